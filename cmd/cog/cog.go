@@ -1,7 +1,14 @@
 package main
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"github.com/replicate/cog/pkg/cli"
+	"github.com/replicate/cog/pkg/telemetry"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
@@ -11,7 +18,24 @@ func main() {
 		console.Fatalf("%f", err)
 	}
 
-	if err = cmd.Execute(); err != nil {
-		console.Fatalf("%s", err)
+	// Ctrl-C cancels the command's context, so builds are stopped and containers are cleaned up. Pressing it again
+	// exits straight away.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	start := time.Now()
+	executed, err := cmd.ExecuteContextC(ctx)
+	if executed != nil {
+		telemetry.Record(executed.CommandPath(), time.Since(start), err)
+	}
+	if err != nil {
+		console.Error(err.Error())
+		if hint := cli.RemediationHint(err); hint != "" {
+			console.Info(hint)
+		}
+		os.Exit(cli.ExitCode(err))
 	}
 }
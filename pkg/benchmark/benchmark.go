@@ -0,0 +1,111 @@
+// Package benchmark summarizes how long a model's predictions took, and the resources they used, from the metrics
+// the model's server returns with each prediction.
+package benchmark
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Run is a prediction that was run in a benchmark
+type Run struct {
+	// Latency is how long the prediction took, as measured by the client
+	Latency time.Duration
+	// Metrics are the prediction's metrics, like predict_time, cpu_time, gpu_time and energy
+	Metrics map[string]float64
+}
+
+// Stats summarizes a metric across predictions. Predictions without the metric are left out, so Count is 0 if none
+// had it.
+type Stats struct {
+	Count int
+	Mean  float64
+	P50   float64
+	P95   float64
+	Max   float64
+	Total float64
+}
+
+// Summary summarizes a benchmark's predictions
+type Summary struct {
+	Predictions int
+	Latency     Stats
+	PredictTime Stats
+	// CPUTime is the CPU time predictions used, in seconds
+	CPUTime Stats
+	// GPUTime is how long predictions held GPUs for, in GPU-seconds
+	GPUTime Stats
+	// Energy is the energy GPUs and CPUs used while predictions ran, in joules, where it could be measured
+	Energy Stats
+}
+
+// Prices are what resources cost, to estimate what predictions cost
+type Prices struct {
+	GPUHour float64
+	CPUHour float64
+	KWh     float64
+}
+
+// IsZero returns whether no prices were set
+func (p Prices) IsZero() bool {
+	return p.GPUHour == 0 && p.CPUHour == 0 && p.KWh == 0
+}
+
+// Summarize summarizes the predictions run in a benchmark
+func Summarize(runs []Run) Summary {
+	latencies := make([]float64, len(runs))
+	for i, run := range runs {
+		latencies[i] = run.Latency.Seconds()
+	}
+	return Summary{
+		Predictions: len(runs),
+		Latency:     newStats(latencies),
+		PredictTime: metricStats(runs, "predict_time"),
+		CPUTime:     metricStats(runs, "cpu_time"),
+		GPUTime:     metricStats(runs, "gpu_time"),
+		Energy:      metricStats(runs, "energy"),
+	}
+}
+
+// Cost returns an estimate of what a prediction cost on average at prices, from the mean of the resources
+// predictions used
+func (s Summary) Cost(prices Prices) float64 {
+	return s.CPUTime.Mean/3600*prices.CPUHour + s.GPUTime.Mean/3600*prices.GPUHour + s.Energy.Mean/3.6e6*prices.KWh
+}
+
+func metricStats(runs []Run, name string) Stats {
+	values := []float64{}
+	for _, run := range runs {
+		if value, ok := run.Metrics[name]; ok {
+			values = append(values, value)
+		}
+	}
+	return newStats(values)
+}
+
+func newStats(values []float64) Stats {
+	if len(values) == 0 {
+		return Stats{}
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	total := 0.0
+	for _, v := range sorted {
+		total += v
+	}
+	return Stats{
+		Count: len(sorted),
+		Mean:  total / float64(len(sorted)),
+		P50:   percentile(sorted, 0.5),
+		P95:   percentile(sorted, 0.95),
+		Max:   sorted[len(sorted)-1],
+		Total: total,
+	}
+}
+
+// percentile returns the p percentile of sorted values, by the nearest-rank method
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
@@ -0,0 +1,45 @@
+package benchmark
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarize(t *testing.T) {
+	runs := []Run{}
+	for i := 1; i <= 20; i++ {
+		runs = append(runs, Run{
+			Latency: time.Duration(i) * time.Second,
+			Metrics: map[string]float64{"predict_time": float64(i) - 0.5, "cpu_time": 2, "gpu_time": 4},
+		})
+	}
+	// Energy couldn't be measured for most of them
+	runs[0].Metrics["energy"] = 3600
+
+	summary := Summarize(runs)
+	require.Equal(t, 20, summary.Predictions)
+	require.Equal(t, Stats{Count: 20, Mean: 10.5, P50: 10, P95: 19, Max: 20, Total: 210}, summary.Latency)
+	require.Equal(t, 19.5, summary.PredictTime.Max)
+	require.Equal(t, Stats{Count: 20, Mean: 2, P50: 2, P95: 2, Max: 2, Total: 40}, summary.CPUTime)
+	require.Equal(t, 80.0, summary.GPUTime.Total)
+	require.Equal(t, 1, summary.Energy.Count)
+}
+
+func TestSummarizeWithoutMetrics(t *testing.T) {
+	summary := Summarize([]Run{{Latency: time.Second}})
+	require.Equal(t, Stats{Count: 1, Mean: 1, P50: 1, P95: 1, Max: 1, Total: 1}, summary.Latency)
+	require.Equal(t, Stats{}, summary.GPUTime)
+	require.Equal(t, Stats{}, summary.Energy)
+}
+
+func TestCost(t *testing.T) {
+	summary := Summary{
+		CPUTime: Stats{Mean: 7200},
+		GPUTime: Stats{Mean: 1800},
+		Energy:  Stats{Mean: 3.6e6},
+	}
+	require.InDelta(t, 2*0.05+0.5*2.0+1*0.1, summary.Cost(Prices{CPUHour: 0.05, GPUHour: 2, KWh: 0.1}), 1e-9)
+	require.True(t, Prices{}.IsZero())
+}
@@ -0,0 +1,296 @@
+// Package bento imports Bentos, the models BentoML builds, by generating a cog.yaml and a predictor that serves the
+// Bento with BentoML and calls one of its APIs. It reads the Bento's environment and APIs from its bento.yaml.
+package bento
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/importer"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// ConfigFile is the file in a Bento that describes it
+const ConfigFile = "bento.yaml"
+
+// BentoDir is the directory in the project the Bento is copied to, which the predictor serves it from
+const BentoDir = "bento"
+
+// Param is an argument of an API of a Bento built with BentoML 1.2 or later
+type Param struct {
+	Name string
+	// Type is the argument's JSON schema type, like string or integer
+	Type string
+	// Format is the argument's JSON schema format, which is binary or an image for files
+	Format   string
+	Default  any
+	Required bool
+}
+
+// API is an API the Bento serves
+type API struct {
+	Name string
+	// Route is the path the Bento's server serves the API at, like /classify
+	Route string
+	// InputType is the input's IO descriptor in Bentos built with BentoML 1.1 and earlier, like NumpyNdarray, JSON or
+	// Image. It's empty in later Bentos, whose APIs have Params.
+	InputType string
+	Params    []Param
+}
+
+// Bento is a model built with BentoML
+type Bento struct {
+	Name           string
+	Version        string
+	BentoMLVersion string
+	// PythonVersion is the version of Python the Bento was built with, like 3.10.12
+	PythonVersion  string
+	Requirements   []string
+	SystemPackages []string
+	APIs           []API
+	// HasWheels is whether the Bento has Python wheels of its own, which aren't installed
+	HasWheels bool
+	// HasSetupScript is whether the Bento has a setup script for its Docker image, which isn't run
+	HasSetupScript bool
+}
+
+type bentoConfig struct {
+	Name           string `yaml:"name"`
+	Version        string `yaml:"version"`
+	BentoMLVersion string `yaml:"bentoml_version"`
+	APIs           []struct {
+		Name      string `yaml:"name"`
+		Route     string `yaml:"route"`
+		InputType string `yaml:"input_type"`
+	} `yaml:"apis"`
+	Docker struct {
+		// PythonVersion is a string, so versions like 3.10 aren't read as numbers
+		PythonVersion  string   `yaml:"python_version"`
+		SystemPackages []string `yaml:"system_packages"`
+		SetupScript    string   `yaml:"setup_script"`
+	} `yaml:"docker"`
+	Python struct {
+		Packages []string `yaml:"packages"`
+	} `yaml:"python"`
+	Schema struct {
+		Routes []struct {
+			Name  string    `yaml:"name"`
+			Route string    `yaml:"route"`
+			Input yaml.Node `yaml:"input"`
+		} `yaml:"routes"`
+	} `yaml:"schema"`
+}
+
+// Read reads the Bento in a directory
+func Read(dir string) (*Bento, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, ConfigFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s isn't a Bento, because it hasn't got a %s file", dir, ConfigFile)
+	} else if err != nil {
+		return nil, err
+	}
+	config := bentoConfig{}
+	if err := yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", ConfigFile, err)
+	}
+
+	b := &Bento{
+		Name:           config.Name,
+		Version:        config.Version,
+		BentoMLVersion: config.BentoMLVersion,
+		PythonVersion:  config.Docker.PythonVersion,
+		SystemPackages: config.Docker.SystemPackages,
+		HasSetupScript: config.Docker.SetupScript != "",
+	}
+	if version, err := os.ReadFile(filepath.Join(dir, "env", "python", "version.txt")); err == nil {
+		b.PythonVersion = strings.TrimSpace(string(version))
+	}
+	if requirements, err := os.ReadFile(filepath.Join(dir, "env", "python", "requirements.txt")); err == nil {
+		b.Requirements = importer.RequirementLines(string(requirements))
+	} else {
+		b.Requirements = config.Python.Packages
+	}
+	if wheels, _ := filepath.Glob(filepath.Join(dir, "env", "python", "wheels", "*.whl")); len(wheels) > 0 {
+		b.HasWheels = true
+	}
+
+	// Bentos built with BentoML 1.2 and later have a JSON schema for each API's arguments
+	for _, route := range config.Schema.Routes {
+		params, err := schemaParams(&route.Input)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse the input of the Bento's %s API: %w", route.Name, err)
+		}
+		b.APIs = append(b.APIs, API{Name: route.Name, Route: routeOr(route.Route, route.Name), Params: params})
+	}
+	if len(config.Schema.Routes) == 0 {
+		for _, api := range config.APIs {
+			b.APIs = append(b.APIs, API{Name: api.Name, Route: routeOr(api.Route, api.Name), InputType: api.InputType})
+		}
+	}
+	if len(b.APIs) == 0 {
+		return nil, fmt.Errorf("The Bento hasn't got any APIs")
+	}
+	return b, nil
+}
+
+func routeOr(route string, name string) string {
+	if route == "" {
+		return "/" + name
+	}
+	return route
+}
+
+// schemaParams returns the arguments in an API's input schema, in the order they're defined in, which is the order
+// of the properties in bento.yaml
+func schemaParams(input *yaml.Node) ([]Param, error) {
+	schema := struct {
+		Properties yaml.Node `yaml:"properties"`
+		Required   []string  `yaml:"required"`
+	}{}
+	if input.Kind == 0 {
+		return nil, nil
+	}
+	if err := input.Decode(&schema); err != nil {
+		return nil, err
+	}
+	required := map[string]bool{}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	params := []Param{}
+	for i := 0; i+1 < len(schema.Properties.Content); i += 2 {
+		property := struct {
+			Type    string `yaml:"type"`
+			Format  string `yaml:"format"`
+			Default any    `yaml:"default"`
+		}{}
+		if err := schema.Properties.Content[i+1].Decode(&property); err != nil {
+			return nil, err
+		}
+		name := schema.Properties.Content[i].Value
+		params = append(params, Param{Name: name, Type: property.Type, Format: property.Format, Default: property.Default, Required: required[name]})
+	}
+	return params, nil
+}
+
+// Environment returns what the Bento needs to run, which is its requirements and BentoML
+func (b *Bento) Environment() importer.Environment {
+	bentoml := "bentoml"
+	if b.BentoMLVersion != "" {
+		bentoml = "bentoml==" + b.BentoMLVersion
+	}
+	return importer.Environment{
+		PythonVersion:  b.PythonVersion,
+		Requirements:   importer.AddRequirements(b.Requirements, bentoml),
+		SystemPackages: b.SystemPackages,
+	}
+}
+
+// API returns the Bento's API with a name, or its first one if the name is empty
+func (b *Bento) API(name string) (API, error) {
+	if name == "" {
+		return b.APIs[0], nil
+	}
+	names := []string{}
+	for _, api := range b.APIs {
+		if api.Name == name {
+			return api, nil
+		}
+		names = append(names, api.Name)
+	}
+	return API{}, fmt.Errorf("The Bento hasn't got an API named %s. Its APIs are %s", name, strings.Join(names, ", "))
+}
+
+// Path returns the directory of a Bento in BentoML's store, from its tag, like iris_classifier:latest. The store is
+// in $BENTOML_HOME, or ~/bentoml.
+func Path(tag string) (string, error) {
+	home := os.Getenv("BENTOML_HOME")
+	if home == "" {
+		userHome, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		home = filepath.Join(userHome, "bentoml")
+	}
+	name, version, _ := strings.Cut(tag, ":")
+	if version == "" || version == "latest" {
+		// The store has a file with the latest version of each Bento
+		latest, err := os.ReadFile(filepath.Join(home, "bentos", name, "latest"))
+		if err != nil {
+			return "", fmt.Errorf("Failed to find the Bento %s in %s: %w", tag, home, err)
+		}
+		version = strings.TrimSpace(string(latest))
+	}
+	dir := filepath.Join(home, "bentos", name, version)
+	if exists, err := files.Exists(filepath.Join(dir, ConfigFile)); err != nil {
+		return "", err
+	} else if !exists {
+		return "", fmt.Errorf("Failed to find the Bento %s in %s", tag, home)
+	}
+	return dir, nil
+}
+
+// Extract extracts a Bento that's been exported with 'bentoml export', which is a tar file that may be compressed
+// with gzip, to a directory
+func Extract(path string, dst string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if magic, err := r.(*bufio.Reader).Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Failed to read %s: %w", path, err)
+		}
+		target := filepath.Join(dst, header.Name)
+		if !strings.HasPrefix(target, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("%s has a file outside the Bento, %s", path, header.Name)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0o755|0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil { //#nosec G110
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package bento
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testBentoYaml = `service: service:Summarization
+name: summarization
+version: ydikwscvcgzptfhs
+bentoml_version: 1.2.16
+creation_time: '2024-05-28T09:12:35.520000+00:00'
+docker:
+  distro: debian
+  python_version: '3.11'
+  system_packages:
+  - ffmpeg
+python:
+  packages:
+  - torch
+  - transformers
+schema:
+  name: Summarization
+  type: service
+  routes:
+  - name: summarize
+    route: /summarize
+    batchable: false
+    input:
+      properties:
+        text:
+          title: Text
+          type: string
+        max_length:
+          default: 100
+          title: Max Length
+          type: integer
+        options:
+          title: Options
+          type: object
+        audio:
+          format: binary
+          title: Audio
+          type: file
+      required:
+      - text
+      title: Input
+      type: object
+    output:
+      title: strIODescriptor
+      type: string
+`
+
+const testLegacyBentoYaml = `service: service:svc
+name: iris_classifier
+version: 5yzr2hqkdcvfenbt
+bentoml_version: 1.1.11
+apis:
+- name: classify
+  input_type: NumpyNdarray
+  output_type: NumpyNdarray
+- name: upload
+  input_type: Multipart
+  output_type: JSON
+`
+
+func writeBento(t *testing.T, bentoYaml string, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	files[ConfigFile] = bentoYaml
+	for name, contents := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+	}
+	return dir
+}
+
+func TestRead(t *testing.T) {
+	dir := writeBento(t, testBentoYaml, map[string]string{
+		"env/python/version.txt":      "3.11.9\n",
+		"env/python/requirements.txt": "torch==2.3.0\ntransformers==4.41.1\n",
+	})
+	b, err := Read(dir)
+	require.NoError(t, err)
+	require.Equal(t, "summarization", b.Name)
+	require.Equal(t, "3.11.9", b.PythonVersion)
+	require.Equal(t, []API{{
+		Name:  "summarize",
+		Route: "/summarize",
+		Params: []Param{
+			{Name: "text", Type: "string", Required: true},
+			{Name: "max_length", Type: "integer", Default: 100},
+			{Name: "options", Type: "object"},
+			{Name: "audio", Type: "file", Format: "binary"},
+		},
+	}}, b.APIs)
+
+	env := b.Environment()
+	require.Equal(t, []string{"torch==2.3.0", "transformers==4.41.1", "bentoml==1.2.16"}, env.Requirements)
+	require.Equal(t, []string{"ffmpeg"}, env.SystemPackages)
+}
+
+func TestReadLegacy(t *testing.T) {
+	dir := writeBento(t, testLegacyBentoYaml, map[string]string{})
+	b, err := Read(dir)
+	require.NoError(t, err)
+	require.Equal(t, []API{
+		{Name: "classify", Route: "/classify", InputType: "NumpyNdarray"},
+		{Name: "upload", Route: "/upload", InputType: "Multipart"},
+	}, b.APIs)
+
+	api, err := b.API("")
+	require.NoError(t, err)
+	require.Equal(t, "classify", api.Name)
+	_, err = b.API("predict")
+	require.ErrorContains(t, err, "Its APIs are classify, upload")
+
+	_, err = Read(t.TempDir())
+	require.ErrorContains(t, err, "isn't a Bento")
+}
+
+func TestPredictor(t *testing.T) {
+	dir := writeBento(t, testBentoYaml, map[string]string{})
+	b, err := Read(dir)
+	require.NoError(t, err)
+	predictor, err := Predictor(b.APIs[0])
+	require.NoError(t, err)
+	require.Contains(t, string(predictor), `ROUTE = "/summarize"`)
+	require.Contains(t, string(predictor), `
+    def predict(
+        self,
+        text: str = Input(description="text"),
+        max_length: int = Input(description="max length", default=100),
+        options: str = Input(description="options, as JSON", default=None),
+        audio: Path = Input(description="audio", default=None),
+    ) -> Any:
+        """Run a single prediction on the model"""
+        arguments = {
+            "text": text,
+            "max_length": max_length,
+            "options": None if options is None else json.loads(options),
+            "audio": audio,
+        }
+        return call(*encode_arguments(arguments))
+`)
+
+	predictor, err = Predictor(API{Name: "classify", Route: "/classify", InputType: "NumpyNdarray"})
+	require.NoError(t, err)
+	require.NotContains(t, string(predictor), "def encode_arguments")
+	require.Contains(t, string(predictor), `        input: str = Input(description="The API's input, as JSON"),`)
+	require.Contains(t, string(predictor), `        return call(input.encode(), "application/json")`)
+
+	_, err = Predictor(API{Name: "upload", Route: "/upload", InputType: "Multipart"})
+	require.ErrorContains(t, err, "Choose another API")
+}
+
+func TestExtract(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "iris_classifier.bento")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for name, contents := range map[string]string{ConfigFile: testLegacyBentoYaml, "src/service.py": "import bentoml\n"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	require.NoError(t, f.Close())
+
+	dst := t.TempDir()
+	require.NoError(t, Extract(archive, dst))
+	b, err := Read(dst)
+	require.NoError(t, err)
+	require.Equal(t, "iris_classifier", b.Name)
+	require.FileExists(t, filepath.Join(dst, "src", "service.py"))
+}
@@ -0,0 +1,131 @@
+package bento
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+//go:embed templates/predict.py.tmpl
+var predictorTemplate string
+
+// The ways the predictor sends its inputs to the API
+const (
+	// bodyArguments is a JSON object of the API's arguments, or a form if any of them are files, for Bentos built
+	// with BentoML 1.2 and later
+	bodyArguments = "arguments"
+	// bodyJSON, bodyText and bodyFile are the input as it is, for Bentos built with BentoML 1.1 and earlier
+	bodyJSON = "json"
+	bodyText = "text"
+	bodyFile = "file"
+)
+
+// inputTypeBodies are how the predictor sends the input of APIs in Bentos built with BentoML 1.1 and earlier, by
+// their input's IO descriptor
+var inputTypeBodies = map[string]string{
+	"JSON":            bodyJSON,
+	"NumpyNdarray":    bodyJSON,
+	"PandasDataFrame": bodyJSON,
+	"PandasSeries":    bodyJSON,
+	"Text":            bodyText,
+	"Image":           bodyFile,
+	"File":            bodyFile,
+}
+
+// paramTypes are the Python types of inputs for the JSON schema types of arguments. Arguments of other types, like
+// lists and objects, are inputs that are JSON.
+var paramTypes = map[string]string{
+	"string":  "str",
+	"integer": "int",
+	"number":  "float",
+	"boolean": "bool",
+}
+
+type predictorInput struct {
+	// Name is the API's argument
+	Name string
+	// Param is the name of the predictor's input
+	Param string
+	Type  string
+	// Args are the arguments of the input's Input()
+	Args string
+	// Value is the Python expression for the argument's value
+	Value string
+}
+
+// Predictor returns a predictor that serves the Bento with BentoML, and runs predictions with one of its APIs
+func Predictor(api API) ([]byte, error) {
+	tmpl, err := template.New("predict.py").Parse(predictorTemplate)
+	if err != nil {
+		return nil, err
+	}
+	body := bodyArguments
+	inputs := []predictorInput{}
+	if api.InputType != "" {
+		var ok bool
+		if body, ok = inputTypeBodies[api.InputType]; !ok {
+			return nil, fmt.Errorf("The Bento's %s API takes %s input, which the predictor can't send it. Choose another API with --api", api.Name, api.InputType)
+		}
+		switch body {
+		case bodyJSON:
+			inputs = append(inputs, predictorInput{Param: "input", Type: "str", Args: `description="The API's input, as JSON"`})
+		case bodyText:
+			inputs = append(inputs, predictorInput{Param: "text", Type: "str", Args: `description="The API's input text"`})
+		case bodyFile:
+			inputs = append(inputs, predictorInput{Param: "file", Type: "Path", Args: `description="The API's input file"`})
+		}
+	} else {
+		for _, param := range api.Params {
+			inputs = append(inputs, paramInput(param))
+		}
+	}
+
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]any{
+		"BentoDir": BentoDir,
+		"API":      api,
+		"Body":     body,
+		"Inputs":   inputs,
+	}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// paramInput returns the predictor's input for an argument of an API
+func paramInput(param Param) predictorInput {
+	input := predictorInput{Name: param.Name, Param: param.Name, Value: param.Name}
+	args := []string{"description=" + strconv.Quote(strings.ReplaceAll(param.Name, "_", " "))}
+	pythonType, ok := paramTypes[param.Type]
+	switch {
+	case param.Type == "file" || param.Format == "binary" || param.Format == "image":
+		input.Type = "Path"
+	case ok:
+		input.Type = pythonType
+		if literal, ok := cogschema.PythonLiteral(param.Default); ok {
+			args = append(args, "default="+literal)
+		}
+	default:
+		input.Type = "str"
+		input.Value = fmt.Sprintf("None if %s is None else json.loads(%s)", param.Name, param.Name)
+		args[0] = "description=" + strconv.Quote(strings.ReplaceAll(param.Name, "_", " ")+", as JSON")
+		if param.Default != nil {
+			if j, err := json.Marshal(param.Default); err == nil {
+				args = append(args, "default="+strconv.Quote(string(j)))
+			}
+		}
+	}
+	if len(args) == 1 && !param.Required {
+		// The API's default is used if the input isn't set
+		args = append(args, "default=None")
+	}
+	input.Args = strings.Join(args, ", ")
+	return input
+}
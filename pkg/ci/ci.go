@@ -0,0 +1,118 @@
+// Package ci makes Cog's output fit in with CI systems, like GitHub Actions: it groups the output of each step of a
+// build, annotates errors with the files and lines they're about, and writes a summary of what was built.
+package ci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// The CI systems Cog's output can be made for
+const (
+	// GitHubActions is GitHub Actions, with workflow commands
+	GitHubActions = "github-actions"
+)
+
+// Systems are the names of the CI systems, for flags' help
+var Systems = []string{GitHubActions}
+
+// Reporter writes output for a CI system
+type Reporter interface {
+	// StartGroup starts a group of output with a title, which can be collapsed. Call the function it returns to end
+	// it.
+	StartGroup(title string) func()
+	// Annotate reports an error, on a file and line if it's about one
+	Annotate(annotation Annotation)
+	// Summary adds Markdown to the job's summary
+	Summary(markdown string) error
+}
+
+// Annotation is an error that's shown on a file and line, if it's about one
+type Annotation struct {
+	// File is relative to the root of the repository, or "" if the error isn't about a file
+	File string
+	// Line is the line in the file, starting from 1, or 0 if it isn't about a line
+	Line    int
+	Title   string
+	Message string
+}
+
+// NewReporter returns the reporter for a CI system, or nil if system is ""
+func NewReporter(system string) (Reporter, error) {
+	switch system {
+	case "":
+		return nil, nil
+	case GitHubActions:
+		// Workflow commands are written with the rest of the output, so they stay in order with it
+		return newGitHubActionsReporter(console.Writer(), os.Getenv("GITHUB_STEP_SUMMARY")), nil
+	}
+	return nil, fmt.Errorf("Unknown CI system %q, expected %s", system, strings.Join(Systems, " or "))
+}
+
+type reporterKey struct{}
+
+// WithReporter returns a context that makes what it's passed to report to r
+func WithReporter(ctx context.Context, r Reporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, r)
+}
+
+// StartGroup starts a group of output with a title, if ctx has a reporter. Call the function it returns to end it.
+func StartGroup(ctx context.Context, title string) func() {
+	if r, ok := ctx.Value(reporterKey{}).(Reporter); ok && r != nil {
+		return r.StartGroup(title)
+	}
+	return func() {}
+}
+
+// fileLinePattern matches errors about a line of a file, like "predict.py:12: Predictor doesn't define predict()"
+var fileLinePattern = regexp.MustCompile(`^([^\s:]+):(\d+): (.+)$`)
+
+// yamlLinePattern matches the line in YAML parse errors, like "yaml: line 3: mapping values are not allowed"
+var yamlLinePattern = regexp.MustCompile(`\bline (\d+)\b`)
+
+// Annotations returns the annotations for an error from the project in projectDir. Errors about a line of a file
+// are annotated on it, with paths relative to the repository's root, root.
+func Annotations(err error, projectDir string, root string, title string) []Annotation {
+	relativeToRoot := func(path string) string {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(projectDir, path)
+		}
+		if rel, relErr := filepath.Rel(root, path); relErr == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+		return filepath.ToSlash(path)
+	}
+
+	var configErr *cogerrors.ConfigError
+	if errors.As(err, &configErr) {
+		annotation := Annotation{File: relativeToRoot(configErr.Path), Title: title, Message: err.Error()}
+		if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+			annotation.Line, _ = strconv.Atoi(m[1])
+		}
+		return []Annotation{annotation}
+	}
+
+	annotations := []Annotation{}
+	other := []string{}
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if m := fileLinePattern.FindStringSubmatch(line); m != nil {
+			lineNumber, _ := strconv.Atoi(m[2])
+			annotations = append(annotations, Annotation{File: relativeToRoot(m[1]), Line: lineNumber, Title: title, Message: m[3]})
+		} else if strings.TrimSpace(line) != "" {
+			other = append(other, line)
+		}
+	}
+	if len(other) > 0 {
+		annotations = append(annotations, Annotation{Title: title, Message: strings.Join(other, "\n")})
+	}
+	return annotations
+}
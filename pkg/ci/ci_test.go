@@ -0,0 +1,71 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+func TestAnnotations(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "repo")
+	projectDir := filepath.Join(root, "model")
+
+	err := errors.Join(
+		errors.New("predict.py:12: Predictor doesn't define predict(), which 'predict' in cog.yaml needs"),
+		errors.New("train.py doesn't exist. 'train' in cog.yaml must point to a Python file in the project, relative to cog.yaml"),
+	)
+	require.Equal(t, []Annotation{
+		{File: "model/predict.py", Line: 12, Title: "cog build failed", Message: "Predictor doesn't define predict(), which 'predict' in cog.yaml needs"},
+		{Title: "cog build failed", Message: "train.py doesn't exist. 'train' in cog.yaml must point to a Python file in the project, relative to cog.yaml"},
+	}, Annotations(err, projectDir, root, "cog build failed"))
+
+	configErr := &cogerrors.ConfigError{Path: filepath.Join(projectDir, "cog.yaml"), Err: errors.New("yaml: line 3: mapping values are not allowed in this context")}
+	require.Equal(t, []Annotation{
+		{File: "model/cog.yaml", Line: 3, Title: "cog build failed", Message: "Failed to load config: " + configErr.Error()},
+	}, Annotations(fmt.Errorf("Failed to load config: %w", configErr), projectDir, root, "cog build failed"))
+}
+
+func TestGitHubActionsReporter(t *testing.T) {
+	var out bytes.Buffer
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+	reporter := newGitHubActionsReporter(&out, summaryPath)
+
+	ctx := WithReporter(context.Background(), reporter)
+	endGroup := StartGroup(ctx, "Build r8.im/alice/hotdog")
+	out.WriteString("#1 building\n")
+	endGroup()
+	reporter.Annotate(Annotation{File: "model/predict.py", Line: 12, Title: "cog build failed: predict", Message: "first line\nsecond line, 100%"})
+	reporter.Annotate(Annotation{Message: "no file"})
+	require.Equal(t, `::group::Build r8.im/alice/hotdog
+#1 building
+::endgroup::
+::error file=model/predict.py,line=12,title=cog build failed%3A predict::first line%0Asecond line, 100%25
+::error::no file
+`, out.String())
+
+	require.NoError(t, reporter.Summary("### Built"))
+	require.NoError(t, reporter.Summary("| Size | 1GB |"))
+	contents, err := os.ReadFile(summaryPath)
+	require.NoError(t, err)
+	require.Equal(t, "### Built\n| Size | 1GB |\n", string(contents))
+
+	// Without a reporter, groups do nothing
+	StartGroup(context.Background(), "Build")()
+}
+
+func TestNewReporter(t *testing.T) {
+	reporter, err := NewReporter("")
+	require.NoError(t, err)
+	require.Nil(t, reporter)
+
+	_, err = NewReporter("jenkins")
+	require.ErrorContains(t, err, `Unknown CI system "jenkins"`)
+}
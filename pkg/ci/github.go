@@ -0,0 +1,70 @@
+package ci
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// gitHubActionsReporter writes GitHub Actions' workflow commands. See
+// https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/workflow-commands-for-github-actions
+type gitHubActionsReporter struct {
+	out io.Writer
+	// summaryPath is the file in GITHUB_STEP_SUMMARY, which the job's summary is appended to
+	summaryPath string
+}
+
+func newGitHubActionsReporter(out io.Writer, summaryPath string) *gitHubActionsReporter {
+	return &gitHubActionsReporter{out: out, summaryPath: summaryPath}
+}
+
+func (r *gitHubActionsReporter) StartGroup(title string) func() {
+	fmt.Fprintf(r.out, "::group::%s\n", escapeData(title))
+	return func() {
+		fmt.Fprintln(r.out, "::endgroup::")
+	}
+}
+
+func (r *gitHubActionsReporter) Annotate(annotation Annotation) {
+	properties := []string{}
+	if annotation.File != "" {
+		properties = append(properties, "file="+escapeProperty(annotation.File))
+		if annotation.Line > 0 {
+			properties = append(properties, fmt.Sprintf("line=%d", annotation.Line))
+		}
+	}
+	if annotation.Title != "" {
+		properties = append(properties, "title="+escapeProperty(annotation.Title))
+	}
+	command := "::error"
+	if len(properties) > 0 {
+		command += " " + strings.Join(properties, ",")
+	}
+	fmt.Fprintf(r.out, "%s::%s\n", command, escapeData(annotation.Message))
+}
+
+func (r *gitHubActionsReporter) Summary(markdown string) error {
+	if r.summaryPath == "" {
+		return nil
+	}
+	f, err := os.OpenFile(r.summaryPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("Failed to write job summary: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(markdown + "\n"); err != nil {
+		return fmt.Errorf("Failed to write job summary: %w", err)
+	}
+	return f.Close()
+}
+
+// escapeData escapes the message of a workflow command, so newlines don't end it
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes the value of a workflow command's property, so it can have colons and commas in it
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
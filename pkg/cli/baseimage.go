@@ -122,7 +122,7 @@ func newBaseImageBuildCommand() *cobra.Command {
 			}
 			baseImageName := dockerfile.BaseImageName(baseImageCUDAVersion, baseImagePythonVersion, baseImageTorchVersion)
 
-			err = docker.Build(cwd, dockerfileContents, baseImageName, []string{}, buildNoCache, buildProgressOutput, config.BuildSourceEpochTimestamp)
+			err = docker.Build(cmd.Context(), cwd, dockerfileContents, baseImageName, []string{}, nil, buildNoCache, buildProgressOutput, config.BuildSourceEpochTimestamp)
 			if err != nil {
 				return err
 			}
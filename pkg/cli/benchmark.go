@@ -0,0 +1,217 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/benchmark"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	benchmarkPredictions int
+	benchmarkWarmup      int
+	benchmarkCost        bool
+	benchmarkGPUPrice    float64
+	benchmarkCPUPrice    float64
+	benchmarkEnergyPrice float64
+)
+
+func newBenchmarkCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "benchmark [image]",
+		Short: "Measure how long the model's predictions take",
+		Long: `Measure how long the model's predictions take.
+
+Run the same prediction a number of times, after warming the model up, and
+print how long they took: their latency, as measured by Cog, and how long
+predict() took.
+
+With --cost, also print the resources each prediction used, for chargeback:
+CPU time, GPU time, which is how long the GPUs the model can use were held
+for, and energy, where the GPUs and CPUs can measure it. Pass the prices of
+those resources to estimate what a prediction costs.
+
+If 'image' is passed, the model in that image is benchmarked. Otherwise, the
+model in the current directory is built and benchmarked.`,
+		Example: `cog benchmark -i prompt="a photo of a hot dog" -n 20 --cost --gpu-price 1.10`,
+		RunE:    cmdBenchmark,
+		Args:    cobra.MaximumNArgs(1),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().IntVarP(&benchmarkPredictions, "predictions", "n", 10, "Number of predictions to measure")
+	cmd.Flags().IntVar(&benchmarkWarmup, "warmup", 1, "Number of predictions to run before measuring, which aren't counted")
+	cmd.Flags().BoolVar(&benchmarkCost, "cost", false, "Print the CPU time, GPU time and energy each prediction used")
+	cmd.Flags().Float64Var(&benchmarkGPUPrice, "gpu-price", 0, "With --cost, the price of a GPU for an hour, to estimate what a prediction costs")
+	cmd.Flags().Float64Var(&benchmarkCPUPrice, "cpu-price", 0, "With --cost, the price of a CPU core for an hour, to estimate what a prediction costs")
+	cmd.Flags().Float64Var(&benchmarkEnergyPrice, "energy-price", 0, "With --cost, the price of a kilowatt-hour of energy, to estimate what a prediction costs")
+
+	return cmd
+}
+
+func cmdBenchmark(cmd *cobra.Command, args []string) error {
+	if benchmarkPredictions < 1 {
+		return fmt.Errorf("--predictions must be at least 1")
+	}
+	if benchmarkWarmup < 0 {
+		return fmt.Errorf("--warmup can't be negative")
+	}
+	prices := benchmark.Prices{GPUHour: benchmarkGPUPrice, CPUHour: benchmarkCPUPrice, KWh: benchmarkEnergyPrice}
+	if prices.GPUHour < 0 || prices.CPUHour < 0 || prices.KWh < 0 {
+		return fmt.Errorf("Prices can't be negative")
+	}
+	if !prices.IsZero() && !benchmarkCost {
+		return fmt.Errorf("--gpu-price, --cpu-price and --energy-price can only be used with --cost")
+	}
+
+	inputs, err := parseInputFlags(inputFlags)
+	if err != nil {
+		return err
+	}
+
+	var cfg *config.Config
+	var projectDir, imageName string
+	volumes := []docker.Volume{}
+	if len(args) == 0 {
+		if cfg, projectDir, err = config.GetConfig(projectDirFlag); err != nil {
+			return err
+		}
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+	} else {
+		imageName = args[0]
+		if err := pullIfMissing(cmd.Context(), imageName); err != nil {
+			return err
+		}
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	}
+
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	runOptions := docker.RunOptions{
+		GPUs:    gpusForConfig(cfg),
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     envFlags,
+		Labels:  containerLabels("predict", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	token, err := addAPIKey(&runOptions, cfg, "")
+	if err != nil {
+		return err
+	}
+	predictor, err := startPredictor(cmd.Context(), runOptions, token, setupTimeoutFor(cmd, cfg))
+	if err != nil {
+		return err
+	}
+	defer stopPredictor(cmd.Context(), predictor)
+
+	runs := []benchmark.Run{}
+	total := benchmarkWarmup + benchmarkPredictions
+	for i := 1; i <= total; i++ {
+		if i <= benchmarkWarmup {
+			console.Infof("Warming up (%d of %d)...", i, benchmarkWarmup)
+		} else {
+			console.Infof("Running prediction %d of %d...", i-benchmarkWarmup, benchmarkPredictions)
+		}
+		start := time.Now()
+		prediction, err := predictor.Predict(cmd.Context(), inputs)
+		if err != nil {
+			return fmt.Errorf("Failed to predict: %w", err)
+		}
+		if prediction.Status == "failed" {
+			return fmt.Errorf("The prediction failed: %s", prediction.Error)
+		}
+		if i > benchmarkWarmup {
+			runs = append(runs, benchmark.Run{Latency: time.Since(start), Metrics: prediction.Metrics})
+		}
+	}
+
+	printBenchmark(benchmark.Summarize(runs), prices)
+	return nil
+}
+
+func printBenchmark(summary benchmark.Summary, prices benchmark.Prices) {
+	console.Output("")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "\tMEAN\tP50\tP95\tMAX")
+	printStats(w, "Latency", summary.Latency, formatSeconds)
+	printStats(w, "Predict time", summary.PredictTime, formatSeconds)
+	_ = w.Flush()
+	if !benchmarkCost {
+		return
+	}
+
+	console.Output("")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "\tPER PREDICTION\tTOTAL")
+	printUsage(w, "CPU time", summary.CPUTime, formatSeconds)
+	printUsage(w, "GPU time", summary.GPUTime, formatSeconds)
+	printUsage(w, "Energy", summary.Energy, formatEnergy)
+	if !prices.IsZero() {
+		cost := summary.Cost(prices)
+		fmt.Fprintf(w, "Estimated cost\t%s\t%s\n", formatCost(cost), formatCost(cost*float64(summary.Predictions)))
+	}
+	_ = w.Flush()
+	if summary.GPUTime.Count == 0 {
+		console.Info("")
+		console.Info("GPU time is only measured when the model has GPUs.")
+	}
+	if summary.Energy.Count < summary.Predictions {
+		console.Info("")
+		console.Info("Energy is only measured on NVIDIA GPUs from Volta onwards, and CPUs whose RAPL counters the model's container can read.")
+	}
+}
+
+func printStats(w *tabwriter.Writer, name string, stats benchmark.Stats, format func(float64) string) {
+	if stats.Count == 0 {
+		fmt.Fprintf(w, "%s\t-\t-\t-\t-\n", name)
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, format(stats.Mean), format(stats.P50), format(stats.P95), format(stats.Max))
+}
+
+func printUsage(w *tabwriter.Writer, name string, stats benchmark.Stats, format func(float64) string) {
+	if stats.Count == 0 {
+		fmt.Fprintf(w, "%s\t-\t-\n", name)
+		return
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\n", name, format(stats.Mean), format(stats.Total))
+}
+
+func formatSeconds(seconds float64) string {
+	return fmt.Sprintf("%.3fs", seconds)
+}
+
+func formatEnergy(joules float64) string {
+	return fmt.Sprintf("%.1f J (%.4f Wh)", joules, joules/3600)
+}
+
+func formatCost(cost float64) string {
+	return fmt.Sprintf("%.6f", cost)
+}
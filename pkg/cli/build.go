@@ -4,18 +4,23 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 
+	"github.com/replicate/cog/pkg/ci"
 	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/lambda"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
 var buildTag string
 var buildSeparateWeights bool
 var buildSecrets []string
+var buildArgs []string
 var buildNoCache bool
 var buildProgressOutput string
 var buildSchemaFile string
@@ -25,6 +30,9 @@ var buildUseCogBaseImage bool
 var buildStrip bool
 var buildPrecompile bool
 var buildFast bool
+var buildPinBaseImage bool
+var buildCI string
+var buildTarget string
 
 const useCogBaseImageFlagKey = "use-cog-base-image"
 
@@ -38,6 +46,7 @@ func newBuildCommand() *cobra.Command {
 	}
 	addBuildProgressOutputFlag(cmd)
 	addSecretsFlag(cmd)
+	addBuildArgFlag(cmd)
 	addNoCacheFlag(cmd)
 	addSeparateWeightsFlag(cmd)
 	addSchemaFlag(cmd)
@@ -48,15 +57,41 @@ func newBuildCommand() *cobra.Command {
 	addStripFlag(cmd)
 	addPrecompileFlag(cmd)
 	addFastFlag(cmd)
+	addPinBaseImageFlag(cmd)
+	addDryRunFlag(cmd)
 	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+	cmd.Flags().StringVar(&buildTarget, "target", "", "Build the model to run on a platform other than a server, in place of build.target in cog.yaml: '"+config.TargetLambda+"'")
+	cmd.Flags().StringVar(&buildCI, "ci", "", "Format the output for a CI system: '"+strings.Join(ci.Systems, "' or '")+"'. This groups the output, annotates errors, and writes a summary of the build")
 	return cmd
 }
 
-func buildCommand(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+func buildCommand(cmd *cobra.Command, args []string) (err error) {
+	reporter, err := ci.NewReporter(buildCI)
 	if err != nil {
 		return err
 	}
+	projectDir := ""
+	if reporter != nil {
+		defer func() {
+			if err != nil {
+				reportBuildFailure(reporter, err, projectDir)
+			}
+		}()
+	}
+
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(projectDirFlag, buildArgs)
+	if err != nil {
+		return err
+	}
+	if buildTarget != "" {
+		// Devices are set in cog.yaml, because the versions of Python and CUDA depend on them
+		if buildTarget != config.TargetLambda {
+			return fmt.Errorf("Invalid --target %q, expected '%s'. Set build.target in cog.yaml to build for a device", buildTarget, config.TargetLambda)
+		}
+		if err := cfg.SetTarget(buildTarget); err != nil {
+			return err
+		}
+	}
 
 	imageName := cfg.Image
 	if buildTag != "" {
@@ -71,11 +106,38 @@ func buildCommand(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildSecrets, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, buildSchemaFile, buildDockerfileFile, DetermineUseCogBaseImage(cmd), buildStrip, buildPrecompile, buildFast); err != nil {
+	if dryRun {
+		operations, err := printBuildPlan(cmd, cfg, projectDir, imageName)
+		if err != nil {
+			return err
+		}
+		printOperations(operations)
+		return nil
+	}
+
+	ctx := cmd.Context()
+	if reporter != nil {
+		ctx = ci.WithReporter(ctx, reporter)
+	}
+	start := time.Now()
+	if err := image.Build(ctx, cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, buildSchemaFile, buildDockerfileFile, DetermineUseCogBaseImage(cmd), buildStrip, buildPrecompile, buildFast, buildPinBaseImage); err != nil {
 		return err
 	}
 
+	if cfg.Build.Target == config.TargetLambda {
+		inspect, err := docker.ImageInspect(ctx, imageName)
+		if err != nil {
+			return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+		}
+		if err := lambda.CheckImageSize(imageName, inspect.Size); err != nil {
+			return err
+		}
+	}
+
 	console.Infof("\nImage built as %s", imageName)
+	if reporter != nil {
+		reportBuild(ctx, reporter, imageName, time.Since(start))
+	}
 
 	return nil
 }
@@ -92,6 +154,10 @@ func addSecretsFlag(cmd *cobra.Command) {
 	cmd.Flags().StringArrayVar(&buildSecrets, "secret", []string{}, "Secrets to pass to the build environment in the form 'id=foo,src=/path/to/file'")
 }
 
+func addBuildArgFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&buildArgs, "build-arg", []string{}, "Set a build arg in build.args in cog.yaml, in the form 'KEY=VALUE'")
+}
+
 func addNoCacheFlag(cmd *cobra.Command) {
 	cmd.Flags().BoolVar(&buildNoCache, "no-cache", false, "Do not use cache when building the image")
 }
@@ -144,6 +210,10 @@ func addFastFlag(cmd *cobra.Command) {
 	_ = cmd.Flags().MarkHidden(fastFlag)
 }
 
+func addPinBaseImageFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&buildPinBaseImage, "pin-base-image", true, "Pin the base image to a digest in "+image.BuildManifestPath+" the first time it's built, so later builds use the same base image. 'false' builds on whatever its tag points to")
+}
+
 func checkMutuallyExclusiveFlags(cmd *cobra.Command, args []string) error {
 	flags := []string{useCogBaseImageFlagKey, "use-cuda-base-image", "dockerfile"}
 	var flagsSet []string
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/debugbundle"
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var bundleDebugOutput string
+
+func newBundleDebugCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle-debug",
+		Short: "Collect information for a bug report into a tarball",
+		Long: `Collect information for a bug report into a tarball.
+
+This collects the generated Dockerfile, the config after Cog has filled in its
+defaults, the log of the last build, the versions of Docker and the NVIDIA driver,
+and information about your environment. Values that look like secrets, like tokens
+and passwords, are replaced with [REDACTED].
+
+Attach the tarball to your bug report, but look through it first to check there's
+nothing in it you don't want to share.`,
+		Args: cobra.NoArgs,
+		RunE: cmdBundleDebug,
+	}
+	cmd.Flags().StringVarP(&bundleDebugOutput, "output", "o", "", "The path to write the tarball to (default: cog-debug-<time>.tar.gz)")
+	return cmd
+}
+
+func cmdBundleDebug(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	switch {
+	case cogerrors.IsConfigNotFound(err):
+		console.Warnf("%s, so the bundle won't have the config, Dockerfile or build log", err)
+		cfg = nil
+	case err != nil && cfg == nil:
+		return err
+	case err != nil:
+		console.Warnf("The config is invalid, so some files may be missing from the bundle: %s", err)
+	}
+
+	name := "cog-debug-" + time.Now().Format("20060102-150405")
+	output := bundleDebugOutput
+	if output == "" {
+		output = name + ".tar.gz"
+	} else {
+		name = strings.TrimSuffix(strings.TrimSuffix(filepath.Base(output), ".tgz"), ".tar.gz")
+	}
+
+	console.Info("Collecting debugging information...")
+	files := debugbundle.Collect(cmd.Context(), cfg, projectDir)
+
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", output, err)
+	}
+	defer f.Close()
+	if err := debugbundle.Write(f, name, files); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", output, err)
+	}
+
+	console.Infof("Wrote %s. Secrets that Cog could find have been redacted, but look through it before you attach it to a bug report.", output)
+	return nil
+}
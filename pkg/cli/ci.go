@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/ci"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ciRoot returns the root of the repository that CI checked out, which annotations' paths are relative to
+func ciRoot() string {
+	if workspace := os.Getenv("GITHUB_WORKSPACE"); workspace != "" {
+		return workspace
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "."
+	}
+	return cwd
+}
+
+// reportBuildFailure annotates the error a build failed with, and adds it to the job's summary
+func reportBuildFailure(reporter ci.Reporter, err error, projectDir string) {
+	if projectDir == "" {
+		projectDir = ciRoot()
+	}
+	for _, annotation := range ci.Annotations(err, projectDir, ciRoot(), "cog build failed") {
+		reporter.Annotate(annotation)
+	}
+	summary := fmt.Sprintf("### ❌ Build failed\n\n```\n%s\n```\n", err)
+	if hint := RemediationHint(err); hint != "" {
+		summary += "\n" + hint + "\n"
+	}
+	if summaryErr := reporter.Summary(summary); summaryErr != nil {
+		console.Warn(summaryErr.Error())
+	}
+}
+
+// reportBuild adds the image that was built to the job's summary
+func reportBuild(ctx context.Context, reporter ci.Reporter, imageName string, duration time.Duration) {
+	rows := [][2]string{{"Image", "`" + imageName + "`"}}
+	if inspect, err := docker.ImageInspect(ctx, imageName); err == nil {
+		rows = append(rows, [2]string{"Image ID", "`" + inspect.ID + "`"}, [2]string{"Size", units.HumanSize(float64(inspect.Size))})
+	} else {
+		console.Debugf("Failed to inspect %s: %s", imageName, err)
+	}
+	rows = append(rows, [2]string{"Build time", duration.Round(time.Second).String()}, [2]string{"Cog version", global.Version})
+
+	var b strings.Builder
+	b.WriteString("### ✅ Built " + imageName + "\n\n| | |\n| --- | --- |\n")
+	for _, row := range rows {
+		fmt.Fprintf(&b, "| %s | %s |\n", row[0], row[1])
+	}
+	if err := reporter.Summary(b.String()); err != nil {
+		console.Warn(err.Error())
+	}
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/client"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	clientLang   string
+	clientOutput string
+)
+
+func newClientCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "client",
+		Short: "Generate clients for the model's HTTP API",
+	}
+	cmd.AddCommand(newClientGenerateCommand())
+	return cmd
+}
+
+func newClientGenerateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate [image]",
+		Short: "Generate a typed client for the model's HTTP API, in Python or TypeScript",
+		Long: `Generate a typed client for the model's HTTP API from its schema, so apps can
+run predictions with it without writing the HTTP requests themselves.
+
+The client has a predict method that takes the model's inputs and returns its
+output, with their types, and sends local files as data URLs. The Python
+client has a Client and an AsyncClient, for asyncio, and uses httpx. The
+TypeScript client uses fetch.
+
+If 'image' is passed, the client is for that image. Otherwise, it's for the
+image built from the current directory by 'cog build'. Generate it again when
+the model's inputs or output change.`,
+		Example: `cog client generate --lang python -o app/model_client.py
+cog client generate r8.im/alice/hotdog-detector --lang typescript`,
+		RunE: cmdClientGenerate,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().StringVar(&clientLang, "lang", "python", "Language to generate the client in: "+strings.Join(client.Languages, ", "))
+	cmd.Flags().StringVarP(&clientOutput, "output", "o", "", "Path to write the client to. Defaults to client.py or client.ts")
+
+	return cmd
+}
+
+func cmdClientGenerate(cmd *cobra.Command, args []string) error {
+	var imageName string
+	if len(args) == 0 {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+	} else {
+		imageName = args[0]
+	}
+
+	schema, err := image.GetOpenAPISchema(cmd.Context(), imageName)
+	if err != nil {
+		if len(args) == 0 {
+			return fmt.Errorf("Failed to read the model's schema from %s. Build it with 'cog build' first: %w", imageName, err)
+		}
+		return err
+	}
+	contents, err := client.Generate(schema, clientLang, imageName)
+	if err != nil {
+		return err
+	}
+
+	output := clientOutput
+	if output == "" {
+		output = client.Files[clientLang]
+	}
+	if err := os.WriteFile(output, contents, 0o644); err != nil { //#nosec G306
+		return fmt.Errorf("Failed to write %s: %w", output, err)
+	}
+	console.Infof("Wrote %s", output)
+	return nil
+}
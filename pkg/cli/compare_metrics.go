@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/metrics"
+)
+
+var compareMetricsToken string
+
+func newCompareMetricsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compare-metrics <stable-url> <canary-url>",
+		Short: "Compare the prediction metrics of two versions of a model",
+		Long: `Compare the prediction metrics of two running versions of a model, like a canary
+and the version it's replacing: how many predictions they've run, how many
+failed, and how long they took.
+
+The models' servers have to serve metrics, with serve.metrics in cog.yaml or
+COG_METRICS=true, which charts generated by 'cog helm' turn on. The metrics are
+counted since each server started.`,
+		Example: `kubectl port-forward service/hotdog-detector 5000:80 &
+kubectl port-forward service/hotdog-detector-canary 5001:80 &
+cog compare-metrics http://localhost:5000 http://localhost:5001`,
+		RunE: cmdCompareMetrics,
+		Args: cobra.ExactArgs(2),
+	}
+	cmd.Flags().StringVar(&compareMetricsToken, "token", "", "Token to authenticate with, for models with 'serve.auth' set in cog.yaml")
+	return cmd
+}
+
+func cmdCompareMetrics(cmd *cobra.Command, args []string) error {
+	stable, err := metrics.Scrape(cmd.Context(), args[0], compareMetricsToken)
+	if err != nil {
+		return err
+	}
+	canary, err := metrics.Scrape(cmd.Context(), args[1], compareMetricsToken)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "METRIC\tSTABLE\tCANARY\tCHANGE")
+	for _, c := range metrics.Compare(stable, canary) {
+		change := "-"
+		if ch := c.Change(); !math.IsNaN(ch) {
+			change = fmt.Sprintf("%+.1f%%", ch*100)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Name, formatMetric(c.Stable, c.Unit), formatMetric(c.Canary, c.Unit), change)
+	}
+	return w.Flush()
+}
+
+func formatMetric(value float64, unit string) string {
+	switch {
+	case math.IsNaN(value):
+		return "-"
+	case unit == "%":
+		return fmt.Sprintf("%.2f%%", value)
+	case unit == "s":
+		return fmt.Sprintf("%.3fs", value)
+	default:
+		return fmt.Sprintf("%g", value)
+	}
+}
@@ -0,0 +1,270 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/demo"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	demoFramework string
+	demoShare     bool
+	demoPort      int
+	demoOutput    string
+)
+
+func newDemoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "demo [image]",
+		Short: "Run a web app with a form for the model's inputs, to try it out and share it",
+		Long: `Run a web app with a form for the model's inputs, which runs predictions with
+the model and shows their output, without writing any frontend code.
+
+The app is generated from the model's schema, with a widget for each input,
+like a slider for a number with a minimum and maximum, a dropdown for choices,
+or an upload for a file. It's a Gradio or Streamlit app, which runs on this
+machine with python3, so the framework must be installed with pip. Pass
+--share with Gradio for a public URL that others can use the demo at while
+it's running.
+
+If 'image' is passed, the demo runs that image. Otherwise, it builds the model
+in the current directory, or uses the server started by 'cog serve' for it.
+
+Pass -o to write the app to a file instead of running it, to change it or
+deploy it. It runs predictions with the model's HTTP API at $COG_MODEL_URL.`,
+		Example: `cog demo
+cog demo r8.im/alice/hotdog-detector --share
+cog demo --framework streamlit -o app.py`,
+		RunE: cmdDemo,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+	addFastFlag(cmd)
+
+	cmd.Flags().StringVar(&demoFramework, "framework", "gradio", "Framework to generate the app with: "+strings.Join(demo.Frameworks, ", "))
+	cmd.Flags().BoolVar(&demoShare, "share", false, "Make the demo available at a public URL while it's running, with Gradio's share links")
+	cmd.Flags().IntVar(&demoPort, "port", 0, "Port to run the app on. Defaults to the framework's, 7860 for Gradio and 8501 for Streamlit")
+	cmd.Flags().StringVarP(&demoOutput, "output", "o", "", "Write the app to this path instead of running it")
+	cmd.Flags().BoolVar(&predictUseServer, "use-server", true, "Use the server started by 'cog serve' for this project, if there is one and its code hasn't changed since it started")
+	cmd.Flags().StringVar(&predictToken, "token", "", "Token to authenticate with, for models with 'serve.auth' set in cog.yaml")
+
+	return cmd
+}
+
+func cmdDemo(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(demo.Frameworks, demoFramework) {
+		return fmt.Errorf("Demos can't be generated with %s. Choose one of %s", demoFramework, strings.Join(demo.Frameworks, ", "))
+	}
+	if demoShare && demoFramework != "gradio" {
+		return fmt.Errorf("--share can only be used with Gradio. Deploy Streamlit apps to share them")
+	}
+	if demoOutput != "" {
+		return writeDemo(cmd, args)
+	}
+
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		return fmt.Errorf("Demos run with python3 on this machine, and it isn't installed")
+	}
+	if err := exec.Command(python, "-c", "import "+demo.Packages[demoFramework]).Run(); err != nil { //#nosec G204
+		return fmt.Errorf("Demos with %s need it installed on this machine. Install it with 'pip install %s'", demoFramework, demo.Packages[demoFramework])
+	}
+
+	predictor, stop, err := demoPredictor(cmd, args)
+	if err != nil {
+		return err
+	}
+	if stop {
+		defer stopPredictor(cmd.Context(), predictor)
+	}
+
+	schema, err := predictor.GetSchema()
+	if err != nil {
+		return err
+	}
+	imageName, err := demoImageName(args)
+	if err != nil {
+		return err
+	}
+	contents, err := demo.Generate(schema, demoFramework, imageName)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "cog-demo-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "demo.py")
+	if err := os.WriteFile(path, contents, 0o644); err != nil { //#nosec G306
+		return fmt.Errorf("Failed to write the demo: %w", err)
+	}
+
+	var demoArgs []string
+	switch demoFramework {
+	case "gradio":
+		demoArgs = []string{path}
+	case "streamlit":
+		demoArgs = []string{"-m", "streamlit", "run", path, "--server.headless", "true"}
+		if demoPort != 0 {
+			demoArgs = append(demoArgs, "--server.port", strconv.Itoa(demoPort))
+		}
+	}
+	app := exec.CommandContext(cmd.Context(), python, demoArgs...) //#nosec G204
+	app.Stdout = os.Stdout
+	app.Stderr = os.Stderr
+	app.Env = append(os.Environ(), demoEnv(predictor)...)
+
+	console.Infof("Running the demo with %s. Press Ctrl-C to stop it.", demoFramework)
+	if err := app.Run(); err != nil && cmd.Context().Err() == nil {
+		return fmt.Errorf("The demo exited: %w", err)
+	}
+	return nil
+}
+
+// demoEnv returns the environment variables the demo app is configured with
+func demoEnv(predictor *predict.Predictor) []string {
+	env := []string{"COG_MODEL_URL=" + predictor.BaseURL()}
+	if predictor.Token() != "" {
+		env = append(env, "COG_TOKEN="+predictor.Token())
+	}
+	if strings.HasPrefix(predictor.BaseURL(), "https://") {
+		env = append(env, "COG_MODEL_INSECURE=1")
+	}
+	if demoShare {
+		env = append(env, "COG_DEMO_SHARE=1")
+	}
+	if demoPort != 0 {
+		env = append(env, "COG_DEMO_PORT="+strconv.Itoa(demoPort))
+	}
+	return env
+}
+
+// demoPredictor returns a predictor for the model the demo runs, and whether it was started for the demo, so it
+// should be stopped when the demo exits
+func demoPredictor(cmd *cobra.Command, args []string) (*predict.Predictor, bool, error) {
+	var imageName string
+	var cfg *config.Config
+	var projectDir string
+	volumes := []docker.Volume{}
+	var err error
+
+	if len(args) == 0 {
+		cfg, projectDir, err = config.GetConfig(projectDirFlag)
+		if err != nil {
+			return nil, false, err
+		}
+		if cfg.PipelineOfImages() {
+			return nil, false, config.ErrPipelineOfImages
+		}
+		predictor, err := runningServerPredictor(cmd, projectDir)
+		if err != nil {
+			return nil, false, err
+		}
+		if predictor != nil {
+			return predictor, false, nil
+		}
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+			return nil, false, err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+	} else {
+		imageName = args[0]
+		if err := pullIfMissing(cmd.Context(), imageName); err != nil {
+			return nil, false, err
+		}
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return nil, false, err
+		}
+	}
+
+	console.Info("")
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+
+	runOptions := docker.RunOptions{
+		GPUs:    gpusForConfig(cfg),
+		Image:   imageName,
+		Volumes: volumes,
+		Labels:  containerLabels("demo", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return nil, false, err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return nil, false, err
+	}
+	token, err := addAPIKey(&runOptions, cfg, predictToken)
+	if err != nil {
+		return nil, false, err
+	}
+	predictor, err := startPredictor(cmd.Context(), runOptions, token, setupTimeoutFor(cmd, cfg))
+	if err != nil {
+		return nil, false, err
+	}
+	return predictor, true, nil
+}
+
+// demoImageName returns the image the demo is for, which is its title
+func demoImageName(args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return "", err
+	}
+	if cfg.Image != "" {
+		return cfg.Image, nil
+	}
+	return config.DockerImageName(projectDir), nil
+}
+
+// writeDemo writes the demo app to the path passed with -o, from the schema of the image
+func writeDemo(cmd *cobra.Command, args []string) error {
+	imageName, err := demoImageName(args)
+	if err != nil {
+		return err
+	}
+
+	schema, err := image.GetOpenAPISchema(cmd.Context(), imageName)
+	if err != nil {
+		if len(args) == 0 {
+			return fmt.Errorf("Failed to read the model's schema from %s. Build it with 'cog build' first: %w", imageName, err)
+		}
+		return err
+	}
+	contents, err := demo.Generate(schema, demoFramework, imageName)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(demoOutput, contents, 0o644); err != nil { //#nosec G306
+		return fmt.Errorf("Failed to write %s: %w", demoOutput, err)
+	}
+	console.Infof("Wrote %s", demoOutput)
+	if demoFramework == "streamlit" {
+		console.Infof("Run it with 'COG_MODEL_URL=http://localhost:5000 streamlit run %s'", demoOutput)
+	} else {
+		console.Infof("Run it with 'COG_MODEL_URL=http://localhost:5000 python %s'", demoOutput)
+	}
+	return nil
+}
@@ -0,0 +1,583 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/cloudrun"
+	"github.com/replicate/cog/pkg/cog"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/fly"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/lambda"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+var (
+	deployFunction string
+	deployRole     string
+	deployMemory   int
+	deployTimeout  int
+
+	deployService              string
+	deployRegion               string
+	deployMinInstances         int
+	deployServiceTimeout       int
+	deployAllowUnauthenticated bool
+
+	deployApp         string
+	deployFlyRegion   string
+	deployMinMachines int
+
+	deployHost    string
+	deployName    string
+	deployPort    int
+	deployRestart string
+	deployPull    bool
+)
+
+func newDeployCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deploy",
+		Short: "Deploy the model to a serverless platform or a Docker host",
+	}
+	cmd.AddCommand(newDeployCloudRunCommand(), newDeployDockerCommand(), newDeployFlyCommand(), newDeployLambdaCommand())
+	return cmd
+}
+
+func newDeployCloudRunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cloudrun [IMAGE]",
+		Short: "Build and push the model, and create or update a Google Cloud Run service that runs it",
+		Long: `Build the model in the current directory, push it to Artifact Registry, and
+create or update a Google Cloud Run service that runs it. If 'IMAGE' isn't
+passed, the image in cog.yaml is used.
+
+The service gets the CPUs, memory and GPU in resources in cog.yaml, runs as
+many predictions at once as concurrency.max allows, and has the variables in
+environment_variables. Its secrets are read from Secret Manager, so each of
+them must be set with 'from: gcp-secret-manager:<name>'.
+
+It uses the gcloud CLI, with its credentials and project.`,
+		Example: `cog deploy cloudrun us-central1-docker.pkg.dev/my-project/models/hotdog-detector --min-instances 1`,
+		RunE:    cmdDeployCloudRun,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	addSecretsFlag(cmd)
+	addBuildArgFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addPinBaseImageFlag(cmd)
+	addDryRunFlag(cmd)
+
+	cmd.Flags().StringVar(&deployService, "service", "", "Name of the service. Defaults to the name of the image's repository")
+	cmd.Flags().StringVar(&deployRegion, "region", "", "Region to run the service in. Defaults to the region of the image's repository in Artifact Registry")
+	cmd.Flags().IntVar(&deployMinInstances, "min-instances", 0, "How many instances of the model to keep running when there aren't any requests, so they don't have to start up")
+	cmd.Flags().IntVar(&deployServiceTimeout, "timeout", cloudrun.MaxTimeout, "Longest a prediction can run for, in seconds")
+	cmd.Flags().BoolVar(&deployAllowUnauthenticated, "allow-unauthenticated", false, "Let anyone make predictions with the service, without authenticating")
+
+	return cmd
+}
+
+func newDeployDockerCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docker [IMAGE]",
+		Short: "Build the model and run it on a Docker host, like a GPU machine reached over SSH",
+		Long: `Build the model in the current directory and run it on another Docker host,
+in place of the container that ran it before. If 'IMAGE' isn't passed, the
+image in cog.yaml is used, or one named after the directory.
+
+The image is copied to the host over the connection to it, or, with --pull,
+pushed to its registry and pulled on the host. The container restarts when
+the host does, and gets the GPUs, resources, devices, environment_variables
+and secrets in cog.yaml. Secrets are read on this machine.`,
+		Example: `cog deploy docker --host ssh://ubuntu@gpu-box --port 8080`,
+		RunE:    cmdDeployDocker,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	addSecretsFlag(cmd)
+	addBuildArgFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addPinBaseImageFlag(cmd)
+	addGpusFlag(cmd)
+	addDryRunFlag(cmd)
+
+	cmd.Flags().StringVar(&deployHost, "host", "", "Docker host to run the model on, like ssh://user@gpu-box or tcp://gpu-box:2376")
+	cmd.Flags().StringVar(&deployName, "name", "", "Name of the container. Defaults to one named after the image")
+	cmd.Flags().IntVar(&deployPort, "port", config.RunnerPort, "Port on the host to serve the model on")
+	cmd.Flags().StringVar(&deployRestart, "restart", "unless-stopped", "When Docker restarts the container: no, always, unless-stopped or on-failure[:max-retries]")
+	cmd.Flags().BoolVar(&deployPull, "pull", false, "Push the image to its registry and pull it on the host, rather than copying it over the connection to the host")
+	_ = cmd.MarkFlagRequired("host")
+
+	return cmd
+}
+
+func newDeployFlyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fly [IMAGE]",
+		Short: "Build the model, and create or update a Fly.io app that runs it",
+		Long: `Build the model in the current directory, and create or update a Fly.io app
+that runs it. If 'IMAGE' isn't passed, the image in cog.yaml is used, or one
+named after the directory.
+
+The app is configured by fly.toml in the project directory. If it doesn't
+exist, it's generated from cog.yaml, with the GPU, CPUs and memory in
+resources, and the variables in environment_variables, and you can change it
+after that. The secrets in cog.yaml are read on this machine and set as the
+app's secrets.
+
+It uses the fly CLI, with its credentials and organization.`,
+		Example: `cog deploy fly --app hotdog-detector --region ord`,
+		RunE:    cmdDeployFly,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	addSecretsFlag(cmd)
+	addBuildArgFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addPinBaseImageFlag(cmd)
+	addDryRunFlag(cmd)
+
+	cmd.Flags().StringVar(&deployApp, "app", "", "Name of the app. Defaults to the name of the image's repository")
+	cmd.Flags().StringVar(&deployFlyRegion, "region", fly.DefaultRegion, "Region to run the app in, when fly.toml is generated")
+	cmd.Flags().IntVar(&deployMinMachines, "min-machines", 0, "How many machines to keep running when there aren't any requests, when fly.toml is generated")
+
+	return cmd
+}
+
+func newDeployLambdaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lambda [image]",
+		Short: "Create or update an AWS Lambda function that runs the model",
+		Long: `Create or update an AWS Lambda function that runs the model's image.
+
+The image must be built with 'cog build --target lambda', or with
+build.target set to lambda in cog.yaml, and pushed to Amazon ECR. If 'image'
+isn't passed, the image in cog.yaml is deployed.
+
+The function is created if it doesn't exist, which needs the ARN of an IAM
+role for it to run as. Otherwise, its image, memory and timeout are updated.
+Its memory is resources.memory in cog.yaml, if it's set.
+
+It uses the aws CLI, with its credentials and profiles.`,
+		Example: `cog deploy lambda 123456789012.dkr.ecr.us-east-1.amazonaws.com/hotdog-detector --role arn:aws:iam::123456789012:role/cog-lambda`,
+		RunE:    cmdDeployLambda,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	addDryRunFlag(cmd)
+
+	cmd.Flags().StringVar(&deployFunction, "function", "", "Name of the function. Defaults to the name of the image's repository")
+	cmd.Flags().StringVar(&deployRole, "role", "", "ARN of the IAM role the function runs as. Needed to create the function")
+	cmd.Flags().IntVar(&deployMemory, "memory", 0, fmt.Sprintf("Memory of the function in MB, between %d and %d. Defaults to resources.memory in cog.yaml, or %d", lambda.MinMemory, lambda.MaxMemory, lambda.DefaultMemory))
+	cmd.Flags().IntVar(&deployTimeout, "timeout", lambda.MaxTimeout, "Longest a prediction can run for, in seconds")
+
+	return cmd
+}
+
+func cmdDeployCloudRun(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(projectDirFlag, buildArgs)
+	if err != nil {
+		return err
+	}
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		return fmt.Errorf("To deploy a model, set 'image' in cog.yaml to its repository in Artifact Registry, or pass the image")
+	}
+
+	region, project, err := cloudrun.ImageLocation(imageName)
+	if err != nil {
+		return err
+	}
+	if deployRegion != "" {
+		region = deployRegion
+	}
+	serviceName, err := repositoryName(imageName)
+	if err != nil {
+		return err
+	}
+	if deployService != "" {
+		serviceName = deployService
+	}
+	service := cloudrun.Service{
+		Name:                 serviceName,
+		Image:                imageName,
+		Region:               region,
+		Project:              project,
+		MinInstances:         deployMinInstances,
+		Timeout:              deployServiceTimeout,
+		AllowUnauthenticated: deployAllowUnauthenticated,
+	}
+	// Check the service can be deployed before spending time building the model
+	deployArgs, _, err := cloudrun.DeployArgs(cfg, service, "<environment_variables>")
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		operations, err := printBuildPlan(cmd, cfg, projectDir, imageName)
+		if err != nil {
+			return err
+		}
+		operations = append(operations, []string{"push", imageName})
+		printCommands(append(commandLines("docker", operations), commandLines("gcloud", [][]string{deployArgs})...))
+		return nil
+	}
+
+	if err := image.Build(cmd.Context(), cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, "", "", DetermineUseCogBaseImage(cmd), false, false, false, buildPinBaseImage); err != nil {
+		return err
+	}
+	console.Infof("\nPushing image '%s'...", imageName)
+	if err := cog.Push(cmd.Context(), imageName, cog.PushOptions{}); err != nil {
+		return err
+	}
+
+	url, err := cloudrun.Deploy(cfg, service)
+	if err != nil {
+		return err
+	}
+	console.Infof("\nDeployed Cloud Run service %s", serviceName)
+	console.Info("")
+	console.Info("Run a prediction with:")
+	auth := ""
+	if !deployAllowUnauthenticated {
+		auth = `-H "Authorization: Bearer $(gcloud auth print-identity-token)" `
+	}
+	console.Infof(`  curl %s-H "Content-Type: application/json" -d '{"input": {...}}' %s/predictions`, auth, url)
+	return nil
+}
+
+// repositoryName returns the last part of the name of an image's repository, like hotdog-detector for
+// us-central1-docker.pkg.dev/my-project/models/hotdog-detector:latest
+func repositoryName(imageName string) (string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	return path.Base(ref.Context().RepositoryStr()), nil
+}
+
+func cmdDeployDocker(cmd *cobra.Command, args []string) error {
+	if !validRestartPolicy(deployRestart) {
+		return fmt.Errorf("Invalid --restart %s, expected no, always, unless-stopped or on-failure[:max-retries]", deployRestart)
+	}
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(projectDirFlag, buildArgs)
+	if err != nil {
+		return err
+	}
+	if cfg.Build.Target != "" {
+		return fmt.Errorf("The model is built to run on %s, not a server, so it can't run on a Docker host. Remove build.target from cog.yaml", cfg.Build.Target)
+	}
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		if deployPull {
+			return fmt.Errorf("To pull the model on the host, set 'image' in cog.yaml to its repository, or pass the image")
+		}
+		imageName = config.DockerImageName(projectDir)
+	}
+	containerName := deployName
+	if containerName == "" {
+		containerName = unitContainerName(imageName)
+	}
+
+	// Read the secrets before building, so a missing one doesn't waste a build
+	runOptions := docker.RunOptions{
+		GPUs:          gpusForConfig(cfg),
+		Image:         imageName,
+		Ports:         []docker.Port{{HostPort: deployPort, ContainerPort: config.RunnerPort}},
+		Labels:        containerLabels("serve", ""),
+		Name:          containerName,
+		RestartPolicy: deployRestart,
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	// The volumes in cog.yaml are directories on this machine, which the host doesn't have
+	if len(cfg.Volumes) > 0 {
+		console.Warnf("The volumes in cog.yaml aren't mounted on %s, because they're on this machine", deployHost)
+	}
+	if len(cfg.SharedWeights()) > 0 {
+		console.Warnf("The shared weights in cog.yaml aren't mounted on %s, because they're in the weights cache on this machine. Build the image without 'shared' to deploy it.", deployHost)
+	}
+
+	remote := docker.Remote{Host: deployHost}
+	if dryRun {
+		operations, err := printBuildPlan(cmd, cfg, projectDir, imageName)
+		if err != nil {
+			return err
+		}
+		var lines []string
+		if deployPull {
+			lines = commandLines("docker", append(operations, []string{"push", imageName}, remote.PullArgs(imageName)))
+		} else {
+			save, load := remote.LoadArgs(imageName)
+			lines = append(commandLines("docker", operations), "$ docker "+strings.Join(save, " ")+" | docker "+strings.Join(load, " "))
+		}
+		rm, run := remote.ReplaceArgs(runOptions)
+		printCommands(append(lines, commandLines("docker", [][]string{rm, run})...))
+		return nil
+	}
+
+	if err := image.Build(cmd.Context(), cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, "", "", DetermineUseCogBaseImage(cmd), false, false, false, buildPinBaseImage); err != nil {
+		return err
+	}
+
+	if deployPull {
+		console.Infof("\nPushing image '%s'...", imageName)
+		if err := cog.Push(cmd.Context(), imageName, cog.PushOptions{}); err != nil {
+			return err
+		}
+		console.Infof("\nPulling image '%s' on %s...", imageName, deployHost)
+		if err := remote.Pull(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	} else {
+		console.Infof("\nCopying image '%s' to %s...", imageName, deployHost)
+		if err := remote.Load(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	}
+
+	console.Infof("\nStarting container %s on %s...", containerName, deployHost)
+	if _, err := remote.Replace(cmd.Context(), runOptions); err != nil {
+		if errors.Is(err, docker.ErrMissingDeviceDriver) {
+			return fmt.Errorf("%s doesn't have the NVIDIA Container Toolkit, which the model needs to use its GPUs", deployHost)
+		}
+		return err
+	}
+	console.Infof("\nThe model is running on %s as container %s", deployHost, containerName)
+	console.Info("")
+	console.Info("Run a prediction with:")
+	console.Infof(`  curl -H "Content-Type: application/json" -d '{"input": {...}}' http://%s:%d/predictions`, dockerHostname(deployHost), deployPort)
+	return nil
+}
+
+// validRestartPolicy returns whether policy is a Docker restart policy, like unless-stopped or on-failure:3
+func validRestartPolicy(policy string) bool {
+	name, retries, hasRetries := strings.Cut(policy, ":")
+	if hasRetries {
+		n, err := strconv.Atoi(retries)
+		return name == "on-failure" && err == nil && n >= 0
+	}
+	return slices.Contains([]string{"no", "always", "unless-stopped", "on-failure"}, name)
+}
+
+// dockerHostname returns the name of the machine a Docker host is on, like gpu-box for ssh://ubuntu@gpu-box:2222
+func dockerHostname(host string) string {
+	u, err := url.Parse(host)
+	if err != nil || u.Hostname() == "" {
+		return "localhost"
+	}
+	return u.Hostname()
+}
+
+func cmdDeployFly(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(projectDirFlag, buildArgs)
+	if err != nil {
+		return err
+	}
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+	appName := deployApp
+	if appName == "" {
+		if appName, err = repositoryName(imageName); err != nil {
+			return err
+		}
+	}
+	app := fly.App{Name: appName, Region: deployFlyRegion, MinMachines: deployMinMachines}
+
+	// Generate fly.toml before spending time building the model, so it fails early if it can't run on Fly.io
+	configPath := filepath.Join(projectDir, fly.ConfigFile)
+	flyConfig, err := fly.GenerateConfig(cfg, app)
+	if err != nil {
+		return err
+	}
+	exists, err := files.Exists(configPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		console.Infof("Using the Fly.io configuration in %s", fly.ConfigFile)
+	} else if !dryRun {
+		if err := os.WriteFile(configPath, []byte(flyConfig), 0o644); err != nil {
+			return fmt.Errorf("Failed to write %s: %w", fly.ConfigFile, err)
+		}
+		console.Infof("Wrote the Fly.io configuration to %s", fly.ConfigFile)
+	}
+
+	// Read the secrets before building, too, so a missing one doesn't waste a build
+	runOptions := docker.RunOptions{}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+
+	if dryRun {
+		operations, err := printBuildPlan(cmd, cfg, projectDir, imageName)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			console.Output(fmt.Sprintf("=== %s contents (it would be written to the project directory):\n%s===\n", fly.ConfigFile, flyConfig))
+		}
+		status, create := fly.CreateAppArgs(app)
+		lines := commandLines("docker", operations)
+		lines = append(lines, commandLines("fly", [][]string{status})...)
+		lines = append(lines, fmt.Sprintf("# If %s doesn't exist:", app.Name))
+		lines = append(lines, commandLines("fly", [][]string{create})...)
+		if len(runOptions.SecretEnv) > 0 {
+			names := []string{}
+			for _, env := range runOptions.SecretEnv {
+				name, _, _ := strings.Cut(env, "=")
+				names = append(names, name)
+			}
+			lines = append(lines, fmt.Sprintf("# With the values of %s on stdin:", strings.Join(names, ", ")))
+			lines = append(lines, commandLines("fly", [][]string{fly.ImportSecretsArgs(app.Name)})...)
+		}
+		printCommands(append(lines, commandLines("fly", [][]string{fly.DeployArgs(app, imageName, configPath)})...))
+		return nil
+	}
+
+	if err := image.Build(cmd.Context(), cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, "", "", DetermineUseCogBaseImage(cmd), false, false, false, buildPinBaseImage); err != nil {
+		return err
+	}
+
+	if _, err := fly.CreateApp(app); err != nil {
+		return err
+	}
+	if err := fly.ImportSecrets(app.Name, runOptions.SecretEnv); err != nil {
+		return err
+	}
+	if err := fly.Deploy(app, imageName, configPath); err != nil {
+		return err
+	}
+	console.Infof("\nDeployed Fly.io app %s", app.Name)
+	console.Info("")
+	console.Info("Run a prediction with:")
+	console.Infof(`  curl -H "Content-Type: application/json" -d '{"input": {...}}' https://%s.fly.dev/predictions`, app.Name)
+	return nil
+}
+
+func cmdDeployLambda(cmd *cobra.Command, args []string) error {
+	imageName := ""
+	if len(args) > 0 {
+		imageName = args[0]
+	} else {
+		cfg, _, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		if cfg.Image == "" {
+			return fmt.Errorf("To deploy a model, set 'image' in cog.yaml to its repository in Amazon ECR, or pass the image")
+		}
+		imageName = cfg.Image
+	}
+
+	inspect, err := docker.ImageInspect(cmd.Context(), imageName)
+	if errors.Is(err, docker.ErrNoSuchImage) {
+		return fmt.Errorf("There's no image %s. Build and push it with 'cog push' first", imageName)
+	} else if err != nil {
+		return fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	cfg, err := image.GetConfig(cmd.Context(), imageName)
+	if err != nil {
+		return err
+	}
+	if cfg.Build == nil || cfg.Build.Target != config.TargetLambda {
+		return fmt.Errorf("%s wasn't built to run on Lambda. Build it with 'cog build --target lambda', or set build.target to lambda in cog.yaml", imageName)
+	}
+	if err := lambda.CheckImageSize(imageName, inspect.Size); err != nil {
+		return err
+	}
+	architecture, err := lambda.Architecture(inspect.Architecture)
+	if err != nil {
+		return err
+	}
+
+	memory := deployMemory
+	if memory == 0 {
+		if memory, err = lambda.Memory(cfg.Resources); err != nil {
+			return err
+		}
+	} else if memory < lambda.MinMemory || memory > lambda.MaxMemory {
+		return fmt.Errorf("Invalid --memory %d, expected between %d and %d", memory, lambda.MinMemory, lambda.MaxMemory)
+	}
+
+	functionName := deployFunction
+	if functionName == "" {
+		if functionName, err = repositoryName(imageName); err != nil {
+			return err
+		}
+	}
+
+	function := lambda.Function{
+		Name:         functionName,
+		Image:        imageName,
+		Role:         deployRole,
+		Memory:       memory,
+		Timeout:      deployTimeout,
+		Architecture: architecture,
+	}
+	if dryRun {
+		get, create, update, err := lambda.DeployArgs(function)
+		if err != nil {
+			return err
+		}
+		lines := commandLines("aws", [][]string{get})
+		if len(create) == 0 {
+			lines = append(lines, fmt.Sprintf("# If %s doesn't exist, it can't be created without --role", functionName))
+		} else {
+			lines = append(lines, fmt.Sprintf("# If %s doesn't exist:", functionName))
+			lines = append(lines, commandLines("aws", create)...)
+		}
+		lines = append(lines, "# If it does:")
+		printCommands(append(lines, commandLines("aws", update)...))
+		return nil
+	}
+
+	created, err := lambda.Deploy(function)
+	if err != nil {
+		return err
+	}
+	if created {
+		console.Infof("Created Lambda function %s", functionName)
+	} else {
+		console.Infof("Updated Lambda function %s", functionName)
+	}
+	console.Info("")
+	console.Info("Run a prediction with:")
+	console.Infof(`  aws lambda invoke --function-name %s --cli-binary-format raw-in-base64-out --payload '{"input": {...}}' prediction.json`, functionName)
+	return nil
+}
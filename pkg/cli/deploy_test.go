@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidRestartPolicy(t *testing.T) {
+	for _, policy := range []string{"no", "always", "unless-stopped", "on-failure", "on-failure:3"} {
+		require.True(t, validRestartPolicy(policy), policy)
+	}
+	for _, policy := range []string{"", "sometimes", "always:3", "on-failure:lots"} {
+		require.False(t, validRestartPolicy(policy), policy)
+	}
+}
+
+func TestDockerHostname(t *testing.T) {
+	require.Equal(t, "gpu-box", dockerHostname("ssh://ubuntu@gpu-box"))
+	require.Equal(t, "gpu-box", dockerHostname("ssh://ubuntu@gpu-box:2222"))
+	require.Equal(t, "10.0.0.5", dockerHostname("tcp://10.0.0.5:2376"))
+	require.Equal(t, "localhost", dockerHostname("unix:///var/run/docker.sock"))
+}
+
+func TestRepositoryName(t *testing.T) {
+	name, err := repositoryName("us-central1-docker.pkg.dev/my-project/models/hotdog-detector:latest")
+	require.NoError(t, err)
+	require.Equal(t, "hotdog-detector", name)
+	name, err = repositoryName("cog-hotdog-detector")
+	require.NoError(t, err)
+	require.Equal(t, "cog-hotdog-detector", name)
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/detect"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var detectWrite bool
+
+func newDetectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "detect",
+		Short: "Find the packages the model's code needs that aren't in cog.yaml",
+		Long: `Find the packages the model's code needs that aren't in cog.yaml.
+
+This looks at the modules that the project's Python code imports, and suggests the Python
+packages they're in, and the system packages that those need, like ffmpeg for librosa or
+libgl1 for opencv-python. With --write, it adds them to cog.yaml, or to the requirements
+file in build.python_requirements.
+
+The Python packages aren't pinned to versions, so pin them to the ones the model was
+written for.`,
+		Args: cobra.NoArgs,
+		RunE: cmdDetect,
+	}
+	cmd.Flags().BoolVar(&detectWrite, "write", false, "Add the packages to cog.yaml")
+	return cmd
+}
+
+func cmdDetect(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	project, err := detect.Inspect(projectDir)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect the project: %w", err)
+	}
+	suggestions := detect.Suggest(project, cfg)
+	if len(suggestions.PythonPackages) == 0 && len(suggestions.SystemPackages) == 0 {
+		console.Infof("%s has all the packages that the model's code needs", global.ConfigFilename)
+		return nil
+	}
+
+	printSuggestions("Python packages", suggestions.PythonPackages)
+	printSuggestions("System packages", suggestions.SystemPackages)
+	if !detectWrite {
+		console.Info("\nRun 'cog detect --write' to add them to " + global.ConfigFilename)
+		return nil
+	}
+
+	configPath := filepath.Join(projectDir, global.ConfigFilename)
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", global.ConfigFilename, err)
+	}
+	if len(suggestions.PythonPackages) > 0 {
+		packages := suggestionPackages(suggestions.PythonPackages)
+		if cfg.Build.PythonRequirements != "" {
+			if err := appendRequirements(filepath.Join(projectDir, cfg.Build.PythonRequirements), packages); err != nil {
+				return err
+			}
+			console.Infof("\nAdded the Python packages to %s", cfg.Build.PythonRequirements)
+		} else {
+			if contents, err = config.AddToBuildList(contents, "python_packages", packages); err != nil {
+				return err
+			}
+		}
+	}
+	if len(suggestions.SystemPackages) > 0 {
+		if contents, err = config.AddToBuildList(contents, "system_packages", suggestionPackages(suggestions.SystemPackages)); err != nil {
+			return err
+		}
+	}
+	if len(suggestions.SystemPackages) == 0 && cfg.Build.PythonRequirements != "" {
+		// Only the requirements file changed
+		return nil
+	}
+	if err := os.WriteFile(configPath, contents, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", global.ConfigFilename, err)
+	}
+	console.Infof("\nUpdated %s", global.ConfigFilename)
+	return nil
+}
+
+func printSuggestions(title string, suggestions []detect.Suggestion) {
+	if len(suggestions) == 0 {
+		return
+	}
+	console.Infof("%s:", title)
+	for _, suggestion := range suggestions {
+		console.Infof("  %s (%s)", suggestion.Package, suggestion.Reason)
+	}
+}
+
+func suggestionPackages(suggestions []detect.Suggestion) []string {
+	packages := []string{}
+	for _, suggestion := range suggestions {
+		packages = append(packages, suggestion.Package)
+	}
+	return packages
+}
+
+// appendRequirements adds packages to the end of a requirements file
+func appendRequirements(path string, packages []string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	if len(contents) > 0 && !strings.HasSuffix(string(contents), "\n") {
+		contents = append(contents, '\n')
+	}
+	contents = append(contents, []byte(strings.Join(packages, "\n")+"\n")...)
+	if err := os.WriteFile(path, contents, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
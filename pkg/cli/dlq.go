@@ -0,0 +1,244 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/servers"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	dlqDir   string
+	dlqToken string
+)
+
+// quarantinedInput is an input that crashed the model serve.dead_letter.max_crashes times, as the model's server
+// writes it to serve.dead_letter.destination
+type quarantinedInput struct {
+	ID            string         `json:"id"`
+	QuarantinedAt time.Time      `json:"quarantined_at"`
+	Input         map[string]any `json:"input"`
+	// Crashes are the predictions the input crashed, with their logs and errors
+	Crashes []json.RawMessage `json:"crashes"`
+
+	path string
+}
+
+func newDlqCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dlq",
+		Short: "Manage the inputs quarantined because they crashed the model",
+		Long: `Manage the inputs quarantined because they crashed the model.
+
+With 'serve.dead_letter' set in cog.yaml, the model is restarted when a
+prediction crashes it, and inputs that crash it 'max_crashes' times are
+quarantined: they're written to 'destination', with the logs and errors of the
+predictions they crashed, and rejected from then on.
+
+These commands read the quarantined inputs from 'destination' when it's in the
+project, like /src/dead-letter, or from the directory passed with --dir.`,
+	}
+	cmd.PersistentFlags().StringVar(&dlqDir, "dir", "", "Directory the quarantined inputs are in. Defaults to serve.dead_letter.destination in cog.yaml")
+	cmd.AddCommand(
+		newDlqLsCommand(),
+		newDlqRetryCommand(),
+	)
+	return cmd
+}
+
+func newDlqLsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls",
+		Short: "List the quarantined inputs",
+		RunE:  cmdDlqLs,
+		Args:  cobra.NoArgs,
+	}
+}
+
+func newDlqRetryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retry <id>...",
+		Short: "Run quarantined inputs again, and remove them if they succeed",
+		Long: `Run quarantined inputs again on the server started by 'cog serve' for this
+project, and remove them from the quarantine if their predictions succeed.
+
+The server rejects inputs it has quarantined until the model is reloaded, so
+once the model is fixed, run 'cog reload' before retrying them. IDs can be
+shortened to their first few characters, as 'cog dlq ls' shows them.`,
+		Example: `cog reload && cog dlq retry 1a2b3c4d5e6f`,
+		RunE:    cmdDlqRetry,
+		Args:    cobra.MinimumNArgs(1),
+	}
+	cmd.Flags().StringVar(&dlqToken, "token", "", "Token to authenticate with, for models with 'serve.auth' set in cog.yaml")
+	return cmd
+}
+
+func cmdDlqLs(cmd *cobra.Command, args []string) error {
+	dir, _, err := resolveDlqDir()
+	if err != nil {
+		return err
+	}
+	inputs, err := readQuarantinedInputs(dir)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "ID\tQUARANTINED\tCRASHES\tINPUT")
+	for _, q := range inputs {
+		input, err := json.Marshal(q.Input)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", shortQuarantineID(q.ID), console.FormatTime(q.QuarantinedAt), len(q.Crashes), shortenInput(string(input)))
+	}
+	return w.Flush()
+}
+
+func cmdDlqRetry(cmd *cobra.Command, args []string) error {
+	dir, projectDir, err := resolveDlqDir()
+	if err != nil {
+		return err
+	}
+	inputs, err := readQuarantinedInputs(dir)
+	if err != nil {
+		return err
+	}
+	toRetry := []quarantinedInput{}
+	for _, id := range args {
+		q, err := findQuarantinedInput(inputs, id)
+		if err != nil {
+			return err
+		}
+		toRetry = append(toRetry, q)
+	}
+
+	server, err := servers.Lookup(projectDir)
+	if err != nil {
+		return err
+	}
+	if server == nil {
+		return fmt.Errorf("There isn't a server running for this project. Start one with 'cog serve'.")
+	}
+	token := dlqToken
+	if token == "" {
+		token = server.Token
+	}
+	predictor := predict.NewServerPredictor(server.Port, false)
+	predictor.SetToken(token)
+	predictor.SetTLS(server.TLS)
+
+	for _, q := range toRetry {
+		id := shortQuarantineID(q.ID)
+		console.Infof("Retrying %s...", id)
+		response, err := predictor.PredictInput(cmd.Context(), q.Input)
+		if err != nil {
+			return fmt.Errorf("Failed to retry %s: %w", id, err)
+		}
+		if response.Status != "succeeded" {
+			return fmt.Errorf("Failed to retry %s, the prediction %s: %s", id, response.Status, response.Error)
+		}
+		if err := os.Remove(q.path); err != nil {
+			return err
+		}
+		console.Infof("Retried %s, and removed it from the quarantine", id)
+	}
+	return nil
+}
+
+// resolveDlqDir returns the directory quarantined inputs are in, and the project's directory. Without --dir, it's
+// serve.dead_letter.destination in cog.yaml, which is a path in the container, where the project is mounted at /src.
+func resolveDlqDir() (dir string, projectDir string, err error) {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return "", "", err
+	}
+	if dlqDir != "" {
+		return dlqDir, projectDir, nil
+	}
+	dir, err = deadLetterDir(cfg, projectDir)
+	return dir, projectDir, err
+}
+
+func deadLetterDir(cfg *config.Config, projectDir string) (string, error) {
+	if cfg.Serve == nil || cfg.Serve.DeadLetter == nil {
+		return "", fmt.Errorf("serve.dead_letter isn't set in cog.yaml, so inputs that crash the model aren't quarantined. Pass --dir to read them from a directory.")
+	}
+	destination := cfg.Serve.DeadLetter.Destination
+	if strings.HasPrefix(destination, "s3://") {
+		return "", fmt.Errorf("serve.dead_letter.destination is %s. Download it, and pass the directory with --dir.", destination)
+	}
+	rel, err := filepath.Rel("/src", destination)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("serve.dead_letter.destination %s isn't in the project, so it can't be read from here. Pass the directory with --dir.", destination)
+	}
+	return filepath.Join(projectDir, rel), nil
+}
+
+// readQuarantinedInputs returns the quarantined inputs in dir, most recently quarantined first
+func readQuarantinedInputs(dir string) ([]quarantinedInput, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	inputs := []quarantinedInput{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		q := quarantinedInput{path: path}
+		if err := json.Unmarshal(data, &q); err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %w", path, err)
+		}
+		inputs = append(inputs, q)
+	}
+	sort.Slice(inputs, func(i, j int) bool {
+		return inputs[i].QuarantinedAt.After(inputs[j].QuarantinedAt)
+	})
+	return inputs, nil
+}
+
+// findQuarantinedInput returns the quarantined input whose ID starts with id
+func findQuarantinedInput(inputs []quarantinedInput, id string) (quarantinedInput, error) {
+	matches := []quarantinedInput{}
+	for _, q := range inputs {
+		if strings.HasPrefix(q.ID, id) {
+			matches = append(matches, q)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return quarantinedInput{}, fmt.Errorf("There isn't a quarantined input with the ID %s", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return quarantinedInput{}, fmt.Errorf("The ID %s matches %d quarantined inputs. Pass more of it.", id, len(matches))
+	}
+}
+
+// shortenInput shortens the JSON of an input to fit in a table
+func shortenInput(input string) string {
+	if len(input) > 60 {
+		return input[:57] + "..."
+	}
+	return input
+}
+
+func shortQuarantineID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestDeadLetterDir(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := &config.Config{Serve: &config.Serve{DeadLetter: &config.DeadLetter{Destination: "/src/dead-letter"}}}
+	dir, err := deadLetterDir(cfg, projectDir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(projectDir, "dead-letter"), dir)
+
+	cfg.Serve.DeadLetter.Destination = "/var/dead-letter"
+	_, err = deadLetterDir(cfg, projectDir)
+	require.ErrorContains(t, err, "isn't in the project")
+
+	cfg.Serve.DeadLetter.Destination = "s3://bucket/dead-letter"
+	_, err = deadLetterDir(cfg, projectDir)
+	require.ErrorContains(t, err, "pass the directory with --dir")
+
+	_, err = deadLetterDir(&config.Config{}, projectDir)
+	require.ErrorContains(t, err, "serve.dead_letter isn't set")
+}
+
+func TestReadQuarantinedInputs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1a2b.json"), []byte(`{"id": "1a2b", "quarantined_at": "2024-05-24T06:00:00+00:00", "input": {"text": "crash"}, "crashes": [{}, {}, {}]}`), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1a3c.json"), []byte(`{"id": "1a3c", "quarantined_at": "2024-05-25T06:00:00+00:00", "input": {"text": "boom"}, "crashes": [{}]}`), 0o644))
+
+	inputs, err := readQuarantinedInputs(dir)
+	require.NoError(t, err)
+	require.Len(t, inputs, 2)
+	// Most recently quarantined first
+	require.Equal(t, "1a3c", inputs[0].ID)
+	require.Equal(t, map[string]any{"text": "crash"}, inputs[1].Input)
+	require.Len(t, inputs[1].Crashes, 3)
+
+	q, err := findQuarantinedInput(inputs, "1a2")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "1a2b.json"), q.path)
+	_, err = findQuarantinedInput(inputs, "1a")
+	require.ErrorContains(t, err, "matches 2 quarantined inputs")
+	_, err = findQuarantinedInput(inputs, "ff")
+	require.ErrorContains(t, err, "There isn't a quarantined input")
+}
@@ -0,0 +1,153 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var dryRun bool
+
+func addDryRunFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the resolved configuration, generated Dockerfile and the operations that would run, without running them")
+}
+
+// printBuildPlan prints the resolved configuration and generated Dockerfile for building imageName, and returns
+// the docker operations the build would run, without building anything
+func printBuildPlan(cmd *cobra.Command, cfg *config.Config, projectDir string, imageName string) ([][]string, error) {
+	configYAML, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to convert config to YAML: %w", err)
+	}
+	console.Output(fmt.Sprintf("=== Resolved configuration:\n%s===\n", configYAML))
+
+	operations := [][]string{}
+	dockerArgs, err := docker.BuildArgs(imageName, buildSecrets, buildArgs, buildNoCache, buildProgressOutput, config.BuildSourceEpochTimestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case buildDockerfileFile != "":
+		dockerfileContents, err := os.ReadFile(buildDockerfileFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read Dockerfile at %s: %w", buildDockerfileFile, err)
+		}
+		console.Output(fmt.Sprintf("=== Dockerfile contents (from %s):\n%s\n===\n", buildDockerfileFile, dockerfileContents))
+		operations = append(operations, dockerArgs)
+	case buildSeparateWeights:
+		generator, err := newDryRunGenerator(cmd, cfg, projectDir)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanupGenerator(generator)
+
+		weightsDockerfile, runnerDockerfile, dockerignore, err := generator.GenerateModelBaseWithSeparateWeights(imageName)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate Dockerfile: %w", err)
+		}
+		console.Output(fmt.Sprintf("=== Weights Dockerfile contents:\n%s\n===\n", weightsDockerfile))
+		console.Output(fmt.Sprintf("=== Runner Dockerfile contents:\n%s\n===\n", runnerDockerfile))
+		console.Output(fmt.Sprintf("=== DockerIgnore contents:\n%s===\n", dockerignore))
+
+		weightsBuildArgs, err := docker.BuildArgs(imageName+"-weights", buildSecrets, buildArgs, buildNoCache, buildProgressOutput, config.BuildSourceEpochTimestamp)
+		if err != nil {
+			return nil, err
+		}
+		operations = append(operations, weightsBuildArgs, dockerArgs)
+	default:
+		generator, err := newDryRunGenerator(cmd, cfg, projectDir)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanupGenerator(generator)
+
+		dockerfileContents, err := generator.GenerateDockerfileWithoutSeparateWeights()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to generate Dockerfile: %w", err)
+		}
+		console.Output(fmt.Sprintf("=== Dockerfile contents:\n%s\n===\n", dockerfileContents))
+		operations = append(operations, dockerArgs)
+	}
+
+	switch {
+	case buildSchemaFile != "" || (cfg.Runner != nil && cfg.Runner.Schema != ""):
+		// The schema is read from a file
+	case cfg.UsesRunner():
+		// The schema is fetched from the runner's server
+		operations = append(operations, docker.RunArgs(docker.RunOptions{
+			Image: imageName,
+			Ports: []docker.Port{{HostPort: 0, ContainerPort: config.RunnerPort}},
+		}))
+	default:
+		operations = append(operations, docker.RunArgs(docker.RunOptions{
+			Image: imageName,
+			Args:  []string{"python", "-m", "cog.command.openapi_schema"},
+		}))
+	}
+	operations = append(operations, docker.RunArgs(docker.RunOptions{
+		Image: imageName,
+		Args:  []string{"python", "-m", "pip", "freeze"},
+	}))
+	operations = append(operations, docker.AddLabelsArgs(imageName, map[string]string{
+		global.LabelNamespace + "version":        global.Version,
+		global.LabelNamespace + "config":         "<config>",
+		global.LabelNamespace + "openapi_schema": "<openapi schema>",
+		global.LabelNamespace + "pip_freeze":     "<pip freeze>",
+		global.LabelNamespace + "has_init":       "true",
+	}))
+
+	return operations, nil
+}
+
+func printOperations(operations [][]string) {
+	printCommands(commandLines("docker", operations))
+}
+
+// commandLines returns the lines that show running program with each of operations, like "$ gcloud run deploy ..."
+func commandLines(program string, operations [][]string) []string {
+	lines := []string{}
+	for _, args := range operations {
+		lines = append(lines, "$ "+program+" "+strings.Join(args, " "))
+	}
+	return lines
+}
+
+func printCommands(lines []string) {
+	console.Output(fmt.Sprintf("=== Operations:\n%s\n===\n", strings.Join(lines, "\n")))
+}
+
+func newDryRunGenerator(cmd *cobra.Command, cfg *config.Config, projectDir string) (dockerfile.Generator, error) {
+	generator, err := dockerfile.NewGenerator(cfg, projectDir, buildFast)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	generator.SetStrip(buildStrip)
+	generator.SetPrecompile(buildPrecompile)
+	generator.SetUseCudaBaseImage(buildUseCudaBaseImage)
+	if useCogBaseImage := DetermineUseCogBaseImage(cmd); useCogBaseImage != nil {
+		generator.SetUseCogBaseImage(*useCogBaseImage)
+	}
+	manifest, err := image.LoadBuildManifest(projectDir)
+	if err != nil {
+		return nil, err
+	}
+	generator.SetBaseImageDigests(manifest.BaseImages)
+	return generator, nil
+}
+
+func cleanupGenerator(generator dockerfile.Generator) {
+	if err := generator.Cleanup(); err != nil {
+		console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+	}
+}
@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// ejectDir is the directory in the project that cog eject writes the files the Dockerfile copies into the image to
+const ejectDir = "docker"
+
+var (
+	ejectFile            string
+	ejectForce           bool
+	ejectUseCogBaseImage bool
+)
+
+func newEjectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "eject",
+		Short: "Write the model's Dockerfile into the project, to build it without Cog",
+		Long: `Write the Dockerfile Cog generates for the model into the project, with the
+files it copies into the image, so the image can be built with 'docker build'
+and Cog isn't needed to build it any more.
+
+The files are written to the docker directory: the model's requirements.txt,
+and the Cog Python package, which runs the model's HTTP server, as sources.
+They're yours to change, like the Dockerfile. cog.yaml is still needed,
+because the server reads the predictor from it.`,
+		Example: `cog eject
+docker build -t my-model .
+docker run -p 5000:5000 --gpus all my-model`,
+		RunE: cmdEject,
+		Args: cobra.NoArgs,
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	cmd.Flags().BoolVar(&ejectUseCogBaseImage, useCogBaseImageFlagKey, false, "Build on Cog's pre-built base image, rather than an image from Nvidia or Python")
+	cmd.Flags().StringVarP(&ejectFile, "file", "f", "Dockerfile", "Path to write the Dockerfile to, relative to the project")
+	cmd.Flags().BoolVar(&ejectForce, "force", false, "Overwrite the Dockerfile and the files in the docker directory if they exist")
+
+	return cmd
+}
+
+func cmdEject(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	if cfg.Build.Dockerfile != "" && filepath.Clean(cfg.Build.Dockerfile) == filepath.Clean(ejectFile) {
+		return fmt.Errorf("%s is the Dockerfile in build.dockerfile, which the ejected Dockerfile is built from. Write it somewhere else with --file", ejectFile)
+	}
+	dockerfilePath := filepath.Join(projectDir, ejectFile)
+	if !ejectForce {
+		for _, path := range []string{dockerfilePath, filepath.Join(projectDir, ejectDir)} {
+			exists, err := files.Exists(path)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return fmt.Errorf("%s already exists. Pass --force to overwrite it", path)
+			}
+		}
+	}
+
+	generator, err := dockerfile.NewStandardGenerator(cfg, projectDir)
+	if err != nil {
+		return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up after ejecting: %v", err)
+		}
+	}()
+	generator.SetEjectDir(ejectDir)
+	generator.SetUseCudaBaseImage(buildUseCudaBaseImage)
+	generator.SetUseCogBaseImage(ejectUseCogBaseImage)
+
+	contents, err := generator.GenerateDockerfileWithoutSeparateWeights()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dockerfilePath), 0o755); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", filepath.Dir(dockerfilePath), err)
+	}
+	if err := os.WriteFile(dockerfilePath, []byte(contents+"\n"), 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", dockerfilePath, err)
+	}
+	console.Infof("✅ Created %s", dockerfilePath)
+	console.Infof("✅ Created %s", filepath.Join(projectDir, ejectDir))
+
+	for _, run := range cfg.Build.Run {
+		for _, mount := range run.Mounts {
+			if mount.Type == "secret" {
+				console.Warnf("The Dockerfile mounts the secret %s. Pass it to docker build with --secret id=%s,src=<file>", mount.ID, mount.ID)
+			}
+		}
+	}
+	console.Info("")
+	console.Info("Build and run the model with Docker:")
+	buildCommand := "docker build -t my-model ."
+	if ejectFile != "Dockerfile" {
+		buildCommand = fmt.Sprintf("docker build -t my-model -f %s .", ejectFile)
+	}
+	console.Infof("  %s", buildCommand)
+	if cfg.Build.GPU {
+		console.Info("  docker run -p 5000:5000 --gpus all my-model")
+	} else {
+		console.Info("  docker run -p 5000:5000 my-model")
+	}
+	return nil
+}
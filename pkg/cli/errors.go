@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Exit codes for the kinds of errors, so scripts can tell them apart. Other errors exit with 1.
+const (
+	ExitCodeError          = 1
+	ExitCodeConfig         = 3
+	ExitCodeBuild          = 4
+	ExitCodeRegistryAuth   = 5
+	ExitCodeGPUUnavailable = 6
+	// ExitCodeInterrupted is the conventional exit code for a command stopped by Ctrl-C
+	ExitCodeInterrupted = 130
+)
+
+// ExitCode returns the code to exit with after a command fails with err
+func ExitCode(err error) int {
+	if errors.Is(err, context.Canceled) {
+		return ExitCodeInterrupted
+	}
+	switch cogerrors.Code(err) {
+	case cogerrors.CodeConfigNotFound, cogerrors.CodeConfigInvalid:
+		return ExitCodeConfig
+	case cogerrors.CodeBuildFailed:
+		return ExitCodeBuild
+	case cogerrors.CodeRegistryAuth:
+		return ExitCodeRegistryAuth
+	case cogerrors.CodeGPUUnavailable:
+		return ExitCodeGPUUnavailable
+	}
+	return ExitCodeError
+}
+
+// RemediationHint returns a suggestion of how to fix err, or "" if there isn't one
+func RemediationHint(err error) string {
+	var configErr *cogerrors.ConfigError
+	var buildErr *cogerrors.BuildError
+	var authErr *cogerrors.RegistryAuthError
+	var gpuErr *cogerrors.GPUUnavailableError
+	switch {
+	case cogerrors.IsConfigNotFound(err):
+		return "Run this command in a directory with a cog.yaml, pass --project-dir, or run 'cog init' to create one."
+	case errors.As(err, &configErr):
+		return fmt.Sprintf("Fix %s, then try again. The options you can use are documented at https://cog.run/yaml", configErr.Path)
+	case errors.As(err, &buildErr):
+		return buildHint(buildErr)
+	case errors.As(err, &authErr):
+		if authErr.Registry == global.ReplicateRegistryHost {
+			return "Run 'cog login' to log in to Replicate, and check the model exists on replicate.com and you can push to it."
+		}
+		return fmt.Sprintf("Run 'docker login %s' to log in to the registry, and check you have access to the image.", authErr.Registry)
+	case errors.As(err, &gpuErr):
+		return "Docker couldn't give the container a GPU. Install the NVIDIA Container Toolkit, or run without --gpus."
+	}
+	return ""
+}
+
+func buildHint(err *cogerrors.BuildError) string {
+	switch err.Stage {
+	case cogerrors.BuildStageWeights:
+		return "Check the weights in cog.yaml exist, and set HF_TOKEN if they're in a private or gated repository."
+	case cogerrors.BuildStageDockerfile:
+		return "Check the build section of cog.yaml. The options you can use are documented at https://cog.run/yaml"
+	case cogerrors.BuildStageImage:
+		if err.Layer != "" {
+			return fmt.Sprintf("The build failed at %s. Its output is above. If a cached layer is stale, try again with --no-cache.", err.Layer)
+		}
+		return "The build's output is above. If a cached layer is stale, try again with --no-cache."
+	case cogerrors.BuildStageSchema:
+		return "Cog couldn't load the model to get its inputs and outputs. Check predict.py imports without errors with 'cog run python predict.py'."
+	}
+	return "Run the command again with --debug to see more about what went wrong."
+}
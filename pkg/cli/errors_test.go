@@ -0,0 +1,40 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		code int
+	}{
+		{"plain error", errors.New("oops"), ExitCodeError},
+		{"config not found", cogerrors.ConfigNotFound("cog.yaml not found"), ExitCodeConfig},
+		{"invalid config", &cogerrors.ConfigError{Path: "cog.yaml", Err: errors.New("bad")}, ExitCodeConfig},
+		{"wrapped build error", fmt.Errorf("Failed to build: %w", &cogerrors.BuildError{Stage: cogerrors.BuildStageImage, Err: errors.New("exit status 1")}), ExitCodeBuild},
+		{"registry auth", &cogerrors.RegistryAuthError{Registry: "r8.im", Err: errors.New("unauthorized")}, ExitCodeRegistryAuth},
+		{"gpu unavailable", &cogerrors.GPUUnavailableError{Err: errors.New("no driver")}, ExitCodeGPUUnavailable},
+		{"interrupted", fmt.Errorf("Failed to build: %w", context.Canceled), ExitCodeInterrupted},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.code, ExitCode(tt.err))
+		})
+	}
+}
+
+func TestRemediationHint(t *testing.T) {
+	require.Equal(t, "", RemediationHint(errors.New("oops")))
+	require.Contains(t, RemediationHint(&cogerrors.ConfigError{Path: "/src/cog.yaml", Err: errors.New("bad")}), "Fix /src/cog.yaml")
+	require.Contains(t, RemediationHint(&cogerrors.BuildError{Stage: cogerrors.BuildStageImage, Layer: "[stage-0 5/12] RUN pip install torch", Err: errors.New("exit status 1")}), "failed at [stage-0 5/12] RUN pip install torch")
+	require.Contains(t, RemediationHint(&cogerrors.RegistryAuthError{Registry: "r8.im", Err: errors.New("unauthorized")}), "cog login")
+	require.Contains(t, RemediationHint(&cogerrors.RegistryAuthError{Registry: "ghcr.io", Err: errors.New("unauthorized")}), "docker login ghcr.io")
+}
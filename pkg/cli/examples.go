@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/examples"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var examplesExact bool
+
+func newExamplesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "examples",
+		Short: "Replay example predictions saved with 'cog predict --save-example'",
+	}
+	cmd.AddCommand(newExamplesRunCommand())
+	return cmd
+}
+
+func newExamplesRunCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "run [image]",
+		Short: "Run the project's example predictions and check their outputs",
+		Long: `Run the example predictions saved with 'cog predict --save-example',
+and check that their outputs match the saved outputs.
+
+By default, outputs match if they have the same shape, with the same types of
+values and files, because most models don't return exactly the same output
+every time. Pass --exact to require identical outputs.
+
+If 'image' is passed, the examples are run on that image, like a new build
+of the model. Otherwise, they're run on the model in the current directory.`,
+		RunE: cmdExamplesRun,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+
+	cmd.Flags().BoolVar(&examplesExact, "exact", false, "Require outputs to be identical to the saved outputs")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+
+	return cmd
+}
+
+func cmdExamplesRun(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	saved, err := examples.Load(projectDir)
+	if err != nil {
+		return err
+	}
+	if len(saved) == 0 {
+		return fmt.Errorf("There are no examples in %s. Save one with 'cog predict --save-example <name>'", examples.Dir)
+	}
+
+	var imageName string
+	volumes := []docker.Volume{}
+	if len(args) == 0 {
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+	} else {
+		imageName = args[0]
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	}
+
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	runOptions := docker.RunOptions{
+		GPUs:    gpusForConfig(cfg),
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     envFlags,
+		Labels:  containerLabels("predict", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	token, err := addAPIKey(&runOptions, cfg, "")
+	if err != nil {
+		return err
+	}
+	predictor, err := startPredictor(cmd.Context(), runOptions, token, setupTimeoutFor(cmd, cfg))
+	if err != nil {
+		return err
+	}
+	defer stopPredictor(cmd.Context(), predictor)
+
+	failed := 0
+	for _, example := range saved {
+		console.Infof("Running example %s...", example.Name)
+		prediction, err := predictor.Predict(cmd.Context(), example.PredictInputs())
+		switch {
+		case err != nil:
+		case prediction.Status == "failed":
+			err = fmt.Errorf("the prediction failed: %s", prediction.Error)
+		default:
+			err = example.Check(prediction.Output, examplesExact)
+		}
+		if err != nil {
+			failed++
+			console.Errorf("Example %s failed: %s", example.Name, err)
+			continue
+		}
+		console.Infof("Example %s passed", example.Name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d examples failed", failed, len(saved))
+	}
+	console.Infof("All %d examples passed", len(saved))
+	return nil
+}
@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/wasm"
+)
+
+var (
+	exportOutput string
+	exportShapes []string
+)
+
+func newExportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the model to run somewhere other than Docker",
+	}
+	cmd.AddCommand(newExportDevicePluginConfigCommand(), newExportKServeCommand(), newExportSeldonCommand(), newExportWasmCommand())
+	return cmd
+}
+
+func newExportWasmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "wasm [model.onnx]",
+		Short: "Export an ONNX model to a WebAssembly bundle. This is an experimental feature with no guarantees of future support.",
+		Long: `Export an ONNX model to a WebAssembly bundle, which runs the model with
+wasi-nn in runtimes like wasmtime, for edge and serverless platforms.
+
+The bundle only runs the ONNX model, not the predictor, so inputs and outputs
+are the model's tensors, and the predictor's preprocessing isn't included. It's
+for small models whose inputs and outputs are float32 tensors.
+
+If 'model.onnx' isn't passed, the ONNX file in the current directory is
+exported. The module that runs the model is built with Docker.`,
+		Example: `cog export wasm model.onnx --shape pixels=1,3,224,224 -o dist`,
+		RunE:    cmdExportWasm,
+		Args:    cobra.MaximumNArgs(1),
+	}
+
+	addBuildProgressOutputFlag(cmd)
+
+	cmd.Flags().StringVarP(&exportOutput, "output", "o", "wasm", "Directory to write the bundle to")
+	cmd.Flags().StringArrayVar(&exportShapes, "shape", []string{}, "Shape of an input or output whose size is set when the model is run, like the batch size, in the form name=1,3,224,224")
+
+	return cmd
+}
+
+func cmdExportWasm(cmd *cobra.Command, args []string) error {
+	shapes, err := parseShapes(exportShapes)
+	if err != nil {
+		return err
+	}
+
+	var modelPath string
+	if len(args) > 0 {
+		modelPath = args[0]
+	} else {
+		_, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		if modelPath, err = findONNXModel(projectDir); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(exportOutput, 0o755); err != nil {
+		return fmt.Errorf("Failed to create %s: %w", exportOutput, err)
+	}
+	console.Infof("Exporting %s to WebAssembly...", modelPath)
+	manifest, err := wasm.Export(cmd.Context(), modelPath, exportOutput, shapes, buildProgressOutput)
+	if err != nil {
+		return err
+	}
+
+	console.Infof("Wrote %s", exportOutput)
+	for _, input := range manifest.Inputs {
+		console.Infof("  input %s: %v", input.Name, input.Shape)
+	}
+	for _, output := range manifest.Outputs {
+		console.Infof("  output %s: %v", output.Name, output.Shape)
+	}
+	console.Info("")
+	console.Info("Run it with a runtime that has wasi-nn's ONNX backend:")
+	console.Infof("  cd %s && wasmtime run -S nn --dir . %s < inputs.json", exportOutput, wasm.ModuleFile)
+	return nil
+}
+
+// parseShapes parses --shape flags, like "pixels=1,3,224,224"
+func parseShapes(flags []string) (map[string][]int64, error) {
+	shapes := map[string][]int64{}
+	for _, flag := range flags {
+		name, dims, ok := strings.Cut(flag, "=")
+		if !ok || name == "" || dims == "" {
+			return nil, fmt.Errorf("Invalid --shape %q, expected name=dimensions, like pixels=1,3,224,224", flag)
+		}
+		shape := []int64{}
+		for _, d := range strings.Split(dims, ",") {
+			size, err := strconv.ParseInt(strings.TrimSpace(d), 10, 64)
+			if err != nil || size <= 0 {
+				return nil, fmt.Errorf("Invalid --shape %q, expected dimensions to be positive numbers, like pixels=1,3,224,224", flag)
+			}
+			shape = append(shape, size)
+		}
+		shapes[name] = shape
+	}
+	return shapes, nil
+}
+
+// findONNXModel returns the ONNX model in a project, if there's exactly one
+func findONNXModel(projectDir string) (string, error) {
+	models := []string{}
+	err := filepath.WalkDir(projectDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != projectDir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && strings.EqualFold(filepath.Ext(path), ".onnx") {
+			models = append(models, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	switch len(models) {
+	case 0:
+		return "", fmt.Errorf("There's no ONNX model in %s. Export the model to ONNX, then pass its path", projectDir)
+	case 1:
+		return models[0], nil
+	}
+	return "", fmt.Errorf("There's more than one ONNX model in %s. Pass the path of the one to export", projectDir)
+}
@@ -0,0 +1,229 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/manifests"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	exportManifestOutput string
+	exportName           string
+	exportMinReplicas    int
+	exportMaxReplicas    int
+	exportSecretName     string
+	exportKServeProtocol string
+	exportSeldonProtocol string
+
+	exportDevicePluginName      string
+	exportDevicePluginNamespace string
+)
+
+func newExportKServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kserve [IMAGE]",
+		Short: "Generate a KServe InferenceService that runs the model",
+		Long: `Generate a KServe InferenceService that runs the model's image as a custom
+predictor. If 'IMAGE' isn't passed, the image in cog.yaml is used. It must be
+in a registry the cluster can pull from.
+
+The predictor gets the resources and GPUs in cog.yaml, runs as many
+predictions at once as concurrency.max allows, and has the variables in
+environment_variables. Its secrets are read from a Kubernetes Secret with a
+key for each of them.
+
+By default, KServe passes requests to the model's HTTP API as they are. With
+--protocol v2, it sends them in the Open Inference Protocol, and the model's
+inputs and outputs are mapped to tensors.`,
+		Example: `cog export kserve r8.im/alice/hotdog-detector:v2 -o inference-service.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportManifest(cmd, args, "KServe", exportKServeProtocol, manifests.InferenceService)
+		},
+		Args: cobra.MaximumNArgs(1),
+	}
+	addExportManifestFlags(cmd)
+	cmd.Flags().StringVar(&exportKServeProtocol, "protocol", manifests.ProtocolCog, "Protocol KServe sends requests to the model in: cog, for Cog's HTTP API, or v2, for the Open Inference Protocol")
+	return cmd
+}
+
+func newExportSeldonCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "seldon [IMAGE]",
+		Short: "Generate a Seldon Core SeldonDeployment that runs the model",
+		Long: `Generate a Seldon Core SeldonDeployment that runs the model's image as a
+custom model server. If 'IMAGE' isn't passed, the image in cog.yaml is used.
+It must be in a registry the cluster can pull from.
+
+Seldon Core sends requests to the model in the Open Inference Protocol, so the
+model's inputs and outputs are mapped to tensors. The model gets the resources
+and GPUs in cog.yaml, and has the variables in environment_variables. Its
+secrets are read from a Kubernetes Secret with a key for each of them.`,
+		Example: `cog export seldon r8.im/alice/hotdog-detector:v2 -o seldon-deployment.yaml`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return exportManifest(cmd, args, "Seldon Core", exportSeldonProtocol, manifests.SeldonDeployment)
+		},
+		Args: cobra.MaximumNArgs(1),
+	}
+	addExportManifestFlags(cmd)
+	cmd.Flags().StringVar(&exportSeldonProtocol, "protocol", manifests.ProtocolV2, "Protocol Seldon Core sends requests to the model in. Only v2, the Open Inference Protocol, is supported")
+	_ = cmd.Flags().MarkHidden("protocol")
+	return cmd
+}
+
+func newExportDevicePluginConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "device-plugin-config [IMAGE]",
+		Short: "Generate a config for NVIDIA's device plugin that shares GPUs like resources.gpu_sharing says",
+		Long: `Generate a ConfigMap with a config for NVIDIA's Kubernetes device plugin,
+which shares GPUs between models the way resources.gpu_sharing in cog.yaml
+says. If 'IMAGE' is passed, its cog.yaml is used.
+
+With time-slicing or MPS, each GPU is split into 'replicas' shares, which pods
+ask for as nvidia.com/gpu.shared, so models that need a whole GPU never get a
+share of one. With MIG, each size of MIG partition is a resource of its own,
+like nvidia.com/mig-1g.10gb.
+
+The manifests generated by 'cog helm' and 'cog export' ask for these
+resources, and only run on nodes that share their GPUs the same way. Point the
+GPU operator's device plugin at the ConfigMap, and label the nodes that share
+their GPUs with the config's name, as this command shows.`,
+		Example: `cog export device-plugin-config -o device-plugin-config.yaml`,
+		RunE:    cmdExportDevicePluginConfig,
+		Args:    cobra.MaximumNArgs(1),
+	}
+	cmd.Flags().StringVarP(&exportManifestOutput, "output", "o", "", "Path to write the ConfigMap to. Defaults to standard output")
+	cmd.Flags().StringVar(&exportDevicePluginName, "name", "cog-device-plugin-config", "Name of the ConfigMap")
+	cmd.Flags().StringVar(&exportDevicePluginNamespace, "namespace", manifests.DefaultDevicePluginNamespace, "Namespace of the ConfigMap, which is the one the device plugin runs in")
+	return cmd
+}
+
+func cmdExportDevicePluginConfig(cmd *cobra.Command, args []string) error {
+	var cfg *config.Config
+	var err error
+	if len(args) > 0 {
+		if cfg, err = image.GetConfig(cmd.Context(), args[0]); err != nil {
+			return fmt.Errorf("Failed to read the Cog config from %s. Pull or build the image first: %w", args[0], err)
+		}
+	} else if cfg, _, err = config.GetConfig(projectDirFlag); err != nil {
+		return err
+	}
+	manifest, err := manifests.DevicePluginConfig(cfg, exportDevicePluginName, exportDevicePluginNamespace)
+	if err != nil {
+		return err
+	}
+
+	if exportManifestOutput == "" {
+		fmt.Print(string(manifest))
+	} else {
+		if err := os.WriteFile(exportManifestOutput, manifest, 0o644); err != nil { //#nosec G306
+			return fmt.Errorf("Failed to write %s: %w", exportManifestOutput, err)
+		}
+		console.Infof("Wrote %s", exportManifestOutput)
+	}
+
+	sharing := cfg.Resources.GPUSharing
+	console.Info("To share GPUs with it, apply it, point the GPU operator's device plugin at it, and label the nodes:")
+	console.Infof("  kubectl patch clusterpolicies.nvidia.com/cluster-policy --type merge -p '{\"spec\": {\"devicePlugin\": {\"config\": {\"name\": \"%s\"}}}}'", exportDevicePluginName)
+	console.Infof("  kubectl label node <node> nvidia.com/device-plugin.config=%s", manifests.DevicePluginConfigKey(sharing))
+	if sharing.Strategy == config.GPUSharingMIG {
+		console.Info("Partition the nodes' GPUs with NVIDIA's MIG manager too, like:")
+		console.Infof("  kubectl label node <node> nvidia.com/mig.config=all-%s", sharing.MIGProfile)
+	}
+	return nil
+}
+
+func addExportManifestFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&exportManifestOutput, "output", "o", "", "Path to write the manifest to. Defaults to standard output")
+	cmd.Flags().StringVar(&exportName, "name", "", "Name of the model's resource. Defaults to the name of the image's repository")
+	cmd.Flags().IntVar(&exportMinReplicas, "min-replicas", 1, "Fewest copies of the model to run")
+	cmd.Flags().IntVar(&exportMaxReplicas, "max-replicas", 1, "Most copies of the model to run")
+	cmd.Flags().StringVar(&exportSecretName, "secret-name", "", "Kubernetes Secret to read the model's secrets from. Defaults to the name of the model's resource")
+}
+
+func exportManifest(cmd *cobra.Command, args []string, operator string, protocol string, generate func(*config.Config, manifests.Options) ([]byte, error)) error {
+	var imageName string
+	var cfg *config.Config
+	if len(args) > 0 {
+		imageName = args[0]
+		var err error
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return fmt.Errorf("Failed to read the Cog config from %s. Pull or build the image first: %w", imageName, err)
+		}
+	} else {
+		var err error
+		if cfg, _, err = config.GetConfig(projectDirFlag); err != nil {
+			return err
+		}
+		if cfg.Image == "" {
+			return fmt.Errorf("Set 'image' in cog.yaml to the repository the cluster pulls the model from, or pass the image")
+		}
+		imageName = cfg.Image
+	}
+
+	resourceName := exportName
+	if resourceName == "" {
+		var err error
+		if resourceName, err = manifests.ResourceName(imageName); err != nil {
+			return err
+		}
+	}
+	manifest, err := generate(cfg, manifests.Options{
+		Name:        resourceName,
+		Image:       imageName,
+		MinReplicas: exportMinReplicas,
+		MaxReplicas: exportMaxReplicas,
+		Protocol:    protocol,
+		SecretName:  exportSecretName,
+	})
+	if err != nil {
+		return err
+	}
+
+	if protocol == manifests.ProtocolV2 {
+		showV2Metadata(cmd, imageName, resourceName, operator)
+	}
+	if len(cfg.Volumes) > 0 {
+		console.Warn("The volumes in cog.yaml aren't in the manifest. Add them to the model's container as persistent volumes.")
+	}
+	if len(cfg.SharedWeights()) > 0 {
+		console.Warn("The shared weights in cog.yaml aren't in the image or the manifest. Mount them into the model's container, like 'cog weights pull' shows.")
+	}
+
+	if exportManifestOutput == "" {
+		fmt.Print(string(manifest))
+		return nil
+	}
+	if err := os.WriteFile(exportManifestOutput, manifest, 0o644); err != nil { //#nosec G306
+		return fmt.Errorf("Failed to write %s: %w", exportManifestOutput, err)
+	}
+	console.Infof("Wrote %s", exportManifestOutput)
+	return nil
+}
+
+// showV2Metadata shows how the model's inputs and outputs are mapped to tensors in the Open Inference Protocol, and
+// warns about the ones that can't be
+func showV2Metadata(cmd *cobra.Command, imageName string, modelName string, operator string) {
+	schema, err := image.GetOpenAPISchema(cmd.Context(), imageName)
+	if err != nil {
+		console.Warnf("Can't show the model's inputs and outputs in the Open Inference Protocol, because its schema couldn't be read: %s", err)
+		return
+	}
+	metadata, unmapped := manifests.V2Metadata(modelName, schema)
+	console.Infof("%s sends requests to the model in the Open Inference Protocol, with these tensors:", operator)
+	for _, tensor := range metadata.Inputs {
+		console.Infof("  input %s: %s %v", tensor.Name, tensor.Datatype, tensor.Shape)
+	}
+	for _, tensor := range metadata.Outputs {
+		console.Infof("  output %s: %s %v", tensor.Name, tensor.Datatype, tensor.Shape)
+	}
+	if len(unmapped) > 0 {
+		console.Warnf("These inputs and outputs can't be tensors: %s. Inputs like these can be passed in the request's parameters.", strings.Join(unmapped, ", "))
+	}
+}
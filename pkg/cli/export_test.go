@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseShapes(t *testing.T) {
+	shapes, err := parseShapes([]string{"pixels=1,3,224,224", "mask=1, 224"})
+	require.NoError(t, err)
+	require.Equal(t, map[string][]int64{"pixels": {1, 3, 224, 224}, "mask": {1, 224}}, shapes)
+
+	for _, flag := range []string{"pixels", "=1,3", "pixels=", "pixels=1,x", "pixels=0,3"} {
+		_, err := parseShapes([]string{flag})
+		require.ErrorContains(t, err, "Invalid --shape", flag)
+	}
+}
+
+func TestFindONNXModel(t *testing.T) {
+	dir := t.TempDir()
+	_, err := findONNXModel(dir)
+	require.ErrorContains(t, err, "There's no ONNX model")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "weights"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights", "model.onnx"), []byte{}, 0o644))
+	// Hidden directories, like Cog's own, are left out
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".cog"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".cog", "old.onnx"), []byte{}, 0o644))
+	model, err := findONNXModel(dir)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "weights", "model.onnx"), model)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.ONNX"), []byte{}, 0o644))
+	_, err = findONNXModel(dir)
+	require.ErrorContains(t, err, "more than one ONNX model")
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/helm"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+var (
+	helmName   string
+	helmOutput string
+	helmForce  bool
+
+	helmCanary       string
+	helmCanaryWeight int
+	helmShadow       bool
+)
+
+func newHelmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "helm [IMAGE]",
+		Short: "Generate a Helm chart that runs the model on Kubernetes",
+		Long: `Generate a Helm chart that runs the model's HTTP server on Kubernetes.
+
+The chart runs 'IMAGE', or the image in cog.yaml, which must be in a registry
+the cluster can pull from. Its values are generated from cog.yaml: the model's
+resources and GPUs, environment_variables, and the names of its secrets, which
+it reads from a Kubernetes Secret. It also has values for replicas, autoscaling
+and an ingress, which are off until you turn them on.
+
+With --canary, the chart also runs a new version of the model next to IMAGE,
+and a Gateway API HTTPRoute sends --canary-weight percent of requests to it. With
+--shadow, the canary gets a copy of every request instead, and its responses are
+thrown away. Compare the two versions with 'cog compare-metrics'.
+
+The chart is yours to change after it's generated, and to commit alongside the
+model, so it can be deployed with Helm, Argo CD or Flux.`,
+		Example: `cog helm r8.im/alice/hotdog-detector:v2 -o charts/hotdog-detector
+cog helm r8.im/alice/hotdog-detector:v2 --canary r8.im/alice/hotdog-detector:v3 --canary-weight 5`,
+		RunE: cmdHelm,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().StringVar(&helmName, "name", "", "Name of the chart. Defaults to the name of the image's repository")
+	cmd.Flags().StringVarP(&helmOutput, "output", "o", "", "Directory to write the chart to. Defaults to a directory named after the chart")
+	cmd.Flags().BoolVar(&helmForce, "force", false, "Overwrite the chart's files if the directory already exists")
+	cmd.Flags().StringVar(&helmCanary, "canary", "", "Image of a new version of the model to run next to IMAGE on a share of requests")
+	cmd.Flags().IntVar(&helmCanaryWeight, "canary-weight", helm.DefaultCanaryWeight, "Percentage of requests that go to the canary")
+	cmd.Flags().BoolVar(&helmShadow, "shadow", false, "Send the canary a copy of every request, and throw away its responses, rather than a share of them")
+
+	return cmd
+}
+
+func cmdHelm(cmd *cobra.Command, args []string) error {
+	cfg, _, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	imageName := cfg.Image
+	if len(args) > 0 {
+		imageName = args[0]
+	}
+	if imageName == "" {
+		return fmt.Errorf("Set 'image' in cog.yaml to the repository the cluster pulls the model from, or pass the image")
+	}
+
+	chartName := helmName
+	if chartName == "" {
+		if chartName, err = helm.ChartName(imageName); err != nil {
+			return err
+		}
+	}
+	if helmCanary == "" && (cmd.Flags().Changed("canary-weight") || helmShadow) {
+		return fmt.Errorf("--canary-weight and --shadow need a --canary image")
+	}
+	if helmCanaryWeight < 0 || helmCanaryWeight > 100 {
+		return fmt.Errorf("--canary-weight must be a percentage from 0 to 100")
+	}
+	chartFiles, err := helm.Generate(cfg, helm.Chart{
+		Name:         chartName,
+		Image:        imageName,
+		Canary:       helmCanary,
+		CanaryWeight: helmCanaryWeight,
+		Shadow:       helmShadow,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The cluster doesn't have the paths on this machine that volumes and devices refer to
+	if len(cfg.Volumes) > 0 {
+		console.Warn("The volumes in cog.yaml aren't in the chart. Add them to templates/_deployment.tpl as persistent volumes.")
+	}
+	if len(cfg.SharedWeights()) > 0 {
+		console.Warn("The shared weights in cog.yaml aren't in the image or the chart. Mount them into the model's container in templates/_deployment.tpl, like 'cog weights pull' shows.")
+	}
+	if len(cfg.Devices) > 0 {
+		console.Warn("The devices in cog.yaml aren't in the chart. Give the model its devices with a device plugin.")
+	}
+
+	dir := helmOutput
+	if dir == "" {
+		dir = chartName
+	}
+	exists, err := files.Exists(dir)
+	if err != nil {
+		return err
+	}
+	if exists && !helmForce {
+		return fmt.Errorf("%s already exists. Pass --force to overwrite its files", dir)
+	}
+
+	paths := make([]string, 0, len(chartFiles))
+	for p := range chartFiles {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		target := filepath.Join(dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, chartFiles[p], 0o644); err != nil { //#nosec G306
+			return fmt.Errorf("Failed to write %s: %w", target, err)
+		}
+	}
+
+	console.Infof("Wrote Helm chart %s to %s", chartName, dir)
+	console.Info("")
+	console.Info("Install it with:")
+	console.Infof("  helm install %s %s", chartName, dir)
+	if helmCanary != "" {
+		console.Info("")
+		console.Info("The canary is routed to by an HTTPRoute, so the cluster needs a Gateway API implementation. Set httpRoute.parentRefs to your Gateway.")
+	}
+	if len(cfg.Secrets) > 0 {
+		console.Info("")
+		console.Info("The model reads its secrets from a Kubernetes Secret, which 'helm install' prints how to create.")
+	}
+	return nil
+}
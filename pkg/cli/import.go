@@ -0,0 +1,341 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/bento"
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/importer"
+	"github.com/replicate/cog/pkg/mlflow"
+	"github.com/replicate/cog/pkg/torchserve"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+var (
+	importOutput   string
+	importGPU      bool
+	importNoBuild  bool
+	importBentoAPI string
+)
+
+func newImportCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import a model saved with another tool, so Cog can build and run it",
+	}
+	cmd.AddCommand(newImportBentoCommand(), newImportMLflowCommand(), newImportTorchServeCommand())
+	return cmd
+}
+
+func newImportBentoCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bento <bento>",
+		Short: "Import a Bento built with BentoML, and build an image that runs it",
+		Long: `Import a Bento built with BentoML, and build an image that runs it.
+
+'bento' is a Bento's directory, an archive made with 'bentoml export', or a
+tag in BentoML's store, like iris_classifier:latest.
+
+The Bento is copied to bento/ in the output directory, with a cog.yaml that
+installs its requirements and system packages with the version of Python it
+was built with, and a predictor that serves it with BentoML and calls one of
+its APIs. Each argument of the API is an input of the predictor.
+
+The files are yours to change after they're generated. Use --no-build to
+change them before the image is built.`,
+		Example: `cog import bento iris_classifier:latest --api classify -t iris-classifier`,
+		RunE:    cmdImportBento,
+		Args:    cobra.ExactArgs(1),
+	}
+	addImportFlags(cmd)
+	cmd.Flags().StringVar(&importBentoAPI, "api", "", "The Bento's API to run predictions with. Defaults to its first one")
+	return cmd
+}
+
+func newImportMLflowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mlflow <model-uri>",
+		Short: "Import an MLflow model, and build an image that runs it",
+		Long: `Import a model saved with MLflow, and build an image that runs it.
+
+'model-uri' is a directory with the model's MLmodel file, or a URI the mlflow
+CLI can download, like models:/hotdog-detector/3 or runs:/<run id>/model, from
+the tracking server in MLFLOW_TRACKING_URI.
+
+The model is copied to model/ in the output directory, with a cog.yaml that
+installs its requirements with the version of Python it was saved with, and a
+predictor that loads it with its python_function flavor. If the model's
+signature has a column for each of its inputs, the predictor has an input for
+each of them and runs the model on one row. Otherwise, it takes the model's
+input as JSON.
+
+The files are yours to change after they're generated. Use --no-build to
+change them before the image is built.`,
+		Example: `cog import mlflow models:/hotdog-detector/3 -o hotdog-detector -t hotdog-detector`,
+		RunE:    cmdImportMLflow,
+		Args:    cobra.ExactArgs(1),
+	}
+	addImportFlags(cmd)
+	return cmd
+}
+
+func newImportTorchServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "torchserve <model.mar>",
+		Short: "Import a TorchServe model archive, and build an image that runs it",
+		Long: `Import a TorchServe model archive, and build an image that runs it.
+
+'model.mar' is an archive made with torch-model-archiver, or a directory it's
+been extracted to.
+
+The archive is extracted to model/ in the output directory, with a cog.yaml
+that installs its requirements, PyTorch and TorchServe's Python library, and a
+predictor that runs its handler without TorchServe's frontend. If the handler
+is one of TorchServe's default handlers for images, the predictor takes an
+image. Otherwise it takes text, which is passed to the handler as JSON if it's
+valid JSON.
+
+The files are yours to change after they're generated. Use --no-build to
+change them before the image is built.`,
+		Example: `cog import torchserve densenet161.mar --gpu -t densenet161`,
+		RunE:    cmdImportTorchServe,
+		Args:    cobra.ExactArgs(1),
+	}
+	addImportFlags(cmd)
+	return cmd
+}
+
+func addImportFlags(cmd *cobra.Command) {
+	addSecretsFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addPinBaseImageFlag(cmd)
+
+	cmd.Flags().StringVarP(&importOutput, "output", "o", ".", "Directory to write the model, cog.yaml and predictor to")
+	cmd.Flags().BoolVar(&importGPU, "gpu", false, "Run the model on a GPU")
+	cmd.Flags().BoolVar(&importNoBuild, "no-build", false, "Only write the files, without building the image")
+	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+}
+
+func cmdImportBento(cmd *cobra.Command, args []string) error {
+	dir, err := importOutputDir(bento.BentoDir)
+	if err != nil {
+		return err
+	}
+
+	src := args[0]
+	if isDir, _ := files.IsDir(src); !isDir {
+		if exists, err := files.Exists(src); err != nil {
+			return err
+		} else if exists {
+			extractDir, err := os.MkdirTemp("", "cog-bento-")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(extractDir)
+			if err := bento.Extract(src, extractDir); err != nil {
+				return err
+			}
+			src = extractDir
+		} else if src, err = bento.Path(src); err != nil {
+			return err
+		}
+	}
+
+	b, err := bento.Read(src)
+	if err != nil {
+		return err
+	}
+	api, err := b.API(importBentoAPI)
+	if err != nil {
+		return err
+	}
+	console.Infof("\nImporting the Bento %s:%s, built with BentoML %s, with its %s API", b.Name, b.Version, b.BentoMLVersion, api.Name)
+	if b.HasWheels {
+		console.Warn("The Bento has Python wheels of its own, which aren't installed. Add them to requirements.txt.")
+	}
+	if b.HasSetupScript {
+		console.Warn("The Bento has a setup script for its Docker image, which isn't run. Add its commands to run in cog.yaml.")
+	}
+	predictor, err := bento.Predictor(api)
+	if err != nil {
+		return err
+	}
+
+	return writeImport(cmd, dir, importedModel{
+		generatedBy: "cog import bento",
+		source:      args[0],
+		dir:         bento.BentoDir,
+		src:         src,
+		env:         b.Environment(),
+		predictor:   predictor,
+	})
+}
+
+func cmdImportMLflow(cmd *cobra.Command, args []string) error {
+	uri := args[0]
+	dir, err := importOutputDir(mlflow.ModelDir)
+	if err != nil {
+		return err
+	}
+
+	src := strings.TrimPrefix(uri, "file://")
+	if isDir, _ := files.IsDir(src); !isDir {
+		downloadDir, err := os.MkdirTemp("", "cog-mlflow-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(downloadDir)
+		if src, err = mlflow.Download(uri, downloadDir); err != nil {
+			return err
+		}
+	}
+
+	model, err := mlflow.ReadModel(src)
+	if err != nil {
+		return err
+	}
+	console.Infof("\nImporting an MLflow model with the flavors %s, saved with Python %s", strings.Join(model.Flavors, ", "), importer.PythonVersion(model.PythonVersion))
+	if len(model.CondaPackages) > 0 {
+		console.Warnf("The model's conda environment has packages that aren't pip packages, which Cog can't install: %s. Add the ones it needs to system_packages or python_packages in cog.yaml.", strings.Join(model.CondaPackages, ", "))
+	}
+	predictor, err := mlflow.Predictor(model)
+	if err != nil {
+		return err
+	}
+	if model.Columns == nil {
+		console.Info("The model's signature hasn't got a column for each of its inputs, so the predictor takes its input as JSON.")
+	}
+
+	return writeImport(cmd, dir, importedModel{
+		generatedBy: "cog import mlflow",
+		source:      uri,
+		dir:         mlflow.ModelDir,
+		src:         src,
+		env:         model.Environment(),
+		predictor:   predictor,
+	})
+}
+
+func cmdImportTorchServe(cmd *cobra.Command, args []string) error {
+	dir, err := importOutputDir(torchserve.ModelDir)
+	if err != nil {
+		return err
+	}
+
+	src := args[0]
+	if isDir, _ := files.IsDir(src); !isDir {
+		extractDir, err := os.MkdirTemp("", "cog-torchserve-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(extractDir)
+		if err := torchserve.Extract(src, extractDir); err != nil {
+			return err
+		}
+		src = extractDir
+	}
+
+	archive, err := torchserve.Read(src)
+	if err != nil {
+		return err
+	}
+	console.Infof("\nImporting the TorchServe model %s %s, with the handler %s", archive.ModelName, archive.ModelVersion, archive.Handler)
+	predictor, err := torchserve.Predictor(archive)
+	if err != nil {
+		return err
+	}
+
+	return writeImport(cmd, dir, importedModel{
+		generatedBy: "cog import torchserve",
+		source:      args[0],
+		src:         src,
+		dir:         torchserve.ModelDir,
+		env:         archive.Environment(),
+		predictor:   predictor,
+	})
+}
+
+// importedModel is a model saved with another tool, and what's generated to run it with Cog
+type importedModel struct {
+	// generatedBy is the command that imported the model, like "cog import mlflow"
+	generatedBy string
+	// source is where the model came from
+	source string
+	// src is the model's directory on this machine
+	src string
+	// dir is the directory in the project the model is copied to
+	dir       string
+	env       importer.Environment
+	predictor []byte
+}
+
+// importOutputDir returns the directory to write an imported model to, and checks it hasn't already got the files
+// that are written to it, including the directory the model is copied to
+func importOutputDir(modelDir string) (string, error) {
+	dir, err := filepath.Abs(importOutput)
+	if err != nil {
+		return "", err
+	}
+	for _, filename := range []string{"cog.yaml", "predict.py", "requirements.txt", modelDir} {
+		if exists, err := files.Exists(filepath.Join(dir, filename)); err != nil {
+			return "", err
+		} else if exists {
+			return "", fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!)", filename)
+		}
+	}
+	return dir, nil
+}
+
+// writeImport copies an imported model to the project, writes its cog.yaml, predictor and requirements, and builds
+// it, unless --no-build is set
+func writeImport(cmd *cobra.Command, dir string, model importedModel) error {
+	modelDir := filepath.Join(dir, model.dir)
+	if err := files.CopyDir(model.src, modelDir); err != nil {
+		return fmt.Errorf("Failed to copy the model to %s: %w", modelDir, err)
+	}
+	console.Infof("✅ Created %s", modelDir)
+
+	env := model.env
+	env.GPU = importGPU
+	fileContentMap := map[string][]byte{
+		"cog.yaml":         importer.CogYaml(env, model.generatedBy, model.source),
+		"predict.py":       model.predictor,
+		"requirements.txt": importer.RequirementsFile(env, model.generatedBy),
+	}
+	if exists, err := files.Exists(filepath.Join(dir, ".dockerignore")); err != nil {
+		return err
+	} else if !exists {
+		fileContentMap[".dockerignore"] = dockerignoreContent
+	}
+	if err := writeInitFiles(dir, fileContentMap); err != nil {
+		return err
+	}
+	if importNoBuild {
+		return nil
+	}
+
+	cfg, projectDir, err := config.GetConfig(dir)
+	if err != nil {
+		return err
+	}
+	imageName := buildTag
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+	if err := image.Build(cmd.Context(), cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, "", "", DetermineUseCogBaseImage(cmd), false, false, false, buildPinBaseImage); err != nil {
+		return err
+	}
+	console.Infof("\nImage built as %s", imageName)
+	return nil
+}
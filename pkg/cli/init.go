@@ -5,7 +5,7 @@ import (
 	_ "embed"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 
@@ -25,27 +25,38 @@ var predictPyContent []byte
 //go:embed init-templates/.github/workflows/push.yaml
 var actionsWorkflowContent []byte
 
+var initInteractive bool
+
 func newInitCommand() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:        "init",
 		SuggestFor: []string{"new", "start"},
 		Short:      "Configure your project for use with Cog",
+		Long: `Configure your project for use with Cog, by creating cog.yaml and an example predictor.
+
+With --interactive, it looks at the project's code to work out what the model needs, like its
+requirements file, whether it uses CUDA, and the function that runs it, asks a few questions,
+and writes a cog.yaml and a predictor that calls the function.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			return initCommand(args)
 		},
 		Args: cobra.MaximumNArgs(0),
 	}
+	cmd.Flags().BoolVarP(&initInteractive, "interactive", "i", false, "Inspect the project and ask questions to write a cog.yaml and predictor for it")
 
 	return cmd
 }
 
 func initCommand(args []string) error {
-	console.Infof("\nSetting up the current directory for use with Cog...\n")
-
 	cwd, err := os.Getwd()
 	if err != nil {
 		return err
 	}
+	if initInteractive {
+		return initInteractiveCommand(cwd)
+	}
+
+	console.Infof("\nSetting up the current directory for use with Cog...\n")
 
 	fileContentMap := map[string][]byte{
 		"cog.yaml":                    cogYamlContent,
@@ -54,8 +65,13 @@ func initCommand(args []string) error {
 		".github/workflows/push.yaml": actionsWorkflowContent,
 	}
 
+	return writeInitFiles(cwd, fileContentMap)
+}
+
+// writeInitFiles writes the files that 'cog init' creates, with paths relative to dir, unless any of them exist
+func writeInitFiles(dir string, fileContentMap map[string][]byte) error {
 	for filename, content := range fileContentMap {
-		filePath := path.Join(cwd, filename)
+		filePath := filepath.Join(dir, filename)
 		fileExists, err := files.Exists(filePath)
 		if err != nil {
 			return err
@@ -65,7 +81,7 @@ func initCommand(args []string) error {
 			return fmt.Errorf("Found an existing %s.\nExiting without overwriting (to be on the safe side!)", filename)
 		}
 
-		dirPath := path.Dir(filePath)
+		dirPath := filepath.Dir(filePath)
 		err = os.MkdirAll(dirPath, os.ModePerm)
 		if err != nil {
 			return fmt.Errorf("Error creating directory %s: %w", dirPath, err)
@@ -0,0 +1,195 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/detect"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// initAnswers are the answers to the questions 'cog init --interactive' asks
+type initAnswers struct {
+	PythonVersion string
+	GPU           bool
+	// EntryPoint is the function the predictor calls to run predictions, or nil to write an example predictor
+	EntryPoint *detect.EntryPoint
+	// PredictorFile is where the predictor goes, like "predict.py"
+	PredictorFile string
+}
+
+// predictorTypes are the types of inputs and outputs that the predictor can use from an entry point's annotations
+var predictorTypes = map[string]bool{"str": true, "int": true, "float": true, "bool": true, "Path": true}
+
+func initInteractiveCommand(dir string) error {
+	project, err := detect.Inspect(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to inspect the project: %w", err)
+	}
+
+	console.Infof("\nSetting up the current directory for use with Cog...\n")
+	if project.Requirements != "" {
+		console.Infof("Found Python packages in %s", project.Requirements)
+	}
+	if len(project.Frameworks) > 0 {
+		console.Infof("Found code that uses %s", strings.Join(project.Frameworks, ", "))
+	}
+	if project.UsesCUDA {
+		console.Info("Found code that uses CUDA")
+	}
+	console.Info("")
+
+	answers := initAnswers{}
+	pythonVersion := project.PythonVersion
+	if pythonVersion == "" {
+		pythonVersion = "3.12"
+	}
+	if answers.PythonVersion, err = (console.Interactive{Prompt: "Python version", Default: pythonVersion, Required: true}).Read(); err != nil {
+		return err
+	}
+	if answers.GPU, err = (console.InteractiveBool{Prompt: "Does the model need a GPU?", Default: project.UsesCUDA, NonDefaultFlag: "--interactive=false"}).Read(); err != nil {
+		return err
+	}
+
+	if len(project.EntryPoints) > 0 {
+		console.Info("\nFunctions that might run the model:")
+		options := []string{"0"}
+		for i, entryPoint := range project.EntryPoints {
+			console.Infof("  %d. %s in %s", i+1, entryPoint.Function, entryPoint.File)
+			options = append(options, strconv.Itoa(i+1))
+		}
+		choice, err := (console.Interactive{Prompt: "Which one runs predictions? 0 writes an example predictor instead", Default: "1", Options: options}).Read()
+		if err != nil {
+			return err
+		}
+		if i, _ := strconv.Atoi(choice); i > 0 {
+			answers.EntryPoint = &project.EntryPoints[i-1]
+		}
+	}
+
+	predictorFile := "predict.py"
+	if exists, err := files.Exists(filepath.Join(dir, predictorFile)); err != nil {
+		return err
+	} else if exists {
+		predictorFile = "infer.py"
+	}
+	if answers.PredictorFile, err = (console.Interactive{Prompt: "File to write the predictor to", Default: predictorFile, Required: true}).Read(); err != nil {
+		return err
+	}
+
+	return writeInitFiles(dir, map[string][]byte{
+		"cog.yaml":                    initCogYaml(project, answers),
+		answers.PredictorFile:         initPredictor(answers),
+		".dockerignore":               dockerignoreContent,
+		".github/workflows/push.yaml": actionsWorkflowContent,
+	})
+}
+
+// initCogYaml returns a cog.yaml for a project, configured with the answers to the questions
+func initCogYaml(project *detect.Project, answers initAnswers) []byte {
+	var b strings.Builder
+	b.WriteString("# Configuration for Cog ⚙️\n# Reference: https://cog.run/yaml\n\nbuild:\n")
+	fmt.Fprintf(&b, "  # set to true if your model requires a GPU\n  gpu: %t\n\n", answers.GPU)
+	fmt.Fprintf(&b, "  # python version in the form '3.11' or '3.11.4'\n  python_version: %q\n\n", answers.PythonVersion)
+	switch {
+	case project.Requirements != "":
+		fmt.Fprintf(&b, "  # the Python packages the model needs\n  python_requirements: %s\n\n", project.Requirements)
+	case len(project.Frameworks) > 0:
+		b.WriteString("  # a list of packages in the format <package-name>==<version>\n")
+		b.WriteString("  # pin these to the versions the model was written for\n  python_packages:\n")
+		for _, framework := range project.Frameworks {
+			fmt.Fprintf(&b, "    - %q\n", detect.PythonPackage(framework))
+		}
+		b.WriteString("\n")
+	default:
+		b.WriteString("  # a list of packages in the format <package-name>==<version>\n  # python_packages:\n  #   - \"numpy==1.26.4\"\n\n")
+	}
+	b.WriteString("  # a list of ubuntu apt packages to install\n  # system_packages:\n  #   - \"libgl1-mesa-glx\"\n\n")
+	b.WriteString("  # commands run after the environment is setup\n  # run:\n  #   - \"echo env is ready!\"\n\n")
+	fmt.Fprintf(&b, "# %s defines how predictions are run on your model\npredict: \"%s:Predictor\"\n", answers.PredictorFile, answers.PredictorFile)
+	return []byte(b.String())
+}
+
+// initPredictor returns a predictor that calls the entry point in the answers, with its arguments as inputs, or the
+// example predictor if there isn't one
+func initPredictor(answers initAnswers) []byte {
+	entryPoint := answers.EntryPoint
+	if entryPoint == nil {
+		return predictPyContent
+	}
+
+	usesPath := false
+	usesAny := false
+	parameters := []string{}
+	arguments := []string{}
+	for _, argument := range entryPoint.Arguments {
+		literal, ok := literalType(argument.Default)
+		if !ok {
+			// The default isn't a literal that an input can have, so the function's default is used
+			continue
+		}
+		t := argument.Type
+		if !predictorTypes[t] {
+			t = literal
+		}
+		usesPath = usesPath || t == "Path"
+		input := "Input(description=" + strconv.Quote(strings.ReplaceAll(argument.Name, "_", " ")) + ")"
+		if argument.Default != "" {
+			input = "Input(description=" + strconv.Quote(strings.ReplaceAll(argument.Name, "_", " ")) + ", default=" + argument.Default + ")"
+		}
+		parameters = append(parameters, fmt.Sprintf("        %s: %s = %s,", argument.Name, t, input))
+		arguments = append(arguments, argument.Name+"="+argument.Name)
+	}
+	returnType := entryPoint.ReturnType
+	if !predictorTypes[returnType] {
+		returnType = "Any"
+		usesAny = true
+	}
+	usesPath = usesPath || returnType == "Path"
+
+	var b strings.Builder
+	b.WriteString("# Prediction interface for Cog ⚙️\n# https://cog.run/python\n\n")
+	if usesAny {
+		b.WriteString("from typing import Any\n\n")
+	}
+	if usesPath {
+		b.WriteString("from cog import BasePredictor, Input, Path\n\n")
+	} else {
+		b.WriteString("from cog import BasePredictor, Input\n\n")
+	}
+	fmt.Fprintf(&b, "from %s import %s\n\n\n", entryPoint.Module(), entryPoint.Function)
+	b.WriteString("class Predictor(BasePredictor):\n")
+	b.WriteString("    def setup(self) -> None:\n")
+	b.WriteString("        \"\"\"Load the model into memory to make running multiple predictions efficient\"\"\"\n\n")
+	b.WriteString("    def predict(\n        self,\n")
+	for _, parameter := range parameters {
+		b.WriteString(parameter + "\n")
+	}
+	fmt.Fprintf(&b, "    ) -> %s:\n", returnType)
+	b.WriteString("        \"\"\"Run a single prediction on the model\"\"\"\n")
+	fmt.Fprintf(&b, "        return %s(%s)\n", entryPoint.Function, strings.Join(arguments, ", "))
+	return []byte(b.String())
+}
+
+// literalType returns the type of an input with a Python literal as its default, which is str if it hasn't got a
+// default or it's None. It's not ok if the default isn't a literal of a type an input can have.
+func literalType(literal string) (string, bool) {
+	switch {
+	case literal == "" || literal == "None":
+		return "str", true
+	case literal == "True" || literal == "False":
+		return "bool", true
+	case strings.HasPrefix(literal, `"`) || strings.HasPrefix(literal, "'"):
+		return "str", true
+	}
+	if _, err := strconv.ParseInt(literal, 10, 64); err == nil {
+		return "int", true
+	}
+	if _, err := strconv.ParseFloat(literal, 64); err == nil {
+		return "float", true
+	}
+	return "", false
+}
@@ -6,6 +6,9 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/detect"
 )
 
 func TestInit(t *testing.T) {
@@ -20,3 +23,62 @@ func TestInit(t *testing.T) {
 	require.FileExists(t, path.Join(dir, "cog.yaml"))
 	require.FileExists(t, path.Join(dir, "predict.py"))
 }
+
+func TestInitCogYaml(t *testing.T) {
+	project := &detect.Project{Frameworks: []string{"sklearn", "torch"}}
+	contents := initCogYaml(project, initAnswers{PythonVersion: "3.11", GPU: true, PredictorFile: "infer.py"})
+	cfg, err := config.FromYAML(contents)
+	require.NoError(t, err)
+	require.True(t, cfg.Build.GPU)
+	require.Equal(t, "3.11", cfg.Build.PythonVersion)
+	require.Equal(t, []string{"scikit-learn", "torch"}, cfg.Build.PythonPackages)
+	require.Equal(t, "infer.py:Predictor", cfg.Predict)
+
+	project = &detect.Project{Requirements: "requirements.txt", Frameworks: []string{"torch"}}
+	cfg, err = config.FromYAML(initCogYaml(project, initAnswers{PythonVersion: "3.12", PredictorFile: "predict.py"}))
+	require.NoError(t, err)
+	require.False(t, cfg.Build.GPU)
+	require.Equal(t, "requirements.txt", cfg.Build.PythonRequirements)
+	require.Empty(t, cfg.Build.PythonPackages)
+}
+
+func TestInitPredictor(t *testing.T) {
+	require.Equal(t, predictPyContent, initPredictor(initAnswers{}))
+
+	predictor := initPredictor(initAnswers{EntryPoint: &detect.EntryPoint{
+		File:     "models/infer.py",
+		Function: "run",
+		Arguments: []detect.Argument{
+			{Name: "image", Type: "Path"},
+			{Name: "num_steps", Default: "50"},
+			{Name: "guidance", Type: "float", Default: "7.5"},
+			{Name: "negative_prompt", Type: "Optional[str]", Default: "None"},
+			{Name: "layers", Type: "list[int]", Default: "[1, 2]"},
+		},
+		ReturnType: "np.ndarray",
+	}})
+	require.Equal(t, `# Prediction interface for Cog ⚙️
+# https://cog.run/python
+
+from typing import Any
+
+from cog import BasePredictor, Input, Path
+
+from models.infer import run
+
+
+class Predictor(BasePredictor):
+    def setup(self) -> None:
+        """Load the model into memory to make running multiple predictions efficient"""
+
+    def predict(
+        self,
+        image: Path = Input(description="image"),
+        num_steps: int = Input(description="num steps", default=50),
+        guidance: float = Input(description="guidance", default=7.5),
+        negative_prompt: str = Input(description="negative prompt", default=None),
+    ) -> Any:
+        """Run a single prediction on the model"""
+        return run(image=image, num_steps=num_steps, guidance=guidance, negative_prompt=negative_prompt)
+`, string(predictor))
+}
@@ -0,0 +1,130 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/licenses"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	licensesOutput    string
+	licensesForbidden []string
+)
+
+func newLicensesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "licenses [image]",
+		Short: "List the licenses of the packages in the model's image",
+		Long: `List the licenses of the Python and system packages installed in the model's
+image, and check none of them need a license that cog.yaml forbids.
+
+If 'image' is passed, the packages in that image are listed. Otherwise, it
+lists the packages in the image built from the current directory by 'cog build'.
+
+Forbidden licenses are set in cog.yaml:
+
+  licenses:
+    forbidden: ["AGPL-*", "GPL-3.0-*"]
+    exceptions: [some-package]
+
+A package is forbidden if it can't be used without one of them. It exits with
+an error if any package is forbidden. Packages that don't say what their
+license is are listed as UNKNOWN.`,
+		Example: `cog licenses -o licenses.json`,
+		RunE:    cmdLicenses,
+		Args:    cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().StringVarP(&licensesOutput, "output", "o", "", "Path to write a JSON report of the packages and their licenses to")
+	cmd.Flags().StringSliceVar(&licensesForbidden, "forbid", nil, "Licenses to forbid, as well as the ones in cog.yaml, like 'AGPL-*'")
+
+	return cmd
+}
+
+func cmdLicenses(cmd *cobra.Command, args []string) error {
+	var cfg *config.Config
+	var imageName string
+	if len(args) == 0 {
+		var projectDir string
+		var err error
+		cfg, projectDir, err = config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+	} else {
+		imageName = args[0]
+		var err error
+		cfg, err = image.GetConfig(cmd.Context(), imageName)
+		if err != nil {
+			return fmt.Errorf("Failed to read the Cog config from %s. Pull or build the image first: %w", imageName, err)
+		}
+	}
+
+	policy := &config.Licenses{}
+	if cfg.Licenses != nil {
+		*policy = *cfg.Licenses
+	}
+	policy.Forbidden = append(append([]string{}, policy.Forbidden...), licensesForbidden...)
+
+	console.Infof("Listing the packages in %s...", imageName)
+	packages, err := licenses.Scan(cmd.Context(), imageName)
+	if err != nil {
+		if len(args) == 0 {
+			return fmt.Errorf("%w\n\nBuild the image with 'cog build' first", err)
+		}
+		return err
+	}
+	report := licenses.Check(imageName, packages, policy)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tVERSION\tTYPE\tLICENSE\t")
+	for _, pkg := range report.Packages {
+		note := ""
+		switch {
+		case pkg.Forbidden:
+			note = "❌ forbidden"
+		case pkg.Exception:
+			note = "allowed by exception"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pkg.Name, pkg.Version, pkg.Type, pkg.License, note)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if licensesOutput != "" {
+		reportJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("Failed to convert report to JSON: %w", err)
+		}
+		if err := os.WriteFile(licensesOutput, append(reportJSON, '\n'), 0o644); err != nil { //#nosec G306
+			return fmt.Errorf("Failed to write %s: %w", licensesOutput, err)
+		}
+		console.Infof("Wrote %s", licensesOutput)
+	}
+
+	if unknown := report.UnknownPackages(); len(unknown) > 0 {
+		console.Warnf("%d of %d packages don't say what their license is. Check them by hand before shipping the model.", len(unknown), len(report.Packages))
+	}
+	if forbidden := report.ForbiddenPackages(); len(forbidden) > 0 {
+		lines := []string{}
+		for _, pkg := range forbidden {
+			lines = append(lines, fmt.Sprintf("%s %s (%s): %s", pkg.Name, pkg.Version, pkg.Type, pkg.License))
+		}
+		return fmt.Errorf("%d packages need a forbidden license:\n  %s\n\nRemove them, or add them to licenses.exceptions in cog.yaml once they've been signed off", len(forbidden), strings.Join(lines, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/lint"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var lintFix bool
+
+// lintFixes fix the problems that lint finds with the rules they're keyed by, where it's safe to do without asking
+var lintFixes = map[string]func(projectDir string) error{
+	lint.RuleDockerignore: func(projectDir string) error {
+		if err := os.WriteFile(filepath.Join(projectDir, ".dockerignore"), dockerignoreContent, 0o644); err != nil {
+			return fmt.Errorf("Failed to write .dockerignore: %w", err)
+		}
+		return nil
+	},
+	lint.RuleDeprecatedLayout: func(projectDir string) error {
+		return editConfigFile(projectDir, func(contents []byte) ([]byte, error) {
+			migrated, _, err := config.Migrate(contents)
+			return migrated, err
+		})
+	},
+	lint.RulePreInstall: func(projectDir string) error {
+		return editConfigFile(projectDir, config.MovePreInstallToRun)
+	},
+}
+
+func newLintCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the project for common mistakes",
+		Long: `Check the project for common mistakes.
+
+This checks for Python packages that aren't pinned to versions, a missing .dockerignore,
+large files that are sent to Docker each time the model is built, deprecated keys in
+cog.yaml, and settings that put secrets in the image or are insecure.
+
+Problems are errors or warnings. It exits with an error if it finds any errors. With --fix,
+it fixes the problems it can fix safely, like adding a .dockerignore or upgrading the layout
+of cog.yaml.`,
+		Args: cobra.NoArgs,
+		RunE: cmdLint,
+	}
+	cmd.Flags().BoolVar(&lintFix, "fix", false, "Fix the problems that can be fixed safely")
+	return cmd
+}
+
+func cmdLint(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	problems, err := lint.Lint(cfg, projectDir)
+	if err != nil {
+		return err
+	}
+
+	fixed := map[string]bool{}
+	errorCount := 0
+	for _, problem := range problems {
+		fix, fixable := lintFixes[problem.Rule]
+		if fixable && lintFix {
+			if !fixed[problem.Rule] {
+				if err := fix(projectDir); err != nil {
+					return fmt.Errorf("Failed to fix %s: %w", problem.Rule, err)
+				}
+				fixed[problem.Rule] = true
+			}
+			console.Infof("Fixed %s", problem)
+			continue
+		}
+		if fixable {
+			console.Infof("%s [fixable with --fix]", problem)
+		} else {
+			console.Info(problem.String())
+		}
+		if problem.Severity == lint.SeverityError {
+			errorCount++
+		}
+	}
+
+	if len(problems) == 0 {
+		console.Info("No problems found")
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("Found %d errors", errorCount)
+	}
+	return nil
+}
+
+// editConfigFile replaces the contents of cog.yaml in projectDir with what edit returns
+func editConfigFile(projectDir string, edit func(contents []byte) ([]byte, error)) error {
+	configPath := filepath.Join(projectDir, global.ConfigFilename)
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", global.ConfigFilename, err)
+	}
+	edited, err := edit(contents)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configPath, edited, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", global.ConfigFilename, err)
+	}
+	return nil
+}
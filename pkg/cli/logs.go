@@ -0,0 +1,33 @@
+package cli
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+var logsFollow bool
+
+func newLogsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Show the logs of a model container started by Cog",
+		Long: `Show the logs of a model container started by Cog.
+
+'name' is a name or ID shown by 'cog ps'.`,
+		RunE: cmdLogs,
+		Args: cobra.ExactArgs(1),
+	}
+	cmd.Flags().BoolVarP(&logsFollow, "follow", "f", false, "Follow log output")
+	return cmd
+}
+
+func cmdLogs(cmd *cobra.Command, args []string) error {
+	container, err := docker.FindContainer(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+	return docker.ContainerLogs(cmd.Context(), container.ID, logsFollow, os.Stdout)
+}
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/modelcard"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newLsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ls <registry>[/<namespace>]",
+		Short: "List the models in a Docker registry",
+		Long: `List the models in a Docker registry, or in a namespace of it.
+
+This lists images built by Cog, with their tags, sizes, when they were built, and a
+summary of their inputs and output. Images that weren't built by Cog are skipped.
+
+The registry must support listing its repositories. If it doesn't, pass a model
+instead, like 'cog ls r8.im/your-username/your-model', to list its versions.`,
+		Example: `cog ls localhost:5000
+cog ls ghcr.io/your-username`,
+		RunE: cmdLs,
+		Args: cobra.ExactArgs(1),
+	}
+	return cmd
+}
+
+func cmdLs(cmd *cobra.Command, args []string) error {
+	models, err := registry.ListModels(cmd.Context(), args[0])
+	if err != nil {
+		return err
+	}
+	if len(models) == 0 {
+		console.Infof("No models found in %s", args[0])
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tTAG\tDIGEST\tSIZE\tCREATED\tSCHEMA")
+	for _, m := range models {
+		created := ""
+		if !m.Created.IsZero() {
+			created = console.FormatTime(m.Created)
+		}
+		digest := strings.TrimPrefix(m.Digest, "sha256:")
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", m.Repository, m.Tag, digest[:min(len(digest), 12)], units.HumanSize(float64(m.Size)), created, modelcard.SchemaSummary(m.Schema))
+	}
+	return w.Flush()
+}
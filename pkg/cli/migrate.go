@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newMigrateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Upgrade cog.yaml to the current layout",
+		Long: `Upgrade cog.yaml to the current layout, keeping its comments.
+
+cog.yaml with an old layout still works, because Cog upgrades it when it loads it, but it
+warns each time. This rewrites cog.yaml with the current layout, and sets config_version
+to the version of the layout, so it stays working with later versions of Cog.`,
+		Args: cobra.NoArgs,
+		RunE: cmdMigrate,
+	}
+	return cmd
+}
+
+func cmdMigrate(cmd *cobra.Command, args []string) error {
+	projectDir, err := config.GetProjectDir(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	configPath := filepath.Join(projectDir, global.ConfigFilename)
+	contents, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", global.ConfigFilename, err)
+	}
+
+	migrated, changes, err := config.Migrate(contents)
+	if err != nil {
+		return err
+	}
+	if string(migrated) == string(contents) {
+		console.Infof("%s is already up to date", global.ConfigFilename)
+		return nil
+	}
+	if err := os.WriteFile(configPath, migrated, 0o644); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", global.ConfigFilename, err)
+	}
+
+	changes = append(changes, fmt.Sprintf("set config_version to %d", config.CurrentConfigVersion))
+	console.Infof("Updated %s: %s", global.ConfigFilename, strings.Join(changes, ", "))
+	return nil
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/examples"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/modelcard"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	modelcardOutput string
+	modelcardPush   bool
+)
+
+func newModelcardCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "modelcard [image]",
+		Short: "Generate a model card describing the model",
+		Long: `Generate a model card, a Markdown document describing the model's inputs
+and outputs, how to run it, its environment, the hardware it needs and its
+license.
+
+If 'image' is passed, the model card describes that image. Otherwise, it
+describes the image built from the current directory by 'cog build'.
+
+'cog build' also saves the model card in the image, at .cog/model_card.md.`,
+		RunE: cmdModelcard,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().StringVarP(&modelcardOutput, "output", "o", "", "Path to write the model card to. Defaults to standard output")
+	cmd.Flags().BoolVar(&modelcardPush, "push", false, "Push the model card to the image's registry, as an OCI artifact that refers to the image")
+
+	return cmd
+}
+
+func cmdModelcard(cmd *cobra.Command, args []string) error {
+	card := modelcard.Card{}
+	var imageName string
+	if len(args) == 0 {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+		card.Config = cfg
+		card.PythonPackages = cfg.PythonPackages()
+		card.License = modelcard.DetectLicense(projectDir)
+		if card.Examples, err = examples.Load(projectDir); err != nil {
+			return err
+		}
+	} else {
+		imageName = args[0]
+		cfg, err := image.GetConfig(cmd.Context(), imageName)
+		if err != nil {
+			return fmt.Errorf("Failed to read the Cog config from %s. Pull or build the image first: %w", imageName, err)
+		}
+		card.Config = cfg
+		if inspect, err := docker.ImageInspect(cmd.Context(), imageName); err == nil {
+			card.License = inspect.Config.Labels["org.opencontainers.image.licenses"]
+			if examplesJSON := inspect.Config.Labels[global.LabelNamespace+"examples"]; examplesJSON != "" {
+				if err := json.Unmarshal([]byte(examplesJSON), &card.Examples); err != nil {
+					console.Warnf("Failed to read the examples in %s: %s", imageName, err)
+				}
+			}
+		}
+	}
+	card.Name = imageName
+
+	schema, err := image.GetOpenAPISchema(cmd.Context(), imageName)
+	if err != nil {
+		if len(args) == 0 {
+			return fmt.Errorf("Failed to read the model's schema from %s. Build it with 'cog build' first: %w", imageName, err)
+		}
+		return err
+	}
+	card.Schema = schema
+
+	rendered := card.Render()
+	if modelcardOutput == "" && !modelcardPush {
+		fmt.Print(rendered)
+	}
+	if modelcardOutput != "" {
+		if err := os.WriteFile(modelcardOutput, []byte(rendered), 0o644); err != nil { //#nosec G306
+			return fmt.Errorf("Failed to write %s: %w", modelcardOutput, err)
+		}
+		console.Infof("Wrote %s", modelcardOutput)
+	}
+	if modelcardPush {
+		if card.Config.Image == "" && len(args) == 0 {
+			return fmt.Errorf("To push a model card, set 'image' in cog.yaml or pass the image to push it for")
+		}
+		ref, err := modelcard.Push(cmd.Context(), imageName, rendered)
+		if err != nil {
+			return err
+		}
+		console.Infof("Pushed model card to %s (artifact type %s)", ref, modelcard.ArtifactType)
+	}
+	return nil
+}
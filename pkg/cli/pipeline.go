@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/pipeline"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// predictPipeline runs a prediction with the inputs passed with -i on a pipeline of images. Each step's image is
+// started in a container of its own, and they're all stopped once the prediction is done.
+func predictPipeline(cmd *cobra.Command, cfg *config.Config, projectDir string) error {
+	ctx := cmd.Context()
+
+	outputPath, err := checkOutputPath(outPath)
+	if err != nil {
+		return err
+	}
+	inputs, err := parseInputFlags(inputFlags)
+	if err != nil {
+		return err
+	}
+	input, err := inputs.ToMap()
+	if err != nil {
+		return err
+	}
+
+	predictors := map[string]pipeline.Predictor{}
+	var last *predict.Predictor
+	for _, step := range cfg.Pipeline {
+		predictor, err := startPipelineStep(cmd, step, projectDir)
+		if err != nil {
+			return err
+		}
+		defer stopPredictor(ctx, predictor)
+		predictors[step.Name] = predictor
+		last = predictor
+	}
+
+	schema, err := last.GetSchema()
+	if err != nil {
+		return err
+	}
+	outputSchema := predictionOutputSchema(schema, last.Endpoint())
+
+	prediction, err := pipeline.Run(ctx, cfg.Pipeline, predictors, input, func(step config.PipelineStep) {
+		console.Infof("Running %s...", step.Name)
+	})
+	if err != nil {
+		return err
+	}
+	return writePredictionOutput(prediction, outputSchema, outputPath)
+}
+
+// startPipelineStep starts a container for a step of a pipeline of images and waits for its setup to complete
+func startPipelineStep(cmd *cobra.Command, step config.PipelineStep, projectDir string) (*predict.Predictor, error) {
+	if err := pullIfMissing(cmd.Context(), step.Image); err != nil {
+		return nil, err
+	}
+	cfg, err := image.GetConfig(cmd.Context(), step.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	console.Infof("Starting Docker image %s for %s and running setup()...", step.Image, step.Name)
+	runOptions := docker.RunOptions{
+		GPUs:   gpusForConfig(cfg),
+		Image:  step.Image,
+		Env:    slices.Clone(envFlags),
+		Labels: containerLabels("predict", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return nil, err
+	}
+	token, err := addAPIKey(&runOptions, cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	return startPredictor(cmd.Context(), runOptions, token, setupTimeoutFor(cmd, cfg))
+}
@@ -2,35 +2,44 @@ package cli
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/vincent-petithory/dataurl"
-	"golang.org/x/sys/unix"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/examples"
 	"github.com/replicate/cog/pkg/image"
 	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/servers"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
 	"github.com/replicate/cog/pkg/util/mime"
 )
 
 var (
-	envFlags     []string
-	inputFlags   []string
-	outPath      string
-	setupTimeout uint32
+	envFlags         []string
+	inputFlags       []string
+	outPath          string
+	setupTimeout     uint32
+	predictUseServer bool
+	predictToken     string
+	predictKeepAlive time.Duration
+	predictExample   string
+	predictMethod    string
+	predictForce     bool
 )
 
 func newPredictCommand() *cobra.Command {
@@ -54,12 +63,19 @@ the prediction on that.`,
 	addBuildProgressOutputFlag(cmd)
 	addDockerfileFlag(cmd)
 	addGpusFlag(cmd)
+	addVolumeFlag(cmd)
 	addSetupTimeoutFlag(cmd)
 	addFastFlag(cmd)
 
 	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
 	cmd.Flags().StringVarP(&outPath, "output", "o", "", "Output path")
 	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().BoolVar(&predictUseServer, "use-server", true, "Run the prediction on the server started by 'cog serve' for this project, if there is one and its code hasn't changed since it started")
+	cmd.Flags().StringVar(&predictToken, "token", "", "Token to authenticate with, for models with 'serve.auth' set in cog.yaml")
+	cmd.Flags().DurationVar(&predictKeepAlive, "keep-alive", 0, "Leave the model running for this long after the last prediction, and use it for later predictions on this project (e.g. 10m)")
+	cmd.Flags().StringVar(&predictMethod, "method", "predict", "Predict method to run, from 'predict_methods' in cog.yaml")
+	cmd.Flags().StringVar(&predictExample, "save-example", "", "Save the inputs and output as an example with this name, to replay with 'cog examples run'")
+	cmd.Flags().BoolVar(&predictForce, "force", false, "Run the prediction even if the image was built with a version of Cog that isn't compatible with this one")
 
 	return cmd
 }
@@ -67,17 +83,52 @@ the prediction on that.`,
 func cmdPredict(cmd *cobra.Command, args []string) error {
 	imageName := ""
 	volumes := []docker.Volume{}
-	gpus := gpusFlag
+	projectDir := ""
+	var cfg *config.Config
+	var err error
+
+	if predictKeepAlive != 0 && predictKeepAlive < time.Second {
+		return fmt.Errorf("--keep-alive must be at least 1s")
+	}
+	if predictKeepAlive > 0 && len(args) > 0 {
+		return fmt.Errorf("--keep-alive can only be used when predicting from a project directory, not an image")
+	}
+	if predictExample != "" && len(args) > 0 {
+		return fmt.Errorf("--save-example can only be used when predicting from a project directory, not an image")
+	}
+
+	if predictExample != "" && predictMethod != "predict" {
+		return fmt.Errorf("--save-example can only be used with predict(), not other predict methods")
+	}
 
 	if len(args) == 0 {
 		// Build image
 
-		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		cfg, projectDir, err = config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+
+		if cfg.PipelineOfImages() {
+			if predictKeepAlive > 0 || predictExample != "" || predictMethod != "predict" {
+				return fmt.Errorf("--keep-alive, --save-example and --method can't be used with a pipeline of images")
+			}
+			return predictPipeline(cmd, cfg, projectDir)
+		}
+
+		if err := checkPredictMethod(cfg); err != nil {
+			return err
+		}
+
+		predictor, err := runningServerPredictor(cmd, projectDir)
 		if err != nil {
 			return err
 		}
+		if predictor != nil {
+			return predictAndSaveExample(cmd.Context(), *predictor, projectDir)
+		}
 
-		if imageName, err = image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
 			return err
 		}
 
@@ -87,10 +138,6 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			Destination: "/src",
 		})
 
-		if gpus == "" && cfg.Build.GPU {
-			gpus = "all"
-		}
-
 	} else {
 		// Use existing image
 		imageName = args[0]
@@ -100,119 +147,323 @@ func cmdPredict(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("Invalid image name '%s'. Did you forget `-i`?", imageName)
 		}
 
-		exists, err := docker.ImageExists(imageName)
-		if err != nil {
-			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+		if err := pullIfMissing(cmd.Context(), imageName); err != nil {
+			return err
 		}
-		if !exists {
-			console.Infof("Pulling image: %s", imageName)
-			if err := docker.Pull(imageName); err != nil {
-				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
-			}
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return err
 		}
-		conf, err := image.GetConfig(imageName)
-		if err != nil {
+		if err := image.CheckRuntimeVersion(cmd.Context(), imageName, predictForce); err != nil {
 			return err
 		}
-		if gpus == "" && conf.Build.GPU {
-			gpus = "all"
+		if err := checkPredictMethod(cfg); err != nil {
+			return err
 		}
 	}
 
 	console.Info("")
 	console.Infof("Starting Docker image %s and running setup()...", imageName)
 
-	predictor := predict.NewPredictor(docker.RunOptions{
-		GPUs:    gpus,
+	runOptions := docker.RunOptions{
+		GPUs:    gpusForConfig(cfg),
 		Image:   imageName,
 		Volumes: volumes,
 		Env:     envFlags,
-	}, false, buildFast)
+		Labels:  containerLabels("predict", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	token, err := addAPIKey(&runOptions, cfg, predictToken)
+	if err != nil {
+		return err
+	}
+	if predictKeepAlive > 0 {
+		// The server shuts itself down once it has been idle for this long, and the container is removed when it exits
+		runOptions.Env = append(runOptions.Env, fmt.Sprintf("COG_IDLE_TIMEOUT=%d", int(predictKeepAlive.Seconds())))
+	}
+
+	predictor, err := startPredictor(cmd.Context(), runOptions, token, setupTimeoutFor(cmd, cfg))
+	if err != nil {
+		return err
+	}
+
+	if predictKeepAlive > 0 {
+		if err := servers.Register(servers.Server{ProjectDir: projectDir, Port: predictor.Port(), StartedAt: time.Now(), KeepAlive: true, Token: token}); err != nil {
+			console.Warnf("Failed to register the model container, so it won't be reused: %s", err)
+		} else {
+			console.Infof("Keeping the model running until it has been idle for %s. Stop it with 'cog stop'.", predictKeepAlive)
+		}
+		return predictAndSaveExample(cmd.Context(), *predictor, projectDir)
+	}
 
-	go func() {
-		captureSignal := make(chan os.Signal, 1)
-		signal.Notify(captureSignal, syscall.SIGINT)
+	defer stopPredictor(cmd.Context(), predictor)
 
-		<-captureSignal
+	return predictAndSaveExample(cmd.Context(), *predictor, projectDir)
+}
 
-		console.Info("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
+// pullIfMissing pulls an image if it isn't on this machine
+func pullIfMissing(ctx context.Context, imageName string) error {
+	exists, err := docker.ImageExists(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+	}
+	if !exists {
+		console.Infof("Pulling image: %s", imageName)
+		if err := docker.Pull(ctx, imageName); err != nil {
+			return fmt.Errorf("Failed to pull %s: %w", imageName, err)
 		}
-	}()
+	}
+	return nil
+}
+
+// startPredictor starts a container for a model and waits for its setup to complete, retrying without a GPU if
+// there isn't one. The container is stopped if ctx is canceled before then.
+func startPredictor(ctx context.Context, runOptions docker.RunOptions, token string, timeout time.Duration) (*predict.Predictor, error) {
+	predictor := predict.NewPredictor(runOptions, false, buildFast)
+	predictor.SetToken(token)
 
-	timeout := time.Duration(setupTimeout) * time.Second
-	if err := predictor.Start(os.Stderr, timeout); err != nil {
+	if err := predictor.Start(ctx, os.Stderr, timeout); err != nil {
 		// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
 		// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
-		if gpus == "all" && errors.Is(err, docker.ErrMissingDeviceDriver) {
+		if gpusFlag == "" && runOptions.GPUs != "" && errors.Is(err, docker.ErrMissingDeviceDriver) {
 			console.Info("Missing device driver, re-trying without GPU")
 
-			_ = predictor.Stop()
-			predictor = predict.NewPredictor(docker.RunOptions{
-				Image:   imageName,
-				Volumes: volumes,
-				Env:     envFlags,
-			}, false, buildFast)
+			_ = predictor.Stop(ctx)
+			runOptions.GPUs = ""
+			predictor = predict.NewPredictor(runOptions, false, buildFast)
+			predictor.SetToken(token)
 
-			if err := predictor.Start(os.Stderr, timeout); err != nil {
-				return err
+			if err := predictor.Start(ctx, os.Stderr, timeout); err != nil {
+				return nil, err
 			}
 		} else {
-			return err
+			return nil, err
 		}
 	}
+	return &predictor, nil
+}
 
-	// FIXME: will not run on signal
-	defer func() {
+// stopPredictor stops a predictor's container. It's stopped even if ctx was canceled by Ctrl-C, so it isn't left
+// running.
+func stopPredictor(ctx context.Context, predictor *predict.Predictor) {
+	if ctx.Err() != nil {
+		console.Info("Stopping container...")
+	} else {
 		console.Debugf("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
+	}
+	if err := predictor.Stop(context.WithoutCancel(ctx)); err != nil {
+		console.Warnf("Failed to stop container: %s", err)
+	}
+}
+
+// predictAndSaveExample runs a prediction with the inputs passed with -i, and saves it as an example if
+// --save-example was passed
+func predictAndSaveExample(ctx context.Context, predictor predict.Predictor, projectDir string) error {
+	predictor.SetMethod(predictMethod)
+	inputs, prediction, err := predictIndividualInputs(ctx, predictor, inputFlags, outPath)
+	if err != nil || predictExample == "" {
+		return err
+	}
+	if prediction.Status == "failed" {
+		return fmt.Errorf("Not saving the example, because the prediction failed: %s", prediction.Error)
+	}
+	if _, err := examples.Save(projectDir, predictExample, inputs, prediction.Output); err != nil {
+		return fmt.Errorf("Failed to save example: %w", err)
+	}
+	console.Infof("Saved example %s in %s", predictExample, filepath.Join(examples.Dir, predictExample))
+	return nil
+}
+
+// checkPredictMethod returns an error if the predict method passed with --method isn't one of the model's
+func checkPredictMethod(cfg *config.Config) error {
+	if cfg.HasPredictMethod(predictMethod) {
+		return nil
+	}
+	if len(cfg.PredictMethods) == 0 {
+		return fmt.Errorf("The model doesn't have a %s() predict method. Add it to 'predict_methods' in cog.yaml to call it with --method", predictMethod)
+	}
+	return fmt.Errorf("The model doesn't have a %s() predict method. It has: predict, %s", predictMethod, strings.Join(cfg.PredictMethods, ", "))
+}
+
+// serverRunFlags are the flags that change how the model is built or run, so they can't be applied to a server
+// that's already running
+var serverRunFlags = []string{"env", "gpus", "volume", "dockerfile", "use-cuda-base-image", useCogBaseImageFlagKey, "x-fast", "keep-alive"}
+
+// runningServerPredictor returns a predictor for the server started by `cog serve` or `cog predict --keep-alive`
+// for projectDir, or nil if there isn't one ready to take predictions, or the project's code has changed since it
+// started. It fails if there is one, but flags were passed that it can't be run with.
+func runningServerPredictor(cmd *cobra.Command, projectDir string) (*predict.Predictor, error) {
+	if !predictUseServer {
+		return nil, nil
+	}
+	server, err := servers.Lookup(projectDir)
+	if err != nil {
+		console.Debugf("Failed to look up running server: %s", err)
+		return nil, nil
+	}
+	if server == nil {
+		return nil, nil
+	}
+	token := predictToken
+	if token == "" {
+		token = server.Token
+	}
+	predictor := predict.NewServerPredictor(server.Port, false)
+	predictor.SetToken(token)
+	predictor.SetTLS(server.TLS)
+	if !predictor.IsReady() {
+		console.Debugf("Server at port %d is not ready, starting a new container", server.Port)
+		return nil, nil
+	}
+	startedBy := "cog serve"
+	if server.KeepAlive {
+		startedBy = "cog predict --keep-alive"
+	}
+	if flags := changedFlags(cmd, serverRunFlags); len(flags) > 0 {
+		return nil, fmt.Errorf("The server started by '%s' for this project can't be run with %s. Pass --use-server=false to start a new container, or stop the server with 'cog stop'", startedBy, strings.Join(flags, ", "))
+	}
+	changed, err := projectChangedSince(projectDir, server.StartedAt)
+	if err != nil {
+		console.Debugf("Failed to check whether the project has changed: %s", err)
+	}
+	if changed {
+		console.Infof("The project has changed since '%s' started its server, so starting a new container", startedBy)
+		return nil, nil
+	}
+	scheme := "http"
+	if server.TLS {
+		scheme = "https"
+	}
+	console.Infof("Using the server started by '%s' at %s://127.0.0.1:%d (pass --use-server=false to start a new container)", startedBy, scheme, server.Port)
+	return &predictor, nil
+}
+
+// changedFlags returns the flags in names that were passed to cmd, as they're written on the command line
+func changedFlags(cmd *cobra.Command, names []string) []string {
+	changed := []string{}
+	for _, name := range names {
+		if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+			changed = append(changed, "--"+name)
+		}
+	}
+	return changed
+}
+
+// projectChangedSince returns whether cog.yaml or any of the project's Python files have been modified since t, so a
+// server started before then is running old code. Hidden directories, like .git and .cog, are skipped.
+func projectChangedSince(projectDir string, t time.Time) (bool, error) {
+	errChanged := errors.New("changed")
+	err := filepath.WalkDir(projectDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != projectDir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != "cog.yaml" && filepath.Ext(path) != ".py" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(t) {
+			return errChanged
 		}
-	}()
+		return nil
+	})
+	if errors.Is(err, errChanged) {
+		return true, nil
+	}
+	return false, err
+}
 
-	return predictIndividualInputs(predictor, inputFlags, outPath, false)
+// addAPIKey passes an API key to the container if its server requires one, so we can make predictions on it.
+// It returns the token to authenticate with: the one passed with --token, or a random one if none was passed.
+func addAPIKey(runOptions *docker.RunOptions, cfg *config.Config, token string) (string, error) {
+	if cfg.Serve.AuthType() != config.AuthTypeAPIKey {
+		return token, nil
+	}
+	if token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("Failed to generate API key: %w", err)
+		}
+		token = hex.EncodeToString(b)
+	}
+	runOptions.Env = append(runOptions.Env, "COG_API_KEYS="+token)
+	return token, nil
 }
 
 func isURI(ref *openapi3.Schema) bool {
 	return ref != nil && ref.Type.Is("string") && ref.Format == "uri"
 }
 
-func predictIndividualInputs(predictor predict.Predictor, inputFlags []string, outputPath string, isTrain bool) error {
+// predictIndividualInputs runs a prediction with inputs passed with -i, and writes its output. It returns the
+// inputs and the prediction.
+func predictIndividualInputs(ctx context.Context, predictor predict.Predictor, inputFlags []string, outputPath string) (predict.Inputs, *predict.Response, error) {
 	console.Info("Running prediction...")
 	schema, err := predictor.GetSchema()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	inputs, err := parseInputFlags(inputFlags)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+
+	outputPath, err = checkOutputPath(outputPath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Generate output depending on type in schema
+	outputSchema := predictionOutputSchema(schema, predictor.Endpoint())
+
+	prediction, err := predictor.Predict(ctx, inputs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to predict: %w", err)
+	}
+
+	if err := writePredictionOutput(prediction, outputSchema, outputPath); err != nil {
+		return nil, nil, err
 	}
+	return inputs, prediction, nil
+}
 
+// checkOutputPath returns the output path passed with -o, and an error if it isn't writable, so that's found out
+// before running the prediction
+func checkOutputPath(outputPath string) (string, error) {
 	// If outputPath != "", then we now know the output path for sure
 	if outputPath != "" {
 		// Ignore @, to make it behave the same as -i
 		outputPath = strings.TrimPrefix(outputPath, "@")
 
 		if err := checkOutputWritable(outputPath); err != nil {
-			return fmt.Errorf("Output path is not writable: %w", err)
+			return "", fmt.Errorf("Output path is not writable: %w", err)
 		}
 	}
+	return outputPath, nil
+}
 
-	// Generate output depending on type in schema
-	url := "/predictions"
-	if isTrain {
-		url = "/trainings"
-	}
-	responseSchema := schema.Paths.Value(url).Post.Responses.Value("200").Value.Content["application/json"].Schema.Value
-	outputSchema := responseSchema.Properties["output"].Value
-
-	prediction, err := predictor.Predict(inputs)
-	if err != nil {
-		return fmt.Errorf("Failed to predict: %w", err)
-	}
+// predictionOutputSchema returns the schema of the output of predictions created at endpoint, like "predictions"
+func predictionOutputSchema(schema *openapi3.T, endpoint string) *openapi3.Schema {
+	responseSchema := schema.Paths.Value("/" + endpoint).Post.Responses.Value("200").Value.Content["application/json"].Schema.Value
+	return responseSchema.Properties["output"].Value
+}
 
+// writePredictionOutput writes a prediction's output to outputPath, or prints it if outputPath is "". Files are
+// written to output.<ext>, or output.<n>.<ext> for lists of files, if outputPath is "".
+func writePredictionOutput(prediction *predict.Response, outputSchema *openapi3.Schema, outputPath string) error {
 	if prediction.Output == nil {
 		console.Warn("No output generated")
 		return nil
@@ -307,11 +558,11 @@ func checkOutputWritable(outputPath string) error {
 	_, err = os.Stat(outputPath)
 	if err == nil {
 		// File exists, check if it's writable
-		return unix.Access(outputPath, unix.W_OK)
+		return files.CheckWritable(outputPath)
 	} else if os.IsNotExist(err) {
 		// File doesn't exist, check if the directory is writable
 		dir := filepath.Dir(outputPath)
-		return unix.Access(dir, unix.W_OK)
+		return files.CheckWritable(dir)
 	}
 
 	// Some other error occurred
@@ -387,5 +638,16 @@ func parseInputFlags(inputs []string) (predict.Inputs, error) {
 }
 
 func addSetupTimeoutFlag(cmd *cobra.Command) {
-	cmd.Flags().Uint32Var(&setupTimeout, "setup-timeout", 5*60, "The timeout for a container to setup (in seconds).")
+	cmd.Flags().Uint32Var(&setupTimeout, "setup-timeout", 5*60, "The timeout for a container to setup (in seconds). Defaults to serve.setup_timeout in cog.yaml, or 5 minutes.")
+}
+
+// setupTimeoutFor returns how long to wait for setup() to complete: the --setup-timeout flag if it was set,
+// otherwise serve.setup_timeout from cog.yaml, otherwise the flag's default
+func setupTimeoutFor(cmd *cobra.Command, cfg *config.Config) time.Duration {
+	if !cmd.Flags().Changed("setup-timeout") {
+		if timeout := cfg.Serve.SetupTimeoutDuration(); timeout > 0 {
+			return timeout
+		}
+	}
+	return time.Duration(setupTimeout) * time.Second
 }
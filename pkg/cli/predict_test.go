@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestCheckPredictMethod(t *testing.T) {
+	defer func(method string) { predictMethod = method }(predictMethod)
+
+	cfg := &config.Config{Predict: "predict.py:Predictor", PredictMethods: []string{"generate", "embed"}}
+	for _, method := range []string{"predict", "generate", "embed"} {
+		predictMethod = method
+		require.NoError(t, checkPredictMethod(cfg))
+	}
+
+	predictMethod = "train"
+	require.EqualError(t, checkPredictMethod(cfg), "The model doesn't have a train() predict method. It has: predict, generate, embed")
+
+	predictMethod = "generate"
+	err := checkPredictMethod(&config.Config{Predict: "predict.py:Predictor"})
+	require.ErrorContains(t, err, "Add it to 'predict_methods' in cog.yaml")
+}
+
+func TestChangedFlags(t *testing.T) {
+	defer func(env []string, gpus string) { envFlags, gpusFlag = env, gpus }(envFlags, gpusFlag)
+
+	cmd := newPredictCommand()
+	require.NoError(t, cmd.ParseFlags([]string{"-i", "prompt=hello", "-e", "FOO=bar", "--gpus", "all"}))
+	require.Equal(t, []string{"--env", "--gpus"}, changedFlags(cmd, serverRunFlags))
+
+	cmd = newPredictCommand()
+	require.NoError(t, cmd.ParseFlags([]string{"-i", "prompt=hello"}))
+	require.Empty(t, changedFlags(cmd, serverRunFlags))
+}
+
+func TestProjectChangedSince(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("predict: predict.py:Predictor"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte(""), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "weights.bin"), []byte(""), 0o644))
+
+	startedAt := time.Now().Add(time.Minute)
+	changed, err := projectChangedSince(dir, startedAt)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// Files that aren't code, and hidden directories, don't count
+	later := startedAt.Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "weights.bin"), later, later))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".git", "index.py"), []byte(""), 0o644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, ".git", "index.py"), later, later))
+	changed, err = projectChangedSince(dir, startedAt)
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "predict.py"), later, later))
+	changed, err = projectChangedSince(dir, startedAt)
+	require.NoError(t, err)
+	require.True(t, changed)
+}
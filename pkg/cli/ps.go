@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+func newPsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ps",
+		Short: "List running model containers started by Cog",
+		Long: `List running model containers started by Cog.
+
+This lists containers started with 'cog serve', 'cog predict', 'cog run' and 'cog train'.
+Use the name in the NAME column with 'cog logs' and 'cog stop'.`,
+		RunE: cmdPs,
+		Args: cobra.NoArgs,
+	}
+	return cmd
+}
+
+func cmdPs(cmd *cobra.Command, args []string) error {
+	containers, err := docker.ListContainers(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("Failed to list containers: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCOMMAND\tIMAGE\tSTATUS\tPORTS\tPROJECT")
+	for _, c := range containers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Name, c.Command, c.Image, c.Status, c.Ports, c.Project)
+	}
+	return w.Flush()
+}
@@ -4,15 +4,24 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 
+	"github.com/replicate/cog/pkg/cog"
 	"github.com/replicate/cog/pkg/config"
-	"github.com/replicate/cog/pkg/docker"
-	"github.com/replicate/cog/pkg/global"
 	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
+var (
+	pushChunked    bool
+	pushResume     bool
+	pushJobs       int
+	pushBWLimit    string
+	pushProvenance bool
+)
+
 func newPushCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use: "push [IMAGE]",
@@ -23,6 +32,7 @@ func newPushCommand() *cobra.Command {
 		Args:    cobra.MaximumNArgs(1),
 	}
 	addSecretsFlag(cmd)
+	addBuildArgFlag(cmd)
 	addNoCacheFlag(cmd)
 	addSeparateWeightsFlag(cmd)
 	addSchemaFlag(cmd)
@@ -33,12 +43,19 @@ func newPushCommand() *cobra.Command {
 	addStripFlag(cmd)
 	addPrecompileFlag(cmd)
 	addFastFlag(cmd)
+	addPinBaseImageFlag(cmd)
+	addDryRunFlag(cmd)
+	cmd.Flags().BoolVar(&pushChunked, "chunked", false, "Upload layers in chunks that are retried if they fail, rather than with 'docker push'")
+	cmd.Flags().BoolVar(&pushResume, "resume", false, "Carry on uploading layers from where an interrupted chunked push got to, rather than starting them again. Implies --chunked")
+	cmd.Flags().IntVar(&pushJobs, "jobs", 0, fmt.Sprintf("How many layers to upload at once (default %d). Implies --chunked", registry.DefaultJobs))
+	cmd.Flags().StringVar(&pushBWLimit, "bwlimit", "", "Limit the upload bandwidth across all layers, like '10MB' for 10 MB per second. Implies --chunked")
+	cmd.Flags().BoolVar(&pushProvenance, "provenance", true, "Attach the image's build provenance to it in the registry, as an OCI artifact that refers to the image")
 
 	return cmd
 }
 
 func push(cmd *cobra.Command, args []string) error {
-	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(projectDirFlag, buildArgs)
 	if err != nil {
 		return err
 	}
@@ -52,14 +69,37 @@ func push(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("To push images, you must either set the 'image' option in cog.yaml or pass an image name as an argument. For example, 'cog push r8.im/your-username/hotdog-detector'")
 	}
 
-	replicatePrefix := fmt.Sprintf("%s/", global.ReplicateRegistryHost)
-	if strings.HasPrefix(imageName, replicatePrefix) {
-		if err := docker.ManifestInspect(imageName); err != nil && strings.Contains(err.Error(), `"code":"NAME_UNKNOWN"`) {
-			return fmt.Errorf("Unable to find Replicate existing model for %s. Go to replicate.com and create a new model before pushing.", imageName)
+	bandwidthLimit, err := parseBandwidthLimit(pushBWLimit)
+	if err != nil {
+		return err
+	}
+	if pushJobs < 0 {
+		return fmt.Errorf("--jobs must be at least 1")
+	}
+	pushOptions := cog.PushOptions{Chunked: pushChunked, Resume: pushResume, Jobs: pushJobs, BandwidthLimit: bandwidthLimit}
+
+	if dryRun {
+		operations, err := printBuildPlan(cmd, cfg, projectDir, imageName)
+		if err != nil {
+			return err
+		}
+		if pushOptions.IsChunked() {
+			printOperations(operations)
+			console.Output(fmt.Sprintf("The image's layers would then be read from Docker and uploaded to %s in chunks.", imageName))
+		} else {
+			printOperations(append(operations, []string{"push", imageName}))
+		}
+		if pushProvenance {
+			console.Output("Its build provenance would then be attached to it, as an OCI artifact that refers to it.")
 		}
+		return nil
 	}
 
-	if err := image.Build(cfg, projectDir, imageName, buildSecrets, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, buildSchemaFile, buildDockerfileFile, DetermineUseCogBaseImage(cmd), buildStrip, buildPrecompile, buildFast); err != nil {
+	if err := cog.CheckPushable(cmd.Context(), imageName); err != nil {
+		return err
+	}
+
+	if err := image.Build(cmd.Context(), cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, buildSchemaFile, buildDockerfileFile, DetermineUseCogBaseImage(cmd), buildStrip, buildPrecompile, buildFast, buildPinBaseImage); err != nil {
 
 		return err
 	}
@@ -69,27 +109,34 @@ func push(cmd *cobra.Command, args []string) error {
 		console.Info("Fast push enabled.")
 	}
 
-	err = docker.Push(imageName)
-	if err != nil {
-		if strings.Contains(err.Error(), "NAME_UNKNOWN") {
-			return fmt.Errorf("Unable to find existing Replicate model for %s. "+
-				"Go to replicate.com and create a new model before pushing."+
-				"\n\n"+
-				"If the model already exists, you may be getting this error "+
-				"because you're not logged in as owner of the model. "+
-				"This can happen if you did `sudo cog login` instead of `cog login` "+
-				"or `sudo cog push` instead of `cog push`, "+
-				"which causes Docker to use the wrong Docker credentials.",
-				imageName)
-		}
-		return fmt.Errorf("Failed to push image: %w", err)
+	if err := cog.Push(cmd.Context(), imageName, pushOptions); err != nil {
+		return err
 	}
 
 	console.Infof("Image '%s' pushed", imageName)
-	if strings.HasPrefix(imageName, replicatePrefix) {
-		replicatePage := fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
-		console.Infof("\nRun your model on Replicate:\n    %s", replicatePage)
+	if pushProvenance {
+		// The image is already pushed, so it's still usable without its provenance
+		if ref, err := cog.PushProvenance(cmd.Context(), imageName); err != nil {
+			console.Warnf("Failed to attach provenance to %s: %s", imageName, err)
+		} else if ref != "" {
+			console.Infof("Attached provenance to the image as %s", ref)
+		}
+	}
+	if url := cog.ReplicateModelURL(imageName); url != "" {
+		console.Infof("\nRun your model on Replicate:\n    %s", url)
 	}
 
 	return nil
 }
+
+// parseBandwidthLimit parses a --bwlimit like "10MB" or "500kB/s" into bytes per second, or 0 if it's not set
+func parseBandwidthLimit(limit string) (int64, error) {
+	if limit == "" {
+		return 0, nil
+	}
+	bytesPerSecond, err := units.FromHumanSize(strings.TrimSuffix(limit, "/s"))
+	if err != nil || bytesPerSecond <= 0 {
+		return 0, fmt.Errorf("Invalid --bwlimit %q. It should be a size per second, like '10MB'", limit)
+	}
+	return bytesPerSecond, nil
+}
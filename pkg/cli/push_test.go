@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBandwidthLimit(t *testing.T) {
+	for _, tt := range []struct {
+		limit    string
+		expected int64
+		err      bool
+	}{
+		{limit: "", expected: 0},
+		{limit: "10MB", expected: 10_000_000},
+		{limit: "500kB/s", expected: 500_000},
+		{limit: "1G", expected: 1_000_000_000},
+		{limit: "fast", err: true},
+		{limit: "0", err: true},
+	} {
+		t.Run(tt.limit, func(t *testing.T) {
+			bytesPerSecond, err := parseBandwidthLimit(tt.limit)
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, bytesPerSecond)
+		})
+	}
+}
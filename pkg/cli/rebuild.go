@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var rebuildUpdateBase bool
+
+func newRebuildCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebuild",
+		Short: "Rebuild an image from cog.yaml, optionally on the newest version of its base image",
+		Long: `Rebuild an image from cog.yaml, on the base image pinned in ` + image.BuildManifestPath + `.
+
+With --update-base, this checks whether the base image's tag points to a newer version of it,
+like one with security fixes. If it does, the base image is pinned to the newer version, the
+old and new digests are recorded in the build manifest, and the image is rebuilt on it. If the
+base image is already up to date, nothing is rebuilt.`,
+		Example: `cog rebuild --update-base -t r8.im/your-username/hotdog-detector`,
+		Args:    cobra.NoArgs,
+		RunE:    rebuildCommand,
+		PreRunE: checkMutuallyExclusiveFlags,
+	}
+	addBuildProgressOutputFlag(cmd)
+	addSecretsFlag(cmd)
+	addBuildArgFlag(cmd)
+	addNoCacheFlag(cmd)
+	addSeparateWeightsFlag(cmd)
+	addUseCudaBaseImageFlag(cmd)
+	addDockerfileFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	cmd.Flags().StringVarP(&buildTag, "tag", "t", "", "A name for the built image in the form 'repository:tag'")
+	cmd.Flags().BoolVar(&rebuildUpdateBase, "update-base", false, "Pin the base image to the newest version of its tag, and rebuild if it changed")
+	return cmd
+}
+
+func rebuildCommand(cmd *cobra.Command, args []string) error {
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(projectDirFlag, buildArgs)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.Image
+	if buildTag != "" {
+		imageName = buildTag
+	}
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+
+	if rebuildUpdateBase {
+		update, baseImage, err := image.UpdateBaseImage(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd))
+		if err != nil {
+			return err
+		}
+		if update == nil {
+			console.Infof("Base image %s is up to date", baseImage)
+			return nil
+		}
+		if update.OldDigest == "" {
+			console.Infof("Pinned base image %s to %s", update.Image, update.NewDigest)
+		} else {
+			console.Infof("Updated base image %s from %s to %s", update.Image, update.OldDigest, update.NewDigest)
+		}
+	}
+
+	if err := image.Build(cmd.Context(), cfg, projectDir, imageName, buildSecrets, buildArgs, buildNoCache, buildSeparateWeights, buildUseCudaBaseImage, buildProgressOutput, "", buildDockerfileFile, DetermineUseCogBaseImage(cmd), false, false, false, true); err != nil {
+		return err
+	}
+
+	console.Infof("\nImage rebuilt as %s", imageName)
+	return nil
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/servers"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	reloadWeights string
+	reloadToken   string
+)
+
+func newReloadCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Reload the model on the server started by 'cog serve', without dropping predictions",
+		Long: `Reload the model on the server started by 'cog serve' or 'cog predict
+--keep-alive' for this project, with new weights if --weights is passed.
+
+The new model is set up in the background while the old one carries on running
+predictions. Once it's set up, new predictions run on it, and the old model
+stops when it has finished the predictions it was running. If setup fails, the
+old model keeps serving.
+
+--weights is a URL, or a file in the project, which setup() gets as its
+'weights' argument. Without it, the model is reloaded with the weights it has,
+which picks up changes to the files in the project.`,
+		Example: `cog reload --weights checkpoints/step-2000.safetensors
+cog reload --weights https://example.com/lora.tar`,
+		RunE: cmdReload,
+		Args: cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&reloadWeights, "weights", "", "URL or path in the project of the weights to load")
+	cmd.Flags().StringVar(&reloadToken, "token", "", "Token to authenticate with, for models with 'serve.auth' set in cog.yaml")
+	return cmd
+}
+
+func cmdReload(cmd *cobra.Command, args []string) error {
+	_, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+	server, err := servers.Lookup(projectDir)
+	if err != nil {
+		return err
+	}
+	if server == nil {
+		return fmt.Errorf("There isn't a server running for this project. Start one with 'cog serve'.")
+	}
+	weights, err := containerWeightsPath(projectDir, reloadWeights)
+	if err != nil {
+		return err
+	}
+
+	token := reloadToken
+	if token == "" {
+		token = server.Token
+	}
+	predictor := predict.NewServerPredictor(server.Port, false)
+	predictor.SetToken(token)
+	predictor.SetTLS(server.TLS)
+
+	console.Info("Reloading the model...")
+	setup, err := predictor.Reload(cmd.Context(), weights)
+	if err != nil {
+		if setup != nil && setup.Logs != "" {
+			console.Info(setup.Logs)
+		}
+		return err
+	}
+	console.Infof("Reloaded the model on port %d", server.Port)
+	return nil
+}
+
+// containerWeightsPath returns where weights passed with --weights are in the container: a URL as it is, or the path
+// of a file in the project under /src, where the project is mounted
+func containerWeightsPath(projectDir string, weights string) (string, error) {
+	if weights == "" || strings.Contains(weights, "://") || strings.HasPrefix(weights, "data:") {
+		return weights, nil
+	}
+	path, err := filepath.Abs(weights)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("Failed to find weights %s: %w", weights, err)
+	}
+	rel, err := filepath.Rel(projectDir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s isn't in the project, so the server can't read it. Move it into %s, or pass a URL.", weights, projectDir)
+	}
+	return "/src/" + filepath.ToSlash(rel), nil
+}
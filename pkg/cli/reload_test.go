@@ -0,0 +1,35 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContainerWeightsPath(t *testing.T) {
+	projectDir := t.TempDir()
+	checkpoint := filepath.Join(projectDir, "checkpoints", "step-2000.safetensors")
+	require.NoError(t, os.MkdirAll(filepath.Dir(checkpoint), 0o755))
+	require.NoError(t, os.WriteFile(checkpoint, []byte("weights"), 0o644))
+
+	for weights, expected := range map[string]string{
+		"":                             "",
+		"https://example.com/lora.tar": "https://example.com/lora.tar",
+		checkpoint:                     "/src/checkpoints/step-2000.safetensors",
+		projectDir + "/checkpoints/../checkpoints/step-2000.safetensors": "/src/checkpoints/step-2000.safetensors",
+	} {
+		path, err := containerWeightsPath(projectDir, weights)
+		require.NoError(t, err)
+		require.Equal(t, expected, path)
+	}
+
+	_, err := containerWeightsPath(projectDir, filepath.Join(projectDir, "missing.safetensors"))
+	require.ErrorContains(t, err, "Failed to find weights")
+
+	outside := filepath.Join(t.TempDir(), "weights.bin")
+	require.NoError(t, os.WriteFile(outside, []byte("weights"), 0o644))
+	_, err = containerWeightsPath(projectDir, outside)
+	require.ErrorContains(t, err, "isn't in the project")
+}
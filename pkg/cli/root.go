@@ -19,7 +19,17 @@ func NewRootCommand() (*cobra.Command, error) {
 		Long: `Containers for machine learning.
 
 To get started, take a look at the documentation:
-https://github.com/replicate/cog`,
+https://github.com/replicate/cog
+
+Cog exits with these codes when a command fails, so scripts can tell the
+errors apart:
+
+  1    Other errors
+  3    cog.yaml is missing or invalid
+  4    The model failed to build
+  5    The registry refused to let an image be pushed or pulled
+  6    Docker couldn't give the model a GPU
+  130  The command was interrupted with Ctrl-C`,
 		Example: `   To run a command inside a Docker environment defined with Cog:
       $ cog run echo hello world`,
 		Version: fmt.Sprintf("%s (built %s)", global.Version, global.BuildTime),
@@ -38,15 +48,47 @@ https://github.com/replicate/cog`,
 	setPersistentFlags(&rootCmd)
 
 	rootCmd.AddCommand(
+		newBenchmarkCommand(),
 		newBuildCommand(),
+		newBundleDebugCommand(),
+		newClientCommand(),
+		newCompareMetricsCommand(),
 		newDebugCommand(),
+		newDemoCommand(),
+		newDeployCommand(),
+		newDetectCommand(),
+		newDlqCommand(),
+		newEjectCommand(),
+		newExamplesCommand(),
+		newExportCommand(),
+		newHelmCommand(),
+		newImportCommand(),
 		newInitCommand(),
+		newLicensesCommand(),
 		newLoginCommand(),
+		newLogsCommand(),
+		newLintCommand(),
+		newLsCommand(),
+		newMigrateCommand(),
+		newModelcardCommand(),
 		newPredictCommand(),
+		newPsCommand(),
 		newPushCommand(),
+		newRebuildCommand(),
+		newReloadCommand(),
 		newRunCommand(),
+		newScheduleCommand(),
+		newSchemaCommand(),
 		newServeCommand(),
+		newStopCommand(),
+		newSystemdUnitCommand(),
+		newTelemetryCommand(),
+		newTestCommand(),
 		newTrainCommand(),
+		newUpdateCommand(),
+		newUpgradeImageCommand(),
+		newVerifyCommand(),
+		newWeightsCommand(),
 	)
 
 	return &rootCmd, nil
@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"context"
 	"runtime"
 	"strconv"
 	"strings"
@@ -15,14 +16,98 @@ import (
 )
 
 var (
-	runPorts []string
-	gpusFlag string
+	runPorts    []string
+	gpusFlag    string
+	volumeFlags []string
 )
 
 func addGpusFlag(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&gpusFlag, "gpus", "", "GPU devices to add to the container, in the same format as `docker run --gpus`.")
 }
 
+func addVolumeFlag(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVarP(&volumeFlags, "volume", "v", []string{}, "Mount a file or directory on the host into the container, in the form source:destination or source:destination:ro, e.g. -v /mnt/datasets:/data:ro")
+}
+
+// gpusForConfig returns the GPUs to request from Docker for a model. The --gpus flag takes precedence,
+// otherwise all GPUs are requested, or as many as resources.gpu_count asks for.
+func gpusForConfig(cfg *config.Config) string {
+	if gpusFlag != "" {
+		return gpusFlag
+	}
+	if !cfg.Build.GPU {
+		return ""
+	}
+	if cfg.Resources != nil && cfg.Resources.GPUCount > 0 {
+		return strconv.Itoa(cfg.Resources.GPUCount)
+	}
+	return "all"
+}
+
+// addContainerOptions limits the container to the resources declared in cog.yaml, gives it the devices in cog.yaml,
+// and makes its root filesystem read-only if cog.yaml says the model runs like that, so models that write outside
+// their state directory fail here rather than in production
+func addContainerOptions(runOptions *docker.RunOptions, cfg *config.Config) {
+	runOptions.CPUs = cfg.Resources.CPUString()
+	runOptions.Memory = cfg.Resources.MemoryBytes()
+	runOptions.ShmSize = cfg.Resources.ShmSizeBytes()
+	runOptions.Tmpfs = docker.TmpfsMounts(cfg.Resources)
+	runOptions.Devices = docker.Devices(cfg)
+	runOptions.ReadOnly = cfg.StateDir() != ""
+}
+
+// addVolumes mounts the model's shared weights, the volumes in cog.yaml, if the model is run from its project
+// directory, and the ones passed with --volume
+func addVolumes(ctx context.Context, runOptions *docker.RunOptions, cfg *config.Config, projectDir string) error {
+	volumes, err := image.RuntimeVolumes(ctx, cfg, runOptions.Image, projectDir, volumeFlags)
+	if err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		runOptions.Volumes = append(runOptions.Volumes, docker.Volume{Source: volume.Source, Destination: volume.Destination, ReadOnly: volume.ReadOnly})
+	}
+	return nil
+}
+
+// addRuntimeEnv passes the environment_variables and secrets in cog.yaml to the container. Secrets are read from the
+// host now, so they're never saved in the image. Variables set with --env take precedence over both.
+func addRuntimeEnv(runOptions *docker.RunOptions, cfg *config.Config) error {
+	overridden := map[string]bool{}
+	for _, env := range runOptions.Env {
+		name, _, _ := strings.Cut(env, "=")
+		overridden[name] = true
+	}
+	env := []string{}
+	for _, e := range cfg.RuntimeEnv() {
+		name, _, _ := strings.Cut(e, "=")
+		if !overridden[name] {
+			env = append(env, e)
+		}
+	}
+	runOptions.Env = append(env, runOptions.Env...)
+
+	for _, secret := range cfg.Secrets {
+		if overridden[secret.Name] {
+			continue
+		}
+		value, err := secret.Resolve()
+		if err != nil {
+			return err
+		}
+		runOptions.SecretEnv = append(runOptions.SecretEnv, secret.Name+"="+value)
+	}
+	return nil
+}
+
+// containerLabels returns the labels that let `cog ps` find a container started by command
+func containerLabels(command string, projectDir string) map[string]string {
+	labels := map[string]string{docker.ContainerCommandLabel: command}
+	if projectDir != "" {
+		labels[docker.ContainerProjectLabel] = projectDir
+	}
+	return labels
+}
+
 func newRunCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:     "run <command> [arg...]",
@@ -36,6 +121,7 @@ func newRunCommand() *cobra.Command {
 	addUseCudaBaseImageFlag(cmd)
 	addUseCogBaseImageFlag(cmd)
 	addGpusFlag(cmd)
+	addVolumeFlag(cmd)
 	addFastFlag(cmd)
 
 	flags := cmd.Flags()
@@ -55,25 +141,26 @@ func run(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-	imageName, err := image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput)
+	imageName, err := image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput)
 	if err != nil {
 		return err
 	}
 
-	gpus := ""
-	if gpusFlag != "" {
-		gpus = gpusFlag
-	} else if cfg.Build.GPU {
-		gpus = "all"
-	}
-
 	runOptions := docker.RunOptions{
 		Args:    args,
 		Env:     envFlags,
-		GPUs:    gpus,
+		GPUs:    gpusForConfig(cfg),
 		Image:   imageName,
 		Volumes: []docker.Volume{{Source: projectDir, Destination: "/src"}},
 		Workdir: "/src",
+		Labels:  containerLabels("run", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
 	}
 
 	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
@@ -96,14 +183,14 @@ func run(cmd *cobra.Command, args []string) error {
 		console.Info("Fast run enabled.")
 	}
 
-	err = docker.Run(runOptions)
+	err = docker.Run(cmd.Context(), runOptions)
 	// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
 	// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
-	if runOptions.GPUs == "all" && err == docker.ErrMissingDeviceDriver {
+	if gpusFlag == "" && runOptions.GPUs != "" && err == docker.ErrMissingDeviceDriver {
 		console.Info("Missing device driver, re-trying without GPU")
 
 		runOptions.GPUs = ""
-		err = docker.Run(runOptions)
+		err = docker.Run(cmd.Context(), runOptions)
 	}
 
 	return err
@@ -0,0 +1,200 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var scheduleOutput string
+
+// Where the scheduled prediction's inputs and outputs are mounted in the container
+const (
+	containerScheduleInputPath  = "/var/run/cog/schedule/input.json"
+	containerScheduleOutputPath = "/var/run/cog/schedule/outputs"
+)
+
+func newScheduleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schedule <cron> [image]",
+		Short: "Run a prediction on a schedule",
+		Long: `Run a prediction on a schedule.
+
+Start the model and run a prediction with the same inputs on a cron schedule,
+for models that need to run periodically, like daily forecasts or refreshes.
+The schedule has five fields, in UTC: minute, hour, day of the month, month
+and day of the week, like '0 6 * * *' for 6am every day. @hourly, @daily,
+@weekly, @monthly and @yearly can be used too.
+
+Each prediction, and its output files, are written to a directory in --output
+named after when the prediction was scheduled, like
+outputs/20240524T0600Z/prediction.json. --output can be an s3:// URL, with the
+credentials for it passed with -e, like -e AWS_ACCESS_KEY_ID.
+
+If 'image' is passed, the model in that image is run. Otherwise, the model in
+the current directory is built and run. It keeps running until it's stopped.`,
+		Example: `cog schedule "0 6 * * *" -i days=7 -o s3://my-bucket/forecasts -e AWS_ACCESS_KEY_ID -e AWS_SECRET_ACCESS_KEY`,
+		RunE:    cmdSchedule,
+		Args:    cobra.RangeArgs(1, 2),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+	cmd.Flags().StringVarP(&scheduleOutput, "output", "o", "outputs", "Directory, or s3:// URL, to write predictions and their output files to")
+
+	return cmd
+}
+
+func cmdSchedule(cmd *cobra.Command, args []string) error {
+	cron := args[0]
+	if err := checkCron(cron); err != nil {
+		return err
+	}
+
+	inputs, err := parseInputFlags(inputFlags)
+	if err != nil {
+		return err
+	}
+	// Inputs are passed in a file, because files in them are read into data URLs, which can be too big for arguments
+	inputMap, err := inputs.ToMap()
+	if err != nil {
+		return err
+	}
+	inputJSON, err := json.Marshal(inputMap)
+	if err != nil {
+		return err
+	}
+	inputFile, err := os.CreateTemp("", "cog-schedule-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(inputFile.Name())
+	if _, err := inputFile.Write(inputJSON); err != nil {
+		return err
+	}
+	if err := inputFile.Close(); err != nil {
+		return err
+	}
+
+	volumes := []docker.Volume{{Source: inputFile.Name(), Destination: containerScheduleInputPath, ReadOnly: true}}
+	destination, outputDir, err := scheduleDestination(scheduleOutput)
+	if err != nil {
+		return err
+	}
+	if outputDir != "" {
+		if err := os.MkdirAll(outputDir, 0o755); err != nil {
+			return fmt.Errorf("Failed to create %s: %w", outputDir, err)
+		}
+		volumes = append(volumes, docker.Volume{Source: outputDir, Destination: containerScheduleOutputPath})
+	}
+
+	var cfg *config.Config
+	var projectDir, imageName, workdir string
+	serverArgs := []string{"python", "-m", "cog.server.http"}
+	if len(args) == 1 {
+		if cfg, projectDir, err = config.GetConfig(projectDirFlag); err != nil {
+			return err
+		}
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+		workdir = "/src"
+		serverArgs = []string{"python", "--check-hash-based-pycs", "never", "-m", "cog.server.http"}
+	} else {
+		imageName = args[1]
+		if err := pullIfMissing(cmd.Context(), imageName); err != nil {
+			return err
+		}
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	}
+	if cfg.UsesRunner() {
+		return fmt.Errorf("cog schedule only works with Cog's Python server, not 'runner' in cog.yaml or R or Julia predictors")
+	}
+	serverArgs = append(serverArgs,
+		"--schedule", cron,
+		"--schedule-input", "@"+containerScheduleInputPath,
+		"--schedule-destination", destination,
+	)
+
+	runOptions := docker.RunOptions{
+		Args:    serverArgs,
+		Env:     envFlags,
+		GPUs:    gpusForConfig(cfg),
+		Image:   imageName,
+		Volumes: volumes,
+		Workdir: workdir,
+		Labels:  containerLabels("schedule", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
+		runOptions.Platform = "linux/amd64"
+	}
+
+	console.Infof("Running predictions on the schedule '%s' (UTC), and writing them to %s", cron, scheduleOutput)
+	console.Info("Stop with Ctrl-C")
+	console.Info("")
+
+	err = docker.Run(cmd.Context(), runOptions)
+	// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
+	if gpusFlag == "" && runOptions.GPUs != "" && err == docker.ErrMissingDeviceDriver {
+		console.Info("Missing device driver, re-trying without GPU")
+
+		runOptions.GPUs = ""
+		err = docker.Run(cmd.Context(), runOptions)
+	}
+	return err
+}
+
+// checkCron checks that a cron expression has the right number of fields, so that mistakes like unquoted
+// expressions are caught before the model is built. The model's server checks the fields themselves.
+func checkCron(cron string) error {
+	if strings.HasPrefix(cron, "@") {
+		return nil
+	}
+	if len(strings.Fields(cron)) != 5 {
+		return fmt.Errorf("Invalid schedule %q: it should have 5 fields, minute, hour, day of month, month and day of week, like \"0 * * * *\", quoted so that it's one argument", cron)
+	}
+	return nil
+}
+
+// scheduleDestination returns where the model's server writes scheduled predictions to, and the local directory to
+// mount there, if output isn't in S3
+func scheduleDestination(output string) (destination string, outputDir string, err error) {
+	if strings.HasPrefix(output, "s3://") {
+		return output, "", nil
+	}
+	if strings.Contains(output, "://") {
+		return "", "", fmt.Errorf("Invalid --output %q: it must be a directory or an s3:// URL", output)
+	}
+	outputDir, err = filepath.Abs(output)
+	if err != nil {
+		return "", "", err
+	}
+	return containerScheduleOutputPath, outputDir, nil
+}
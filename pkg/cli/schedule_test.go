@@ -0,0 +1,32 @@
+package cli
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCron(t *testing.T) {
+	require.NoError(t, checkCron("0 * * * *"))
+	require.NoError(t, checkCron("*/15 9-17 * * mon-fri"))
+	require.NoError(t, checkCron("@daily"))
+	require.ErrorContains(t, checkCron("0"), "it should have 5 fields")
+	require.ErrorContains(t, checkCron("0 * * * * *"), "it should have 5 fields")
+}
+
+func TestScheduleDestination(t *testing.T) {
+	destination, outputDir, err := scheduleDestination("s3://my-bucket/forecasts")
+	require.NoError(t, err)
+	require.Equal(t, "s3://my-bucket/forecasts", destination)
+	require.Equal(t, "", outputDir)
+
+	dir := filepath.Join(t.TempDir(), "outputs")
+	destination, outputDir, err = scheduleDestination(dir + "/")
+	require.NoError(t, err)
+	require.Equal(t, containerScheduleOutputPath, destination)
+	require.Equal(t, dir, outputDir)
+
+	_, _, err = scheduleDestination("gs://my-bucket/forecasts")
+	require.ErrorContains(t, err, "it must be a directory or an s3:// URL")
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/schema"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	schemaFormat string
+	schemaOutput string
+)
+
+func newSchemaCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema [image]",
+		Short: "Export the model's inputs and output as JSON Schema, OpenAPI or Protocol Buffers",
+		Long: `Export the model's typed interface, its inputs and output, for gateways, form
+builders and validation layers.
+
+The schema is the one 'cog build' generates from the predictor and saves in
+the image, which the model's HTTP API serves at /openapi.json. It can be
+exported as:
+
+  jsonschema  A JSON Schema with the input and output's schemas in $defs
+  openapi     The model's OpenAPI schema, as it is
+  proto       A proto3 file with an Input and an Output message
+
+If 'image' is passed, the schema is that image's. Otherwise, it's the schema
+of the image built from the current directory by 'cog build'.`,
+		Example: `cog schema --format jsonschema -o schema.json
+cog schema r8.im/alice/hotdog-detector --format proto`,
+		RunE: cmdSchema,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	cmd.Flags().StringVar(&schemaFormat, "format", "jsonschema", "Format to export the schema in: "+strings.Join(schema.Formats, ", "))
+	cmd.Flags().StringVarP(&schemaOutput, "output", "o", "", "Path to write the schema to. Defaults to standard output")
+
+	return cmd
+}
+
+func cmdSchema(cmd *cobra.Command, args []string) error {
+	var imageName string
+	if len(args) == 0 {
+		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+	} else {
+		imageName = args[0]
+	}
+
+	doc, err := image.GetOpenAPISchema(cmd.Context(), imageName)
+	if err != nil {
+		if len(args) == 0 {
+			return fmt.Errorf("Failed to read the model's schema from %s. Build it with 'cog build' first: %w", imageName, err)
+		}
+		return err
+	}
+	exported, err := schema.Export(doc, schemaFormat, imageName)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(string(exported), "\n") {
+		exported = append(exported, '\n')
+	}
+
+	if schemaOutput == "" {
+		fmt.Print(string(exported))
+		return nil
+	}
+	if err := os.WriteFile(schemaOutput, exported, 0o644); err != nil { //#nosec G306
+		return fmt.Errorf("Failed to write %s: %w", schemaOutput, err)
+	}
+	console.Infof("Wrote %s", schemaOutput)
+	return nil
+}
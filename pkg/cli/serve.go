@@ -1,20 +1,42 @@
 package cli
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/servers"
 	"github.com/replicate/cog/pkg/util"
+	"github.com/replicate/cog/pkg/util/certs"
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/shell"
 )
 
 var (
-	port = 8393
+	port        = 8393
+	serveTLS    bool
+	serveTLSCrt string
+	serveTLSKey string
+	serveDetach bool
+
+	serveIdleTimeout time.Duration
+)
+
+// Where TLS certificates are mounted in the container
+const (
+	containerTLSCertPath = "/var/run/cog/tls/tls.crt"
+	containerTLSKeyPath  = "/var/run/cog/tls/tls.key"
 )
 
 func newServeCommand() *cobra.Command {
@@ -33,9 +55,15 @@ Generate and run an HTTP server based on the declared model inputs and outputs.`
 	addUseCudaBaseImageFlag(cmd)
 	addUseCogBaseImageFlag(cmd)
 	addGpusFlag(cmd)
+	addVolumeFlag(cmd)
 	addFastFlag(cmd)
 
 	cmd.Flags().IntVarP(&port, "port", "p", port, "Port on which to listen")
+	cmd.Flags().BoolVar(&serveTLS, "tls", false, "Serve HTTPS, with a self-signed certificate for localhost unless --tls-cert and --tls-key are set")
+	cmd.Flags().StringVar(&serveTLSCrt, "tls-cert", "", "Path to a PEM certificate to serve HTTPS with")
+	cmd.Flags().StringVar(&serveTLSKey, "tls-key", "", "Path to the PEM private key for --tls-cert")
+	cmd.Flags().BoolVarP(&serveDetach, "detach", "d", false, "Run the server in the background. Stop it with 'cog stop'")
+	cmd.Flags().DurationVar(&serveIdleTimeout, "idle-timeout", 0, "Stop the model after this long without requests, and start it again on the next request (e.g. 15m)")
 
 	return cmd
 }
@@ -45,8 +73,20 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 	if err != nil {
 		return err
 	}
+	if cfg.PipelineOfImages() {
+		return config.ErrPipelineOfImages
+	}
+	if serveIdleTimeout < 0 {
+		return fmt.Errorf("--idle-timeout can't be negative")
+	}
+	if serveIdleTimeout > 0 && serveDetach {
+		return fmt.Errorf("--idle-timeout can't be used with --detach, because 'cog serve' starts the model when a request comes in")
+	}
+	if serveIdleTimeout > 0 && (serveTLS || serveTLSCrt != "") {
+		return fmt.Errorf("--idle-timeout can't be used with --tls, --tls-cert or --tls-key")
+	}
 
-	imageName, err := image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput)
+	imageName, err := image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput)
 	if err != nil {
 		return err
 	}
@@ -55,13 +95,6 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 		console.Info("Fast serve enabled.")
 	}
 
-	gpus := ""
-	if gpusFlag != "" {
-		gpus = gpusFlag
-	} else if cfg.Build.GPU {
-		gpus = "all"
-	}
-
 	args := []string{
 		"python",
 		"--check-hash-based-pycs", "never",
@@ -69,36 +102,149 @@ func cmdServe(cmd *cobra.Command, arg []string) error {
 		"--await-explicit-shutdown", "true",
 	}
 
+	certPath, keyPath, err := serveTLSFiles()
+	if err != nil {
+		return err
+	}
+	if cfg.UsesRunner() {
+		// The runner's server is started the same way as in the image, with the project mounted over /src
+		args = cfg.ServerCommand()
+		if certPath != "" {
+			return fmt.Errorf("--tls-cert can only be used with Cog's Python server, not 'runner' in cog.yaml or R or Julia predictors")
+		}
+	}
+	scheme := "http"
+	volumes := []docker.Volume{{Source: projectDir, Destination: "/src"}}
+	if certPath != "" {
+		scheme = "https"
+		args = append(args, "--tls-cert", containerTLSCertPath, "--tls-key", containerTLSKeyPath)
+		volumes = append(volumes,
+			docker.Volume{Source: certPath, Destination: containerTLSCertPath},
+			docker.Volume{Source: keyPath, Destination: containerTLSKeyPath},
+		)
+	}
+
 	runOptions := docker.RunOptions{
 		Args:    args,
 		Env:     envFlags,
-		GPUs:    gpus,
+		GPUs:    gpusForConfig(cfg),
 		Image:   imageName,
-		Volumes: []docker.Volume{{Source: projectDir, Destination: "/src"}},
+		Volumes: volumes,
 		Workdir: "/src",
+		Labels:  containerLabels("serve", projectDir),
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
 	}
 
 	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
 		runOptions.Platform = "linux/amd64"
 	}
 
+	if shell.PortIsOpen(port) {
+		freePort, err := shell.FreePort()
+		if err != nil {
+			return fmt.Errorf("Port %d is already in use, and failed to find a free port: %w", port, err)
+		}
+		console.Warnf("Port %d is already in use, using port %d instead", port, freePort)
+		port = freePort
+	}
+
+	if serveIdleTimeout > 0 {
+		return serveUntilIdle(cmd, cfg, runOptions, projectDir)
+	}
+
 	runOptions.Ports = append(runOptions.Ports, docker.Port{HostPort: port, ContainerPort: 5000})
 
+	// Register the server so `cog predict` can find it on whatever port it ended up on
+	server := servers.Server{ProjectDir: projectDir, Port: port, PID: os.Getpid(), StartedAt: time.Now(), TLS: certPath != ""}
+	if serveDetach {
+		// Nothing is left running to unregister it, so it's pruned once it stops listening
+		server.PID = 0
+		return serveDetached(cmd.Context(), runOptions, server)
+	}
+	if err := servers.Register(server); err != nil {
+		console.Warnf("Failed to register server: %s", err)
+	}
+	defer func() {
+		if err := servers.Unregister(projectDir, port); err != nil {
+			console.Debugf("Failed to unregister server: %s", err)
+		}
+	}()
+
 	console.Info("")
 	console.Infof("Running '%[1]s' in Docker with the current directory mounted as a volume...", strings.Join(args, " "))
 	console.Info("")
-	console.Infof("Serving at http://127.0.0.1:%[1]v", port)
+	console.Infof("Serving at %s://127.0.0.1:%v", scheme, port)
 	console.Info("")
 
-	err = docker.Run(runOptions)
+	err = docker.Run(cmd.Context(), runOptions)
 	// Only retry if we're using a GPU but but the user didn't explicitly select a GPU with --gpus
 	// If the user specified the wrong GPU, they are explicitly selecting a GPU and they'll want to hear about it
-	if runOptions.GPUs == "all" && err == docker.ErrMissingDeviceDriver {
+	if gpusFlag == "" && runOptions.GPUs != "" && err == docker.ErrMissingDeviceDriver {
 		console.Info("Missing device driver, re-trying without GPU")
 
 		runOptions.GPUs = ""
-		err = docker.Run(runOptions)
+		err = docker.Run(cmd.Context(), runOptions)
 	}
 
 	return err
 }
+
+// serveDetached starts the server in a container in the background and returns once it has started
+func serveDetached(ctx context.Context, runOptions docker.RunOptions, server servers.Server) error {
+	containerID, err := docker.RunDaemon(ctx, runOptions, os.Stderr)
+	if gpusFlag == "" && runOptions.GPUs != "" && errors.Is(err, docker.ErrMissingDeviceDriver) {
+		console.Info("Missing device driver, re-trying without GPU")
+
+		runOptions.GPUs = ""
+		containerID, err = docker.RunDaemon(ctx, runOptions, os.Stderr)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to start container: %w", err)
+	}
+	if err := servers.Register(server); err != nil {
+		console.Warnf("Failed to register server: %s", err)
+	}
+
+	scheme := "http"
+	if server.TLS {
+		scheme = "https"
+	}
+	shortID := containerID
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+	console.Infof("Serving at %s://127.0.0.1:%v in container %s", scheme, server.Port, shortID)
+	console.Infof("See its logs with 'cog logs %[1]s' and stop it with 'cog stop %[1]s'", shortID)
+	return nil
+}
+
+// serveTLSFiles returns the absolute paths to the certificate and key to serve HTTPS with, or empty strings to serve HTTP
+func serveTLSFiles() (certPath string, keyPath string, err error) {
+	if (serveTLSCrt == "") != (serveTLSKey == "") {
+		return "", "", fmt.Errorf("--tls-cert and --tls-key must be set together")
+	}
+	if serveTLSCrt != "" {
+		if certPath, err = filepath.Abs(serveTLSCrt); err != nil {
+			return "", "", err
+		}
+		if keyPath, err = filepath.Abs(serveTLSKey); err != nil {
+			return "", "", err
+		}
+		return certPath, keyPath, nil
+	}
+	if !serveTLS {
+		return "", "", nil
+	}
+	dir, err := homedir.Expand("~/.config/cog/tls")
+	if err != nil {
+		return "", "", err
+	}
+	console.Infof("Using a self-signed certificate from %s. Clients will need to skip certificate verification.", dir)
+	return certs.SelfSigned(dir)
+}
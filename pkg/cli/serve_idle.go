@@ -0,0 +1,78 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/idleproxy"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/servers"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// serveBackend runs the model's server in a container for idleproxy, on a random port
+type serveBackend struct {
+	runOptions   docker.RunOptions
+	setupTimeout time.Duration
+	predictor    *predict.Predictor
+}
+
+func (b *serveBackend) Start(ctx context.Context) (*url.URL, error) {
+	console.Info("Starting the model...")
+	predictor, err := startPredictor(ctx, b.runOptions, "", b.setupTimeout)
+	if err != nil {
+		return nil, err
+	}
+	b.predictor = predictor
+	return url.Parse(predictor.BaseURL())
+}
+
+func (b *serveBackend) Stop(ctx context.Context) error {
+	if b.predictor == nil {
+		return nil
+	}
+	err := b.predictor.Stop(ctx)
+	b.predictor = nil
+	return err
+}
+
+// serveUntilIdle serves the model on port, but only runs it while it's getting requests: it's started when a request
+// comes in, and stopped once it has had none for --idle-timeout
+func serveUntilIdle(cmd *cobra.Command, cfg *config.Config, runOptions docker.RunOptions, projectDir string) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return fmt.Errorf("Failed to listen on port %d: %w", port, err)
+	}
+
+	backend := &serveBackend{runOptions: runOptions, setupTimeout: setupTimeoutFor(cmd, cfg)}
+	proxy := idleproxy.New(backend, serveIdleTimeout)
+	proxy.OnStop = func() {
+		console.Infof("Stopped the model after %s without requests. It'll start again on the next request.", serveIdleTimeout)
+	}
+
+	// Register the server so `cog predict` can find it on whatever port it ended up on
+	server := servers.Server{ProjectDir: projectDir, Port: port, PID: os.Getpid(), StartedAt: time.Now()}
+	if err := servers.Register(server); err != nil {
+		console.Warnf("Failed to register server: %s", err)
+	}
+	defer func() {
+		if err := servers.Unregister(projectDir, port); err != nil {
+			console.Debugf("Failed to unregister server: %s", err)
+		}
+	}()
+
+	console.Info("")
+	console.Infof("Serving at http://127.0.0.1:%v", port)
+	console.Infof("The model will start on the first request, and stop after %s without requests.", serveIdleTimeout)
+	console.Info("")
+
+	return proxy.Serve(cmd.Context(), l)
+}
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+func newStopCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stop <name> [name...]",
+		Short: "Stop model containers started by Cog",
+		Long: `Stop model containers started by Cog.
+
+'name' is a name or ID shown by 'cog ps'.`,
+		RunE: cmdStop,
+		Args: cobra.MinimumNArgs(1),
+	}
+	return cmd
+}
+
+func cmdStop(cmd *cobra.Command, args []string) error {
+	for _, nameOrID := range args {
+		container, err := docker.FindContainer(cmd.Context(), nameOrID)
+		if err != nil {
+			return err
+		}
+		if err := docker.Stop(cmd.Context(), container.ID); err != nil {
+			return fmt.Errorf("Failed to stop %s: %w", container.Name, err)
+		}
+		console.Infof("Stopped %s", container.Name)
+	}
+	return nil
+}
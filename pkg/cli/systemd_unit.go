@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/systemd"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	unitPort     int
+	unitName     string
+	unitEnvFiles []string
+	unitRestart  string
+	unitOutput   string
+)
+
+func newSystemdUnitCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "systemd-unit [image]",
+		Short: "Generate a systemd service that runs the model's HTTP server",
+		Long: `Generate a systemd service that runs the model's HTTP server.
+
+The service runs the model's image with Docker, and restarts it if it stops.
+This is for running a model on a machine without a container orchestrator.
+
+If 'image' is passed, the service runs that image. Otherwise, it runs the
+image built from the current directory by 'cog build'.
+
+To install the service:
+
+  cog systemd-unit -o /etc/systemd/system/my-model.service
+  systemctl daemon-reload
+  systemctl enable --now my-model`,
+		RunE: cmdSystemdUnit,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addGpusFlag(cmd)
+	addVolumeFlag(cmd)
+
+	cmd.Flags().IntVarP(&unitPort, "port", "p", 5000, "Port on the host to serve on")
+	cmd.Flags().StringVar(&unitName, "name", "", "Name of the container the service runs. Defaults to a name based on the image")
+	cmd.Flags().StringArrayVar(&unitEnvFiles, "env-file", []string{}, "Path on the host to a file of environment variables to pass to the model, in the form name=value on each line")
+	cmd.Flags().StringVar(&unitRestart, "restart", "always", "When systemd restarts the service: "+strings.Join(systemd.RestartPolicies, ", "))
+	cmd.Flags().StringVarP(&unitOutput, "output", "o", "", "Path to write the service file to. Defaults to standard output")
+
+	return cmd
+}
+
+func cmdSystemdUnit(cmd *cobra.Command, args []string) error {
+	if !slices.Contains(systemd.RestartPolicies, unitRestart) {
+		return fmt.Errorf("Invalid --restart %q, expected one of: %s", unitRestart, strings.Join(systemd.RestartPolicies, ", "))
+	}
+
+	var imageName, projectDir string
+	var cfg *config.Config
+	if len(args) == 0 {
+		var err error
+		cfg, projectDir, err = config.GetConfig(projectDirFlag)
+		if err != nil {
+			return err
+		}
+		imageName = cfg.Image
+		if imageName == "" {
+			imageName = config.DockerImageName(projectDir)
+		}
+		exists, err := docker.ImageExists(cmd.Context(), imageName)
+		if err != nil {
+			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
+		}
+		if !exists {
+			console.Warnf("Image %s doesn't exist yet. Build it with 'cog build' before starting the service.", imageName)
+		}
+	} else {
+		imageName = args[0]
+		var err error
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return fmt.Errorf("Failed to read the Cog config from %s. Pull or build the image first: %w", imageName, err)
+		}
+	}
+
+	envFiles := []string{}
+	for _, envFile := range unitEnvFiles {
+		// systemd runs the service from /, so relative paths wouldn't work
+		p, err := filepath.Abs(envFile)
+		if err != nil {
+			return err
+		}
+		envFiles = append(envFiles, p)
+	}
+
+	name := unitName
+	if name == "" {
+		name = unitContainerName(imageName)
+	}
+
+	runOptions := docker.RunOptions{
+		GPUs:     gpusForConfig(cfg),
+		Image:    imageName,
+		Ports:    []docker.Port{{HostPort: unitPort, ContainerPort: 5000}},
+		Labels:   containerLabels("serve", ""),
+		Name:     name,
+		EnvFiles: envFiles,
+	}
+	addContainerOptions(&runOptions, cfg)
+	// Relative sources are made absolute, because systemd runs the service from /
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	runOptions.Env = cfg.RuntimeEnv()
+	for _, secret := range cfg.Secrets {
+		// Writing the value into the service file would leave it readable by anyone on the machine
+		console.Warnf("Secret %s isn't included in the service. Add it to a file passed with --env-file.", secret.Name)
+	}
+
+	dockerPath, err := exec.LookPath("docker")
+	if err != nil || !filepath.IsAbs(dockerPath) {
+		dockerPath = "/usr/bin/docker"
+	}
+
+	unit := systemd.Unit{
+		Description:   "Cog model server for " + imageName,
+		DockerPath:    dockerPath,
+		ContainerName: name,
+		DockerRunArgs: docker.RunArgs(runOptions),
+		Restart:       unitRestart,
+		RestartSec:    10,
+	}
+
+	if unitOutput == "" {
+		fmt.Print(unit.Render())
+		return nil
+	}
+	if err := os.WriteFile(unitOutput, []byte(unit.Render()), 0o644); err != nil { //#nosec G306
+		return fmt.Errorf("Failed to write %s: %w", unitOutput, err)
+	}
+	console.Infof("Wrote %s", unitOutput)
+	return nil
+}
+
+var unitContainerNameIllegalChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// unitContainerName returns a container name for an image, like "cog-my-model" for "r8.im/user/my-model:latest"
+func unitContainerName(imageName string) string {
+	name := path.Base(imageName)
+	name, _, _ = strings.Cut(name, "@")
+	name, _, _ = strings.Cut(name, ":")
+	name = unitContainerNameIllegalChars.ReplaceAllString(name, "-")
+	if !strings.HasPrefix(name, "cog-") {
+		name = "cog-" + name
+	}
+	return name
+}
@@ -0,0 +1,21 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnitContainerName(t *testing.T) {
+	for _, tc := range []struct {
+		image    string
+		expected string
+	}{
+		{"cog-my-model", "cog-my-model"},
+		{"r8.im/user/my-model", "cog-my-model"},
+		{"localhost:5000/my-model:v2", "cog-my-model"},
+		{"r8.im/user/model@sha256:abc", "cog-model"},
+	} {
+		require.Equal(t, tc.expected, unitContainerName(tc.image), tc.image)
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/telemetry"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var telemetryEndpoint string
+
+func newTelemetryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "telemetry",
+		Short: "Turn anonymous usage telemetry on or off",
+		Long: `Turn anonymous usage telemetry on or off.
+
+Telemetry is off unless you turn it on, and it's only sent to an endpoint you give
+it, like your own collector. When it's on, Cog sends an event each time it runs a
+command, with the command's name, how long it took, the category of error it failed
+with, and the versions of Cog and your operating system. It doesn't send arguments,
+file names, image names, or anything about your model.
+
+Set COG_NO_TELEMETRY or DO_NOT_TRACK to turn it off, even if it has been turned on.`,
+		RunE: cmdTelemetryStatus,
+		Args: cobra.NoArgs,
+	}
+	cmd.AddCommand(newTelemetryOnCommand(), newTelemetryOffCommand(), newTelemetryStatusCommand())
+	return cmd
+}
+
+func newTelemetryOnCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "on",
+		Short: "Send anonymous usage telemetry to an endpoint",
+		RunE:  cmdTelemetryOn,
+		Args:  cobra.NoArgs,
+	}
+	cmd.Flags().StringVar(&telemetryEndpoint, "endpoint", "", "The URL to send events to. Required, unless "+telemetry.EndpointEnvVar+" is set or an endpoint has been set before")
+	return cmd
+}
+
+func newTelemetryOffCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "off",
+		Short: "Stop sending anonymous usage telemetry",
+		RunE:  cmdTelemetryOff,
+		Args:  cobra.NoArgs,
+	}
+}
+
+func newTelemetryStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether telemetry is on, and an example of what's sent",
+		RunE:  cmdTelemetryStatus,
+		Args:  cobra.NoArgs,
+	}
+}
+
+func cmdTelemetryOn(cmd *cobra.Command, args []string) error {
+	settings, err := telemetry.LoadSettings()
+	if err != nil {
+		return err
+	}
+	settings.Enabled = true
+	if cmd.Flags().Changed("endpoint") {
+		settings.Endpoint = telemetryEndpoint
+	}
+	if settings.EndpointURL() == "" {
+		return fmt.Errorf("Telemetry needs an endpoint to send events to. Pass --endpoint, or set %s", telemetry.EndpointEnvVar)
+	}
+	if err := settings.Save(); err != nil {
+		return err
+	}
+	console.Infof("Telemetry is on, and is sent to %s. Thanks for helping improve Cog!", settings.EndpointURL())
+	if telemetry.DisabledByEnvironment() {
+		console.Warnf("%s or DO_NOT_TRACK is set, so telemetry isn't sent", telemetry.DisableEnvVar)
+	}
+	return nil
+}
+
+func cmdTelemetryOff(cmd *cobra.Command, args []string) error {
+	settings, err := telemetry.LoadSettings()
+	if err != nil {
+		return err
+	}
+	settings.Enabled = false
+	if err := settings.Save(); err != nil {
+		return err
+	}
+	console.Info("Telemetry is off")
+	return nil
+}
+
+func cmdTelemetryStatus(cmd *cobra.Command, args []string) error {
+	settings, err := telemetry.LoadSettings()
+	if err != nil {
+		return err
+	}
+	switch {
+	case settings.IsEnabled():
+		console.Infof("Telemetry is on, and is sent to %s", settings.EndpointURL())
+	case settings.Enabled && settings.EndpointURL() == "":
+		console.Infof("Telemetry is on, but it hasn't got an endpoint, so it isn't sent. Run 'cog telemetry on --endpoint <url>' to set one")
+	case settings.Enabled:
+		console.Infof("Telemetry is on, but %s or DO_NOT_TRACK is set, so it isn't sent", telemetry.DisableEnvVar)
+	default:
+		console.Info("Telemetry is off. Run 'cog telemetry on' to turn it on")
+	}
+
+	event, err := json.MarshalIndent(telemetry.NewEvent(settings.ID, "cog build", 95*time.Second, nil), "", "  ")
+	if err != nil {
+		return err
+	}
+	console.Infof("\nThis is an example of what's sent each time Cog runs a command:\n%s", event)
+	return nil
+}
@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/examples"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/modeltest"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	testDeterminism     int
+	testTolerance       float64
+	testSeed            int64
+	testUpdate          bool
+	testMinSSIM         float64
+	testMaxHashDistance int
+	testMinSNR          float64
+)
+
+func newTestCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test [image]",
+		Short: "Test the model",
+		Long: `Test the model.
+
+Run the examples saved with 'cog predict --save-example', and compare their
+outputs with the saved golden outputs. Images are compared by how similar they
+look (their SSIM and perceptual hashes), WAV audio by how similar it sounds
+(its signal-to-noise ratio), and JSON by its values, so that small differences
+don't fail the tests. Other files must be identical. Pass --update to save the
+outputs as the new golden outputs.
+
+With --determinism N, run the same inputs N times and check the outputs are
+the same every time, to catch models that return different outputs for the
+same inputs. The inputs are the ones passed with -i, or else the examples
+saved with 'cog predict --save-example'.
+
+Cog passes a seed to the model in the COG_SEED environment variable, and seeds
+Python's random module, NumPy and PyTorch with it before setup() and before
+every prediction. Models that use other sources of randomness should seed them
+from COG_SEED too.
+
+If 'image' is passed, the model in that image is tested. Otherwise, the model
+in the current directory is tested.`,
+		RunE: cmdTest,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	addUseCudaBaseImageFlag(cmd)
+	addUseCogBaseImageFlag(cmd)
+	addBuildProgressOutputFlag(cmd)
+	addGpusFlag(cmd)
+	addSetupTimeoutFlag(cmd)
+
+	cmd.Flags().IntVar(&testDeterminism, "determinism", 0, "Run each prediction this many times, and check the outputs are the same")
+	cmd.Flags().Float64Var(&testTolerance, "tolerance", 0, "How much numbers in the outputs may differ by. Files and other values must be identical")
+	cmd.Flags().Int64Var(&testSeed, "seed", 42, "Seed to pass to the model in "+modeltest.SeedEnvVar)
+	cmd.Flags().BoolVar(&testUpdate, "update", false, "Save the examples' outputs as their new golden outputs")
+	cmd.Flags().Float64Var(&testMinSSIM, "min-ssim", modeltest.DefaultMediaOptions.MinSSIM, "Lowest structural similarity (SSIM) between images and their golden images, from 0 to 1")
+	cmd.Flags().IntVar(&testMaxHashDistance, "max-hash-distance", modeltest.DefaultMediaOptions.MaxHashDistance, "How many of the 64 bits of the perceptual hashes of images and their golden images may differ")
+	cmd.Flags().Float64Var(&testMinSNR, "min-snr", modeltest.DefaultMediaOptions.MinSNR, "Lowest signal-to-noise ratio between audio and its golden audio, in decibels")
+	cmd.Flags().StringArrayVarP(&inputFlags, "input", "i", []string{}, "Inputs, in the form name=value. if value is prefixed with @, then it is read from a file on disk. E.g. -i path=@image.jpg")
+	cmd.Flags().StringArrayVarP(&envFlags, "env", "e", []string{}, "Environment variables, in the form name=value")
+
+	return cmd
+}
+
+// testCase is a set of inputs that `cog test` runs predictions with
+type testCase struct {
+	name   string
+	inputs predict.Inputs
+	// example is the saved example the inputs are from, with the golden output, if there is one
+	example *examples.Example
+}
+
+func cmdTest(cmd *cobra.Command, args []string) error {
+	if testDeterminism == 1 || testDeterminism < 0 {
+		return fmt.Errorf("--determinism must be at least 2")
+	}
+	if testTolerance < 0 {
+		return fmt.Errorf("--tolerance must not be negative")
+	}
+
+	cfg, projectDir, err := config.GetConfig(projectDirFlag)
+	if err != nil {
+		return err
+	}
+
+	cases := []testCase{}
+	if len(inputFlags) > 0 {
+		if testDeterminism == 0 {
+			return fmt.Errorf("Inputs passed with -i don't have golden outputs to compare with. Pass --determinism to check the model is deterministic with them")
+		}
+		inputs, err := parseInputFlags(inputFlags)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, testCase{name: "inputs", inputs: inputs})
+	} else {
+		saved, err := examples.Load(projectDir)
+		if err != nil {
+			return err
+		}
+		for _, example := range saved {
+			cases = append(cases, testCase{name: "example " + example.Name, inputs: example.PredictInputs(), example: example})
+		}
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("Pass the inputs to test with -i, or save examples with 'cog predict --save-example <name>'")
+	}
+
+	var imageName string
+	volumes := []docker.Volume{}
+	if len(args) == 0 {
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+			return err
+		}
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+	} else {
+		imageName = args[0]
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	}
+
+	console.Infof("Starting Docker image %s and running setup()...", imageName)
+	runOptions := docker.RunOptions{
+		GPUs:    gpusForConfig(cfg),
+		Image:   imageName,
+		Volumes: volumes,
+		Env:     envFlags,
+		Labels:  containerLabels("predict", projectDir),
+	}
+	runOptions.Env = append(runOptions.Env, modeltest.SeedEnvVar+"="+strconv.FormatInt(testSeed, 10))
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	token, err := addAPIKey(&runOptions, cfg, "")
+	if err != nil {
+		return err
+	}
+	predictor, err := startPredictor(cmd.Context(), runOptions, token, setupTimeoutFor(cmd, cfg))
+	if err != nil {
+		return err
+	}
+	defer stopPredictor(cmd.Context(), predictor)
+
+	failed := 0
+	for _, c := range cases {
+		if err := runTestCase(cmd.Context(), predictor, c); err != nil {
+			failed++
+			console.Errorf("Test of %s failed: %s", c.name, err)
+			continue
+		}
+		console.Infof("Test of %s passed", c.name)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tests failed", failed, len(cases))
+	}
+	console.Infof("All %d tests passed", len(cases))
+	return nil
+}
+
+// runTestCase runs a test case's inputs, --determinism times if it's set, and checks the output is the same every
+// time and matches the golden output
+func runTestCase(ctx context.Context, predictor *predict.Predictor, c testCase) error {
+	runs := max(1, testDeterminism)
+	var first any
+	for run := 1; run <= runs; run++ {
+		if runs > 1 {
+			console.Infof("Running %s (%d of %d)...", c.name, run, runs)
+		} else {
+			console.Infof("Running %s...", c.name)
+		}
+		prediction, err := predictor.Predict(ctx, c.inputs)
+		if err != nil {
+			return err
+		}
+		if prediction.Status == "failed" {
+			return fmt.Errorf("the prediction failed: %s", prediction.Error)
+		}
+		var output any
+		if prediction.Output != nil {
+			output = *prediction.Output
+		}
+		if run == 1 {
+			first = output
+			continue
+		}
+		if err := modeltest.Compare(first, output, modeltest.Options{Tolerance: testTolerance}); err != nil {
+			return fmt.Errorf("the model isn't deterministic, run %d was different to run 1: %w", run, err)
+		}
+	}
+
+	if c.example == nil {
+		return nil
+	}
+	if testUpdate {
+		if err := c.example.SaveOutput(&first); err != nil {
+			return fmt.Errorf("Failed to save golden output: %w", err)
+		}
+		console.Infof("Saved the golden output for %s", c.name)
+		return nil
+	}
+	golden, err := c.example.GoldenOutput()
+	if err != nil {
+		return fmt.Errorf("Failed to read golden output: %w", err)
+	}
+	return modeltest.Compare(golden, first, modeltest.Options{
+		Tolerance:       testTolerance,
+		Media:           true,
+		MinSSIM:         testMinSSIM,
+		MaxHashDistance: testMaxHashDistance,
+		MinSNR:          testMinSNR,
+	})
+}
@@ -3,9 +3,6 @@ package cli
 import (
 	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
 
 	"github.com/spf13/cobra"
 
@@ -41,6 +38,7 @@ Otherwise, it will build the model in the current directory and train it.`,
 	addDockerfileFlag(cmd)
 	addUseCudaBaseImageFlag(cmd)
 	addGpusFlag(cmd)
+	addVolumeFlag(cmd)
 	addUseCogBaseImageFlag(cmd)
 	addFastFlag(cmd)
 
@@ -54,17 +52,19 @@ Otherwise, it will build the model in the current directory and train it.`,
 func cmdTrain(cmd *cobra.Command, args []string) error {
 	imageName := ""
 	volumes := []docker.Volume{}
-	gpus := gpusFlag
+	projectDir := ""
+	var cfg *config.Config
+	var err error
 
 	if len(args) == 0 {
 		// Build image
 
-		cfg, projectDir, err := config.GetConfig(projectDirFlag)
+		cfg, projectDir, err = config.GetConfig(projectDirFlag)
 		if err != nil {
 			return err
 		}
 
-		if imageName, err = image.BuildBase(cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
+		if imageName, err = image.BuildBase(cmd.Context(), cfg, projectDir, buildUseCudaBaseImage, DetermineUseCogBaseImage(cmd), buildProgressOutput); err != nil {
 			return err
 		}
 
@@ -73,67 +73,56 @@ func cmdTrain(cmd *cobra.Command, args []string) error {
 			Source:      projectDir,
 			Destination: "/src",
 		})
-
-		if gpus == "" && cfg.Build.GPU {
-			gpus = "all"
-		}
 	} else {
 		// Use existing image
 		imageName = args[0]
 
-		exists, err := docker.ImageExists(imageName)
+		exists, err := docker.ImageExists(cmd.Context(), imageName)
 		if err != nil {
 			return fmt.Errorf("Failed to determine if %s exists: %w", imageName, err)
 		}
 		if !exists {
 			console.Infof("Pulling image: %s", imageName)
-			if err := docker.Pull(imageName); err != nil {
+			if err := docker.Pull(cmd.Context(), imageName); err != nil {
 				return fmt.Errorf("Failed to pull %s: %w", imageName, err)
 			}
 		}
-		conf, err := image.GetConfig(imageName)
-		if err != nil {
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
 			return err
 		}
-		if gpus == "" && conf.Build.GPU {
-			gpus = "all"
-		}
 	}
 
 	console.Info("")
 	console.Infof("Starting Docker image %s...", imageName)
 
-	predictor := predict.NewPredictor(docker.RunOptions{
-		GPUs:    gpus,
+	runOptions := docker.RunOptions{
+		GPUs:    gpusForConfig(cfg),
 		Image:   imageName,
 		Volumes: volumes,
 		Env:     trainEnvFlags,
+		Labels:  containerLabels("train", projectDir),
 		Args:    []string{"python", "-m", "cog.server.http", "--x-mode", "train"},
-	}, true, buildFast)
-
-	go func() {
-		captureSignal := make(chan os.Signal, 1)
-		signal.Notify(captureSignal, syscall.SIGINT)
-
-		<-captureSignal
+	}
+	addContainerOptions(&runOptions, cfg)
+	if err := addVolumes(cmd.Context(), &runOptions, cfg, projectDir); err != nil {
+		return err
+	}
+	if err := addRuntimeEnv(&runOptions, cfg); err != nil {
+		return err
+	}
+	token, err := addAPIKey(&runOptions, cfg, "")
+	if err != nil {
+		return err
+	}
 
-		console.Info("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
+	predictor := predict.NewPredictor(runOptions, true, buildFast)
+	predictor.SetToken(token)
 
-	if err := predictor.Start(os.Stderr, time.Duration(setupTimeout)*time.Second); err != nil {
+	if err := predictor.Start(cmd.Context(), os.Stderr, setupTimeoutFor(cmd, cfg)); err != nil {
 		return err
 	}
+	defer stopPredictor(cmd.Context(), &predictor)
 
-	// FIXME: will not run on signal
-	defer func() {
-		console.Debugf("Stopping container...")
-		if err := predictor.Stop(); err != nil {
-			console.Warnf("Failed to stop container: %s", err)
-		}
-	}()
-
-	return predictIndividualInputs(predictor, trainInputFlags, trainOutPath, true)
+	_, _, err = predictIndividualInputs(cmd.Context(), predictor, trainInputFlags, trainOutPath)
+	return err
 }
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/update"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var updateChannel string
+
+func newUpdateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "update",
+		Short: "Update Cog to the latest version",
+		Long: `Update Cog to the latest version.
+
+This downloads the latest release of Cog from GitHub, checks it against the release's
+SHA-256 checksums, and replaces the cog binary that's running with it. The stable channel
+has releases, and the beta channel has pre-releases too.
+
+If Cog was installed with Homebrew, update it with 'brew upgrade cog' instead.`,
+		Args: cobra.NoArgs,
+		RunE: cmdUpdate,
+	}
+	cmd.Flags().StringVar(&updateChannel, "channel", update.ChannelStable, "The release channel to update from: stable or beta")
+	return cmd
+}
+
+func cmdUpdate(cmd *cobra.Command, args []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Failed to find the cog binary: %w", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("Failed to find the cog binary: %w", err)
+	}
+	if strings.Contains(executable, "/Cellar/") || strings.Contains(executable, "/homebrew/") {
+		return fmt.Errorf("Cog was installed with Homebrew, so update it with 'brew upgrade cog'")
+	}
+
+	release, err := update.LatestRelease(cmd.Context(), updateChannel)
+	if err != nil {
+		return err
+	}
+	if !release.IsNewerThan(global.Version) {
+		console.Infof("Cog %s is up to date. The latest %s release is %s", global.Version, updateChannel, release.Version())
+		return nil
+	}
+
+	console.Infof("Updating Cog from %s to %s...", global.Version, release.Version())
+	if err := update.Install(cmd.Context(), release, executable); err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%w\nYou don't have permission to replace %s. Try running 'sudo cog update'", err, executable)
+		}
+		return err
+	}
+	console.Infof("Updated Cog to %s", release.Version())
+	return nil
+}
@@ -0,0 +1,46 @@
+package cli
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var upgradeImageTag string
+
+func newUpgradeImageCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upgrade-image <image>",
+		Short: "Upgrade the Cog runtime in an image to this version of Cog",
+		Long: `Upgrade the Cog runtime in an image to this version of Cog.
+
+Only the runtime is rebuilt, on top of the image, so the model's environment, code and
+weights stay the same, and cog.yaml and the project aren't needed. Use it when an image
+was built with a version of Cog that isn't compatible with this one.
+
+The upgraded image replaces the original, unless --tag is set.`,
+		Example: `cog upgrade-image r8.im/your-username/hotdog-detector -t r8.im/your-username/hotdog-detector:upgraded`,
+		Args:    cobra.ExactArgs(1),
+		RunE:    cmdUpgradeImage,
+	}
+	addBuildProgressOutputFlag(cmd)
+	cmd.Flags().StringVarP(&upgradeImageTag, "tag", "t", "", "A name for the upgraded image in the form 'repository:tag'")
+	return cmd
+}
+
+func cmdUpgradeImage(cmd *cobra.Command, args []string) error {
+	imageName := args[0]
+	newImageName := upgradeImageTag
+	if newImageName == "" {
+		newImageName = imageName
+	}
+	if err := pullIfMissing(cmd.Context(), imageName); err != nil {
+		return err
+	}
+	if err := image.UpgradeRuntime(cmd.Context(), imageName, newImageName, buildProgressOutput); err != nil {
+		return err
+	}
+	console.Infof("\nImage upgraded as %s", newImageName)
+	return nil
+}
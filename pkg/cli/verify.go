@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/provenance"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+var (
+	verifyProvenance bool
+	verifyCommit     string
+	verifyBuilder    string
+)
+
+func newVerifyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify IMAGE",
+		Short: "Check an image in a registry was built the way it says it was",
+		Long: `Check an image in a registry was built the way it says it was.
+
+With --provenance, check the build provenance 'cog push' attached to the
+image: that it's SLSA provenance of the image, and, if --commit or --builder
+are passed, that the image was built from that commit, by that builder. It
+then prints what the image was built from.
+
+The provenance isn't signed, so this only checks it's consistent with the
+image. Anyone who can push to the image's repository can attach provenance.`,
+		Example: `cog verify --provenance --commit 4f1c2e9 r8.im/your-username/hotdog-detector`,
+		RunE:    cmdVerify,
+		Args:    cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().BoolVar(&verifyProvenance, "provenance", false, "Check the image's build provenance")
+	cmd.Flags().StringVar(&verifyCommit, "commit", "", "With --provenance, check the image was built from this Git commit, given as its full SHA or at least its first 7 characters")
+	cmd.Flags().StringVar(&verifyBuilder, "builder", "", "With --provenance, check the image was built by this builder, like 'https://github.com/your-username/hotdog-detector/.github/workflows/push.yaml@refs/heads/main'")
+
+	return cmd
+}
+
+func cmdVerify(cmd *cobra.Command, args []string) error {
+	imageName := args[0]
+	if !verifyProvenance {
+		return fmt.Errorf("Nothing to verify. Pass --provenance to check the image's build provenance")
+	}
+	if verifyCommit != "" && !commitPattern.MatchString(verifyCommit) {
+		return fmt.Errorf("Invalid --commit %s, expected a Git commit's full SHA or at least its first 7 characters, like 4f1c2e9", verifyCommit)
+	}
+
+	statements, digest, err := provenance.Fetch(cmd.Context(), imageName)
+	if errors.Is(err, provenance.ErrNotFound) {
+		return fmt.Errorf("%s has no provenance. Push it with 'cog push', which attaches it", imageName)
+	}
+	if err != nil {
+		return err
+	}
+
+	// An image pushed more than once has provenance from each push. Any of them will do, as long as it checks out.
+	var problems []string
+	for _, statement := range statements {
+		if err := verifyStatement(statement, digest); err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		printProvenance(imageName, digest, &statement.Predicate)
+		return nil
+	}
+	return fmt.Errorf("The provenance of %s doesn't check out:\n  %s", imageName, strings.Join(problems, "\n  "))
+}
+
+// commitPattern matches a Git commit's SHA, which is SHA-1 or SHA-256, or enough of the start of it to identify it
+var commitPattern = regexp.MustCompile(`^[0-9a-fA-F]{7,64}$`)
+
+// verifyStatement checks a statement is provenance of the image with digest, built from the commit and by the
+// builder that were asked for
+func verifyStatement(statement *provenance.Statement, digest string) error {
+	if err := statement.Verify(digest); err != nil {
+		return err
+	}
+	predicate := &statement.Predicate
+	if verifyCommit != "" {
+		commit := predicate.Commit()
+		if commit == "" {
+			return fmt.Errorf("The image wasn't built from a Git commit")
+		}
+		if !strings.HasPrefix(commit, strings.ToLower(verifyCommit)) {
+			return fmt.Errorf("The image was built from commit %s, not %s", commit, verifyCommit)
+		}
+		if predicate.BuildDefinition.InternalParameters.UncommittedChanges {
+			return fmt.Errorf("The image was built from commit %s with changes that weren't committed", commit)
+		}
+	}
+	if verifyBuilder != "" && predicate.RunDetails.Builder.ID != verifyBuilder {
+		return fmt.Errorf("The image was built by %s, not %s", predicate.RunDetails.Builder.ID, verifyBuilder)
+	}
+	return nil
+}
+
+func printProvenance(imageName string, digest string, predicate *provenance.Predicate) {
+	console.Infof("%s@%s has build provenance that's consistent with it", imageName, digest)
+	console.Warnf("The provenance isn't signed, so it doesn't prove how the image was built: anyone who can push to %s can attach provenance to it", imageName)
+	console.Output("")
+	if source := predicate.BuildDefinition.ExternalParameters.Source; source != nil {
+		commit := predicate.Commit()
+		if predicate.BuildDefinition.InternalParameters.UncommittedChanges {
+			commit += " (with changes that weren't committed)"
+		}
+		console.Output(fmt.Sprintf("Source:      %s", strings.TrimPrefix(source.URI, "git+")))
+		console.Output(fmt.Sprintf("Commit:      %s", commit))
+	}
+	console.Output(fmt.Sprintf("Config:      %s", predicate.BuildDefinition.ExternalParameters.Config))
+	console.Output(fmt.Sprintf("Builder:     %s", predicate.RunDetails.Builder.ID))
+	if invocation := predicate.RunDetails.Metadata.InvocationID; invocation != "" {
+		console.Output(fmt.Sprintf("Run:         %s", invocation))
+	}
+	console.Output(fmt.Sprintf("Cog version: %s", predicate.BuildDefinition.InternalParameters.CogVersion))
+	console.Output(fmt.Sprintf("Built:       %s", predicate.RunDetails.Metadata.FinishedOn.Format("2006-01-02 15:04:05 MST")))
+	if dependencies := predicate.BuildDefinition.ResolvedDependencies; len(dependencies) > 0 {
+		console.Output("Built with:")
+		for _, dependency := range dependencies {
+			console.Output(fmt.Sprintf("  %s %s", dependency.Name, formatDigests(dependency.Digest)))
+		}
+	}
+}
+
+// formatDigests formats a resource's digests, like "sha256:abc123"
+func formatDigests(digests map[string]string) string {
+	formatted := []string{}
+	for algorithm, digest := range digests {
+		formatted = append(formatted, algorithm+":"+digest)
+	}
+	sort.Strings(formatted)
+	return strings.Join(formatted, " ")
+}
@@ -0,0 +1,16 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommitPattern(t *testing.T) {
+	for _, commit := range []string{"4f1c2e9", "4F1C2E9", "4f1c2e9b8a7d6c5e4f3a2b1c0d9e8f7a6b5c4d3e"} {
+		require.True(t, commitPattern.MatchString(commit), commit)
+	}
+	for _, commit := range []string{"", "4", "4f1c2e", "main", "4f1c2e9z", "4f1c2e9 "} {
+		require.False(t, commitPattern.MatchString(commit), commit)
+	}
+}
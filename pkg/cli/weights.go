@@ -0,0 +1,240 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/weights"
+)
+
+var (
+	weightsForce     bool
+	weightsOlderThan time.Duration
+)
+
+func newWeightsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "weights",
+		Short: "Manage the weights cache",
+		Long: `Manage the weights cache, where the weights in cog.yaml are downloaded to.
+
+Shared weights, with 'shared: true' in cog.yaml, aren't built into the image.
+They're mounted read-only from the cache when the model runs, so every container
+of the model on a host uses the same files, and the files are only in memory
+once.
+
+The cache is in your user cache directory. Set COG_WEIGHTS_CACHE to use another
+one, like a directory every user on the host can read.`,
+	}
+	cmd.AddCommand(
+		newWeightsLsCommand(),
+		newWeightsPruneCommand(),
+		newWeightsPullCommand(),
+		newWeightsRmCommand(),
+	)
+	return cmd
+}
+
+func newWeightsLsCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "ls",
+		Short: "List the weights in the cache",
+		RunE:  cmdWeightsLs,
+		Args:  cobra.NoArgs,
+	}
+}
+
+func newWeightsPullCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pull [image]",
+		Short: "Download a model's shared weights into the cache",
+		Long: `Download a model's shared weights into the cache, and print the options that
+mount them into its container with 'docker run'.
+
+If 'image' is passed, the weights are the ones the image was built with.
+Otherwise, they're the weights in cog.yaml in the current directory. 'cog
+predict', 'cog serve' and 'cog run' download and mount them themselves, so this
+is for running the image some other way.`,
+		Example: `cog weights pull r8.im/alice/sdxl
+docker run $(cog weights pull r8.im/alice/sdxl) -p 5000:5000 r8.im/alice/sdxl`,
+		RunE: cmdWeightsPull,
+		Args: cobra.MaximumNArgs(1),
+	}
+}
+
+func newWeightsRmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm <repo>[@<commit>]...",
+		Short: "Remove weights from the cache",
+		Long: `Remove weights from the cache: every commit of a repository, or one commit.
+
+Weights that are mounted into a running container aren't removed, unless
+--force is passed.`,
+		Example: `cog weights rm stabilityai/sdxl-turbo
+cog weights rm stabilityai/sdxl-turbo@0123456789abcdef0123456789abcdef01234567`,
+		RunE: cmdWeightsRm,
+		Args: cobra.MinimumNArgs(1),
+	}
+	cmd.Flags().BoolVarP(&weightsForce, "force", "f", false, "Remove weights even if they're mounted into a running container")
+	return cmd
+}
+
+func newWeightsPruneCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the weights that aren't in use from the cache",
+		Long: `Remove the weights that aren't mounted into a running container from the cache.
+
+Weights that have been downloaded or mounted more recently than --older-than
+are kept. Weights that are removed are downloaded again when they're next
+used.`,
+		Example: `cog weights prune --older-than 720h`,
+		RunE:    cmdWeightsPrune,
+		Args:    cobra.NoArgs,
+	}
+	cmd.Flags().DurationVar(&weightsOlderThan, "older-than", 0, "Only remove weights that haven't been used for this long (e.g. 720h)")
+	return cmd
+}
+
+func cmdWeightsLs(cmd *cobra.Command, args []string) error {
+	dir, err := weights.CacheDir()
+	if err != nil {
+		return err
+	}
+	revisions, err := weights.ListCache(dir)
+	if err != nil {
+		return err
+	}
+	if len(revisions) == 0 {
+		console.Infof("No weights in %s", dir)
+		return nil
+	}
+	mounted, err := docker.ListMountSources(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("Failed to list the containers that use weights: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tCOMMIT\tFILES\tSIZE\tLAST USED\tIN USE")
+	for _, r := range revisions {
+		inUse := ""
+		if slices.Contains(mounted, r.Path) {
+			inUse = "yes"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", r.Repo, r.Commit[:12], r.Files, units.HumanSize(float64(r.Size)), console.FormatTime(r.LastUsed), inUse)
+	}
+	return w.Flush()
+}
+
+func cmdWeightsPull(cmd *cobra.Command, args []string) error {
+	var cfg *config.Config
+	var err error
+	imageName := ""
+	if len(args) == 0 {
+		if cfg, _, err = config.GetConfig(projectDirFlag); err != nil {
+			return err
+		}
+	} else {
+		imageName = args[0]
+		if err := pullIfMissing(cmd.Context(), imageName); err != nil {
+			return err
+		}
+		if cfg, err = image.GetConfig(cmd.Context(), imageName); err != nil {
+			return err
+		}
+	}
+	if len(cfg.SharedWeights()) == 0 {
+		console.Info("The model hasn't got any shared weights, because they're built into its image.")
+		return nil
+	}
+
+	volumes, err := image.SharedWeightsMounts(cmd.Context(), cfg, imageName)
+	if err != nil {
+		return err
+	}
+	mounts := []string{}
+	for _, v := range volumes {
+		mounts = append(mounts, fmt.Sprintf("-v %s:%s:ro", v.Source, v.Destination))
+	}
+	console.Output(strings.Join(mounts, " "))
+	return nil
+}
+
+func cmdWeightsRm(cmd *cobra.Command, args []string) error {
+	dir, err := weights.CacheDir()
+	if err != nil {
+		return err
+	}
+	revisions, err := weights.ListCache(dir)
+	if err != nil {
+		return err
+	}
+	mounted := []string{}
+	if !weightsForce {
+		if mounted, err = docker.ListMountSources(cmd.Context()); err != nil {
+			return fmt.Errorf("Failed to list the containers that use weights: %w", err)
+		}
+	}
+
+	for _, arg := range args {
+		repo, commit, _ := strings.Cut(strings.TrimPrefix(arg, weights.HuggingFaceScheme), "@")
+		found := false
+		for _, r := range revisions {
+			if r.Repo != repo || (commit != "" && !strings.HasPrefix(r.Commit, commit)) {
+				continue
+			}
+			found = true
+			if slices.Contains(mounted, r.Path) {
+				return fmt.Errorf("%s@%s is mounted into a running container. Stop it first, or pass --force.", r.Repo, r.Commit)
+			}
+			if err := weights.RemoveCached(dir, r); err != nil {
+				return fmt.Errorf("Failed to remove %s@%s: %w", r.Repo, r.Commit, err)
+			}
+			console.Infof("Removed %s@%s (%s)", r.Repo, r.Commit, units.HumanSize(float64(r.Size)))
+		}
+		if !found {
+			return fmt.Errorf("%s isn't in the weights cache. Run 'cog weights ls' to see what is.", arg)
+		}
+	}
+	return nil
+}
+
+func cmdWeightsPrune(cmd *cobra.Command, args []string) error {
+	dir, err := weights.CacheDir()
+	if err != nil {
+		return err
+	}
+	revisions, err := weights.ListCache(dir)
+	if err != nil {
+		return err
+	}
+	mounted, err := docker.ListMountSources(cmd.Context())
+	if err != nil {
+		return fmt.Errorf("Failed to list the containers that use weights: %w", err)
+	}
+
+	var freed int64
+	for _, r := range revisions {
+		if slices.Contains(mounted, r.Path) || time.Since(r.LastUsed) < weightsOlderThan {
+			continue
+		}
+		if err := weights.RemoveCached(dir, r); err != nil {
+			return fmt.Errorf("Failed to remove %s@%s: %w", r.Repo, r.Commit, err)
+		}
+		console.Infof("Removed %s@%s", r.Repo, r.Commit)
+		freed += r.Size
+	}
+	console.Infof("Freed %s", units.HumanSize(float64(freed)))
+	return nil
+}
@@ -0,0 +1,138 @@
+// Package client generates typed clients for a model's HTTP API, in Python and TypeScript, from the model's OpenAPI
+// schema, so apps can run predictions without writing the HTTP requests themselves.
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+// Languages are the languages clients can be generated in
+var Languages = []string{"python", "typescript"}
+
+// Files are the files clients are written to, by language
+var Files = map[string]string{
+	"python":     "client.py",
+	"typescript": "client.ts",
+}
+
+// Input is one of the model's inputs
+type Input struct {
+	Name        string
+	Description string
+	Required    bool
+	// Default is the input's default, as a literal in the client's language, if it has one that can be
+	Default string
+	// Type is the input's type in the client's language
+	Type string
+	// IsFile and IsFileList are whether the input is a file, or a list of files, which the client sends as data
+	// URLs if they're local files
+	IsFile     bool
+	IsFileList bool
+}
+
+// language is how a client is generated in a language
+type language struct {
+	template string
+	// inputType and outputType return the type of an input or the output
+	inputType  func(schema *openapi3.Schema) string
+	outputType func(schema *openapi3.Schema) string
+	// literal returns a default as a literal, if it can be written as one
+	literal func(v any) (string, bool)
+	// outputFields returns the fields of an output that's an object
+	outputFields func(schema *openapi3.Schema) []Input
+}
+
+// Generate generates a client for the model with a schema, in one of Languages. name is the model's name, like its
+// image, which the client's documentation refers to.
+func Generate(schema *openapi3.T, lang string, name string) ([]byte, error) {
+	var l language
+	switch lang {
+	case "python":
+		l = python
+	case "typescript":
+		l = typescript
+	default:
+		return nil, fmt.Errorf("Clients can't be generated in %s. Choose one of %s", lang, strings.Join(Languages, ", "))
+	}
+	inputSchema := cogschema.Component(schema, "Input")
+	if inputSchema == nil {
+		return nil, fmt.Errorf("The model's schema hasn't got its inputs. Build it with a newer version of Cog")
+	}
+
+	inputs := []Input{}
+	for _, in := range cogschema.SortedProperties(inputSchema) {
+		input := Input{
+			Name:        in.Name,
+			Description: in.Schema.Description,
+			Required:    in.Required,
+			Type:        l.inputType(in.Schema),
+			IsFile:      cogschema.IsFile(in.Schema),
+			IsFileList:  cogschema.IsFileList(in.Schema),
+		}
+		if in.Schema.Default != nil {
+			input.Default, _ = l.literal(in.Schema.Default)
+		}
+		inputs = append(inputs, input)
+	}
+
+	outputType := l.outputType(nil)
+	var outputFields []Input
+	if outputSchema := cogschema.Component(schema, "Output"); outputSchema != nil {
+		outputType = l.outputType(outputSchema)
+		if cogschema.IsObject(outputSchema) {
+			outputFields = l.outputFields(outputSchema)
+		}
+	}
+
+	tmpl, err := template.New(lang).Funcs(templateFuncs).Parse(l.template)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]any{
+		"Name":         name,
+		"Inputs":       inputs,
+		"OutputType":   outputType,
+		"OutputFields": outputFields,
+		"PythonTyping": pythonTyping(inputs, outputType, outputFields),
+	}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+var templateFuncs = template.FuncMap{
+	"fileInputs": func(inputs []Input, list bool) []string {
+		names := []string{}
+		for _, in := range inputs {
+			if (list && in.IsFileList) || (!list && in.IsFile) {
+				names = append(names, in.Name)
+			}
+		}
+		return names
+	},
+	"docstring": docstring,
+	"oneline": func(s string) string {
+		return strings.Join(strings.Fields(s), " ")
+	},
+	"comment": comment,
+	"quote":   quote,
+}
+
+// docstring escapes text for a Python docstring
+func docstring(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, `"""`, `\"\"\"`)
+}
+
+// comment escapes text for a JSDoc comment
+func comment(s string) string {
+	return strings.ReplaceAll(s, "*/", `*\/`)
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["prompt"],
+        "properties": {
+          "steps": {"type": "integer", "title": "Steps", "default": 20, "x-order": 1, "description": "Number of denoising steps"},
+          "prompt": {"type": "string", "title": "Prompt", "x-order": 0, "description": "What to draw"},
+          "image": {"type": "string", "format": "uri", "title": "Image", "x-order": 2},
+          "masks": {"type": "array", "items": {"type": "string", "format": "uri"}, "title": "Masks", "x-order": 3},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 4}
+        }
+      },
+      "scheduler": {"type": "string", "title": "scheduler", "enum": ["DDIM", "K_EULER"]},
+      "Output": {
+        "type": "object",
+        "title": "Output",
+        "required": ["images"],
+        "properties": {
+          "images": {"type": "array", "items": {"type": "string", "format": "uri"}, "title": "Images"},
+          "seed": {"type": "integer", "title": "Seed", "description": "The seed that was used"}
+        }
+      }
+    }
+  }
+}`
+
+func loadSchema(t *testing.T, data string) *openapi3.T {
+	t.Helper()
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(data))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestGeneratePython(t *testing.T) {
+	contents, err := Generate(loadSchema(t, testSchema), "python", "r8.im/test/sdxl")
+	require.NoError(t, err)
+	client := string(contents)
+	require.Contains(t, client, "from typing import IO, Any, Dict, List, Literal, Optional, TypedDict, Union\n")
+	require.Contains(t, client, `
+class Output(TypedDict):
+    """The model's output"""
+
+    images: List[FileOutput]
+    # The seed that was used
+    seed: Optional[int]
+
+
+FILE_INPUTS = ["image"]
+FILE_LIST_INPUTS = ["masks"]
+`)
+	require.Contains(t, client, `
+    def predict(
+        self,
+        *,
+        prompt: str,
+        steps: int = 20,
+        image: Optional[FileInput] = None,
+        masks: Optional[List[FileInput]] = None,
+        scheduler: Literal["DDIM", "K_EULER"] = "DDIM",
+        prediction_id: Optional[str] = None,
+    ) -> Output:
+        """Run a prediction, and return its output when it's finished
+
+        Args:
+            prompt: What to draw
+            steps: Number of denoising steps
+            image: image
+            masks: masks
+            scheduler: scheduler
+        """
+        input = {
+            "prompt": prompt,
+            "steps": steps,
+            "image": image,
+            "masks": masks,
+            "scheduler": scheduler,
+        }
+        return _output(
+            self._client.request(**_request(input, prediction_id, None))
+        )
+`)
+	require.Contains(t, client, "    async def predict(\n")
+}
+
+func TestGenerateTypeScript(t *testing.T) {
+	contents, err := Generate(loadSchema(t, testSchema), "typescript", "r8.im/test/sdxl")
+	require.NoError(t, err)
+	client := string(contents)
+	require.Contains(t, client, `
+/** The model's inputs */
+export interface Input {
+  /** What to draw */
+  prompt: string;
+  /** Number of denoising steps */
+  steps?: number;
+  image?: FileInput;
+  masks?: Array<FileInput>;
+  scheduler?: "DDIM" | "K_EULER";
+}
+
+/** The model's output */
+export interface Output {
+  images: Array<FileOutput>;
+  /** The seed that was used */
+  seed: number | null;
+}
+`)
+	require.Contains(t, client, `const FILE_INPUTS: string[] = ["image"];`)
+	require.Contains(t, client, `const FILE_LIST_INPUTS: string[] = ["masks"];`)
+}
+
+func TestGenerateScalarOutput(t *testing.T) {
+	schema := loadSchema(t, `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {"type": "object", "title": "Input", "properties": {}},
+      "Output": {"type": "array", "items": {"type": "string"}, "x-cog-array-type": "iterator"}
+    }
+  }
+}`)
+	contents, err := Generate(schema, "python", "hello")
+	require.NoError(t, err)
+	require.Contains(t, string(contents), "Output = List[str]\n")
+	require.Contains(t, string(contents), "from typing import IO, Any, Dict, List, Optional, Union\n")
+	require.Contains(t, string(contents), "        input: Dict[str, Any] = {}\n")
+
+	contents, err = Generate(schema, "typescript", "hello")
+	require.NoError(t, err)
+	require.Contains(t, string(contents), "export type Output = Array<string>;\n")
+
+	_, err = Generate(schema, "rust", "hello")
+	require.ErrorContains(t, err, "Choose one of python, typescript")
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+	// blank import for embeds
+	_ "embed"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+//go:embed templates/client.py.tmpl
+var pythonTemplate string
+
+var python = language{
+	template: pythonTemplate,
+	inputType: func(schema *openapi3.Schema) string {
+		return pythonType(schema, "FileInput")
+	},
+	outputType: func(schema *openapi3.Schema) string {
+		return pythonType(schema, "FileOutput")
+	},
+	literal: cogschema.PythonLiteral,
+	outputFields: func(schema *openapi3.Schema) []Input {
+		fields := []Input{}
+		for _, p := range cogschema.SortedProperties(schema) {
+			t := pythonType(p.Schema, "FileOutput")
+			if !p.Required {
+				t = "Optional[" + t + "]"
+			}
+			fields = append(fields, Input{Name: p.Name, Description: p.Schema.Description, Required: p.Required, Type: t})
+		}
+		return fields
+	},
+}
+
+// pythonType returns the Python type of a value with a schema, where file is the type of files
+func pythonType(schema *openapi3.Schema, file string) string {
+	if schema == nil {
+		return "Any"
+	}
+	schema = cogschema.Resolve(schema)
+	if len(schema.Enum) > 0 {
+		choices := []string{}
+		for _, v := range schema.Enum {
+			literal, ok := cogschema.PythonLiteral(v)
+			if !ok {
+				return "Any"
+			}
+			choices = append(choices, literal)
+		}
+		return "Literal[" + strings.Join(choices, ", ") + "]"
+	}
+	switch {
+	case cogschema.IsFile(schema):
+		return file
+	case cogschema.Is(schema, "string"):
+		return "str"
+	case cogschema.Is(schema, "integer"):
+		return "int"
+	case cogschema.Is(schema, "number"):
+		return "float"
+	case cogschema.Is(schema, "boolean"):
+		return "bool"
+	case cogschema.Is(schema, "array"):
+		if schema.Items == nil || schema.Items.Value == nil {
+			return "List[Any]"
+		}
+		return "List[" + pythonType(schema.Items.Value, file) + "]"
+	case cogschema.Is(schema, "object"):
+		return "Dict[str, Any]"
+	}
+	return "Any"
+}
+
+// pythonTyping returns the names the Python client imports from typing, which depend on the types of the model's
+// inputs and output
+func pythonTyping(inputs []Input, outputType string, outputFields []Input) string {
+	types := []string{outputType}
+	for _, in := range inputs {
+		types = append(types, in.Type)
+	}
+	for _, field := range outputFields {
+		types = append(types, field.Type)
+	}
+	all := strings.Join(types, " ")
+	names := []string{"IO", "Any", "Dict"}
+	if strings.Contains(all, "List[") {
+		names = append(names, "List")
+	}
+	if strings.Contains(all, "Literal[") {
+		names = append(names, "Literal")
+	}
+	names = append(names, "Optional")
+	if len(outputFields) > 0 {
+		names = append(names, "TypedDict")
+	}
+	return strings.Join(append(names, "Union"), ", ")
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+//go:embed templates/client.ts.tmpl
+var typescriptTemplate string
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+var typescript = language{
+	template: typescriptTemplate,
+	inputType: func(schema *openapi3.Schema) string {
+		return typescriptType(schema, "FileInput")
+	},
+	outputType: func(schema *openapi3.Schema) string {
+		return typescriptType(schema, "FileOutput")
+	},
+	literal: typescriptLiteral,
+	outputFields: func(schema *openapi3.Schema) []Input {
+		fields := []Input{}
+		for _, p := range cogschema.SortedProperties(schema) {
+			t := typescriptType(p.Schema, "FileOutput")
+			if !p.Required {
+				t += " | null"
+			}
+			fields = append(fields, Input{Name: p.Name, Description: p.Schema.Description, Required: p.Required, Type: t})
+		}
+		return fields
+	},
+}
+
+// typescriptType returns the TypeScript type of a value with a schema, where file is the type of files
+func typescriptType(schema *openapi3.Schema, file string) string {
+	if schema == nil {
+		return "unknown"
+	}
+	schema = cogschema.Resolve(schema)
+	if len(schema.Enum) > 0 {
+		choices := []string{}
+		for _, v := range schema.Enum {
+			literal, ok := typescriptLiteral(v)
+			if !ok {
+				return "unknown"
+			}
+			choices = append(choices, literal)
+		}
+		return strings.Join(choices, " | ")
+	}
+	switch {
+	case cogschema.IsFile(schema):
+		return file
+	case cogschema.Is(schema, "string"):
+		return "string"
+	case cogschema.Is(schema, "integer"), cogschema.Is(schema, "number"):
+		return "number"
+	case cogschema.Is(schema, "boolean"):
+		return "boolean"
+	case cogschema.Is(schema, "array"):
+		if schema.Items == nil || schema.Items.Value == nil {
+			return "Array<unknown>"
+		}
+		return "Array<" + typescriptType(schema.Items.Value, file) + ">"
+	case cogschema.Is(schema, "object"):
+		return "Record<string, unknown>"
+	}
+	return "unknown"
+}
+
+// typescriptLiteral returns a value from the schema, like a default, as a TypeScript literal
+func typescriptLiteral(v any) (string, bool) {
+	j, err := json.Marshal(v)
+	return string(j), err == nil
+}
+
+// quote returns a property name, quoted if it isn't an identifier in TypeScript
+func quote(name string) string {
+	if identifierPattern.MatchString(name) {
+		return name
+	}
+	j, _ := json.Marshal(name)
+	return string(j)
+}
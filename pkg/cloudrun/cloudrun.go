@@ -0,0 +1,221 @@
+// Package cloudrun deploys models to Google Cloud Run as services, with the gcloud CLI. It uses the same credentials
+// and project as the CLI does.
+package cloudrun
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/secrets"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// MaxTimeout is the longest, in seconds, Cloud Run lets a request run for
+const MaxTimeout = 3600
+
+// GPUType is the GPU Cloud Run services can have
+const GPUType = "nvidia-l4"
+
+// Services with a GPU need at least this many CPUs and this much memory, and Cloud Run can only give them one GPU
+const (
+	minGPUCPU    = 4
+	minGPUMemory = 16 * 1024 * 1024 * 1024
+)
+
+// Service is a Cloud Run service that runs a model
+type Service struct {
+	Name string
+	// Image is the model's image in Artifact Registry or Container Registry
+	Image string
+	// Region is where the service runs, like us-central1, or "" for gcloud's default
+	Region string
+	// Project is the Google Cloud project the service is in, or "" for gcloud's default
+	Project string
+	// MinInstances is how many instances Cloud Run keeps running when there aren't any requests
+	MinInstances int
+	// Timeout is in seconds
+	Timeout              int
+	AllowUnauthenticated bool
+}
+
+// registryPattern matches images in Artifact Registry, like us-central1-docker.pkg.dev/my-project/models/hotdog, and
+// Container Registry, like gcr.io/my-project/hotdog
+var registryPattern = regexp.MustCompile(`^(?:([a-z0-9-]+)-docker\.pkg\.dev|(?:[a-z]+\.)?gcr\.io)/([a-z0-9.:-]+)/`)
+
+// ImageLocation returns the region and project of an image in Artifact Registry or Container Registry. The region is
+// "" for Container Registry, which isn't regional.
+func ImageLocation(imageName string) (region string, project string, err error) {
+	m := registryPattern.FindStringSubmatch(imageName)
+	if m == nil {
+		return "", "", fmt.Errorf("%s isn't in Artifact Registry or Container Registry, which Cloud Run runs images from. Push it to a repository like us-central1-docker.pkg.dev/my-project/models/hotdog-detector", imageName)
+	}
+	return m[1], m[2], nil
+}
+
+// Args returns the arguments to `gcloud run deploy` that deploy a model with a configuration, and the environment
+// variables to set on the service from environment_variables in cog.yaml, which are passed in a file so their values
+// can have any characters in them
+func Args(cfg *config.Config, s Service) (args []string, env map[string]string, err error) {
+	if s.Timeout < 1 || s.Timeout > MaxTimeout {
+		return nil, nil, fmt.Errorf("Invalid timeout %d, expected between 1 and %d seconds", s.Timeout, MaxTimeout)
+	}
+	if cfg.Build.Target != "" {
+		return nil, nil, fmt.Errorf("The model is built to run on %s, not a server, so it can't run on Cloud Run. Remove build.target from cog.yaml", cfg.Build.Target)
+	}
+	args = []string{"run", "deploy", s.Name, "--image", s.Image, "--port", strconv.Itoa(config.RunnerPort), "--timeout", strconv.Itoa(s.Timeout), "--min-instances", strconv.Itoa(s.MinInstances)}
+	if s.Region != "" {
+		args = append(args, "--region", s.Region)
+	}
+	if s.Project != "" {
+		args = append(args, "--project", s.Project)
+	}
+
+	// Cog's server runs one prediction at a time, unless concurrency.max says it can run more
+	concurrency := 1
+	if cfg.Concurrency != nil && cfg.Concurrency.Max > 0 {
+		concurrency = cfg.Concurrency.Max
+	}
+	args = append(args, "--concurrency", strconv.Itoa(concurrency))
+
+	cpu := 0.0
+	memory := int64(0)
+	if cfg.Resources != nil {
+		cpu = cfg.Resources.CPU
+		memory = cfg.Resources.MemoryBytes()
+	}
+	if cfg.Build.GPU {
+		if err := checkGPU(cfg.Resources); err != nil {
+			return nil, nil, err
+		}
+		cpu = max(cpu, minGPUCPU)
+		memory = max(memory, minGPUMemory)
+		// Cloud Run only gives services GPUs if their CPUs are always allocated
+		args = append(args, "--gpu", "1", "--gpu-type", GPUType, "--no-cpu-throttling")
+	}
+	if cpu > 0 {
+		args = append(args, "--cpu", strconv.FormatFloat(cpu, 'f', -1, 64))
+	}
+	if memory > 0 {
+		args = append(args, "--memory", strconv.FormatInt((memory+1024*1024-1)/(1024*1024), 10)+"Mi")
+	}
+
+	secretRefs, err := secretArgs(cfg.Secrets)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(secretRefs) > 0 {
+		args = append(args, "--set-secrets", strings.Join(secretRefs, ","))
+	}
+
+	if s.AllowUnauthenticated {
+		args = append(args, "--allow-unauthenticated")
+	} else {
+		args = append(args, "--no-allow-unauthenticated")
+	}
+	return args, cfg.EnvironmentVariables, nil
+}
+
+func checkGPU(resources *config.Resources) error {
+	if resources == nil {
+		return nil
+	}
+	if resources.GPUCount > 1 {
+		return fmt.Errorf("resources.gpu_count is %d, but Cloud Run services can only have one GPU", resources.GPUCount)
+	}
+	if resources.GPUType != "" && !strings.Contains(strings.ToLower(resources.GPUType), "l4") {
+		return fmt.Errorf("resources.gpu_type is %s, but Cloud Run services can only have NVIDIA L4 GPUs", resources.GPUType)
+	}
+	return nil
+}
+
+// secretArgs returns the secrets from cog.yaml as Cloud Run secret references, like HF_TOKEN=hf-token:latest. Cloud
+// Run reads them from Secret Manager when it starts the model, so they must all be in it.
+func secretArgs(secretList []config.Secret) ([]string, error) {
+	refs := []string{}
+	for _, s := range secretList {
+		ref, err := secrets.ParseRef(s.From)
+		if err != nil || ref.Provider != "gcp-secret-manager" {
+			return nil, fmt.Errorf("Cloud Run can't read secret %s from your machine. Store it in Secret Manager, and set its from to gcp-secret-manager:<name> in cog.yaml", s.Name)
+		}
+		if ref.Field != "" {
+			return nil, fmt.Errorf("Cloud Run can't pick the field %s from secret %s. Store the field in a secret of its own", ref.Field, s.Name)
+		}
+		secret, version := secrets.SplitGCPSecretVersion(ref.Path)
+		refs = append(refs, s.Name+"="+secret+":"+version)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+// DeployArgs returns the arguments to gcloud that Deploy runs, with the service's environment variables read from
+// envFile, and the variables Deploy writes to it. There's no envFile argument if there aren't any variables.
+func DeployArgs(cfg *config.Config, s Service, envFile string) (args []string, env map[string]string, err error) {
+	args, env, err = Args(cfg, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(env) > 0 {
+		args = append(args, "--env-vars-file", envFile)
+	}
+	return append(args, "--format", "value(status.url)"), env, nil
+}
+
+// Deploy creates or updates the service, and returns its URL
+func Deploy(cfg *config.Config, s Service) (string, error) {
+	dir, err := os.MkdirTemp("", "cog-cloudrun-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, "env.yaml")
+	args, env, err := DeployArgs(cfg, s, envFile)
+	if err != nil {
+		return "", err
+	}
+	if len(env) > 0 {
+		contents, err := yaml.Marshal(env)
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(envFile, contents, 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	console.Infof("Deploying Cloud Run service %s...", s.Name)
+	out, err := runGcloud(args...)
+	if err != nil {
+		return "", fmt.Errorf("Failed to deploy Cloud Run service %s: %w", s.Name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// runGcloud is a variable so tests can replace the gcloud CLI. gcloud's progress goes to the terminal, and its output
+// is returned.
+var runGcloud = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("gcloud", args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ gcloud " + strings.Join(args, " "))
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the gcloud CLI isn't installed. See https://cloud.google.com/sdk/docs/install")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,101 @@
+package cloudrun
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+const testImage = "us-central1-docker.pkg.dev/my-project/models/hotdog-detector:latest"
+
+func TestImageLocation(t *testing.T) {
+	region, project, err := ImageLocation(testImage)
+	require.NoError(t, err)
+	require.Equal(t, "us-central1", region)
+	require.Equal(t, "my-project", project)
+
+	region, project, err = ImageLocation("gcr.io/my-project/hotdog-detector")
+	require.NoError(t, err)
+	require.Equal(t, "", region)
+	require.Equal(t, "my-project", project)
+
+	_, _, err = ImageLocation("r8.im/alice/hotdog-detector")
+	require.ErrorContains(t, err, "isn't in Artifact Registry")
+}
+
+func TestArgs(t *testing.T) {
+	cfg := &config.Config{
+		Build:                &config.Build{},
+		Concurrency:          &config.Concurrency{Max: 4},
+		Resources:            &config.Resources{CPU: 2, Memory: "8Gi"},
+		EnvironmentVariables: map[string]string{"MODEL_SIZE": "large"},
+		Secrets:              []config.Secret{{Name: "HF_TOKEN", From: "gcp-secret-manager:hf-token"}},
+	}
+	args, env, err := Args(cfg, Service{Name: "hotdog-detector", Image: testImage, Region: "us-central1", MinInstances: 1, Timeout: 600})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"run", "deploy", "hotdog-detector", "--image", testImage, "--port", "5000", "--timeout", "600", "--min-instances", "1",
+		"--region", "us-central1", "--concurrency", "4", "--cpu", "2", "--memory", "8192Mi",
+		"--set-secrets", "HF_TOKEN=hf-token:latest", "--no-allow-unauthenticated",
+	}, args)
+	require.Equal(t, map[string]string{"MODEL_SIZE": "large"}, env)
+
+	cfg.Build.Target = config.TargetLambda
+	_, _, err = Args(cfg, Service{Name: "hotdog-detector", Image: testImage, Timeout: 600})
+	require.ErrorContains(t, err, "can't run on Cloud Run")
+}
+
+func TestArgsWithGPU(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{GPU: true}, Resources: &config.Resources{GPUType: "L4"}}
+	args, _, err := Args(cfg, Service{Name: "hotdog-detector", Image: testImage, Timeout: 3600, AllowUnauthenticated: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"run", "deploy", "hotdog-detector", "--image", testImage, "--port", "5000", "--timeout", "3600", "--min-instances", "0",
+		"--concurrency", "1", "--gpu", "1", "--gpu-type", "nvidia-l4", "--no-cpu-throttling", "--cpu", "4", "--memory", "16384Mi",
+		"--allow-unauthenticated",
+	}, args)
+
+	cfg.Resources = &config.Resources{GPUType: "A100"}
+	_, _, err = Args(cfg, Service{Name: "hotdog-detector", Image: testImage, Timeout: 3600})
+	require.ErrorContains(t, err, "can only have NVIDIA L4 GPUs")
+
+	cfg.Resources = &config.Resources{GPUCount: 2}
+	_, _, err = Args(cfg, Service{Name: "hotdog-detector", Image: testImage, Timeout: 3600})
+	require.ErrorContains(t, err, "can only have one GPU")
+}
+
+func TestArgsRejectsSecretsFromTheHost(t *testing.T) {
+	for _, secret := range []config.Secret{
+		{Name: "HF_TOKEN", Env: "HF_TOKEN"},
+		{Name: "HF_TOKEN", From: "vault:kv/models/hf#token"},
+		{Name: "HF_TOKEN", From: "gcp-secret-manager:hf#token"},
+	} {
+		cfg := &config.Config{Build: &config.Build{}, Secrets: []config.Secret{secret}}
+		_, _, err := Args(cfg, Service{Name: "hotdog-detector", Image: testImage, Timeout: 600})
+		require.Error(t, err, secret)
+	}
+}
+
+func TestDeploy(t *testing.T) {
+	var calledWith []string
+	var envFile []byte
+	original := runGcloud
+	t.Cleanup(func() { runGcloud = original })
+	runGcloud = func(args ...string) ([]byte, error) {
+		calledWith = args
+		var err error
+		envFile, err = os.ReadFile(args[len(args)-3])
+		require.NoError(t, err)
+		return []byte("https://hotdog-detector-abc123-uc.a.run.app\n"), nil
+	}
+
+	cfg := &config.Config{Build: &config.Build{}, EnvironmentVariables: map[string]string{"LABELS": "hotdog,not hotdog"}}
+	url, err := Deploy(cfg, Service{Name: "hotdog-detector", Image: testImage, Timeout: 600})
+	require.NoError(t, err)
+	require.Equal(t, "https://hotdog-detector-abc123-uc.a.run.app", url)
+	require.Equal(t, []string{"--env-vars-file"}, calledWith[len(calledWith)-4:len(calledWith)-3])
+	require.Equal(t, "LABELS: hotdog,not hotdog\n", string(envFile))
+}
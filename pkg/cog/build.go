@@ -0,0 +1,73 @@
+package cog
+
+import (
+	"context"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/image"
+)
+
+// BuildOptions are how to build a model. They're the same as the flags to `cog build`.
+type BuildOptions struct {
+	// Tag is the name of the image to build. It defaults to 'image' in cog.yaml, or a name based on the project
+	// directory.
+	Tag string
+	// Secrets are secrets to pass to the build, in the same format as `docker build --secret`
+	Secrets []string
+	// BuildArgs override build args in build.args in cog.yaml, in the form KEY=VALUE, like `cog build --build-arg`
+	BuildArgs []string
+	// NoCache builds without using the cache
+	NoCache bool
+	// SeparateWeights builds the model's weights into a separate layer
+	SeparateWeights bool
+	// UseCudaBaseImage is whether to use NVIDIA's CUDA base images: "auto" (the default), "true" or "false"
+	UseCudaBaseImage string
+	// UseCogBaseImage is whether to use Cog's base images. If it's nil, Cog decides.
+	UseCogBaseImage *bool
+	// ProgressOutput is the type of build progress output: "auto", "tty" or "plain". It defaults to "plain".
+	ProgressOutput string
+	// SchemaFile is a model schema to use, instead of generating one from the model
+	SchemaFile string
+	// Dockerfile is a Dockerfile to build with, instead of generating one from cog.yaml
+	Dockerfile string
+	// Strip strips shared libraries to make the image smaller
+	Strip bool
+	// Precompile precompiles Python bytecode
+	Precompile bool
+	// NoPinBaseImage builds on whatever the base image's tag points to, rather than pinning it to a digest in the
+	// project's build manifest the first time it's built
+	NoPinBaseImage bool
+	// Project is the project a BuildQueue counts the build against, to limit how many builds of each project run at
+	// the same time. It defaults to the project's directory. Builds of checkouts in different directories, like of
+	// each commit pushed to a repository, set it to share a limit. Build ignores it.
+	Project string
+}
+
+// Build builds the model in dir, or the nearest parent directory with a cog.yaml if dir is empty, and returns the
+// name of the image
+func Build(ctx context.Context, dir string, opts BuildOptions) (string, error) {
+	cfg, projectDir, err := loadConfig(dir, opts.BuildArgs)
+	if err != nil {
+		return "", err
+	}
+	if err := config.ValidateModelPythonVersion(cfg); err != nil {
+		return "", err
+	}
+
+	imageName := opts.Tag
+	if imageName == "" {
+		imageName = cfg.Image
+	}
+	if imageName == "" {
+		imageName = config.DockerImageName(projectDir)
+	}
+	progressOutput := opts.ProgressOutput
+	if progressOutput == "" {
+		progressOutput = "plain"
+	}
+
+	if err := image.Build(ctx, cfg, projectDir, imageName, opts.Secrets, opts.BuildArgs, opts.NoCache, opts.SeparateWeights, opts.UseCudaBaseImage, progressOutput, opts.SchemaFile, opts.Dockerfile, opts.UseCogBaseImage, opts.Strip, opts.Precompile, false, !opts.NoPinBaseImage); err != nil {
+		return "", err
+	}
+	return imageName, nil
+}
@@ -0,0 +1,40 @@
+// Package cog builds, pushes and runs Cog models from Go, for services that embed Cog rather than running the cog
+// command.
+//
+// Functions take a context, and return errors rather than exiting. Messages about what's happening, and the output
+// of Docker, are written to standard error, or to the writer passed to SetOutput.
+package cog
+
+import (
+	"io"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// SetOutput sets where messages and the output of Docker are written, instead of standard error. It applies to the
+// whole process.
+func SetOutput(w io.Writer) {
+	console.SetOutput(w)
+}
+
+// LoadConfig loads and validates the cog.yaml in dir, or if dir is empty, in the current directory or the nearest
+// parent directory with a cog.yaml. It returns the config and the absolute path of the project directory.
+func LoadConfig(dir string) (*config.Config, string, error) {
+	return loadConfig(dir, nil)
+}
+
+// loadConfig loads the config like LoadConfig, for a build with buildArgs, which must override build args in
+// build.args
+func loadConfig(dir string, buildArgs []string) (*config.Config, string, error) {
+	cfg, projectDir, err := config.GetConfigWithBuildArgs(dir, buildArgs)
+	if err != nil {
+		return nil, "", err
+	}
+	projectDir, err = filepath.Abs(projectDir)
+	if err != nil {
+		return nil, "", err
+	}
+	return cfg, projectDir, nil
+}
@@ -0,0 +1,59 @@
+package cog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cat.png")
+	require.NoError(t, os.WriteFile(path, []byte("cat"), 0o644))
+	u, err := File(path)
+	require.NoError(t, err)
+	require.Equal(t, "data:image/png;base64,Y2F0", u)
+
+	_, err = File(filepath.Join(t.TempDir(), "missing.png"))
+	require.Error(t, err)
+}
+
+func TestGPUs(t *testing.T) {
+	cpu := &config.Config{Build: &config.Build{}}
+	gpu := &config.Config{Build: &config.Build{GPU: true}}
+	twoGPUs := &config.Config{Build: &config.Build{GPU: true}, Resources: &config.Resources{GPUCount: 2}}
+
+	require.Equal(t, "", gpus("", cpu))
+	require.Equal(t, "all", gpus("", gpu))
+	require.Equal(t, "2", gpus("", twoGPUs))
+	require.Equal(t, "device=1", gpus("device=1", gpu))
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_version: \"3.12\"\npredict: predict.py:Predictor\n"), 0o644))
+
+	cfg, projectDir, err := LoadConfig(dir)
+	require.NoError(t, err)
+	require.Equal(t, dir, projectDir)
+	require.Equal(t, "3.12", cfg.Build.PythonVersion)
+
+	_, _, err = LoadConfig(t.TempDir())
+	require.Error(t, err)
+}
+
+func TestCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.ErrorIs(t, Push(ctx, "my-model", PushOptions{}), context.Canceled)
+	require.ErrorIs(t, CheckPushable(ctx, "r8.im/alice/hotdog"), context.Canceled)
+}
+
+func TestReplicateModelURL(t *testing.T) {
+	require.Equal(t, "https://replicate.com/alice/hotdog", ReplicateModelURL("r8.im/alice/hotdog"))
+	require.Equal(t, "", ReplicateModelURL("ghcr.io/alice/hotdog"))
+}
@@ -0,0 +1,212 @@
+package cog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/image"
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// DefaultSetupTimeout is how long to wait for a model's setup() to finish, if RunOptions.SetupTimeout isn't set
+const DefaultSetupTimeout = 5 * time.Minute
+
+// RunOptions are how to run a model
+type RunOptions struct {
+	// ProjectDir is the directory with the model's cog.yaml. It defaults to the current directory, or the nearest
+	// parent directory with a cog.yaml. The project's environment is built, and its code is mounted into the
+	// container, like `cog predict`.
+	ProjectDir string
+	// Image is a model image to run, instead of building the project. It's pulled if it doesn't exist.
+	Image string
+	// GPUs are the GPUs to give the model, in the same format as `docker run --gpus`. It defaults to all GPUs if
+	// the model needs a GPU, or as many as resources.gpu_count asks for.
+	GPUs string
+	// Env are extra environment variables to run the model with, in the form name=value
+	Env []string
+	// Volumes are extra files or directories on the host to mount into the container, in the same form as
+	// `docker run -v`, like "/mnt/datasets:/data:ro". They replace any volumes in cog.yaml with the same destination.
+	Volumes []string
+	// SetupTimeout is how long to wait for the model's setup() to finish
+	SetupTimeout time.Duration
+	// Logs is where to write the model's logs. It defaults to standard error.
+	Logs io.Writer
+	// ContainerCommand is the command that `cog ps` shows started the container. It defaults to "library".
+	ContainerCommand string
+}
+
+// Model is a running model
+type Model struct {
+	// Image is the Docker image the model is running from
+	Image string
+	// Config is the model's cog.yaml
+	Config *config.Config
+
+	predictor *predict.Predictor
+	stopOnce  sync.Once
+	stopErr   error
+}
+
+// Run builds a model, or uses RunOptions.Image, then starts it and waits for its setup() to finish. Stop it with
+// Close. Canceling ctx stops the build, pull or setup() that's in progress. If ctx has a deadline, it's the latest
+// setup() can finish. Once Run returns, the model runs until it's closed, even if ctx is canceled.
+func Run(ctx context.Context, opts RunOptions) (*Model, error) {
+	logs := opts.Logs
+	if logs == nil {
+		logs = os.Stderr
+	}
+	setupTimeout := opts.SetupTimeout
+	if setupTimeout == 0 {
+		setupTimeout = DefaultSetupTimeout
+	}
+	command := opts.ContainerCommand
+	if command == "" {
+		command = "library"
+	}
+
+	m := &Model{}
+	volumes := []docker.Volume{}
+	projectDir := ""
+	if opts.Image == "" {
+		cfg, dir, err := LoadConfig(opts.ProjectDir)
+		if err != nil {
+			return nil, err
+		}
+		projectDir = dir
+		if m.Image, err = image.BuildBase(ctx, cfg, projectDir, "", nil, "plain"); err != nil {
+			return nil, err
+		}
+		m.Config = cfg
+		// Base image doesn't have /src in it, so mount as volume
+		volumes = append(volumes, docker.Volume{Source: projectDir, Destination: "/src"})
+	} else {
+		m.Image = opts.Image
+		exists, err := docker.ImageExists(ctx, m.Image)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to determine if %s exists: %w", m.Image, err)
+		}
+		if !exists {
+			if err := docker.Pull(ctx, m.Image); err != nil {
+				return nil, fmt.Errorf("Failed to pull %s: %w", m.Image, err)
+			}
+		}
+		if m.Config, err = image.GetConfig(ctx, m.Image); err != nil {
+			return nil, err
+		}
+	}
+
+	runOptions := docker.RunOptions{
+		GPUs:     gpus(opts.GPUs, m.Config),
+		Image:    m.Image,
+		Volumes:  volumes,
+		Labels:   map[string]string{docker.ContainerCommandLabel: command},
+		CPUs:     m.Config.Resources.CPUString(),
+		Memory:   m.Config.Resources.MemoryBytes(),
+		ShmSize:  m.Config.Resources.ShmSizeBytes(),
+		Tmpfs:    docker.TmpfsMounts(m.Config.Resources),
+		Devices:  docker.Devices(m.Config),
+		ReadOnly: m.Config.StateDir() != "",
+	}
+	mounts, err := image.RuntimeVolumes(ctx, m.Config, m.Image, projectDir, opts.Volumes)
+	if err != nil {
+		return nil, err
+	}
+	for _, volume := range mounts {
+		runOptions.Volumes = append(runOptions.Volumes, docker.Volume{Source: volume.Source, Destination: volume.Destination, ReadOnly: volume.ReadOnly})
+	}
+	if projectDir != "" {
+		runOptions.Labels[docker.ContainerProjectLabel] = projectDir
+	}
+	runOptions.Env = append(runOptions.Env, m.Config.RuntimeEnv()...)
+	runOptions.Env = append(runOptions.Env, opts.Env...)
+	for _, secret := range m.Config.Secrets {
+		value, err := secret.Resolve()
+		if err != nil {
+			return nil, err
+		}
+		runOptions.SecretEnv = append(runOptions.SecretEnv, secret.Name+"="+value)
+	}
+
+	token := ""
+	if m.Config.Serve.AuthType() == config.AuthTypeAPIKey {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("Failed to generate API key: %w", err)
+		}
+		token = hex.EncodeToString(b)
+		runOptions.Env = append(runOptions.Env, "COG_API_KEYS="+token)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		setupTimeout = min(setupTimeout, time.Until(deadline))
+	}
+	predictor := predict.NewPredictor(runOptions, false, false)
+	predictor.SetToken(token)
+	m.predictor = &predictor
+	if err := m.predictor.Start(ctx, logs, setupTimeout); err != nil {
+		_ = m.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// Predict runs a prediction. The input is sent to the model as it is, like the input in the prediction API, so
+// numbers are numbers and files are URLs or data URLs. Use File to pass a local file.
+func (m *Model) Predict(ctx context.Context, input map[string]any) (*predict.Response, error) {
+	return m.predictor.PredictInput(ctx, input)
+}
+
+// Schema returns the model's OpenAPI schema
+func (m *Model) Schema() (*openapi3.T, error) {
+	return m.predictor.GetSchema()
+}
+
+// URL returns the URL of the model's HTTP API, to make requests to it directly
+func (m *Model) URL() string {
+	return "http://localhost:" + strconv.Itoa(m.predictor.Port())
+}
+
+// Close stops the model. It's safe to call more than once.
+func (m *Model) Close() error {
+	m.stopOnce.Do(func() {
+		m.stopErr = m.predictor.Stop(context.Background())
+	})
+	return m.stopErr
+}
+
+// File returns a local file as a data URL, to pass as an input to Model.Predict
+func File(path string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return dataurl.New(contents, mime.TypeByExtension(filepath.Ext(path))).String(), nil
+}
+
+// gpus returns the GPUs to request from Docker for a model, like `cog predict`
+func gpus(requested string, cfg *config.Config) string {
+	if requested != "" {
+		return requested
+	}
+	if !cfg.Build.GPU {
+		return ""
+	}
+	if cfg.Resources != nil && cfg.Resources.GPUCount > 0 {
+		return strconv.Itoa(cfg.Resources.GPUCount)
+	}
+	return "all"
+}
@@ -0,0 +1,100 @@
+package cog
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/provenance"
+	"github.com/replicate/cog/pkg/registry"
+)
+
+// CheckPushable checks an image can be pushed. For Replicate, the model must have been created on replicate.com first.
+func CheckPushable(ctx context.Context, imageName string) error {
+	if isReplicateImage(imageName) {
+		err := docker.ManifestInspect(ctx, imageName)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && strings.Contains(err.Error(), `"code":"NAME_UNKNOWN"`) {
+			return fmt.Errorf("Unable to find Replicate existing model for %s. Go to replicate.com and create a new model before pushing.", imageName)
+		}
+	}
+	return nil
+}
+
+// PushOptions are how to push an image
+type PushOptions struct {
+	// Chunked uploads the image's layers in chunks that are retried if they fail, rather than pushing it with
+	// `docker push`. Resume, Jobs and BandwidthLimit imply it.
+	Chunked bool
+	// Resume carries on uploading layers from where an earlier chunked push that was interrupted got to
+	Resume bool
+	// Jobs is how many layers to upload at once in a chunked push. It defaults to registry.DefaultJobs.
+	Jobs int
+	// BandwidthLimit is the most bytes per second a chunked push uploads, or 0 for no limit
+	BandwidthLimit int64
+}
+
+// IsChunked returns whether the push uploads layers in chunks, rather than using `docker push`
+func (o PushOptions) IsChunked() bool {
+	return o.Chunked || o.Resume || o.Jobs > 0 || o.BandwidthLimit > 0
+}
+
+// Push pushes an image built by Build to its registry, with `docker push` unless opts asks for a chunked push
+func Push(ctx context.Context, imageName string, opts PushOptions) error {
+	var err error
+	if opts.IsChunked() {
+		err = registry.Push(ctx, imageName, registry.PushOptions{Resume: opts.Resume, Jobs: opts.Jobs, BandwidthLimit: opts.BandwidthLimit})
+	} else {
+		err = docker.Push(ctx, imageName)
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "NAME_UNKNOWN") {
+			return fmt.Errorf("Unable to find existing Replicate model for %s. "+
+				"Go to replicate.com and create a new model before pushing."+
+				"\n\n"+
+				"If the model already exists, you may be getting this error "+
+				"because you're not logged in as owner of the model. "+
+				"This can happen if you did `sudo cog login` instead of `cog login` "+
+				"or `sudo cog push` instead of `cog push`, "+
+				"which causes Docker to use the wrong Docker credentials.",
+				imageName)
+		}
+		return fmt.Errorf("Failed to push image: %w", err)
+	}
+	return nil
+}
+
+// PushProvenance attaches the provenance cog build recorded in an image to the image in its registry, so it can be
+// checked with 'cog verify --provenance'. It returns the provenance artifact's reference, or "" if the image has no
+// provenance because it wasn't built by this version of Cog.
+func PushProvenance(ctx context.Context, imageName string) (string, error) {
+	inspect, err := docker.ImageInspect(ctx, imageName)
+	if err != nil {
+		return "", fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	label, ok := inspect.Config.Labels[provenance.Label]
+	if !ok {
+		return "", nil
+	}
+	predicate, err := provenance.ParsePredicate(label)
+	if err != nil {
+		return "", err
+	}
+	return provenance.Push(ctx, imageName, *predicate)
+}
+
+// ReplicateModelURL returns the URL of the page for a model pushed to Replicate, or "" if it isn't a Replicate image
+func ReplicateModelURL(imageName string) string {
+	if !isReplicateImage(imageName) {
+		return ""
+	}
+	return fmt.Sprintf("https://%s", strings.Replace(imageName, global.ReplicateRegistryHost, global.ReplicateWebsiteHost, 1))
+}
+
+func isReplicateImage(imageName string) bool {
+	return strings.HasPrefix(imageName, global.ReplicateRegistryHost+"/")
+}
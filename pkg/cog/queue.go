@@ -0,0 +1,287 @@
+package cog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+// BuildQueue builds models for a service that builds them on request. A request that's the same as a build that's
+// queued or running, with the same files in the build context, the same config and the same options, gets that
+// build rather than starting another. Builds of each project are queued, so only a set number of them run at the
+// same time, but builds of different projects don't wait for each other.
+type BuildQueue struct {
+	ctx         context.Context
+	concurrency int
+	// build builds a model, and writes Docker's output to output. It's buildWithOutput, except in tests.
+	build func(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error)
+
+	mu sync.Mutex
+	// builds are the builds that are queued or running, by key
+	builds map[string]*QueuedBuild
+	// projects are the slots for running builds of each project that has builds queued or running, by
+	// BuildOptions.Project, or the project directory if it isn't set
+	projects map[string]*projectSlots
+}
+
+// projectSlots are the slots for running builds of a project
+type projectSlots struct {
+	slots chan struct{}
+	// builds is how many builds of the project are queued or running. The slots are deleted when it gets to zero, so
+	// a long-running service doesn't keep them for every project it has ever built.
+	builds int
+}
+
+// NewBuildQueue returns a queue that runs up to concurrency builds of each project at the same time, or one if
+// concurrency is less than one. The builds are canceled when ctx is done.
+func NewBuildQueue(ctx context.Context, concurrency int) *BuildQueue {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &BuildQueue{
+		ctx:         ctx,
+		concurrency: concurrency,
+		build:       buildWithOutput,
+		builds:      map[string]*QueuedBuild{},
+		projects:    map[string]*projectSlots{},
+	}
+}
+
+// Build queues a build of the model in dir, or the nearest parent directory with a cog.yaml if dir is empty. If
+// the same build is already queued or running, it returns that build, and deduplicated is true.
+//
+// Working out whether it's the same build reads every file in the build context, like Docker does when it builds.
+func (q *BuildQueue) Build(dir string, opts BuildOptions) (build *QueuedBuild, deduplicated bool, err error) {
+	cfg, projectDir, err := loadConfig(dir, opts.BuildArgs)
+	if err != nil {
+		return nil, false, err
+	}
+	key, err := buildKey(cfg, projectDir, opts)
+	if err != nil {
+		return nil, false, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if build, ok := q.builds[key]; ok {
+		return build, true, nil
+	}
+	projectKey := opts.Project
+	if projectKey == "" {
+		projectKey = projectDir
+	}
+	project, ok := q.projects[projectKey]
+	if !ok {
+		project = &projectSlots{slots: make(chan struct{}, q.concurrency)}
+		q.projects[projectKey] = project
+	}
+	project.builds++
+	slots := project.slots
+	ctx, cancel := context.WithCancel(q.ctx)
+	build = &QueuedBuild{
+		Key:     key,
+		Dir:     projectDir,
+		project: projectKey,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		updated: make(chan struct{}),
+	}
+	q.builds[key] = build
+
+	go func() {
+		defer build.finish()
+		defer cancel()
+		// It's removed before it finishes, so requests from then on start a build of their own, rather than getting
+		// one that has finished
+		defer q.remove(build)
+
+		select {
+		case slots <- struct{}{}:
+		default:
+			fmt.Fprintf(build.logWriter(), "Waiting for %d other builds of %s to finish...\n", q.concurrency, projectKey)
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				build.err = ctx.Err()
+				return
+			}
+		}
+		defer func() { <-slots }()
+		build.image, build.err = q.build(ctx, projectDir, opts, build.logWriter())
+	}()
+	return build, false, nil
+}
+
+func buildWithOutput(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error) {
+	return Build(docker.WithBuildOutput(ctx, output), dir, opts)
+}
+
+func (q *BuildQueue) remove(build *QueuedBuild) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.builds[build.Key] == build {
+		delete(q.builds, build.Key)
+	}
+	if project := q.projects[build.project]; project != nil {
+		project.builds--
+		if project.builds == 0 {
+			delete(q.projects, build.project)
+		}
+	}
+}
+
+// QueuedBuild is a build in a BuildQueue
+type QueuedBuild struct {
+	// Key identifies the build's context, config and options. Requests with the same key share a build.
+	Key string
+	// Dir is the absolute path of the project
+	Dir string
+
+	// project is the key of the project's slots in the queue
+	project string
+	cancel  context.CancelFunc
+	done    chan struct{}
+	image   string
+	err     error
+
+	mu  sync.Mutex
+	log []byte
+	// updated is closed, and replaced, when the log is written to or the build finishes
+	updated chan struct{}
+}
+
+// Done returns a channel that's closed when the build finishes
+func (b *QueuedBuild) Done() <-chan struct{} {
+	return b.done
+}
+
+// Wait waits for the build to finish, and returns the name of the image it built. If ctx is done first, it stops
+// waiting, but the build carries on for anyone else waiting for it.
+func (b *QueuedBuild) Wait(ctx context.Context) (string, error) {
+	select {
+	case <-b.done:
+		return b.image, b.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Cancel cancels the build, for everyone waiting for it
+func (b *QueuedBuild) Cancel() {
+	b.cancel()
+}
+
+// Logs returns a reader of Docker's output from the build. It reads what has been written so far, then follows
+// what's written until the build finishes, so clients can attach to a build that's running. Close it to stop
+// following.
+func (b *QueuedBuild) Logs() io.ReadCloser {
+	return &buildLogReader{build: b, closed: make(chan struct{})}
+}
+
+func (b *QueuedBuild) logWriter() io.Writer {
+	return buildLogWriter{b}
+}
+
+func (b *QueuedBuild) write(p []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.log = append(b.log, p...)
+	close(b.updated)
+	b.updated = make(chan struct{})
+}
+
+func (b *QueuedBuild) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	close(b.done)
+	close(b.updated)
+	b.updated = make(chan struct{})
+}
+
+type buildLogWriter struct {
+	build *QueuedBuild
+}
+
+func (w buildLogWriter) Write(p []byte) (int, error) {
+	w.build.write(p)
+	return len(p), nil
+}
+
+type buildLogReader struct {
+	build     *QueuedBuild
+	offset    int
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *buildLogReader) Read(p []byte) (int, error) {
+	for {
+		r.build.mu.Lock()
+		if r.offset < len(r.build.log) {
+			n := copy(p, r.build.log[r.offset:])
+			r.offset += n
+			r.build.mu.Unlock()
+			return n, nil
+		}
+		updated := r.build.updated
+		r.build.mu.Unlock()
+
+		select {
+		case <-r.build.done:
+			// Read anything that was written just before it finished
+			r.build.mu.Lock()
+			finished := r.offset >= len(r.build.log)
+			r.build.mu.Unlock()
+			if finished {
+				return 0, io.EOF
+			}
+		case <-r.closed:
+			return 0, io.EOF
+		case <-updated:
+		}
+	}
+}
+
+func (r *buildLogReader) Close() error {
+	r.closeOnce.Do(func() { close(r.closed) })
+	return nil
+}
+
+// buildKey returns the key of a build of the project in projectDir with opts, which is a hash of the files in its
+// build context, its config, and the options
+func buildKey(cfg *config.Config, projectDir string, opts BuildOptions) (string, error) {
+	hash := sha256.New()
+	_, err := dockerfile.WalkBuildContext(projectDir, func(rel string, info fs.FileInfo) error {
+		fmt.Fprintf(hash, "%s\x00%o\x00%d\x00", rel, info.Mode(), info.Size())
+		f, err := os.Open(filepath.Join(projectDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(hash, f)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the build context: %w", err)
+	}
+	for _, v := range []any{cfg, opts} {
+		contents, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		hash.Write(contents)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
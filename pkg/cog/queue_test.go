@@ -0,0 +1,156 @@
+package cog
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeProject writes a project with a cog.yaml to a directory, and returns it
+func writeProject(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_version: \"3.12\"\npredict: predict.py:Predictor\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("class Predictor: pass\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte("*.log\n"), 0o644))
+	return dir
+}
+
+// blockingBuild returns a build function that writes to the build's output, then waits for release to be closed
+func blockingBuild(builds *atomic.Int32, release chan struct{}) func(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error) {
+	return func(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error) {
+		builds.Add(1)
+		_, _ = output.Write([]byte("#1 building\n"))
+		select {
+		case <-release:
+			return "image-" + opts.Tag, nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+}
+
+func TestBuildQueueDeduplicates(t *testing.T) {
+	dir := writeProject(t)
+	var builds atomic.Int32
+	release := make(chan struct{})
+	q := NewBuildQueue(context.Background(), 1)
+	q.build = blockingBuild(&builds, release)
+
+	first, deduplicated, err := q.Build(dir, BuildOptions{Tag: "a"})
+	require.NoError(t, err)
+	require.False(t, deduplicated)
+
+	// Files the .dockerignore excludes aren't part of the build
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "debug.log"), []byte("changed"), 0o644))
+	second, deduplicated, err := q.Build(dir, BuildOptions{Tag: "a"})
+	require.NoError(t, err)
+	require.True(t, deduplicated)
+	require.Same(t, first, second)
+
+	// Different options, or a different file in the context, are a different build
+	other, deduplicated, err := q.Build(dir, BuildOptions{Tag: "b"})
+	require.NoError(t, err)
+	require.False(t, deduplicated)
+	require.NotEqual(t, first.Key, other.Key)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte("class Predictor: pass  # changed\n"), 0o644))
+	changed, _, err := q.Build(dir, BuildOptions{Tag: "a"})
+	require.NoError(t, err)
+	require.NotEqual(t, first.Key, changed.Key)
+
+	close(release)
+	image, err := first.Wait(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "image-a", image)
+	for _, build := range []*QueuedBuild{other, changed} {
+		_, err := build.Wait(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, int32(3), builds.Load())
+
+	// Once it has finished, the same request starts a new build
+	again, deduplicated, err := q.Build(dir, BuildOptions{Tag: "b"})
+	require.NoError(t, err)
+	require.False(t, deduplicated)
+	_, err = again.Wait(context.Background())
+	require.NoError(t, err)
+}
+
+func TestBuildQueueChecksBuildArgs(t *testing.T) {
+	dir := writeProject(t)
+	var builds atomic.Int32
+	q := NewBuildQueue(context.Background(), 1)
+	q.build = blockingBuild(&builds, make(chan struct{}))
+
+	_, _, err := q.Build(dir, BuildOptions{BuildArgs: []string{"PIP_INDEX_URL=https://mirror/simple"}})
+	require.ErrorContains(t, err, "Build arg PIP_INDEX_URL passed with --build-arg isn't in build.args")
+	require.Zero(t, builds.Load())
+}
+
+func TestBuildQueueConcurrency(t *testing.T) {
+	dir := writeProject(t)
+	var builds atomic.Int32
+	release := make(chan struct{})
+	q := NewBuildQueue(context.Background(), 1)
+	q.build = blockingBuild(&builds, release)
+
+	first, _, err := q.Build(dir, BuildOptions{Tag: "a"})
+	require.NoError(t, err)
+	second, _, err := q.Build(dir, BuildOptions{Tag: "b"})
+	require.NoError(t, err)
+
+	// Only one build of the project runs at a time
+	require.Eventually(t, func() bool { return builds.Load() == 1 }, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(1), builds.Load())
+
+	// Builds of other projects don't wait for it
+	otherProject, _, err := q.Build(writeProject(t), BuildOptions{Tag: "c"})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return builds.Load() == 2 }, time.Second, 10*time.Millisecond)
+
+	second.Cancel()
+	_, err = second.Wait(context.Background())
+	require.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	for _, build := range []*QueuedBuild{first, otherProject} {
+		_, err := build.Wait(context.Background())
+		require.NoError(t, err)
+	}
+
+	// The projects' slots are deleted once they have no builds
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	require.Empty(t, q.projects)
+	require.Empty(t, q.builds)
+}
+
+func TestBuildQueueLogs(t *testing.T) {
+	dir := writeProject(t)
+	var builds atomic.Int32
+	release := make(chan struct{})
+	q := NewBuildQueue(context.Background(), 1)
+	q.build = blockingBuild(&builds, release)
+
+	build, _, err := q.Build(dir, BuildOptions{})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return builds.Load() == 1 }, time.Second, 10*time.Millisecond)
+
+	// A client that attaches while it's running reads what was written before, then follows it until it finishes
+	logs := build.Logs()
+	defer logs.Close()
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(release)
+	}()
+	contents, err := io.ReadAll(logs)
+	require.NoError(t, err)
+	require.Equal(t, "#1 building\n", string(contents))
+}
@@ -0,0 +1,364 @@
+package cog
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// maxWebhookPayload is the largest webhook payload that's read. GitHub's are at most 25MB.
+const maxWebhookPayload = 25 * 1024 * 1024
+
+// statusContext is the name builds' statuses have on commits
+const statusContext = "cog"
+
+// The providers that webhooks come from
+const (
+	ProviderGitHub = "github"
+	ProviderGitLab = "gitlab"
+)
+
+// Webhook builds models when commits are pushed to GitHub or GitLab repositories. It's an http.Handler for push
+// webhooks: point the repositories' webhooks at it, with the same secret. It builds with a BuildQueue, so pushes of
+// the same commit share a build, and reports whether the build succeeded on the commit.
+type Webhook struct {
+	// Queue builds the models
+	Queue *BuildQueue
+	// Repositories are the repositories to build, by their full name, like "alice/hotdog-detector". Pushes to other
+	// repositories are ignored.
+	Repositories map[string]WebhookRepository
+	// Secret is the webhook's secret. GitHub signs payloads with it, and GitLab sends it in the X-Gitlab-Token
+	// header. Requests without it are rejected.
+	Secret string
+	// WorkDir is where commits are checked out to build. Each build has a directory of its own in it, which is
+	// removed when it finishes.
+	WorkDir string
+	// GitHubToken and GitLabToken are tokens that can set commit statuses, to report whether builds succeeded. If
+	// a provider's token is empty, statuses aren't reported to it.
+	GitHubToken string
+	GitLabToken string
+	// GitHubAPIURL and GitLabAPIURL are the URLs of the providers' APIs, for GitHub Enterprise or self-managed
+	// GitLab. They default to https://api.github.com and https://gitlab.com/api/v4.
+	GitHubAPIURL string
+	GitLabAPIURL string
+	// OnBuild is called when a push has been built, with the name of the image, or the error it failed with, like
+	// failing to check out the commit, build it, push it, or report its status. It's called from a goroutine of its
+	// own, so the webhook can log builds or send them on.
+	OnBuild func(event *PushEvent, imageName string, err error)
+
+	// checkout checks out a commit of a repository to dir. It's checkoutCommit, except in tests.
+	checkout func(ctx context.Context, cloneURL string, commit string, dir string) error
+}
+
+// WebhookRepository is how to build a repository that a Webhook builds
+type WebhookRepository struct {
+	// Branches are the branches to build. If there aren't any, the repository's default branch is built.
+	Branches []string
+	// Dir is the directory of the model in the repository, if it isn't at the root
+	Dir string
+	// Build is how to build the model. Its Project defaults to the repository, so the queue's limit on builds of each
+	// project applies to all the commits pushed to it.
+	Build BuildOptions
+	// Push pushes the image when it's built, to deploy it
+	Push bool
+}
+
+// PushEvent is a push of a commit to a repository, from a webhook
+type PushEvent struct {
+	Provider   string
+	Repository string
+	// ProjectID is GitLab's ID of the repository
+	ProjectID     int
+	CloneURL      string
+	Branch        string
+	DefaultBranch string
+	// Commit is the commit the branch points to, or "" if the branch was deleted
+	Commit string
+}
+
+// ServeHTTP handles a webhook. It responds once the push is queued to be built, without waiting for the build.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxWebhookPayload))
+	if err != nil {
+		http.Error(rw, "Failed to read payload", http.StatusBadRequest)
+		return
+	}
+
+	var event *PushEvent
+	switch {
+	case req.Header.Get("X-GitHub-Event") != "":
+		if !validGitHubSignature(body, req.Header.Get("X-Hub-Signature-256"), w.Secret) {
+			http.Error(rw, "Invalid signature", http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("X-GitHub-Event") != "push" {
+			// Like the ping that's sent when the webhook is created
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		event, err = parseGitHubPush(body)
+	case req.Header.Get("X-Gitlab-Event") != "":
+		if w.Secret == "" || subtle.ConstantTimeCompare([]byte(req.Header.Get("X-Gitlab-Token")), []byte(w.Secret)) != 1 {
+			http.Error(rw, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("X-Gitlab-Event") != "Push Hook" {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		event, err = parseGitLabPush(body)
+	default:
+		http.Error(rw, "Not a GitHub or GitLab webhook", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo, ok := w.Repositories[event.Repository]
+	if !ok || event.Commit == "" || !repo.builds(event) {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+	go func() {
+		imageName, err := w.build(event, repo)
+		if w.OnBuild != nil {
+			w.OnBuild(event, imageName, err)
+		}
+	}()
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// builds returns whether pushes to the push's branch are built
+func (r WebhookRepository) builds(event *PushEvent) bool {
+	if len(r.Branches) == 0 {
+		return event.Branch == event.DefaultBranch
+	}
+	return slices.Contains(r.Branches, event.Branch)
+}
+
+// build checks out the pushed commit, builds it, and pushes it if the repository is deployed, reporting its status
+// on the commit as it goes. It returns the name of the image.
+func (w *Webhook) build(event *PushEvent, repo WebhookRepository) (string, error) {
+	ctx := w.Queue.ctx
+	var statusErrs []error
+	report := func(state string, description string) {
+		if err := w.reportStatus(ctx, event, state, description); err != nil {
+			statusErrs = append(statusErrs, fmt.Errorf("Failed to report the status of %s at %s: %w", event.Repository, event.Commit, err))
+		}
+	}
+	fail := func(err error) (string, error) {
+		report(statusFailure, err.Error())
+		return "", errors.Join(append([]error{fmt.Errorf("Failed to build %s at %s: %w", event.Repository, event.Commit, err)}, statusErrs...)...)
+	}
+	report(statusPending, "Building")
+
+	if err := os.MkdirAll(w.WorkDir, 0o755); err != nil {
+		return fail(fmt.Errorf("Failed to create work directory: %w", err))
+	}
+	checkoutDir, err := os.MkdirTemp(w.WorkDir, "checkout-")
+	if err != nil {
+		return fail(fmt.Errorf("Failed to create work directory: %w", err))
+	}
+	defer os.RemoveAll(checkoutDir)
+	checkout := w.checkout
+	if checkout == nil {
+		checkout = checkoutCommit
+	}
+	if err := checkout(ctx, event.CloneURL, event.Commit, checkoutDir); err != nil {
+		return fail(fmt.Errorf("Failed to check out the commit: %w", err))
+	}
+
+	opts := repo.Build
+	if opts.Project == "" {
+		opts.Project = event.Provider + ":" + event.Repository
+	}
+	build, _, err := w.Queue.Build(filepath.Join(checkoutDir, filepath.FromSlash(repo.Dir)), opts)
+	if err != nil {
+		return fail(err)
+	}
+	imageName, err := build.Wait(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	if repo.Push {
+		report(statusPending, "Pushing "+imageName)
+		if err := Push(ctx, imageName, PushOptions{}); err != nil {
+			return fail(err)
+		}
+		report(statusSuccess, "Built and pushed "+imageName)
+	} else {
+		report(statusSuccess, "Built "+imageName)
+	}
+	return imageName, errors.Join(statusErrs...)
+}
+
+// checkoutCommit checks out a commit of a repository to dir, without its history. Private repositories need git to
+// have credentials for them, like from a credential helper.
+func checkoutCommit(ctx context.Context, cloneURL string, commit string, dir string) error {
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"fetch", "--quiet", "--depth", "1", cloneURL, commit},
+		{"checkout", "--quiet", "FETCH_HEAD"},
+	} {
+		cmd := exec.CommandContext(ctx, "git", args...)
+		cmd.Dir = dir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("git %s failed: %w\n%s", args[0], err, output)
+		}
+	}
+	return nil
+}
+
+// The states of commit statuses. GitLab calls failure "failed".
+const (
+	statusPending = "pending"
+	statusSuccess = "success"
+	statusFailure = "failure"
+)
+
+// reportStatus sets the status of the pushed commit, if there's a token for its provider
+func (w *Webhook) reportStatus(ctx context.Context, event *PushEvent, state string, description string) error {
+	// Both providers limit the length of descriptions
+	if len(description) > 140 {
+		description = description[:137] + "..."
+	}
+	var req *http.Request
+	var err error
+	switch event.Provider {
+	case ProviderGitHub:
+		if w.GitHubToken == "" {
+			return nil
+		}
+		apiURL := w.GitHubAPIURL
+		if apiURL == "" {
+			apiURL = "https://api.github.com"
+		}
+		body, marshalErr := json.Marshal(map[string]string{"state": state, "description": description, "context": statusContext})
+		if marshalErr != nil {
+			return marshalErr
+		}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/repos/%s/statuses/%s", strings.TrimSuffix(apiURL, "/"), event.Repository, event.Commit), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+w.GitHubToken)
+		req.Header.Set("Accept", "application/vnd.github+json")
+		req.Header.Set("Content-Type", "application/json")
+	case ProviderGitLab:
+		if w.GitLabToken == "" {
+			return nil
+		}
+		apiURL := w.GitLabAPIURL
+		if apiURL == "" {
+			apiURL = "https://gitlab.com/api/v4"
+		}
+		if state == statusFailure {
+			state = "failed"
+		}
+		query := url.Values{"state": {state}, "name": {statusContext}, "description": {description}}
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%d/statuses/%s?%s", strings.TrimSuffix(apiURL, "/"), event.ProjectID, event.Commit, query.Encode()), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("PRIVATE-TOKEN", w.GitLabToken)
+	default:
+		return nil
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %s", req.URL.Host, resp.Status)
+	}
+	return nil
+}
+
+// validGitHubSignature returns whether signature, from the X-Hub-Signature-256 header, is the signature of body
+// with secret
+func validGitHubSignature(body []byte, signature string, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+func parseGitHubPush(body []byte) (*PushEvent, error) {
+	var payload struct {
+		Ref     string `json:"ref"`
+		After   string `json:"after"`
+		Deleted bool   `json:"deleted"`
+		Repo    struct {
+			FullName      string `json:"full_name"`
+			CloneURL      string `json:"clone_url"`
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("Invalid push payload: %w", err)
+	}
+	event := &PushEvent{
+		Provider:      ProviderGitHub,
+		Repository:    payload.Repo.FullName,
+		CloneURL:      payload.Repo.CloneURL,
+		Branch:        strings.TrimPrefix(payload.Ref, "refs/heads/"),
+		DefaultBranch: payload.Repo.DefaultBranch,
+	}
+	if !payload.Deleted && strings.HasPrefix(payload.Ref, "refs/heads/") {
+		event.Commit = payload.After
+	}
+	return event, nil
+}
+
+func parseGitLabPush(body []byte) (*PushEvent, error) {
+	var payload struct {
+		Ref         string `json:"ref"`
+		CheckoutSHA string `json:"checkout_sha"`
+		Project     struct {
+			ID                int    `json:"id"`
+			PathWithNamespace string `json:"path_with_namespace"`
+			GitHTTPURL        string `json:"git_http_url"`
+			DefaultBranch     string `json:"default_branch"`
+		} `json:"project"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, fmt.Errorf("Invalid push payload: %w", err)
+	}
+	event := &PushEvent{
+		Provider:      ProviderGitLab,
+		Repository:    payload.Project.PathWithNamespace,
+		ProjectID:     payload.Project.ID,
+		CloneURL:      payload.Project.GitHTTPURL,
+		Branch:        strings.TrimPrefix(payload.Ref, "refs/heads/"),
+		DefaultBranch: payload.Project.DefaultBranch,
+	}
+	// checkout_sha is null when the branch is deleted
+	if strings.HasPrefix(payload.Ref, "refs/heads/") {
+		event.Commit = payload.CheckoutSHA
+	}
+	return event, nil
+}
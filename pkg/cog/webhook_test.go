@@ -0,0 +1,231 @@
+package cog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const githubPushPayload = `{
+  "ref": "refs/heads/main",
+  "after": "abc123",
+  "deleted": false,
+  "repository": {"full_name": "alice/hotdog-detector", "clone_url": "https://github.com/alice/hotdog-detector.git", "default_branch": "main"}
+}`
+
+func signGitHub(body string, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// statusServer records the commit statuses reported to it
+type statusServer struct {
+	mu       sync.Mutex
+	statuses []map[string]string
+}
+
+func (s *statusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := map[string]string{"path": r.URL.Path}
+	if r.Header.Get("Authorization") != "" {
+		_ = json.NewDecoder(r.Body).Decode(&status)
+	} else {
+		status["state"] = r.URL.Query().Get("state")
+		status["token"] = r.Header.Get("PRIVATE-TOKEN")
+	}
+	s.statuses = append(s.statuses, status)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *statusServer) states() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := []string{}
+	for _, status := range s.statuses {
+		states = append(states, status["state"])
+	}
+	return states
+}
+
+// newTestWebhook returns a webhook that checks out a project with a cog.yaml, and builds it with build
+func newTestWebhook(t *testing.T, statuses *statusServer, build func(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error)) *Webhook {
+	t.Helper()
+	queue := NewBuildQueue(context.Background(), 1)
+	queue.build = build
+	api := httptest.NewServer(statuses)
+	t.Cleanup(api.Close)
+	return &Webhook{
+		Queue:        queue,
+		Repositories: map[string]WebhookRepository{"alice/hotdog-detector": {Build: BuildOptions{Tag: "hotdog-detector"}}},
+		Secret:       "s3cret",
+		WorkDir:      t.TempDir(),
+		GitHubToken:  "github-token",
+		GitLabToken:  "gitlab-token",
+		GitHubAPIURL: api.URL,
+		GitLabAPIURL: api.URL,
+		checkout: func(ctx context.Context, cloneURL string, commit string, dir string) error {
+			return os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_version: \"3.12\"\npredict: predict.py:Predictor\n"), 0o644)
+		},
+	}
+}
+
+func TestWebhookGitHub(t *testing.T) {
+	statuses := &statusServer{}
+	webhook := newTestWebhook(t, statuses, func(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error) {
+		return opts.Tag, nil
+	})
+	type result struct {
+		imageName string
+		err       error
+	}
+	built := make(chan result, 1)
+	webhook.OnBuild = func(event *PushEvent, imageName string, err error) {
+		built <- result{imageName, err}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(githubPushPayload))
+	req.Header.Set("X-GitHub-Event", "push")
+	req.Header.Set("X-Hub-Signature-256", signGitHub(githubPushPayload, "s3cret"))
+	rec := httptest.NewRecorder()
+	webhook.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	require.Eventually(t, func() bool { return len(statuses.states()) == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"pending", "success"}, statuses.states())
+	require.Equal(t, "/repos/alice/hotdog-detector/statuses/abc123", statuses.statuses[1]["path"])
+	require.Equal(t, "cog", statuses.statuses[1]["context"])
+	require.Equal(t, "Built hotdog-detector", statuses.statuses[1]["description"])
+	require.Equal(t, result{"hotdog-detector", nil}, <-built)
+
+	// The checkout is removed once it's built
+	require.Eventually(t, func() bool {
+		entries, err := os.ReadDir(webhook.WorkDir)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWebhookGitLabFailure(t *testing.T) {
+	statuses := &statusServer{}
+	webhook := newTestWebhook(t, statuses, func(ctx context.Context, dir string, opts BuildOptions, output io.Writer) (string, error) {
+		return "", io.ErrUnexpectedEOF
+	})
+	built := make(chan error, 1)
+	webhook.OnBuild = func(event *PushEvent, imageName string, err error) {
+		built <- err
+	}
+
+	payload := `{
+  "object_kind": "push",
+  "ref": "refs/heads/main",
+  "checkout_sha": "def456",
+  "project": {"id": 42, "path_with_namespace": "alice/hotdog-detector", "git_http_url": "https://gitlab.com/alice/hotdog-detector.git", "default_branch": "main"}
+}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+	req.Header.Set("X-Gitlab-Event", "Push Hook")
+	req.Header.Set("X-Gitlab-Token", "s3cret")
+	rec := httptest.NewRecorder()
+	webhook.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+
+	require.Eventually(t, func() bool { return len(statuses.states()) == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"pending", "failed"}, statuses.states())
+	require.Equal(t, "/projects/42/statuses/def456", statuses.statuses[1]["path"])
+	require.Equal(t, "gitlab-token", statuses.statuses[1]["token"])
+	err := <-built
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.ErrorContains(t, err, "Failed to build alice/hotdog-detector at def456")
+}
+
+func TestWebhookLimitsBuildsOfEachRepository(t *testing.T) {
+	var builds atomic.Int32
+	release := make(chan struct{})
+	webhook := newTestWebhook(t, &statusServer{}, blockingBuild(&builds, release))
+	webhook.checkout = func(ctx context.Context, cloneURL string, commit string, dir string) error {
+		// Each commit has a different build context, so they aren't the same build
+		if err := os.WriteFile(filepath.Join(dir, "predict.py"), []byte("# "+commit+"\n"), 0o644); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "cog.yaml"), []byte("build:\n  python_version: \"3.12\"\npredict: predict.py:Predictor\n"), 0o644)
+	}
+	built := make(chan error, 2)
+	webhook.OnBuild = func(event *PushEvent, imageName string, err error) {
+		built <- err
+	}
+
+	for _, commit := range []string{"abc123", "def456"} {
+		payload := strings.Replace(githubPushPayload, "abc123", commit, 1)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload))
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", signGitHub(payload, "s3cret"))
+		rec := httptest.NewRecorder()
+		webhook.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusAccepted, rec.Code)
+	}
+
+	// The commits are checked out to different directories, but they're builds of the same repository, so only one
+	// of them runs at a time
+	require.Eventually(t, func() bool { return builds.Load() == 1 }, time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		webhook.Queue.mu.Lock()
+		defer webhook.Queue.mu.Unlock()
+		project := webhook.Queue.projects["github:alice/hotdog-detector"]
+		return len(webhook.Queue.projects) == 1 && project != nil && project.builds == 2
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int32(1), builds.Load())
+
+	close(release)
+	require.NoError(t, <-built)
+	require.NoError(t, <-built)
+	require.Equal(t, int32(2), builds.Load())
+}
+
+func TestWebhookIgnored(t *testing.T) {
+	webhook := newTestWebhook(t, &statusServer{}, nil)
+	for _, tt := range []struct {
+		name     string
+		event    string
+		payload  string
+		secret   string
+		expected int
+	}{
+		{"wrong secret", "push", githubPushPayload, "wrong", http.StatusUnauthorized},
+		{"ping", "ping", `{"zen": "Keep it logically awesome."}`, "s3cret", http.StatusNoContent},
+		{"other branch", "push", strings.Replace(githubPushPayload, "refs/heads/main", "refs/heads/feature", 1), "s3cret", http.StatusNoContent},
+		{"tag", "push", strings.Replace(githubPushPayload, "refs/heads/main", "refs/tags/v1", 1), "s3cret", http.StatusNoContent},
+		{"deleted branch", "push", strings.Replace(githubPushPayload, `"deleted": false`, `"deleted": true`, 1), "s3cret", http.StatusNoContent},
+		{"other repository", "push", strings.Replace(githubPushPayload, "alice/hotdog-detector", "bob/other", 1), "s3cret", http.StatusNoContent},
+		{"invalid payload", "push", "not json", "s3cret", http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.payload))
+			req.Header.Set("X-GitHub-Event", tt.event)
+			req.Header.Set("X-Hub-Signature-256", signGitHub(tt.payload, tt.secret))
+			rec := httptest.NewRecorder()
+			webhook.ServeHTTP(rec, req)
+			require.Equal(t, tt.expected, rec.Code)
+		})
+	}
+}
+
+func TestWebhookRepositoryBranches(t *testing.T) {
+	event := &PushEvent{Branch: "release", DefaultBranch: "main"}
+	require.False(t, WebhookRepository{}.builds(event))
+	require.True(t, WebhookRepository{Branches: []string{"main", "release"}}.builds(event))
+}
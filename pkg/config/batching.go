@@ -0,0 +1,20 @@
+package config
+
+import "fmt"
+
+// Batching configures the model server to coalesce concurrent predictions into calls to the predictor's
+// predict_batch() method, which runs the model on a list of inputs at once
+type Batching struct {
+	MaxBatchSize int     `json:"max_batch_size" yaml:"max_batch_size"`
+	MaxLatencyMs float64 `json:"max_latency_ms,omitempty" yaml:"max_latency_ms"`
+}
+
+func (b *Batching) validate() error {
+	if b.MaxBatchSize < 1 {
+		return fmt.Errorf("batching.max_batch_size must be at least 1, got %d", b.MaxBatchSize)
+	}
+	if b.MaxLatencyMs < 0 {
+		return fmt.Errorf("batching.max_latency_ms can't be negative")
+	}
+	return nil
+}
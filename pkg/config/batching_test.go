@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchingFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+batching:
+  max_batch_size: 32
+  max_latency_ms: 5
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &Batching{MaxBatchSize: 32, MaxLatencyMs: 5}, config.Batching)
+}
+
+func TestBatchingInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "zero batch size",
+			yaml:        "max_batch_size: 0",
+			expectedErr: "batching.max_batch_size must be at least 1",
+		},
+		{
+			name:        "negative latency",
+			yaml:        "max_batch_size: 8\n  max_latency_ms: -1",
+			expectedErr: "batching.max_latency_ms can't be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("batching:\n  " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var buildArgNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseBuildArgs parses build args in the form KEY=VALUE, like the ones passed with --build-arg
+func ParseBuildArgs(args []string) (map[string]string, error) {
+	parsed := map[string]string{}
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid build arg %q, expected KEY=VALUE", arg)
+		}
+		parsed[name] = value
+	}
+	return parsed, nil
+}
+
+// BuildArgNames returns the names of the build args in build.args, sorted
+func (c *Config) BuildArgNames() []string {
+	return slices.Sorted(maps.Keys(c.Build.Args))
+}
+
+// validateBuildArgs returns an error if build.args isn't valid, or if overrides, the build args passed with
+// --build-arg, set ones that aren't in build.args
+func (c *Config) validateBuildArgs(overrides []string) error {
+	for _, name := range c.BuildArgNames() {
+		if !buildArgNamePattern.MatchString(name) {
+			return fmt.Errorf("Invalid build arg name %q in build.args in cog.yaml, expected a name like 'PIP_INDEX_URL'", name)
+		}
+		if strings.ContainsAny(c.Build.Args[name], "\r\n") {
+			return fmt.Errorf("The value of build arg %s in build.args in cog.yaml can't contain a new line", name)
+		}
+	}
+	parsed, err := ParseBuildArgs(overrides)
+	if err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(parsed)) {
+		if _, ok := c.Build.Args[name]; !ok {
+			return fmt.Errorf("Build arg %s passed with --build-arg isn't in build.args in cog.yaml. Add it there, with a default value", name)
+		}
+	}
+	return nil
+}
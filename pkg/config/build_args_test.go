@@ -0,0 +1,61 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildArgsFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  args:
+    PIP_INDEX_URL: https://pypi.org/simple
+    WORKERS: 4
+    USE_MIRROR: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, map[string]string{"PIP_INDEX_URL": "https://pypi.org/simple", "WORKERS": "4", "USE_MIRROR": "true"}, config.Build.Args)
+	require.Equal(t, []string{"PIP_INDEX_URL", "USE_MIRROR", "WORKERS"}, config.BuildArgNames())
+
+	require.NoError(t, config.ValidateAndComplete("", []string{"WORKERS=8"}))
+	require.Equal(t, "4", config.Build.Args["WORKERS"], "overrides are passed to the build, not written to the config")
+	require.ErrorContains(t, config.ValidateAndComplete("", []string{"THREADS=8"}), "Build arg THREADS passed with --build-arg isn't in build.args")
+}
+
+func TestParseBuildArgs(t *testing.T) {
+	args, err := ParseBuildArgs([]string{"PIP_INDEX_URL=https://mirror/simple?a=b", "EMPTY="})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"PIP_INDEX_URL": "https://mirror/simple?a=b", "EMPTY": ""}, args)
+
+	_, err = ParseBuildArgs([]string{"PIP_INDEX_URL"})
+	require.ErrorContains(t, err, `Invalid build arg "PIP_INDEX_URL", expected KEY=VALUE`)
+}
+
+func TestValidateBuildArgs(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		args      map[string]string
+		overrides []string
+		err       string
+	}{
+		{"none", nil, nil, ""},
+		{"defaults", map[string]string{"MIRROR": "https://mirror"}, nil, ""},
+		{"override", map[string]string{"MIRROR": "https://mirror"}, []string{"MIRROR=https://other"}, ""},
+		{"invalid name", map[string]string{"MY-MIRROR": ""}, nil, `Invalid build arg name "MY-MIRROR"`},
+		{"new line", map[string]string{"MIRROR": "a\nb"}, nil, "can't contain a new line"},
+		{"undeclared override", map[string]string{"MIRROR": ""}, []string{"OTHER=1"}, "Build arg OTHER passed with --build-arg isn't in build.args"},
+		{"invalid override", map[string]string{"MIRROR": ""}, []string{"MIRROR"}, "expected KEY=VALUE"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Build: &Build{Args: tt.args}}
+			err := config.validateBuildArgs(tt.overrides)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// validateBuildDockerfile returns an error if build.dockerfile doesn't exist in projectDir, or if options that
+// configure the environment Cog generates are set with it, since they'd be ignored
+func (c *Config) validateBuildDockerfile(projectDir string) error {
+	if c.Build.Dockerfile == "" {
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, c.Build.Dockerfile)); err != nil {
+		return fmt.Errorf("Failed to read build.dockerfile: %w", err)
+	}
+	for _, option := range []struct {
+		key string
+		set bool
+	}{
+		{"python_packages", len(c.Build.PythonPackages) > 0},
+		{"python_requirements", c.Build.PythonRequirements != ""},
+		{"system_packages", len(c.Build.SystemPackages) > 0},
+		{"run", len(c.Build.Run) > 0},
+		{"pre_install", len(c.Build.PreInstall) > 0},
+		{"r_version", c.Build.RVersion != ""},
+		{"julia_version", c.Build.JuliaVersion != ""},
+		{"dockerfile_pre", c.Build.DockerfilePre != ""},
+		{"dockerfile_post", c.Build.DockerfilePost != ""},
+		{"target", c.Build.Target != ""},
+	} {
+		if option.set {
+			return fmt.Errorf("build.%s can't be set in cog.yaml with build.dockerfile. Install what the model needs in %s instead", option.key, c.Build.Dockerfile)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateBuildDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM python:3.12\n"), 0o644))
+
+	for _, tt := range []struct {
+		name  string
+		build Build
+		err   string
+	}{
+		{"not set", Build{PythonPackages: []string{"torch"}}, ""},
+		{"dockerfile", Build{Dockerfile: "Dockerfile", GPU: true, PythonVersion: "3.12"}, ""},
+		{"missing", Build{Dockerfile: "missing.Dockerfile"}, "Failed to read build.dockerfile"},
+		{"python packages", Build{Dockerfile: "Dockerfile", PythonPackages: []string{"torch"}}, "build.python_packages can't be set in cog.yaml with build.dockerfile. Install what the model needs in Dockerfile instead"},
+		{"system packages", Build{Dockerfile: "Dockerfile", SystemPackages: []string{"ffmpeg"}}, "build.system_packages can't be set"},
+		{"run", Build{Dockerfile: "Dockerfile", Run: []RunItem{{Command: "echo"}}}, "build.run can't be set"},
+		{"snippets", Build{Dockerfile: "Dockerfile", DockerfilePost: "RUN echo"}, "build.dockerfile_post can't be set"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Build: &tt.build}
+			err := config.validateBuildDockerfile(dir)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -97,16 +97,16 @@ var TorchCompatibilityMatrix []TorchCompatibility
 
 func init() {
 	if err := json.Unmarshal(cudaBaseImagesData, &CUDABaseImages); err != nil {
-		console.Fatalf("Failed to load embedded CUDA base images: %s", err)
+		panic(fmt.Sprintf("Failed to load embedded CUDA base images: %s", err))
 	}
 
 	if err := json.Unmarshal(tfCompatibilityMatrixData, &TFCompatibilityMatrix); err != nil {
-		console.Fatalf("Failed to load embedded Tensorflow compatibility matrix: %s", err)
+		panic(fmt.Sprintf("Failed to load embedded Tensorflow compatibility matrix: %s", err))
 	}
 
 	var torchCompatibilityMatrix []TorchCompatibility
 	if err := json.Unmarshal(torchCompatibilityMatrixData, &torchCompatibilityMatrix); err != nil {
-		console.Fatalf("Failed to load embedded PyTorch compatibility matrix: %s", err)
+		panic(fmt.Sprintf("Failed to load embedded PyTorch compatibility matrix: %s", err))
 	}
 	filteredTorchCompatibilityMatrix := []TorchCompatibility{}
 	for _, compat := range torchCompatibilityMatrix {
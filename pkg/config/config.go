@@ -6,7 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -46,15 +46,31 @@ type RunItem struct {
 }
 
 type Build struct {
-	GPU                bool      `json:"gpu,omitempty" yaml:"gpu"`
-	PythonVersion      string    `json:"python_version,omitempty" yaml:"python_version"`
-	PythonRequirements string    `json:"python_requirements,omitempty" yaml:"python_requirements"`
-	PythonPackages     []string  `json:"python_packages,omitempty" yaml:"python_packages"` // Deprecated, but included for backwards compatibility
-	Run                []RunItem `json:"run,omitempty" yaml:"run"`
-	SystemPackages     []string  `json:"system_packages,omitempty" yaml:"system_packages"`
-	PreInstall         []string  `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
-	CUDA               string    `json:"cuda,omitempty" yaml:"cuda"`
-	CuDNN              string    `json:"cudnn,omitempty" yaml:"cudnn"`
+	GPU                bool              `json:"gpu,omitempty" yaml:"gpu"`
+	PythonVersion      string            `json:"python_version,omitempty" yaml:"python_version"`
+	PythonRequirements string            `json:"python_requirements,omitempty" yaml:"python_requirements"`
+	PythonPackages     []string          `json:"python_packages,omitempty" yaml:"python_packages"` // Deprecated, but included for backwards compatibility
+	Run                []RunItem         `json:"run,omitempty" yaml:"run"`
+	SystemPackages     []string          `json:"system_packages,omitempty" yaml:"system_packages"`
+	AutoSystemPackages *bool             `json:"auto_system_packages,omitempty" yaml:"auto_system_packages"`
+	PreInstall         []string          `json:"pre_install,omitempty" yaml:"pre_install"` // Deprecated, but included for backwards compatibility
+	CUDA               string            `json:"cuda,omitempty" yaml:"cuda"`
+	CuDNN              string            `json:"cudnn,omitempty" yaml:"cudnn"`
+	RVersion           string            `json:"r_version,omitempty" yaml:"r_version"`
+	RPackages          []string          `json:"r_packages,omitempty" yaml:"r_packages"`
+	JuliaVersion       string            `json:"julia_version,omitempty" yaml:"julia_version"`
+	JuliaPackages      []string          `json:"julia_packages,omitempty" yaml:"julia_packages"`
+	Args               map[string]string `json:"args,omitempty" yaml:"args"`
+	DockerfilePre      string            `json:"dockerfile_pre,omitempty" yaml:"dockerfile_pre"`
+	DockerfilePost     string            `json:"dockerfile_post,omitempty" yaml:"dockerfile_post"`
+	Dockerfile         string            `json:"dockerfile,omitempty" yaml:"dockerfile"`
+	CheckImports       bool              `json:"check_imports,omitempty" yaml:"check_imports"`
+	// ReadOnlyRootFilesystem makes the model write its state to StateDir, so it runs with a read-only root filesystem
+	ReadOnlyRootFilesystem bool   `json:"read_only_root_filesystem,omitempty" yaml:"read_only_root_filesystem"`
+	StateDir               string `json:"state_dir,omitempty" yaml:"state_dir"`
+	// Target is the device or platform the model is built to run on, like TargetJetson or TargetLambda, or "" for servers
+	Target         string `json:"target,omitempty" yaml:"target"`
+	JetPackVersion string `json:"jetpack,omitempty" yaml:"jetpack"`
 
 	pythonRequirementsContent []string
 }
@@ -69,11 +85,27 @@ type Example struct {
 }
 
 type Config struct {
-	Build       *Build       `json:"build" yaml:"build"`
-	Image       string       `json:"image,omitempty" yaml:"image"`
-	Predict     string       `json:"predict,omitempty" yaml:"predict"`
-	Train       string       `json:"train,omitempty" yaml:"train"`
-	Concurrency *Concurrency `json:"concurrency,omitempty" yaml:"concurrency"`
+	ConfigVersion  int            `json:"config_version,omitempty" yaml:"config_version"`
+	Build          *Build         `json:"build" yaml:"build"`
+	Image          string         `json:"image,omitempty" yaml:"image"`
+	Predict        string         `json:"predict,omitempty" yaml:"predict"`
+	PredictMethods []string       `json:"predict_methods,omitempty" yaml:"predict_methods"`
+	Pipeline       []PipelineStep `json:"pipeline,omitempty" yaml:"pipeline"`
+	Models         []ServedModel  `json:"models,omitempty" yaml:"models"`
+	Train          string         `json:"train,omitempty" yaml:"train"`
+	Runner         *Runner        `json:"runner,omitempty" yaml:"runner"`
+	Concurrency    *Concurrency   `json:"concurrency,omitempty" yaml:"concurrency"`
+	Batching       *Batching      `json:"batching,omitempty" yaml:"batching"`
+	Resources      *Resources     `json:"resources,omitempty" yaml:"resources"`
+	Downloads      *Downloads     `json:"downloads,omitempty" yaml:"downloads"`
+	Licenses       *Licenses      `json:"licenses,omitempty" yaml:"licenses"`
+	Serve          *Serve         `json:"serve,omitempty" yaml:"serve"`
+
+	EnvironmentVariables map[string]string `json:"environment_variables,omitempty" yaml:"environment_variables"`
+	Secrets              []Secret          `json:"secrets,omitempty" yaml:"secrets"`
+	Weights              []WeightsSource   `json:"weights,omitempty" yaml:"weights"`
+	Volumes              []string          `json:"volumes,omitempty" yaml:"volumes"`
+	Devices              []string          `json:"devices,omitempty" yaml:"devices"`
 }
 
 func DefaultConfig() *Config {
@@ -270,7 +302,9 @@ func ValidateModelPythonVersion(cfg *Config) error {
 	return nil
 }
 
-func (c *Config) ValidateAndComplete(projectDir string) error {
+// ValidateAndComplete checks the config and fills in its defaults. buildArgs are the build args passed with
+// --build-arg, in the form KEY=VALUE, which must override ones in build.args.
+func (c *Config) ValidateAndComplete(projectDir string, buildArgs []string) error {
 	// TODO(andreas): validate that torch/torchvision/torchaudio are compatible
 	// TODO(andreas): warn if user specifies tensorflow-gpu instead of tensorflow
 	// TODO(andreas): use pypi api to validate that all python versions exist
@@ -282,11 +316,47 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 		errs = append(errs, err)
 	}
 
-	if c.Predict != "" {
+	if notebook, name := c.PredictNotebook(); notebook != "" {
+		if err := validateNotebook(filepath.Join(projectDir, notebook), name); err != nil {
+			errs = append(errs, err)
+		}
+	} else if c.Predict != "" && !c.UsesRunner() {
 		if len(strings.Split(c.Predict, ".py:")) != 2 {
-			errs = append(errs, fmt.Errorf("'predict' in cog.yaml must be in the form 'predict.py:Predictor"))
+			errs = append(errs, fmt.Errorf("'predict' in cog.yaml must be in the form 'predict.py:Predictor', 'notebook.ipynb:Predictor', 'predict.R:predict' or 'predict.jl:predict'"))
 		}
 	}
+	if err := c.validateR(projectDir); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateJulia(projectDir); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validatePredictMethods(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validatePipeline(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateModels(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateRunner(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := c.validateBuildArgs(buildArgs); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Build.validateDockerfileSnippets(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.validateBuildDockerfile(projectDir); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Build.validateReadOnlyRootFilesystem(); err != nil {
+		errs = append(errs, err)
+	}
 
 	if len(c.Build.PythonPackages) > 0 && c.Build.PythonRequirements != "" {
 		errs = append(errs, fmt.Errorf("Only one of python_packages or python_requirements can be set in your cog.yaml, not both"))
@@ -294,7 +364,7 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 
 	// Load python_requirements into memory to simplify reading it multiple times
 	if c.Build.PythonRequirements != "" {
-		fh, err := os.Open(path.Join(projectDir, c.Build.PythonRequirements))
+		fh, err := os.Open(filepath.Join(projectDir, c.Build.PythonRequirements))
 		if err != nil {
 			errs = append(errs, fmt.Errorf("Failed to open python_requirements file: %w", err))
 		}
@@ -310,12 +380,64 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 		c.Build.pythonRequirementsContent = c.Build.PythonPackages
 	}
 
-	if c.Build.GPU {
+	if err := c.Build.validateAndCompleteTarget(); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Jetson models use the CUDA that comes with JetPack
+	if c.Build.GPU && c.Build.Target != TargetJetson {
 		if err := c.validateAndCompleteCUDA(); err != nil {
 			errs = append(errs, err)
 		}
 	}
 
+	if c.Batching != nil {
+		if err := c.Batching.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Resources != nil {
+		if err := c.Resources.validate(c.Build.GPU); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Downloads != nil {
+		if err := c.Downloads.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Licenses != nil {
+		if err := c.Licenses.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if c.Serve != nil {
+		if err := c.Serve.validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := validateEnvironmentVariables(c.EnvironmentVariables); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := validateWeights(c.Weights); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateSecrets(c.Secrets, c.EnvironmentVariables); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateVolumes(c.Volumes); err != nil {
+		errs = append(errs, err)
+	}
+	if err := validateDevices(c.Devices); err != nil {
+		errs = append(errs, err)
+	}
+
 	if len(errs) > 0 {
 		return errors.Join(errs...)
 	}
@@ -323,6 +445,20 @@ func (c *Config) ValidateAndComplete(projectDir string) error {
 	return nil
 }
 
+// PythonPackages returns the Python packages in python_requirements or python_packages, without comments or pip options
+func (c *Config) PythonPackages() []string {
+	packages := []string{}
+	for _, line := range c.Build.pythonRequirementsContent {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "-") {
+			continue
+		}
+		packages = append(packages, line)
+	}
+	return packages
+}
+
 // PythonRequirementsForArch returns a requirements.txt file with all the GPU packages resolved for given OS and architecture.
 func (c *Config) PythonRequirementsForArch(goos string, goarch string, includePackages []string) (string, error) {
 	packages := []string{}
@@ -403,6 +539,12 @@ func (c *Config) pythonPackageForArch(pkg, goos, goarch string) (actualPackage s
 		return name + "==" + version, findLinksList, extraIndexURLs, nil
 	}
 
+	// PyTorch and TensorFlow's packages on PyPI are for servers, so packages for other devices are installed as
+	// they're written, from the index in requirements.txt
+	if c.Build.IsDevice() {
+		return pkg, []string{}, []string{}, nil
+	}
+
 	extraIndexURL := ""
 	findLinks := ""
 	switch name {
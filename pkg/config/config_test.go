@@ -160,7 +160,7 @@ func TestPythonPackagesAndRequirementsCantBeUsedTogether(t *testing.T) {
 			PythonRequirements: "requirements.txt",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Only one of python_packages or python_requirements can be set in your cog.yaml, not both")
 }
@@ -180,7 +180,7 @@ foo==1.0.0`), 0o644)
 			PythonRequirements: "requirements.txt",
 		},
 	}
-	err = config.ValidateAndComplete(tmpDir)
+	err = config.ValidateAndComplete(tmpDir, nil)
 	require.NoError(t, err)
 	require.Equal(t, "11.0", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -210,7 +210,7 @@ foo==1.0.0`), 0o644)
 			PythonRequirements: "requirements.txt",
 		},
 	}
-	err = config.ValidateAndComplete(tmpDir)
+	err = config.ValidateAndComplete(tmpDir, nil)
 	require.NoError(t, err)
 	require.Equal(t, "11.6", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -245,7 +245,7 @@ flask>0.4
 			PythonRequirements: "requirements.txt",
 		},
 	}
-	err = config.ValidateAndComplete(tmpDir)
+	err = config.ValidateAndComplete(tmpDir, nil)
 	require.NoError(t, err)
 
 	requirements, err := config.PythonRequirementsForArch("", "", []string{})
@@ -275,7 +275,7 @@ func TestValidateAndCompleteCUDAForAllTF(t *testing.T) {
 			},
 		}
 
-		err := config.ValidateAndComplete("")
+		err := config.ValidateAndComplete("", nil)
 		require.NoError(t, err)
 		assertMinorVersion(t, compat.CUDA, config.Build.CUDA)
 		require.Equal(t, compat.CuDNN, config.Build.CuDNN)
@@ -294,7 +294,7 @@ func TestValidateAndCompleteCUDAForAllTorch(t *testing.T) {
 			},
 		}
 
-		err := config.ValidateAndComplete("")
+		err := config.ValidateAndComplete("", nil)
 		require.NoError(t, err)
 		if compat.CUDA == nil {
 			require.Equal(t, "", config.Build.CUDA)
@@ -325,7 +325,7 @@ func TestValidateAndCompleteCUDAForSelectedTorch(t *testing.T) {
 				},
 			},
 		}
-		err := config.ValidateAndComplete("")
+		err := config.ValidateAndComplete("", nil)
 		require.NoError(t, err)
 		require.Equal(t, tt.cuda, config.Build.CUDA)
 		require.Equal(t, tt.cuDNN, config.Build.CuDNN)
@@ -348,7 +348,7 @@ func TestUnsupportedTorch(t *testing.T) {
 			},
 		},
 	}
-	err = config.ValidateAndComplete("")
+	err = config.ValidateAndComplete("", nil)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Cog doesn't know what CUDA version is compatible with torch==0.4.1.")
 
@@ -362,7 +362,7 @@ func TestUnsupportedTorch(t *testing.T) {
 			},
 		},
 	}
-	err = config.ValidateAndComplete("")
+	err = config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	assertMinorVersion(t, "11.8", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -385,7 +385,7 @@ func TestUnsupportedTensorflow(t *testing.T) {
 			},
 		},
 	}
-	err = config.ValidateAndComplete("")
+	err = config.ValidateAndComplete("", nil)
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "Cog doesn't know what CUDA version is compatible with tensorflow==0.4.1.")
 
@@ -399,7 +399,7 @@ func TestUnsupportedTensorflow(t *testing.T) {
 			},
 		},
 	}
-	err = config.ValidateAndComplete("")
+	err = config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	assertMinorVersion(t, "11.8", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -419,7 +419,7 @@ func TestPythonPackagesForArchTorchGPU(t *testing.T) {
 			CUDA: "11.8",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	assertMinorVersion(t, "11.8", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -448,7 +448,7 @@ func TestPythonPackagesForArchTorchCPU(t *testing.T) {
 			CUDA: "11.8",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 
 	requirements, err := config.PythonRequirementsForArch("", "", []string{})
@@ -473,7 +473,7 @@ func TestPythonPackagesForArchTensorflowGPU(t *testing.T) {
 			CUDA: "11.8",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	assertMinorVersion(t, "11.8", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -503,7 +503,7 @@ func TestPythonPackagesBothTorchAndTensorflow(t *testing.T) {
 			CUDA: "12.3",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	require.Equal(t, "12.3", config.Build.CUDA)
 	require.Equal(t, "8", config.Build.CuDNN)
@@ -527,7 +527,7 @@ func TestCUDABaseImageTag(t *testing.T) {
 		},
 	}
 
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 
 	imageTag, err := config.CUDABaseImageTag()
@@ -651,7 +651,7 @@ func TestTorchWithExistingExtraIndexURL(t *testing.T) {
 			CUDA: "11.6.2",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	require.Equal(t, "11.6.2", config.Build.CUDA)
 
@@ -716,7 +716,7 @@ func TestPythonRequirementsForArchWithAddedPackage(t *testing.T) {
 			CUDA: "11.6.2",
 		},
 	}
-	err := config.ValidateAndComplete("")
+	err := config.ValidateAndComplete("", nil)
 	require.NoError(t, err)
 	require.Equal(t, "11.6.2", config.Build.CUDA)
 	requirements, err := config.PythonRequirementsForArch("", "", []string{
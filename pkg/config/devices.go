@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Device is a device on the host to give the model's container, like a camera or an accelerator that isn't a GPU
+type Device struct {
+	HostPath      string
+	ContainerPath string
+	// Permissions are what the container can do with the device: any of r (read), w (write) and m (mknod)
+	Permissions string
+}
+
+// ParseDevice parses a device in the same form as `docker run --device`, like "/dev/video0" or
+// "/dev/apex_0:/dev/apex_0:rw"
+func ParseDevice(s string) (Device, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return Device{}, fmt.Errorf("Invalid device %q, expected a path like '/dev/video0', optionally followed by :container_path and :permissions", s)
+	}
+	device := Device{HostPath: parts[0], ContainerPath: parts[0], Permissions: "rwm"}
+	if len(parts) == 2 && !strings.HasPrefix(parts[1], "/") {
+		// Docker allows the permissions straight after the host path, like "/dev/video0:r"
+		device.Permissions = parts[1]
+	} else if len(parts) >= 2 {
+		device.ContainerPath = parts[1]
+		if len(parts) == 3 {
+			device.Permissions = parts[2]
+		}
+	}
+	if !path.IsAbs(device.HostPath) || !path.IsAbs(device.ContainerPath) {
+		return Device{}, fmt.Errorf("Invalid device %q, expected absolute paths like '/dev/video0'", s)
+	}
+	if device.Permissions == "" || strings.Trim(device.Permissions, "rwm") != "" {
+		return Device{}, fmt.Errorf("Invalid device %q, expected the permissions to be some of r, w and m, like 'rw'", s)
+	}
+	return device, nil
+}
+
+func validateDevices(devices []string) error {
+	for _, s := range devices {
+		if _, err := ParseDevice(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeviceMounts returns the devices in cog.yaml
+func (c *Config) DeviceMounts() []Device {
+	devices := []Device{}
+	for _, s := range c.Devices {
+		// Validated in ValidateAndComplete
+		device, _ := ParseDevice(s)
+		devices = append(devices, device)
+	}
+	return devices
+}
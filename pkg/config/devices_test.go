@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDevice(t *testing.T) {
+	for s, expected := range map[string]Device{
+		"/dev/video0":                 {HostPath: "/dev/video0", ContainerPath: "/dev/video0", Permissions: "rwm"},
+		"/dev/video0:r":               {HostPath: "/dev/video0", ContainerPath: "/dev/video0", Permissions: "r"},
+		"/dev/video2:/dev/video0":     {HostPath: "/dev/video2", ContainerPath: "/dev/video0", Permissions: "rwm"},
+		"/dev/apex_0:/dev/apex_0:rw":  {HostPath: "/dev/apex_0", ContainerPath: "/dev/apex_0", Permissions: "rw"},
+		"/dev/bus/usb/001/004::r":     {},
+		"video0":                      {},
+		"/dev/video0:/dev/video0:rwx": {},
+		"/dev/video0:video0":          {},
+		"/a:/b:r:w":                   {},
+	} {
+		device, err := ParseDevice(s)
+		if expected.HostPath == "" {
+			require.ErrorContains(t, err, "Invalid device", s)
+		} else {
+			require.NoError(t, err, s)
+			require.Equal(t, expected, device, s)
+		}
+	}
+}
+
+func TestDevicesFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte("devices:\n  - /dev/video0\n  - /dev/apex_0:/dev/apex_0:rw\n"))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, []Device{
+		{HostPath: "/dev/video0", ContainerPath: "/dev/video0", Permissions: "rwm"},
+		{HostPath: "/dev/apex_0", ContainerPath: "/dev/apex_0", Permissions: "rw"},
+	}, config.DeviceMounts())
+
+	config, err = FromYAML([]byte("devices:\n  - video0\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.ValidateAndComplete("", nil), "Invalid device")
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// dockerfileInstructions are the instructions that can be used in build.dockerfile_pre and build.dockerfile_post.
+// FROM would start a new stage, and Cog sets CMD and ENTRYPOINT itself, so they can't be.
+var dockerfileInstructions = map[string]bool{
+	"ADD":         true,
+	"ARG":         true,
+	"COPY":        true,
+	"ENV":         true,
+	"EXPOSE":      true,
+	"HEALTHCHECK": true,
+	"LABEL":       true,
+	"ONBUILD":     true,
+	"RUN":         true,
+	"SHELL":       true,
+	"STOPSIGNAL":  true,
+	"USER":        true,
+	"VOLUME":      true,
+	"WORKDIR":     true,
+}
+
+var heredocPattern = regexp.MustCompile(`<<-?["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+// validateDockerfileSnippet returns an error if snippet, the value of key in cog.yaml, has lines that aren't
+// Dockerfile instructions, or uses instructions that would break the image Cog generates
+func validateDockerfileSnippet(key string, snippet string) error {
+	lines := strings.Split(strings.TrimRight(snippet, "\n"), "\n")
+	continued := false
+	heredoc := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case heredoc != "":
+			if trimmed == heredoc {
+				heredoc = ""
+			}
+			continue
+		case continued:
+			// The line continues the instruction before it
+		case trimmed == "" || strings.HasPrefix(trimmed, "#"):
+			continue
+		default:
+			instruction := strings.ToUpper(strings.Fields(trimmed)[0])
+			if instruction == "FROM" || instruction == "CMD" || instruction == "ENTRYPOINT" {
+				return fmt.Errorf("build.%s in cog.yaml can't use %s on line %d, because Cog sets it in the image it generates", key, instruction, i+1)
+			}
+			if !dockerfileInstructions[instruction] {
+				return fmt.Errorf("Line %d of build.%s in cog.yaml isn't a Dockerfile instruction: %s", i+1, key, trimmed)
+			}
+		}
+		if match := heredocPattern.FindStringSubmatch(line); match != nil {
+			heredoc = match[1]
+		}
+		continued = strings.HasSuffix(strings.TrimRight(line, " \t"), `\`)
+	}
+	if continued {
+		return fmt.Errorf("The last line of build.%s in cog.yaml ends with '\\', but there isn't a line after it", key)
+	}
+	if heredoc != "" {
+		return fmt.Errorf("build.%s in cog.yaml has a heredoc that isn't terminated with %s", key, heredoc)
+	}
+	return nil
+}
+
+func (b *Build) validateDockerfileSnippets() error {
+	if err := validateDockerfileSnippet("dockerfile_pre", b.DockerfilePre); err != nil {
+		return err
+	}
+	return validateDockerfileSnippet("dockerfile_post", b.DockerfilePost)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerfileSnippetsFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  dockerfile_pre: |
+    ENV PIP_INDEX_URL=https://mirror.example.com/simple
+  dockerfile_post: |
+    RUN echo done
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, "ENV PIP_INDEX_URL=https://mirror.example.com/simple\n", config.Build.DockerfilePre)
+	require.Equal(t, "RUN echo done\n", config.Build.DockerfilePost)
+}
+
+func TestValidateDockerfileSnippet(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		snippet string
+		err     string
+	}{
+		{"empty", "", ""},
+		{"instructions", "ENV A=1\nrun echo $A\n\n# A comment\nLABEL a=b\n", ""},
+		{"continuation", "RUN apt-get update && \\\n    apt-get install -y ffmpeg\n", ""},
+		{"heredoc", "RUN <<EOF\nset -e\necho hello\nEOF\nENV A=1\n", ""},
+		{"quoted heredoc", "COPY <<'END' /etc/app.conf\nkey = value\nEND\n", ""},
+		{"not an instruction", "ENV A=1\napt-get install -y ffmpeg\n", "Line 2 of build.dockerfile_pre in cog.yaml isn't a Dockerfile instruction: apt-get install -y ffmpeg"},
+		{"from", "FROM ubuntu:22.04\n", "build.dockerfile_pre in cog.yaml can't use FROM on line 1"},
+		{"cmd", "RUN true\ncmd [\"python\"]\n", "can't use CMD on line 2"},
+		{"entrypoint", "ENTRYPOINT [\"/bin/sh\"]", "can't use ENTRYPOINT"},
+		{"trailing continuation", "RUN echo \\\n", "ends with '\\', but there isn't a line after it"},
+		{"unterminated heredoc", "RUN <<EOF\necho hello\n", "has a heredoc that isn't terminated with EOF"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDockerfileSnippet("dockerfile_pre", tt.snippet)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Downloads configures how the model server fetches input files that are passed as URLs
+type Downloads struct {
+	MaxSize             string   `json:"max_size,omitempty" yaml:"max_size"`
+	Timeout             float64  `json:"timeout,omitempty" yaml:"timeout"`
+	AllowedSchemes      []string `json:"allowed_schemes,omitempty" yaml:"allowed_schemes"`
+	AllowedHosts        []string `json:"allowed_hosts,omitempty" yaml:"allowed_hosts"`
+	AllowedContentTypes []string `json:"allowed_content_types,omitempty" yaml:"allowed_content_types"`
+}
+
+func (d *Downloads) validate() error {
+	if d.MaxSize != "" {
+		if _, err := ParseQuantity(d.MaxSize); err != nil {
+			return fmt.Errorf("Invalid downloads.max_size: %w", err)
+		}
+	}
+	if d.Timeout < 0 {
+		return fmt.Errorf("downloads.timeout must be a positive number of seconds, got %v", d.Timeout)
+	}
+	for _, host := range d.AllowedHosts {
+		if host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("Invalid downloads.allowed_hosts entry %q, expected a host name like 'example.com' or '*.example.com'", host)
+		}
+		if strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+			return fmt.Errorf("Invalid downloads.allowed_hosts entry %q, wildcards are only allowed as a '*.' prefix", host)
+		}
+	}
+	for _, contentType := range d.AllowedContentTypes {
+		parts := strings.Split(contentType, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" || parts[0] == "*" {
+			return fmt.Errorf("Invalid downloads.allowed_content_types entry %q, expected a MIME type like 'image/png' or 'image/*'", contentType)
+		}
+	}
+	return nil
+}
+
+// MaxSizeBytes returns the maximum size of a downloaded input in bytes, or 0 if there's no limit
+func (d *Downloads) MaxSizeBytes() int64 {
+	if d == nil || d.MaxSize == "" {
+		return 0
+	}
+	// Validated in ValidateAndComplete
+	bytes, _ := ParseQuantity(d.MaxSize)
+	return bytes
+}
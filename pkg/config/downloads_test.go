@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadsFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+downloads:
+  max_size: 100M
+  timeout: 30
+  allowed_schemes: [https]
+  allowed_hosts: ["*.example.com", "storage.googleapis.com"]
+  allowed_content_types: ["image/*", "application/json"]
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+
+	require.Equal(t, int64(100_000_000), config.Downloads.MaxSizeBytes())
+	require.Equal(t, 30.0, config.Downloads.Timeout)
+	require.Equal(t, []string{"https"}, config.Downloads.AllowedSchemes)
+	require.Equal(t, []string{"*.example.com", "storage.googleapis.com"}, config.Downloads.AllowedHosts)
+}
+
+func TestDownloadsInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "max size",
+			yaml:        "max_size: huge",
+			expectedErr: "Invalid downloads.max_size",
+		},
+		{
+			name:        "negative timeout",
+			yaml:        "timeout: -1",
+			expectedErr: "downloads.timeout must be a positive number",
+		},
+		{
+			name:        "host with scheme",
+			yaml:        `allowed_hosts: ["https://example.com"]`,
+			expectedErr: "Invalid downloads.allowed_hosts entry",
+		},
+		{
+			name:        "host with inner wildcard",
+			yaml:        `allowed_hosts: ["foo.*.com"]`,
+			expectedErr: "wildcards are only allowed",
+		},
+		{
+			name:        "content type",
+			yaml:        `allowed_content_types: ["image"]`,
+			expectedErr: "Invalid downloads.allowed_content_types entry",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("downloads:\n  " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestDownloadsInvalidScheme(t *testing.T) {
+	// Schemes are checked by the JSON schema
+	_, err := FromYAML([]byte(`
+downloads:
+  allowed_schemes: [file]
+`))
+	require.ErrorContains(t, err, "downloads.allowed_schemes.0 must be one of the following")
+}
+
+func TestDownloadsUnset(t *testing.T) {
+	var downloads *Downloads
+	require.Equal(t, int64(0), downloads.MaxSizeBytes())
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AddToBuildList adds items to the end of a list in build in cog.yaml, like build.system_packages, keeping its
+// comments. The list, and build, are added if they aren't there.
+func AddToBuildList(contents []byte, key string, items []string) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(contents, doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse config yaml: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		doc = &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("cog.yaml must be a mapping")
+	}
+
+	build := mappingValue(root, "build")
+	if build == nil || (build.Kind == yaml.ScalarNode && build.Tag == "!!null") {
+		build = addMappingValue(root, "build", &yaml.Node{Kind: yaml.MappingNode})
+	}
+	if build.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("build in cog.yaml must be a mapping")
+	}
+	list := mappingValue(build, key)
+	if list == nil || (list.Kind == yaml.ScalarNode && list.Tag == "!!null") {
+		list = addMappingValue(build, key, &yaml.Node{Kind: yaml.SequenceNode})
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("build.%s in cog.yaml must be a list", key)
+	}
+	for _, item := range items {
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: item, Style: yaml.DoubleQuotedStyle})
+	}
+
+	return encodeConfigYAML(doc)
+}
+
+// MovePreInstallToRun moves the commands in build.pre_install, which is deprecated, to the end of build.run, where
+// they're run in the same order, keeping the comments in cog.yaml
+func MovePreInstallToRun(contents []byte) ([]byte, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(contents, doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse config yaml: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return contents, nil
+	}
+	build := mappingValue(doc.Content[0], "build")
+	if build == nil || build.Kind != yaml.MappingNode {
+		return contents, nil
+	}
+	preInstall := mappingValue(build, "pre_install")
+	if preInstall == nil || preInstall.Kind != yaml.SequenceNode {
+		return contents, nil
+	}
+	run := mappingValue(build, "run")
+	if run == nil || (run.Kind == yaml.ScalarNode && run.Tag == "!!null") {
+		run = addMappingValue(build, "run", &yaml.Node{Kind: yaml.SequenceNode})
+	}
+	if run.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("build.run in cog.yaml must be a list")
+	}
+	run.Content = append(run.Content, preInstall.Content...)
+	removeMappingValue(build, "pre_install")
+	return encodeConfigYAML(doc)
+}
+
+// encodeConfigYAML returns a cog.yaml document, indented like the ones 'cog init' writes
+func encodeConfigYAML(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("Failed to write config yaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("Failed to write config yaml: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// removeMappingValue removes key from a mapping, if it's there
+func removeMappingValue(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+// addMappingValue sets the value of key in a mapping, replacing it if it's already there, and returns the value
+func addMappingValue(mapping *yaml.Node, key string, value *yaml.Node) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return value
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+	return value
+}
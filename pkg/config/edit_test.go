@@ -0,0 +1,71 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddToBuildList(t *testing.T) {
+	contents, err := AddToBuildList([]byte(`build:
+  # the model's packages
+  python_packages:
+    - "torch==2.3.1" # for the model
+  gpu: true
+predict: "predict.py:Predictor"
+`), "python_packages", []string{"numpy"})
+	require.NoError(t, err)
+	require.Equal(t, `build:
+  # the model's packages
+  python_packages:
+    - "torch==2.3.1" # for the model
+    - "numpy"
+  gpu: true
+predict: "predict.py:Predictor"
+`, string(contents))
+
+	contents, err = AddToBuildList(contents, "system_packages", []string{"ffmpeg", "libsndfile1"})
+	require.NoError(t, err)
+	require.Equal(t, `build:
+  # the model's packages
+  python_packages:
+    - "torch==2.3.1" # for the model
+    - "numpy"
+  gpu: true
+  system_packages:
+    - "ffmpeg"
+    - "libsndfile1"
+predict: "predict.py:Predictor"
+`, string(contents))
+}
+
+func TestAddToBuildListWithoutBuild(t *testing.T) {
+	contents, err := AddToBuildList([]byte("predict: predict.py:Predictor\n"), "system_packages", []string{"ffmpeg"})
+	require.NoError(t, err)
+	require.Equal(t, "predict: predict.py:Predictor\nbuild:\n  system_packages:\n    - \"ffmpeg\"\n", string(contents))
+
+	_, err = AddToBuildList([]byte("build:\n  system_packages: ffmpeg\n"), "system_packages", []string{"ffmpeg"})
+	require.ErrorContains(t, err, "build.system_packages in cog.yaml must be a list")
+}
+
+func TestMovePreInstallToRun(t *testing.T) {
+	contents, err := MovePreInstallToRun([]byte(`build:
+  run:
+    - "apt-get update" # first
+  # old commands
+  pre_install:
+    - "pip install torch==2.3.1"
+predict: "predict.py:Predictor"
+`))
+	require.NoError(t, err)
+	require.Equal(t, `build:
+  run:
+    - "apt-get update" # first
+    - "pip install torch==2.3.1"
+predict: "predict.py:Predictor"
+`, string(contents))
+
+	contents, err = MovePreInstallToRun([]byte("build:\n  pre_install:\n    - echo hello\n"))
+	require.NoError(t, err)
+	require.Equal(t, "build:\n  run:\n    - echo hello\n", string(contents))
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/secrets"
+)
+
+// Secret is an environment variable whose value is read on the host when a container starts, so it's never saved
+// in the image or in cog.yaml. Exactly one of the sources must be set.
+type Secret struct {
+	Name string `json:"name" yaml:"name"`
+	// Env is the environment variable on the host to read the value from
+	Env string `json:"env,omitempty" yaml:"env"`
+	// File is the file on the host to read the value from
+	File string `json:"file,omitempty" yaml:"file"`
+	// From is a secret in a secrets manager to read the value from, like "vault:kv/models/hf#token"
+	From string `json:"from,omitempty" yaml:"from"`
+}
+
+var envVarNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// secretNamePattern matches names of variables that usually have secrets in them, like HF_TOKEN
+var secretNamePattern = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|ACCESS_KEY|PRIVATE_KEY|CREDENTIALS?)`)
+
+// IsSecretName returns whether the name of a variable, like an environment variable or build arg, looks like it has
+// a secret in it
+func IsSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+func validateEnvironmentVariables(vars map[string]string) error {
+	for name := range vars {
+		if !envVarNameRegexp.MatchString(name) {
+			return fmt.Errorf("Invalid environment_variables name %q, expected letters, digits and underscores", name)
+		}
+	}
+	return nil
+}
+
+func validateSecrets(secretList []Secret, vars map[string]string) error {
+	seen := map[string]bool{}
+	for _, s := range secretList {
+		if !envVarNameRegexp.MatchString(s.Name) {
+			return fmt.Errorf("Invalid secrets name %q, expected letters, digits and underscores", s.Name)
+		}
+		if seen[s.Name] {
+			return fmt.Errorf("Secret %s is defined more than once", s.Name)
+		}
+		seen[s.Name] = true
+		if _, ok := vars[s.Name]; ok {
+			return fmt.Errorf("%s is set in both environment_variables and secrets", s.Name)
+		}
+		if len(s.sources()) != 1 {
+			return fmt.Errorf("Secret %s must set exactly one of env, file or from", s.Name)
+		}
+		if s.From != "" {
+			if _, err := secrets.ParseRef(s.From); err != nil {
+				return fmt.Errorf("Invalid from for secret %s: %w", s.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (s Secret) sources() []string {
+	sources := []string{}
+	if s.Env != "" {
+		sources = append(sources, "env")
+	}
+	if s.File != "" {
+		sources = append(sources, "file")
+	}
+	if s.From != "" {
+		sources = append(sources, "from")
+	}
+	return sources
+}
+
+// Resolve reads the secret's value from where it's kept on the host
+func (s Secret) Resolve() (string, error) {
+	switch {
+	case s.Env != "":
+		value, ok := os.LookupEnv(s.Env)
+		if !ok {
+			return "", fmt.Errorf("Secret %s is read from the environment variable %s, which isn't set", s.Name, s.Env)
+		}
+		return value, nil
+	case s.File != "":
+		path, err := homedir.Expand(s.File)
+		if err != nil {
+			return "", err
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read secret %s: %w", s.Name, err)
+		}
+		// Files written by editors and `echo` end in a newline that isn't part of the secret
+		return strings.TrimRight(string(contents), "\r\n"), nil
+	case s.From != "":
+		value, err := secrets.Get(s.From)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read secret %s: %w", s.Name, err)
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("Secret %s doesn't say where to read it from", s.Name)
+}
+
+// RuntimeEnv returns the environment_variables from cog.yaml, in the form name=value
+func (c *Config) RuntimeEnv() []string {
+	env := make([]string, 0, len(c.EnvironmentVariables))
+	for name, value := range c.EnvironmentVariables {
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvironmentAndSecretsFromYAML(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("file-secret\n"), 0o600))
+	t.Setenv("HOST_HF_TOKEN", "env-secret")
+
+	config, err := FromYAML([]byte(`
+environment_variables:
+  MODEL_CACHE: /src/.cache
+  LOG_FORMAT: json
+secrets:
+  - name: HF_TOKEN
+    env: HOST_HF_TOKEN
+  - name: API_KEY
+    file: ` + keyPath + `
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+
+	require.Equal(t, []string{"LOG_FORMAT=json", "MODEL_CACHE=/src/.cache"}, config.RuntimeEnv())
+	value, err := config.Secrets[0].Resolve()
+	require.NoError(t, err)
+	require.Equal(t, "env-secret", value)
+	value, err = config.Secrets[1].Resolve()
+	require.NoError(t, err)
+	require.Equal(t, "file-secret", value)
+}
+
+func TestSecretMissing(t *testing.T) {
+	config, err := FromYAML([]byte(`
+secrets:
+  - name: HF_TOKEN
+    env: COG_TEST_UNSET_SECRET
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	_, err = config.Secrets[0].Resolve()
+	require.ErrorContains(t, err, "Secret HF_TOKEN is read from the environment variable COG_TEST_UNSET_SECRET, which isn't set")
+}
+
+func TestEnvironmentInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "invalid variable name",
+			yaml:        "environment_variables:\n  MY-VAR: x\n",
+			expectedErr: `Invalid environment_variables name "MY-VAR"`,
+		},
+		{
+			name:        "secret without source",
+			yaml:        "secrets:\n  - name: TOKEN\n",
+			expectedErr: "Secret TOKEN must set exactly one of",
+		},
+		{
+			name:        "secret with two sources",
+			yaml:        "secrets:\n  - name: TOKEN\n    env: TOKEN\n    file: token.txt\n",
+			expectedErr: "Secret TOKEN must set exactly one of",
+		},
+		{
+			name:        "secret defined twice",
+			yaml:        "secrets:\n  - name: TOKEN\n    env: A\n  - name: TOKEN\n    env: B\n",
+			expectedErr: "Secret TOKEN is defined more than once",
+		},
+		{
+			name:        "secret that's also a variable",
+			yaml:        "environment_variables:\n  TOKEN: x\nsecrets:\n  - name: TOKEN\n    env: TOKEN\n",
+			expectedErr: "TOKEN is set in both environment_variables and secrets",
+		},
+		{
+			name:        "secret from an unknown provider",
+			yaml:        "secrets:\n  - name: TOKEN\n    from: keychain:hf\n",
+			expectedErr: `Unknown secrets provider "keychain"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte(tc.yaml))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
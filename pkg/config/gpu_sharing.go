@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// The ways a model can share GPUs with other models on Kubernetes, with NVIDIA's device plugin
+const (
+	// GPUSharingTimeSlicing takes turns on each GPU. The models' memory isn't isolated, so one can run the others
+	// out of it.
+	GPUSharingTimeSlicing = "time-slicing"
+	// GPUSharingMPS runs the models on each GPU at once with CUDA's Multi-Process Service, with an equal share of its
+	// memory and compute each
+	GPUSharingMPS = "mps"
+	// GPUSharingMIG runs the model on a Multi-Instance GPU partition of a GPU, like on A100s and H100s, which is
+	// isolated from the others in hardware
+	GPUSharingMIG = "mig"
+)
+
+// GPUResource is the Kubernetes resource NVIDIA's device plugin gives pods whole GPUs with
+const GPUResource = "nvidia.com/gpu"
+
+// SharedGPUResource is the Kubernetes resource NVIDIA's device plugin gives pods shares of GPUs with, when it's
+// configured to time-slice GPUs or share them with MPS and rename the resource, as cog export device-plugin-config
+// configures it to
+const SharedGPUResource = "nvidia.com/gpu.shared"
+
+// GPUSharingStrategyLabel is the label NVIDIA's GPU feature discovery gives nodes, with how their GPUs are shared
+const GPUSharingStrategyLabel = "nvidia.com/gpu.sharing-strategy"
+
+// DefaultGPUSharingReplicas is how many models share each GPU with time-slicing or MPS, unless
+// resources.gpu_sharing.replicas says otherwise
+const DefaultGPUSharingReplicas = 2
+
+// MIG profiles are named by their compute slices and memory, like 1g.10gb, or 1g.10gb+me with media extensions
+var migProfileRegexp = regexp.MustCompile(`^[1-9][0-9]*g\.[1-9][0-9]*gb(\+me)?$`)
+
+// GPUSharing is how the model shares GPUs with other models when it's deployed to Kubernetes, so several models that
+// don't use much of a GPU can run on one. It isn't used when running locally.
+type GPUSharing struct {
+	// Strategy is GPUSharingTimeSlicing, GPUSharingMPS or GPUSharingMIG
+	Strategy string `json:"strategy" yaml:"strategy"`
+	// Replicas is how many models share each GPU, with time-slicing or MPS
+	Replicas int `json:"replicas,omitempty" yaml:"replicas"`
+	// MIGProfile is the size of the MIG partition the model runs on, like 1g.10gb
+	MIGProfile string `json:"mig_profile,omitempty" yaml:"mig_profile"`
+}
+
+func (g *GPUSharing) validate(gpuCount int) error {
+	switch g.Strategy {
+	case GPUSharingTimeSlicing, GPUSharingMPS:
+		if g.Replicas < 0 || g.Replicas == 1 {
+			return fmt.Errorf("resources.gpu_sharing.replicas must be at least 2, got %d", g.Replicas)
+		}
+		if g.MIGProfile != "" {
+			return fmt.Errorf("resources.gpu_sharing.mig_profile is only used when resources.gpu_sharing.strategy is %s", GPUSharingMIG)
+		}
+		// A pod that asks for two shares of GPUs can get two shares of the same one
+		if gpuCount > 1 {
+			return fmt.Errorf("Models that share GPUs with %s can only use one of them, but resources.gpu_count is %d", g.Strategy, gpuCount)
+		}
+	case GPUSharingMIG:
+		if !migProfileRegexp.MatchString(g.MIGProfile) {
+			return fmt.Errorf("Invalid resources.gpu_sharing.mig_profile %q, expected a MIG profile like '1g.10gb'", g.MIGProfile)
+		}
+		if g.Replicas != 0 {
+			return fmt.Errorf("resources.gpu_sharing.replicas is only used when resources.gpu_sharing.strategy is %s or %s", GPUSharingTimeSlicing, GPUSharingMPS)
+		}
+	default:
+		return fmt.Errorf("Invalid resources.gpu_sharing.strategy %q, expected %s, %s or %s", g.Strategy, GPUSharingTimeSlicing, GPUSharingMPS, GPUSharingMIG)
+	}
+	return nil
+}
+
+// ReplicasOrDefault returns how many models share each GPU with time-slicing or MPS
+func (g *GPUSharing) ReplicasOrDefault() int {
+	if g.Replicas == 0 {
+		return DefaultGPUSharingReplicas
+	}
+	return g.Replicas
+}
+
+// KubernetesGPUResource returns the Kubernetes resource the model asks for GPUs with: whole GPUs, shares of them, or
+// MIG partitions of them, like nvidia.com/mig-1g.10gb
+func (r *Resources) KubernetesGPUResource() string {
+	if r == nil || r.GPUSharing == nil {
+		return GPUResource
+	}
+	switch r.GPUSharing.Strategy {
+	case GPUSharingTimeSlicing, GPUSharingMPS:
+		return SharedGPUResource
+	case GPUSharingMIG:
+		// NVIDIA's device plugin names MIG partitions like this with its mixed strategy
+		return "nvidia.com/mig-" + r.GPUSharing.MIGProfile
+	}
+	return GPUResource
+}
+
+// KubernetesNodeSelector returns the labels of the nodes the model can run on, so models that share GPUs with
+// time-slicing only run on nodes that time-slice them, and so on, or nil for any node
+func (r *Resources) KubernetesNodeSelector() map[string]string {
+	if r == nil || r.GPUSharing == nil {
+		return nil
+	}
+	switch r.GPUSharing.Strategy {
+	case GPUSharingTimeSlicing, GPUSharingMPS:
+		return map[string]string{GPUSharingStrategyLabel: r.GPUSharing.Strategy}
+	}
+	// Only nodes with MIG partitions of the right size have the resource
+	return nil
+}
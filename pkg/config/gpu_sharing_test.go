@@ -0,0 +1,115 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGPUSharing(t *testing.T) {
+	testCases := []struct {
+		yaml                 string
+		expectedResource     string
+		expectedNodeSelector map[string]string
+		expectedReplicas     int
+	}{
+		{
+			yaml:                 "strategy: time-slicing",
+			expectedResource:     "nvidia.com/gpu.shared",
+			expectedNodeSelector: map[string]string{"nvidia.com/gpu.sharing-strategy": "time-slicing"},
+			expectedReplicas:     2,
+		},
+		{
+			yaml:                 "strategy: mps\n    replicas: 4",
+			expectedResource:     "nvidia.com/gpu.shared",
+			expectedNodeSelector: map[string]string{"nvidia.com/gpu.sharing-strategy": "mps"},
+			expectedReplicas:     4,
+		},
+		{
+			yaml:             "strategy: mig\n    mig_profile: 1g.10gb",
+			expectedResource: "nvidia.com/mig-1g.10gb",
+			expectedReplicas: 2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.yaml, func(t *testing.T) {
+			config, err := FromYAML([]byte("build:\n  gpu: true\nresources:\n  gpu_sharing:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			require.NoError(t, config.ValidateAndComplete("", nil))
+			require.Equal(t, tc.expectedResource, config.Resources.KubernetesGPUResource())
+			require.Equal(t, tc.expectedNodeSelector, config.Resources.KubernetesNodeSelector())
+			require.Equal(t, tc.expectedReplicas, config.Resources.GPUSharing.ReplicasOrDefault())
+		})
+	}
+}
+
+func TestGPUSharingUnset(t *testing.T) {
+	var resources *Resources
+	require.Equal(t, "nvidia.com/gpu", resources.KubernetesGPUResource())
+	require.Nil(t, resources.KubernetesNodeSelector())
+}
+
+func TestGPUSharingInvalidStrategy(t *testing.T) {
+	_, err := FromYAML([]byte(`
+build:
+  gpu: true
+resources:
+  gpu_sharing:
+    strategy: vgpu
+`))
+	require.ErrorContains(t, err, "resources.gpu_sharing.strategy must be one of the following")
+
+	_, err = FromYAML([]byte(`
+build:
+  gpu: true
+resources:
+  gpu_sharing:
+    strategy: mps
+    replicas: 1
+`))
+	require.ErrorContains(t, err, "greater than or equal to 2")
+}
+
+func TestGPUSharingInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "without gpu",
+			yaml:        "resources:\n  gpu_sharing:\n    strategy: mps\n",
+			expectedErr: "resources.gpu_sharing requires 'gpu: true'",
+		},
+		{
+			name:        "several gpus",
+			yaml:        "build:\n  gpu: true\nresources:\n  gpu_count: 2\n  gpu_sharing:\n    strategy: time-slicing\n",
+			expectedErr: "can only use one of them",
+		},
+		{
+			name:        "mig profile with time-slicing",
+			yaml:        "build:\n  gpu: true\nresources:\n  gpu_sharing:\n    strategy: time-slicing\n    mig_profile: 1g.10gb\n",
+			expectedErr: "mig_profile is only used when",
+		},
+		{
+			name:        "invalid mig profile",
+			yaml:        "build:\n  gpu: true\nresources:\n  gpu_sharing:\n    strategy: mig\n    mig_profile: small\n",
+			expectedErr: "Invalid resources.gpu_sharing.mig_profile",
+		},
+		{
+			name:        "replicas with mig",
+			yaml:        "build:\n  gpu: true\nresources:\n  gpu_sharing:\n    strategy: mig\n    mig_profile: 1g.10gb\n    replicas: 2\n",
+			expectedErr: "replicas is only used when",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte(tc.yaml))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
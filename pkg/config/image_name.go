@@ -1,7 +1,7 @@
 package config
 
 import (
-	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -9,7 +9,7 @@ import (
 // DockerImageName returns the default Docker image name for images
 func DockerImageName(projectDir string) string {
 	prefix := "cog-"
-	projectName := strings.ToLower(path.Base(projectDir))
+	projectName := strings.ToLower(filepath.Base(projectDir))
 
 	// Convert whitespace to dashes
 	projectName = strings.ReplaceAll(projectName, " ", "-")
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// JuliaExtension is the extension of Julia scripts, which a predictor can be defined in
+const JuliaExtension = ".jl"
+
+// JuliaServerPath is where the server for Julia predictors goes in the image. It's outside /src so it's still there
+// when the project directory is mounted over /src.
+const JuliaServerPath = "/opt/cog/julia/server.jl"
+
+var (
+	// juliaVersionPattern matches juliaup channels: versions, and the latest release or long-term support release
+	juliaVersionPattern = regexp.MustCompile(`^([0-9]+\.[0-9]+(\.[0-9]+)?|release|lts)$`)
+	juliaPackagePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(@[0-9][0-9A-Za-z.+-]*)?$`)
+)
+
+// PredictJulia returns the Julia script that predict refers to, like "predict.jl", and the name of the function in it
+// that runs predictions. script is "" if the predictor isn't in a Julia script.
+func (c *Config) PredictJulia() (script string, name string) {
+	script, name, ok := strings.Cut(c.Predict, JuliaExtension+":")
+	if !ok {
+		return "", ""
+	}
+	return script + JuliaExtension, name
+}
+
+func (c *Config) validateJulia(projectDir string) error {
+	if c.Build.JuliaVersion == "" {
+		if len(c.Build.JuliaPackages) > 0 {
+			return fmt.Errorf("build.julia_version must be set in cog.yaml to install julia_packages")
+		}
+	} else if !juliaVersionPattern.MatchString(c.Build.JuliaVersion) {
+		return fmt.Errorf("Invalid build.julia_version %q in cog.yaml, expected a version like '1.10' or '1.10.4', 'release' or 'lts'", c.Build.JuliaVersion)
+	}
+	for _, pkg := range c.Build.JuliaPackages {
+		if !juliaPackagePattern.MatchString(pkg) {
+			return fmt.Errorf("Invalid Julia package %q in build.julia_packages in cog.yaml, expected a package like 'Flux' or 'Flux@0.14.0'", pkg)
+		}
+	}
+
+	script, name := c.PredictJulia()
+	if script == "" {
+		return nil
+	}
+	if c.Build.JuliaVersion == "" {
+		return fmt.Errorf("build.julia_version must be set in cog.yaml to use the Julia predictor %s", c.Predict)
+	}
+	if err := c.validateScriptPredictor("a Julia predictor"); err != nil {
+		return err
+	}
+	return validateJuliaScript(filepath.Join(projectDir, script), name)
+}
+
+// validateJuliaScript returns an error if the Julia script at path doesn't define a function called name
+func validateJuliaScript(path string, name string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read Julia script: %w", err)
+	}
+	// Either function name(...) or the short form, name(...) = ...
+	definition := regexp.MustCompile(`(?m)^(function\s+` + regexp.QuoteMeta(name) + `\s*\(|` + regexp.QuoteMeta(name) + `\s*\(.*\)\s*(::\s*\S+\s*)?=[^=])`)
+	if !definition.Match(contents) {
+		return fmt.Errorf("%s doesn't define a function called %s. 'predict' in cog.yaml must point to a function defined at the top level of the script, like 'function %s(...)'", filepath.Base(path), name, name)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJuliaPredictorFromYAML(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.jl"), []byte(`
+using Flux
+
+function setup()
+    global model = load_model("model.bson")
+end
+
+function predict(x::Float64, n::Int = 5)
+    model(x) * n
+end
+`), 0o644))
+	config, err := FromYAML([]byte(`
+build:
+  julia_version: "1.10"
+  julia_packages:
+    - Flux
+    - BSON@0.3.9
+predict: predict.jl:predict
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(dir, nil))
+	require.Equal(t, "1.10", config.Build.JuliaVersion)
+	require.Equal(t, []string{"Flux", "BSON@0.3.9"}, config.Build.JuliaPackages)
+
+	script, name := config.PredictJulia()
+	require.Equal(t, "predict.jl", script)
+	require.Equal(t, "predict", name)
+	require.True(t, config.UsesRunner())
+	require.Equal(t, []string{"julia", JuliaServerPath, "predict.jl", "predict"}, config.ServerCommand())
+}
+
+func TestValidateJulia(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.jl"), []byte("predict(x::Int)::Int = 2x\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "long.jl"), []byte("function predict(x)\n    2x\nend\n"), 0o644))
+
+	for _, tt := range []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{"python predictor", Config{Build: &Build{}, Predict: "predict.py:Predictor"}, ""},
+		{"short form", Config{Build: &Build{JuliaVersion: "1.10.4"}, Predict: "predict.jl:predict"}, ""},
+		{"long form", Config{Build: &Build{JuliaVersion: "lts"}, Predict: "long.jl:predict"}, ""},
+		{"invalid version", Config{Build: &Build{JuliaVersion: "latest"}}, "Invalid build.julia_version"},
+		{"packages without version", Config{Build: &Build{JuliaPackages: []string{"Flux"}}}, "build.julia_version must be set in cog.yaml to install julia_packages"},
+		{"invalid package", Config{Build: &Build{JuliaVersion: "1.10", JuliaPackages: []string{"Flux\"]); run(`ls`"}}}, "Invalid Julia package"},
+		{"predictor without version", Config{Build: &Build{}, Predict: "predict.jl:predict"}, "build.julia_version must be set in cog.yaml to use the Julia predictor"},
+		{"missing script", Config{Build: &Build{JuliaVersion: "1.10"}, Predict: "missing.jl:predict"}, "Failed to read Julia script"},
+		{"missing function", Config{Build: &Build{JuliaVersion: "1.10"}, Predict: "predict.jl:run"}, "predict.jl doesn't define a function called run"},
+		{"train", Config{Build: &Build{JuliaVersion: "1.10"}, Predict: "predict.jl:predict", Train: "train.py:train"}, "'train' can't be set in cog.yaml with a Julia predictor"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateJulia(dir)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Licenses configures which licenses 'cog licenses' forbids the packages in the model's image to have
+type Licenses struct {
+	// Forbidden are SPDX license identifiers, like "AGPL-3.0-only", or patterns like "GPL-*"
+	Forbidden []string `json:"forbidden,omitempty" yaml:"forbidden"`
+	// Exceptions are the names of packages that are allowed whatever their license is, because they've been
+	// signed off
+	Exceptions []string `json:"exceptions,omitempty" yaml:"exceptions"`
+}
+
+func (l *Licenses) validate() error {
+	for _, pattern := range l.Forbidden {
+		if _, err := path.Match(pattern, ""); err != nil || strings.TrimSpace(pattern) == "" {
+			return fmt.Errorf("Invalid licenses.forbidden entry %q, expected an SPDX license identifier like 'AGPL-3.0-only' or a pattern like 'GPL-*'", pattern)
+		}
+	}
+	return nil
+}
+
+// IsForbidden returns whether a license identifier, like "GPL-3.0-only", matches one of the forbidden licenses. It's
+// not case sensitive, like SPDX identifiers.
+func (l *Licenses) IsForbidden(license string) bool {
+	if l == nil {
+		return false
+	}
+	for _, pattern := range l.Forbidden {
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(license)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsException returns whether a package is allowed whatever its license is
+func (l *Licenses) IsException(pkg string) bool {
+	if l == nil {
+		return false
+	}
+	for _, exception := range l.Exceptions {
+		if strings.EqualFold(exception, pkg) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLicensesValidate(t *testing.T) {
+	require.NoError(t, (&Licenses{Forbidden: []string{"AGPL-3.0-only", "GPL-*"}}).validate())
+	require.ErrorContains(t, (&Licenses{Forbidden: []string{"GPL-["}}).validate(), `Invalid licenses.forbidden entry "GPL-["`)
+	require.ErrorContains(t, (&Licenses{Forbidden: []string{""}}).validate(), "Invalid licenses.forbidden entry")
+}
+
+func TestLicensesIsForbidden(t *testing.T) {
+	licenses := &Licenses{Forbidden: []string{"AGPL-*", "gpl-3.0-only"}, Exceptions: []string{"PyQt5"}}
+	require.True(t, licenses.IsForbidden("AGPL-3.0-or-later"))
+	require.True(t, licenses.IsForbidden("GPL-3.0-only"))
+	require.False(t, licenses.IsForbidden("GPL-3.0-or-later"))
+	require.False(t, licenses.IsForbidden("MIT"))
+	require.True(t, licenses.IsException("pyqt5"))
+	require.False(t, licenses.IsException("torch"))
+
+	var none *Licenses
+	require.False(t, none.IsForbidden("AGPL-3.0-only"))
+	require.False(t, none.IsException("pyqt5"))
+}
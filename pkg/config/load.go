@@ -3,11 +3,12 @@ package config
 import (
 	"fmt"
 	"os"
-	"path"
 	"path/filepath"
+	"strings"
 
 	"github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/util/files"
 )
 
@@ -29,12 +30,18 @@ func GetProjectDir(customDir string) (string, error) {
 // Loads and instantiates a Config object
 // customDir can be specified to override the default - current working directory
 func GetConfig(customDir string) (*Config, string, error) {
+	return GetConfigWithBuildArgs(customDir, nil)
+}
+
+// GetConfigWithBuildArgs loads the config like GetConfig, for a build with buildArgs, the build args passed with
+// --build-arg, and checks they override ones in build.args
+func GetConfigWithBuildArgs(customDir string, buildArgs []string) (*Config, string, error) {
 	// Find the root project directory
 	rootDir, err := GetProjectDir(customDir)
 	if err != nil {
 		return nil, "", err
 	}
-	configPath := path.Join(rootDir, global.ConfigFilename)
+	configPath := filepath.Join(rootDir, global.ConfigFilename)
 
 	// Then try to load the config file from there
 	config, err := loadConfigFromFile(configPath)
@@ -42,9 +49,11 @@ func GetConfig(customDir string) (*Config, string, error) {
 		return nil, "", err
 	}
 
-	err = config.ValidateAndComplete(rootDir)
+	if err := config.ValidateAndComplete(rootDir, buildArgs); err != nil {
+		return config, rootDir, &errors.ConfigError{Path: configPath, Err: err}
+	}
 
-	return config, rootDir, err
+	return config, rootDir, nil
 }
 
 // Given a file path, attempt to load a config from that file
@@ -55,7 +64,7 @@ func loadConfigFromFile(file string) (*Config, error) {
 	}
 
 	if !exists {
-		return nil, fmt.Errorf("%s does not exist in %s. Are you in the right directory?", global.ConfigFilename, filepath.Dir(file))
+		return nil, errors.ConfigNotFound(fmt.Sprintf("%s does not exist in %s. Are you in the right directory?", global.ConfigFilename, filepath.Dir(file)))
 	}
 
 	contents, err := os.ReadFile(file)
@@ -63,9 +72,18 @@ func loadConfigFromFile(file string) (*Config, error) {
 		return nil, err
 	}
 
+	migrated, changes, err := Migrate(contents)
+	if err != nil {
+		return nil, &errors.ConfigError{Path: file, Err: err}
+	}
+	if len(changes) > 0 {
+		console.Warnf("%s uses an old layout, so Cog %s when loading it. Run 'cog migrate' to update it.", global.ConfigFilename, strings.Join(changes, " and "))
+		contents = migrated
+	}
+
 	config, err := FromYAML(contents)
 	if err != nil {
-		return nil, err
+		return nil, &errors.ConfigError{Path: file, Err: err}
 	}
 
 	return config, nil
@@ -74,7 +92,7 @@ func loadConfigFromFile(file string) (*Config, error) {
 
 // Given a directory, find the cog config file in that directory
 func findConfigPathInDirectory(dir string) (configPath string, err error) {
-	filePath := path.Join(dir, global.ConfigFilename)
+	filePath := filepath.Join(dir, global.ConfigFilename)
 	exists, err := files.Exists(filePath)
 	if err != nil {
 		return "", fmt.Errorf("Failed to scan directory %s for %s: %s", dir, filePath, err)
@@ -95,7 +113,8 @@ func findProjectRootDir(startDir string) (string, error) {
 			return "", err
 		case err == nil:
 			return dir, nil
-		case dir == "." || dir == "/":
+		case dir == "." || filepath.Dir(dir) == dir:
+			// filepath.Dir of a root directory, like "/" or `C:\`, is itself
 			return "", errors.ConfigNotFound(fmt.Sprintf("%s not found in %s (or in any parent directories)", global.ConfigFilename, startDir))
 		}
 
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/errors"
 )
 
 const testConfig = `
@@ -64,3 +66,15 @@ func TestFindProjectRootDirShouldReturnErrIfNoConfig(t *testing.T) {
 	_, err = findProjectRootDir(subdir)
 	require.Error(t, err)
 }
+
+func TestGetConfigReturnsConfigError(t *testing.T) {
+	dir := t.TempDir()
+
+	err := os.WriteFile(path.Join(dir, "cog.yaml"), []byte("build:\n  python_version: [\"3.8\"]\n"), 0o644)
+	require.NoError(t, err)
+	_, _, err = GetConfig(dir)
+	var configErr *errors.ConfigError
+	require.ErrorAs(t, err, &configErr)
+	require.Equal(t, path.Join(dir, "cog.yaml"), configErr.Path)
+	require.Equal(t, errors.CodeConfigInvalid, errors.Code(err))
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentConfigVersion is the version of the layout of cog.yaml that this version of Cog uses, which is set in
+// config_version. cog.yaml without config_version is version 1.
+const CurrentConfigVersion = 2
+
+// migration upgrades the layout of cog.yaml by one version. It changes the document in place, and returns a
+// description of each change it made.
+type migration func(doc *yaml.Node) ([]string, error)
+
+// migrations upgrade cog.yaml from the version at their index plus one to the next version
+var migrations = []migration{
+	migrateV1,
+}
+
+// Migrate upgrades cog.yaml to the current layout, keeping its comments. It returns the upgraded cog.yaml, with
+// config_version set, and a description of each change, apart from setting config_version. If cog.yaml is already
+// up to date, it's returned as it is.
+func Migrate(contents []byte) ([]byte, []string, error) {
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(contents, doc); err != nil {
+		return nil, nil, fmt.Errorf("Failed to parse config yaml: %w", err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		// Empty, or not a mapping, which is an error when it's loaded
+		return contents, nil, nil
+	}
+	root := doc.Content[0]
+
+	version := 1
+	if node := mappingValue(root, "config_version"); node != nil {
+		v, err := strconv.Atoi(node.Value)
+		if err != nil || v < 1 {
+			return nil, nil, fmt.Errorf("Invalid config_version %q in cog.yaml, expected a number like %d", node.Value, CurrentConfigVersion)
+		}
+		version = v
+	}
+	if version > CurrentConfigVersion {
+		return nil, nil, fmt.Errorf("cog.yaml has config_version %d, but this version of Cog only supports up to %d. Upgrade Cog to build this model", version, CurrentConfigVersion)
+	}
+	if version == CurrentConfigVersion {
+		return contents, nil, nil
+	}
+
+	changes := []string{}
+	for _, migrate := range migrations[version-1:] {
+		c, err := migrate(root)
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, c...)
+	}
+	setConfigVersion(root)
+
+	migrated, err := encodeConfigYAML(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return migrated, changes, nil
+}
+
+// migrateV1 renames the keys from before build and predict were called that
+func migrateV1(root *yaml.Node) ([]string, error) {
+	changes := []string{}
+	for _, rename := range []struct{ from, to string }{
+		{"environment", "build"},
+		{"model", "predict"},
+	} {
+		key := mappingKey(root, rename.from)
+		if key == nil {
+			continue
+		}
+		if mappingKey(root, rename.to) != nil {
+			return nil, fmt.Errorf("cog.yaml has both '%s' and '%s'. '%s' is the old name for '%s', so merge it into '%s'", rename.from, rename.to, rename.from, rename.to, rename.to)
+		}
+		key.Value = rename.to
+		changes = append(changes, fmt.Sprintf("renamed '%s' to '%s'", rename.from, rename.to))
+	}
+	return changes, nil
+}
+
+// setConfigVersion sets config_version to the current version, adding it to the start of cog.yaml if it isn't there
+func setConfigVersion(root *yaml.Node) {
+	value := strconv.Itoa(CurrentConfigVersion)
+	if node := mappingValue(root, "config_version"); node != nil {
+		node.Value = value
+		return
+	}
+	root.Content = append([]*yaml.Node{
+		{Kind: yaml.ScalarNode, Tag: "!!str", Value: "config_version"},
+		{Kind: yaml.ScalarNode, Tag: "!!int", Value: value},
+	}, root.Content...)
+}
+
+// mappingKey returns the node of key in a mapping, or nil if it isn't there
+func mappingKey(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the node of the value of key in a mapping, or nil if it isn't there
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(`# The model's environment
+environment:
+  python_version: "3.11"
+  # For the model
+  python_packages:
+    - torch==2.3.1
+model: "predict.py:Predictor" # the predictor
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"renamed 'environment' to 'build'", "renamed 'model' to 'predict'"}, changes)
+	require.Equal(t, `config_version: 2
+# The model's environment
+build:
+  python_version: "3.11"
+  # For the model
+  python_packages:
+    - torch==2.3.1
+predict: "predict.py:Predictor" # the predictor
+`, string(migrated))
+
+	config, err := FromYAML(migrated)
+	require.NoError(t, err)
+	require.Equal(t, CurrentConfigVersion, config.ConfigVersion)
+	require.Equal(t, "predict.py:Predictor", config.Predict)
+	require.Equal(t, "3.11", config.Build.PythonVersion)
+
+	// Migrating again changes nothing
+	again, changes, err := Migrate(migrated)
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	require.Equal(t, string(migrated), string(again))
+}
+
+func TestMigrateOnlySetsConfigVersion(t *testing.T) {
+	migrated, changes, err := Migrate([]byte("build:\n  gpu: true\npredict: predict.py:Predictor\n"))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	require.Equal(t, "config_version: 2\nbuild:\n  gpu: true\npredict: predict.py:Predictor\n", string(migrated))
+}
+
+func TestMigrateErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		contents string
+		err      string
+	}{
+		{"newer version", "config_version: 3\n", "cog.yaml has config_version 3, but this version of Cog only supports up to 2"},
+		{"invalid version", "config_version: latest\n", `Invalid config_version "latest" in cog.yaml`},
+		{"old and new keys", "environment:\n  gpu: true\nbuild:\n  gpu: false\n", "cog.yaml has both 'environment' and 'build'"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := Migrate([]byte(tt.contents))
+			require.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestMigrateEmpty(t *testing.T) {
+	migrated, changes, err := Migrate([]byte(""))
+	require.NoError(t, err)
+	require.Empty(t, changes)
+	require.Equal(t, "", string(migrated))
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ServedModel is one of the other models the server runs alongside the one in 'predict', at
+// /models/<name>/predictions. It's loaded the first time a prediction is run on it.
+type ServedModel struct {
+	// Name is the model's name in the URL of its endpoint
+	Name string `json:"name" yaml:"name"`
+	// Predict is the predictor in the project that runs the model, like "upscale.py:Predictor"
+	Predict string `json:"predict" yaml:"predict"`
+	// Memory is how much memory the model uses when it's loaded, like "8Gi", or "" to measure it
+	Memory string `json:"memory,omitempty" yaml:"memory"`
+}
+
+// ModelLimits configures how many of the models in 'models' the server keeps loaded at once. When loading a model
+// would go over them, the least recently used models that aren't running predictions are unloaded.
+type ModelLimits struct {
+	MaxLoaded int    `json:"max_loaded,omitempty" yaml:"max_loaded"`
+	MaxMemory string `json:"max_memory,omitempty" yaml:"max_memory"`
+}
+
+var modelNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+func (c *Config) validateModels() error {
+	if c.Serve != nil && c.Serve.Models != nil {
+		if len(c.Models) == 0 {
+			return fmt.Errorf("serve.models can only be set in cog.yaml if 'models' is")
+		}
+		if err := c.Serve.Models.validate(); err != nil {
+			return err
+		}
+	}
+	if len(c.Models) == 0 {
+		return nil
+	}
+	if c.Predict == "" {
+		return fmt.Errorf("'models' in cog.yaml can only be set if 'predict' is")
+	}
+	seen := map[string]bool{}
+	for _, model := range c.Models {
+		if !modelNamePattern.MatchString(model.Name) {
+			return fmt.Errorf("Invalid model name %q in cog.yaml: it can only contain letters, numbers, '_', '.' and '-'", model.Name)
+		}
+		if seen[model.Name] {
+			return fmt.Errorf("There's more than one model called %s in 'models' in cog.yaml", model.Name)
+		}
+		seen[model.Name] = true
+		if _, _, ok := strings.Cut(model.Predict, ".py:"); !ok {
+			return fmt.Errorf("'predict' of model %s in cog.yaml must be in the form 'predict.py:Predictor'", model.Name)
+		}
+		if model.Memory != "" {
+			if _, err := ParseQuantity(model.Memory); err != nil {
+				return fmt.Errorf("Invalid memory of model %s in cog.yaml: %w", model.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (l *ModelLimits) validate() error {
+	if l.MaxLoaded < 0 {
+		return fmt.Errorf("serve.models.max_loaded can't be negative")
+	}
+	if l.MaxMemory != "" {
+		if _, err := ParseQuantity(l.MaxMemory); err != nil {
+			return fmt.Errorf("Invalid serve.models.max_memory: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestModelsFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+predict: predict.py:Predictor
+models:
+  - name: upscaler
+    predict: upscale.py:Predictor
+    memory: 4Gi
+  - name: sd-xl
+    predict: sdxl.py:Predictor
+serve:
+  models:
+    max_loaded: 1
+    max_memory: 20Gi
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, []ServedModel{
+		{Name: "upscaler", Predict: "upscale.py:Predictor", Memory: "4Gi"},
+		{Name: "sd-xl", Predict: "sdxl.py:Predictor"},
+	}, config.Models)
+	require.Equal(t, &ModelLimits{MaxLoaded: 1, MaxMemory: "20Gi"}, config.Serve.Models)
+}
+
+func TestModelsMissingPredict(t *testing.T) {
+	_, err := FromYAML([]byte(`
+predict: predict.py:Predictor
+models:
+  - name: upscaler
+`))
+	require.ErrorContains(t, err, "predict is required")
+}
+
+func TestValidateModels(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		predict string
+		models  []ServedModel
+		limits  *ModelLimits
+		err     string
+	}{
+		{"none", "predict.py:Predictor", nil, nil, ""},
+		{"valid", "predict.py:Predictor", []ServedModel{{Name: "sd-xl_1.0", Predict: "sdxl.py:Predictor"}}, &ModelLimits{MaxLoaded: 2}, ""},
+		{"without predict", "", []ServedModel{{Name: "a", Predict: "a.py:Predictor"}}, nil, "can only be set if 'predict' is"},
+		{"invalid name", "predict.py:Predictor", []ServedModel{{Name: "a/b", Predict: "a.py:Predictor"}}, nil, `Invalid model name "a/b"`},
+		{"duplicate name", "predict.py:Predictor", []ServedModel{{Name: "a", Predict: "a.py:Predictor"}, {Name: "a", Predict: "b.py:Predictor"}}, nil, "more than one model called a"},
+		{"invalid predict", "predict.py:Predictor", []ServedModel{{Name: "a", Predict: "a.R:predict"}}, nil, "'predict' of model a in cog.yaml must be in the form"},
+		{"invalid memory", "predict.py:Predictor", []ServedModel{{Name: "a", Predict: "a.py:Predictor", Memory: "lots"}}, nil, "Invalid memory of model a"},
+		{"limits without models", "predict.py:Predictor", nil, &ModelLimits{MaxLoaded: 1}, "serve.models can only be set in cog.yaml if 'models' is"},
+		{"negative max_loaded", "predict.py:Predictor", []ServedModel{{Name: "a", Predict: "a.py:Predictor"}}, &ModelLimits{MaxLoaded: -1}, "can't be negative"},
+		{"invalid max_memory", "predict.py:Predictor", []ServedModel{{Name: "a", Predict: "a.py:Predictor"}}, &ModelLimits{MaxMemory: "1 potato"}, "Invalid serve.models.max_memory"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Predict: tt.predict, Models: tt.models, Serve: &Serve{Models: tt.limits}}
+			err := config.validateModels()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
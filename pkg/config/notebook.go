@@ -0,0 +1,70 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// NotebookExtension is the extension of Jupyter notebooks, which a predictor can be defined in
+const NotebookExtension = ".ipynb"
+
+// PredictNotebook returns the Jupyter notebook that predict refers to, like "notebook.ipynb", and the name of the
+// predictor in it. notebook is "" if the predictor is in a Python file.
+func (c *Config) PredictNotebook() (notebook string, name string) {
+	notebook, name, ok := strings.Cut(c.Predict, NotebookExtension+":")
+	if !ok {
+		return "", ""
+	}
+	return notebook + NotebookExtension, name
+}
+
+// notebookCell is a cell of a Jupyter notebook. Its source is either a string or a list of lines.
+type notebookCell struct {
+	CellType string          `json:"cell_type"`
+	Source   json.RawMessage `json:"source"`
+}
+
+// validateNotebook returns an error if the notebook at path doesn't define a class or function called name
+func validateNotebook(path string, name string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read notebook: %w", err)
+	}
+	var notebook struct {
+		Cells []notebookCell `json:"cells"`
+	}
+	if err := json.Unmarshal(contents, &notebook); err != nil {
+		return fmt.Errorf("%s isn't a valid Jupyter notebook: %w", filepath.Base(path), err)
+	}
+
+	definition := regexp.MustCompile(`(?m)^(class|def|async def)\s+` + regexp.QuoteMeta(name) + `\b`)
+	for _, cell := range notebook.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+		source, err := cellSource(cell.Source)
+		if err != nil {
+			return fmt.Errorf("%s isn't a valid Jupyter notebook: %w", filepath.Base(path), err)
+		}
+		if definition.MatchString(source) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s doesn't define %s. 'predict' in cog.yaml must point to a class or function defined at the top level of one of its code cells", filepath.Base(path), name)
+}
+
+func cellSource(raw json.RawMessage) (string, error) {
+	var source string
+	if err := json.Unmarshal(raw, &source); err == nil {
+		return source, nil
+	}
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return "", fmt.Errorf("Cell source must be a string or a list of strings")
+	}
+	return strings.Join(lines, ""), nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testNotebook = `{
+  "cells": [
+    {"cell_type": "markdown", "metadata": {}, "source": ["class Model:\n"]},
+    {"cell_type": "code", "metadata": {}, "outputs": [], "source": ["import torch\n", "%matplotlib inline"]},
+    {"cell_type": "code", "metadata": {}, "outputs": [], "source": "from cog import BasePredictor\n\nclass Predictor(BasePredictor):\n    def predict(self, prompt: str) -> str:\n        return prompt\n"}
+  ],
+  "metadata": {},
+  "nbformat": 4,
+  "nbformat_minor": 5
+}`
+
+func TestPredictNotebook(t *testing.T) {
+	notebook, name := (&Config{Predict: "notebooks/model.ipynb:Predictor"}).PredictNotebook()
+	require.Equal(t, "notebooks/model.ipynb", notebook)
+	require.Equal(t, "Predictor", name)
+
+	notebook, _ = (&Config{Predict: "predict.py:Predictor"}).PredictNotebook()
+	require.Equal(t, "", notebook)
+}
+
+func TestValidateNotebook(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "model.ipynb"), []byte(testNotebook), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.ipynb"), []byte("{"), 0o644))
+
+	for _, tt := range []struct {
+		predict string
+		err     string
+	}{
+		{"model.ipynb:Predictor", ""},
+		// Markdown cells aren't code
+		{"model.ipynb:Model", "model.ipynb doesn't define Model"},
+		{"broken.ipynb:Predictor", "broken.ipynb isn't a valid Jupyter notebook"},
+		{"missing.ipynb:Predictor", "Failed to read notebook"},
+	} {
+		config := DefaultConfig()
+		config.Predict = tt.predict
+		err := config.ValidateAndComplete(dir, nil)
+		if tt.err == "" {
+			require.NoError(t, err, tt.predict)
+		} else {
+			require.ErrorContains(t, err, tt.err, tt.predict)
+		}
+	}
+}
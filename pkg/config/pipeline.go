@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PipelineStep is a model in a pipeline. Its inputs can come from the pipeline's inputs or the outputs of the steps
+// before it.
+type PipelineStep struct {
+	// Name is how later steps refer to this step's output, like $transcribe.output
+	Name string `json:"name" yaml:"name"`
+	// Predict is the predictor in the project that runs this step, like "asr.py:Predictor"
+	Predict string `json:"predict,omitempty" yaml:"predict"`
+	// Image is a Cog image that runs this step, like "r8.im/openai/whisper"
+	Image string `json:"image,omitempty" yaml:"image"`
+	// Inputs are the step's inputs, by name. Values are either references, like $input.audio or
+	// $transcribe.output.text, or literal values.
+	Inputs map[string]any `json:"inputs,omitempty" yaml:"inputs"`
+}
+
+// ErrPipelineOfImages is returned when building or serving a pipeline of images, which is only run by `cog predict`
+var ErrPipelineOfImages = errors.New("The steps of the pipeline in cog.yaml are images, which run in containers of their own, so it can't be built into an image. Run it with 'cog predict'")
+
+// PipelineInput is the name of the reference to the pipeline's own inputs, like $input.audio
+const PipelineInput = "input"
+
+// PipelineReference is a reference in a pipeline step's inputs to one of the pipeline's inputs, like $input.audio, or
+// another step's output, like $transcribe.output or $transcribe.output.text
+type PipelineReference struct {
+	// Step is the name of the step whose output is referred to, or "input" for the pipeline's inputs
+	Step string
+	// Field is the name of the pipeline input, or the field of the step's output. It's "" for a step's whole output.
+	Field string
+}
+
+var (
+	pipelineNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	pipelineReferencePattern = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)(?:\.([A-Za-z_][A-Za-z0-9_]*))?(?:\.([A-Za-z_][A-Za-z0-9_]*))?$`)
+)
+
+// ParsePipelineReference returns the reference that value is, and whether it is one. Strings starting with "$" are
+// references, apart from ones starting with "$$", which are literal strings starting with "$".
+func ParsePipelineReference(value any) (ref PipelineReference, ok bool, err error) {
+	s, isString := value.(string)
+	if !isString || !strings.HasPrefix(s, "$") || strings.HasPrefix(s, "$$") {
+		return PipelineReference{}, false, nil
+	}
+	match := pipelineReferencePattern.FindStringSubmatch(s)
+	if match == nil {
+		return PipelineReference{}, false, fmt.Errorf("Invalid reference %q, expected $input.<name>, $<step>.output or $<step>.output.<field>", s)
+	}
+	step, second, third := match[1], match[2], match[3]
+	if step == PipelineInput {
+		if second == "" || third != "" {
+			return PipelineReference{}, false, fmt.Errorf("Invalid reference %q, expected $input.<name>", s)
+		}
+		return PipelineReference{Step: step, Field: second}, true, nil
+	}
+	if second != "output" {
+		return PipelineReference{}, false, fmt.Errorf("Invalid reference %q, expected $%s.output or $%s.output.<field>", s, step, step)
+	}
+	return PipelineReference{Step: step, Field: third}, true, nil
+}
+
+// PipelineLiteral returns a literal value in a step's inputs as it's passed to the model, with "$$" at the start
+// of strings unescaped to "$"
+func PipelineLiteral(value any) any {
+	if s, ok := value.(string); ok && strings.HasPrefix(s, "$$") {
+		return s[1:]
+	}
+	return value
+}
+
+// PipelineOfImages returns whether the pipeline's steps are Cog images, which are run in containers of their own,
+// rather than predictors in the project, which are built into one image
+func (c *Config) PipelineOfImages() bool {
+	return len(c.Pipeline) > 0 && c.Pipeline[0].Image != ""
+}
+
+// PipelineInputs returns the names of the pipeline's inputs, in the order they're first referred to
+func (c *Config) PipelineInputs() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, step := range c.Pipeline {
+		for _, name := range slices.Sorted(maps.Keys(step.Inputs)) {
+			ref, ok, _ := ParsePipelineReference(step.Inputs[name])
+			if ok && ref.Step == PipelineInput && !seen[ref.Field] {
+				seen[ref.Field] = true
+				names = append(names, ref.Field)
+			}
+		}
+	}
+	return names
+}
+
+func (c *Config) validatePipeline() error {
+	if len(c.Pipeline) == 0 {
+		return nil
+	}
+	if c.Predict != "" {
+		return fmt.Errorf("Only one of 'predict' or 'pipeline' can be set in cog.yaml, not both")
+	}
+
+	images := c.PipelineOfImages()
+	steps := map[string]bool{}
+	for i, step := range c.Pipeline {
+		if !pipelineNamePattern.MatchString(step.Name) {
+			return fmt.Errorf("Invalid name %q for step %d of the pipeline in cog.yaml, expected a name like 'transcribe'", step.Name, i+1)
+		}
+		if step.Name == PipelineInput {
+			return fmt.Errorf("A pipeline step can't be called %q", PipelineInput)
+		}
+		if steps[step.Name] {
+			return fmt.Errorf("There's more than one pipeline step called %s in cog.yaml", step.Name)
+		}
+		if (step.Predict == "") == (step.Image == "") {
+			return fmt.Errorf("Pipeline step %s must set one of 'predict' or 'image'", step.Name)
+		}
+		if (step.Image != "") != images {
+			return fmt.Errorf("Pipeline step %s can't be mixed with the others: the steps of a pipeline must either all be predictors in the project, or all be images", step.Name)
+		}
+		if step.Predict != "" && len(strings.Split(step.Predict, ".py:")) != 2 {
+			return fmt.Errorf("'predict' for pipeline step %s must be in the form 'predict.py:Predictor'", step.Name)
+		}
+		for _, name := range slices.Sorted(maps.Keys(step.Inputs)) {
+			ref, ok, err := ParsePipelineReference(step.Inputs[name])
+			if err != nil {
+				return fmt.Errorf("Invalid input %s for pipeline step %s: %w", name, step.Name, err)
+			}
+			if ok && ref.Step != PipelineInput && !steps[ref.Step] {
+				return fmt.Errorf("Input %s for pipeline step %s refers to %s, which isn't a step before it", name, step.Name, ref.Step)
+			}
+		}
+		steps[step.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipelineFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+pipeline:
+  - name: transcribe
+    predict: asr.py:Predictor
+    inputs:
+      audio: $input.audio
+  - name: translate
+    predict: translate.py:Predictor
+    inputs:
+      text: $transcribe.output.text
+      target: $input.language
+      beam_size: 4
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Len(t, config.Pipeline, 2)
+	require.Equal(t, "translate.py:Predictor", config.Pipeline[1].Predict)
+	require.Equal(t, 4, config.Pipeline[1].Inputs["beam_size"])
+	require.False(t, config.PipelineOfImages())
+	require.Equal(t, []string{"audio", "language"}, config.PipelineInputs())
+}
+
+func TestParsePipelineReference(t *testing.T) {
+	for _, tt := range []struct {
+		value any
+		ref   PipelineReference
+		ok    bool
+		err   string
+	}{
+		{"$input.audio", PipelineReference{Step: "input", Field: "audio"}, true, ""},
+		{"$transcribe.output", PipelineReference{Step: "transcribe"}, true, ""},
+		{"$transcribe.output.text", PipelineReference{Step: "transcribe", Field: "text"}, true, ""},
+		{"hello", PipelineReference{}, false, ""},
+		{"$$5", PipelineReference{}, false, ""},
+		{4, PipelineReference{}, false, ""},
+		{"$input", PipelineReference{}, false, "expected $input.<name>"},
+		{"$input.audio.data", PipelineReference{}, false, "expected $input.<name>"},
+		{"$transcribe.text", PipelineReference{}, false, "expected $transcribe.output or $transcribe.output.<field>"},
+		{"$transcribe.output[0]", PipelineReference{}, false, "Invalid reference"},
+	} {
+		ref, ok, err := ParsePipelineReference(tt.value)
+		if tt.err != "" {
+			require.ErrorContains(t, err, tt.err, tt.value)
+			continue
+		}
+		require.NoError(t, err, tt.value)
+		require.Equal(t, tt.ok, ok, tt.value)
+		require.Equal(t, tt.ref, ref, tt.value)
+	}
+	require.Equal(t, "$5", PipelineLiteral("$$5"))
+	require.Equal(t, 5, PipelineLiteral(5))
+}
+
+func TestValidatePipeline(t *testing.T) {
+	asr := PipelineStep{Name: "transcribe", Predict: "asr.py:Predictor", Inputs: map[string]any{"audio": "$input.audio"}}
+	for _, tt := range []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{"valid", Config{Pipeline: []PipelineStep{asr}}, ""},
+		{"images", Config{Pipeline: []PipelineStep{{Name: "a", Image: "r8.im/a"}, {Name: "b", Image: "r8.im/b", Inputs: map[string]any{"x": "$a.output"}}}}, ""},
+		{"predict too", Config{Predict: "predict.py:Predictor", Pipeline: []PipelineStep{asr}}, "Only one of 'predict' or 'pipeline'"},
+		{"invalid name", Config{Pipeline: []PipelineStep{{Name: "speech-to-text", Predict: "asr.py:Predictor"}}}, `Invalid name "speech-to-text" for step 1`},
+		{"called input", Config{Pipeline: []PipelineStep{{Name: "input", Predict: "asr.py:Predictor"}}}, `can't be called "input"`},
+		{"duplicate", Config{Pipeline: []PipelineStep{asr, asr}}, "more than one pipeline step called transcribe"},
+		{"neither", Config{Pipeline: []PipelineStep{{Name: "a"}}}, "must set one of 'predict' or 'image'"},
+		{"both", Config{Pipeline: []PipelineStep{{Name: "a", Predict: "a.py:A", Image: "r8.im/a"}}}, "must set one of 'predict' or 'image'"},
+		{"mixed", Config{Pipeline: []PipelineStep{asr, {Name: "b", Image: "r8.im/b"}}}, "can't be mixed with the others"},
+		{"invalid predict", Config{Pipeline: []PipelineStep{{Name: "a", Predict: "asr"}}}, "must be in the form 'predict.py:Predictor'"},
+		{"later step", Config{Pipeline: []PipelineStep{{Name: "a", Predict: "a.py:A", Inputs: map[string]any{"x": "$b.output"}}, {Name: "b", Predict: "b.py:B"}}}, "refers to b, which isn't a step before it"},
+		{"itself", Config{Pipeline: []PipelineStep{{Name: "a", Predict: "a.py:A", Inputs: map[string]any{"x": "$a.output"}}}}, "refers to a, which isn't a step before it"},
+		{"invalid reference", Config{Pipeline: []PipelineStep{{Name: "a", Predict: "a.py:A", Inputs: map[string]any{"x": "$input"}}}}, "Invalid input x for pipeline step a"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validatePipeline()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var predictMethodPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedPredictMethods are the predictor's methods that Cog calls itself, so can't be served as predict methods
+var reservedPredictMethods = map[string]bool{
+	"predict": true,
+	"setup":   true,
+}
+
+// validatePredictMethods checks predict_methods, the methods of the predictor other than predict() that are served as
+// their own endpoints at /predictions/<method>
+func (c *Config) validatePredictMethods() error {
+	if len(c.PredictMethods) == 0 {
+		return nil
+	}
+	if c.Predict == "" {
+		return fmt.Errorf("'predict_methods' in cog.yaml can only be set if 'predict' is")
+	}
+	seen := map[string]bool{}
+	for _, method := range c.PredictMethods {
+		if !predictMethodPattern.MatchString(method) {
+			return fmt.Errorf("Invalid predict method %q in cog.yaml: it must be the name of a method of the predictor", method)
+		}
+		if reservedPredictMethods[method] {
+			return fmt.Errorf("%s() can't be in 'predict_methods' in cog.yaml", method)
+		}
+		if seen[method] {
+			return fmt.Errorf("%s is in 'predict_methods' in cog.yaml more than once", method)
+		}
+		seen[method] = true
+	}
+	return nil
+}
+
+// HasPredictMethod returns whether method is predict, or one of the predictor's other predict methods
+func (c *Config) HasPredictMethod(method string) bool {
+	if method == "predict" {
+		return true
+	}
+	for _, m := range c.PredictMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredictMethodsFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+predict: predict.py:Predictor
+predict_methods:
+  - generate
+  - embed
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, []string{"generate", "embed"}, config.PredictMethods)
+	require.True(t, config.HasPredictMethod("predict"))
+	require.True(t, config.HasPredictMethod("embed"))
+	require.False(t, config.HasPredictMethod("train"))
+}
+
+func TestValidatePredictMethods(t *testing.T) {
+	for _, tt := range []struct {
+		predict string
+		methods []string
+		err     string
+	}{
+		{"predict.py:Predictor", nil, ""},
+		{"predict.py:Predictor", []string{"generate_image", "_embed"}, ""},
+		{"", []string{"generate"}, "can only be set if 'predict' is"},
+		{"predict.py:Predictor", []string{"generate-image"}, `Invalid predict method "generate-image"`},
+		{"predict.py:Predictor", []string{"predictions/generate"}, `Invalid predict method "predictions/generate"`},
+		{"predict.py:Predictor", []string{"predict"}, "predict() can't be in 'predict_methods'"},
+		{"predict.py:Predictor", []string{"setup"}, "setup() can't be in 'predict_methods'"},
+		{"predict.py:Predictor", []string{"embed", "embed"}, "embed is in 'predict_methods' in cog.yaml more than once"},
+	} {
+		config := &Config{Predict: tt.predict, PredictMethods: tt.methods}
+		err := config.validatePredictMethods()
+		if tt.err == "" {
+			require.NoError(t, err)
+		} else {
+			require.ErrorContains(t, err, tt.err)
+		}
+	}
+}
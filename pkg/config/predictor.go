@@ -0,0 +1,226 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// predictorBases are the base classes of predictors that don't define methods the predictor needs, so a predictor
+// that only inherits from these has to define them itself
+var predictorBases = map[string]bool{
+	"":                  true,
+	"object":            true,
+	"BasePredictor":     true,
+	"cog.BasePredictor": true,
+}
+
+var (
+	pythonIndentPattern   = regexp.MustCompile(`^[ \t]*`)
+	pythonMethodPattern   = regexp.MustCompile(`^(?:async\s+)?def\s+([A-Za-z_][A-Za-z0-9_]*)\s*\(`)
+	pythonImportPattern   = regexp.MustCompile(`^(?:from\s+\S+\s+)?import\s+(.+)$`)
+	pythonTripleQuotes    = regexp.MustCompile(`"""|'''`)
+	pythonIdentifierChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789_"
+)
+
+// ValidatePredictor returns an error if the Python files that 'predict', 'train' and 'models' in cog.yaml point to
+// don't exist in projectDir, don't define the classes or functions they name, or if those classes haven't got the
+// methods Cog calls. It reads the files rather than running them, so it can be done before the model is built.
+func (c *Config) ValidatePredictor(projectDir string) error {
+	if c.UsesRunner() {
+		return nil
+	}
+	type predictorRef struct {
+		key     string
+		ref     string
+		methods []string
+	}
+	predictors := []predictorRef{
+		{"predict", c.Predict, append([]string{"predict"}, c.PredictMethods...)},
+		{"train", c.Train, []string{"train"}},
+	}
+	for _, model := range c.Models {
+		predictors = append(predictors, predictorRef{"models", model.Predict, []string{"predict"}})
+	}
+	errs := []error{}
+	for _, predictor := range predictors {
+		file, name, ok := strings.Cut(predictor.ref, ".py:")
+		if !ok {
+			continue
+		}
+		if err := validatePythonPredictor(projectDir, file+".py", name, predictor.key, predictor.methods); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validatePythonPredictor returns an error if the Python file at path, relative to projectDir, doesn't define name,
+// or if name is a class that hasn't got methods
+func validatePythonPredictor(projectDir string, path string, name string, key string, methods []string) error {
+	contents, err := os.ReadFile(filepath.Join(projectDir, path))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s doesn't exist. '%s' in cog.yaml must point to a Python file in the project, relative to cog.yaml", path, key)
+	} else if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+
+	lines := pythonCodeLines(string(contents))
+	for i, line := range lines {
+		// The name might be imported at the top of a try or if statement
+		if isPythonImport(line.code, name) {
+			return nil
+		}
+		if line.indent != "" {
+			continue
+		}
+		if isPythonFunction(line.code, name) || isPythonAssignment(line.code, name) {
+			return nil
+		}
+		bases, ok := pythonClassBases(line.code, name)
+		if !ok {
+			continue
+		}
+		defined := pythonClassMethods(lines[i+1:])
+		for _, method := range methods {
+			if defined[method] || !predictorBases[bases] {
+				// If the class has other base classes, one of them might define the method
+				continue
+			}
+			return fmt.Errorf("%s:%d: %s doesn't define %s(), which '%s' in cog.yaml needs", path, line.number, name, method, key)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s doesn't define %s. '%s' in cog.yaml must point to a class or function defined at the top level of %s", path, name, key, path)
+}
+
+// pythonLine is a line of Python code
+type pythonLine struct {
+	// number is the line's number in the file, starting at 1
+	number int
+	indent string
+	code   string
+}
+
+// pythonCodeLines returns the lines of Python source that have code on them, apart from the ones inside multi-line
+// strings
+func pythonCodeLines(source string) []pythonLine {
+	lines := []pythonLine{}
+	inString := false
+	inImport := false
+	for i, text := range strings.Split(source, "\n") {
+		quotes := len(pythonTripleQuotes.FindAllString(text, -1))
+		if inString {
+			inString = quotes%2 == 0
+			continue
+		}
+		inString = quotes%2 == 1
+		code := strings.TrimSpace(text)
+		if code == "" || strings.HasPrefix(code, "#") {
+			continue
+		}
+		if inImport {
+			// The names in "from model import (\n    Predictor,\n)" go on the line of the import
+			lines[len(lines)-1].code += " " + code
+			inImport = !strings.Contains(code, ")")
+			continue
+		}
+		lines = append(lines, pythonLine{number: i + 1, indent: pythonIndentPattern.FindString(text), code: code})
+		inImport = pythonImportPattern.MatchString(code) && strings.HasSuffix(code, "(")
+	}
+	return lines
+}
+
+// pythonClassBases returns the base classes in the class statement code, like "BasePredictor", if it defines a class
+// called name
+func pythonClassBases(code string, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(code, "class ")
+	if !ok {
+		return "", false
+	}
+	rest, ok = cutPythonName(strings.TrimSpace(rest), name)
+	if !ok {
+		return "", false
+	}
+	bases, ok := strings.CutPrefix(rest, "(")
+	if !ok {
+		return "", true
+	}
+	bases, _, ok = strings.Cut(bases, ")")
+	if !ok {
+		// The base classes are on the lines after the class statement
+		return "...", true
+	}
+	return strings.Join(strings.Fields(strings.TrimSuffix(strings.TrimSpace(bases), ",")), ""), true
+}
+
+// pythonClassMethods returns the names of the methods defined in the body of a class, which starts at the first of
+// lines
+func pythonClassMethods(lines []pythonLine) map[string]bool {
+	methods := map[string]bool{}
+	if len(lines) == 0 || lines[0].indent == "" {
+		return methods
+	}
+	indent := lines[0].indent
+	for _, line := range lines {
+		if !strings.HasPrefix(line.indent, indent) {
+			break
+		}
+		if line.indent != indent {
+			continue
+		}
+		if match := pythonMethodPattern.FindStringSubmatch(line.code); match != nil {
+			methods[match[1]] = true
+		}
+	}
+	return methods
+}
+
+// isPythonFunction returns whether code defines a function called name
+func isPythonFunction(code string, name string) bool {
+	rest, ok := strings.CutPrefix(code, "async ")
+	if ok {
+		code = strings.TrimSpace(rest)
+	}
+	rest, ok = strings.CutPrefix(code, "def ")
+	if !ok {
+		return false
+	}
+	rest, ok = cutPythonName(strings.TrimSpace(rest), name)
+	return ok && strings.HasPrefix(rest, "(")
+}
+
+// isPythonAssignment returns whether code assigns to name, like "Predictor = make_predictor()"
+func isPythonAssignment(code string, name string) bool {
+	rest, ok := cutPythonName(code, name)
+	return ok && strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "==")
+}
+
+// isPythonImport returns whether code imports name, like "from model import Predictor"
+func isPythonImport(code string, name string) bool {
+	match := pythonImportPattern.FindStringSubmatch(code)
+	if match == nil {
+		return false
+	}
+	for _, imported := range strings.Split(strings.Trim(match[1], "()"), ",") {
+		// "import model.Predictor as Predictor" or "from model import Model as Predictor"
+		fields := strings.Fields(imported)
+		if len(fields) > 0 && fields[len(fields)-1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// cutPythonName returns what comes after name at the start of code, with leading space trimmed, if code starts with
+// name as a whole identifier
+func cutPythonName(code string, name string) (string, bool) {
+	rest, ok := strings.CutPrefix(code, name)
+	if !ok || (rest != "" && strings.ContainsRune(pythonIdentifierChars, rune(rest[0]))) {
+		return "", false
+	}
+	return strings.TrimSpace(rest), true
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePredictor(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		source string
+		yaml   string
+		err    string
+	}{
+		{
+			name: "class",
+			source: `from cog import BasePredictor, Input
+
+
+class Predictor(BasePredictor):
+    """Runs the model"""
+
+    def setup(self):
+        self.model = load()
+
+    @torch.inference_mode()
+    def predict(self, prompt: str = Input(description="""The prompt
+def foo""")) -> str:
+        def helper():
+            pass
+        return self.model(prompt)
+`,
+		},
+		{
+			name:   "function",
+			source: "async def predict(prompt: str) -> str:\n    return prompt\n",
+			yaml:   "predict: predict.py:predict\n",
+		},
+		{
+			name:   "imported",
+			source: "from model import (\n    Model,\n    Predictor,\n)\n",
+		},
+		{
+			name:   "assigned",
+			source: "Predictor = make_predictor()\n",
+		},
+		{
+			name:   "inherited method",
+			source: "class Predictor(SDXLPredictor):\n    def setup(self):\n        pass\n",
+		},
+		{
+			name:   "missing class",
+			source: "class Model(BasePredictor):\n    def predict(self) -> str:\n        return ''\n",
+			err:    "predict.py doesn't define Predictor. 'predict' in cog.yaml must point to a class or function defined at the top level of predict.py",
+		},
+		{
+			name:   "class with a longer name",
+			source: "class PredictorBase(BasePredictor):\n    def predict(self) -> str:\n        return ''\n",
+			err:    "predict.py doesn't define Predictor",
+		},
+		{
+			name:   "missing predict method",
+			source: "import os\n\nclass Predictor(BasePredictor):\n    def setup(self):\n        def predict():\n            pass\n\ndef predict():\n    pass\n",
+			err:    "predict.py:3: Predictor doesn't define predict(), which 'predict' in cog.yaml needs",
+		},
+		{
+			name:   "missing predict method in predict_methods",
+			source: "class Predictor:\n    def predict(self) -> str:\n        return ''\n",
+			yaml:   "predict: predict.py:Predictor\npredict_methods: [embed]\n",
+			err:    "predict.py:1: Predictor doesn't define embed()",
+		},
+		{
+			name:   "missing train method",
+			source: "class Predictor(BasePredictor):\n    def predict(self) -> str:\n        return ''\n",
+			yaml:   "predict: predict.py:Predictor\ntrain: predict.py:Predictor\n",
+			err:    "predict.py:1: Predictor doesn't define train(), which 'train' in cog.yaml needs",
+		},
+		{
+			name:   "missing model",
+			source: "class Predictor(BasePredictor):\n    def predict(self) -> str:\n        return ''\n",
+			yaml:   "predict: predict.py:Predictor\nmodels:\n  - name: upscaler\n    predict: predict.py:Upscaler\n",
+			err:    "predict.py doesn't define Upscaler. 'models' in cog.yaml must point to",
+		},
+		{
+			name: "missing file",
+			yaml: "predict: infer.py:Predictor\n",
+			err:  "infer.py doesn't exist. 'predict' in cog.yaml must point to a Python file in the project, relative to cog.yaml",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.source != "" {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.py"), []byte(tt.source), 0o644))
+			}
+			yaml := tt.yaml
+			if yaml == "" {
+				yaml = "predict: predict.py:Predictor\n"
+			}
+			config, err := FromYAML([]byte(yaml))
+			require.NoError(t, err)
+
+			err = config.ValidatePredictor(dir)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
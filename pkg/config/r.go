@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// RExtension is the extension of R scripts, which a predictor can be defined in
+const RExtension = ".R"
+
+// RServerPath is where the server for R predictors goes in the image. It's outside /src so it's still there when the
+// project directory is mounted over /src.
+const RServerPath = "/opt/cog/r/server.R"
+
+var (
+	rVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?$`)
+	rPackagePattern = regexp.MustCompile(`^[^\s'"\\]+$`)
+)
+
+// PredictR returns the R script that predict refers to, like "predict.R", and the name of the function in it that
+// runs predictions. script is "" if the predictor isn't in an R script.
+func (c *Config) PredictR() (script string, name string) {
+	script, name, ok := strings.Cut(c.Predict, RExtension+":")
+	if !ok {
+		return "", ""
+	}
+	return script + RExtension, name
+}
+
+func (c *Config) validateR(projectDir string) error {
+	if c.Build.RVersion == "" {
+		if len(c.Build.RPackages) > 0 {
+			return fmt.Errorf("build.r_version must be set in cog.yaml to install r_packages")
+		}
+	} else if !rVersionPattern.MatchString(c.Build.RVersion) {
+		return fmt.Errorf("Invalid build.r_version %q in cog.yaml, expected a version like '4.4' or '4.4.1'", c.Build.RVersion)
+	}
+	for _, pkg := range c.Build.RPackages {
+		if !rPackagePattern.MatchString(pkg) {
+			return fmt.Errorf("Invalid R package %q in build.r_packages in cog.yaml, expected a package like 'ranger' or 'ranger@0.16.0'", pkg)
+		}
+	}
+
+	script, name := c.PredictR()
+	if script == "" {
+		return nil
+	}
+	if c.Build.RVersion == "" {
+		return fmt.Errorf("build.r_version must be set in cog.yaml to use the R predictor %s", c.Predict)
+	}
+	if err := c.validateScriptPredictor("an R predictor"); err != nil {
+		return err
+	}
+	return validateRScript(filepath.Join(projectDir, script), name)
+}
+
+// validateRScript returns an error if the R script at path doesn't define a function called name
+func validateRScript(path string, name string) error {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read R script: %w", err)
+	}
+	definition := regexp.MustCompile(`(?m)^` + regexp.QuoteMeta(name) + `\s*(<-|=)\s*function\b`)
+	if !definition.Match(contents) {
+		return fmt.Errorf("%s doesn't define a function called %s. 'predict' in cog.yaml must point to a function defined at the top level of the script, like '%s <- function(...)'", filepath.Base(path), name, name)
+	}
+	return nil
+}
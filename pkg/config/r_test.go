@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPredictorFromYAML(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.R"), []byte(`
+setup <- function() {
+  model <<- readRDS("model.rds")
+}
+
+predict <- function(x, n = 5L) {
+  x * n
+}
+`), 0o644))
+	config, err := FromYAML([]byte(`
+build:
+  r_version: "4.4"
+  r_packages:
+    - ranger
+    - jsonlite@1.8.8
+predict: predict.R:predict
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete(dir, nil))
+	require.Equal(t, "4.4", config.Build.RVersion)
+	require.Equal(t, []string{"ranger", "jsonlite@1.8.8"}, config.Build.RPackages)
+
+	script, name := config.PredictR()
+	require.Equal(t, "predict.R", script)
+	require.Equal(t, "predict", name)
+	require.True(t, config.UsesRunner())
+	require.Equal(t, []string{"Rscript", RServerPath, "predict.R", "predict"}, config.ServerCommand())
+}
+
+func TestPredictRWithPythonPredictor(t *testing.T) {
+	config := &Config{Predict: "predict.py:Predictor"}
+	script, name := config.PredictR()
+	require.Equal(t, "", script)
+	require.Equal(t, "", name)
+	require.False(t, config.UsesRunner())
+}
+
+func TestValidateR(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "predict.R"), []byte("predict = function(x) x\n"), 0o644))
+
+	for _, tt := range []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{"python predictor", Config{Build: &Build{}, Predict: "predict.py:Predictor"}, ""},
+		{"r for python", Config{Build: &Build{RVersion: "4.4.1", RPackages: []string{"ranger"}}, Predict: "predict.py:Predictor"}, ""},
+		{"r predictor", Config{Build: &Build{RVersion: "4.4"}, Predict: "predict.R:predict"}, ""},
+		{"invalid version", Config{Build: &Build{RVersion: "latest"}}, "Invalid build.r_version"},
+		{"packages without version", Config{Build: &Build{RPackages: []string{"ranger"}}}, "build.r_version must be set in cog.yaml to install r_packages"},
+		{"invalid package", Config{Build: &Build{RVersion: "4.4", RPackages: []string{"ranger'); system('ls"}}}, "Invalid R package"},
+		{"predictor without version", Config{Build: &Build{}, Predict: "predict.R:predict"}, "build.r_version must be set in cog.yaml to use the R predictor"},
+		{"missing script", Config{Build: &Build{RVersion: "4.4"}, Predict: "missing.R:predict"}, "Failed to read R script"},
+		{"missing function", Config{Build: &Build{RVersion: "4.4"}, Predict: "predict.R:run"}, "predict.R doesn't define a function called run"},
+		{"train", Config{Build: &Build{RVersion: "4.4"}, Predict: "predict.R:predict", Train: "train.py:train"}, "'train' can't be set in cog.yaml with an R predictor"},
+		{"predict methods", Config{Build: &Build{RVersion: "4.4"}, Predict: "predict.R:predict", PredictMethods: []string{"embed"}}, "'predict_methods' can't be set"},
+		{"concurrency", Config{Build: &Build{RVersion: "4.4"}, Predict: "predict.R:predict", Concurrency: &Concurrency{Max: 2}}, "'concurrency' can't be set"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateR(dir)
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+// DefaultStateDir is where models with a read-only root filesystem write their state, if build.state_dir isn't set
+const DefaultStateDir = "/tmp"
+
+func (b *Build) validateReadOnlyRootFilesystem() error {
+	if b.StateDir == "" {
+		return nil
+	}
+	if !b.ReadOnlyRootFilesystem {
+		return fmt.Errorf("build.state_dir can only be set when build.read_only_root_filesystem is true")
+	}
+	if !path.IsAbs(b.StateDir) || path.Clean(b.StateDir) == "/" || path.Clean(b.StateDir) == "/src" {
+		return fmt.Errorf("Invalid build.state_dir %q, expected an absolute path like '/var/lib/model' that isn't / or /src", b.StateDir)
+	}
+	return nil
+}
+
+// StateDir returns the directory the model writes its state to at runtime, like caches and temporary files, if it
+// runs with a read-only root filesystem, or "" if it doesn't
+func (c *Config) StateDir() string {
+	if c.Build == nil || !c.Build.ReadOnlyRootFilesystem {
+		return ""
+	}
+	if c.Build.StateDir != "" {
+		return path.Clean(c.Build.StateDir)
+	}
+	return DefaultStateDir
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReadOnlyRootFilesystem(t *testing.T) {
+	for _, tt := range []struct {
+		build    Build
+		expected string
+	}{
+		{Build{}, ""},
+		{Build{ReadOnlyRootFilesystem: true}, ""},
+		{Build{ReadOnlyRootFilesystem: true, StateDir: "/var/lib/model"}, ""},
+		{Build{StateDir: "/var/lib/model"}, "build.state_dir can only be set when build.read_only_root_filesystem is true"},
+		{Build{ReadOnlyRootFilesystem: true, StateDir: "state"}, `Invalid build.state_dir "state"`},
+		{Build{ReadOnlyRootFilesystem: true, StateDir: "/src/"}, `Invalid build.state_dir "/src/"`},
+	} {
+		err := tt.build.validateReadOnlyRootFilesystem()
+		if tt.expected == "" {
+			require.NoError(t, err)
+		} else {
+			require.ErrorContains(t, err, tt.expected)
+		}
+	}
+}
+
+func TestStateDir(t *testing.T) {
+	require.Equal(t, "", (&Config{Build: &Build{}}).StateDir())
+	require.Equal(t, DefaultStateDir, (&Config{Build: &Build{ReadOnlyRootFilesystem: true}}).StateDir())
+	require.Equal(t, "/var/lib/model", (&Config{Build: &Build{ReadOnlyRootFilesystem: true, StateDir: "/var/lib/model/"}}).StateDir())
+}
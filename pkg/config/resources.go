@@ -0,0 +1,201 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var quantityRegex = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)?)\s*([kKmMgGtT]?)(i?)[bB]?$`)
+
+// Resources describes the hardware a model needs to run. It is the single source of truth for sizing:
+// it's applied as limits when running the model locally, and propagated to generated deployment manifests.
+type Resources struct {
+	CPU      float64 `json:"cpu,omitempty" yaml:"cpu"`
+	Memory   string  `json:"memory,omitempty" yaml:"memory"`
+	GPUCount int     `json:"gpu_count,omitempty" yaml:"gpu_count"`
+	GPUType  string  `json:"gpu_type,omitempty" yaml:"gpu_type"`
+	Disk     string  `json:"disk,omitempty" yaml:"disk"`
+	// ShmSize is the size of /dev/shm. Docker's default of 64MB is too small for PyTorch's DataLoader workers, which
+	// pass batches to each other through it.
+	ShmSize string  `json:"shm_size,omitempty" yaml:"shm_size"`
+	Tmpfs   []Tmpfs `json:"tmpfs,omitempty" yaml:"tmpfs"`
+	// GPUSharing is how the model shares GPUs with other models on Kubernetes
+	GPUSharing *GPUSharing `json:"gpu_sharing,omitempty" yaml:"gpu_sharing"`
+}
+
+// Tmpfs is a directory in memory the model can use for scratch space
+type Tmpfs struct {
+	Path string `json:"path" yaml:"path"`
+	// Size is the most it can hold, or "" for half of the machine's memory
+	Size string `json:"size,omitempty" yaml:"size"`
+}
+
+func (r *Resources) validate(gpu bool) error {
+	if r.CPU < 0 {
+		return fmt.Errorf("resources.cpu must be a positive number, got %v", r.CPU)
+	}
+	if r.Memory != "" {
+		if _, err := ParseQuantity(r.Memory); err != nil {
+			return fmt.Errorf("Invalid resources.memory: %w", err)
+		}
+	}
+	if r.Disk != "" {
+		if _, err := ParseQuantity(r.Disk); err != nil {
+			return fmt.Errorf("Invalid resources.disk: %w", err)
+		}
+	}
+	if r.ShmSize != "" {
+		if _, err := ParseQuantity(r.ShmSize); err != nil {
+			return fmt.Errorf("Invalid resources.shm_size: %w", err)
+		}
+		// Shared memory counts towards the container's memory
+		if r.MemoryBytes() > 0 && r.ShmSizeBytes() > r.MemoryBytes() {
+			return fmt.Errorf("resources.shm_size (%s) can't be more than resources.memory (%s)", r.ShmSize, r.Memory)
+		}
+	}
+	paths := map[string]bool{}
+	for _, tmpfs := range r.Tmpfs {
+		if !path.IsAbs(tmpfs.Path) || path.Clean(tmpfs.Path) == "/" || path.Clean(tmpfs.Path) == "/src" {
+			return fmt.Errorf("Invalid resources.tmpfs path %q, expected an absolute path like '/scratch' that isn't / or /src", tmpfs.Path)
+		}
+		if paths[path.Clean(tmpfs.Path)] {
+			return fmt.Errorf("resources.tmpfs has %s more than once", tmpfs.Path)
+		}
+		paths[path.Clean(tmpfs.Path)] = true
+		if tmpfs.Size != "" {
+			if _, err := ParseQuantity(tmpfs.Size); err != nil {
+				return fmt.Errorf("Invalid resources.tmpfs size for %s: %w", tmpfs.Path, err)
+			}
+		}
+	}
+	if r.GPUCount < 0 {
+		return fmt.Errorf("resources.gpu_count must be a positive integer, got %d", r.GPUCount)
+	}
+	if (r.GPUCount > 0 || r.GPUType != "") && !gpu {
+		return fmt.Errorf("resources.gpu_count and resources.gpu_type require 'gpu: true' to be set in the 'build' section of cog.yaml")
+	}
+	if r.GPUSharing != nil {
+		if !gpu {
+			return fmt.Errorf("resources.gpu_sharing requires 'gpu: true' to be set in the 'build' section of cog.yaml")
+		}
+		if err := r.GPUSharing.validate(r.GPUCount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MemoryBytes returns the memory requirement in bytes, or 0 if none is set
+func (r *Resources) MemoryBytes() int64 {
+	if r == nil || r.Memory == "" {
+		return 0
+	}
+	// Validated in ValidateAndComplete
+	bytes, _ := ParseQuantity(r.Memory)
+	return bytes
+}
+
+// DiskBytes returns the disk requirement in bytes, or 0 if none is set
+func (r *Resources) DiskBytes() int64 {
+	if r == nil || r.Disk == "" {
+		return 0
+	}
+	bytes, _ := ParseQuantity(r.Disk)
+	return bytes
+}
+
+// ShmSizeBytes returns the size of /dev/shm in bytes, or 0 if none is set
+func (r *Resources) ShmSizeBytes() int64 {
+	if r == nil || r.ShmSize == "" {
+		return 0
+	}
+	bytes, _ := ParseQuantity(r.ShmSize)
+	return bytes
+}
+
+// SizeBytes returns the most the tmpfs can hold in bytes, or 0 if there's no limit
+func (t Tmpfs) SizeBytes() int64 {
+	if t.Size == "" {
+		return 0
+	}
+	bytes, _ := ParseQuantity(t.Size)
+	return bytes
+}
+
+// KubernetesResources returns the requests and limits of the container that runs the model on Kubernetes. Memory and
+// disk are limits as well as requests, so a model that uses more than it asked for is stopped, rather than starving
+// the other pods on its node.
+func (r *Resources) KubernetesResources(gpu bool) (requests map[string]string, limits map[string]string) {
+	requests = map[string]string{}
+	limits = map[string]string{}
+	if cpu := r.CPUString(); cpu != "" {
+		requests["cpu"] = cpu
+	}
+	if memory := r.MemoryBytes(); memory > 0 {
+		requests["memory"] = KubernetesQuantity(memory)
+		limits["memory"] = KubernetesQuantity(memory)
+	}
+	if disk := r.DiskBytes(); disk > 0 {
+		requests["ephemeral-storage"] = KubernetesQuantity(disk)
+		limits["ephemeral-storage"] = KubernetesQuantity(disk)
+	}
+	if gpu {
+		gpus := 1
+		if r != nil && r.GPUCount > 0 {
+			gpus = r.GPUCount
+		}
+		limits[r.KubernetesGPUResource()] = strconv.Itoa(gpus)
+	}
+	return requests, limits
+}
+
+// KubernetesQuantity returns a size in bytes as a Kubernetes quantity in mebibytes, rounded up
+func KubernetesQuantity(bytes int64) string {
+	return fmt.Sprintf("%dMi", (bytes+1024*1024-1)/(1024*1024))
+}
+
+// CPUString formats the CPU requirement the way Docker and Kubernetes expect it, or "" if none is set
+func (r *Resources) CPUString() string {
+	if r == nil || r.CPU == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(r.CPU, 'f', -1, 64)
+}
+
+// ParseQuantity parses a human-readable size like "512M", "16GB" or "16Gi" into bytes.
+// Decimal suffixes (k, M, G, T) are powers of 1000 and binary suffixes (Ki, Mi, Gi, Ti) are powers of 1024,
+// matching Kubernetes. A bare number is a count of bytes.
+func ParseQuantity(s string) (int64, error) {
+	matches := quantityRegex.FindStringSubmatch(strings.TrimSpace(s))
+	if matches == nil {
+		return 0, fmt.Errorf("%q is not a valid size, expected a value like '512M', '16G' or '16Gi'", s)
+	}
+	value, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a valid size: %w", s, err)
+	}
+
+	base := 1000.0
+	if matches[3] != "" {
+		base = 1024.0
+	}
+	multiplier := 1.0
+	switch strings.ToLower(matches[2]) {
+	case "k":
+		multiplier = base
+	case "m":
+		multiplier = base * base
+	case "g":
+		multiplier = base * base * base
+	case "t":
+		multiplier = base * base * base * base
+	case "":
+		if matches[3] != "" {
+			return 0, fmt.Errorf("%q is not a valid size, expected a value like '512M', '16G' or '16Gi'", s)
+		}
+	}
+	return int64(value * multiplier), nil
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuantity(t *testing.T) {
+	testCases := []struct {
+		input       string
+		expected    int64
+		expectedErr bool
+	}{
+		{input: "1024", expected: 1024},
+		{input: "512M", expected: 512_000_000},
+		{input: "512Mi", expected: 512 * 1024 * 1024},
+		{input: "16GB", expected: 16_000_000_000},
+		{input: "16g", expected: 16_000_000_000},
+		{input: "16Gi", expected: 16 * 1024 * 1024 * 1024},
+		{input: "1.5G", expected: 1_500_000_000},
+		{input: "2T", expected: 2_000_000_000_000},
+		{input: "", expectedErr: true},
+		{input: "lots", expectedErr: true},
+		{input: "16X", expectedErr: true},
+		{input: "16i", expectedErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			actual, err := ParseQuantity(tc.input)
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				require.Equal(t, tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestResourcesFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  gpu: true
+resources:
+  cpu: 4
+  memory: 16Gi
+  gpu_count: 2
+  gpu_type: nvidia-a100
+  disk: 50G
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+
+	require.Equal(t, "4", config.Resources.CPUString())
+	require.Equal(t, int64(16*1024*1024*1024), config.Resources.MemoryBytes())
+	require.Equal(t, 2, config.Resources.GPUCount)
+	require.Equal(t, "nvidia-a100", config.Resources.GPUType)
+	require.Equal(t, int64(50_000_000_000), config.Resources.DiskBytes())
+
+	requests, limits := config.Resources.KubernetesResources(config.Build.GPU)
+	require.Equal(t, map[string]string{"cpu": "4", "memory": "16384Mi", "ephemeral-storage": "47684Mi"}, requests)
+	require.Equal(t, map[string]string{"memory": "16384Mi", "ephemeral-storage": "47684Mi", "nvidia.com/gpu": "2"}, limits)
+}
+
+func TestResourcesInvalidMemory(t *testing.T) {
+	config, err := FromYAML([]byte(`
+resources:
+  memory: plenty
+`))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("", nil)
+	require.ErrorContains(t, err, "Invalid resources.memory")
+}
+
+func TestResourcesGPUWithoutGPUBuild(t *testing.T) {
+	config, err := FromYAML([]byte(`
+resources:
+  gpu_count: 1
+`))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("", nil)
+	require.ErrorContains(t, err, "require 'gpu: true'")
+}
+
+func TestResourcesUnset(t *testing.T) {
+	var resources *Resources
+	require.Equal(t, "", resources.CPUString())
+	require.Equal(t, int64(0), resources.MemoryBytes())
+	require.Equal(t, int64(0), resources.DiskBytes())
+	require.Equal(t, int64(0), resources.ShmSizeBytes())
+
+	requests, limits := resources.KubernetesResources(true)
+	require.Empty(t, requests)
+	require.Equal(t, map[string]string{"nvidia.com/gpu": "1"}, limits)
+}
+
+func TestResourcesSharedMemory(t *testing.T) {
+	config, err := FromYAML([]byte(`
+resources:
+  memory: 32G
+  shm_size: 16G
+  tmpfs:
+    - path: /scratch
+      size: 8G
+    - path: /cache
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, int64(16_000_000_000), config.Resources.ShmSizeBytes())
+	require.Equal(t, int64(8_000_000_000), config.Resources.Tmpfs[0].SizeBytes())
+	require.Equal(t, int64(0), config.Resources.Tmpfs[1].SizeBytes())
+
+	for yaml, expectedErr := range map[string]string{
+		"memory: 8G\n  shm_size: 16G":                         "can't be more than resources.memory",
+		"shm_size: lots":                                      "Invalid resources.shm_size",
+		"tmpfs:\n    - path: scratch":                         "Invalid resources.tmpfs path",
+		"tmpfs:\n    - path: /src":                            "Invalid resources.tmpfs path",
+		"tmpfs:\n    - path: /scratch\n      size: lots":      "Invalid resources.tmpfs size",
+		"tmpfs:\n    - path: /scratch\n    - path: /scratch/": "more than once",
+	} {
+		config, err := FromYAML([]byte("resources:\n  " + yaml + "\n"))
+		require.NoError(t, err)
+		require.ErrorContains(t, config.ValidateAndComplete("", nil), expectedErr, yaml)
+	}
+}
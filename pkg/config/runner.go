@@ -0,0 +1,80 @@
+package config
+
+import "fmt"
+
+// RunnerPort is the port a runner's server listens on in the container, which it's passed in $PORT
+const RunnerPort = 5000
+
+// Runner is a model server that isn't Cog's Python server, like a binary written in C++, Rust or Go. It serves the
+// same HTTP API: GET /health-check, GET /openapi.json and POST /predictions.
+type Runner struct {
+	// Command starts the server, like "./server --port $PORT". It's run with /bin/sh in /src.
+	Command string `json:"command" yaml:"command"`
+	// Schema is the path in the project to the OpenAPI schema of the server's API. If it isn't set, the schema is
+	// fetched from the server's /openapi.json when the image is built.
+	Schema string `json:"schema,omitempty" yaml:"schema"`
+}
+
+// ServerCommand returns the command that starts the model's server in its image
+func (c *Config) ServerCommand() []string {
+	if c.Runner != nil {
+		return []string{"/bin/sh", "-c", "exec " + c.Runner.Command}
+	}
+	if script, name := c.PredictR(); script != "" {
+		return []string{"Rscript", RServerPath, script, name}
+	}
+	if script, name := c.PredictJulia(); script != "" {
+		return []string{"julia", JuliaServerPath, script, name}
+	}
+	return []string{"python", "-m", "cog.server.http"}
+}
+
+// UsesRunner returns whether the model is served by a server other than Cog's Python server, which is either the
+// runner in cog.yaml or the server for R or Julia predictors. It listens on $PORT and serves its own schema.
+func (c *Config) UsesRunner() bool {
+	r, _ := c.PredictR()
+	julia, _ := c.PredictJulia()
+	return c.Runner != nil || r != "" || julia != ""
+}
+
+func (c *Config) validateRunner() error {
+	if c.Runner == nil {
+		return nil
+	}
+	if c.Runner.Command == "" {
+		return fmt.Errorf("runner.command must be set in cog.yaml")
+	}
+	for _, option := range []struct {
+		key string
+		set bool
+	}{
+		{"predict", c.Predict != ""},
+		{"pipeline", len(c.Pipeline) > 0},
+		{"models", len(c.Models) > 0},
+		{"train", c.Train != ""},
+	} {
+		if option.set {
+			return fmt.Errorf("'%s' can't be set in cog.yaml with 'runner', which serves predictions itself", option.key)
+		}
+	}
+	return nil
+}
+
+// validateScriptPredictor returns an error if options that only Cog's Python server supports are set for a predictor
+// in another language, like "an R predictor"
+func (c *Config) validateScriptPredictor(predictor string) error {
+	for _, option := range []struct {
+		key string
+		set bool
+	}{
+		{"predict_methods", len(c.PredictMethods) > 0},
+		{"models", len(c.Models) > 0},
+		{"train", c.Train != ""},
+		{"concurrency", c.Concurrency != nil && c.Concurrency.Max > 1},
+	} {
+		if option.set {
+			return fmt.Errorf("'%s' can't be set in cog.yaml with %s", option.key, predictor)
+		}
+	}
+	return nil
+}
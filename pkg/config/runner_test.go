@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+runner:
+  command: ./server --port $PORT
+  schema: openapi.json
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &Runner{Command: "./server --port $PORT", Schema: "openapi.json"}, config.Runner)
+	require.Equal(t, []string{"/bin/sh", "-c", "exec ./server --port $PORT"}, config.ServerCommand())
+}
+
+func TestServerCommandWithoutRunner(t *testing.T) {
+	require.Equal(t, []string{"python", "-m", "cog.server.http"}, (&Config{Predict: "predict.py:Predictor"}).ServerCommand())
+}
+
+func TestValidateRunner(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		config Config
+		err    string
+	}{
+		{"valid", Config{Runner: &Runner{Command: "./server"}}, ""},
+		{"no command", Config{Runner: &Runner{Schema: "openapi.json"}}, "runner.command must be set"},
+		{"predict", Config{Predict: "predict.py:Predictor", Runner: &Runner{Command: "./server"}}, "'predict' can't be set in cog.yaml with 'runner'"},
+		{"pipeline", Config{Pipeline: []PipelineStep{{Name: "a", Image: "a"}}, Runner: &Runner{Command: "./server"}}, "'pipeline' can't be set"},
+		{"train", Config{Train: "train.py:train", Runner: &Runner{Command: "./server"}}, "'train' can't be set"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateRunner()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,403 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var resolutionRegexp = regexp.MustCompile(`^[0-9]+x[0-9]+$`)
+
+// Serve configures the HTTP server that runs inside the model's image
+type Serve struct {
+	MaxRequestSize  string       `json:"max_request_size,omitempty" yaml:"max_request_size"`
+	Output          string       `json:"output,omitempty" yaml:"output"`
+	OutputUploadURL string       `json:"output_upload_url,omitempty" yaml:"output_upload_url"`
+	Auth            *Auth        `json:"auth,omitempty" yaml:"auth"`
+	RateLimit       *RateLimit   `json:"rate_limit,omitempty" yaml:"rate_limit"`
+	Cache           *Cache       `json:"cache,omitempty" yaml:"cache"`
+	DeadLetter      *DeadLetter  `json:"dead_letter,omitempty" yaml:"dead_letter"`
+	Results         *Results     `json:"results,omitempty" yaml:"results"`
+	CORS            *CORS        `json:"cors,omitempty" yaml:"cors"`
+	Models          *ModelLimits `json:"models,omitempty" yaml:"models"`
+	Metrics         bool         `json:"metrics,omitempty" yaml:"metrics"`
+	Record          *Record      `json:"record,omitempty" yaml:"record"`
+	Filters         *Filters     `json:"filters,omitempty" yaml:"filters"`
+	SetupTimeout    float64      `json:"setup_timeout,omitempty" yaml:"setup_timeout"`
+	// RestartOnCrash restarts the model when a prediction crashes it, like with a segfault, instead of stopping the
+	// server. It's always restarted when DeadLetter is set.
+	RestartOnCrash bool `json:"restart_on_crash,omitempty" yaml:"restart_on_crash"`
+	// RetryOnOOM runs predictions that run out of GPU memory again once, after the memory PyTorch cached is released,
+	// with the input named OOMBatchSizeInput halved if it's set
+	RetryOnOOM        bool   `json:"retry_on_oom,omitempty" yaml:"retry_on_oom"`
+	OOMBatchSizeInput string `json:"oom_batch_size_input,omitempty" yaml:"oom_batch_size_input"`
+	// InputLimits are the limits on the model's inputs, by input name
+	InputLimits map[string]InputLimit `json:"input_limits,omitempty" yaml:"input_limits"`
+}
+
+// Auth configures how the HTTP server authenticates requests to its prediction endpoints.
+// API keys are never set in cog.yaml, because they would end up in the image: they're passed to the
+// server in the COG_API_KEYS environment variable.
+type Auth struct {
+	Type     string `json:"type" yaml:"type"`
+	JWKSURL  string `json:"jwks_url,omitempty" yaml:"jwks_url"`
+	Issuer   string `json:"issuer,omitempty" yaml:"issuer"`
+	Audience string `json:"audience,omitempty" yaml:"audience"`
+}
+
+// RateLimit configures how many prediction and training requests the HTTP server accepts, in total and from each
+// client. Clients are identified by their API key or token subject, or by their IP address if auth isn't enabled.
+type RateLimit struct {
+	RequestsPerSecond          float64 `json:"requests_per_second,omitempty" yaml:"requests_per_second"`
+	Burst                      int     `json:"burst,omitempty" yaml:"burst"`
+	PerClientRequestsPerSecond float64 `json:"per_client_requests_per_second,omitempty" yaml:"per_client_requests_per_second"`
+	PerClientBurst             int     `json:"per_client_burst,omitempty" yaml:"per_client_burst"`
+}
+
+// Cache configures caching the responses of predictions, so predictions with the same inputs as an earlier one
+// return its output without running the model. The Redis backend's URL is never set in cog.yaml, because it can
+// have a password: it's passed to the server in the COG_CACHE_REDIS_URL environment variable.
+type Cache struct {
+	Backend    string  `json:"backend" yaml:"backend"`
+	TTL        float64 `json:"ttl,omitempty" yaml:"ttl"`
+	MaxEntries int     `json:"max_entries,omitempty" yaml:"max_entries"`
+	Path       string  `json:"path,omitempty" yaml:"path"`
+}
+
+// DeadLetter configures quarantining inputs that crash the model. The server restarts the model when a prediction
+// crashes it, and once an input has crashed it MaxCrashes times, it's written to Destination, with the logs and
+// errors of its predictions, and rejected from then on. The credentials for S3 are never set in cog.yaml: they're
+// passed to the server in the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables.
+type DeadLetter struct {
+	Destination string `json:"destination" yaml:"destination"`
+	MaxCrashes  int    `json:"max_crashes,omitempty" yaml:"max_crashes"`
+}
+
+// Results configures storing the responses of asynchronous predictions, so they can be fetched with
+// GET /predictions/{id} after they finish, and from other servers running the same model. The Redis and Postgres
+// backends' URLs are never set in cog.yaml, because they can have passwords: they're passed to the server in the
+// COG_RESULTS_REDIS_URL and COG_RESULTS_POSTGRES_URL environment variables.
+type Results struct {
+	Backend    string  `json:"backend" yaml:"backend"`
+	TTL        float64 `json:"ttl,omitempty" yaml:"ttl"`
+	MaxEntries int     `json:"max_entries,omitempty" yaml:"max_entries"`
+	URL        string  `json:"url,omitempty" yaml:"url"`
+}
+
+// Record configures recording the inputs and outputs of a sample of predictions, to build datasets from production
+// traffic. The credentials for S3 are never set in cog.yaml: they're passed to the server in the AWS_ACCESS_KEY_ID
+// and AWS_SECRET_ACCESS_KEY environment variables.
+type Record struct {
+	Destination   string   `json:"destination" yaml:"destination"`
+	Format        string   `json:"format,omitempty" yaml:"format"`
+	SampleRate    *float64 `json:"sample_rate,omitempty" yaml:"sample_rate"`
+	Mask          []string `json:"mask,omitempty" yaml:"mask"`
+	FlushInterval float64  `json:"flush_interval,omitempty" yaml:"flush_interval"`
+}
+
+// Filters configures content filters, which check the inputs of predictions before the model runs and their outputs
+// before they're returned, so deployments can enforce content policies. Each filter is a function or class in the
+// model's code, like "filters.py:check", or the URL of a filter running as a separate service, like a sidecar.
+type Filters struct {
+	Input   string  `json:"input,omitempty" yaml:"input"`
+	Output  string  `json:"output,omitempty" yaml:"output"`
+	Timeout float64 `json:"timeout,omitempty" yaml:"timeout"`
+}
+
+// InputLimit limits one of the model's inputs, which the HTTP server checks before the model runs. MaxResolution
+// applies to images, like "1024x1024", MaxDuration to audio, in seconds, and MaxTokens to strings. Tokens are
+// estimated from words and punctuation unless Tokenizer is the path to a tokenizer.json in the image, which needs
+// the tokenizers package.
+type InputLimit struct {
+	MaxResolution string  `json:"max_resolution,omitempty" yaml:"max_resolution"`
+	MaxDuration   float64 `json:"max_duration,omitempty" yaml:"max_duration"`
+	MaxTokens     int     `json:"max_tokens,omitempty" yaml:"max_tokens"`
+	Tokenizer     string  `json:"tokenizer,omitempty" yaml:"tokenizer"`
+}
+
+// CORS configures which web pages can call the HTTP server from a browser
+type CORS struct {
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins"`
+	AllowedMethods []string `json:"allowed_methods,omitempty" yaml:"allowed_methods"`
+	AllowedHeaders []string `json:"allowed_headers,omitempty" yaml:"allowed_headers"`
+}
+
+const (
+	AuthTypeAPIKey = "api_key"
+	AuthTypeJWT    = "jwt"
+)
+
+const (
+	RecordFormatJSONL   = "jsonl"
+	RecordFormatParquet = "parquet"
+)
+
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendDisk   = "disk"
+	CacheBackendRedis  = "redis"
+)
+
+const (
+	ResultsBackendMemory   = "memory"
+	ResultsBackendRedis    = "redis"
+	ResultsBackendS3       = "s3"
+	ResultsBackendPostgres = "postgres"
+)
+
+func (s *Serve) validate() error {
+	if s.MaxRequestSize != "" {
+		if _, err := ParseQuantity(s.MaxRequestSize); err != nil {
+			return fmt.Errorf("Invalid serve.max_request_size: %w", err)
+		}
+	}
+	if s.SetupTimeout < 0 {
+		return fmt.Errorf("serve.setup_timeout can't be negative")
+	}
+	if s.OOMBatchSizeInput != "" && !s.RetryOnOOM {
+		return fmt.Errorf("serve.oom_batch_size_input is only used when serve.retry_on_oom is true")
+	}
+	if s.OutputUploadURL != "" {
+		u, err := url.Parse(s.OutputUploadURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Invalid serve.output_upload_url %q, expected an http or https URL", s.OutputUploadURL)
+		}
+	}
+	if s.Auth != nil {
+		if err := s.Auth.validate(); err != nil {
+			return err
+		}
+	}
+	if s.RateLimit != nil {
+		if err := s.RateLimit.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Cache != nil {
+		if err := s.Cache.validate(); err != nil {
+			return err
+		}
+	}
+	if s.DeadLetter != nil {
+		if err := s.DeadLetter.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Results != nil {
+		if err := s.Results.validate(); err != nil {
+			return err
+		}
+	}
+	if s.CORS != nil {
+		if err := s.CORS.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Record != nil {
+		if err := s.Record.validate(); err != nil {
+			return err
+		}
+	}
+	if s.Filters != nil {
+		if err := s.Filters.validate(); err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(s.InputLimits))
+	for name := range s.InputLimits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		limit := s.InputLimits[name]
+		if err := limit.validate(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DeadLetter) validate() error {
+	if strings.HasPrefix(d.Destination, "s3://") {
+		if bucket, _, _ := strings.Cut(strings.TrimPrefix(d.Destination, "s3://"), "/"); bucket == "" {
+			return fmt.Errorf("Invalid serve.dead_letter.destination %q, expected a directory or an S3 URL like \"s3://bucket/prefix\"", d.Destination)
+		}
+	} else if strings.Contains(d.Destination, "://") || !path.IsAbs(d.Destination) {
+		return fmt.Errorf("Invalid serve.dead_letter.destination %q, expected an absolute path to a directory, or an S3 URL like \"s3://bucket/prefix\"", d.Destination)
+	}
+	if d.MaxCrashes < 0 {
+		return fmt.Errorf("serve.dead_letter.max_crashes can't be negative")
+	}
+	return nil
+}
+
+func (r *Results) validate() error {
+	switch r.Backend {
+	case ResultsBackendMemory, ResultsBackendRedis, ResultsBackendS3, ResultsBackendPostgres:
+	default:
+		return fmt.Errorf("serve.results.backend must be '%s', '%s', '%s' or '%s'", ResultsBackendMemory, ResultsBackendRedis, ResultsBackendS3, ResultsBackendPostgres)
+	}
+	if r.TTL < 0 || r.MaxEntries < 0 {
+		return fmt.Errorf("serve.results values can't be negative")
+	}
+	if r.MaxEntries != 0 && r.Backend != ResultsBackendMemory {
+		return fmt.Errorf("serve.results.max_entries can only be set when serve.results.backend is '%s'", ResultsBackendMemory)
+	}
+	if r.Backend == ResultsBackendS3 {
+		if u, err := url.Parse(r.URL); err != nil || u.Scheme != "s3" || u.Host == "" {
+			return fmt.Errorf("serve.results.url must be an S3 URL like 's3://bucket/prefix' when serve.results.backend is '%s'", ResultsBackendS3)
+		}
+	} else if r.URL != "" {
+		return fmt.Errorf("serve.results.url can only be set when serve.results.backend is '%s'", ResultsBackendS3)
+	}
+	return nil
+}
+
+func (f *Filters) validate() error {
+	for _, filter := range []struct{ key, value string }{{"input", f.Input}, {"output", f.Output}} {
+		if filter.value == "" {
+			continue
+		}
+		if strings.HasPrefix(filter.value, "http://") || strings.HasPrefix(filter.value, "https://") {
+			if u, err := url.Parse(filter.value); err != nil || u.Host == "" {
+				return fmt.Errorf("Invalid serve.filters.%s %q, expected an http or https URL", filter.key, filter.value)
+			}
+			continue
+		}
+		if _, _, ok := strings.Cut(filter.value, ".py:"); !ok {
+			return fmt.Errorf("serve.filters.%s in cog.yaml must be in the form 'filters.py:check', or an http or https URL", filter.key)
+		}
+	}
+	if f.Timeout < 0 {
+		return fmt.Errorf("serve.filters.timeout can't be negative")
+	}
+	return nil
+}
+
+func (l *InputLimit) validate(name string) error {
+	if l.MaxResolution != "" && !resolutionRegexp.MatchString(l.MaxResolution) {
+		return fmt.Errorf("Invalid serve.input_limits.%s.max_resolution %q, expected a resolution like \"1024x1024\"", name, l.MaxResolution)
+	}
+	if l.MaxDuration < 0 {
+		return fmt.Errorf("serve.input_limits.%s.max_duration can't be negative", name)
+	}
+	if l.MaxTokens < 0 {
+		return fmt.Errorf("serve.input_limits.%s.max_tokens can't be negative", name)
+	}
+	if l.Tokenizer != "" && l.MaxTokens == 0 {
+		return fmt.Errorf("serve.input_limits.%s.tokenizer is set, but max_tokens isn't", name)
+	}
+	return nil
+}
+
+func (r *Record) validate() error {
+	if strings.HasPrefix(r.Destination, "s3://") {
+		if bucket, _, _ := strings.Cut(strings.TrimPrefix(r.Destination, "s3://"), "/"); bucket == "" {
+			return fmt.Errorf("Invalid serve.record.destination %q, expected a directory or an S3 URL like \"s3://bucket/prefix\"", r.Destination)
+		}
+	} else if strings.Contains(r.Destination, "://") || !path.IsAbs(r.Destination) {
+		return fmt.Errorf("Invalid serve.record.destination %q, expected an absolute path to a directory, or an S3 URL like \"s3://bucket/prefix\"", r.Destination)
+	}
+	switch r.Format {
+	case "", RecordFormatJSONL, RecordFormatParquet:
+	default:
+		return fmt.Errorf("serve.record.format must be '%s' or '%s'", RecordFormatJSONL, RecordFormatParquet)
+	}
+	if r.SampleRate != nil && (*r.SampleRate < 0 || *r.SampleRate > 1) {
+		return fmt.Errorf("serve.record.sample_rate must be from 0 to 1")
+	}
+	if r.FlushInterval < 0 {
+		return fmt.Errorf("serve.record.flush_interval can't be negative")
+	}
+	return nil
+}
+
+func (c *Cache) validate() error {
+	switch c.Backend {
+	case CacheBackendMemory, CacheBackendDisk, CacheBackendRedis:
+	default:
+		return fmt.Errorf("serve.cache.backend must be '%s', '%s' or '%s'", CacheBackendMemory, CacheBackendDisk, CacheBackendRedis)
+	}
+	if c.TTL < 0 || c.MaxEntries < 0 {
+		return fmt.Errorf("serve.cache values can't be negative")
+	}
+	if c.MaxEntries != 0 && c.Backend != CacheBackendMemory {
+		return fmt.Errorf("serve.cache.max_entries can only be set when serve.cache.backend is '%s'", CacheBackendMemory)
+	}
+	if c.Path != "" && c.Backend != CacheBackendDisk {
+		return fmt.Errorf("serve.cache.path can only be set when serve.cache.backend is '%s'", CacheBackendDisk)
+	}
+	return nil
+}
+
+func (c *CORS) validate() error {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		// Browsers send the origin as scheme://host[:port], so anything else would never match
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" {
+			return fmt.Errorf("Invalid origin %q in serve.cors.allowed_origins, expected \"*\" or an origin like \"https://example.com\"", origin)
+		}
+	}
+	return nil
+}
+
+func (r *RateLimit) validate() error {
+	if r.RequestsPerSecond < 0 || r.PerClientRequestsPerSecond < 0 || r.Burst < 0 || r.PerClientBurst < 0 {
+		return fmt.Errorf("serve.rate_limit values can't be negative")
+	}
+	if r.RequestsPerSecond == 0 && r.PerClientRequestsPerSecond == 0 {
+		return fmt.Errorf("serve.rate_limit must set requests_per_second, per_client_requests_per_second, or both")
+	}
+	if r.Burst != 0 && r.RequestsPerSecond == 0 {
+		return fmt.Errorf("serve.rate_limit.burst can only be set with serve.rate_limit.requests_per_second")
+	}
+	if r.PerClientBurst != 0 && r.PerClientRequestsPerSecond == 0 {
+		return fmt.Errorf("serve.rate_limit.per_client_burst can only be set with serve.rate_limit.per_client_requests_per_second")
+	}
+	return nil
+}
+
+func (a *Auth) validate() error {
+	if a.Type == AuthTypeJWT {
+		u, err := url.Parse(a.JWKSURL)
+		if a.JWKSURL == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("serve.auth.jwks_url must be set to an http or https URL when serve.auth.type is '%s'", AuthTypeJWT)
+		}
+	} else if a.JWKSURL != "" || a.Issuer != "" || a.Audience != "" {
+		return fmt.Errorf("serve.auth.jwks_url, serve.auth.issuer and serve.auth.audience can only be set when serve.auth.type is '%s'", AuthTypeJWT)
+	}
+	return nil
+}
+
+// AuthType returns how the server authenticates requests, or "" if it doesn't
+func (s *Serve) AuthType() string {
+	if s == nil || s.Auth == nil {
+		return ""
+	}
+	return s.Auth.Type
+}
+
+// SetupTimeoutDuration returns how long setup() may take, or 0 if there's no limit
+func (s *Serve) SetupTimeoutDuration() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(s.SetupTimeout * float64(time.Second))
+}
+
+// MaxRequestSizeBytes returns the largest request body the server accepts in bytes, or 0 if there's no limit
+func (s *Serve) MaxRequestSizeBytes() int64 {
+	if s == nil || s.MaxRequestSize == "" {
+		return 0
+	}
+	// Validated in ValidateAndComplete
+	bytes, _ := ParseQuantity(s.MaxRequestSize)
+	return bytes
+}
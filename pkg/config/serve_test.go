@@ -0,0 +1,523 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeFromYAML(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  max_request_size: 2Gi
+  output: upload
+  output_upload_url: https://bucket.example.com/outputs/
+  metrics: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, int64(2*1024*1024*1024), config.Serve.MaxRequestSizeBytes())
+	require.Equal(t, "upload", config.Serve.Output)
+	require.Equal(t, "https://bucket.example.com/outputs/", config.Serve.OutputUploadURL)
+	require.True(t, config.Serve.Metrics)
+}
+
+func TestServeInvalidOutput(t *testing.T) {
+	_, err := FromYAML([]byte(`
+serve:
+  output: email
+`))
+	require.ErrorContains(t, err, "serve.output must be one of the following")
+}
+
+func TestServeInvalidOutputUploadURL(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  output_upload_url: s3://bucket/outputs
+`))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("", nil)
+	require.ErrorContains(t, err, "Invalid serve.output_upload_url")
+}
+
+func TestServeInvalidMaxRequestSize(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  max_request_size: unlimited
+`))
+	require.NoError(t, err)
+	err = config.ValidateAndComplete("", nil)
+	require.ErrorContains(t, err, "Invalid serve.max_request_size")
+}
+
+func TestServeUnset(t *testing.T) {
+	var serve *Serve
+	require.Equal(t, int64(0), serve.MaxRequestSizeBytes())
+	require.Equal(t, time.Duration(0), serve.SetupTimeoutDuration())
+}
+
+func TestServeSetupTimeout(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  setup_timeout: 600
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, 10*time.Minute, config.Serve.SetupTimeoutDuration())
+
+	config.Serve.SetupTimeout = -1
+	require.ErrorContains(t, config.ValidateAndComplete("", nil), "serve.setup_timeout can't be negative")
+}
+
+func TestServeRetryOnOOM(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  retry_on_oom: true
+  oom_batch_size_input: batch_size
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.True(t, config.Serve.RetryOnOOM)
+	require.Equal(t, "batch_size", config.Serve.OOMBatchSizeInput)
+
+	config.Serve.RetryOnOOM = false
+	require.ErrorContains(t, config.ValidateAndComplete("", nil), "serve.oom_batch_size_input is only used when serve.retry_on_oom is true")
+}
+
+func TestServeAuth(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  auth:
+    type: jwt
+    jwks_url: https://auth.example.com/.well-known/jwks.json
+    audience: my-model
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, AuthTypeJWT, config.Serve.AuthType())
+	require.Equal(t, "my-model", config.Serve.Auth.Audience)
+}
+
+func TestServeAuthInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "jwt without jwks_url",
+			yaml:        "type: jwt",
+			expectedErr: "serve.auth.jwks_url must be set",
+		},
+		{
+			name:        "api_key with jwks_url",
+			yaml:        "type: api_key\n    jwks_url: https://auth.example.com/jwks.json",
+			expectedErr: "can only be set when serve.auth.type is 'jwt'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  auth:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeAuthTypeUnset(t *testing.T) {
+	var serve *Serve
+	require.Equal(t, "", serve.AuthType())
+	require.Equal(t, "", (&Serve{}).AuthType())
+}
+
+func TestServeRateLimit(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  rate_limit:
+    requests_per_second: 10
+    burst: 20
+    per_client_requests_per_second: 0.5
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &RateLimit{RequestsPerSecond: 10, Burst: 20, PerClientRequestsPerSecond: 0.5}, config.Serve.RateLimit)
+}
+
+func TestServeRateLimitInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "no rates",
+			yaml:        "burst: 10",
+			expectedErr: "must set requests_per_second, per_client_requests_per_second, or both",
+		},
+		{
+			name:        "negative rate",
+			yaml:        "requests_per_second: -1",
+			expectedErr: "can't be negative",
+		},
+		{
+			name:        "per-client burst without per-client rate",
+			yaml:        "requests_per_second: 1\n    per_client_burst: 5",
+			expectedErr: "per_client_burst can only be set with",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  rate_limit:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeCache(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  cache:
+    backend: memory
+    ttl: 3600
+    max_entries: 500
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &Cache{Backend: CacheBackendMemory, TTL: 3600, MaxEntries: 500}, config.Serve.Cache)
+}
+
+func TestServeCacheInvalidBackend(t *testing.T) {
+	_, err := FromYAML([]byte(`
+serve:
+  cache:
+    backend: memcached
+`))
+	require.ErrorContains(t, err, "serve.cache.backend must be one of the following")
+}
+
+func TestServeCacheInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "negative ttl",
+			yaml:        "backend: redis\n    ttl: -1",
+			expectedErr: "can't be negative",
+		},
+		{
+			name:        "max entries for disk",
+			yaml:        "backend: disk\n    max_entries: 10",
+			expectedErr: "max_entries can only be set when serve.cache.backend is 'memory'",
+		},
+		{
+			name:        "path for redis",
+			yaml:        "backend: redis\n    path: /cache",
+			expectedErr: "path can only be set when serve.cache.backend is 'disk'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  cache:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeResults(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  results:
+    backend: s3
+    ttl: 3600
+    url: s3://my-bucket/predictions
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &Results{Backend: ResultsBackendS3, TTL: 3600, URL: "s3://my-bucket/predictions"}, config.Serve.Results)
+}
+
+func TestServeResultsInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "negative ttl",
+			yaml:        "backend: redis\n    ttl: -1",
+			expectedErr: "can't be negative",
+		},
+		{
+			name:        "max entries for postgres",
+			yaml:        "backend: postgres\n    max_entries: 10",
+			expectedErr: "max_entries can only be set when serve.results.backend is 'memory'",
+		},
+		{
+			name:        "s3 without url",
+			yaml:        "backend: s3",
+			expectedErr: "serve.results.url must be an S3 URL",
+		},
+		{
+			name:        "s3 with other url",
+			yaml:        "backend: s3\n    url: https://example.com/predictions",
+			expectedErr: "serve.results.url must be an S3 URL",
+		},
+		{
+			name:        "url for redis",
+			yaml:        "backend: redis\n    url: s3://my-bucket",
+			expectedErr: "url can only be set when serve.results.backend is 's3'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  results:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeDeadLetter(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  dead_letter:
+    destination: /src/dead-letter
+    max_crashes: 2
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &DeadLetter{Destination: "/src/dead-letter", MaxCrashes: 2}, config.Serve.DeadLetter)
+}
+
+func TestServeDeadLetterInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "relative path",
+			yaml:        "destination: dead-letter",
+			expectedErr: "expected an absolute path to a directory",
+		},
+		{
+			name:        "no bucket",
+			yaml:        "destination: s3:///dead-letter",
+			expectedErr: "expected a directory or an S3 URL",
+		},
+		{
+			name:        "negative max crashes",
+			yaml:        "destination: /dead-letter\n    max_crashes: -1",
+			expectedErr: "max_crashes can't be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  dead_letter:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeRecord(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  record:
+    destination: s3://datasets/hotdogs
+    format: parquet
+    sample_rate: 0.1
+    mask: [email]
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	sampleRate := 0.1
+	require.Equal(t, &Record{Destination: "s3://datasets/hotdogs", Format: RecordFormatParquet, SampleRate: &sampleRate, Mask: []string{"email"}}, config.Serve.Record)
+}
+
+func TestServeRecordInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "relative path",
+			yaml:        "destination: recordings",
+			expectedErr: "expected an absolute path to a directory",
+		},
+		{
+			name:        "other URL",
+			yaml:        "destination: gs://datasets/hotdogs",
+			expectedErr: "expected an absolute path to a directory",
+		},
+		{
+			name:        "no bucket",
+			yaml:        "destination: s3:///hotdogs",
+			expectedErr: "expected a directory or an S3 URL",
+		},
+		{
+			name:        "sample rate over 1",
+			yaml:        "destination: /recordings\n    sample_rate: 10",
+			expectedErr: "sample_rate must be from 0 to 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  record:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeFilters(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  filters:
+    input: filters.py:check_prompt
+    output: http://localhost:8080/check
+    timeout: 5
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, &Filters{Input: "filters.py:check_prompt", Output: "http://localhost:8080/check", Timeout: 5}, config.Serve.Filters)
+}
+
+func TestServeFiltersInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "not a reference",
+			yaml:        "input: check_prompt",
+			expectedErr: "serve.filters.input in cog.yaml must be in the form 'filters.py:check'",
+		},
+		{
+			name:        "URL without host",
+			yaml:        "output: http:///check",
+			expectedErr: `Invalid serve.filters.output "http:///check"`,
+		},
+		{
+			name:        "negative timeout",
+			yaml:        "input: filters.py:check\n    timeout: -1",
+			expectedErr: "serve.filters.timeout can't be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  filters:\n    " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeInputLimits(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  input_limits:
+    image:
+      max_resolution: 1024x1024
+    audio:
+      max_duration: 300
+    prompt:
+      max_tokens: 4096
+      tokenizer: /src/tokenizer.json
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, map[string]InputLimit{
+		"image":  {MaxResolution: "1024x1024"},
+		"audio":  {MaxDuration: 300},
+		"prompt": {MaxTokens: 4096, Tokenizer: "/src/tokenizer.json"},
+	}, config.Serve.InputLimits)
+}
+
+func TestServeInputLimitsInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "resolution without height",
+			yaml:        "max_resolution: '1024'",
+			expectedErr: `Invalid serve.input_limits.image.max_resolution "1024"`,
+		},
+		{
+			name:        "negative duration",
+			yaml:        "max_duration: -1",
+			expectedErr: "serve.input_limits.image.max_duration can't be negative",
+		},
+		{
+			name:        "tokenizer without max tokens",
+			yaml:        "tokenizer: /src/tokenizer.json",
+			expectedErr: "tokenizer is set, but max_tokens isn't",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  input_limits:\n    image:\n      " + tc.yaml + "\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestServeCORS(t *testing.T) {
+	config, err := FromYAML([]byte(`
+serve:
+  cors:
+    allowed_origins: ["https://demo.example.com", "http://localhost:3000"]
+    allowed_methods: [GET, POST]
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, []string{"https://demo.example.com", "http://localhost:3000"}, config.Serve.CORS.AllowedOrigins)
+	require.Equal(t, []string{"GET", "POST"}, config.Serve.CORS.AllowedMethods)
+}
+
+func TestServeCORSInvalidOrigin(t *testing.T) {
+	for _, origin := range []string{"example.com", "https://example.com/demo", "ftp://example.com"} {
+		t.Run(origin, func(t *testing.T) {
+			config, err := FromYAML([]byte("serve:\n  cors:\n    allowed_origins: [\"" + origin + "\"]\n"))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, "Invalid origin")
+		})
+	}
+}
+
+func TestServeCORSInvalidMethod(t *testing.T) {
+	_, err := FromYAML([]byte(`
+serve:
+  cors:
+    allowed_origins: ["*"]
+    allowed_methods: [CONNECT]
+`))
+	require.ErrorContains(t, err, "must be one of the following")
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// pythonPackageSystemPackages are the system packages that Python packages need, but don't install themselves, like
+// shared libraries they load when they're imported, or programs they run
+var pythonPackageSystemPackages = map[string][]string{
+	"cairosvg":               {"libcairo2"},
+	"ffmpeg-python":          {"ffmpeg"},
+	"gitpython":              {"git"},
+	"librosa":                {"ffmpeg", "libsndfile1"},
+	"moviepy":                {"ffmpeg"},
+	"mysqlclient":            {"default-libmysqlclient-dev", "pkg-config"},
+	"openai-whisper":         {"ffmpeg"},
+	"opencv-contrib-python":  {"libgl1", "libglib2.0-0"},
+	"opencv-python":          {"libgl1", "libglib2.0-0"},
+	"opencv-python-headless": {"libglib2.0-0"},
+	"pdf2image":              {"poppler-utils"},
+	"psycopg2":               {"libpq-dev"},
+	"pyaudio":                {"portaudio19-dev"},
+	"pydub":                  {"ffmpeg"},
+	"pygraphviz":             {"graphviz", "libgraphviz-dev"},
+	"pytesseract":            {"tesseract-ocr"},
+	"python-magic":           {"libmagic1"},
+	"soundfile":              {"libsndfile1"},
+	"weasyprint":             {"libpango-1.0-0", "libpangoft2-1.0-0"},
+}
+
+var (
+	pythonPackageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*`)
+	pythonPackageSeparators  = regexp.MustCompile(`[-_.]+`)
+)
+
+// PythonPackageName returns the normalized name of the package in a pip requirement, like "torch" for
+// "Torch==2.3.1", or "" if it isn't a package
+func PythonPackageName(requirement string) string {
+	name := pythonPackageNamePattern.FindString(strings.TrimSpace(requirement))
+	return strings.ToLower(pythonPackageSeparators.ReplaceAllString(name, "-"))
+}
+
+// SystemPackagesForPythonPackage returns the system packages that a Python package needs, but doesn't install
+// itself. name is a package name or a pip requirement.
+func SystemPackagesForPythonPackage(name string) []string {
+	return pythonPackageSystemPackages[PythonPackageName(name)]
+}
+
+// AddedSystemPackages returns the system packages that the model's Python packages need, but aren't in
+// build.system_packages. Cog installs them too, unless build.auto_system_packages is false.
+func (c *Config) AddedSystemPackages() []string {
+	if c.Build.AutoSystemPackages != nil && !*c.Build.AutoSystemPackages {
+		return nil
+	}
+	added := []string{}
+	for _, pythonPackage := range c.PythonPackages() {
+		for _, pkg := range SystemPackagesForPythonPackage(pythonPackage) {
+			if !slices.Contains(c.Build.SystemPackages, pkg) && !slices.Contains(added, pkg) {
+				added = append(added, pkg)
+			}
+		}
+	}
+	return added
+}
+
+// SystemPackages returns the system packages to install in the model's image: the ones in build.system_packages,
+// and the ones its Python packages need
+func (c *Config) SystemPackages() []string {
+	return slices.Concat(c.Build.SystemPackages, c.AddedSystemPackages())
+}
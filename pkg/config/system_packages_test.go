@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPythonPackageName(t *testing.T) {
+	for requirement, name := range map[string]string{
+		"torch==2.3.1":                          "torch",
+		"Pillow":                                "pillow",
+		"opencv_python>=4.8":                    "opencv-python",
+		"ruamel.yaml[jinja2]~=0.18":             "ruamel-yaml",
+		"  soundfile ; python_version>'3.8'":    "soundfile",
+		"--extra-index-url https://example.com": "",
+	} {
+		require.Equal(t, name, PythonPackageName(requirement), requirement)
+	}
+}
+
+func TestSystemPackagesForPythonPackage(t *testing.T) {
+	require.Equal(t, []string{"libgl1", "libglib2.0-0"}, SystemPackagesForPythonPackage("opencv_python==4.10.0.84"))
+	require.Equal(t, []string{"libpq-dev"}, SystemPackagesForPythonPackage("psycopg2"))
+	require.Empty(t, SystemPackagesForPythonPackage("torch"))
+}
+
+func TestSystemPackages(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  python_packages:
+    - soundfile==0.12.1
+    - librosa==0.10.2
+  system_packages:
+    - libsndfile1
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, []string{"ffmpeg"}, config.AddedSystemPackages())
+	require.Equal(t, []string{"libsndfile1", "ffmpeg"}, config.SystemPackages())
+
+	off := false
+	config.Build.AutoSystemPackages = &off
+	require.Empty(t, config.AddedSystemPackages())
+	require.Equal(t, []string{"libsndfile1"}, config.SystemPackages())
+}
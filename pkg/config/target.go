@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// The devices a model can be built to run on, as well as servers, in build.target
+const (
+	// TargetJetson is NVIDIA Jetson boards, with JetPack
+	TargetJetson = "jetson"
+	// TargetEdgeTPU is Coral Edge TPUs
+	TargetEdgeTPU = "edgetpu"
+	// TargetLambda is AWS Lambda, which runs the model as a container image function
+	TargetLambda = "lambda"
+)
+
+// Targets are the values build.target can be set to
+var Targets = []string{TargetJetson, TargetEdgeTPU, TargetLambda}
+
+// DefaultJetPack is the JetPack version Jetson models are built for, if build.jetpack isn't set
+const DefaultJetPack = "6.0"
+
+// JetPack is a release of JetPack, NVIDIA's SDK for Jetson boards
+type JetPack struct {
+	// L4T is the release of Linux for Tegra it runs on, which the base image is tagged with
+	L4T    string
+	Python string
+	CUDA   string
+}
+
+// jetPacks are the JetPack releases Cog can build for. NVIDIA's PyTorch wheels for them are built for the Python
+// that comes with them.
+var jetPacks = map[string]JetPack{
+	"5.1.1": {L4T: "r35.3.1", Python: "3.8", CUDA: "11.4"},
+	"5.1.2": {L4T: "r35.4.1", Python: "3.8", CUDA: "11.4"},
+	"6.0":   {L4T: "r36.3.0", Python: "3.10", CUDA: "12.2"},
+}
+
+// edgeTPUPythonVersions are the Python versions pycoral has packages for
+var edgeTPUPythonVersions = []string{"3.8", "3.9"}
+
+// IsDevice returns whether the model is built for a device, like a Jetson board, rather than a server
+func (b *Build) IsDevice() bool {
+	return b.Target == TargetJetson || b.Target == TargetEdgeTPU
+}
+
+// JetPack returns the JetPack release a Jetson model is built for, or false if it isn't a Jetson model
+func (b *Build) JetPack() (JetPack, bool) {
+	if b.Target != TargetJetson {
+		return JetPack{}, false
+	}
+	jetPack, ok := jetPacks[b.jetPackOrDefault()]
+	return jetPack, ok
+}
+
+// Platform returns the platform the model's image is built for, like "linux/arm64", or "" for the platform Docker
+// builds for by default
+func (b *Build) Platform() string {
+	if b.Target == TargetJetson {
+		return "linux/arm64"
+	}
+	return ""
+}
+
+func (b *Build) validateAndCompleteTarget() error {
+	if b.Target == "" {
+		if b.JetPackVersion != "" {
+			return fmt.Errorf("build.jetpack can only be set when build.target is %s", TargetJetson)
+		}
+		return nil
+	}
+	if !slices.Contains(Targets, b.Target) {
+		return fmt.Errorf("Invalid build.target %q, expected one of: %s", b.Target, strings.Join(Targets, ", "))
+	}
+	major, minor, err := splitPythonVersion(b.PythonVersion)
+	if err != nil {
+		return err
+	}
+	pythonMinor := fmt.Sprintf("%d.%d", major, minor)
+
+	switch b.Target {
+	case TargetJetson:
+		if b.JetPackVersion != "" {
+			if _, ok := jetPacks[b.JetPackVersion]; !ok {
+				versions := []string{}
+				for version := range jetPacks {
+					versions = append(versions, version)
+				}
+				slices.Sort(versions)
+				return fmt.Errorf("Invalid build.jetpack %q, expected one of: %s", b.JetPackVersion, strings.Join(versions, ", "))
+			}
+		}
+		jetPack, _ := b.JetPack()
+		if pythonMinor != jetPack.Python {
+			return fmt.Errorf("build.python_version must be %s to build for JetPack %s, because that's the Python NVIDIA's packages for it are built for", jetPack.Python, b.jetPackOrDefault())
+		}
+		if b.CUDA != "" && b.CUDA != jetPack.CUDA {
+			return fmt.Errorf("build.cuda can't be %s with JetPack %s, which comes with CUDA %s. Remove build.cuda from cog.yaml", b.CUDA, b.jetPackOrDefault(), jetPack.CUDA)
+		}
+		b.CUDA = jetPack.CUDA
+	case TargetEdgeTPU:
+		if b.GPU {
+			return fmt.Errorf("build.gpu can't be true when build.target is %s", TargetEdgeTPU)
+		}
+		if !slices.Contains(edgeTPUPythonVersions, pythonMinor) {
+			return fmt.Errorf("build.python_version must be %s to build for Edge TPUs, because pycoral only supports those versions", strings.Join(edgeTPUPythonVersions, " or "))
+		}
+	case TargetLambda:
+		if b.GPU {
+			return fmt.Errorf("build.gpu can't be true when build.target is %s, because Lambda functions don't have GPUs", TargetLambda)
+		}
+		// /tmp is the only directory Lambda functions can write to
+		if b.StateDir != "" && path.Clean(b.StateDir) != DefaultStateDir {
+			return fmt.Errorf("build.state_dir must be %s when build.target is %s, because it's the only directory Lambda functions can write to", DefaultStateDir, TargetLambda)
+		}
+		b.ReadOnlyRootFilesystem = true
+	}
+	return nil
+}
+
+// SetTarget sets what the model is built to run on, like TargetLambda, in place of build.target in cog.yaml
+func (c *Config) SetTarget(target string) error {
+	c.Build.Target = target
+	return c.Build.validateAndCompleteTarget()
+}
+
+func (b *Build) jetPackOrDefault() string {
+	if b.JetPackVersion == "" {
+		return DefaultJetPack
+	}
+	return b.JetPackVersion
+}
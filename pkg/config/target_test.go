@@ -0,0 +1,94 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJetsonTarget(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  gpu: true
+  target: jetson
+  python_version: "3.10"
+  python_packages:
+    - torch==2.3.0
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+
+	jetPack, ok := config.Build.JetPack()
+	require.True(t, ok)
+	require.Equal(t, "r36.3.0", jetPack.L4T)
+	require.Equal(t, "12.2", config.Build.CUDA)
+	require.Equal(t, "linux/arm64", config.Build.Platform())
+
+	// NVIDIA's PyTorch for Jetson isn't on PyPI, so it's installed as it's written
+	requirements, err := config.PythonRequirementsForArch("linux", "arm64", nil)
+	require.NoError(t, err)
+	require.Equal(t, "torch==2.3.0", requirements)
+}
+
+func TestEdgeTPUTarget(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  target: edgetpu
+  python_version: "3.9"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	_, ok := config.Build.JetPack()
+	require.False(t, ok)
+	require.Equal(t, "", config.Build.Platform())
+}
+
+func TestInvalidTarget(t *testing.T) {
+	for yaml, expectedErr := range map[string]string{
+		"jetpack: \"6.0\"":                                             "build.jetpack can only be set",
+		"target: jetson\n  python_version: \"3.12\"":                   "build.python_version must be 3.10 to build for JetPack 6.0",
+		"target: jetson\n  jetpack: \"5.1.2\"":                         "build.python_version must be 3.8",
+		"target: jetson\n  jetpack: \"4.6\"":                           "Invalid build.jetpack",
+		"target: jetson\n  python_version: \"3.10\"\n  cuda: \"11.8\"": "build.cuda can't be 11.8",
+		"target: edgetpu\n  python_version: \"3.11\"":                  "build.python_version must be 3.8 or 3.9",
+		"target: edgetpu\n  python_version: \"3.9\"\n  gpu: true":      "build.gpu can't be true",
+	} {
+		config, err := FromYAML([]byte("build:\n  " + yaml + "\n"))
+		require.NoError(t, err)
+		require.ErrorContains(t, config.ValidateAndComplete("", nil), expectedErr, yaml)
+	}
+
+	build := &Build{Target: "tpu", PythonVersion: "3.12"}
+	require.ErrorContains(t, build.validateAndCompleteTarget(), "Invalid build.target")
+}
+
+func TestLambdaTarget(t *testing.T) {
+	config, err := FromYAML([]byte(`
+build:
+  target: lambda
+  python_version: "3.12"
+  python_packages:
+    - torch==2.3.0
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.False(t, config.Build.IsDevice())
+	// /tmp is the only directory Lambda functions can write to
+	require.Equal(t, "/tmp", config.StateDir())
+
+	// PyTorch is installed from its CPU index, like it is for servers
+	requirements, err := config.PythonRequirementsForArch("linux", "amd64", nil)
+	require.NoError(t, err)
+	require.Contains(t, requirements, "--extra-index-url")
+
+	config, err = FromYAML([]byte("build:\n  python_version: \"3.12\"\n  gpu: true\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.SetTarget(TargetLambda), "Lambda functions don't have GPUs")
+
+	config, err = FromYAML([]byte("build:\n  target: lambda\n  read_only_root_filesystem: true\n  state_dir: /var/lib/model\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.ValidateAndComplete("", nil), "build.state_dir must be /tmp")
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Volume is a file or directory on the host that's mounted into the model's container, so the model can read data
+// that's too big to build into its image, like a dataset
+type Volume struct {
+	Source      string
+	Destination string
+	ReadOnly    bool
+}
+
+// ParseVolume parses a volume in the same form as `docker run -v`, like "/mnt/datasets:/data:ro". Relative sources
+// are relative to dir.
+func ParseVolume(s string, dir string) (Volume, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return Volume{}, fmt.Errorf("Invalid volume %q, expected source:destination or source:destination:ro", s)
+	}
+	volume := Volume{Destination: parts[1]}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			volume.ReadOnly = true
+		case "rw":
+		default:
+			return Volume{}, fmt.Errorf("Invalid volume %q, expected the mode to be ro or rw, got %q", s, parts[2])
+		}
+	}
+	if !path.IsAbs(volume.Destination) || path.Clean(volume.Destination) == "/" || path.Clean(volume.Destination) == "/src" {
+		return Volume{}, fmt.Errorf("Invalid volume %q, expected the destination to be an absolute path like '/data' that isn't / or /src", s)
+	}
+	volume.Destination = path.Clean(volume.Destination)
+
+	source, err := homedir.Expand(parts[0])
+	if err != nil {
+		return Volume{}, fmt.Errorf("Invalid volume %q: %w", s, err)
+	}
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(dir, source)
+	}
+	volume.Source = filepath.Clean(source)
+	return volume, nil
+}
+
+func validateVolumes(volumes []string) error {
+	destinations := map[string]bool{}
+	for _, s := range volumes {
+		volume, err := ParseVolume(s, "")
+		if err != nil {
+			return err
+		}
+		if destinations[volume.Destination] {
+			return fmt.Errorf("More than one volume is mounted at %s", volume.Destination)
+		}
+		destinations[volume.Destination] = true
+	}
+	return nil
+}
+
+// VolumeMounts returns the volumes to mount into the model's container: the ones in cog.yaml, if the model is run
+// from projectDir, and extra ones in the same form as `docker run -v`, with sources relative to the current
+// directory. Extra volumes replace any in cog.yaml with the same destination. It returns an error if a source
+// doesn't exist, because Docker's error doesn't say which volume it was.
+func (c *Config) VolumeMounts(projectDir string, extra []string) ([]Volume, error) {
+	volumes := []Volume{}
+	if projectDir != "" {
+		for _, s := range c.Volumes {
+			// Validated in ValidateAndComplete
+			volume, _ := ParseVolume(s, projectDir)
+			volumes = append(volumes, volume)
+		}
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range extra {
+		volume, err := ParseVolume(s, cwd)
+		if err != nil {
+			return nil, err
+		}
+		volumes = slices.DeleteFunc(volumes, func(v Volume) bool { return v.Destination == volume.Destination })
+		volumes = append(volumes, volume)
+	}
+	for _, volume := range volumes {
+		if _, err := os.Stat(volume.Source); err != nil {
+			return nil, fmt.Errorf("Failed to mount %s at %s: %w", volume.Source, volume.Destination, err)
+		}
+	}
+	return volumes, nil
+}
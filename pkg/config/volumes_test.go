@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVolume(t *testing.T) {
+	volume, err := ParseVolume("/mnt/datasets:/data:ro", "/home/alice/model")
+	require.NoError(t, err)
+	require.Equal(t, Volume{Source: "/mnt/datasets", Destination: "/data", ReadOnly: true}, volume)
+
+	volume, err = ParseVolume("./data:/data/", "/home/alice/model")
+	require.NoError(t, err)
+	require.Equal(t, Volume{Source: "/home/alice/model/data", Destination: "/data"}, volume)
+
+	for _, s := range []string{"/data", ":/data", "/data:data", "/data:/src", "/data:/", "/data:/data:rx", "/a:/b:ro:z"} {
+		_, err := ParseVolume(s, "/home/alice/model")
+		require.ErrorContains(t, err, "Invalid volume", s)
+	}
+}
+
+func TestVolumeMounts(t *testing.T) {
+	projectDir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(projectDir, "data"), 0o755))
+	other := t.TempDir()
+
+	config, err := FromYAML([]byte("volumes:\n  - ./data:/data:ro\n  - " + other + ":/cache\n"))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+
+	volumes, err := config.VolumeMounts(projectDir, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Volume{
+		{Source: filepath.Join(projectDir, "data"), Destination: "/data", ReadOnly: true},
+		{Source: other, Destination: "/cache"},
+	}, volumes)
+
+	// Volumes in cog.yaml only apply to the project
+	volumes, err = config.VolumeMounts("", nil)
+	require.NoError(t, err)
+	require.Empty(t, volumes)
+
+	volumes, err = config.VolumeMounts(projectDir, []string{other + ":/data"})
+	require.NoError(t, err)
+	require.Equal(t, []Volume{{Source: other, Destination: "/cache"}, {Source: other, Destination: "/data"}}, volumes)
+
+	_, err = config.VolumeMounts(projectDir, []string{filepath.Join(other, "missing") + ":/missing"})
+	require.ErrorContains(t, err, "Failed to mount")
+}
+
+func TestVolumesMountedTwice(t *testing.T) {
+	config, err := FromYAML([]byte("volumes:\n  - /a:/data\n  - /b:/data/\n"))
+	require.NoError(t, err)
+	require.ErrorContains(t, config.ValidateAndComplete("", nil), "More than one volume is mounted at /data")
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/weights"
+)
+
+// WeightsSource is model weights that Cog downloads into the project before it builds the image
+type WeightsSource struct {
+	// Source is where to download the weights from, like hf://stabilityai/sdxl-turbo@main
+	Source string `json:"source" yaml:"source"`
+	// Path is the directory in the project to put the weights in. Defaults to weights/<repo>.
+	Path string `json:"path,omitempty" yaml:"path"`
+	// Include is glob patterns of the files to download. Defaults to all the files.
+	Include []string `json:"include,omitempty" yaml:"include"`
+	// Shared weights aren't built into the image. They're kept in the weights cache on the host and mounted
+	// read-only into the model's container, so containers on the same host share one copy of the files.
+	Shared bool `json:"shared,omitempty" yaml:"shared"`
+}
+
+type weightsSourceFields WeightsSource
+
+func (w *WeightsSource) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var source string
+	if err := unmarshal(&source); err == nil {
+		*w = WeightsSource{Source: source}
+		return nil
+	}
+	fields := weightsSourceFields{}
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	*w = WeightsSource(fields)
+	return nil
+}
+
+func (w *WeightsSource) UnmarshalJSON(data []byte) error {
+	var source string
+	if err := json.Unmarshal(data, &source); err == nil {
+		*w = WeightsSource{Source: source}
+		return nil
+	}
+	fields := weightsSourceFields{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*w = WeightsSource(fields)
+	return nil
+}
+
+// Dir returns the directory in the project the weights are put in, relative to the project
+func (w WeightsSource) Dir() string {
+	if w.Path != "" {
+		return filepath.Clean(w.Path)
+	}
+	repo, err := weights.ParseHuggingFaceURL(w.Source)
+	if err != nil {
+		return ""
+	}
+	return filepath.Join("weights", path.Base(repo.Repo))
+}
+
+func validateWeights(sources []WeightsSource) error {
+	dirs := map[string]string{}
+	for _, w := range sources {
+		if _, err := weights.ParseHuggingFaceURL(w.Source); err != nil {
+			return err
+		}
+		dir := w.Dir()
+		if filepath.IsAbs(dir) || dir == "." || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("Invalid weights path %q for %s, expected a directory inside the project", w.Path, w.Source)
+		}
+		if other, ok := dirs[dir]; ok {
+			return fmt.Errorf("Weights %s and %s are both put in %s. Set path on one of them", other, w.Source, dir)
+		}
+		dirs[dir] = w.Source
+		for _, pattern := range w.Include {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid include pattern %q for %s", pattern, w.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// SharedWeights returns the weights in cog.yaml that are mounted from the weights cache rather than built into the
+// image
+func (c *Config) SharedWeights() []WeightsSource {
+	shared := []WeightsSource{}
+	for _, w := range c.Weights {
+		if w.Shared {
+			shared = append(shared, w)
+		}
+	}
+	return shared
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeights(t *testing.T) {
+	config, err := FromYAML([]byte(`
+weights:
+  - hf://stabilityai/sdxl-turbo@main
+  - source: hf://org/repo
+    path: models/repo
+    include: ["*.safetensors"]
+    shared: true
+`))
+	require.NoError(t, err)
+	require.NoError(t, config.ValidateAndComplete("", nil))
+	require.Equal(t, []WeightsSource{
+		{Source: "hf://stabilityai/sdxl-turbo@main"},
+		{Source: "hf://org/repo", Path: "models/repo", Include: []string{"*.safetensors"}, Shared: true},
+	}, config.Weights)
+	require.Equal(t, []WeightsSource{config.Weights[1]}, config.SharedWeights())
+	require.Equal(t, "weights/sdxl-turbo", config.Weights[0].Dir())
+	require.Equal(t, "models/repo", config.Weights[1].Dir())
+
+	// The config is stored in the image as JSON, so it needs to round trip
+	data, err := json.Marshal(config)
+	require.NoError(t, err)
+	roundTripped := &Config{}
+	require.NoError(t, json.Unmarshal(data, roundTripped))
+	require.Equal(t, config.Weights, roundTripped.Weights)
+}
+
+func TestWeightsInvalid(t *testing.T) {
+	testCases := []struct {
+		name        string
+		yaml        string
+		expectedErr string
+	}{
+		{
+			name:        "unsupported source",
+			yaml:        "weights:\n  - s3://bucket/model\n",
+			expectedErr: `Unsupported weights source "s3://bucket/model"`,
+		},
+		{
+			name:        "path outside the project",
+			yaml:        "weights:\n  - source: hf://org/repo\n    path: ../repo\n",
+			expectedErr: `Invalid weights path "../repo"`,
+		},
+		{
+			name:        "two sources in the same path",
+			yaml:        "weights:\n  - hf://org/repo\n  - hf://other/repo\n",
+			expectedErr: "Weights hf://org/repo and hf://other/repo are both put in weights/repo",
+		},
+		{
+			name:        "invalid include pattern",
+			yaml:        "weights:\n  - source: hf://org/repo\n    include: [\"[\"]\n",
+			expectedErr: `Invalid include pattern "["`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := FromYAML([]byte(tc.yaml))
+			require.NoError(t, err)
+			err = config.ValidateAndComplete("", nil)
+			require.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
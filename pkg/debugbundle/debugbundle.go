@@ -0,0 +1,216 @@
+// Package debugbundle collects what's needed to debug a problem with Cog into a tarball, to attach to a bug report
+package debugbundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// Redacted replaces secrets in the bundle
+const Redacted = "[REDACTED]"
+
+// commandTimeout is how long each command whose output is collected can run for
+const commandTimeout = 10 * time.Second
+
+// secretAssignmentPattern matches secrets assigned to variables in text, like "HF_TOKEN=hf_abc" or "api_key: abc"
+var secretAssignmentPattern = regexp.MustCompile(`(?i)\b([A-Z0-9_]*(?:TOKEN|SECRET|PASSWORD|PASSWD|API_?KEY|ACCESS_KEY|PRIVATE_KEY|CREDENTIALS?)[A-Z0-9_]*)(["']?\s*[=:]\s*["']?)[^\s"',]+`)
+
+// tokenPatterns match tokens that are recognizable without the name of the variable they're in
+var tokenPatterns = regexp.MustCompile(`\b(hf_[A-Za-z0-9]{20,}|r8_[A-Za-z0-9]{20,}|sk-[A-Za-z0-9_-]{20,}|gh[pousr]_[A-Za-z0-9]{20,}|AKIA[A-Z0-9]{16})\b`)
+
+// File is a file in a bundle
+type File struct {
+	Name     string
+	Contents string
+}
+
+// Collect returns the files in a bundle for the project in dir, which has the config cfg, or nil if there isn't a
+// project. Secrets in them are redacted. Things that can't be collected are left out, with why in errors.txt.
+func Collect(ctx context.Context, cfg *config.Config, dir string) []File {
+	files := []File{}
+	failures := []string{}
+	add := func(name string, collect func() (string, error)) {
+		contents, err := collect()
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", name, err))
+			return
+		}
+		files = append(files, File{Name: name, Contents: contents})
+	}
+
+	add("environment.txt", func() (string, error) { return environment(), nil })
+	add("docker-version.txt", commandOutput(ctx, "docker", "version"))
+	add("docker-buildx-version.txt", commandOutput(ctx, "docker", "buildx", "version"))
+	add("docker-info.txt", commandOutput(ctx, "docker", "info"))
+	if _, err := exec.LookPath("nvidia-smi"); err == nil {
+		add("nvidia-smi.txt", commandOutput(ctx, "nvidia-smi"))
+	}
+
+	if cfg != nil {
+		add("config.json", func() (string, error) { return resolvedConfig(cfg) })
+		add("Dockerfile", func() (string, error) { return generatedDockerfile(cfg, dir) })
+		add("build.log", func() (string, error) { return lastBuildLog(dir) })
+	}
+
+	if len(failures) > 0 {
+		files = append(files, File{Name: "errors.txt", Contents: strings.Join(failures, "\n") + "\n"})
+	}
+
+	secrets := configSecrets(cfg)
+	for i := range files {
+		files[i].Contents = Redact(files[i].Contents, secrets)
+	}
+	return files
+}
+
+// Write writes files to a gzipped tarball, in a directory called name
+func Write(w io.Writer, name string, files []File) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, file := range files {
+		header := &tar.Header{
+			Name:    name + "/" + file.Name,
+			Mode:    0o644,
+			Size:    int64(len(file.Contents)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(file.Contents)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Redact replaces secrets in text: the values in secrets, values assigned to names that look like secrets, and
+// tokens that look like API keys
+func Redact(text string, secrets []string) string {
+	for _, secret := range secrets {
+		// Short values are likely to be in the text by chance, like "1" or "true"
+		if len(secret) >= 6 {
+			text = strings.ReplaceAll(text, secret, Redacted)
+		}
+	}
+	text = secretAssignmentPattern.ReplaceAllString(text, "${1}${2}"+Redacted)
+	return tokenPatterns.ReplaceAllString(text, Redacted)
+}
+
+// environment returns the versions of Cog and the operating system, and the environment variables that change how
+// Cog and Docker work
+func environment() string {
+	lines := []string{
+		"cog_version: " + global.Version,
+		"cog_commit: " + global.Commit,
+		"cog_build_time: " + global.BuildTime,
+		"os: " + runtime.GOOS,
+		"arch: " + runtime.GOARCH,
+		"cpus: " + fmt.Sprint(runtime.NumCPU()),
+	}
+	env := []string{}
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		if !strings.HasPrefix(name, "COG_") && !strings.HasPrefix(name, "DOCKER_") && !strings.HasPrefix(name, "BUILDKIT_") && name != "CUDA_VISIBLE_DEVICES" {
+			continue
+		}
+		if config.IsSecretName(name) {
+			value = Redacted
+		}
+		env = append(env, name+"="+value)
+	}
+	sort.Strings(env)
+	lines = append(lines, "", "environment:")
+	lines = append(lines, env...)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// commandOutput returns a function that runs a command, and returns its output
+func commandOutput(ctx context.Context, name string, args ...string) func() (string, error) {
+	return func() (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+		output, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("%s failed: %w\n%s", strings.Join(append([]string{name}, args...), " "), err, output)
+		}
+		return string(output), nil
+	}
+}
+
+// resolvedConfig returns the config after Cog has filled in its defaults, like the versions of CUDA and the Python
+// packages from the requirements file
+func resolvedConfig(cfg *config.Config) (string, error) {
+	contents, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(contents) + "\n", nil
+}
+
+func generatedDockerfile(cfg *config.Config, dir string) (contents string, err error) {
+	generator, err := dockerfile.NewGenerator(cfg, dir, false)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		if cleanupErr := generator.Cleanup(); cleanupErr != nil && err == nil {
+			err = cleanupErr
+		}
+	}()
+	return generator.GenerateDockerfileWithoutSeparateWeights()
+}
+
+func lastBuildLog(dir string) (string, error) {
+	path, err := docker.BuildLogPath(dir)
+	if err != nil {
+		return "", err
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("The project hasn't been built with this version of Cog")
+	}
+	return string(contents), err
+}
+
+// configSecrets returns the values in the config that look like secrets, so they can be redacted wherever they are
+func configSecrets(cfg *config.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	secrets := []string{}
+	for name, value := range cfg.EnvironmentVariables {
+		if config.IsSecretName(name) {
+			secrets = append(secrets, value)
+		}
+	}
+	if cfg.Build != nil {
+		for name, value := range cfg.Build.Args {
+			if config.IsSecretName(name) {
+				secrets = append(secrets, value)
+			}
+		}
+	}
+	return secrets
+}
@@ -0,0 +1,68 @@
+package debugbundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestRedact(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		text     string
+		secrets  []string
+		expected string
+	}{
+		{"config secret", "ENV MY_VALUE=abcdef123\n", []string{"abcdef123"}, "ENV MY_VALUE=[REDACTED]\n"},
+		{"short config secret", "debug: true", []string{"true"}, "debug: true"},
+		{"assignment", "HF_TOKEN=abc123 python", nil, "HF_TOKEN=[REDACTED] python"},
+		{"quoted json", `"REPLICATE_API_TOKEN": "abc123",`, nil, `"REPLICATE_API_TOKEN": "[REDACTED]",`},
+		{"yaml", "password: hunter2", nil, "password: [REDACTED]"},
+		{"token", "pip install --index-url https://hf_abcdefghijklmnopqrstuvwxyz@example.com", nil, "pip install --index-url https://[REDACTED]@example.com"},
+		{"not a secret", "CUDA_VERSION=12.1", nil, "CUDA_VERSION=12.1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, Redact(tt.text, tt.secrets))
+		})
+	}
+}
+
+func TestConfigSecrets(t *testing.T) {
+	cfg := &config.Config{
+		Build:                &config.Build{Args: map[string]string{"HF_TOKEN": "hf-value", "TORCH_VERSION": "2.1"}},
+		EnvironmentVariables: map[string]string{"API_KEY": "key-value", "LOG_LEVEL": "debug"},
+	}
+	require.ElementsMatch(t, []string{"hf-value", "key-value"}, configSecrets(cfg))
+	require.Nil(t, configSecrets(nil))
+}
+
+func TestWrite(t *testing.T) {
+	var b bytes.Buffer
+	err := Write(&b, "cog-debug", []File{{Name: "environment.txt", Contents: "os: linux\n"}, {Name: "Dockerfile", Contents: "FROM python\n"}})
+	require.NoError(t, err)
+
+	gz, err := gzip.NewReader(&b)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[header.Name] = string(contents)
+	}
+	require.Equal(t, map[string]string{
+		"cog-debug/environment.txt": "os: linux\n",
+		"cog-debug/Dockerfile":      "FROM python\n",
+	}, files)
+}
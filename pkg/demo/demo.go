@@ -0,0 +1,184 @@
+// Package demo generates web apps that run a model, with a form for its inputs, from the model's OpenAPI schema. The
+// apps use Gradio or Streamlit, and call the model's HTTP API.
+package demo
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+// Frameworks are the frameworks demos can be generated with
+var Frameworks = []string{"gradio", "streamlit"}
+
+// Packages are the Python packages demos need, by framework
+var Packages = map[string]string{
+	"gradio":    "gradio",
+	"streamlit": "streamlit",
+}
+
+//go:embed templates/gradio.py.tmpl
+var gradioTemplate string
+
+//go:embed templates/streamlit.py.tmpl
+var streamlitTemplate string
+
+// The kinds of inputs and outputs, which is how the app converts them to and from the model's HTTP API
+const (
+	kindText  = "text"
+	kindInt   = "int"
+	kindFloat = "float"
+	kindBool  = "bool"
+	kindFile  = "file"
+	kindFiles = "files"
+	// kindTexts is an iterator of strings, like the tokens a language model generates, which are shown as one text
+	kindTexts = "texts"
+	// kindJSON is anything else, like lists and dictionaries, which are entered and shown as JSON
+	kindJSON = "json"
+)
+
+// field is an input or the output of the model, and the widget the app shows it with
+type field struct {
+	Name   string
+	Kind   string
+	Widget string
+}
+
+// Generate returns a demo for a model, with one of Frameworks. name is the model's name, like its image, which is
+// the demo's title.
+func Generate(schema *openapi3.T, framework string, name string) ([]byte, error) {
+	var tmpl string
+	var widget func(name string, kind string, schema *openapi3.Schema, required bool) string
+	switch framework {
+	case "gradio":
+		tmpl, widget = gradioTemplate, gradioWidget
+	case "streamlit":
+		tmpl, widget = streamlitTemplate, streamlitWidget
+	default:
+		return nil, fmt.Errorf("Demos can't be generated with %s. Choose one of %s", framework, strings.Join(Frameworks, ", "))
+	}
+	inputSchema := cogschema.Component(schema, "Input")
+	if inputSchema == nil {
+		return nil, fmt.Errorf("The model's schema hasn't got its inputs. Build it with a newer version of Cog")
+	}
+
+	inputs := []field{}
+	for _, p := range cogschema.SortedProperties(inputSchema) {
+		kind := inputKind(p.Schema)
+		inputs = append(inputs, field{Name: p.Name, Kind: kind, Widget: widget(p.Name, kind, p.Schema, p.Required)})
+	}
+	output := field{Name: "output", Kind: outputKind(cogschema.Component(schema, "Output"))}
+	output.Widget = widget("output", output.Kind, nil, false)
+
+	t, err := template.New(framework).Funcs(template.FuncMap{"quote": cogschema.PythonString}).Parse(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, map[string]any{
+		"Name":   name,
+		"Inputs": inputs,
+		"Output": output,
+	}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// inputKind returns the kind of an input
+func inputKind(schema *openapi3.Schema) string {
+	schema = cogschema.Resolve(schema)
+	switch {
+	case len(schema.Enum) > 0:
+		// Choices are shown as a dropdown, and sent as they are
+		return kindText
+	case cogschema.IsFile(schema):
+		return kindFile
+	case cogschema.Is(schema, "array") && schema.Items != nil && schema.Items.Value != nil && cogschema.IsFile(schema.Items.Value):
+		return kindFiles
+	case cogschema.Is(schema, "string"):
+		return kindText
+	case cogschema.Is(schema, "integer"):
+		return kindInt
+	case cogschema.Is(schema, "number"):
+		return kindFloat
+	case cogschema.Is(schema, "boolean"):
+		return kindBool
+	}
+	return kindJSON
+}
+
+// outputKind returns the kind of the model's output
+func outputKind(schema *openapi3.Schema) string {
+	if schema == nil {
+		return kindJSON
+	}
+	schema = cogschema.Resolve(schema)
+	switch {
+	case cogschema.IsFile(schema):
+		return kindFile
+	case cogschema.Is(schema, "array") && schema.Items != nil && schema.Items.Value != nil:
+		item := cogschema.Resolve(schema.Items.Value)
+		if cogschema.IsFile(item) {
+			return kindFiles
+		}
+		if cogschema.Is(item, "string") && schema.Extensions["x-cog-array-type"] == "iterator" {
+			return kindTexts
+		}
+	case cogschema.Is(schema, "string"):
+		return kindText
+	}
+	return kindJSON
+}
+
+// jsonDefault returns a default of an input that's entered as JSON, as a Python string literal of the JSON
+func jsonDefault(v any) (string, bool) {
+	if v == nil {
+		return "", false
+	}
+	j, err := json.Marshal(v)
+	if err != nil {
+		return "", false
+	}
+	return cogschema.PythonString(string(j)), true
+}
+
+// choices returns the choices of an input, as Python literals
+func choices(schema *openapi3.Schema) []string {
+	literals := []string{}
+	for _, v := range cogschema.Resolve(schema).Enum {
+		if literal, ok := cogschema.PythonLiteral(v); ok {
+			literals = append(literals, literal)
+		}
+	}
+	return literals
+}
+
+// number returns a number, like a minimum or maximum, as a Python literal of an input's kind, because widgets like
+// sliders need all their numbers to be ints or all of them to be floats
+func number(v *float64, kind string) string {
+	if kind == kindInt {
+		return strconv.FormatInt(int64(*v), 10)
+	}
+	literal := strconv.FormatFloat(*v, 'f', -1, 64)
+	if !strings.ContainsAny(literal, ".eE") {
+		literal += ".0"
+	}
+	return literal
+}
+
+func description(schema *openapi3.Schema) string {
+	if schema == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(schema.Description), " ")
+}
@@ -0,0 +1,113 @@
+package demo
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["prompt"],
+        "properties": {
+          "steps": {"type": "integer", "title": "Steps", "default": 20, "minimum": 1, "maximum": 50, "x-order": 1, "description": "Number of denoising steps"},
+          "prompt": {"type": "string", "title": "Prompt", "x-order": 0, "description": "What to draw"},
+          "image": {"type": "string", "format": "uri", "title": "Image", "x-order": 2},
+          "guidance": {"type": "number", "title": "Guidance", "default": 7, "minimum": 0, "x-order": 3},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "K_EULER", "x-order": 4},
+          "refine": {"type": "boolean", "title": "Refine", "default": false, "x-order": 5},
+          "weights": {"type": "object", "title": "Weights", "default": {"a": 1}, "x-order": 6}
+        }
+      },
+      "scheduler": {"type": "string", "title": "scheduler", "enum": ["DDIM", "K_EULER"]},
+      "Output": {"type": "array", "items": {"type": "string", "format": "uri"}, "title": "Output"}
+    }
+  }
+}`
+
+func loadSchema(t *testing.T, data string) *openapi3.T {
+	t.Helper()
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(data))
+	require.NoError(t, err)
+	return schema
+}
+
+func TestGenerateGradio(t *testing.T) {
+	contents, err := Generate(loadSchema(t, testSchema), "gradio", "r8.im/test/sdxl")
+	require.NoError(t, err)
+	app := string(contents)
+	require.Contains(t, app, `TITLE = "r8.im/test/sdxl"`)
+	require.Contains(t, app, `
+INPUTS = [
+    ("prompt", "text"),
+    ("steps", "int"),
+    ("image", "file"),
+    ("guidance", "float"),
+    ("scheduler", "text"),
+    ("refine", "bool"),
+    ("weights", "json"),
+]
+OUTPUT = "files"
+`)
+	require.Contains(t, app, `
+            inputs = [
+                gr.Textbox(label="prompt", info="What to draw"),
+                gr.Slider(label="steps", info="Number of denoising steps", minimum=1, maximum=50, value=20, step=1),
+                gr.File(label="image", type="filepath"),
+                gr.Number(label="guidance", minimum=0.0, value=7.0),
+                gr.Dropdown(label="scheduler", choices=["DDIM", "K_EULER"], value="K_EULER"),
+                gr.Checkbox(label="refine", value=False),
+                gr.Textbox(label="weights (JSON)", value="{\"a\":1}"),
+            ]
+`)
+	require.Contains(t, app, `            output = gr.File(label="output", file_count="multiple")`)
+}
+
+func TestGenerateStreamlit(t *testing.T) {
+	contents, err := Generate(loadSchema(t, testSchema), "streamlit", "r8.im/test/sdxl")
+	require.NoError(t, err)
+	app := string(contents)
+	require.Contains(t, app, `
+    values = {
+        "prompt": st.text_input("prompt", help="What to draw"),
+        "steps": st.slider("steps", min_value=1, max_value=50, value=20, step=1, help="Number of denoising steps"),
+        "image": st.file_uploader("image"),
+        "guidance": st.number_input("guidance", min_value=0.0, value=7.0),
+        "scheduler": st.selectbox("scheduler", ["DDIM", "K_EULER"], index=1),
+        "refine": st.checkbox("refine", value=False),
+        "weights": st.text_area("weights (JSON)", value="{\"a\":1}"),
+    }
+`)
+}
+
+func TestOutputKind(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		kind   string
+	}{
+		{`{"type": "string", "format": "uri"}`, kindFile},
+		{`{"type": "string"}`, kindText},
+		{`{"type": "array", "items": {"type": "string"}, "x-cog-array-type": "iterator"}`, kindTexts},
+		{`{"type": "array", "items": {"type": "string"}}`, kindJSON},
+		{`{"type": "object", "properties": {"seed": {"type": "integer"}}}`, kindJSON},
+	} {
+		schema := loadSchema(t, `{"openapi": "3.0.2", "info": {"title": "Cog", "version": "0.1.0"}, "paths": {},
+  "components": {"schemas": {"Input": {"type": "object", "properties": {}}, "Output": `+tc.output+`}}}`)
+		require.Equal(t, tc.kind, outputKind(cogschema.Component(schema, "Output")), tc.output)
+	}
+}
+
+func TestGenerateUnknownFramework(t *testing.T) {
+	_, err := Generate(loadSchema(t, testSchema), "dash", "test")
+	require.ErrorContains(t, err, "Choose one of gradio, streamlit")
+}
@@ -0,0 +1,169 @@
+package demo
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+// gradioWidget returns the Gradio component for an input, or the output if schema is nil
+func gradioWidget(name string, kind string, schema *openapi3.Schema, required bool) string {
+	args := []string{"label=" + cogschema.PythonString(name)}
+	if schema == nil {
+		switch kind {
+		case kindFile:
+			return "gr.File(" + args[0] + ")"
+		case kindFiles:
+			return "gr.File(" + args[0] + `, file_count="multiple")`
+		case kindText, kindTexts:
+			return "gr.Textbox(" + args[0] + ")"
+		}
+		return "gr.JSON(" + args[0] + ")"
+	}
+
+	if desc := description(schema); desc != "" && kind != kindFile && kind != kindFiles {
+		args = append(args, "info="+cogschema.PythonString(desc))
+	}
+	value := func() {
+		if v, ok := schema.Default.(float64); ok && (kind == kindInt || kind == kindFloat) {
+			args = append(args, "value="+number(&v, kind))
+		} else if literal, ok := cogschema.PythonLiteral(schema.Default); ok {
+			args = append(args, "value="+literal)
+		}
+	}
+	resolved := cogschema.Resolve(schema)
+	switch {
+	case len(resolved.Enum) > 0:
+		args = append(args, "choices=["+strings.Join(choices(schema), ", ")+"]")
+		value()
+		return "gr.Dropdown(" + strings.Join(args, ", ") + ")"
+	case kind == kindText:
+		value()
+		if resolved.Format == "password" {
+			args = append(args, `type="password"`)
+		}
+		return "gr.Textbox(" + strings.Join(args, ", ") + ")"
+	case kind == kindInt || kind == kindFloat:
+		if resolved.Min != nil && resolved.Max != nil {
+			args = append(args, "minimum="+number(resolved.Min, kind), "maximum="+number(resolved.Max, kind))
+			value()
+			if kind == kindInt {
+				args = append(args, "step=1")
+			}
+			return "gr.Slider(" + strings.Join(args, ", ") + ")"
+		}
+		if resolved.Min != nil {
+			args = append(args, "minimum="+number(resolved.Min, kind))
+		}
+		if resolved.Max != nil {
+			args = append(args, "maximum="+number(resolved.Max, kind))
+		}
+		value()
+		if kind == kindInt {
+			args = append(args, "precision=0")
+		}
+		return "gr.Number(" + strings.Join(args, ", ") + ")"
+	case kind == kindBool:
+		value()
+		return "gr.Checkbox(" + strings.Join(args, ", ") + ")"
+	case kind == kindFile:
+		return "gr.File(" + strings.Join(args, ", ") + `, type="filepath")`
+	case kind == kindFiles:
+		return "gr.File(" + strings.Join(args, ", ") + `, type="filepath", file_count="multiple")`
+	}
+	args[0] = "label=" + cogschema.PythonString(name+" (JSON)")
+	if literal, ok := jsonDefault(schema.Default); ok {
+		args = append(args, "value="+literal)
+	}
+	return "gr.Textbox(" + strings.Join(args, ", ") + ")"
+}
+
+// streamlitWidget returns the Streamlit widget for an input. The output isn't a widget, so it's "".
+func streamlitWidget(name string, kind string, schema *openapi3.Schema, required bool) string {
+	if schema == nil {
+		return ""
+	}
+	args := []string{cogschema.PythonString(name)}
+	help := func() {
+		if desc := description(schema); desc != "" {
+			args = append(args, "help="+cogschema.PythonString(desc))
+		}
+	}
+	literal, hasDefault := cogschema.PythonLiteral(schema.Default)
+	resolved := cogschema.Resolve(schema)
+	switch {
+	case len(resolved.Enum) > 0:
+		options := choices(schema)
+		args = append(args, "["+strings.Join(options, ", ")+"]")
+		index := "0"
+		if !required {
+			index = "None"
+		}
+		for i, option := range options {
+			if hasDefault && option == literal {
+				index = strconv.Itoa(i)
+			}
+		}
+		args = append(args, "index="+index)
+		help()
+		return "st.selectbox(" + strings.Join(args, ", ") + ")"
+	case kind == kindText:
+		if hasDefault {
+			args = append(args, "value="+literal)
+		}
+		if resolved.Format == "password" {
+			args = append(args, `type="password"`)
+		}
+		help()
+		return "st.text_input(" + strings.Join(args, ", ") + ")"
+	case kind == kindInt || kind == kindFloat:
+		widget := "st.number_input"
+		if resolved.Min != nil {
+			args = append(args, "min_value="+number(resolved.Min, kind))
+		}
+		if resolved.Max != nil {
+			args = append(args, "max_value="+number(resolved.Max, kind))
+		}
+		switch {
+		case hasDefault:
+			if v, ok := schema.Default.(float64); ok {
+				literal = number(&v, kind)
+			}
+			args = append(args, "value="+literal)
+		case resolved.Min != nil && resolved.Max != nil:
+			args = append(args, "value="+number(resolved.Min, kind))
+		default:
+			args = append(args, "value=None")
+		}
+		if resolved.Min != nil && resolved.Max != nil {
+			widget = "st.slider"
+		}
+		if kind == kindInt {
+			args = append(args, "step=1")
+		}
+		help()
+		return widget + "(" + strings.Join(args, ", ") + ")"
+	case kind == kindBool:
+		if hasDefault {
+			args = append(args, "value="+literal)
+		}
+		help()
+		return "st.checkbox(" + strings.Join(args, ", ") + ")"
+	case kind == kindFile:
+		help()
+		return "st.file_uploader(" + strings.Join(args, ", ") + ")"
+	case kind == kindFiles:
+		args = append(args, "accept_multiple_files=True")
+		help()
+		return "st.file_uploader(" + strings.Join(args, ", ") + ")"
+	}
+	args[0] = cogschema.PythonString(name + " (JSON)")
+	if literal, ok := jsonDefault(schema.Default); ok {
+		args = append(args, "value="+literal)
+	}
+	help()
+	return "st.text_area(" + strings.Join(args, ", ") + ")"
+}
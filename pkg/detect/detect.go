@@ -0,0 +1,160 @@
+// Package detect inspects a project's Python code, to work out what it needs to run with Cog
+package detect
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Project is what Inspect found in a project
+type Project struct {
+	// Requirements is the path of the project's requirements file, relative to the project, or "" if it hasn't got one
+	Requirements string
+	// PythonVersion is the Python version in the project's .python-version, or "" if it hasn't got one
+	PythonVersion string
+	// Imports are the top-level modules that the project's Python code imports, apart from its own modules
+	Imports []string
+	// Frameworks are the machine learning frameworks in Imports, like "torch"
+	Frameworks []string
+	// UsesCUDA is whether the project's Python code uses CUDA, like with tensor.cuda() or torch.device("cuda")
+	UsesCUDA bool
+	// EntryPoints are the functions that look like they run the model, in the order of the files they're in
+	EntryPoints []EntryPoint
+}
+
+// frameworks are the modules of machine learning frameworks
+var frameworks = []string{"diffusers", "jax", "keras", "onnxruntime", "sklearn", "tensorflow", "torch", "transformers", "vllm", "xgboost"}
+
+// requirementsFiles are the names requirements files are given, in order of preference
+var requirementsFiles = []string{"requirements.txt", "requirements/prod.txt", "requirements/base.txt"}
+
+// skippedDirs are directories that don't have the project's own code in them
+var skippedDirs = map[string]bool{
+	"__pycache__":   true,
+	"node_modules":  true,
+	"site-packages": true,
+	"venv":          true,
+	"env":           true,
+}
+
+var (
+	importPattern     = regexp.MustCompile(`^\s*import\s+(.+)$`)
+	fromImportPattern = regexp.MustCompile(`^\s*from\s+([A-Za-z_][A-Za-z0-9_.]*)\s+import\b`)
+	cudaPattern       = regexp.MustCompile(`\.cuda\(|["']cuda(:[0-9]+)?["']|torch\.cuda\.|device_map\s*=\s*["']auto["']`)
+)
+
+// Inspect returns what's in the project in dir
+func Inspect(dir string) (*Project, error) {
+	project := &Project{}
+	for _, name := range requirementsFiles {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			project.Requirements = name
+			break
+		}
+	}
+	if contents, err := os.ReadFile(filepath.Join(dir, ".python-version")); err == nil {
+		project.PythonVersion = strings.TrimSpace(string(contents))
+	}
+
+	sources, err := pythonFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	imports := map[string]bool{}
+	for _, source := range sources {
+		contents, err := os.ReadFile(filepath.Join(dir, source))
+		if err != nil {
+			return nil, err
+		}
+		for _, module := range fileImports(contents) {
+			imports[module] = true
+		}
+		if cudaPattern.Match(contents) {
+			project.UsesCUDA = true
+		}
+		project.EntryPoints = append(project.EntryPoints, fileEntryPoints(source, contents)...)
+	}
+
+	local := localModules(sources)
+	for module := range imports {
+		if !local[module] {
+			project.Imports = append(project.Imports, module)
+		}
+	}
+	sort.Strings(project.Imports)
+	for _, module := range project.Imports {
+		for _, framework := range frameworks {
+			if module == framework {
+				project.Frameworks = append(project.Frameworks, module)
+			}
+		}
+	}
+	return project, nil
+}
+
+// pythonFiles returns the paths of the Python files in dir, relative to it and sorted, apart from ones in hidden
+// directories and virtualenvs
+func pythonFiles(dir string) ([]string, error) {
+	sources := []string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(d.Name(), ".") || skippedDirs[d.Name()]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(path) == ".py" {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			sources = append(sources, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(sources)
+	return sources, err
+}
+
+// fileImports returns the top-level modules that Python code imports, apart from relative imports
+func fileImports(contents []byte) []string {
+	modules := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := fromImportPattern.FindStringSubmatch(line); match != nil {
+			modules = append(modules, strings.Split(match[1], ".")[0])
+			continue
+		}
+		if match := importPattern.FindStringSubmatch(line); match != nil {
+			statement, _, _ := strings.Cut(match[1], "#")
+			for _, name := range strings.Split(statement, ",") {
+				// "import numpy as np"
+				fields := strings.Fields(name)
+				if len(fields) > 0 {
+					modules = append(modules, strings.Split(fields[0], ".")[0])
+				}
+			}
+		}
+	}
+	return modules
+}
+
+// localModules returns the top-level modules that the Python files at paths are, or are in
+func localModules(paths []string) map[string]bool {
+	modules := map[string]bool{}
+	for _, path := range paths {
+		first, _, _ := strings.Cut(path, "/")
+		modules[strings.TrimSuffix(first, ".py")] = true
+	}
+	return modules
+}
@@ -0,0 +1,90 @@
+package detect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	}
+}
+
+func TestInspect(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"requirements.txt": "torch==2.3.1\n",
+		".python-version":  "3.11\n",
+		"inference.py": `import os, sys
+import numpy as np
+import torch.nn as nn  # the model
+from transformers import AutoModel
+from models.unet import UNet
+from . import helpers
+
+model = AutoModel.from_pretrained("gpt2").to("cuda")
+
+def run(prompt: str, steps: int = 50, *args, **kwargs) -> str:
+    return model(prompt)
+`,
+		"models/unet.py": `from PIL import Image
+
+class UNet:
+    def predict(self, image):
+        pass
+`,
+		"train.py": `def main(
+    epochs=10,
+    lr: float = 1e-4,
+    layers: list[int] = [1, 2],
+):
+    pass
+`,
+		".venv/lib/site.py": "import notaproject\n",
+	})
+
+	project, err := Inspect(dir)
+	require.NoError(t, err)
+	require.Equal(t, "requirements.txt", project.Requirements)
+	require.Equal(t, "3.11", project.PythonVersion)
+	require.Equal(t, []string{"PIL", "numpy", "os", "sys", "torch", "transformers"}, project.Imports)
+	require.Equal(t, []string{"torch", "transformers"}, project.Frameworks)
+	require.True(t, project.UsesCUDA)
+	require.Equal(t, []EntryPoint{
+		{
+			File:     "inference.py",
+			Function: "run",
+			Arguments: []Argument{
+				{Name: "prompt", Type: "str"},
+				{Name: "steps", Type: "int", Default: "50"},
+			},
+			ReturnType: "str",
+		},
+		{
+			File:     "train.py",
+			Function: "main",
+			Arguments: []Argument{
+				{Name: "epochs", Default: "10"},
+				{Name: "lr", Type: "float", Default: "1e-4"},
+				{Name: "layers", Type: "list[int]", Default: "[1, 2]"},
+			},
+		},
+	}, project.EntryPoints)
+}
+
+func TestInspectEmpty(t *testing.T) {
+	project, err := Inspect(t.TempDir())
+	require.NoError(t, err)
+	require.Equal(t, &Project{}, project)
+}
+
+func TestEntryPointModule(t *testing.T) {
+	require.Equal(t, "models.infer", EntryPoint{File: "models/infer.py"}.Module())
+}
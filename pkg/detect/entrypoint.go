@@ -0,0 +1,123 @@
+package detect
+
+import (
+	"regexp"
+	"strings"
+)
+
+// EntryPoint is a function in a project that looks like it runs the model
+type EntryPoint struct {
+	// File is the path of the Python file the function is in, relative to the project
+	File string
+	// Function is the name of the function
+	Function string
+	// Arguments are the arguments of the function, apart from *args and **kwargs
+	Arguments []Argument
+	// ReturnType is the return annotation of the function, or "" if it hasn't got one
+	ReturnType string
+}
+
+// Argument is an argument of an entry point
+type Argument struct {
+	Name string
+	// Type is the argument's annotation, or "" if it hasn't got one
+	Type string
+	// Default is the Python expression of the argument's default, or "" if it hasn't got one
+	Default string
+}
+
+// Module returns the Python module the entry point is in, like "models.infer" for models/infer.py
+func (e EntryPoint) Module() string {
+	return strings.ReplaceAll(strings.TrimSuffix(e.File, ".py"), "/", ".")
+}
+
+// entryPointNames are the names of functions that usually run models
+var entryPointNames = []string{"predict", "infer", "inference", "run_inference", "generate", "run", "main"}
+
+var entryPointPattern = regexp.MustCompile(`(?m)^(?:async\s+)?def\s+(` + strings.Join(entryPointNames, "|") + `)\s*\(`)
+
+// fileEntryPoints returns the top-level functions in a Python file that look like they run a model
+func fileEntryPoints(path string, contents []byte) []EntryPoint {
+	entryPoints := []EntryPoint{}
+	source := string(contents)
+	for _, match := range entryPointPattern.FindAllStringSubmatchIndex(source, -1) {
+		arguments, rest, ok := splitParenthesized(source[match[1]:])
+		if !ok {
+			continue
+		}
+		entryPoint := EntryPoint{File: path, Function: source[match[2]:match[3]]}
+		for _, argument := range splitTopLevel(arguments) {
+			if a, ok := parseArgument(argument); ok {
+				entryPoint.Arguments = append(entryPoint.Arguments, a)
+			}
+		}
+		// ") -> str:"
+		if returns, ok := strings.CutPrefix(strings.TrimSpace(rest), "->"); ok {
+			if annotation, _, ok := strings.Cut(returns, ":"); ok {
+				entryPoint.ReturnType = strings.TrimSpace(annotation)
+			}
+		}
+		entryPoints = append(entryPoints, entryPoint)
+	}
+	return entryPoints
+}
+
+// splitParenthesized returns the text before the parenthesis that closes the one before s, and the rest of the line
+// after it
+func splitParenthesized(s string) (inside string, rest string, ok bool) {
+	depth := 1
+	for i, r := range s {
+		switch r {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth == 0 {
+				rest, _, _ := strings.Cut(s[i+1:], "\n")
+				return s[:i], rest, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// splitTopLevel splits a list of arguments on the commas that aren't in brackets or strings
+func splitTopLevel(s string) []string {
+	parts := []string{}
+	depth := 0
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseArgument parses an argument like "steps: int = 50". It's not ok for self, *args and **kwargs.
+func parseArgument(s string) (Argument, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "self" || s == "/" || strings.HasPrefix(s, "*") {
+		return Argument{}, false
+	}
+	argument := Argument{}
+	s, argument.Default, _ = strings.Cut(s, "=")
+	s, argument.Type, _ = strings.Cut(s, ":")
+	argument.Name = strings.TrimSpace(s)
+	argument.Type = strings.TrimSpace(argument.Type)
+	argument.Default = strings.TrimSpace(argument.Default)
+	return argument, true
+}
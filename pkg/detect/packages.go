@@ -0,0 +1,115 @@
+package detect
+
+import (
+	_ "embed"
+	"slices"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// stdlib is the modules in Python's standard library, one per line, from sys.stdlib_module_names
+//
+//go:embed stdlib.txt
+var stdlib string
+
+var stdlibModules = func() map[string]bool {
+	modules := map[string]bool{}
+	for _, module := range strings.Fields(stdlib) {
+		modules[module] = true
+	}
+	return modules
+}()
+
+// modulePackages are the pip packages of modules that are named differently from them
+var modulePackages = map[string]string{
+	"Crypto":       "pycryptodome",
+	"OpenSSL":      "pyOpenSSL",
+	"PIL":          "pillow",
+	"attr":         "attrs",
+	"bs4":          "beautifulsoup4",
+	"cv2":          "opencv-python",
+	"dateutil":     "python-dateutil",
+	"docx":         "python-docx",
+	"dotenv":       "python-dotenv",
+	"faiss":        "faiss-cpu",
+	"ffmpeg":       "ffmpeg-python",
+	"fitz":         "PyMuPDF",
+	"git":          "GitPython",
+	"jwt":          "PyJWT",
+	"magic":        "python-magic",
+	"mpl_toolkits": "matplotlib",
+	"pptx":         "python-pptx",
+	"serial":       "pyserial",
+	"skimage":      "scikit-image",
+	"sklearn":      "scikit-learn",
+	"whisper":      "openai-whisper",
+	"yaml":         "PyYAML",
+}
+
+// ignoredModules are modules that aren't the project's dependencies, because Cog installs them, or they come with
+// pip
+var ignoredModules = map[string]bool{
+	"cog":           true,
+	"pip":           true,
+	"pkg_resources": true,
+	"setuptools":    true,
+}
+
+// PythonPackage returns the pip package that a module is in
+func PythonPackage(module string) string {
+	if pkg, ok := modulePackages[module]; ok {
+		return pkg
+	}
+	return module
+}
+
+// Suggestion is a package that a project needs
+type Suggestion struct {
+	Package string
+	// Reason is why the project needs it, like "imported as cv2" or "for opencv-python"
+	Reason string
+}
+
+// Suggestions are the packages that a project needs, but aren't in its cog.yaml
+type Suggestions struct {
+	PythonPackages []Suggestion
+	SystemPackages []Suggestion
+}
+
+// Suggest returns the packages that the project's code needs, but aren't in its config: the Python packages it
+// imports, and the system packages they need
+func Suggest(project *Project, cfg *config.Config) Suggestions {
+	suggestions := Suggestions{}
+	pythonPackages := []string{}
+	for _, pkg := range cfg.PythonPackages() {
+		pythonPackages = append(pythonPackages, config.PythonPackageName(pkg))
+	}
+	for _, module := range project.Imports {
+		if stdlibModules[module] || ignoredModules[module] {
+			continue
+		}
+		pkg := PythonPackage(module)
+		if slices.Contains(pythonPackages, config.PythonPackageName(pkg)) {
+			continue
+		}
+		reason := "imported"
+		if pkg != module {
+			reason = "imported as " + module
+		}
+		suggestions.PythonPackages = append(suggestions.PythonPackages, Suggestion{Package: pkg, Reason: reason})
+		pythonPackages = append(pythonPackages, config.PythonPackageName(pkg))
+	}
+
+	systemPackages := slices.Clone(cfg.Build.SystemPackages)
+	for _, pythonPackage := range pythonPackages {
+		for _, pkg := range config.SystemPackagesForPythonPackage(pythonPackage) {
+			if slices.Contains(systemPackages, pkg) {
+				continue
+			}
+			suggestions.SystemPackages = append(suggestions.SystemPackages, Suggestion{Package: pkg, Reason: "for " + pythonPackage})
+			systemPackages = append(systemPackages, pkg)
+		}
+	}
+	return suggestions
+}
@@ -0,0 +1,43 @@
+package detect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestSuggest(t *testing.T) {
+	cfg, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.11"
+  python_packages:
+    - torch==2.3.1
+    - Pillow==10.4.0
+  system_packages:
+    - libgl1
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, cfg.ValidateAndComplete(t.TempDir(), nil))
+
+	project := &Project{Imports: []string{"PIL", "cog", "cv2", "json", "librosa", "numpy", "os", "torch"}}
+	require.Equal(t, Suggestions{
+		PythonPackages: []Suggestion{
+			{Package: "opencv-python", Reason: "imported as cv2"},
+			{Package: "librosa", Reason: "imported"},
+			{Package: "numpy", Reason: "imported"},
+		},
+		SystemPackages: []Suggestion{
+			{Package: "libglib2.0-0", Reason: "for opencv-python"},
+			{Package: "ffmpeg", Reason: "for librosa"},
+			{Package: "libsndfile1", Reason: "for librosa"},
+		},
+	}, Suggest(project, cfg))
+}
+
+func TestPythonPackage(t *testing.T) {
+	require.Equal(t, "scikit-learn", PythonPackage("sklearn"))
+	require.Equal(t, "torch", PythonPackage("torch"))
+}
@@ -1,25 +1,93 @@
 package docker
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"io"
 	"runtime"
+	"sort"
 	"strings"
 
+	"github.com/replicate/cog/pkg/ci"
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/dockerfile"
+	cogerrors "github.com/replicate/cog/pkg/errors"
 
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func Build(dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string, epoch int64) error {
+// Build builds dockerfileContents in dir as imageName. buildArgs are build args to pass with --build-arg, in the form
+// KEY=VALUE.
+func Build(ctx context.Context, dir, dockerfileContents, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, epoch int64) error {
+	args, err := BuildArgs(imageName, secrets, buildArgs, noCache, progressOutput, epoch)
+	if err != nil {
+		return err
+	}
+	if epoch >= 0 {
+		console.Infof("Forcing timestamp rewriting to epoch %d", epoch)
+	}
+
+	buildLog := createBuildLog(dir)
+	defer buildLog.Close()
+	defer ci.StartGroup(ctx, "Build "+imageName)()
+
+	layer := ""
+	// build output is all messaging, so write it with the messages on stderr
+	output := io.MultiWriter(console.Writer(), buildLog, buildOutput(ctx), &lineWriter{fn: func(line string) {
+		if step := failedStep(line); step != "" {
+			layer = step
+		}
+	}})
+	cmd := command(ctx, args...)
+	cmd.Dir = dir
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Stdin = strings.NewReader(dockerfileContents)
+
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if layer != "" {
+			err = fmt.Errorf("%s failed: %w", layer, err)
+		}
+		return &cogerrors.BuildError{Stage: cogerrors.BuildStageImage, Layer: layer, Err: err}
+	}
+	return nil
+}
+
+// BuildFiles builds dockerfileContents in dir and writes the files in its final stage to outputDir, instead of making
+// an image. It's for building things that aren't images, like programs built in a container that has the toolchain
+// for them.
+func BuildFiles(ctx context.Context, dir, dockerfileContents, outputDir, progressOutput string) error {
+	cmd := command(ctx,
+		"buildx", "build",
+		"--file", "-",
+		"--output", "type=local,dest="+outputDir,
+		"--progress", progressOutput,
+		".",
+	)
+	cmd.Dir = dir
+	cmd.Stdout = console.Writer()
+	cmd.Stderr = console.Writer()
+	cmd.Stdin = strings.NewReader(dockerfileContents)
+
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+// BuildArgs returns the arguments to `docker` that Build runs, with the Dockerfile read from stdin
+func BuildArgs(imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string, epoch int64) ([]string, error) {
 	var args []string
 
 	userCache, err := dockerfile.UserCache()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	args = append(args,
@@ -35,6 +103,10 @@ func Build(dir, dockerfileContents, imageName string, secrets []string, noCache
 		args = append(args, "--secret", secret)
 	}
 
+	for _, buildArg := range buildArgs {
+		args = append(args, "--build-arg", buildArg)
+	}
+
 	if noCache {
 		args = append(args, "--no-cache")
 	}
@@ -46,8 +118,6 @@ func Build(dir, dockerfileContents, imageName string, secrets []string, noCache
 		args = append(args,
 			"--build-arg", fmt.Sprintf("SOURCE_DATE_EPOCH=%d", epoch),
 			"--output", "type=docker,rewrite-timestamp=true")
-		console.Infof("Forcing timestamp rewriting to epoch %d", epoch)
-
 	}
 
 	if config.BuildXCachePath != "" {
@@ -66,18 +136,48 @@ func Build(dir, dockerfileContents, imageName string, secrets []string, noCache
 		"--progress", progressOutput,
 		".",
 	)
+	return args, nil
+}
 
-	cmd := exec.Command("docker", args...)
+// BuildAddLabelsAndSchemaToImage adds labels to an image, and copies the bundled schema and model card into it. The
+// bundled files are relative to dir.
+func BuildAddLabelsAndSchemaToImage(ctx context.Context, dir string, image string, labels map[string]string, bundledSchemaFile string, bundledSchemaPy string, bundledModelCardFile string) error {
+	args := AddLabelsArgs(image, labels)
+	cmd := command(ctx, args...)
 	cmd.Dir = dir
-	cmd.Stdout = os.Stderr // redirect stdout to stderr - build output is all messaging
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = strings.NewReader(dockerfileContents)
+
+	dockerfile := "FROM " + image + "\n"
+	dockerfile += "COPY " + bundledModelCardFile + " .cog/\n"
+	dockerfile += "COPY " + bundledSchemaFile + " .cog\n"
+	cmd.Stdin = strings.NewReader(dockerfile)
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+
+	if combinedOutput, err := cmd.CombinedOutput(); err != nil {
+		console.Info(string(combinedOutput))
+		return contextError(ctx, err)
+	}
+	return nil
 }
 
-func BuildAddLabelsAndSchemaToImage(image string, labels map[string]string, bundledSchemaFile string, bundledSchemaPy string) error {
+// BuildAddLabelsToImage adds labels to an image, replacing any it already has with the same keys
+func BuildAddLabelsToImage(ctx context.Context, dir string, image string, labels map[string]string) error {
+	args := AddLabelsArgs(image, labels)
+	cmd := command(ctx, args...)
+	cmd.Dir = dir
+	cmd.Stdin = strings.NewReader("FROM " + image + "\n")
+
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	if combinedOutput, err := cmd.CombinedOutput(); err != nil {
+		console.Info(string(combinedOutput))
+		return contextError(ctx, err)
+	}
+	return nil
+}
+
+// AddLabelsArgs returns the arguments to `docker` that BuildAddLabelsAndSchemaToImage runs
+func AddLabelsArgs(image string, labels map[string]string) []string {
 	var args []string
 
 	args = append(args,
@@ -93,24 +193,17 @@ func BuildAddLabelsAndSchemaToImage(image string, labels map[string]string, bund
 		"--file", "-",
 		"--tag", image,
 	)
-	for k, v := range labels {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
 		// Unlike in Dockerfiles, the value here does not need quoting -- Docker merely
 		// splits on the first '=' in the argument and the rest is the label value.
-		args = append(args, "--label", fmt.Sprintf(`%s=%s`, k, v))
+		args = append(args, "--label", fmt.Sprintf(`%s=%s`, k, labels[k]))
 	}
 	// We're not using context, but Docker requires we pass a context
 	args = append(args, ".")
-	cmd := exec.Command("docker", args...)
-
-	dockerfile := "FROM " + image + "\n"
-	dockerfile += "COPY " + bundledSchemaFile + " .cog\n"
-	cmd.Stdin = strings.NewReader(dockerfile)
-
-	console.Debug("$ " + strings.Join(cmd.Args, " "))
-
-	if combinedOutput, err := cmd.CombinedOutput(); err != nil {
-		console.Info(string(combinedOutput))
-		return err
-	}
-	return nil
+	return args
 }
@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// BuildLogPath returns the path of the log of the last build of the project in dir. It's kept in the user's cache
+// directory, rather than the project, so it isn't part of the next build's context.
+func BuildLogPath(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256([]byte(abs))
+	return filepath.Join(cacheDir, "cog", "build-logs", hex.EncodeToString(hash[:])[:16]+".log"), nil
+}
+
+// createBuildLog creates the log of a build of the project in dir, replacing the last one. If it can't, the build
+// isn't logged, so it returns io.Discard.
+func createBuildLog(dir string) io.WriteCloser {
+	path, err := BuildLogPath(dir)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.Create(path)
+	}
+	if err != nil {
+		console.Debugf("Failed to create build log: %s", err)
+		return nopWriteCloser{io.Discard}
+	}
+	return f
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+type buildOutputKey struct{}
+
+// WithBuildOutput returns a context that makes the builds it's passed to write Docker's output to w, as well as where
+// messages are written. It lets services that run several builds at the same time keep each build's output apart.
+func WithBuildOutput(ctx context.Context, w io.Writer) context.Context {
+	return context.WithValue(ctx, buildOutputKey{}, w)
+}
+
+// buildOutput returns the writer that WithBuildOutput added to ctx, or io.Discard if it hasn't got one
+func buildOutput(ctx context.Context) io.Writer {
+	if w, ok := ctx.Value(buildOutputKey{}).(io.Writer); ok {
+		return w
+	}
+	return io.Discard
+}
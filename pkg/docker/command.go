@@ -0,0 +1,37 @@
+package docker
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// cancelWaitDelay is how long docker has to exit after it's interrupted, before it's killed
+const cancelWaitDelay = 10 * time.Second
+
+// command returns a docker command that's interrupted when ctx is canceled, like pressing Ctrl-C, so docker cleans
+// up (stopping a build, or a container started with --rm) rather than leaving it behind. It's killed if it doesn't
+// exit soon after.
+func command(ctx context.Context, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Cancel = func() error {
+		// Windows can't send an interrupt to another process. Ctrl-C is sent to docker by the console anyway, so if
+		// ctx was canceled some other way it's killed.
+		if runtime.GOOS == "windows" {
+			return cmd.Process.Kill()
+		}
+		return cmd.Process.Signal(os.Interrupt)
+	}
+	cmd.WaitDelay = cancelWaitDelay
+	return cmd
+}
+
+// contextError returns ctx's error if it was canceled or timed out, which is why a command failed, or otherwise err
+func contextError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
@@ -1,21 +1,21 @@
 package docker
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 
 	"github.com/docker/docker/api/types"
 )
 
-func ContainerInspect(id string) (*types.ContainerJSON, error) {
-	cmd := exec.Command("docker", "container", "inspect", id)
+func ContainerInspect(ctx context.Context, id string) (*types.ContainerJSON, error) {
+	cmd := command(ctx, "container", "inspect", id)
 	cmd.Env = os.Environ()
 
 	out, err := cmd.Output()
 	if err != nil {
-		return nil, err
+		return nil, contextError(ctx, err)
 	}
 	var slice []types.ContainerJSON
 	err = json.Unmarshal(out, &slice)
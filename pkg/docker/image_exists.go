@@ -1,7 +1,9 @@
 package docker
 
-func ImageExists(id string) (bool, error) {
-	_, err := ImageInspect(id)
+import "context"
+
+func ImageExists(ctx context.Context, id string) (bool, error) {
+	_, err := ImageInspect(ctx, id)
 	if err == ErrNoSuchImage {
 		return false, nil
 	}
@@ -1,15 +1,24 @@
 package docker
 
 import (
+	"context"
 	"io"
 	"os"
-	"os/exec"
 )
 
-func ContainerLogsFollow(containerID string, out io.Writer) error {
-	cmd := exec.Command("docker", "container", "logs", "--follow", containerID)
+func ContainerLogsFollow(ctx context.Context, containerID string, out io.Writer) error {
+	return ContainerLogs(ctx, containerID, true, out)
+}
+
+func ContainerLogs(ctx context.Context, containerID string, follow bool, out io.Writer) error {
+	args := []string{"container", "logs"}
+	if follow {
+		args = append(args, "--follow")
+	}
+	args = append(args, containerID)
+	cmd := command(ctx, args...)
 	cmd.Env = os.Environ()
 	cmd.Stdout = out
 	cmd.Stderr = out
-	return cmd.Run()
+	return contextError(ctx, cmd.Run())
 }
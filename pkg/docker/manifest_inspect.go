@@ -1,14 +1,14 @@
 package docker
 
 import (
-	"os/exec"
+	"context"
 	"strings"
 
 	"github.com/replicate/cog/pkg/util/console"
 )
 
-func ManifestInspect(image string) error {
-	cmd := exec.Command("docker", "manifest", "inspect", image)
+func ManifestInspect(ctx context.Context, image string) error {
+	cmd := command(ctx, "manifest", "inspect", image)
 	var out strings.Builder
 	cmd.Stdout = &out
 	cmd.Stderr = &out
@@ -21,7 +21,7 @@ func ManifestInspect(image string) error {
 		if strings.Contains(output, "no such manifest") || strings.Contains(output, "manifest unknown") || strings.Contains(output, "not found") {
 			return nil
 		}
-		return err
+		return contextError(ctx, err)
 	}
 	return nil
 }
@@ -0,0 +1,112 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+// failedStepRegexp matches the line BuildKit prints before the output of a step that failed, like
+// " > [stage-0 5/12] RUN pip install -r requirements.txt:"
+var failedStepRegexp = regexp.MustCompile(`^\s*> \[([^\]]+)\] (.+):$`)
+
+// registryAuthMessages are what registries and Docker say when they refuse to push or pull an image
+var registryAuthMessages = []string{
+	"unauthorized",
+	"authentication required",
+	"no basic auth credentials",
+	"denied:",
+	"access denied",
+}
+
+// temporaryNetworkMessages are what Docker says when the connection to a registry fails in a way that's worth retrying
+var temporaryNetworkMessages = []string{
+	"connection reset by peer",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"502 bad gateway",
+	"503 service unavailable",
+	"504 gateway timeout",
+	"too many requests",
+}
+
+// lineWriter calls fn with each line written to it
+type lineWriter struct {
+	fn  func(line string)
+	buf []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(strings.TrimRight(string(w.buf[:i]), "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// failedStep returns the step that failed from a line of build output, like "[stage-0 5/12] RUN pip install", or
+// "" if it isn't the line that says which step failed
+func failedStep(line string) string {
+	match := failedStepRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return ""
+	}
+	return fmt.Sprintf("[%s] %s", strings.Join(strings.Fields(match[1]), " "), match[2])
+}
+
+// isRegistryAuthMessage returns whether a line of push or pull output says the registry refused access
+func isRegistryAuthMessage(line string) bool {
+	line = strings.ToLower(line)
+	for _, message := range registryAuthMessages {
+		if strings.Contains(line, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTemporaryNetworkMessage returns whether a line of push or pull output says the connection to the registry failed
+// in a way that's worth retrying
+func isTemporaryNetworkMessage(line string) bool {
+	line = strings.ToLower(line)
+	for _, message := range temporaryNetworkMessages {
+		if strings.Contains(line, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// registryHost returns the host of the registry an image is in, or "" if the image name isn't valid
+func registryHost(image string) string {
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return ""
+	}
+	return ref.Context().RegistryStr()
+}
+
+// registryCommandError returns the error for a push or pull that failed, which is a RegistryAuthError if authFailed
+func registryCommandError(image string, err error, authFailed bool) error {
+	if !authFailed {
+		return err
+	}
+	host := registryHost(image)
+	return &cogerrors.RegistryAuthError{
+		Registry: host,
+		Err:      fmt.Errorf("%s refused access to %s: %w", host, image, err),
+	}
+}
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+func TestFailedStep(t *testing.T) {
+	require.Equal(t, "[stage-0 5/12] RUN pip install -r /tmp/requirements.txt", failedStep(" > [stage-0  5/12] RUN pip install -r /tmp/requirements.txt:"))
+	require.Equal(t, "", failedStep("#10 [stage-0  5/12] RUN pip install -r /tmp/requirements.txt"))
+	require.Equal(t, "", failedStep("ERROR: failed to solve: process did not complete successfully: exit code: 1"))
+}
+
+func TestLineWriter(t *testing.T) {
+	lines := []string{}
+	w := &lineWriter{fn: func(line string) { lines = append(lines, line) }}
+	_, _ = fmt.Fprint(w, "one\r\ntw")
+	_, _ = fmt.Fprint(w, "o\nthree")
+	require.Equal(t, []string{"one", "two"}, lines)
+}
+
+func TestRegistryCommandError(t *testing.T) {
+	err := errors.New("exit status 1")
+	require.Equal(t, err, registryCommandError("r8.im/alice/hotdog", err, false))
+
+	require.True(t, isRegistryAuthMessage("unauthorized: authentication required"))
+	require.True(t, isRegistryAuthMessage("denied: requested access to the resource is denied"))
+	require.False(t, isRegistryAuthMessage("latest: digest: sha256:abc size: 1234"))
+
+	var authErr *cogerrors.RegistryAuthError
+	require.ErrorAs(t, registryCommandError("r8.im/alice/hotdog", err, true), &authErr)
+	require.Equal(t, "r8.im", authErr.Registry)
+	require.ErrorIs(t, authErr, err)
+}
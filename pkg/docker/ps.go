@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Labels applied to containers started by Cog, so they can be found again with `cog ps`.
+// These are only set on containers, never on images, so they're not inherited from a model image.
+var (
+	ContainerCommandLabel = global.LabelNamespace + "command"
+	ContainerProjectLabel = global.LabelNamespace + "project"
+)
+
+type Container struct {
+	ID      string
+	Name    string
+	Image   string
+	Status  string
+	Ports   string
+	Command string
+	Project string
+}
+
+// ListContainers returns the running containers that were started by Cog
+func ListContainers(ctx context.Context) ([]Container, error) {
+	format := strings.Join([]string{
+		"{{.ID}}",
+		"{{.Names}}",
+		"{{.Image}}",
+		"{{.Status}}",
+		"{{.Ports}}",
+		fmt.Sprintf("{{.Label %q}}", ContainerCommandLabel),
+		fmt.Sprintf("{{.Label %q}}", ContainerProjectLabel),
+	}, "\t")
+	cmd := command(ctx, "ps", "--filter", "label="+ContainerCommandLabel, "--format", format, "--no-trunc")
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return parseContainerList(out)
+}
+
+// FindContainer returns the running container started by Cog with the given name or ID prefix
+func FindContainer(ctx context.Context, nameOrID string) (*Container, error) {
+	containers, err := ListContainers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range containers {
+		if c.Name == nameOrID || strings.HasPrefix(c.ID, nameOrID) {
+			return &c, nil
+		}
+	}
+	return nil, fmt.Errorf("No running Cog container named %s. Run 'cog ps' to see running containers.", nameOrID)
+}
+
+func parseContainerList(out []byte) ([]Container, error) {
+	containers := []Container{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			return nil, fmt.Errorf("Failed to parse docker ps output: %q", line)
+		}
+		containers = append(containers, Container{
+			ID:      fields[0],
+			Name:    fields[1],
+			Image:   fields[2],
+			Status:  fields[3],
+			Ports:   fields[4],
+			Command: fields[5],
+			Project: fields[6],
+		})
+	}
+	return containers, scanner.Err()
+}
+
+// ListMountSources returns the directories and files on the host that are mounted into running containers, whether or
+// not Cog started them
+func ListMountSources(ctx context.Context) ([]string, error) {
+	cmd := command(ctx, "ps", "--quiet", "--no-trunc")
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	ids := strings.Fields(string(out))
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := append([]string{"container", "inspect", "--format", `{{range .Mounts}}{{.Source}}{{"\n"}}{{end}}`}, ids...)
+	cmd = command(ctx, args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	sources := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if source := strings.TrimSpace(line); source != "" {
+			sources = append(sources, source)
+		}
+	}
+	return sources, nil
+}
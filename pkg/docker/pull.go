@@ -1,18 +1,41 @@
 package docker
 
 import (
-	"os"
-	"os/exec"
+	"context"
+	"io"
 	"strings"
 
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/retry"
 )
 
-func Pull(image string) error {
-	cmd := exec.Command("docker", "pull", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// Pull pulls an image, retrying if the connection to the registry fails. Docker keeps the layers that finished
+// downloading, so a retry carries on from where the last attempt got to.
+func Pull(ctx context.Context, image string) error {
+	return retry.Do(ctx, retry.DefaultBackoff, func() error {
+		return pull(ctx, image)
+	})
+}
+
+func pull(ctx context.Context, image string) error {
+	authFailed, temporary := false, false
+	output := io.MultiWriter(console.Writer(), &lineWriter{fn: func(line string) {
+		authFailed = authFailed || isRegistryAuthMessage(line)
+		temporary = temporary || isTemporaryNetworkMessage(line)
+	}})
+	cmd := command(ctx, "pull", image)
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if temporary && !authFailed {
+			return retry.Retryable(err)
+		}
+		return registryCommandError(image, err, authFailed)
+	}
+	return nil
 }
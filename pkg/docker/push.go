@@ -1,19 +1,41 @@
 package docker
 
 import (
-	"os"
-	"os/exec"
+	"context"
+	"io"
 	"strings"
 
 	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/retry"
 )
 
-func Push(image string) error {
-	cmd := exec.Command(
-		"docker", "push", image)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// Push pushes an image, retrying if the connection to the registry fails. Layers that finished uploading are already
+// in the registry, so a retry carries on from where the last attempt got to.
+func Push(ctx context.Context, image string) error {
+	return retry.Do(ctx, retry.DefaultBackoff, func() error {
+		return push(ctx, image)
+	})
+}
+
+func push(ctx context.Context, image string) error {
+	authFailed, temporary := false, false
+	output := io.MultiWriter(console.Writer(), &lineWriter{fn: func(line string) {
+		authFailed = authFailed || isRegistryAuthMessage(line)
+		temporary = temporary || isTemporaryNetworkMessage(line)
+	}})
+	cmd := command(ctx, "push", image)
+	cmd.Stdout = output
+	cmd.Stderr = output
 
 	console.Debug("$ " + strings.Join(cmd.Args, " "))
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if temporary && !authFailed {
+			return retry.Retryable(err)
+		}
+		return registryCommandError(image, err, authFailed)
+	}
+	return nil
 }
@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Remote runs docker commands on another Docker host, like a GPU machine reached over SSH, with `docker --host`
+type Remote struct {
+	// Host is the Docker host, like ssh://user@gpu-box or tcp://gpu-box:2376
+	Host string
+}
+
+func (r Remote) args(args ...string) []string {
+	return append([]string{"--host", r.Host}, args...)
+}
+
+// LoadArgs returns the arguments to the two `docker` commands Load pipes together
+func (r Remote) LoadArgs(image string) (save []string, load []string) {
+	return []string{"save", image}, r.args("load")
+}
+
+// Load copies an image from the local Docker to the remote host over the connection to it, like
+// `docker save image | docker --host host load`, so it doesn't need a registry
+func (r Remote) Load(ctx context.Context, image string) error {
+	reader, writer := io.Pipe()
+	saveArgs, loadArgs := r.LoadArgs(image)
+	save := command(ctx, saveArgs...)
+	save.Stdout = writer
+	save.Stderr = console.Writer()
+	load := command(ctx, loadArgs...)
+	load.Stdin = reader
+	load.Stdout = console.Writer()
+	load.Stderr = console.Writer()
+
+	console.Debug("$ " + strings.Join(save.Args, " ") + " | " + strings.Join(load.Args, " "))
+	if err := load.Start(); err != nil {
+		return err
+	}
+	saveErr := save.Run()
+	// Closing the pipe with save's error stops load, rather than it loading part of the image
+	_ = writer.CloseWithError(saveErr)
+	loadErr := load.Wait()
+	if saveErr != nil {
+		return fmt.Errorf("Failed to export %s: %w", image, contextError(ctx, saveErr))
+	}
+	if loadErr != nil {
+		return fmt.Errorf("Failed to load %s on %s: %w", image, r.Host, contextError(ctx, loadErr))
+	}
+	return nil
+}
+
+// Pull pulls an image on the remote host from its registry
+func (r Remote) Pull(ctx context.Context, image string) error {
+	cmd := command(ctx, r.PullArgs(image)...)
+	cmd.Stdout = console.Writer()
+	cmd.Stderr = console.Writer()
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Failed to pull %s on %s: %w", image, r.Host, contextError(ctx, err))
+	}
+	return nil
+}
+
+// PullArgs returns the arguments to `docker` that Pull runs
+func (r Remote) PullArgs(image string) []string {
+	return r.args("pull", image)
+}
+
+// ReplaceArgs returns the arguments to the `docker` commands Replace runs, to remove the old container and start the
+// new one
+func (r Remote) ReplaceArgs(options RunOptions) (rm []string, run []string) {
+	return r.args("rm", "--force", options.Name), r.args(generateDockerArgs(internalRunOptions{RunOptions: options, Detach: true})...)
+}
+
+// Replace starts a container on the remote host in the background, in place of the container with the same name if
+// there is one, and returns its ID. options.Name must be set.
+func (r Remote) Replace(ctx context.Context, options RunOptions) (string, error) {
+	if options.Name == "" {
+		return "", fmt.Errorf("The container must have a name so it can be replaced")
+	}
+	rmArgs, runArgs := r.ReplaceArgs(options)
+	rm := command(ctx, rmArgs...)
+	console.Debug("$ " + strings.Join(rm.Args, " "))
+	if out, err := rm.CombinedOutput(); err != nil && !strings.Contains(string(out), "No such container") {
+		return "", fmt.Errorf("Failed to remove container %s on %s: %w\n%s", options.Name, r.Host, contextError(ctx, err), out)
+	}
+
+	cmd := command(ctx, runArgs...)
+	cmd.Env = generateEnv(internalRunOptions{RunOptions: options})
+	stderr := new(strings.Builder)
+	cmd.Stderr = io.MultiWriter(console.Writer(), stderr)
+	console.Debug("$ " + strings.Join(cmd.Args, " "))
+	containerID, err := cmd.Output()
+	if strings.Contains(stderr.String(), "could not select device driver") || strings.Contains(stderr.String(), "nvidia-container-cli: initialization error") {
+		return "", ErrMissingDeviceDriver
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to start container %s on %s: %w", options.Name, r.Host, contextError(ctx, err))
+	}
+	return strings.TrimSpace(string(containerID)), nil
+}
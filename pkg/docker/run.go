@@ -3,18 +3,21 @@ package docker
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
-	"os/exec"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/mattn/go-isatty"
 
+	"github.com/replicate/cog/pkg/config"
+	cogerrors "github.com/replicate/cog/pkg/errors"
 	"github.com/replicate/cog/pkg/util"
 	"github.com/replicate/cog/pkg/util/console"
 )
@@ -27,8 +30,49 @@ type Port struct {
 type Volume struct {
 	Source      string
 	Destination string
+	ReadOnly    bool
 }
 
+// Tmpfs is a directory in memory, mounted in a container
+type Tmpfs struct {
+	Destination string
+	// Size is the most it can hold in bytes, or 0 for Docker's default of half of the machine's memory
+	Size int64
+}
+
+// TmpfsMounts returns the tmpfs mounts in cog.yaml's resources
+func TmpfsMounts(resources *config.Resources) []Tmpfs {
+	if resources == nil {
+		return nil
+	}
+	mounts := []Tmpfs{}
+	for _, tmpfs := range resources.Tmpfs {
+		mounts = append(mounts, Tmpfs{Destination: tmpfs.Path, Size: tmpfs.SizeBytes()})
+	}
+	return mounts
+}
+
+// Device is a device on the host, passed through to a container
+type Device struct {
+	HostPath      string
+	ContainerPath string
+	// Permissions are any of r, w and m, like `docker run --device`
+	Permissions string
+}
+
+// Devices returns the devices in cog.yaml
+func Devices(cfg *config.Config) []Device {
+	devices := []Device{}
+	for _, device := range cfg.DeviceMounts() {
+		devices = append(devices, Device(device))
+	}
+	return devices
+}
+
+// DefaultShmSize is the size of /dev/shm in containers that don't set one. Docker's default of 64MB is too small for
+// PyTorch.
+const DefaultShmSize = "6G"
+
 type RunOptions struct {
 	Args     []string
 	Env      []string
@@ -38,6 +82,23 @@ type RunOptions struct {
 	Volumes  []Volume
 	Workdir  string
 	Platform string
+	CPUs     string
+	Memory   int64
+	Labels   map[string]string
+	Name     string
+	EnvFiles []string
+	// SecretEnv are environment variables in the form name=value that are passed to the container without
+	// their values appearing in docker's arguments
+	SecretEnv []string
+	// ReadOnly makes the container's root filesystem read-only. Its volumes can still be written to.
+	ReadOnly bool
+	// ShmSize is the size of /dev/shm in bytes, or 0 for DefaultShmSize
+	ShmSize int64
+	Tmpfs   []Tmpfs
+	Devices []Device
+	// RestartPolicy is when Docker restarts the container, like "unless-stopped", or "" for never. Containers with a
+	// restart policy aren't removed when they stop, so Docker can restart them.
+	RestartPolicy string
 }
 
 // used for generating arguments, with a few options not exposed by public API
@@ -48,31 +109,68 @@ type internalRunOptions struct {
 	TTY         bool
 }
 
-var ErrMissingDeviceDriver = errors.New("Docker is missing required device driver")
+// ErrMissingDeviceDriver is returned when Docker can't give a container the GPUs it asked for
+var ErrMissingDeviceDriver error = &cogerrors.GPUUnavailableError{Err: errors.New("Docker is missing required device driver")}
 
 func generateDockerArgs(options internalRunOptions) []string {
+	// https://github.com/pytorch/pytorch/issues/2244
+	// https://github.com/replicate/cog/issues/1293
+	shmSize := DefaultShmSize
+	if options.ShmSize > 0 {
+		shmSize = strconv.FormatInt(options.ShmSize, 10)
+	}
 	// Use verbose options for clarity
-	dockerArgs := []string{
-		"run",
-		"--rm",
-		"--shm-size", "6G",
-		// https://github.com/pytorch/pytorch/issues/2244
-		// https://github.com/replicate/cog/issues/1293
-		// TODO: relative to pwd and cog.yaml
+	dockerArgs := []string{"run"}
+	if options.RestartPolicy != "" {
+		dockerArgs = append(dockerArgs, "--restart", options.RestartPolicy)
+	} else {
+		dockerArgs = append(dockerArgs, "--rm")
 	}
+	dockerArgs = append(dockerArgs, "--shm-size", shmSize)
 
 	if options.Detach {
 		dockerArgs = append(dockerArgs, "--detach")
 	}
+	if options.Name != "" {
+		dockerArgs = append(dockerArgs, "--name", options.Name)
+	}
+	for _, envFile := range options.EnvFiles {
+		dockerArgs = append(dockerArgs, "--env-file", envFile)
+	}
 	for _, env := range options.Env {
 		dockerArgs = append(dockerArgs, "--env", env)
 	}
+	for _, env := range options.SecretEnv {
+		// docker reads the value from its own environment, which generateEnv sets
+		name, _, _ := strings.Cut(env, "=")
+		dockerArgs = append(dockerArgs, "--env", name)
+	}
 	if options.GPUs != "" {
 		dockerArgs = append(dockerArgs, "--gpus", options.GPUs)
 	}
+	for _, device := range options.Devices {
+		dockerArgs = append(dockerArgs, "--device", device.HostPath+":"+device.ContainerPath+":"+device.Permissions)
+	}
+	if options.CPUs != "" {
+		dockerArgs = append(dockerArgs, "--cpus", options.CPUs)
+	}
+	if options.Memory > 0 {
+		dockerArgs = append(dockerArgs, "--memory", strconv.FormatInt(options.Memory, 10))
+	}
+	if options.ReadOnly {
+		dockerArgs = append(dockerArgs, "--read-only")
+	}
 	if options.Interactive {
 		dockerArgs = append(dockerArgs, "--interactive")
 	}
+	labelKeys := make([]string, 0, len(options.Labels))
+	for key := range options.Labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		dockerArgs = append(dockerArgs, "--label", key+"="+options.Labels[key])
+	}
 	for _, port := range options.Ports {
 		dockerArgs = append(dockerArgs, "--publish", fmt.Sprintf("%d:%d", port.HostPort, port.ContainerPort))
 	}
@@ -82,7 +180,18 @@ func generateDockerArgs(options internalRunOptions) []string {
 	for _, volume := range options.Volumes {
 		// This needs escaping if we want to support commas in filenames
 		// https://github.com/moby/moby/issues/8604
-		dockerArgs = append(dockerArgs, "--mount", "type=bind,source="+volume.Source+",destination="+volume.Destination)
+		mount := "type=bind,source=" + volume.Source + ",destination=" + volume.Destination
+		if volume.ReadOnly {
+			mount += ",readonly"
+		}
+		dockerArgs = append(dockerArgs, "--mount", mount)
+	}
+	for _, tmpfs := range options.Tmpfs {
+		mount := "type=tmpfs,destination=" + tmpfs.Destination
+		if tmpfs.Size > 0 {
+			mount += ",tmpfs-size=" + strconv.FormatInt(tmpfs.Size, 10)
+		}
+		dockerArgs = append(dockerArgs, "--mount", mount)
 	}
 	if options.Workdir != "" {
 		dockerArgs = append(dockerArgs, "--workdir", options.Workdir)
@@ -95,21 +204,27 @@ func generateDockerArgs(options internalRunOptions) []string {
 	return dockerArgs
 }
 
+// RunArgs returns the arguments to `docker` that Run would use for options
+func RunArgs(options RunOptions) []string {
+	return generateDockerArgs(internalRunOptions{RunOptions: options})
+}
+
 func generateEnv(options internalRunOptions) []string {
 	env := os.Environ()
 	if util.IsAppleSiliconMac(runtime.GOOS, runtime.GOARCH) {
 		// Fixes "WARNING: The requested image's platform (linux/amd64) does not match the detected host platform (linux/arm64/v8) and no specific platform was requested"
 		env = append(env, "DOCKER_DEFAULT_PLATFORM=linux/amd64")
 	}
+	env = append(env, options.SecretEnv...)
 
 	return env
 }
 
-func Run(options RunOptions) error {
-	return RunWithIO(options, os.Stdin, os.Stdout, os.Stderr)
+func Run(ctx context.Context, options RunOptions) error {
+	return RunWithIO(ctx, options, os.Stdin, os.Stdout, os.Stderr)
 }
 
-func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
+func RunWithIO(ctx context.Context, options RunOptions, stdin io.Reader, stdout, stderr io.Writer) error {
 	internalOptions := internalRunOptions{RunOptions: options}
 	if stdin != nil {
 		internalOptions.Interactive = true
@@ -121,7 +236,7 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 	stderrMultiWriter := io.MultiWriter(stderr, stderrCopy)
 
 	dockerArgs := generateDockerArgs(internalOptions)
-	cmd := exec.Command("docker", dockerArgs...)
+	cmd := command(ctx, dockerArgs...)
 	cmd.Env = generateEnv(internalOptions)
 	cmd.Stdout = stdout
 	cmd.Stdin = stdin
@@ -134,12 +249,12 @@ func RunWithIO(options RunOptions, stdin io.Reader, stdout, stderr io.Writer) er
 		if strings.Contains(stderrString, "could not select device driver") || strings.Contains(stderrString, "nvidia-container-cli: initialization error") {
 			return ErrMissingDeviceDriver
 		}
-		return err
+		return contextError(ctx, err)
 	}
 	return nil
 }
 
-func RunDaemon(options RunOptions, stderr io.Writer) (string, error) {
+func RunDaemon(ctx context.Context, options RunOptions, stderr io.Writer) (string, error) {
 	internalOptions := internalRunOptions{RunOptions: options}
 	internalOptions.Detach = true
 
@@ -147,7 +262,7 @@ func RunDaemon(options RunOptions, stderr io.Writer) (string, error) {
 	stderrMultiWriter := io.MultiWriter(stderr, stderrCopy)
 
 	dockerArgs := generateDockerArgs(internalOptions)
-	cmd := exec.Command("docker", dockerArgs...)
+	cmd := command(ctx, dockerArgs...)
 	cmd.Env = generateEnv(internalOptions)
 	cmd.Stderr = stderrMultiWriter
 
@@ -161,20 +276,20 @@ func RunDaemon(options RunOptions, stderr io.Writer) (string, error) {
 	}
 
 	if err != nil {
-		return "", err
+		return "", contextError(ctx, err)
 	}
 
 	return strings.TrimSpace(string(containerID)), nil
 }
 
-func GetPort(containerID string, containerPort int) (int, error) {
-	cmd := exec.Command("docker", "port", containerID, fmt.Sprintf("%d", containerPort)) //#nosec G204
+func GetPort(ctx context.Context, containerID string, containerPort int) (int, error) {
+	cmd := command(ctx, "port", containerID, fmt.Sprintf("%d", containerPort))
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 
 	output, err := cmd.Output()
 	if err != nil {
-		return 0, err
+		return 0, contextError(ctx, err)
 	}
 
 	lines := []string{}
@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunArgs(t *testing.T) {
+	args := RunArgs(RunOptions{Image: "my-model"})
+	require.Equal(t, []string{"run", "--rm", "--shm-size", DefaultShmSize, "my-model"}, args)
+
+	args = RunArgs(RunOptions{
+		Image:    "my-model",
+		ShmSize:  16_000_000_000,
+		Tmpfs:    []Tmpfs{{Destination: "/scratch", Size: 8_000_000_000}, {Destination: "/cache"}},
+		ReadOnly: true,
+		Devices:  []Device{{HostPath: "/dev/video2", ContainerPath: "/dev/video0", Permissions: "r"}},
+		Volumes:  []Volume{{Source: "/mnt/datasets", Destination: "/data", ReadOnly: true}},
+	})
+	require.Equal(t, []string{
+		"run", "--rm", "--shm-size", "16000000000",
+		"--device", "/dev/video2:/dev/video0:r",
+		"--read-only",
+		"--mount", "type=bind,source=/mnt/datasets,destination=/data,readonly",
+		"--mount", "type=tmpfs,destination=/scratch,tmpfs-size=8000000000",
+		"--mount", "type=tmpfs,destination=/cache",
+		"my-model",
+	}, args)
+
+	args = RunArgs(RunOptions{Image: "my-model", RestartPolicy: "unless-stopped"})
+	require.Equal(t, []string{"run", "--restart", "unless-stopped", "--shm-size", DefaultShmSize, "my-model"}, args)
+}
+
+func TestRemoteArgs(t *testing.T) {
+	remote := Remote{Host: "ssh://ubuntu@gpu-box"}
+	save, load := remote.LoadArgs("my-model")
+	require.Equal(t, []string{"save", "my-model"}, save)
+	require.Equal(t, []string{"--host", "ssh://ubuntu@gpu-box", "load"}, load)
+	require.Equal(t, []string{"--host", "ssh://ubuntu@gpu-box", "pull", "my-model"}, remote.PullArgs("my-model"))
+
+	rm, run := remote.ReplaceArgs(RunOptions{Image: "my-model", Name: "my-model", RestartPolicy: "unless-stopped"})
+	require.Equal(t, []string{"--host", "ssh://ubuntu@gpu-box", "rm", "--force", "my-model"}, rm)
+	require.Equal(t, []string{"--host", "ssh://ubuntu@gpu-box", "run", "--restart", "unless-stopped", "--shm-size", DefaultShmSize, "--detach", "--name", "my-model", "my-model"}, run)
+}
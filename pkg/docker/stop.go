@@ -1,15 +1,15 @@
 package docker
 
 import (
+	"context"
 	"os"
-	"os/exec"
 )
 
-func Stop(id string) error {
-	cmd := exec.Command("docker", "container", "stop", "--time", "3", id)
+func Stop(ctx context.Context, id string) error {
+	cmd := command(ctx, "container", "stop", "--time", "3", id)
 	cmd.Env = os.Environ()
 	cmd.Stderr = os.Stderr
 
 	_, err := cmd.Output()
-	return err
+	return contextError(ctx, err)
 }
@@ -0,0 +1,23 @@
+package dockerfile
+
+import (
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// buildArgs returns the ARG instructions for build.args, with their values in cog.yaml as defaults, or "" if there
+// aren't any. ARGs are scoped to a stage, so they go after its FROM. RUN steps get them as environment variables, and
+// `cog build --build-arg` overrides them.
+func buildArgs(cfg *config.Config) string {
+	lines := []string{}
+	for _, name := range cfg.BuildArgNames() {
+		lines = append(lines, "ARG "+name+"="+quoteBuildArg(cfg.Build.Args[name]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// quoteBuildArg quotes the default value of an ARG, so it can contain spaces
+func quoteBuildArg(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,40 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateWithBuildArgs(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  args:
+    PIP_INDEX_URL: https://pypi.org/simple
+    GREETING: say "hello world"
+  run:
+    - echo "$GREETING"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `FROM python:3.12-slim
+ARG GREETING="say \"hello world\""
+ARG PIP_INDEX_URL="https://pypi.org/simple"
+ENV DEBIAN_FRONTEND=noninteractive`)
+}
+
+func TestGenerateWithoutBuildArgs(t *testing.T) {
+	require.Equal(t, "", buildArgs(&config.Config{Build: &config.Build{}}))
+}
@@ -2,12 +2,12 @@ package dockerfile
 
 import (
 	"os"
-	"path"
+	"path/filepath"
 	"time"
 )
 
 func BuildCogTempDir(dir string) (string, error) {
-	rootTmp := path.Join(dir, ".cog/tmp")
+	rootTmp := filepath.Join(dir, ".cog", "tmp")
 	if err := os.MkdirAll(rootTmp, 0o755); err != nil {
 		return "", err
 	}
@@ -0,0 +1,15 @@
+package dockerfile
+
+import "github.com/replicate/cog/pkg/config"
+
+// CheckImportsCommand imports the modules of the predictors in cog.yaml, without running their setup()
+const CheckImportsCommand = "RUN python -m cog.command.check_imports"
+
+// checkImports returns the step that checks the model's code can be imported, if build.check_imports is set. It
+// goes after the code is copied into the image.
+func checkImports(cfg *config.Config) string {
+	if !cfg.Build.CheckImports {
+		return ""
+	}
+	return CheckImportsCommand
+}
@@ -1,6 +1,26 @@
 package dockerfile
 
-import "embed"
+import (
+	"embed"
+	"fmt"
+)
 
 //go:embed embed/*.whl
 var CogEmbed embed.FS
+
+// cogWheel returns the filename and contents of the Cog wheel that's embedded in the CLI
+func cogWheel() (string, []byte, error) {
+	files, err := CogEmbed.ReadDir("embed")
+	if err != nil {
+		return "", nil, err
+	}
+	if len(files) != 1 {
+		return "", nil, fmt.Errorf("should only have one cog wheel embedded")
+	}
+	filename := files[0].Name()
+	data, err := CogEmbed.ReadFile("embed/" + filename)
+	if err != nil {
+		return "", nil, err
+	}
+	return filename, data, nil
+}
@@ -0,0 +1,39 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateWithDockerfileSnippets(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  run:
+    - echo hello
+  dockerfile_pre: |
+    ENV PIP_INDEX_URL=https://mirror.example.com/simple
+  dockerfile_post: |
+    RUN echo goodbye
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV NVIDIA_DRIVER_CAPABILITIES=all
+ENV PIP_INDEX_URL=https://mirror.example.com/simple
+RUN --mount=type=cache,target=/var/cache/apt,sharing=locked set -eux;`)
+	require.Contains(t, actual, `RUN echo hello
+RUN echo goodbye
+WORKDIR /src`)
+}
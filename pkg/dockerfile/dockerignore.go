@@ -0,0 +1,147 @@
+package dockerfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// dockerignorePattern is a line of .dockerignore
+type dockerignorePattern struct {
+	pattern *regexp.Regexp
+	// exception is whether the pattern starts with "!", so it includes what earlier patterns exclude
+	exception bool
+}
+
+// Dockerignore is the patterns in a .dockerignore
+type Dockerignore []dockerignorePattern
+
+// ParseDockerignore returns the patterns in a .dockerignore
+func ParseDockerignore(contents string) Dockerignore {
+	patterns := Dockerignore{}
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		exception := false
+		if rest, ok := strings.CutPrefix(line, "!"); ok {
+			exception = true
+			line = strings.TrimSpace(rest)
+		}
+		line = strings.Trim(filepath.ToSlash(filepath.Clean(line)), "/")
+		if line == "" || line == "." {
+			continue
+		}
+		patterns = append(patterns, dockerignorePattern{pattern: globPattern(line), exception: exception})
+	}
+	return patterns
+}
+
+// Excludes returns whether a file, relative to the build context, is excluded by the .dockerignore, either itself
+// or by a directory it's in
+func (d Dockerignore) Excludes(path string) bool {
+	excluded := false
+	for _, p := range d {
+		if p.matches(path) {
+			excluded = !p.exception
+		}
+	}
+	return excluded
+}
+
+// ExcludesDir returns whether a directory is excluded, and nothing in it is included again by an exception
+func (d Dockerignore) ExcludesDir(path string) bool {
+	if !d.Excludes(path) {
+		return false
+	}
+	for _, p := range d {
+		if p.exception {
+			return false
+		}
+	}
+	return true
+}
+
+// matches returns whether a path, or a directory it's in, matches the pattern
+func (p dockerignorePattern) matches(path string) bool {
+	for {
+		if p.pattern.MatchString(path) {
+			return true
+		}
+		i := strings.LastIndex(path, "/")
+		if i < 0 {
+			return false
+		}
+		path = path[:i]
+	}
+}
+
+// globPattern returns a regular expression that matches the paths a .dockerignore pattern matches
+func globPattern(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// WalkBuildContext calls fn for each regular file in the project in dir that's sent to Docker when the model is
+// built, in lexical order, with its path relative to dir with forward slashes. It skips the files that the
+// .dockerignore excludes, and .git and .cog. It returns whether there's a .dockerignore.
+func WalkBuildContext(dir string, fn func(rel string, info fs.FileInfo) error) (bool, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, ".dockerignore"))
+	hasDockerignore := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, fmt.Errorf("Failed to read .dockerignore: %w", err)
+	}
+	ignore := ParseDockerignore(string(contents))
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			return nil
+		}
+		if d.IsDir() {
+			if rel == ".git" || rel == ".cog" || ignore.ExcludesDir(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || ignore.Excludes(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(rel, info)
+	})
+	return hasDockerignore, err
+}
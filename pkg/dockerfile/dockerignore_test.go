@@ -0,0 +1,39 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDockerignore(t *testing.T) {
+	ignore := ParseDockerignore(`# comment
+**/.git
+/venv
+*.ckpt
+weights/
+!weights/config.json
+data/**/*.bin
+`)
+	for _, tt := range []struct {
+		path     string
+		excluded bool
+	}{
+		{"predict.py", false},
+		{".git/HEAD", true},
+		{"sub/.git/HEAD", true},
+		{"venv/lib/site.py", true},
+		{"sub/venv/lib/site.py", false},
+		{"model.ckpt", true},
+		{"sub/model.ckpt", false},
+		{"weights/model.safetensors", true},
+		{"weights/config.json", false},
+		{"data/a/b/x.bin", true},
+		{"data/x.bin", true},
+		{"data/x.txt", false},
+	} {
+		require.Equal(t, tt.excluded, ignore.Excludes(tt.path), tt.path)
+	}
+	require.True(t, ParseDockerignore("venv\n").ExcludesDir("venv"))
+	require.False(t, ignore.ExcludesDir("weights"))
+}
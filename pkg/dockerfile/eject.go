@@ -0,0 +1,143 @@
+package dockerfile
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CogPackageDir is the directory in the eject directory the Cog Python package's sources are written to
+const CogPackageDir = "cog"
+
+// writeCogPackage writes the Cog Python package for the image to install, and returns the lines to add to the
+// Dockerfile to copy it into the image and the path it ends up at, which pip can install. It's the wheel embedded in
+// the CLI, unless the generator is ejecting, when it's the wheel's sources, which can be edited.
+func (g *StandardGenerator) writeCogPackage() ([]string, string, error) {
+	filename, data, err := cogWheel()
+	if err != nil {
+		return nil, "", err
+	}
+	if g.ejectDir == "" {
+		return g.writeTemp(filename, data)
+	}
+	dir, relativeDir := g.filesDir()
+	if err := UnpackCogWheel(data, filepath.Join(dir, CogPackageDir)); err != nil {
+		return nil, "", err
+	}
+	return []string{fmt.Sprintf("COPY %s /tmp/%s", path.Join(relativeDir, CogPackageDir), CogPackageDir)}, "/tmp/" + CogPackageDir, nil
+}
+
+// UnpackCogWheel unpacks the Cog wheel into a directory as a project pip can install, with the package's sources and
+// a pyproject.toml that has the wheel's version and dependencies. Whatever was in the directory is replaced.
+func UnpackCogWheel(wheel []byte, dir string) error {
+	r, err := zip.NewReader(bytes.NewReader(wheel), int64(len(wheel)))
+	if err != nil {
+		return fmt.Errorf("Failed to read the Cog wheel: %w", err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("Failed to remove %s: %w", dir, err)
+	}
+	var metadata []byte
+	for _, f := range r.File {
+		top, _, _ := strings.Cut(f.Name, "/")
+		if strings.HasSuffix(top, ".dist-info") {
+			if path.Base(f.Name) == "METADATA" {
+				if metadata, err = readZipFile(f); err != nil {
+					return fmt.Errorf("Failed to read the Cog wheel's metadata: %w", err)
+				}
+			}
+			continue
+		}
+		if strings.HasSuffix(top, ".data") || f.FileInfo().IsDir() {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(f.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(filepath.Separator)) {
+			return fmt.Errorf("The Cog wheel has a file outside it, %s", f.Name)
+		}
+		contents, err := readZipFile(f)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s from the Cog wheel: %w", f.Name, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(target, contents, 0o644); err != nil {
+			return fmt.Errorf("Failed to write %s: %w", target, err)
+		}
+	}
+	if metadata == nil {
+		return fmt.Errorf("The Cog wheel hasn't got a METADATA file")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pyproject.toml"), pyproject(metadata), 0o644); err != nil {
+		return fmt.Errorf("Failed to write pyproject.toml: %w", err)
+	}
+	return nil
+}
+
+// pyproject returns a pyproject.toml for the Cog package, from its wheel's METADATA, which has the package's
+// version, the versions of Python it supports, and its dependencies, leaving out the optional ones
+func pyproject(metadata []byte) []byte {
+	version := ""
+	requiresPython := ""
+	dependencies := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(metadata))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			// The headers end at the first blank line, and the description follows
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Version":
+			version = value
+		case "Requires-Python":
+			requiresPython = value
+		case "Requires-Dist":
+			if !strings.Contains(value, "extra ==") {
+				dependencies = append(dependencies, value)
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("# The Cog Python package, unpacked from its wheel by cog eject\n")
+	b.WriteString("[build-system]\n")
+	b.WriteString("requires = [\"setuptools\"]\n")
+	b.WriteString("build-backend = \"setuptools.build_meta\"\n\n")
+	b.WriteString("[project]\n")
+	b.WriteString("name = \"cog\"\n")
+	b.WriteString("version = " + strconv.Quote(version) + "\n")
+	if requiresPython != "" {
+		b.WriteString("requires-python = " + strconv.Quote(requiresPython) + "\n")
+	}
+	b.WriteString("dependencies = [\n")
+	for _, dependency := range dependencies {
+		b.WriteString("  " + strconv.Quote(dependency) + ",\n")
+	}
+	b.WriteString("]\n\n")
+	b.WriteString("[tool.setuptools.packages.find]\n")
+	b.WriteString("include = [\"cog*\"]\n")
+	return []byte(b.String())
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
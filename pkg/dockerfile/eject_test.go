@@ -0,0 +1,98 @@
+package dockerfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+const testWheelMetadata = `Metadata-Version: 2.1
+Name: cog
+Version: 0.9.20
+Requires-Python: >=3.8
+Requires-Dist: attrs<24,>=20.1
+Requires-Dist: uvicorn[standard]<1,>=0.12
+Provides-Extra: tests
+Requires-Dist: pytest; extra == "tests"
+
+# Cog: Containers for machine learning
+Requires-Dist: not-a-header
+`
+
+func TestUnpackCogWheel(t *testing.T) {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	for name, contents := range map[string]string{
+		"cog/__init__.py":               "from .predictor import BasePredictor\n",
+		"cog/server/http.py":            "import uvicorn\n",
+		"cog-0.9.20.dist-info/METADATA": testWheelMetadata,
+		"cog-0.9.20.dist-info/RECORD":   "",
+	} {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	dir := filepath.Join(t.TempDir(), "cog")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "stale.py"), []byte(""), 0o644))
+	require.NoError(t, UnpackCogWheel(b.Bytes(), dir))
+
+	require.FileExists(t, filepath.Join(dir, "cog", "__init__.py"))
+	require.FileExists(t, filepath.Join(dir, "cog", "server", "http.py"))
+	require.NoFileExists(t, filepath.Join(dir, "stale.py"))
+	require.NoDirExists(t, filepath.Join(dir, "cog-0.9.20.dist-info"))
+	pyproject, err := os.ReadFile(filepath.Join(dir, "pyproject.toml"))
+	require.NoError(t, err)
+	require.Equal(t, `# The Cog Python package, unpacked from its wheel by cog eject
+[build-system]
+requires = ["setuptools"]
+build-backend = "setuptools.build_meta"
+
+[project]
+name = "cog"
+version = "0.9.20"
+requires-python = ">=3.8"
+dependencies = [
+  "attrs<24,>=20.1",
+  "uvicorn[standard]<1,>=0.12",
+]
+
+[tool.setuptools.packages.find]
+include = ["cog*"]
+`, string(pyproject))
+
+	require.ErrorContains(t, UnpackCogWheel([]byte("not a wheel"), dir), "Failed to read the Cog wheel")
+}
+
+func TestEjectRequirements(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  python_packages:
+    - pandas==2.2.2
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetEjectDir("docker")
+	lines, err := gen.pipInstalls()
+	require.NoError(t, err)
+	require.Contains(t, lines, "COPY docker/requirements.txt /tmp/requirements.txt\n")
+	require.FileExists(t, filepath.Join(tmpDir, "docker", "requirements.txt"))
+
+	require.NoError(t, gen.Cleanup())
+	require.FileExists(t, filepath.Join(tmpDir, "docker", "requirements.txt"))
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
@@ -77,11 +78,30 @@ func (g *FastGenerator) SetUseCogBaseImagePtr(useCogBaseImage *bool) {
 func (g *FastGenerator) SetUseCudaBaseImage(argumentValue string) {
 }
 
+func (g *FastGenerator) SetBaseImageDigests(digests map[string]string) {
+}
+
 func (g *FastGenerator) Name() string {
 	return FAST_GENERATOR_NAME
 }
 
 func (g *FastGenerator) generate() (string, error) {
+	if notebook, _ := g.Config.PredictNotebook(); notebook != "" {
+		return "", errors.New("Notebook predictors not supported in FastGenerator")
+	}
+	if g.Config.Build.RVersion != "" {
+		return "", errors.New("R not supported in FastGenerator")
+	}
+	if g.Config.Build.JuliaVersion != "" {
+		return "", errors.New("Julia not supported in FastGenerator")
+	}
+	if g.Config.Build.Dockerfile != "" {
+		return "", errors.New("build.dockerfile not supported in FastGenerator")
+	}
+	if g.Config.Build.Target != "" {
+		return "", errors.New("build.target not supported in FastGenerator")
+	}
+
 	tmpDir, err := BuildCogTempDir(g.Dir)
 	if err != nil {
 		return "", err
@@ -108,6 +128,8 @@ func (g *FastGenerator) generate() (string, error) {
 		return "", err
 	}
 
+	lines = appendSnippet(lines, g.Config.Build.DockerfilePost)
+
 	lines, err = g.entrypoint(lines)
 	if err != nil {
 		return "", err
@@ -117,15 +139,7 @@ func (g *FastGenerator) generate() (string, error) {
 }
 
 func (g *FastGenerator) copyCog(tmpDir string) (string, error) {
-	files, err := CogEmbed.ReadDir("embed")
-	if err != nil {
-		return "", err
-	}
-	if len(files) != 1 {
-		return "", fmt.Errorf("should only have one cog wheel embedded")
-	}
-	filename := files[0].Name()
-	data, err := CogEmbed.ReadFile("embed/" + filename)
+	filename, data, err := cogWheel()
 	if err != nil {
 		return "", err
 	}
@@ -144,6 +158,8 @@ func (g *FastGenerator) generateMonobase(lines []string, tmpDir string) ([]strin
 		"# syntax=docker/dockerfile:1-labs",
 		"FROM r8.im/monobase:latest",
 	}...)
+	lines = appendSnippet(lines, buildArgs(g.Config))
+	lines = appendSnippet(lines, g.Config.Build.DockerfilePre)
 
 	cogPath, err := g.copyCog(tmpDir)
 	if err != nil {
@@ -197,7 +213,7 @@ func (g *FastGenerator) copyWeights(lines []string, weights []Weight) ([]string,
 	}
 
 	for _, weight := range weights {
-		lines = append(lines, "COPY --link \""+weight.Path+"\" \""+filepath.Join(FUSE_RPC_WEIGHTS_PATH, weight.Digest)+"\"")
+		lines = append(lines, "COPY --link \""+weight.Path+"\" \""+path.Join(FUSE_RPC_WEIGHTS_PATH, weight.Digest)+"\"")
 	}
 
 	return lines, nil
@@ -205,7 +221,7 @@ func (g *FastGenerator) copyWeights(lines []string, weights []Weight) ([]string,
 
 func (g *FastGenerator) install(lines []string, weights []Weight, tmpDir string) ([]string, error) {
 	// Install apt packages
-	packages := g.Config.Build.SystemPackages
+	packages := g.Config.SystemPackages()
 	if len(packages) > 0 {
 		lines = append(lines, "RUN "+APT_CACHE_MOUNT+" apt-get update && apt-get install -qqy "+strings.Join(packages, " ")+" && rm -rf /var/lib/apt/lists/*")
 	}
@@ -238,7 +254,7 @@ func (g *FastGenerator) install(lines []string, weights []Weight, tmpDir string)
 	if len(weights) > 0 {
 		linkCommands := []string{}
 		for _, weight := range weights {
-			linkCommands = append(linkCommands, "ln -s \""+filepath.Join(FUSE_RPC_WEIGHTS_PATH, weight.Digest)+"\" \"/src/"+weight.Path+"\"")
+			linkCommands = append(linkCommands, "ln -s \""+path.Join(FUSE_RPC_WEIGHTS_PATH, weight.Digest)+"\" \"/src/"+weight.Path+"\"")
 		}
 		lines = append(lines, "RUN "+strings.Join(linkCommands, " && "))
 	}
@@ -251,20 +267,28 @@ func (g *FastGenerator) pythonRequirements(tmpDir string) (string, error) {
 }
 
 func (g *FastGenerator) entrypoint(lines []string) ([]string, error) {
+	lines = appendSnippet(append(lines, "WORKDIR /src"), readOnlyRootFilesystem(g.Config))
 	return append(lines, []string{
-		"WORKDIR /src",
 		"ENV VERBOSE=0",
 		"ENTRYPOINT [\"/usr/bin/tini\", \"--\", \"/opt/r8/monobase/exec.sh\"]",
-		"CMD [\"python\", \"-m\", \"cog.server.http\"]",
+		serverCommand(g.Config),
 	}...), nil
 }
 
+// appendSnippet appends the lines of snippet, which can be "", to lines
+func appendSnippet(lines []string, snippet string) []string {
+	if snippet == "" {
+		return lines
+	}
+	return append(lines, strings.Split(strings.TrimSuffix(snippet, "\n"), "\n")...)
+}
+
 func (g *FastGenerator) buildTmpMount(tmpDir string) (string, error) {
 	relativeTmpDir, err := filepath.Rel(g.Dir, tmpDir)
 	if err != nil {
 		return "", err
 	}
-	return "--mount=type=bind,ro,source=\"" + relativeTmpDir + "\",target=\"/buildtmp\"", nil
+	return "--mount=type=bind,ro,source=\"" + filepath.ToSlash(relativeTmpDir) + "\",target=\"/buildtmp\"", nil
 }
 
 func (g *FastGenerator) monobaseUsercacheMount() string {
@@ -11,6 +11,7 @@ type Generator interface {
 	SetStrip(bool)
 	SetPrecompile(bool)
 	SetUseCudaBaseImage(string)
+	SetBaseImageDigests(map[string]string)
 	IsUsingCogBaseImage() bool
 	BaseImage() (string, error)
 	GenerateWeightsManifest() (*weights.Manifest, error)
@@ -0,0 +1,72 @@
+package dockerfile
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// JuliaServer is the server for Julia predictors, which serves Cog's HTTP API with HTTP.jl
+//
+//go:embed julia/server.jl
+var JuliaServer []byte
+
+// juliaServerPackages are the Julia packages the server for Julia predictors uses
+var juliaServerPackages = []string{"HTTP", "JSON3"}
+
+// juliaDepotPath is where Julia, and the packages installed in the image, go. It's set in $JULIA_DEPOT_PATH so they're
+// found whichever user the model runs as.
+const juliaDepotPath = "/opt/julia"
+
+// installJulia returns the steps that install the Julia version in build.julia_version, using juliaup, and the
+// packages in build.julia_packages, or "" if julia_version isn't set. If the predictor is a Julia function, it also
+// installs the server for it.
+func (g *StandardGenerator) installJulia() (string, error) {
+	version := g.Config.Build.JuliaVersion
+	if version == "" {
+		return "", nil
+	}
+	packages := g.Config.Build.JuliaPackages
+	script, _ := g.Config.PredictJulia()
+	if script != "" {
+		packages = slices.Concat(juliaServerPackages, packages)
+	}
+
+	lines := []string{
+		`RUN --mount=type=cache,target=/var/cache/apt,sharing=locked apt-get update -qq && apt-get install -qqy --no-install-recommends curl ca-certificates && rm -rf /var/lib/apt/lists/*`,
+		"ENV JULIA_DEPOT_PATH=" + juliaDepotPath,
+		`ENV PATH="` + juliaDepotPath + `/juliaup/bin:$PATH"`,
+		`RUN curl -fsSL https://install.julialang.org | sh -s -- --yes --path ` + juliaDepotPath + `/juliaup --default-channel ` + version,
+	}
+	if len(packages) > 0 {
+		specs := []string{}
+		for _, pkg := range packages {
+			name, pkgVersion, ok := strings.Cut(pkg, "@")
+			spec := "name=" + strconv.Quote(name)
+			if ok {
+				spec += ", version=" + strconv.Quote(pkgVersion)
+			}
+			specs = append(specs, "Pkg.PackageSpec("+spec+")")
+		}
+		lines = append(lines, `RUN julia -e 'using Pkg; Pkg.add([`+strings.Join(specs, ", ")+`]); Pkg.precompile()'`)
+	}
+	if script != "" {
+		dir, relativeDir := g.filesDir()
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("Failed to write server.jl: %w", err)
+		}
+		tmpPath := filepath.Join(dir, "server.jl")
+		if err := os.WriteFile(tmpPath, JuliaServer, 0o644); err != nil {
+			return "", fmt.Errorf("Failed to write server.jl: %w", err)
+		}
+		lines = append(lines, "COPY "+path.Join(relativeDir, "server.jl")+" "+config.JuliaServerPath)
+	}
+	return strings.Join(lines, "\n"), nil
+}
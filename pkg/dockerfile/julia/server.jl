@@ -0,0 +1,339 @@
+# Serves a Julia predictor with Cog's HTTP API, using HTTP.jl. Cog copies it
+# into the image of models whose `predict` in cog.yaml is a Julia function,
+# like "predict.jl:predict", and runs it with:
+#
+#     julia server.jl <script> <function>
+#
+# The inputs of the model are the arguments of the function, and their types
+# come from its signature. Arguments with defaults are optional. Files are
+# Cog.Path, which is passed to the function with the path to a temporary file,
+# and returned by it to output a file:
+#
+#     function predict(image::Cog.Path, top_k::Int = 5)::Vector{String}
+#
+# If the script defines a function called setup(), it's called once before
+# the server takes predictions, to load the model.
+
+using Base64
+using HTTP
+using JSON3
+
+module Cog
+
+"""
+A file. Inputs of this type are passed to the predictor with the path to a
+temporary file, and outputs are returned to the client as data URLs.
+"""
+struct Path
+    path::String
+end
+
+end
+
+if length(ARGS) != 2
+    error("Usage: julia server.jl <script> <function>")
+end
+const script, function_name = ARGS
+const port = parse(Int, get(ENV, "PORT", "5000"))
+
+# The script is loaded into a module of its own, where Cog.Path is available
+const Model = Core.eval(Main, :(module Model
+    import ..Cog
+end))
+Base.include(Model, abspath(script))
+
+isdefined(Model, Symbol(function_name)) ||
+    error("$script doesn't define a function called $function_name")
+const predict_function = getfield(Model, Symbol(function_name))
+
+# The schema of a type of input or output
+function schema_type(T)
+    if T === Union{} || T === Any
+        Dict{String,Any}()
+    elseif T <: Bool
+        Dict{String,Any}("type" => "boolean")
+    elseif T <: Integer
+        Dict{String,Any}("type" => "integer")
+    elseif T <: Real
+        Dict{String,Any}("type" => "number")
+    elseif T <: AbstractString
+        Dict{String,Any}("type" => "string")
+    elseif T <: Cog.Path
+        Dict{String,Any}("type" => "string", "format" => "uri")
+    elseif T <: AbstractVector
+        Dict{String,Any}("type" => "array", "items" => schema_type(eltype(T)))
+    else
+        Dict{String,Any}()
+    end
+end
+
+title(name) = join(uppercasefirst.(split(name, "_")), " ")
+
+struct Input
+    name::String
+    type::Type
+    required::Bool
+end
+
+# The model's inputs come from the method of the function with the most
+# arguments. Methods with fewer are the ones Julia defines for defaults.
+function read_inputs()
+    ms = collect(methods(predict_function))
+    isempty(ms) && error("$function_name has no methods")
+    m = ms[argmax([m.nargs for m in ms])]
+    required = minimum(m.nargs for m in ms) - 1
+    names = Base.method_argnames(m)[2:end]
+    # Type parameters, like T in x::T where T<:Real, are their upper bound
+    types = [t isa TypeVar ? t.ub : t for t in Base.unwrap_unionall(m.sig).parameters[2:end]]
+    [Input(string(names[i]), types[i], i <= required) for i in eachindex(names)]
+end
+
+const inputs = read_inputs()
+const output_type = let
+    types = Base.return_types(predict_function, Tuple{(input.type for input in inputs)...})
+    length(types) == 1 ? types[1] : Any
+end
+
+function openapi_schema()
+    properties = Dict{String,Any}()
+    for (i, input) in enumerate(inputs)
+        properties[input.name] = merge(
+            Dict{String,Any}("title" => title(input.name), "x-order" => i - 1),
+            schema_type(input.type),
+        )
+    end
+    input_schema = Dict{String,Any}("title" => "Input", "type" => "object", "properties" => properties)
+    required = [input.name for input in inputs if input.required]
+    if !isempty(required)
+        input_schema["required"] = required
+    end
+    json_content(schema) = Dict("application/json" => Dict("schema" => schema))
+    Dict(
+        "openapi" => "3.0.2",
+        "info" => Dict("title" => "Cog", "version" => "0.1.0"),
+        "paths" => Dict(
+            "/health-check" => Dict("get" => Dict(
+                "summary" => "Healthcheck",
+                "operationId" => "healthcheck_health_check_get",
+                "responses" => Dict("200" => Dict(
+                    "description" => "Successful Response",
+                    "content" => json_content(Dict("title" => "Response Healthcheck Health Check Get")),
+                )),
+            )),
+            "/predictions" => Dict("post" => Dict(
+                "summary" => "Predict",
+                "operationId" => "predict_predictions_post",
+                "requestBody" => Dict("content" => json_content(Dict("\$ref" => "#/components/schemas/PredictionRequest"))),
+                "responses" => Dict(
+                    "200" => Dict(
+                        "description" => "Successful Response",
+                        "content" => json_content(Dict("\$ref" => "#/components/schemas/PredictionResponse")),
+                    ),
+                    "422" => Dict("description" => "Validation Error"),
+                ),
+            )),
+        ),
+        "components" => Dict("schemas" => Dict(
+            "Input" => input_schema,
+            "Output" => merge(Dict{String,Any}("title" => "Output"), schema_type(output_type)),
+            "PredictionRequest" => Dict(
+                "title" => "PredictionRequest",
+                "type" => "object",
+                "properties" => Dict(
+                    "id" => Dict("title" => "Id", "type" => "string"),
+                    "input" => Dict("\$ref" => "#/components/schemas/Input"),
+                ),
+            ),
+            "PredictionResponse" => Dict(
+                "title" => "PredictionResponse",
+                "type" => "object",
+                "properties" => Dict(
+                    "id" => Dict("title" => "Id", "type" => "string"),
+                    "input" => Dict("\$ref" => "#/components/schemas/Input"),
+                    "output" => Dict("\$ref" => "#/components/schemas/Output"),
+                    "error" => Dict("title" => "Error", "type" => "string"),
+                    "status" => Dict("title" => "Status", "type" => "string"),
+                    "metrics" => Dict("title" => "Metrics", "type" => "object"),
+                ),
+            ),
+        )),
+    )
+end
+
+# Downloads a file input, which is a URL or a data URL, and returns its path
+function download_input(url::AbstractString)
+    path = tempname()
+    if startswith(url, "data:")
+        header, data = split(url, ","; limit = 2)
+        write(path, endswith(header, ";base64") ? base64decode(data) : HTTP.unescapeuri(data))
+    else
+        ext = splitext(first(split(url, r"[?#]")))[2]
+        path *= ext
+        write(path, HTTP.get(url).body)
+    end
+    Cog.Path(path)
+end
+
+const mime_types = Dict(
+    ".png" => "image/png",
+    ".jpg" => "image/jpeg",
+    ".jpeg" => "image/jpeg",
+    ".gif" => "image/gif",
+    ".webp" => "image/webp",
+    ".wav" => "audio/wav",
+    ".mp3" => "audio/mpeg",
+    ".mp4" => "video/mp4",
+    ".txt" => "text/plain",
+    ".json" => "application/json",
+    ".csv" => "text/csv",
+)
+
+# Returns outputs as they're sent to the client, with files as data URLs
+encode_output(output) = output
+encode_output(output::AbstractVector) = map(encode_output, output)
+function encode_output(output::Cog.Path)
+    mime = get(mime_types, lowercase(splitext(output.path)[2]), "application/octet-stream")
+    "data:$mime;base64," * base64encode(read(output.path))
+end
+
+struct ValidationError <: Exception
+    name::String
+    message::String
+end
+
+# Converts a value in the prediction's input to the type of the argument
+function convert_input(input::Input, value)
+    T = input.type
+    if T <: Bool
+        value isa Bool || throw(ValidationError(input.name, "value is not a valid boolean"))
+        value
+    elseif T <: Integer
+        (value isa Number && !(value isa Bool) && isinteger(value)) ||
+            throw(ValidationError(input.name, "value is not a valid integer"))
+        convert(T === Integer ? Int : T, value)
+    elseif T <: Real
+        (value isa Number && !(value isa Bool)) || throw(ValidationError(input.name, "value is not a valid number"))
+        convert(T === Real ? Float64 : T, value)
+    elseif T <: AbstractString
+        value isa AbstractString || throw(ValidationError(input.name, "value is not a valid string"))
+        String(value)
+    elseif T <: Cog.Path
+        value isa AbstractString || throw(ValidationError(input.name, "value is not a valid file URL"))
+        download_input(value)
+    elseif T <: AbstractVector
+        value isa AbstractVector || throw(ValidationError(input.name, "value is not a valid list"))
+        E = eltype(T)
+        [convert_input(Input(input.name, E, true), v) for v in value]
+    else
+        copy(value)
+    end
+end
+
+function validation_error(name, message)
+    Dict("loc" => ["body", "input", name], "msg" => message, "type" => "value_error")
+end
+
+# Returns the positional arguments of the predict function for the
+# prediction's input, or the validation errors
+function prediction_arguments(input)
+    errors = []
+    names = Set(input.name for input in inputs)
+    for key in keys(input)
+        string(key) in names || push!(errors, validation_error(string(key), "extra inputs are not permitted"))
+    end
+    arguments = []
+    missing_input = nothing
+    for input_type in inputs
+        key = Symbol(input_type.name)
+        if !haskey(input, key) || input[key] === nothing
+            if input_type.required
+                push!(errors, validation_error(input_type.name, "field required"))
+            elseif missing_input === nothing
+                missing_input = input_type.name
+            end
+            continue
+        end
+        if missing_input !== nothing
+            # Optional arguments are positional, so the ones before this one
+            # have to be passed too
+            push!(errors, validation_error(missing_input, "field required when $(input_type.name) is set"))
+            continue
+        end
+        try
+            push!(arguments, convert_input(input_type, input[key]))
+        catch e
+            e isa ValidationError || rethrow()
+            push!(errors, validation_error(e.name, e.message))
+        end
+    end
+    arguments, errors
+end
+
+const state = Dict{String,Any}("status" => "STARTING")
+const predict_lock = ReentrantLock()
+
+json_response(status, body) = HTTP.Response(status, ["Content-Type" => "application/json"], JSON3.write(body))
+
+function health_check(::HTTP.Request)
+    response = Dict{String,Any}("status" => state["status"])
+    if haskey(state, "setup_time")
+        response["setup"] = Dict("metrics" => Dict("setup_time" => state["setup_time"]))
+    end
+    json_response(200, response)
+end
+
+function predict_route(req::HTTP.Request)
+    if state["status"] != "READY"
+        return json_response(503, Dict("detail" => "The model isn't ready to take predictions"))
+    end
+    request = JSON3.read(req.body)
+    input = get(request, :input, Dict{Symbol,Any}())
+    arguments, errors = prediction_arguments(input)
+    if !isempty(errors)
+        return json_response(422, Dict("detail" => errors))
+    end
+
+    response = Dict{String,Any}("id" => get(request, :id, nothing), "input" => input)
+    output = nothing
+    error_message = nothing
+    predict_time = @elapsed lock(predict_lock) do
+        try
+            output = Base.invokelatest(predict_function, arguments...)
+        catch e
+            error_message = sprint(showerror, e)
+            @error "Prediction failed" exception = (e, catch_backtrace())
+        end
+    end
+    response["metrics"] = Dict("predict_time" => predict_time)
+    if error_message !== nothing
+        response["status"] = "failed"
+        response["error"] = error_message
+    else
+        response["status"] = "succeeded"
+        response["output"] = encode_output(output)
+    end
+    json_response(200, response)
+end
+
+router = HTTP.Router()
+HTTP.register!(router, "GET", "/health-check", health_check)
+HTTP.register!(router, "GET", "/openapi.json", _ -> json_response(200, openapi_schema()))
+HTTP.register!(router, "POST", "/predictions", predict_route)
+
+server = HTTP.serve!(router, "0.0.0.0", port)
+
+# setup() runs after the server has started, so the health check says the
+# model is starting until it's finished
+if isdefined(Model, :setup)
+    try
+        state["setup_time"] = @elapsed Base.invokelatest(Model.setup)
+        state["status"] = "READY"
+    catch e
+        @error "setup() failed" exception = (e, catch_backtrace())
+        state["status"] = "SETUP_FAILED"
+    end
+else
+    state["status"] = "READY"
+end
+
+wait(server)
@@ -0,0 +1,48 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateWithJuliaPredictor(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "predict.jl"), []byte("predict(x::Int) = 2x\n"), 0o644))
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  julia_version: "1.10"
+  julia_packages:
+    - DifferentialEquations@7.13.0
+predict: predict.jl:predict
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `ENV JULIA_DEPOT_PATH=/opt/julia
+ENV PATH="/opt/julia/juliaup/bin:$PATH"
+RUN curl -fsSL https://install.julialang.org | sh -s -- --yes --path /opt/julia/juliaup --default-channel 1.10
+RUN julia -e 'using Pkg; Pkg.add([Pkg.PackageSpec(name="HTTP"), Pkg.PackageSpec(name="JSON3"), Pkg.PackageSpec(name="DifferentialEquations", version="7.13.0")]); Pkg.precompile()'
+COPY .cog/tmp/`)
+	require.Contains(t, actual, `/server.jl /opt/cog/julia/server.jl`)
+	require.Contains(t, actual, `WORKDIR /src
+EXPOSE 5000
+ENV PORT=5000
+CMD ["julia", "/opt/cog/julia/server.jl", "predict.jl", "predict"]
+COPY . /src`)
+
+	server, err := os.ReadFile(filepath.Join(gen.tmpDir, "server.jl"))
+	require.NoError(t, err)
+	require.Equal(t, JuliaServer, server)
+}
@@ -0,0 +1,51 @@
+package dockerfile
+
+import (
+	"path"
+	"strconv"
+	"strings"
+)
+
+// NotebookModuleDir is where the Python module that a notebook is converted to goes in the image. It's outside /src so
+// it's still there when the project directory is mounted over /src.
+const NotebookModuleDir = "/opt/cog/notebook"
+
+// StripIPythonCommand replaces the IPython magics and shell commands that nbconvert turns into get_ipython() calls,
+// which only work in Jupyter, with pass
+const StripIPythonCommand = `sed -i -E 's/^([[:space:]]*)get_ipython\(\).*/\1pass  # IPython magic removed by Cog/'`
+
+// notebookStage returns a build stage that converts the notebook the predictor is in to a Python module, or "" if
+// the predictor is in a Python file
+func (g *StandardGenerator) notebookStage() string {
+	notebook, _ := g.Config.PredictNotebook()
+	if notebook == "" {
+		return ""
+	}
+	source := "/notebook/" + path.Base(notebook)
+	module := "/notebook/" + notebookModule(notebook)
+	return strings.Join([]string{
+		"FROM python:" + g.Config.Build.PythonVersion + "-slim AS notebook",
+		"RUN --mount=type=cache,target=/root/.cache/pip pip install nbconvert",
+		"COPY [" + strconv.Quote(notebook) + ", " + strconv.Quote(source) + "]",
+		"RUN jupyter nbconvert --to python --output-dir /notebook " + strconv.Quote(source) + " && " + StripIPythonCommand + " " + strconv.Quote(module),
+	}, "\n")
+}
+
+// installNotebook returns the steps that copy the converted notebook into the image and point the predictor at it,
+// or "" if the predictor is in a Python file
+func (g *StandardGenerator) installNotebook() string {
+	notebook, name := g.Config.PredictNotebook()
+	if notebook == "" {
+		return ""
+	}
+	module := notebookModule(notebook)
+	return strings.Join([]string{
+		"COPY --from=notebook [" + strconv.Quote("/notebook/"+module) + ", " + strconv.Quote(NotebookModuleDir+"/"+module) + "]",
+		"ENV COG_PREDICT_TYPE_STUB=" + strconv.Quote(NotebookModuleDir+"/"+module+":"+name),
+	}, "\n")
+}
+
+// notebookModule returns the filename of the Python module a notebook is converted to, like "notebook.py"
+func notebookModule(notebook string) string {
+	return strings.TrimSuffix(path.Base(notebook), path.Ext(notebook)) + ".py"
+}
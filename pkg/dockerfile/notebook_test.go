@@ -0,0 +1,43 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateWithNotebook(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, "notebooks"), 0o755))
+	notebook := `{"cells": [{"cell_type": "code", "source": ["class Predictor:\n", "    pass\n"]}]}`
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "notebooks", "my model.ipynb"), []byte(notebook), 0o644))
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+predict: "notebooks/my model.ipynb:Predictor"
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `#syntax=docker/dockerfile:1.4
+FROM python:3.12-slim AS notebook
+RUN --mount=type=cache,target=/root/.cache/pip pip install nbconvert
+COPY ["notebooks/my model.ipynb", "/notebook/my model.ipynb"]
+RUN jupyter nbconvert --to python --output-dir /notebook "/notebook/my model.ipynb" && `+StripIPythonCommand+` "/notebook/my model.py"
+FROM python:3.12-slim
+`)
+	require.Contains(t, actual, `COPY --from=notebook ["/notebook/my model.py", "/opt/cog/notebook/my model.py"]
+ENV COG_PREDICT_TYPE_STUB="/opt/cog/notebook/my model.py:Predictor"
+WORKDIR /src`)
+}
@@ -0,0 +1,61 @@
+package dockerfile
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// RServer is the server for R predictors, which serves Cog's HTTP API with plumber
+//
+//go:embed r/server.R
+var RServer []byte
+
+// rServerPackages are the R packages the server for R predictors uses
+var rServerPackages = []string{"plumber", "jsonlite", "mime"}
+
+// installR returns the steps that install the R version in build.r_version, using rig, and the packages in
+// build.r_packages, using pak, or "" if r_version isn't set. If the predictor is an R function, it also installs the
+// server for it.
+func (g *StandardGenerator) installR() (string, error) {
+	version := g.Config.Build.RVersion
+	if version == "" {
+		return "", nil
+	}
+	packages := g.Config.Build.RPackages
+	script, _ := g.Config.PredictR()
+	if script != "" {
+		packages = slices.Concat(rServerPackages, packages)
+	}
+
+	lines := []string{
+		`RUN --mount=type=cache,target=/var/cache/apt,sharing=locked apt-get update -qq && apt-get install -qqy --no-install-recommends curl ca-certificates && rm -rf /var/lib/apt/lists/*`,
+		`RUN curl -fsSL "https://github.com/r-lib/rig/releases/download/latest/rig-linux-$(uname -m)-latest.tar.gz" | tar xz -C /usr/local && rig add ` + version + ` && rig default ` + version,
+	}
+	if len(packages) > 0 {
+		quoted := []string{}
+		for _, pkg := range packages {
+			quoted = append(quoted, strconv.Quote(pkg))
+		}
+		lines = append(lines, `RUN Rscript -e 'pak::pkg_install(c(`+strings.Join(quoted, ", ")+`))'`)
+	}
+	if script != "" {
+		dir, relativeDir := g.filesDir()
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return "", fmt.Errorf("Failed to write server.R: %w", err)
+		}
+		tmpPath := filepath.Join(dir, "server.R")
+		if err := os.WriteFile(tmpPath, RServer, 0o644); err != nil {
+			return "", fmt.Errorf("Failed to write server.R: %w", err)
+		}
+		lines = append(lines, "COPY "+path.Join(relativeDir, "server.R")+" "+config.RServerPath)
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,69 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateWithRPredictor(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "predict.R"), []byte("predict <- function(x = 1) x * 2\n"), 0o644))
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  r_version: "4.4"
+  r_packages:
+    - ranger
+predict: predict.R:predict
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, `RUN curl -fsSL "https://github.com/r-lib/rig/releases/download/latest/rig-linux-$(uname -m)-latest.tar.gz" | tar xz -C /usr/local && rig add 4.4 && rig default 4.4
+RUN Rscript -e 'pak::pkg_install(c("plumber", "jsonlite", "mime", "ranger"))'
+COPY .cog/tmp/`)
+	require.Contains(t, actual, `/server.R /opt/cog/r/server.R`)
+	require.Contains(t, actual, `WORKDIR /src
+EXPOSE 5000
+ENV PORT=5000
+CMD ["Rscript", "/opt/cog/r/server.R", "predict.R", "predict"]
+COPY . /src`)
+
+	server, err := os.ReadFile(filepath.Join(gen.tmpDir, "server.R"))
+	require.NoError(t, err)
+	require.Equal(t, RServer, server)
+}
+
+func TestGenerateWithRForPythonPredictor(t *testing.T) {
+	tmpDir := t.TempDir()
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  r_version: "4.3.3"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	require.Contains(t, actual, "rig add 4.3.3 && rig default 4.3.3")
+	require.NotContains(t, actual, "pak::pkg_install")
+	require.NotContains(t, actual, "server.R")
+	require.Contains(t, actual, `CMD ["python", "-m", "cog.server.http"]`)
+}
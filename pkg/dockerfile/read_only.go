@@ -0,0 +1,40 @@
+package dockerfile
+
+import (
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// readOnlyRootFilesystem returns the steps that make the model write its state to build.state_dir, if
+// build.read_only_root_filesystem is set, so it runs with a read-only root filesystem. The state directory is a volume,
+// so 'docker run --read-only' can write to it without any other options.
+func readOnlyRootFilesystem(cfg *config.Config) string {
+	stateDir := cfg.StateDir()
+	if stateDir == "" {
+		return ""
+	}
+	// HOME isn't moved, because pyenv and Python packages installed for the user are in it. Everything that writes
+	// to it at runtime has a variable of its own.
+	env := [][2]string{
+		{"TMPDIR", stateDir},
+		{"XDG_CACHE_HOME", path.Join(stateDir, ".cache")},
+		{"PYTHONPYCACHEPREFIX", path.Join(stateDir, ".cache", "pycache")},
+		{"TRITON_CACHE_DIR", path.Join(stateDir, ".cache", "triton")},
+		{"CUDA_CACHE_PATH", path.Join(stateDir, ".cache", "nv")},
+		{"NUMBA_CACHE_DIR", path.Join(stateDir, ".cache", "numba")},
+		{"MPLCONFIGDIR", path.Join(stateDir, ".config", "matplotlib")},
+		{"COG_PROBE_DIR", path.Join(stateDir, "cog")},
+	}
+	lines := []string{}
+	for _, e := range env {
+		lines = append(lines, "ENV "+e[0]+"="+e[1])
+	}
+	// Lambda functions can write to /tmp without a volume, and Lambda doesn't support them
+	if cfg.Build.Target != config.TargetLambda {
+		lines = append(lines, "VOLUME ["+strconv.Quote(stateDir)+"]")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,27 @@
+package dockerfile
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// serverCommand returns the steps that set the command that starts the model's server, which is either Cog's
+// Python server, the runner in cog.yaml, or the server for R or Julia predictors. Lambda functions start it with
+// Cog's Lambda runtime, which passes it the function's events.
+func serverCommand(cfg *config.Config) string {
+	command := cfg.ServerCommand()
+	if cfg.Build.Target == config.TargetLambda {
+		command = append([]string{"python", "-m", "cog.server.lambda_runtime"}, command...)
+	}
+	args := []string{}
+	for _, arg := range command {
+		args = append(args, strconv.Quote(arg))
+	}
+	cmd := "CMD [" + strings.Join(args, ", ") + "]"
+	if !cfg.UsesRunner() {
+		return cmd
+	}
+	return "ENV PORT=" + strconv.Itoa(config.RunnerPort) + "\n" + cmd
+}
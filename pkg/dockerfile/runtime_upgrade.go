@@ -0,0 +1,26 @@
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RuntimeUpgrade returns a Dockerfile that installs the Cog runtime embedded in this CLI on top of imageName, which
+// was built by Cog, and writes the wheel it copies into dir, which is the build context. The model's environment and
+// code are left as they are, and Cog's dependencies are only upgraded if the new runtime needs them to be.
+func RuntimeUpgrade(imageName string, dir string) (string, error) {
+	filename, data, err := cogWheel()
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0o644); err != nil {
+		return "", fmt.Errorf("Failed to write %s: %w", filename, err)
+	}
+	return strings.Join([]string{
+		"FROM " + imageName,
+		"COPY " + filename + " /tmp/" + filename,
+		"RUN PIP_BREAK_SYSTEM_PACKAGES=1 python -m pip install --no-cache-dir --upgrade /tmp/" + filename + " && rm /tmp/" + filename,
+	}, "\n"), nil
+}
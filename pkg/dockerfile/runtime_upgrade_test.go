@@ -0,0 +1,25 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeUpgrade(t *testing.T) {
+	dir := t.TempDir()
+	actual, err := RuntimeUpgrade("r8.im/alice/hotdog:v1", dir)
+	require.NoError(t, err)
+
+	wheel, data, err := cogWheel()
+	require.NoError(t, err)
+	require.Equal(t, `FROM r8.im/alice/hotdog:v1
+COPY `+wheel+` /tmp/`+wheel+`
+RUN PIP_BREAK_SYSTEM_PACKAGES=1 python -m pip install --no-cache-dir --upgrade /tmp/`+wheel+` && rm /tmp/`+wheel, actual)
+
+	written, err := os.ReadFile(filepath.Join(dir, wheel))
+	require.NoError(t, err)
+	require.Equal(t, data, written)
+}
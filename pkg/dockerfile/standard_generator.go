@@ -55,11 +55,16 @@ type StandardGenerator struct {
 	useCogBaseImage  *bool
 	strip            bool
 	precompile       bool
+	// baseImageDigests are the digests base images are pinned to, by tag
+	baseImageDigests map[string]string
 
 	// absolute path to tmpDir, a directory that will be cleaned up
 	tmpDir string
 	// tmpDir relative to Dir
 	relativeTmpDir string
+	// ejectDir is the directory in Dir the files the Dockerfile copies into the image are written to instead of
+	// tmpDir, if it's set
+	ejectDir string
 
 	fileWalker weights.FileWalker
 
@@ -74,11 +79,13 @@ func NewStandardGenerator(config *config.Config, dir string) (*StandardGenerator
 	if err != nil {
 		return nil, err
 	}
-	// tmpDir, but without dir prefix. This is the path used in the Dockerfile.
+	// tmpDir, but without dir prefix. This is the path used in the Dockerfile, so it uses forward slashes, even on
+	// Windows, where a backslash would be read as an escape character.
 	relativeTmpDir, err := filepath.Rel(dir, tmpDir)
 	if err != nil {
 		return nil, err
 	}
+	relativeTmpDir = filepath.ToSlash(relativeTmpDir)
 
 	return &StandardGenerator{
 		Config:           config,
@@ -110,6 +117,14 @@ func (g *StandardGenerator) SetUseCogBaseImagePtr(useCogBaseImage *bool) {
 }
 
 func (g *StandardGenerator) IsUsingCogBaseImage() bool {
+	if g.Config.Build.Dockerfile != "" {
+		// The base image is whatever build.dockerfile is built on
+		return false
+	}
+	if g.Config.Build.IsDevice() {
+		// Cog's base images are for servers
+		return false
+	}
 	useCogBaseImage := g.useCogBaseImage
 	if useCogBaseImage != nil {
 		return *useCogBaseImage
@@ -117,6 +132,13 @@ func (g *StandardGenerator) IsUsingCogBaseImage() bool {
 	return true
 }
 
+// SetEjectDir writes the files the Dockerfile copies into the image to a directory in the project, relative to Dir,
+// rather than a temporary directory, so the Dockerfile can be built without Cog. The Cog Python package is written
+// there as sources, rather than a wheel.
+func (g *StandardGenerator) SetEjectDir(dir string) {
+	g.ejectDir = filepath.ToSlash(filepath.Clean(dir))
+}
+
 func (g *StandardGenerator) SetStrip(strip bool) {
 	g.strip = strip
 }
@@ -125,11 +147,20 @@ func (g *StandardGenerator) SetPrecompile(precompile bool) {
 	g.precompile = precompile
 }
 
+// SetBaseImageDigests pins base images to digests, by tag, so FROM uses the same image on every build
+func (g *StandardGenerator) SetBaseImageDigests(digests map[string]string) {
+	g.baseImageDigests = digests
+}
+
 func (g *StandardGenerator) GenerateInitialSteps() (string, error) {
+	if g.Config.Build.Dockerfile != "" {
+		return g.userDockerfileSteps()
+	}
 	baseImage, err := g.BaseImage()
 	if err != nil {
 		return "", err
 	}
+	baseImage = PinnedImage(baseImage, g.baseImageDigests)
 	installPython, err := g.installPython()
 	if err != nil {
 		return "", err
@@ -150,11 +181,22 @@ func (g *StandardGenerator) GenerateInitialSteps() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	installR, err := g.installR()
+	if err != nil {
+		return "", err
+	}
+	installJulia, err := g.installJulia()
+	if err != nil {
+		return "", err
+	}
 
 	if g.IsUsingCogBaseImage() {
 		steps := []string{
 			"#syntax=docker/dockerfile:1.4",
+			g.notebookStage(),
 			"FROM " + baseImage,
+			buildArgs(g.Config),
+			g.Config.Build.DockerfilePre,
 			aptInstalls,
 			installCog,
 			pipInstalls,
@@ -162,25 +204,34 @@ func (g *StandardGenerator) GenerateInitialSteps() (string, error) {
 		if g.precompile {
 			steps = append(steps, PrecompilePythonCommand)
 		}
-		steps = append(steps, runCommands)
+		steps = append(steps, installR, installJulia, runCommands, g.installNotebook(), g.Config.Build.DockerfilePost)
 
 		return joinStringsWithoutLineSpace(steps), nil
 	}
 
+	from := "FROM " + baseImage
+	if platform := g.Config.Build.Platform(); platform != "" {
+		// Devices like Jetson boards need an image for their platform, whatever machine it's built on
+		from = "FROM --platform=" + platform + " " + baseImage
+	}
 	steps := []string{
 		"#syntax=docker/dockerfile:1.4",
-		"FROM " + baseImage,
+		g.notebookStage(),
+		from,
+		buildArgs(g.Config),
 		g.preamble(),
+		g.Config.Build.DockerfilePre,
 		g.installTini(),
 		aptInstalls,
 		installPython,
+		installTarget(g.Config),
 		pipInstalls,
 		installCog,
 	}
 	if g.precompile {
 		steps = append(steps, PrecompilePythonCommand)
 	}
-	steps = append(steps, LDConfigCacheBuildCommand, runCommands)
+	steps = append(steps, LDConfigCacheBuildCommand, installR, installJulia, runCommands, g.installNotebook(), g.Config.Build.DockerfilePost)
 
 	return joinStringsWithoutLineSpace(steps), nil
 }
@@ -190,12 +241,14 @@ func (g *StandardGenerator) GenerateModelBase() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return strings.Join([]string{
+	return strings.Join(filterEmpty([]string{
 		initialSteps,
 		`WORKDIR /src`,
+		readOnlyRootFilesystem(g.Config),
+		targetRuntime(g.Config),
 		`EXPOSE 5000`,
-		`CMD ["python", "-m", "cog.server.http"]`,
-	}, "\n"), nil
+		serverCommand(g.Config),
+	}), "\n"), nil
 }
 
 // GenerateDockerfileWithoutSeparateWeights generates a Dockerfile that doesn't write model weights to a separate layer.
@@ -207,6 +260,7 @@ func (g *StandardGenerator) GenerateDockerfileWithoutSeparateWeights() (string,
 	return joinStringsWithoutLineSpace([]string{
 		base,
 		`COPY . /src`,
+		checkImports(g.Config),
 	}), nil
 }
 
@@ -245,9 +299,12 @@ func (g *StandardGenerator) GenerateModelBaseWithSeparateWeights(imageName strin
 
 	base = append(base,
 		`WORKDIR /src`,
+		readOnlyRootFilesystem(g.Config),
+		targetRuntime(g.Config),
 		`EXPOSE 5000`,
-		`CMD ["python", "-m", "cog.server.http"]`,
+		serverCommand(g.Config),
 		`COPY . /src`,
+		checkImports(g.Config),
 	)
 
 	dockerignoreContents = makeDockerignoreForWeights(g.modelDirs, g.modelFiles)
@@ -289,6 +346,12 @@ func (g *StandardGenerator) Cleanup() error {
 }
 
 func (g *StandardGenerator) BaseImage() (string, error) {
+	if g.Config.Build.Dockerfile != "" {
+		return "", fmt.Errorf("The model's base image is set in %s, so Cog doesn't manage it", g.Config.Build.Dockerfile)
+	}
+	if baseImage := targetBaseImage(g.Config); baseImage != "" {
+		return baseImage, nil
+	}
 	if g.IsUsingCogBaseImage() {
 		baseImage, err := g.determineBaseImageName()
 		if err == nil || g.useCogBaseImage != nil {
@@ -307,6 +370,15 @@ func (g *StandardGenerator) BaseImage() (string, error) {
 	return "python:" + g.Config.Build.PythonVersion + "-slim", nil
 }
 
+// PinnedImage returns image pinned to its digest in digests, like "python:3.11-slim@sha256:...", or image itself if it
+// isn't pinned
+func PinnedImage(image string, digests map[string]string) string {
+	if digest, ok := digests[image]; ok && digest != "" {
+		return image + "@" + digest
+	}
+	return image
+}
+
 func (g *StandardGenerator) Name() string {
 	return STANDARD_GENERATOR_NAME
 }
@@ -339,16 +411,22 @@ chmod +x /sbin/tini`,
 }
 
 func (g *StandardGenerator) aptInstalls() (string, error) {
-	packages := g.Config.Build.SystemPackages
-	if len(packages) == 0 {
-		return "", nil
-	}
-
+	packages := g.Config.SystemPackages()
 	if g.IsUsingCogBaseImage() {
 		packages = slices.FilterString(packages, func(pkg string) bool {
 			return !slices.ContainsString(baseImageSystemPackages, pkg)
 		})
 	}
+	if len(packages) == 0 {
+		return "", nil
+	}
+
+	added := slices.FilterString(g.Config.AddedSystemPackages(), func(pkg string) bool {
+		return slices.ContainsString(packages, pkg)
+	})
+	if len(added) > 0 {
+		console.Infof("Installing system packages that the model's Python packages need: %s. Set build.auto_system_packages to false in cog.yaml to turn this off.", strings.Join(added, ", "))
+	}
 
 	return "RUN --mount=type=cache,target=/var/cache/apt,sharing=locked apt-get update -qq && apt-get install -qqy " +
 		strings.Join(packages, " ") +
@@ -356,7 +434,7 @@ func (g *StandardGenerator) aptInstalls() (string, error) {
 }
 
 func (g *StandardGenerator) installPython() (string, error) {
-	if g.Config.Build.GPU && g.useCudaBaseImage && !g.IsUsingCogBaseImage() {
+	if g.Config.Build.GPU && g.useCudaBaseImage && !g.IsUsingCogBaseImage() && !g.Config.Build.IsDevice() {
 		return g.installPythonCUDA()
 	}
 	return "", nil
@@ -402,19 +480,7 @@ RUN rm -rf /usr/bin/python3 && ln -s ` + "`realpath \\`pyenv which python\\`` /u
 }
 
 func (g *StandardGenerator) installCog() (string, error) {
-	files, err := CogEmbed.ReadDir("embed")
-	if err != nil {
-		return "", err
-	}
-	if len(files) != 1 {
-		return "", fmt.Errorf("should only have one cog wheel embedded")
-	}
-	filename := files[0].Name()
-	data, err := CogEmbed.ReadFile("embed/" + filename)
-	if err != nil {
-		return "", err
-	}
-	lines, containerPath, err := g.writeTemp(filename, data)
+	lines, containerPath, err := g.writeCogPackage()
 	if err != nil {
 		return "", err
 	}
@@ -505,14 +571,24 @@ This is the offending line: %s`, command)
 // writeTemp writes a temporary file that can be used as part of the build process
 // It returns the lines to add to Dockerfile to make it available and the filename it ends up as inside the container
 func (g *StandardGenerator) writeTemp(filename string, contents []byte) ([]string, string, error) {
-	path := filepath.Join(g.tmpDir, filename)
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+	dir, relativeDir := g.filesDir()
+	tmpPath := filepath.Join(dir, filepath.FromSlash(filename))
+	if err := os.MkdirAll(filepath.Dir(tmpPath), 0o755); err != nil {
 		return []string{}, "", fmt.Errorf("Failed to write %s: %w", filename, err)
 	}
-	if err := os.WriteFile(path, contents, 0o644); err != nil {
+	if err := os.WriteFile(tmpPath, contents, 0o644); err != nil {
 		return []string{}, "", fmt.Errorf("Failed to write %s: %w", filename, err)
 	}
-	return []string{fmt.Sprintf("COPY %s /tmp/%s", filepath.Join(g.relativeTmpDir, filename), filename)}, "/tmp/" + filename, nil
+	return []string{fmt.Sprintf("COPY %s /tmp/%s", path.Join(relativeDir, filename), filename)}, "/tmp/" + filename, nil
+}
+
+// filesDir returns the directory the files the Dockerfile copies into the image are written to, and that directory
+// relative to Dir, with forward slashes, which is the path used in the Dockerfile
+func (g *StandardGenerator) filesDir() (string, string) {
+	if g.ejectDir != "" {
+		return filepath.Join(g.Dir, filepath.FromSlash(g.ejectDir)), g.ejectDir
+	}
+	return g.tmpDir, g.relativeTmpDir
 }
 
 func joinStringsWithoutLineSpace(chunks []string) string {
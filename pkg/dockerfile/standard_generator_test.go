@@ -5,6 +5,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -91,7 +92,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -116,6 +117,32 @@ COPY . /src`
 	require.Equal(t, expected, actual)
 }
 
+func TestGeneratePinnedBaseImage(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: false
+  python_version: "3.12"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	gen.SetBaseImageDigests(map[string]string{"python:3.12-slim": "sha256:abc123", "python:3.11-slim": "sha256:def456"})
+	actual, err := gen.GenerateInitialSteps()
+	require.NoError(t, err)
+	require.Contains(t, actual, "\nFROM python:3.12-slim@sha256:abc123\n")
+
+	// The base image's name is still its tag
+	baseImage, err := gen.BaseImage()
+	require.NoError(t, err)
+	require.Equal(t, "python:3.12-slim", baseImage)
+}
+
 func TestGenerateEmptyGPU(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -126,7 +153,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
 	gen.SetUseCogBaseImage(false)
@@ -169,7 +196,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -224,7 +251,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -275,7 +302,7 @@ build:
     - "cowsay moo"
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -312,7 +339,7 @@ build:
   python_requirements: "my-requirements.txt"
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(tmpDir))
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -323,6 +350,34 @@ build:
 	require.Contains(t, actual, `pip install -r /tmp/requirements.txt`)
 }
 
+func TestGenerateWithWindowsLineEndings(t *testing.T) {
+	tmpDir := t.TempDir()
+	err := os.WriteFile(path.Join(tmpDir, "requirements.txt"), []byte("numpy==1.26.4\r\npandas==2.0.3\r\n"), 0o644)
+	require.NoError(t, err)
+	conf, err := config.FromYAML([]byte("build:\r\n  python_version: \"3.12\"\r\n  python_requirements: requirements.txt\r\n  run:\r\n    - echo moo\r\n    - echo baa\r\n"))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	_, actual, _, err := gen.GenerateModelBaseWithSeparateWeights("r8.im/replicate/cog-test")
+	require.NoError(t, err)
+	require.NotContains(t, actual, "\r")
+	require.Contains(t, actual, "RUN echo moo\nRUN echo baa\n")
+
+	requirements, err := os.ReadFile(path.Join(gen.tmpDir, "requirements.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "numpy==1.26.4\npandas==2.0.3", string(requirements))
+
+	// Backslashes are escape characters in Dockerfiles, so paths in them always use forward slashes
+	for _, line := range strings.Split(actual, "\n") {
+		if strings.HasPrefix(line, "COPY") {
+			require.NotContains(t, line, `\`)
+		}
+	}
+}
+
 // mockFileInfo is a test type to mock os.FileInfo
 type mockFileInfo struct {
 	size int64
@@ -367,7 +422,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -465,7 +520,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -499,7 +554,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -536,7 +591,7 @@ build:
 predict: predict.py:Predictor
 `))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -587,7 +642,7 @@ predict: predict.py:Predictor
 `, torchVersion)
 		conf, err := config.FromYAML([]byte(yaml))
 		require.NoError(t, err)
-		require.NoError(t, conf.ValidateAndComplete(""))
+		require.NoError(t, conf.ValidateAndComplete("", nil))
 
 		gen, err := NewStandardGenerator(conf, tmpDir)
 		require.NoError(t, err)
@@ -646,7 +701,7 @@ predict: predict.py:Predictor
 `
 	conf, err := config.FromYAML([]byte(yaml))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -698,7 +753,7 @@ predict: predict.py:Predictor
 `
 	conf, err := config.FromYAML([]byte(yaml))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -751,7 +806,7 @@ predict: predict.py:Predictor
 `
 	conf, err := config.FromYAML([]byte(yaml))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -783,7 +838,7 @@ predict: predict.py:Predictor
 `
 	conf, err := config.FromYAML([]byte(yaml))
 	require.NoError(t, err)
-	require.NoError(t, conf.ValidateAndComplete(""))
+	require.NoError(t, conf.ValidateAndComplete("", nil))
 
 	gen, err := NewStandardGenerator(conf, tmpDir)
 	require.NoError(t, err)
@@ -817,3 +872,143 @@ COPY . /src`
 torch==2.3.1
 pandas==2.0.3`, string(requirements))
 }
+
+func TestGenerateCheckImports(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  check_imports: true
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(actual, "COPY . /src\nRUN python -m cog.command.check_imports"))
+
+	conf.Build.CheckImports = false
+	actual, err = gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.NotContains(t, actual, "check_imports")
+}
+
+func TestGenerateReadOnlyRootFilesystem(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  read_only_root_filesystem: true
+  state_dir: /var/lib/model/
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateModelBase()
+	require.NoError(t, err)
+	require.Contains(t, actual, `WORKDIR /src
+ENV TMPDIR=/var/lib/model
+ENV XDG_CACHE_HOME=/var/lib/model/.cache
+ENV PYTHONPYCACHEPREFIX=/var/lib/model/.cache/pycache
+ENV TRITON_CACHE_DIR=/var/lib/model/.cache/triton
+ENV CUDA_CACHE_PATH=/var/lib/model/.cache/nv
+ENV NUMBA_CACHE_DIR=/var/lib/model/.cache/numba
+ENV MPLCONFIGDIR=/var/lib/model/.config/matplotlib
+ENV COG_PROBE_DIR=/var/lib/model/cog
+VOLUME ["/var/lib/model"]
+EXPOSE 5000`)
+
+	// The state is in /tmp if state_dir isn't set, and there's nothing to do if the root filesystem isn't read-only
+	conf.Build.StateDir = ""
+	actual, err = gen.GenerateModelBase()
+	require.NoError(t, err)
+	require.Contains(t, actual, "ENV TMPDIR=/tmp\n")
+	require.Contains(t, actual, `VOLUME ["/tmp"]`)
+	conf.Build.ReadOnlyRootFilesystem = false
+	actual, err = gen.GenerateModelBase()
+	require.NoError(t, err)
+	require.Contains(t, actual, "WORKDIR /src\nEXPOSE 5000")
+}
+
+func TestGenerateJetson(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  gpu: true
+  target: jetson
+  jetpack: "5.1.2"
+  python_version: "3.8"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	require.False(t, gen.IsUsingCogBaseImage())
+	baseImage, err := gen.BaseImage()
+	require.NoError(t, err)
+	require.Equal(t, "nvcr.io/nvidia/l4t-jetpack:r35.4.1", baseImage)
+
+	actual, err := gen.GenerateInitialSteps()
+	require.NoError(t, err)
+	require.Contains(t, actual, "FROM --platform=linux/arm64 nvcr.io/nvidia/l4t-jetpack:r35.4.1\n")
+	require.Contains(t, actual, "apt-get install -qqy --no-install-recommends python3-pip python-is-python3")
+	// JetPack's Python is used, instead of installing one
+	require.NotContains(t, actual, "pyenv")
+}
+
+func TestGenerateEdgeTPU(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  target: edgetpu
+  python_version: "3.9"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateInitialSteps()
+	require.NoError(t, err)
+	require.Contains(t, actual, "FROM python:3.9-slim\n")
+	require.Contains(t, actual, "apt-get install -qqy --no-install-recommends libedgetpu1-std")
+	require.Contains(t, actual, `pip install --extra-index-url https://google-coral.github.io/py-repo/ "pycoral~=2.0"`)
+}
+
+func TestGenerateLambda(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete("", nil))
+	require.NoError(t, conf.SetTarget(config.TargetLambda))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	gen.SetUseCogBaseImage(false)
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+	require.Contains(t, actual, "ENV TMPDIR=/tmp\n")
+	require.NotContains(t, actual, "VOLUME")
+	require.Contains(t, actual, "RUN chmod o+rx /root\n")
+	require.Contains(t, actual, `CMD ["python", "-m", "cog.server.lambda_runtime", "python", "-m", "cog.server.http"]`)
+}
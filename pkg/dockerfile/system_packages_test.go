@@ -0,0 +1,45 @@
+package dockerfile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateAddsSystemPackagesForPythonPackages(t *testing.T) {
+	for _, tt := range []struct {
+		name         string
+		auto         string
+		useCogBase   bool
+		expectedLine string
+	}{
+		{"added", "", false, "apt-get install -qqy ffmpeg libgl1 libglib2.0-0 libpq-dev &&"},
+		{"turned off", "  auto_system_packages: false\n", false, "apt-get install -qqy ffmpeg &&"},
+		{"in cog base image", "", true, "apt-get install -qqy libpq-dev &&"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			conf, err := config.FromYAML([]byte(`
+build:
+  python_version: "3.12"
+  system_packages:
+    - ffmpeg
+  python_packages:
+    - opencv-python==4.10.0.84
+    - psycopg2==2.9.9
+    - torch==2.3.0
+` + tt.auto + `predict: predict.py:Predictor
+`))
+			require.NoError(t, err)
+			require.NoError(t, conf.ValidateAndComplete("", nil))
+
+			gen, err := NewStandardGenerator(conf, t.TempDir())
+			require.NoError(t, err)
+			gen.SetUseCogBaseImage(tt.useCogBase)
+			actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+			require.NoError(t, err)
+			require.Contains(t, actual, tt.expectedLine)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package dockerfile
+
+import (
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// edgeTPUPackageRepository is Coral's Python package index, which has pycoral and the TensorFlow Lite runtime it uses
+const edgeTPUPackageRepository = "https://google-coral.github.io/py-repo/"
+
+// targetBaseImage returns the base image for the device in build.target, or "" if it isn't set
+func targetBaseImage(cfg *config.Config) string {
+	switch cfg.Build.Target {
+	case config.TargetJetson:
+		// Validated in ValidateAndComplete
+		jetPack, _ := cfg.Build.JetPack()
+		return "nvcr.io/nvidia/l4t-jetpack:" + jetPack.L4T
+	case config.TargetEdgeTPU:
+		return "python:" + cfg.Build.PythonVersion + "-slim"
+	}
+	return ""
+}
+
+// installTarget returns the steps that install what the device in build.target needs, or "" if it isn't set
+func installTarget(cfg *config.Config) string {
+	switch cfg.Build.Target {
+	case config.TargetJetson:
+		// JetPack's CUDA, cuDNN and TensorRT are already in the base image, with the Python NVIDIA's packages are
+		// built for
+		return `RUN --mount=type=cache,target=/var/cache/apt,sharing=locked apt-get update -qq && apt-get install -qqy --no-install-recommends python3-pip python-is-python3 && rm -rf /var/lib/apt/lists/*`
+	case config.TargetEdgeTPU:
+		return strings.Join([]string{
+			`RUN --mount=type=cache,target=/var/cache/apt,sharing=locked apt-get update -qq && apt-get install -qqy --no-install-recommends curl gnupg ca-certificates && \
+curl -fsSL https://packages.cloud.google.com/apt/doc/apt-key.gpg | gpg --dearmor -o /usr/share/keyrings/coral-edgetpu.gpg && \
+echo "deb [signed-by=/usr/share/keyrings/coral-edgetpu.gpg] https://packages.cloud.google.com/apt coral-edgetpu-stable main" > /etc/apt/sources.list.d/coral-edgetpu.list && \
+apt-get update -qq && apt-get install -qqy --no-install-recommends libedgetpu1-std && \
+rm -rf /var/lib/apt/lists/*`,
+			`RUN --mount=type=cache,target=/root/.cache/pip pip install --extra-index-url ` + edgeTPUPackageRepository + ` "pycoral~=2.0"`,
+		}, "\n")
+	}
+	return ""
+}
+
+// targetRuntime returns the steps that set up the image to run on the platform in build.target, or "" if it doesn't
+// need any
+func targetRuntime(cfg *config.Config) string {
+	if cfg.Build.Target != config.TargetLambda {
+		return ""
+	}
+	// Lambda runs functions as a user other than root, which needs to be able to run the Python in root's home
+	return "RUN chmod o+rx /root"
+}
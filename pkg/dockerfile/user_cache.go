@@ -3,7 +3,6 @@ package dockerfile
 import (
 	"os"
 	"os/user"
-	"path"
 	"path/filepath"
 )
 
@@ -28,7 +27,7 @@ func UserCacheFolder(folder string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	cacheFolder := path.Join(userCache, folder)
+	cacheFolder := filepath.Join(userCache, folder)
 	if err := os.MkdirAll(cacheFolder, 0o755); err != nil {
 		return "", err
 	}
@@ -0,0 +1,44 @@
+package dockerfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// syntaxDirectivePattern matches a Dockerfile that starts with a syntax parser directive, which has to be its first
+// line
+var syntaxDirectivePattern = regexp.MustCompile(`(?i)^#\s*syntax\s*=`)
+
+// userDockerfileSteps returns the Dockerfile in build.dockerfile, with the steps that add Cog's runtime to the end of
+// its last stage: tini as the entrypoint, like in the images Cog generates, and the Cog Python package. The image has
+// to have Python and pip.
+func (g *StandardGenerator) userDockerfileSteps() (string, error) {
+	contents, err := os.ReadFile(filepath.Join(g.Dir, g.Config.Build.Dockerfile))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read build.dockerfile: %w", err)
+	}
+	copyCog, containerPath, err := g.writeCogPackage()
+	if err != nil {
+		return "", err
+	}
+
+	steps := []string{}
+	if !syntaxDirectivePattern.Match(contents) {
+		steps = append(steps, "#syntax=docker/dockerfile:1.4")
+	}
+	steps = append(steps,
+		strings.TrimRight(string(contents), "\n"),
+		"# Added by Cog to the end of "+g.Config.Build.Dockerfile,
+		"USER root",
+		"ARG TARGETARCH",
+		"ADD https://github.com/krallin/tini/releases/download/v0.19.0/tini-static-${TARGETARCH} /sbin/tini",
+		"RUN chmod +x /sbin/tini",
+		`ENTRYPOINT ["/sbin/tini", "--"]`,
+	)
+	steps = append(steps, copyCog...)
+	steps = append(steps, "RUN PIP_BREAK_SYSTEM_PACKAGES=1 python -m pip install --no-cache-dir "+containerPath)
+	return strings.Join(steps, "\n"), nil
+}
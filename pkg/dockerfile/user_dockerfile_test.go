@@ -0,0 +1,81 @@
+package dockerfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateWithUserDockerfile(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "Dockerfile"), []byte(`FROM python:3.12 AS build
+RUN pip wheel --wheel-dir /wheels numpy
+
+FROM python:3.12-slim
+COPY --from=build /wheels /wheels
+RUN pip install /wheels/*
+USER app
+`), 0o644))
+	conf, err := config.FromYAML([]byte(`
+build:
+  dockerfile: Dockerfile
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	require.False(t, gen.IsUsingCogBaseImage())
+	_, err = gen.BaseImage()
+	require.ErrorContains(t, err, "The model's base image is set in Dockerfile")
+
+	actual, err := gen.GenerateDockerfileWithoutSeparateWeights()
+	require.NoError(t, err)
+
+	wheel, _, err := cogWheel()
+	require.NoError(t, err)
+	expected := `#syntax=docker/dockerfile:1.4
+FROM python:3.12 AS build
+RUN pip wheel --wheel-dir /wheels numpy
+FROM python:3.12-slim
+COPY --from=build /wheels /wheels
+RUN pip install /wheels/*
+USER app
+# Added by Cog to the end of Dockerfile
+USER root
+ARG TARGETARCH
+ADD https://github.com/krallin/tini/releases/download/v0.19.0/tini-static-${TARGETARCH} /sbin/tini
+RUN chmod +x /sbin/tini
+ENTRYPOINT ["/sbin/tini", "--"]
+COPY ` + gen.relativeTmpDir + `/` + wheel + ` /tmp/` + wheel + `
+RUN PIP_BREAK_SYSTEM_PACKAGES=1 python -m pip install --no-cache-dir /tmp/` + wheel + `
+WORKDIR /src
+EXPOSE 5000
+CMD ["python", "-m", "cog.server.http"]
+COPY . /src`
+	require.Equal(t, expected, actual)
+}
+
+func TestGenerateWithUserDockerfileSyntaxDirective(t *testing.T) {
+	tmpDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "model.Dockerfile"), []byte("# syntax=docker/dockerfile:1.7\nFROM python:3.12\n"), 0o644))
+	conf, err := config.FromYAML([]byte(`
+build:
+  dockerfile: model.Dockerfile
+predict: predict.py:Predictor
+`))
+	require.NoError(t, err)
+	require.NoError(t, conf.ValidateAndComplete(tmpDir, nil))
+
+	gen, err := NewStandardGenerator(conf, tmpDir)
+	require.NoError(t, err)
+	actual, err := gen.GenerateModelBase()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(actual, "# syntax=docker/dockerfile:1.7\nFROM python:3.12\n# Added by Cog to the end of model.Dockerfile\n"), actual)
+}
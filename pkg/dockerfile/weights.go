@@ -64,6 +64,8 @@ func findFullWeights(folder string, weights []Weight, weightFile string) ([]Weig
 		if err != nil {
 			return err
 		}
+		// Weights are copied in the Dockerfile, which needs forward slashes
+		relPath = filepath.ToSlash(relPath)
 
 		for _, weight := range weights {
 			if weight.Path == relPath {
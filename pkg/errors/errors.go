@@ -1,7 +1,24 @@
 package errors
 
+import (
+	stderrors "errors"
+)
+
 const (
 	CodeConfigNotFound = "CONFIG_NOT_FOUND"
+	CodeConfigInvalid  = "CONFIG_INVALID"
+	CodeBuildFailed    = "BUILD_FAILED"
+	CodeRegistryAuth   = "REGISTRY_AUTH"
+	CodeGPUUnavailable = "GPU_UNAVAILABLE"
+)
+
+// The stages of a build that a BuildError can happen in
+const (
+	BuildStageWeights    = "weights"
+	BuildStageDockerfile = "dockerfile"
+	BuildStageImage      = "image"
+	BuildStageSchema     = "schema"
+	BuildStageLabels     = "labels"
 )
 
 // Types ////////////////////////////////////////
@@ -23,6 +40,84 @@ func (e *codedError) Code() string {
 	return e.code
 }
 
+// ConfigError is a cog.yaml that couldn't be parsed or isn't valid
+type ConfigError struct {
+	// Path is the path to cog.yaml
+	Path string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConfigError) Code() string {
+	return CodeConfigInvalid
+}
+
+// BuildError is a failure building a model's image
+type BuildError struct {
+	// Stage is the stage of the build that failed, one of the BuildStage constants
+	Stage string
+	// Layer is the Dockerfile step that failed, like "[stage-0 5/12] RUN pip install -r requirements.txt", if it's known
+	Layer string
+	Err   error
+}
+
+func (e *BuildError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BuildError) Unwrap() error {
+	return e.Err
+}
+
+func (e *BuildError) Code() string {
+	return CodeBuildFailed
+}
+
+// RegistryAuthError is a registry refusing to let an image be pushed or pulled, because Docker isn't logged in to
+// it or the user doesn't have access to the image
+type RegistryAuthError struct {
+	// Registry is the registry's host, like "r8.im"
+	Registry string
+	Err      error
+}
+
+func (e *RegistryAuthError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RegistryAuthError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RegistryAuthError) Code() string {
+	return CodeRegistryAuth
+}
+
+// GPUUnavailableError is Docker not being able to give a container a GPU, typically because the NVIDIA Container
+// Toolkit isn't installed
+type GPUUnavailableError struct {
+	Err error
+}
+
+func (e *GPUUnavailableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *GPUUnavailableError) Unwrap() error {
+	return e.Err
+}
+
+func (e *GPUUnavailableError) Code() string {
+	return CodeGPUUnavailable
+}
+
 // Error Creators ///////////////////////////////
 
 // The Cog config was not found
@@ -39,9 +134,10 @@ func IsConfigNotFound(err error) bool {
 	return Code(err) == CodeConfigNotFound
 }
 
-// Return the error code, or the empty string
+// Return the error code of the first error in err's chain that has one, or the empty string
 func Code(err error) string {
-	if cerr, ok := err.(CodedError); ok {
+	var cerr CodedError
+	if stderrors.As(err, &cerr) {
 		return cerr.Code()
 	}
 
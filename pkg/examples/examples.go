@@ -0,0 +1,436 @@
+// Package examples saves predictions as examples of how to use a model, and checks that new builds of the model
+// still run them.
+package examples
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/predict"
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// Dir is where examples are saved, relative to the project
+const Dir = ".cog/examples"
+
+const exampleFile = "example.json"
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// Example is a prediction saved with `cog predict --save-example`. Each example is a directory in Dir, with an
+// example.json file and the files passed to or returned by the prediction.
+type Example struct {
+	Name string `json:"name"`
+	// Inputs are the prediction's inputs, as strings or lists of strings like they're passed to `cog predict -i`.
+	// Values that start with @ are files in the example's directory.
+	Inputs map[string]any `json:"inputs"`
+	// Output is the prediction's output. Strings that start with @ are files in the example's directory.
+	Output any `json:"output,omitempty"`
+
+	dir string
+}
+
+// Save saves a prediction as an example called name in projectDir, replacing any example with that name
+func Save(projectDir string, name string, inputs predict.Inputs, output *any) (*Example, error) {
+	if !nameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("Invalid example name %q, expected letters, digits, '.', '-' and '_'", name)
+	}
+	dir := filepath.Join(projectDir, Dir, name)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	example := &Example{Name: name, Inputs: map[string]any{}, dir: dir}
+
+	for key, input := range inputs {
+		switch {
+		case input.String != nil:
+			example.Inputs[key] = *input.String
+		case input.File != nil:
+			ref, err := copyInputFile(*input.File, dir, key)
+			if err != nil {
+				return nil, err
+			}
+			example.Inputs[key] = ref
+		case input.Array != nil:
+			values := []string{}
+			for i, elem := range *input.Array {
+				s, _ := elem.(string)
+				if strings.HasPrefix(s, "@") {
+					ref, err := copyInputFile(s[1:], dir, fmt.Sprintf("%s.%d", key, i))
+					if err != nil {
+						return nil, err
+					}
+					s = ref
+				}
+				values = append(values, s)
+			}
+			example.Inputs[key] = values
+		}
+	}
+
+	if output != nil {
+		w := outputWriter{dir: dir}
+		value, err := w.save(*output)
+		if err != nil {
+			return nil, err
+		}
+		example.Output = value
+	}
+
+	if err := example.write(); err != nil {
+		return nil, err
+	}
+	return example, nil
+}
+
+func (e *Example) write() error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(e.dir, exampleFile), append(data, '\n'), 0o644) //#nosec G306
+}
+
+// copyInputFile copies a file passed as an input into the example, and returns the reference to it
+func copyInputFile(path string, dir string, name string) (string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read input file %s: %w", path, err)
+	}
+	name += filepath.Ext(path)
+	if err := os.WriteFile(filepath.Join(dir, name), contents, 0o644); err != nil { //#nosec G306
+		return "", err
+	}
+	return "@" + name, nil
+}
+
+// outputWriter saves files in an output, which the model server returns as data URLs, to the example's directory
+type outputWriter struct {
+	dir   string
+	files int
+}
+
+func (w *outputWriter) save(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, "data:") {
+			return v, nil
+		}
+		u, err := dataurl.DecodeString(v)
+		if err != nil {
+			return v, nil
+		}
+		name := "output"
+		if w.files > 0 {
+			name = fmt.Sprintf("output.%d", w.files)
+		}
+		w.files++
+		name += mime.ExtensionByType(u.ContentType())
+		if err := os.WriteFile(filepath.Join(w.dir, name), u.Data, 0o644); err != nil { //#nosec G306
+			return nil, err
+		}
+		return "@" + name, nil
+	case []any:
+		saved := make([]any, len(v))
+		for i, elem := range v {
+			s, err := w.save(elem)
+			if err != nil {
+				return nil, err
+			}
+			saved[i] = s
+		}
+		return saved, nil
+	case map[string]any:
+		saved := make(map[string]any, len(v))
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		// Name files in a stable order
+		sort.Strings(keys)
+		for _, key := range keys {
+			s, err := w.save(v[key])
+			if err != nil {
+				return nil, err
+			}
+			saved[key] = s
+		}
+		return saved, nil
+	}
+	return value, nil
+}
+
+// Load returns the examples saved in projectDir, sorted by name
+func Load(projectDir string) ([]*Example, error) {
+	entries, err := os.ReadDir(filepath.Join(projectDir, Dir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	examples := []*Example{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(projectDir, Dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(dir, exampleFile))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		example := &Example{}
+		if err := json.Unmarshal(data, example); err != nil {
+			return nil, fmt.Errorf("Failed to parse example %s: %w", entry.Name(), err)
+		}
+		example.Name = entry.Name()
+		example.dir = dir
+		examples = append(examples, example)
+	}
+	return examples, nil
+}
+
+// PredictInputs returns the example's inputs, to run a prediction with
+func (e *Example) PredictInputs() predict.Inputs {
+	keyVals := map[string][]string{}
+	for key, value := range e.Inputs {
+		switch v := value.(type) {
+		case string:
+			keyVals[key] = []string{e.resolve(v)}
+		case []any:
+			for _, elem := range v {
+				keyVals[key] = append(keyVals[key], e.resolve(fmt.Sprint(elem)))
+			}
+		case []string:
+			for _, elem := range v {
+				keyVals[key] = append(keyVals[key], e.resolve(elem))
+			}
+		}
+	}
+	return predict.NewInputs(keyVals)
+}
+
+// resolve makes a reference to a file in the example's directory absolute
+func (e *Example) resolve(value string) string {
+	if !strings.HasPrefix(value, "@") {
+		return value
+	}
+	return "@" + filepath.Join(e.dir, value[1:])
+}
+
+// GoldenOutput returns the example's saved output, with the files in it as data URLs, like the model server
+// returns them
+func (e *Example) GoldenOutput() (any, error) {
+	return e.goldenOutput(e.Output)
+}
+
+func (e *Example) goldenOutput(value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, "@") {
+			return v, nil
+		}
+		contents, err := os.ReadFile(filepath.Join(e.dir, v[1:]))
+		if errors.Is(err, os.ErrNotExist) {
+			return v, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return dataurl.New(contents, mime.TypeByExtension(filepath.Ext(v))).String(), nil
+	case []any:
+		golden := make([]any, len(v))
+		for i, elem := range v {
+			g, err := e.goldenOutput(elem)
+			if err != nil {
+				return nil, err
+			}
+			golden[i] = g
+		}
+		return golden, nil
+	case map[string]any:
+		golden := make(map[string]any, len(v))
+		for key, elem := range v {
+			g, err := e.goldenOutput(elem)
+			if err != nil {
+				return nil, err
+			}
+			golden[key] = g
+		}
+		return golden, nil
+	}
+	return value, nil
+}
+
+// SaveOutput replaces the example's saved output
+func (e *Example) SaveOutput(output *any) error {
+	for _, name := range outputFiles(e.Output) {
+		if err := os.Remove(filepath.Join(e.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	e.Output = nil
+	if output != nil {
+		w := outputWriter{dir: e.dir}
+		value, err := w.save(*output)
+		if err != nil {
+			return err
+		}
+		e.Output = value
+	}
+	return e.write()
+}
+
+// outputFiles returns the names of the files in a saved output
+func outputFiles(value any) []string {
+	switch v := value.(type) {
+	case string:
+		if strings.HasPrefix(v, "@") {
+			return []string{v[1:]}
+		}
+	case []any:
+		names := []string{}
+		for _, elem := range v {
+			names = append(names, outputFiles(elem)...)
+		}
+		return names
+	case map[string]any:
+		names := []string{}
+		for _, elem := range v {
+			names = append(names, outputFiles(elem)...)
+		}
+		return names
+	}
+	return nil
+}
+
+// Check compares an output from running the example with the saved output. Unless exact is set, it only checks
+// the output has the same shape, with the same types of values and files, because most models don't return exactly
+// the same output every time.
+func (e *Example) Check(output *any, exact bool) error {
+	var actual any
+	if output != nil {
+		actual = *output
+	}
+	return e.check("output", e.Output, actual, exact)
+}
+
+func (e *Example) check(path string, expected any, actual any, exact bool) error {
+	switch exp := expected.(type) {
+	case nil:
+		if actual != nil {
+			return fmt.Errorf("%s: expected no output, got %s", path, describe(actual))
+		}
+		return nil
+	case string:
+		act, ok := actual.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %s", path, describe(actual))
+		}
+		if strings.HasPrefix(exp, "@") {
+			return e.checkFile(path, exp[1:], act, exact)
+		}
+		if exact && exp != act {
+			return fmt.Errorf("%s: expected %q, got %q", path, exp, act)
+		}
+		return nil
+	case []any:
+		act, ok := actual.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a list, got %s", path, describe(actual))
+		}
+		// Outputs like generated images can vary in number, so unless exact is set, only check there are some
+		if (exact && len(act) != len(exp)) || (len(exp) > 0 && len(act) == 0) {
+			return fmt.Errorf("%s: expected %d items, got %d", path, len(exp), len(act))
+		}
+		for i := 0; i < len(exp) && i < len(act); i++ {
+			if err := e.check(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i], exact); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		act, ok := actual.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %s", path, describe(actual))
+		}
+		keys := make([]string, 0, len(exp))
+		for key := range exp {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := e.check(path+"."+key, exp[key], act[key], exact); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if reflect.TypeOf(expected) != reflect.TypeOf(actual) {
+			return fmt.Errorf("%s: expected %s, got %s", path, describe(expected), describe(actual))
+		}
+		if exact && !reflect.DeepEqual(expected, actual) {
+			return fmt.Errorf("%s: expected %v, got %v", path, expected, actual)
+		}
+		return nil
+	}
+}
+
+func (e *Example) checkFile(path string, name string, actual string, exact bool) error {
+	u, err := dataurl.DecodeString(actual)
+	if err != nil {
+		return fmt.Errorf("%s: expected a file, got %s", path, describe(actual))
+	}
+	expectedType := mime.TypeByExtension(filepath.Ext(name))
+	if expectedType != "" && !strings.EqualFold(expectedType, u.ContentType()) {
+		return fmt.Errorf("%s: expected a %s file, got %s", path, expectedType, u.ContentType())
+	}
+	if !exact {
+		return nil
+	}
+	contents, err := os.ReadFile(filepath.Join(e.dir, name))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(contents, u.Data) {
+		return fmt.Errorf("%s: the file is different to %s", path, name)
+	}
+	return nil
+}
+
+func describe(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "nothing"
+	case string:
+		if strings.HasPrefix(v, "data:") {
+			return "a file"
+		}
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,148 @@
+package examples
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/predict"
+)
+
+func pngURL(data string) string {
+	return dataurl.New([]byte(data), "image/png").String()
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	projectDir := t.TempDir()
+	inputImage := filepath.Join(t.TempDir(), "cat.jpg")
+	require.NoError(t, os.WriteFile(inputImage, []byte("cat"), 0o644))
+
+	inputs := predict.NewInputs(map[string][]string{
+		"prompt": {"a cat"},
+		"image":  {"@" + inputImage},
+		"tags":   {"cute", "fluffy"},
+	})
+	var output any = []any{pngURL("first"), pngURL("second")}
+
+	_, err := Save(projectDir, "cat", inputs, &output)
+	require.NoError(t, err)
+
+	dir := filepath.Join(projectDir, Dir, "cat")
+	contents, err := os.ReadFile(filepath.Join(dir, "image.jpg"))
+	require.NoError(t, err)
+	require.Equal(t, "cat", string(contents))
+	contents, err = os.ReadFile(filepath.Join(dir, "output.1.png"))
+	require.NoError(t, err)
+	require.Equal(t, "second", string(contents))
+
+	loaded, err := Load(projectDir)
+	require.NoError(t, err)
+	require.Len(t, loaded, 1)
+	example := loaded[0]
+	require.Equal(t, "cat", example.Name)
+	require.Equal(t, map[string]any{"prompt": "a cat", "image": "@image.jpg", "tags": []any{"cute", "fluffy"}}, example.Inputs)
+	require.Equal(t, []any{"@output.png", "@output.1.png"}, example.Output)
+
+	predictInputs := example.PredictInputs()
+	require.Equal(t, "a cat", *predictInputs["prompt"].String)
+	require.Equal(t, filepath.Join(dir, "image.jpg"), *predictInputs["image"].File)
+	require.Equal(t, []any{"cute", "fluffy"}, *predictInputs["tags"].Array)
+}
+
+func TestSaveInvalidName(t *testing.T) {
+	_, err := Save(t.TempDir(), "../escape", predict.Inputs{}, nil)
+	require.ErrorContains(t, err, `Invalid example name "../escape"`)
+}
+
+func TestLoadWithoutExamples(t *testing.T) {
+	loaded, err := Load(t.TempDir())
+	require.NoError(t, err)
+	require.Empty(t, loaded)
+}
+
+func TestCheck(t *testing.T) {
+	projectDir := t.TempDir()
+	var output any = map[string]any{"image": pngURL("first"), "caption": "a cat", "score": 0.9}
+	_, err := Save(projectDir, "cat", predict.Inputs{}, &output)
+	require.NoError(t, err)
+	loaded, err := Load(projectDir)
+	require.NoError(t, err)
+	example := loaded[0]
+
+	testCases := []struct {
+		name        string
+		output      any
+		exact       bool
+		expectedErr string
+	}{
+		{name: "identical", output: output, exact: true},
+		{name: "same shape", output: map[string]any{"image": pngURL("other"), "caption": "a dog", "score": 0.5}},
+		{
+			name:        "different file",
+			output:      map[string]any{"image": pngURL("other"), "caption": "a cat", "score": 0.9},
+			exact:       true,
+			expectedErr: "output.image: the file is different to output.png",
+		},
+		{
+			name:        "different file type",
+			output:      map[string]any{"image": dataurl.New([]byte("x"), "text/plain").String(), "caption": "a cat", "score": 0.9},
+			expectedErr: "output.image: expected a image/png file, got text/plain",
+		},
+		{
+			name:        "different string",
+			output:      map[string]any{"image": pngURL("first"), "caption": "a dog", "score": 0.9},
+			exact:       true,
+			expectedErr: `output.caption: expected "a cat", got "a dog"`,
+		},
+		{
+			name:        "different type",
+			output:      map[string]any{"image": pngURL("first"), "caption": "a cat", "score": "high"},
+			expectedErr: "output.score: expected a number, got a string",
+		},
+		{
+			name:        "no output",
+			output:      nil,
+			expectedErr: "output: expected an object, got nothing",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			output := tc.output
+			err := example.Check(&output, tc.exact)
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
+
+func TestGoldenOutputAndSaveOutput(t *testing.T) {
+	projectDir := t.TempDir()
+	var output any = []any{pngURL("first"), pngURL("second"), "a caption"}
+	_, err := Save(projectDir, "cat", predict.Inputs{}, &output)
+	require.NoError(t, err)
+	loaded, err := Load(projectDir)
+	require.NoError(t, err)
+	example := loaded[0]
+
+	golden, err := example.GoldenOutput()
+	require.NoError(t, err)
+	require.Equal(t, output, golden)
+
+	var newOutput any = []any{pngURL("third")}
+	require.NoError(t, example.SaveOutput(&newOutput))
+	dir := filepath.Join(projectDir, Dir, "cat")
+	require.NoFileExists(t, filepath.Join(dir, "output.1.png"))
+
+	loaded, err = Load(projectDir)
+	require.NoError(t, err)
+	require.Equal(t, []any{"@output.png"}, loaded[0].Output)
+	golden, err = loaded[0].GoldenOutput()
+	require.NoError(t, err)
+	require.Equal(t, newOutput, golden)
+}
@@ -0,0 +1,235 @@
+// Package fly deploys models to Fly.io as apps, with the fly CLI. It uses the same credentials and organization as
+// the CLI does.
+package fly
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ConfigFile is the file the fly CLI reads an app's configuration from, in the project directory
+const ConfigFile = "fly.toml"
+
+// DefaultRegion is the region apps run in if --region isn't set, which has Fly's GPUs
+const DefaultRegion = "ord"
+
+// gpuKinds are Fly's GPUs, by the words resources.gpu_type is matched against. They're checked in order, so the
+// A100 with more memory is matched before the other one.
+var gpuKinds = []struct {
+	match []string
+	kind  string
+}{
+	{[]string{"a100", "80"}, "a100-sxm4-80gb"},
+	{[]string{"a100"}, "a100-pcie-40gb"},
+	{[]string{"l40s"}, "l40s"},
+	{[]string{"a10"}, "a10"},
+}
+
+// DefaultGPUKind is the GPU apps get if resources.gpu_type isn't set
+const DefaultGPUKind = "a10"
+
+// App is a Fly.io app that runs a model
+type App struct {
+	Name   string
+	Region string
+	// MinMachines is how many machines Fly keeps running when there aren't any requests
+	MinMachines int
+}
+
+// GPUKind returns Fly's name for the GPU in resources.gpu_type
+func GPUKind(resources *config.Resources) (string, error) {
+	if resources == nil || resources.GPUType == "" {
+		return DefaultGPUKind, nil
+	}
+	gpuType := strings.ToLower(resources.GPUType)
+	for _, g := range gpuKinds {
+		matches := true
+		for _, m := range g.match {
+			matches = matches && strings.Contains(gpuType, m)
+		}
+		if matches {
+			return g.kind, nil
+		}
+	}
+	return "", fmt.Errorf("resources.gpu_type is %s, but Fly.io only has NVIDIA A10, L40S and A100 GPUs", resources.GPUType)
+}
+
+// GenerateConfig returns the contents of fly.toml for an app that runs a model with a configuration
+func GenerateConfig(cfg *config.Config, app App) (string, error) {
+	if cfg.Build.Target != "" {
+		return "", fmt.Errorf("The model is built to run on %s, not a server, so it can't run on Fly.io. Remove build.target from cog.yaml", cfg.Build.Target)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Generated by cog deploy fly. Change it as you like: it's only generated if it doesn't exist.\n")
+	fmt.Fprintf(&b, "app = %s\n", quote(app.Name))
+	fmt.Fprintf(&b, "primary_region = %s\n", quote(app.Region))
+
+	if len(cfg.EnvironmentVariables) > 0 {
+		b.WriteString("\n[env]\n")
+		names := make([]string, 0, len(cfg.EnvironmentVariables))
+		for name := range cfg.EnvironmentVariables {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(&b, "  %s = %s\n", name, quote(cfg.EnvironmentVariables[name]))
+		}
+	}
+
+	// Cog's server runs one prediction at a time, unless concurrency.max says it can run more
+	concurrency := 1
+	if cfg.Concurrency != nil && cfg.Concurrency.Max > 0 {
+		concurrency = cfg.Concurrency.Max
+	}
+	b.WriteString("\n[http_service]\n")
+	fmt.Fprintf(&b, "  internal_port = %d\n", config.RunnerPort)
+	b.WriteString("  force_https = true\n")
+	b.WriteString("  auto_stop_machines = \"stop\"\n")
+	b.WriteString("  auto_start_machines = true\n")
+	fmt.Fprintf(&b, "  min_machines_running = %d\n", app.MinMachines)
+	b.WriteString("\n  [http_service.concurrency]\n")
+	b.WriteString("    type = \"requests\"\n")
+	fmt.Fprintf(&b, "    soft_limit = %d\n", concurrency)
+	fmt.Fprintf(&b, "    hard_limit = %d\n", concurrency)
+	b.WriteString("\n  [[http_service.checks]]\n")
+	// Models can take a long time to load their weights in setup()
+	b.WriteString("    grace_period = \"5m\"\n")
+	b.WriteString("    interval = \"30s\"\n")
+	b.WriteString("    method = \"GET\"\n")
+	b.WriteString("    path = \"/health-check\"\n")
+	b.WriteString("    timeout = \"5s\"\n")
+
+	b.WriteString("\n[[vm]]\n")
+	cpus := 1
+	memory := int64(0)
+	if cfg.Resources != nil {
+		cpus = max(cpus, int(cfg.Resources.CPU+0.999))
+		memory = cfg.Resources.MemoryBytes()
+	}
+	if cfg.Build.GPU {
+		kind, err := GPUKind(cfg.Resources)
+		if err != nil {
+			return "", err
+		}
+		gpus := 1
+		if cfg.Resources != nil && cfg.Resources.GPUCount > 0 {
+			gpus = cfg.Resources.GPUCount
+		}
+		fmt.Fprintf(&b, "  gpu_kind = %s\n", quote(kind))
+		fmt.Fprintf(&b, "  gpus = %d\n", gpus)
+		b.WriteString("  cpu_kind = \"performance\"\n")
+		cpus = max(cpus, 8)
+	} else {
+		b.WriteString("  cpu_kind = \"shared\"\n")
+	}
+	fmt.Fprintf(&b, "  cpus = %d\n", cpus)
+	if memory > 0 {
+		fmt.Fprintf(&b, "  memory = \"%dmb\"\n", (memory+1024*1024-1)/(1024*1024))
+	}
+	return b.String(), nil
+}
+
+// quote returns s as a TOML string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`).Replace(s) + `"`
+}
+
+// ImportSecrets sets the app's secrets, in the form name=value, without deploying the app, so the next deploy
+// starts the model with them. Fly keeps them encrypted, and they aren't in fly.toml.
+func ImportSecrets(app string, secretEnv []string) error {
+	if len(secretEnv) == 0 {
+		return nil
+	}
+	var input strings.Builder
+	for _, env := range secretEnv {
+		name, value, _ := strings.Cut(env, "=")
+		if strings.Contains(value, "\n") {
+			fmt.Fprintf(&input, "%s=\"\"\"%s\"\"\"\n", name, value)
+		} else {
+			fmt.Fprintf(&input, "%s=%s\n", name, value)
+		}
+	}
+	if _, err := runFly(input.String(), nil, ImportSecretsArgs(app)...); err != nil {
+		return fmt.Errorf("Failed to set the secrets of Fly.io app %s: %w", app, err)
+	}
+	return nil
+}
+
+// ImportSecretsArgs returns the arguments to fly that ImportSecrets runs. It passes the secrets to fly on stdin.
+func ImportSecretsArgs(app string) []string {
+	return []string{"secrets", "import", "--stage", "--app", app}
+}
+
+// CreateAppArgs returns the arguments to the fly commands CreateApp runs, to check whether the app exists, and to
+// create it if it doesn't
+func CreateAppArgs(app App) (status []string, create []string) {
+	return []string{"status", "--app", app.Name}, []string{"apps", "create", app.Name}
+}
+
+// CreateApp creates the app if it doesn't exist, and returns whether it was created
+func CreateApp(app App) (created bool, err error) {
+	statusArgs, createArgs := CreateAppArgs(app)
+	_, err = runFly("", nil, statusArgs...)
+	if err == nil {
+		return false, nil
+	}
+	if !strings.Contains(err.Error(), "Could not find App") {
+		return false, fmt.Errorf("Failed to get Fly.io app %s: %w", app.Name, err)
+	}
+	console.Infof("Creating Fly.io app %s...", app.Name)
+	if _, err := runFly("", nil, createArgs...); err != nil {
+		return false, fmt.Errorf("Failed to create Fly.io app %s: %w", app.Name, err)
+	}
+	return true, nil
+}
+
+// DeployArgs returns the arguments to fly that Deploy runs. --local-only makes fly push the image from the local
+// Docker, rather than looking for it in a registry.
+func DeployArgs(app App, imageName string, configPath string) []string {
+	return []string{"deploy", "--app", app.Name, "--config", configPath, "--image", imageName, "--local-only"}
+}
+
+// Deploy deploys a local image to the app, with the configuration in configPath
+func Deploy(app App, imageName string, configPath string) error {
+	console.Infof("Deploying %s to Fly.io app %s...", imageName, app.Name)
+	if _, err := runFly("", console.Writer(), DeployArgs(app, imageName, configPath)...); err != nil {
+		return fmt.Errorf("Failed to deploy Fly.io app %s: %w", app.Name, err)
+	}
+	return nil
+}
+
+// runFly is a variable so tests can replace the fly CLI. It passes stdin to fly if it isn't empty, and copies fly's
+// output to progress if it isn't nil, for commands that take a while.
+var runFly = func(stdin string, progress io.Writer, args ...string) ([]byte, error) {
+	cmd := exec.Command("fly", args...)
+	cmd.Env = os.Environ()
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if progress == nil {
+		progress = io.Discard
+	}
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = io.MultiWriter(stderr, progress)
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = io.MultiWriter(stdout, progress)
+	console.Debug("$ fly " + strings.Join(args, " "))
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the fly CLI isn't installed. See https://fly.io/docs/flyctl/install/")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,106 @@
+package fly
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestGenerateConfig(t *testing.T) {
+	cfg := &config.Config{
+		Build:                &config.Build{GPU: true},
+		Concurrency:          &config.Concurrency{Max: 4},
+		Resources:            &config.Resources{CPU: 2, Memory: "32Gi", GPUType: "L40S"},
+		EnvironmentVariables: map[string]string{"MODEL_SIZE": "large", "PROMPT": `say "hi"`},
+	}
+	toml, err := GenerateConfig(cfg, App{Name: "hotdog-detector", Region: "ord", MinMachines: 1})
+	require.NoError(t, err)
+	require.Equal(t, `# Generated by cog deploy fly. Change it as you like: it's only generated if it doesn't exist.
+app = "hotdog-detector"
+primary_region = "ord"
+
+[env]
+  MODEL_SIZE = "large"
+  PROMPT = "say \"hi\""
+
+[http_service]
+  internal_port = 5000
+  force_https = true
+  auto_stop_machines = "stop"
+  auto_start_machines = true
+  min_machines_running = 1
+
+  [http_service.concurrency]
+    type = "requests"
+    soft_limit = 4
+    hard_limit = 4
+
+  [[http_service.checks]]
+    grace_period = "5m"
+    interval = "30s"
+    method = "GET"
+    path = "/health-check"
+    timeout = "5s"
+
+[[vm]]
+  gpu_kind = "l40s"
+  gpus = 1
+  cpu_kind = "performance"
+  cpus = 8
+  memory = "32768mb"
+`, toml)
+
+	cfg = &config.Config{Build: &config.Build{}, Resources: &config.Resources{CPU: 0.5}}
+	toml, err = GenerateConfig(cfg, App{Name: "hotdog-detector", Region: "ord"})
+	require.NoError(t, err)
+	require.Contains(t, toml, "[[vm]]\n  cpu_kind = \"shared\"\n  cpus = 1\n")
+	require.NotContains(t, toml, "[env]")
+}
+
+func TestGPUKind(t *testing.T) {
+	for gpuType, expected := range map[string]string{
+		"":          DefaultGPUKind,
+		"A10G":      "a10",
+		"A100":      "a100-pcie-40gb",
+		"A100 80GB": "a100-sxm4-80gb",
+	} {
+		kind, err := GPUKind(&config.Resources{GPUType: gpuType})
+		require.NoError(t, err, gpuType)
+		require.Equal(t, expected, kind, gpuType)
+	}
+	_, err := GPUKind(&config.Resources{GPUType: "H100"})
+	require.ErrorContains(t, err, "Fly.io only has")
+}
+
+func TestDeploy(t *testing.T) {
+	calls := [][]string{}
+	stdins := []string{}
+	original := runFly
+	t.Cleanup(func() { runFly = original })
+	runFly = func(stdin string, progress io.Writer, args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		stdins = append(stdins, stdin)
+		if args[0] == "status" {
+			return nil, errors.New("exit status 1: Error: Could not find App \"hotdog-detector\"")
+		}
+		return nil, nil
+	}
+
+	app := App{Name: "hotdog-detector", Region: "ord"}
+	created, err := CreateApp(app)
+	require.NoError(t, err)
+	require.True(t, created)
+	require.NoError(t, ImportSecrets("hotdog-detector", []string{"HF_TOKEN=hf_abc", "KEY=line 1\nline 2"}))
+	require.NoError(t, Deploy(app, "hotdog-detector:latest", "/src/fly.toml"))
+	require.Equal(t, [][]string{
+		{"status", "--app", "hotdog-detector"},
+		{"apps", "create", "hotdog-detector"},
+		{"secrets", "import", "--stage", "--app", "hotdog-detector"},
+		{"deploy", "--app", "hotdog-detector", "--config", "/src/fly.toml", "--image", "hotdog-detector:latest", "--local-only"},
+	}, calls)
+	require.Equal(t, "HF_TOKEN=hf_abc\nKEY=\"\"\"line 1\nline 2\"\"\"\n", stdins[2])
+}
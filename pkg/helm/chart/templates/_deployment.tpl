@@ -0,0 +1,138 @@
+{{/*
+The Deployment of one version of the model, which is called with a dict of the
+chart's context as "root" and the version's track, "stable" or "canary". The
+canary's resources are named after the stable version's, with -canary after
+them, and its pods have different selector labels so neither version's
+Deployment or Service picks up the other's pods.
+*/}}
+{{- define "model.deployment" -}}
+{{- $root := .root }}
+{{- $canary := eq .track "canary" }}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ ternary (include "model.canaryFullname" $root) (include "model.fullname" $root) $canary }}
+  labels:
+    {{- include "model.labels" $root | nindent 4 }}
+    app.kubernetes.io/track: {{ .track }}
+spec:
+  {{- if $canary }}
+  replicas: {{ $root.Values.canary.replicaCount }}
+  {{- else if not $root.Values.autoscaling.enabled }}
+  replicas: {{ $root.Values.replicaCount }}
+  {{- end }}
+  selector:
+    matchLabels:
+      {{- include (ternary "model.canarySelectorLabels" "model.selectorLabels" $canary) $root | nindent 6 }}
+  template:
+    metadata:
+      annotations:
+        {{- /* Restart the model when its secrets change */}}
+        checksum/secret: {{ include (print $root.Template.BasePath "/secret.yaml") $root | sha256sum }}
+        {{- if $root.Values.metrics.enabled }}
+        prometheus.io/scrape: "true"
+        prometheus.io/port: "5000"
+        prometheus.io/path: /metrics
+        {{- end }}
+        {{- with $root.Values.podAnnotations }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+      labels:
+        {{- include (ternary "model.canarySelectorLabels" "model.selectorLabels" $canary) $root | nindent 8 }}
+        app.kubernetes.io/track: {{ .track }}
+    spec:
+      {{- with $root.Values.imagePullSecrets }}
+      imagePullSecrets:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      terminationGracePeriodSeconds: {{ $root.Values.terminationGracePeriodSeconds }}
+      containers:
+        - name: model
+          image: {{ include (ternary "model.canaryImage" "model.image" $canary) $root | quote }}
+          imagePullPolicy: {{ $root.Values.image.pullPolicy }}
+          ports:
+            - name: http
+              containerPort: 5000
+              protocol: TCP
+          {{- if or $root.Values.env $root.Values.secrets.names $root.Values.metrics.enabled }}
+          env:
+            {{- if $root.Values.metrics.enabled }}
+            - name: COG_METRICS
+              value: "true"
+            {{- end }}
+            {{- range $name, $value := $root.Values.env }}
+            - name: {{ $name }}
+              value: {{ $value | quote }}
+            {{- end }}
+            {{- range $root.Values.secrets.names }}
+            - name: {{ . }}
+              valueFrom:
+                secretKeyRef:
+                  name: {{ include "model.secretName" $root }}
+                  key: {{ . }}
+            {{- end }}
+          {{- end }}
+          {{- /* Cog creates the ready file when setup() has finished, so the model gets requests once it can run them */}}
+          startupProbe:
+            exec:
+              command: ["test", "-f", "{{ include "model.probeDir" $root }}/ready"]
+            periodSeconds: 10
+            failureThreshold: {{ div $root.Values.setupTimeoutSeconds 10 | max 1 }}
+          readinessProbe:
+            exec:
+              command: ["test", "-f", "{{ include "model.probeDir" $root }}/ready"]
+            periodSeconds: 10
+          livenessProbe:
+            httpGet:
+              path: /health-check
+              port: http
+            periodSeconds: 30
+            timeoutSeconds: 10
+          resources:
+            {{- toYaml $root.Values.resources | nindent 12 }}
+          {{- if $root.Values.readOnlyRootFilesystem }}
+          securityContext:
+            readOnlyRootFilesystem: true
+          {{- end }}
+          volumeMounts:
+            - name: shm
+              mountPath: /dev/shm
+            {{- if $root.Values.readOnlyRootFilesystem }}
+            - name: state
+              mountPath: {{ $root.Values.stateDir }}
+            {{- end }}
+            {{- range $i, $tmpfs := $root.Values.tmpfs }}
+            - name: tmpfs-{{ $i }}
+              mountPath: {{ $tmpfs.path }}
+            {{- end }}
+      volumes:
+        {{- /* Kubernetes gives containers a 64MB /dev/shm, which is too small for PyTorch's DataLoader workers */}}
+        - name: shm
+          emptyDir:
+            medium: Memory
+            sizeLimit: {{ $root.Values.shmSize }}
+        {{- if $root.Values.readOnlyRootFilesystem }}
+        - name: state
+          emptyDir: {}
+        {{- end }}
+        {{- range $i, $tmpfs := $root.Values.tmpfs }}
+        - name: tmpfs-{{ $i }}
+          emptyDir:
+            medium: Memory
+            {{- with $tmpfs.sizeLimit }}
+            sizeLimit: {{ . }}
+            {{- end }}
+        {{- end }}
+      {{- with $root.Values.nodeSelector }}
+      nodeSelector:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      {{- with $root.Values.affinity }}
+      affinity:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      {{- with $root.Values.tolerations }}
+      tolerations:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+{{- end }}
@@ -0,0 +1,88 @@
+{{/*
+The name of the chart, or nameOverride.
+*/}}
+{{- define "model.name" -}}
+{{- default .Chart.Name .Values.nameOverride | trunc 63 | trimSuffix "-" }}
+{{- end }}
+
+{{/*
+The name of the model's resources. It's the release name, with the chart's name
+after it unless the release name already has it.
+*/}}
+{{- define "model.fullname" -}}
+{{- if .Values.fullnameOverride }}
+{{- .Values.fullnameOverride | trunc 63 | trimSuffix "-" }}
+{{- else }}
+{{- $name := default .Chart.Name .Values.nameOverride }}
+{{- if contains $name .Release.Name }}
+{{- .Release.Name | trunc 63 | trimSuffix "-" }}
+{{- else }}
+{{- printf "%s-%s" .Release.Name $name | trunc 63 | trimSuffix "-" }}
+{{- end }}
+{{- end }}
+{{- end }}
+
+{{- define "model.labels" -}}
+helm.sh/chart: {{ printf "%s-%s" .Chart.Name .Chart.Version | replace "+" "_" | trunc 63 | trimSuffix "-" }}
+{{ include "model.selectorLabels" . }}
+app.kubernetes.io/version: {{ .Chart.AppVersion | quote }}
+app.kubernetes.io/managed-by: {{ .Release.Service }}
+{{- end }}
+
+{{- define "model.selectorLabels" -}}
+app.kubernetes.io/name: {{ include "model.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{- end }}
+
+{{/*
+The canary's pods have a different instance label from the stable version's,
+so they're selected separately.
+*/}}
+{{- define "model.canarySelectorLabels" -}}
+app.kubernetes.io/name: {{ include "model.name" . }}
+app.kubernetes.io/instance: {{ printf "%s-canary" .Release.Name | trunc 63 | trimSuffix "-" }}
+{{- end }}
+
+{{- define "model.canaryFullname" -}}
+{{- printf "%s-canary" (include "model.fullname" .) | trunc 63 | trimSuffix "-" }}
+{{- end }}
+
+{{/*
+The model's image, by digest if there is one.
+*/}}
+{{- define "model.image" -}}
+{{- if .Values.image.digest }}
+{{- printf "%s@%s" .Values.image.repository .Values.image.digest }}
+{{- else }}
+{{- printf "%s:%s" .Values.image.repository (.Values.image.tag | default .Chart.AppVersion) }}
+{{- end }}
+{{- end }}
+
+{{/*
+The canary's image. It's in the stable version's repository unless it says
+otherwise, and has to have its own tag or digest.
+*/}}
+{{- define "model.canaryImage" -}}
+{{- $repository := .Values.canary.image.repository | default .Values.image.repository }}
+{{- if .Values.canary.image.digest }}
+{{- printf "%s@%s" $repository .Values.canary.image.digest }}
+{{- else }}
+{{- printf "%s:%s" $repository (required "Set canary.image.tag or canary.image.digest to the version of the model to try" .Values.canary.image.tag) }}
+{{- end }}
+{{- end }}
+
+{{/*
+The directory Cog creates a file named "ready" in when the model has finished
+setup(), which is in the state directory if the root filesystem is read-only.
+*/}}
+{{- define "model.probeDir" -}}
+{{- if .Values.readOnlyRootFilesystem }}
+{{- printf "%s/cog" .Values.stateDir }}
+{{- else }}
+{{- "/var/run/cog" }}
+{{- end }}
+{{- end }}
+
+{{- define "model.secretName" -}}
+{{- .Values.secrets.existingSecret | default (include "model.fullname" .) }}
+{{- end }}
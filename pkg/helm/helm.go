@@ -0,0 +1,303 @@
+// Package helm generates Helm charts that run a model's HTTP server on Kubernetes, from its cog.yaml, for teams that
+// deploy with Helm or GitOps tools like Argo CD and Flux.
+package helm
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+)
+
+// The chart's templates, which are the same for every model. Only Chart.yaml and values.yaml are generated.
+//
+//go:embed all:chart
+var chartFS embed.FS
+
+// Version is the version of generated charts
+const Version = "0.1.0"
+
+// GPUResource is the Kubernetes resource NVIDIA's device plugin gives pods GPUs with
+const GPUResource = config.GPUResource
+
+// Chart is a Helm chart that runs a model
+type Chart struct {
+	// Name is the chart's name, which its Kubernetes resources are named after
+	Name string
+	// Image is the model's image, in a registry the cluster can pull from
+	Image string
+	// Canary is the image of a new version of the model to try on live traffic next to Image, or "" for none
+	Canary string
+	// CanaryWeight is the percentage of requests that go to the canary, like DefaultCanaryWeight
+	CanaryWeight int
+	// Shadow sends a copy of every request to the canary instead, and throws away its responses
+	Shadow bool
+}
+
+// DefaultCanaryWeight is the percentage of requests that go to a canary, unless the chart says otherwise
+const DefaultCanaryWeight = 10
+
+var chartNameIllegalChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ChartName returns a chart name for an image, like hotdog-detector for r8.im/alice/hotdog-detector:latest
+func ChartName(imageName string) (string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	chartName := chartNameIllegalChars.ReplaceAllString(path.Base(ref.Context().RepositoryStr()), "-")
+	return strings.Trim(chartName, "-"), nil
+}
+
+// Generate returns the chart's files, by their paths in the chart's directory
+func Generate(cfg *config.Config, chart Chart) (map[string][]byte, error) {
+	if cfg.Build.Target != "" {
+		return nil, fmt.Errorf("The model is built to run on %s, not a server, so it can't run on Kubernetes. Remove build.target from cog.yaml", cfg.Build.Target)
+	}
+	image, err := parseImage(chart.Image)
+	if err != nil {
+		return nil, err
+	}
+	canary := image
+	canary.tag, canary.digest = "", ""
+	if chart.Canary != "" {
+		if canary, err = parseImage(chart.Canary); err != nil {
+			return nil, err
+		}
+	} else {
+		// So the values have a sensible weight if the canary's turned on later
+		chart.CanaryWeight = DefaultCanaryWeight
+	}
+	if chart.CanaryWeight < 0 || chart.CanaryWeight > 100 {
+		return nil, fmt.Errorf("The canary's weight must be a percentage from 0 to 100, not %d", chart.CanaryWeight)
+	}
+
+	files := map[string][]byte{
+		"Chart.yaml":  []byte(chartYAML(chart.Name, image.tag)),
+		"values.yaml": []byte(valuesYAML(cfg, chart, image, canary)),
+	}
+	err = fs.WalkDir(chartFS, "chart", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		contents, err := chartFS.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		files[strings.TrimPrefix(p, "chart/")] = contents
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// imageRef is an image's repository, and its tag or digest
+type imageRef struct {
+	repository string
+	tag        string
+	digest     string
+}
+
+func parseImage(imageName string) (imageRef, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return imageRef{}, fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	image := imageRef{repository: ref.Context().Name(), tag: "latest"}
+	switch r := ref.(type) {
+	case name.Tag:
+		image.tag = r.TagStr()
+	case name.Digest:
+		image.digest = r.DigestStr()
+	}
+	return image, nil
+}
+
+func chartYAML(chartName string, appVersion string) string {
+	var b strings.Builder
+	b.WriteString("apiVersion: v2\n")
+	fmt.Fprintf(&b, "name: %s\n", chartName)
+	fmt.Fprintf(&b, "description: Runs the Cog model %s on Kubernetes\n", chartName)
+	b.WriteString("type: application\n")
+	fmt.Fprintf(&b, "version: %s\n", Version)
+	fmt.Fprintf(&b, "appVersion: %s\n", quote(appVersion))
+	return b.String()
+}
+
+func valuesYAML(cfg *config.Config, chart Chart, image imageRef, canary imageRef) string {
+	var b strings.Builder
+	b.WriteString("# Generated by cog helm from cog.yaml. Override these for each environment you deploy to.\n\n")
+
+	b.WriteString("image:\n")
+	fmt.Fprintf(&b, "  repository: %s\n", quote(image.repository))
+	fmt.Fprintf(&b, "  tag: %s\n", quote(image.tag))
+	b.WriteString("  # Set to run the image by its digest, like sha256:..., rather than its tag\n")
+	fmt.Fprintf(&b, "  digest: %s\n", quote(image.digest))
+	b.WriteString("  pullPolicy: IfNotPresent\n")
+	b.WriteString("imagePullSecrets: []\n")
+	b.WriteString("nameOverride: \"\"\n")
+	b.WriteString("fullnameOverride: \"\"\n\n")
+
+	b.WriteString("# How many copies of the model to run, when autoscaling isn't enabled\n")
+	b.WriteString("replicaCount: 1\n\n")
+
+	b.WriteString("# How long setup() can take, in seconds, before the model is restarted\n")
+	b.WriteString("setupTimeoutSeconds: 600\n")
+	b.WriteString("terminationGracePeriodSeconds: 30\n\n")
+
+	b.WriteString("# environment_variables in cog.yaml\n")
+	writeMap(&b, "env", cfg.EnvironmentVariables)
+	b.WriteString("\n")
+
+	b.WriteString("# secrets in cog.yaml. The model reads them from a Secret with a key for each of them, which is\n")
+	b.WriteString("# existingSecret if it's set. Otherwise, the chart creates one from values, which should only be\n")
+	b.WriteString("# set from an encrypted file or the command line, never committed.\n")
+	b.WriteString("secrets:\n")
+	if len(cfg.Secrets) == 0 {
+		b.WriteString("  names: []\n")
+	} else {
+		b.WriteString("  names:\n")
+		for _, secret := range cfg.Secrets {
+			fmt.Fprintf(&b, "    - %s\n", secret.Name)
+		}
+	}
+	b.WriteString("  existingSecret: \"\"\n")
+	b.WriteString("  values: {}\n\n")
+
+	b.WriteString("# resources in cog.yaml\n")
+	b.WriteString("resources:\n")
+	requests, limits := cfg.Resources.KubernetesResources(cfg.Build.GPU)
+	writeMap(&b, "  requests", requests)
+	writeMap(&b, "  limits", limits)
+	b.WriteString("\n")
+
+	shmSize := cfg.Resources.ShmSizeBytes()
+	if shmSize == 0 {
+		shmSize, _ = config.ParseQuantity(docker.DefaultShmSize)
+	}
+	fmt.Fprintf(&b, "shmSize: %s\n", config.KubernetesQuantity(shmSize))
+	if cfg.Resources == nil || len(cfg.Resources.Tmpfs) == 0 {
+		b.WriteString("tmpfs: []\n")
+	} else {
+		b.WriteString("tmpfs:\n")
+		for _, tmpfs := range cfg.Resources.Tmpfs {
+			fmt.Fprintf(&b, "  - path: %s\n", quote(tmpfs.Path))
+			if size := tmpfs.SizeBytes(); size > 0 {
+				fmt.Fprintf(&b, "    sizeLimit: %s\n", config.KubernetesQuantity(size))
+			}
+		}
+	}
+	stateDir := cfg.StateDir()
+	fmt.Fprintf(&b, "readOnlyRootFilesystem: %t\n", stateDir != "")
+	if stateDir == "" {
+		stateDir = config.DefaultStateDir
+	}
+	fmt.Fprintf(&b, "stateDir: %s\n\n", quote(stateDir))
+
+	b.WriteString("service:\n")
+	b.WriteString("  type: ClusterIP\n")
+	b.WriteString("  port: 80\n\n")
+
+	b.WriteString("ingress:\n")
+	b.WriteString("  enabled: false\n")
+	b.WriteString("  className: \"\"\n")
+	b.WriteString("  annotations: {}\n")
+	b.WriteString("  hosts:\n")
+	b.WriteString("    - host: model.example.com\n")
+	b.WriteString("      paths:\n")
+	b.WriteString("        - path: /\n")
+	b.WriteString("          pathType: Prefix\n")
+	b.WriteString("  tls: []\n\n")
+
+	b.WriteString("# Routes requests to the model through a Gateway API Gateway, which can split them with a canary\n")
+	b.WriteString("httpRoute:\n")
+	fmt.Fprintf(&b, "  enabled: %t\n", chart.Canary != "")
+	b.WriteString("  # The Gateway the route is attached to\n")
+	b.WriteString("  parentRefs:\n")
+	b.WriteString("    - name: gateway\n")
+	b.WriteString("  hostnames: []\n\n")
+
+	b.WriteString("# A new version of the model to try on live traffic before upgrading to it. With mode: canary, weight\n")
+	b.WriteString("# percent of requests go to it. With mode: shadow, it gets a copy of every request, and its responses\n")
+	b.WriteString("# are thrown away. Requests are split by the HTTPRoute, so httpRoute has to be enabled. Compare the\n")
+	b.WriteString("# versions with cog compare-metrics.\n")
+	b.WriteString("canary:\n")
+	fmt.Fprintf(&b, "  enabled: %t\n", chart.Canary != "")
+	mode := "canary"
+	if chart.Shadow {
+		mode = "shadow"
+	}
+	fmt.Fprintf(&b, "  mode: %s\n", mode)
+	fmt.Fprintf(&b, "  weight: %d\n", chart.CanaryWeight)
+	b.WriteString("  image:\n")
+	fmt.Fprintf(&b, "    repository: %s\n", quote(canary.repository))
+	fmt.Fprintf(&b, "    tag: %s\n", quote(canary.tag))
+	fmt.Fprintf(&b, "    digest: %s\n", quote(canary.digest))
+	b.WriteString("  replicaCount: 1\n\n")
+
+	b.WriteString("# Counts predictions and how long they take, and annotates pods for Prometheus to scrape the counts\n")
+	b.WriteString("metrics:\n")
+	b.WriteString("  enabled: true\n\n")
+
+	concurrency := 1
+	if cfg.Concurrency != nil && cfg.Concurrency.Max > 0 {
+		concurrency = cfg.Concurrency.Max
+	}
+	fmt.Fprintf(&b, "# Each copy of the model runs %d prediction(s) at once. To scale on how many predictions are waiting,\n", concurrency)
+	b.WriteString("# add a Pods or External metric from your metrics adapter to metrics.\n")
+	b.WriteString("autoscaling:\n")
+	b.WriteString("  enabled: false\n")
+	b.WriteString("  minReplicas: 1\n")
+	b.WriteString("  maxReplicas: 5\n")
+	b.WriteString("  targetCPUUtilizationPercentage: 80\n")
+	b.WriteString("  metrics: []\n\n")
+
+	b.WriteString("podAnnotations: {}\n")
+	if cfg.Build.GPU && cfg.Resources != nil && cfg.Resources.GPUType != "" {
+		fmt.Fprintf(&b, "# resources.gpu_type in cog.yaml is %s. Select nodes with it, like with the nvidia.com/gpu.product label\n", cfg.Resources.GPUType)
+		b.WriteString("# from NVIDIA's GPU feature discovery, or your cloud's node pool label.\n")
+	}
+	if cfg.Build.GPU && cfg.Resources != nil && cfg.Resources.GPUSharing != nil {
+		b.WriteString("# resources.gpu_sharing in cog.yaml. Nodes share their GPUs like this once NVIDIA's device plugin is\n")
+		b.WriteString("# configured with cog export device-plugin-config.\n")
+	}
+	writeMap(&b, "nodeSelector", cfg.Resources.KubernetesNodeSelector())
+	b.WriteString("tolerations: []\n")
+	b.WriteString("affinity: {}\n")
+	return b.String()
+}
+
+// writeMap writes a YAML mapping of strings, sorted by key
+func writeMap(b *strings.Builder, key string, m map[string]string) {
+	if len(m) == 0 {
+		fmt.Fprintf(b, "%s: {}\n", key)
+		return
+	}
+	indent := strings.Repeat(" ", len(key)-len(strings.TrimLeft(key, " ")))
+	fmt.Fprintf(b, "%s:\n", key)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, "%s  %s: %s\n", indent, k, quote(m[k]))
+	}
+}
+
+// quote returns s as a YAML string. JSON strings are YAML strings.
+func quote(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out)
+}
@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestChartName(t *testing.T) {
+	chartName, err := ChartName("r8.im/alice/hotdog_detector:latest")
+	require.NoError(t, err)
+	require.Equal(t, "hotdog-detector", chartName)
+}
+
+func TestGenerate(t *testing.T) {
+	cfg := &config.Config{
+		Build:                &config.Build{GPU: true, ReadOnlyRootFilesystem: true},
+		Resources:            &config.Resources{CPU: 4, Memory: "16Gi", GPUCount: 2, GPUType: "A100", Disk: "50G", Tmpfs: []config.Tmpfs{{Path: "/scratch", Size: "1G"}}},
+		EnvironmentVariables: map[string]string{"MODEL_SIZE": "large", "LABELS": "hotdog: yes"},
+		Secrets:              []config.Secret{{Name: "HF_TOKEN", Env: "HF_TOKEN"}},
+	}
+	files, err := Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector:v2"})
+	require.NoError(t, err)
+	for _, p := range []string{".helmignore", "templates/_helpers.tpl", "templates/deployment.yaml", "templates/service.yaml", "templates/hpa.yaml", "templates/ingress.yaml", "templates/secret.yaml", "templates/canary.yaml", "templates/httproute.yaml", "templates/_deployment.tpl", "templates/NOTES.txt"} {
+		require.Contains(t, files, p)
+	}
+
+	chart := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(files["Chart.yaml"], &chart))
+	require.Equal(t, "hotdog-detector", chart["name"])
+	require.Equal(t, "v2", chart["appVersion"])
+
+	values := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(files["values.yaml"], &values))
+	require.Equal(t, map[string]any{"repository": "r8.im/alice/hotdog-detector", "tag": "v2", "digest": "", "pullPolicy": "IfNotPresent"}, values["image"])
+	require.Equal(t, map[string]any{"MODEL_SIZE": "large", "LABELS": "hotdog: yes"}, values["env"])
+	require.Equal(t, []any{"HF_TOKEN"}, values["secrets"].(map[string]any)["names"])
+	require.Equal(t, map[string]any{
+		"requests": map[string]any{"cpu": "4", "memory": "16384Mi", "ephemeral-storage": "47684Mi"},
+		"limits":   map[string]any{"memory": "16384Mi", "ephemeral-storage": "47684Mi", "nvidia.com/gpu": "2"},
+	}, values["resources"])
+	require.Equal(t, "5723Mi", values["shmSize"])
+	require.Equal(t, []any{map[string]any{"path": "/scratch", "sizeLimit": "954Mi"}}, values["tmpfs"])
+	require.Equal(t, true, values["readOnlyRootFilesystem"])
+	require.Equal(t, "/tmp", values["stateDir"])
+	require.Equal(t, false, values["canary"].(map[string]any)["enabled"])
+	require.Equal(t, DefaultCanaryWeight, values["canary"].(map[string]any)["weight"])
+	require.Equal(t, false, values["httpRoute"].(map[string]any)["enabled"])
+	require.Equal(t, map[string]any{"enabled": true}, values["metrics"])
+}
+
+func TestGenerateWithGPUSharing(t *testing.T) {
+	cfg := &config.Config{
+		Build:     &config.Build{GPU: true},
+		Resources: &config.Resources{GPUSharing: &config.GPUSharing{Strategy: config.GPUSharingMPS, Replicas: 4}},
+	}
+	files, err := Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector:v2"})
+	require.NoError(t, err)
+
+	values := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(files["values.yaml"], &values))
+	require.Equal(t, map[string]any{"nvidia.com/gpu.shared": "1"}, values["resources"].(map[string]any)["limits"])
+	require.Equal(t, map[string]any{"nvidia.com/gpu.sharing-strategy": "mps"}, values["nodeSelector"])
+}
+
+func TestGenerateWithCanary(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{}}
+	files, err := Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector:v2", Canary: "r8.im/alice/hotdog-detector:v3", CanaryWeight: 25})
+	require.NoError(t, err)
+	values := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(files["values.yaml"], &values))
+	canary := values["canary"].(map[string]any)
+	require.Equal(t, true, canary["enabled"])
+	require.Equal(t, "canary", canary["mode"])
+	require.Equal(t, 25, canary["weight"])
+	require.Equal(t, map[string]any{"repository": "r8.im/alice/hotdog-detector", "tag": "v3", "digest": ""}, canary["image"])
+	require.Equal(t, true, values["httpRoute"].(map[string]any)["enabled"])
+
+	files, err = Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector:v2", Canary: "r8.im/alice/hotdog-detector:v3", CanaryWeight: DefaultCanaryWeight, Shadow: true})
+	require.NoError(t, err)
+	values = map[string]any{}
+	require.NoError(t, yaml.Unmarshal(files["values.yaml"], &values))
+	require.Equal(t, "shadow", values["canary"].(map[string]any)["mode"])
+	require.Equal(t, DefaultCanaryWeight, values["canary"].(map[string]any)["weight"])
+
+	_, err = Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector:v2", Canary: "r8.im/alice/hotdog-detector:v3", CanaryWeight: 101})
+	require.ErrorContains(t, err, "percentage from 0 to 100")
+}
+
+func TestGenerateWithDigest(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{}}
+	files, err := Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector@sha256:" + strings.Repeat("a", 64)})
+	require.NoError(t, err)
+	values := map[string]any{}
+	require.NoError(t, yaml.Unmarshal(files["values.yaml"], &values))
+	image := values["image"].(map[string]any)
+	require.Equal(t, "sha256:"+strings.Repeat("a", 64), image["digest"])
+	require.Equal(t, map[string]any{"requests": map[string]any{}, "limits": map[string]any{}}, values["resources"])
+	require.Equal(t, false, values["readOnlyRootFilesystem"])
+
+	cfg.Build.Target = config.TargetLambda
+	_, err = Generate(cfg, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector"})
+	require.ErrorContains(t, err, "can't run on Kubernetes")
+}
+
+func TestTemplatesParse(t *testing.T) {
+	files, err := Generate(&config.Config{Build: &config.Build{}}, Chart{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector"})
+	require.NoError(t, err)
+	// Helm's template functions, which only need to exist for the templates to parse
+	funcs := template.FuncMap{}
+	for _, f := range []string{"include", "toYaml", "nindent", "quote", "default", "trunc", "trimSuffix", "contains", "replace", "sha256sum", "div", "max", "dict", "ternary", "required", "sub", "fail"} {
+		funcs[f] = func(...any) string { return "" }
+	}
+	for p, contents := range files {
+		if !strings.HasPrefix(p, "templates/") {
+			continue
+		}
+		_, err := template.New(p).Funcs(funcs).Parse(string(contents))
+		require.NoError(t, err, p)
+	}
+}
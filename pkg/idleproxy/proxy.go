@@ -0,0 +1,339 @@
+// Package idleproxy runs a model's server only while it's being used. It's a reverse proxy that starts the server on
+// the first request, and stops it once it has had no requests for a while, so the model doesn't hold a GPU's memory
+// while nobody's using it.
+package idleproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// healthCheckPath is the path of the model server's health check. Health checks don't count as activity, so
+// something polling the server doesn't keep the model running, and they don't start it.
+const healthCheckPath = "/health-check"
+
+// pollTimeout is how long the proxy waits for the backend to say whether an async prediction is still running
+const pollTimeout = 5 * time.Second
+
+// asyncPrediction is a prediction the backend responded to before it completed, because it was made with
+// `Prefer: respond-async`. The backend isn't stopped until it has completed.
+type asyncPrediction struct {
+	// id is the prediction's ID, or "" if the response didn't have one, or it can't be looked up with
+	// GET /predictions/{id}, in which case the backend's health check is polled until it isn't busy
+	id string
+	// authorization is the request's Authorization header, to poll the prediction with
+	authorization string
+}
+
+// Backend is the server the proxy starts and stops
+type Backend interface {
+	// Start starts the server and returns its URL, once it can take requests
+	Start(ctx context.Context) (*url.URL, error)
+	// Stop stops the server
+	Stop(ctx context.Context) error
+}
+
+// Proxy passes requests to a Backend, which it starts when a request comes in and stops once it has been idle for
+// Timeout
+type Proxy struct {
+	backend Backend
+	timeout time.Duration
+	clock   func() time.Time
+	// OnStop is called when the backend is stopped because it has been idle
+	OnStop func()
+
+	// Held while the backend is started or stopped, so requests wait for it
+	lifecycleMu sync.Mutex
+	// ctx is the context the backend is started with, which lasts as long as Serve
+	ctx context.Context
+
+	mu         sync.Mutex
+	proxy      *httputil.ReverseProxy
+	target     *url.URL
+	inFlight   int
+	lastActive time.Time
+	// The async predictions that are running on the backend
+	asyncPredictions []*asyncPrediction
+	// Set when the backend stopped responding, like when it crashed, so it's stopped before it's started again
+	broken bool
+}
+
+// New returns a Proxy that stops backend once it has had no requests for timeout
+func New(backend Backend, timeout time.Duration) *Proxy {
+	return &Proxy{backend: backend, timeout: timeout, clock: time.Now, ctx: context.Background()}
+}
+
+// Serve serves requests on l until ctx is canceled or it fails, and then closes the server and stops the backend if
+// it's running
+func (p *Proxy) Serve(ctx context.Context, l net.Listener) error {
+	p.ctx = ctx
+	server := &http.Server{Handler: p, ReadHeaderTimeout: 10 * time.Second}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(l)
+	}()
+	shutdown := func() error {
+		_ = server.Close()
+		return p.stop(context.WithoutCancel(ctx))
+	}
+
+	interval := min(p.timeout, 5*time.Second)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.stopIfIdle(ctx); err != nil {
+				_ = shutdown()
+				return err
+			}
+		case err := <-errs:
+			_ = shutdown()
+			return err
+		case <-ctx.Done():
+			return shutdown()
+		}
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == healthCheckPath {
+		p.serveHealthCheck(w, r)
+		return
+	}
+	proxy, err := p.acquire()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start the model: %s", err), http.StatusBadGateway)
+		return
+	}
+	defer p.release()
+	proxy.ServeHTTP(w, r)
+}
+
+// serveHealthCheck passes health checks to the backend if it's running. If it isn't, the model will be started for
+// the next request, so it's reported as ready for one.
+func (p *Proxy) serveHealthCheck(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	proxy := p.proxy
+	p.mu.Unlock()
+	if proxy != nil {
+		proxy.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"status": "READY", "setup": null}`))
+}
+
+// acquire returns the proxy to the backend, starting it if it isn't running, and counts a request in flight until
+// release is called
+func (p *Proxy) acquire() (*httputil.ReverseProxy, error) {
+	p.lifecycleMu.Lock()
+	defer p.lifecycleMu.Unlock()
+
+	p.mu.Lock()
+	proxy, broken := p.proxy, p.broken
+	p.mu.Unlock()
+	if proxy == nil {
+		if broken {
+			_ = p.backend.Stop(p.ctx)
+		}
+		target, err := p.backend.Start(p.ctx)
+		if err != nil {
+			return nil, err
+		}
+		proxy = httputil.NewSingleHostReverseProxy(target)
+		proxy.ModifyResponse = p.trackAsyncPrediction
+		proxy.ErrorHandler = p.handleBackendError
+
+		p.mu.Lock()
+		p.target = target
+		p.asyncPredictions = nil
+		p.mu.Unlock()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.proxy = proxy
+	p.broken = false
+	p.inFlight++
+	p.lastActive = p.clock()
+	return proxy, nil
+}
+
+// trackAsyncPrediction records the predictions the backend responds to before they've completed, with
+// `Prefer: respond-async`, so it isn't stopped while they're running
+func (p *Proxy) trackAsyncPrediction(resp *http.Response) error {
+	req := resp.Request
+	if resp.StatusCode != http.StatusAccepted || req.Header.Get("Prefer") != "respond-async" {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	prediction := &asyncPrediction{authorization: req.Header.Get("Authorization")}
+	// Predictions and trainings can be looked up by ID, but predictions on other models in /models can't
+	if strings.HasPrefix(req.URL.Path, "/predictions") || strings.HasPrefix(req.URL.Path, "/trainings") {
+		result := struct {
+			ID string `json:"id"`
+		}{}
+		if json.Unmarshal(body, &result) == nil {
+			prediction.id = result.ID
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.asyncPredictions = append(p.asyncPredictions, prediction)
+	return nil
+}
+
+// checkAsyncPredictions forgets the async predictions that have completed. While any are running, the backend is
+// active.
+func (p *Proxy) checkAsyncPredictions(ctx context.Context) {
+	p.mu.Lock()
+	target, predictions := p.target, p.asyncPredictions
+	p.mu.Unlock()
+	if target == nil || len(predictions) == 0 {
+		return
+	}
+
+	completed := map[*asyncPrediction]bool{}
+	for _, prediction := range predictions {
+		if !p.isRunning(ctx, target, prediction) {
+			completed[prediction] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	running := []*asyncPrediction{}
+	for _, prediction := range p.asyncPredictions {
+		if !completed[prediction] {
+			running = append(running, prediction)
+		}
+	}
+	p.asyncPredictions = running
+	p.lastActive = p.clock()
+}
+
+// isRunning returns whether an async prediction is still running on the backend. If the backend can't be asked, the
+// prediction is assumed to have completed, so a backend that has stopped responding doesn't run forever.
+func (p *Proxy) isRunning(ctx context.Context, target *url.URL, prediction *asyncPrediction) bool {
+	ctx, cancel := context.WithTimeout(ctx, pollTimeout)
+	defer cancel()
+	path := healthCheckPath
+	if prediction.id != "" {
+		path = "/predictions/" + url.PathEscape(prediction.id)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.JoinPath(path).String(), nil)
+	if err != nil {
+		return false
+	}
+	if prediction.authorization != "" {
+		req.Header.Set("Authorization", prediction.authorization)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	result := struct {
+		Status string `json:"status"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return false
+	}
+	if prediction.id == "" {
+		return result.Status == "BUSY"
+	}
+	switch result.Status {
+	case "succeeded", "failed", "canceled":
+		return false
+	}
+	return true
+}
+
+// handleBackendError responds to requests the backend didn't respond to, and starts it again for the next request
+func (p *Proxy) handleBackendError(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Context().Err() == nil {
+		p.mu.Lock()
+		p.proxy = nil
+		p.broken = true
+		p.asyncPredictions = nil
+		p.mu.Unlock()
+	}
+	http.Error(w, fmt.Sprintf("The model didn't respond: %s", err), http.StatusBadGateway)
+}
+
+func (p *Proxy) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inFlight--
+	p.lastActive = p.clock()
+}
+
+// stopIfIdle stops the backend if it's running, and has had no requests in flight or async predictions running for
+// the timeout
+func (p *Proxy) stopIfIdle(ctx context.Context) error {
+	p.lifecycleMu.Lock()
+	defer p.lifecycleMu.Unlock()
+
+	p.checkAsyncPredictions(ctx)
+
+	p.mu.Lock()
+	idle := p.proxy != nil && p.inFlight == 0 && len(p.asyncPredictions) == 0 && p.clock().Sub(p.lastActive) >= p.timeout
+	if idle {
+		p.proxy = nil
+		p.target = nil
+	}
+	p.mu.Unlock()
+	if !idle {
+		return nil
+	}
+	if err := p.backend.Stop(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		// Stop it again before it's started, or when the proxy exits
+		p.mu.Lock()
+		p.broken = true
+		p.mu.Unlock()
+		return fmt.Errorf("Failed to stop the model: %w", err)
+	}
+	if p.OnStop != nil {
+		p.OnStop()
+	}
+	return nil
+}
+
+// stop stops the backend if it's running
+func (p *Proxy) stop(ctx context.Context) error {
+	p.lifecycleMu.Lock()
+	defer p.lifecycleMu.Unlock()
+
+	p.mu.Lock()
+	running := p.proxy != nil || p.broken
+	p.proxy = nil
+	p.target = nil
+	p.broken = false
+	p.asyncPredictions = nil
+	p.mu.Unlock()
+	if !running {
+		return nil
+	}
+	return p.backend.Stop(ctx)
+}
@@ -0,0 +1,249 @@
+package idleproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	server  *httptest.Server
+	starts  int
+	stops   int
+	err     error
+	stopErr error
+}
+
+func newFakeBackend(t *testing.T) *fakeBackend {
+	b := &fakeBackend{}
+	b.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s from start %d", r.URL.Path, b.starts)
+	}))
+	t.Cleanup(b.server.Close)
+	return b
+}
+
+// newAsyncBackend returns a backend that runs predictions asynchronously, and says the one with the ID "p1", or any
+// without an ID, is running until running is set to false
+func newAsyncBackend(t *testing.T, id string) (*fakeBackend, *atomic.Bool) {
+	running := &atomic.Bool{}
+	running.Store(true)
+	b := &fakeBackend{}
+	b.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/predictions":
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, `{"id": %q, "status": "starting"}`, id)
+		case r.URL.Path == "/predictions/p1":
+			require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			status := "succeeded"
+			if running.Load() {
+				status = "processing"
+			}
+			fmt.Fprintf(w, `{"id": "p1", "status": %q}`, status)
+		case r.URL.Path == healthCheckPath:
+			status := "READY"
+			if running.Load() {
+				status = "BUSY"
+			}
+			fmt.Fprintf(w, `{"status": %q}`, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(b.server.Close)
+	return b, running
+}
+
+func (b *fakeBackend) Start(ctx context.Context) (*url.URL, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	b.starts++
+	return url.Parse(b.server.URL)
+}
+
+func (b *fakeBackend) Stop(ctx context.Context) error {
+	b.stops++
+	return b.stopErr
+}
+
+func get(t *testing.T, p *Proxy, path string) (int, string) {
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	body, err := io.ReadAll(w.Result().Body)
+	require.NoError(t, err)
+	return w.Code, string(body)
+}
+
+func TestProxyStartsAndStopsBackend(t *testing.T) {
+	backend := newFakeBackend(t)
+	now := time.Unix(0, 0)
+	p := New(backend, time.Minute)
+	p.clock = func() time.Time { return now }
+	stopped := 0
+	p.OnStop = func() { stopped++ }
+
+	// Health checks don't start the backend
+	code, body := get(t, p, "/health-check")
+	require.Equal(t, http.StatusOK, code)
+	require.JSONEq(t, `{"status": "READY", "setup": null}`, body)
+	require.Equal(t, 0, backend.starts)
+
+	_, body = get(t, p, "/predictions")
+	require.Equal(t, "/predictions from start 1", body)
+	_, body = get(t, p, "/health-check")
+	require.Equal(t, "/health-check from start 1", body)
+
+	now = now.Add(59 * time.Second)
+	require.NoError(t, p.stopIfIdle(context.Background()))
+	require.Equal(t, 0, backend.stops)
+
+	// Health checks don't count as activity
+	now = now.Add(time.Second)
+	require.NoError(t, p.stopIfIdle(context.Background()))
+	require.Equal(t, 1, backend.stops)
+	require.Equal(t, 1, stopped)
+
+	_, body = get(t, p, "/predictions")
+	require.Equal(t, "/predictions from start 2", body)
+}
+
+func TestProxyDoesNotStopBackendWithRequestsInFlight(t *testing.T) {
+	backend := newFakeBackend(t)
+	now := time.Unix(0, 0)
+	p := New(backend, time.Minute)
+	p.clock = func() time.Time { return now }
+
+	_, err := p.acquire()
+	require.NoError(t, err)
+	now = now.Add(time.Hour)
+	require.NoError(t, p.stopIfIdle(context.Background()))
+	require.Equal(t, 0, backend.stops)
+
+	p.release()
+	now = now.Add(time.Hour)
+	require.NoError(t, p.stopIfIdle(context.Background()))
+	require.Equal(t, 1, backend.stops)
+}
+
+func TestProxyDoesNotStopBackendWithAsyncPredictionsRunning(t *testing.T) {
+	for _, id := range []string{"p1", ""} {
+		backend, running := newAsyncBackend(t, id)
+		now := time.Unix(0, 0)
+		p := New(backend, time.Minute)
+		p.clock = func() time.Time { return now }
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/predictions", strings.NewReader(`{"input": {}}`))
+		r.Header.Set("Prefer", "respond-async")
+		r.Header.Set("Authorization", "Bearer secret")
+		p.ServeHTTP(w, r)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		require.JSONEq(t, fmt.Sprintf(`{"id": %q, "status": "starting"}`, id), w.Body.String())
+
+		now = now.Add(time.Hour)
+		require.NoError(t, p.stopIfIdle(context.Background()))
+		require.Equal(t, 0, backend.stops)
+
+		// It's idle for the timeout after the prediction completes
+		running.Store(false)
+		require.NoError(t, p.stopIfIdle(context.Background()))
+		require.Equal(t, 0, backend.stops)
+		now = now.Add(time.Minute)
+		require.NoError(t, p.stopIfIdle(context.Background()))
+		require.Equal(t, 1, backend.stops)
+	}
+}
+
+func TestProxyBackendFailsToStart(t *testing.T) {
+	backend := newFakeBackend(t)
+	backend.err = errors.New("Model setup failed")
+	p := New(backend, time.Minute)
+
+	code, body := get(t, p, "/predictions")
+	require.Equal(t, http.StatusBadGateway, code)
+	require.Contains(t, body, "Failed to start the model: Model setup failed")
+
+	backend.err = nil
+	_, body = get(t, p, "/predictions")
+	require.Equal(t, "/predictions from start 1", body)
+}
+
+func TestProxyRestartsBackendThatStoppedResponding(t *testing.T) {
+	backend := newFakeBackend(t)
+	p := New(backend, time.Minute)
+	_, body := get(t, p, "/predictions")
+	require.Equal(t, "/predictions from start 1", body)
+
+	backend.server.Close()
+	code, _ := get(t, p, "/predictions")
+	require.Equal(t, http.StatusBadGateway, code)
+
+	backend.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "restarted")
+	}))
+	defer backend.server.Close()
+	_, body = get(t, p, "/predictions")
+	require.Equal(t, "restarted", body)
+	require.Equal(t, 2, backend.starts)
+	require.Equal(t, 1, backend.stops)
+}
+
+func TestProxyServeStopsBackend(t *testing.T) {
+	backend := newFakeBackend(t)
+	p := New(backend, time.Minute)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.Serve(ctx, l)
+	}()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/predictions")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "/predictions from start 1", string(body))
+
+	cancel()
+	require.NoError(t, <-errs)
+	require.Equal(t, 1, backend.stops)
+}
+
+func TestProxyServeClosesServerWhenStopFails(t *testing.T) {
+	backend := newFakeBackend(t)
+	backend.stopErr = errors.New("docker isn't running")
+	p := New(backend, time.Millisecond)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- p.Serve(context.Background(), l)
+	}()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/predictions")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	require.ErrorContains(t, <-errs, "Failed to stop the model: docker isn't running")
+	// The server is closed, and stopping the model is tried again
+	_, err = http.Get("http://" + l.Addr().String() + "/predictions")
+	require.Error(t, err)
+	require.Equal(t, 2, backend.stops)
+}
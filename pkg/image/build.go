@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,48 +17,84 @@ import (
 	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
 
+	"github.com/replicate/cog/pkg/ci"
 	"github.com/replicate/cog/pkg/config"
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/dockerfile"
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/examples"
 	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/modelcard"
+	"github.com/replicate/cog/pkg/provenance"
+	"github.com/replicate/cog/pkg/registry"
 	"github.com/replicate/cog/pkg/util/console"
 	"github.com/replicate/cog/pkg/weights"
 )
 
 const dockerignoreBackupPath = ".dockerignore.cog.bak"
 const weightsManifestPath = ".cog/cache/weights_manifest.json"
-const bundledSchemaFile = ".cog/openapi_schema.json"
-const bundledSchemaPy = ".cog/schema.py"
+const bundledSchemaFile = "openapi_schema.json"
+const bundledSchemaPy = "schema.py"
+const bundledModelCardFile = "model_card.md"
 
 var errGit = errors.New("git error")
 
-// Build a Cog model from a config
+// Build a Cog model from a config. buildArgs are the build args passed with --build-arg, in the form KEY=VALUE.
 //
 // This is separated out from docker.Build(), so that can be as close as possible to the behavior of 'docker build'.
-func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache, separateWeights bool, useCudaBaseImage string, progressOutput string, schemaFile string, dockerfileFile string, useCogBaseImage *bool, strip bool, precompile bool, fastFlag bool) error {
+func Build(ctx context.Context, cfg *config.Config, dir, imageName string, secrets []string, buildArgs []string, noCache, separateWeights bool, useCudaBaseImage string, progressOutput string, schemaFile string, dockerfileFile string, useCogBaseImage *bool, strip bool, precompile bool, fastFlag bool, pinBaseImage bool) error {
+	if cfg.PipelineOfImages() {
+		return config.ErrPipelineOfImages
+	}
+	// Check the predictor before the build, which can take a while, so mistakes in it fail quickly
+	if err := cfg.ValidatePredictor(dir); err != nil {
+		return err
+	}
+
+	startedOn := time.Now()
 	console.Infof("Building Docker image from environment in cog.yaml as %s...", imageName)
 	if fastFlag {
 		console.Info("Fast build enabled.")
 	}
 
-	// remove bundled schema files that may be left from previous builds
-	_ = os.Remove(bundledSchemaFile)
-	_ = os.Remove(bundledSchemaPy)
+	// remove bundled schema files that previous versions of Cog left in .cog/
+	_ = os.Remove(filepath.Join(dir, ".cog", bundledSchemaFile))
+	_ = os.Remove(filepath.Join(dir, ".cog", bundledSchemaPy))
+	_ = os.Remove(filepath.Join(dir, ".cog", bundledModelCardFile))
+
+	// The files that are bundled into the image are in a directory of their own, so builds running at the same time
+	// in the project don't overwrite each other's
+	bundleDir, err := dockerfile.BuildTempDir(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(bundleDir)
+
+	fetchedWeights, err := FetchWeights(ctx, cfg, dir)
+	if err != nil {
+		return buildError(cogerrors.BuildStageWeights, fmt.Errorf("Failed to download weights: %w", err))
+	}
 
 	var cogBaseImageName string
+	// pinnedBaseImage is the base image pinned to a digest, if it's pinned in the build manifest
+	var pinnedBaseImage string
+	manifest, err := LoadBuildManifest(dir)
+	if err != nil {
+		return buildError(cogerrors.BuildStageDockerfile, err)
+	}
 
 	if dockerfileFile != "" {
 		dockerfileContents, err := os.ReadFile(dockerfileFile)
 		if err != nil {
 			return fmt.Errorf("Failed to read Dockerfile at %s: %w", dockerfileFile, err)
 		}
-		if err := docker.Build(dir, string(dockerfileContents), imageName, secrets, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
+		if err := docker.Build(ctx, dir, string(dockerfileContents), imageName, secrets, buildArgs, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
 			return fmt.Errorf("Failed to build Docker image: %w", err)
 		}
 	} else {
 		generator, err := dockerfile.NewGenerator(cfg, dir, fastFlag)
 		if err != nil {
-			return fmt.Errorf("Error creating Dockerfile generator: %w", err)
+			return buildError(cogerrors.BuildStageDockerfile, fmt.Errorf("Error creating Dockerfile generator: %w", err))
 		}
 		defer func() {
 			if err := generator.Cleanup(); err != nil {
@@ -69,6 +107,7 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		if useCogBaseImage != nil {
 			generator.SetUseCogBaseImage(*useCogBaseImage)
 		}
+		generator.SetBaseImageDigests(manifest.BaseImages)
 
 		if generator.IsUsingCogBaseImage() {
 			cogBaseImageName, err = generator.BaseImage()
@@ -76,49 +115,42 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 				return fmt.Errorf("Failed to get cog base image name: %s", err)
 			}
 		}
-
-		if separateWeights {
-			weightsDockerfile, runnerDockerfile, dockerignore, err := generator.GenerateModelBaseWithSeparateWeights(imageName)
+		// The base image of build.dockerfile is pinned in the Dockerfile, if it's pinned
+		if !fastFlag && cfg.Build.Dockerfile == "" {
+			pinnedBaseImage, err = resolvePinnedBaseImage(ctx, generator, manifest, dir, pinBaseImage)
 			if err != nil {
-				return fmt.Errorf("Failed to generate Dockerfile: %w", err)
-			}
-
-			if err := backupDockerignore(); err != nil {
-				return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
+				return buildError(cogerrors.BuildStageDockerfile, err)
 			}
+		}
 
-			weightsManifest, err := generator.GenerateWeightsManifest()
-			if err != nil {
-				return fmt.Errorf("Failed to generate weights manifest: %w", err)
+		if separateWeights {
+			if err := buildWithSeparateWeights(ctx, generator, dir, imageName, secrets, buildArgs, noCache, progressOutput); err != nil {
+				return err
 			}
-			cachedManifest, _ := weights.LoadManifest(weightsManifestPath)
-			changed := cachedManifest == nil || !weightsManifest.Equal(cachedManifest)
-			if changed {
-				if err := buildWeightsImage(dir, weightsDockerfile, imageName+"-weights", secrets, noCache, progressOutput); err != nil {
-					return fmt.Errorf("Failed to build model weights Docker image: %w", err)
-				}
-				err := weightsManifest.Save(weightsManifestPath)
+		} else {
+			if fastFlag {
+				// The fast generator keeps the build's files in .cog/tmp between builds, so builds in the project
+				// take turns
+				unlock, err := lockState(ctx, dir)
 				if err != nil {
-					return fmt.Errorf("Failed to save weights hash: %w", err)
+					return err
 				}
-			} else {
-				console.Info("Weights unchanged, skip rebuilding and use cached image...")
-			}
-
-			if err := buildRunnerImage(dir, runnerDockerfile, dockerignore, imageName, secrets, noCache, progressOutput); err != nil {
-				return fmt.Errorf("Failed to build runner Docker image: %w", err)
+				defer unlock()
 			}
-		} else {
 			dockerfileContents, err := generator.GenerateDockerfileWithoutSeparateWeights()
 			if err != nil {
-				return fmt.Errorf("Failed to generate Dockerfile: %w", err)
+				return buildError(cogerrors.BuildStageDockerfile, fmt.Errorf("Failed to generate Dockerfile: %w", err))
 			}
-			if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
+			if err := docker.Build(ctx, dir, dockerfileContents, imageName, secrets, buildArgs, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
 				return fmt.Errorf("Failed to build Docker image: %w", err)
 			}
 		}
 	}
 
+	if schemaFile == "" && cfg.Runner != nil && cfg.Runner.Schema != "" {
+		schemaFile = filepath.Join(dir, cfg.Runner.Schema)
+	}
+
 	var schemaJSON []byte
 	if schemaFile != "" {
 		console.Infof("Validating model schema from %s...", schemaFile)
@@ -130,9 +162,15 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		schemaJSON = data
 	} else {
 		console.Info("Validating model schema...")
-		schema, err := GenerateOpenAPISchema(imageName, cfg.Build.GPU)
+		endGroup := ci.StartGroup(ctx, "Validate model schema")
+		generate := GenerateOpenAPISchema
+		if cfg.UsesRunner() {
+			generate = GenerateOpenAPISchemaFromServer
+		}
+		schema, err := generate(ctx, imageName, cfg.Build.GPU)
+		endGroup()
 		if err != nil {
-			return fmt.Errorf("Failed to get type signature: %w", err)
+			return buildError(cogerrors.BuildStageSchema, fmt.Errorf("Failed to get type signature: %w", err))
 		}
 
 		data, err := json.Marshal(schema)
@@ -144,7 +182,7 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 	}
 
 	// save open_api schema file
-	err := os.WriteFile(bundledSchemaFile, schemaJSON, 0o644)
+	err = os.WriteFile(filepath.Join(bundleDir, bundledSchemaFile), schemaJSON, 0o644)
 	if err != nil {
 		return fmt.Errorf("failed to store bundled schema file %s: %w", bundledSchemaFile, err)
 	}
@@ -153,11 +191,29 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 	loader.IsExternalRefsAllowed = true
 	doc, err := loader.LoadFromData(schemaJSON)
 	if err != nil {
-		return fmt.Errorf("Failed to load model schema JSON: %w", err)
+		return buildError(cogerrors.BuildStageSchema, fmt.Errorf("Failed to load model schema JSON: %w", err))
 	}
 	err = doc.Validate(loader.Context)
 	if err != nil {
-		return fmt.Errorf("Model schema is invalid: %w\n\n%s", err, string(schemaJSON))
+		return buildError(cogerrors.BuildStageSchema, fmt.Errorf("Model schema is invalid: %w\n\n%s", err, string(schemaJSON)))
+	}
+
+	savedExamples, err := examples.Load(dir)
+	if err != nil {
+		return fmt.Errorf("Failed to load examples: %w", err)
+	}
+
+	license := modelcard.DetectLicense(dir)
+	card := modelcard.Card{
+		Name:           imageName,
+		Config:         cfg,
+		Schema:         doc,
+		PythonPackages: cfg.PythonPackages(),
+		License:        license,
+		Examples:       savedExamples,
+	}
+	if err := os.WriteFile(filepath.Join(bundleDir, bundledModelCardFile), []byte(card.Render()), 0o644); err != nil {
+		return fmt.Errorf("Failed to store model card %s: %w", bundledModelCardFile, err)
 	}
 
 	console.Info("Adding labels to image...")
@@ -170,9 +226,9 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		return fmt.Errorf("Failed to convert config to JSON: %w", err)
 	}
 
-	pipFreeze, err := GeneratePipFreeze(imageName)
+	pipFreeze, err := GeneratePipFreeze(ctx, imageName)
 	if err != nil {
-		return fmt.Errorf("Failed to generate pip freeze from image: %w", err)
+		return buildError(cogerrors.BuildStageLabels, fmt.Errorf("Failed to generate pip freeze from image: %w", err))
 	}
 
 	labels := map[string]string{
@@ -185,15 +241,40 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		global.LabelNamespace + "has_init": "true",
 	}
 
+	if license != "" && !strings.HasPrefix(license, "See ") {
+		labels["org.opencontainers.image.licenses"] = license
+	}
+
+	if len(savedExamples) > 0 {
+		examplesJSON, err := json.Marshal(savedExamples)
+		if err != nil {
+			return fmt.Errorf("Failed to convert examples to JSON: %w", err)
+		}
+		labels[global.LabelNamespace+"examples"] = string(examplesJSON)
+	}
+
+	if len(fetchedWeights) > 0 {
+		weightsJSON, err := json.Marshal(fetchedWeights)
+		if err != nil {
+			return fmt.Errorf("Failed to convert weights to JSON: %w", err)
+		}
+		labels[global.LabelNamespace+"weights"] = string(weightsJSON)
+	}
+
+	if pinnedBaseImage != "" {
+		labels[global.LabelNamespace+"base-image"] = pinnedBaseImage
+	}
+
 	if cogBaseImageName != "" {
 		labels[global.LabelNamespace+"cog-base-image-name"] = cogBaseImageName
 
-		ref, err := name.ParseReference(cogBaseImageName)
+		// Get the layers of the base image that was built on, which is the pinned one if it's pinned
+		ref, err := name.ParseReference(dockerfile.PinnedImage(cogBaseImageName, manifest.BaseImages))
 		if err != nil {
 			return fmt.Errorf("Failed to parse cog base image reference: %w", err)
 		}
 
-		img, err := remote.Image(ref)
+		img, err := remote.Image(ref, remote.WithContext(ctx))
 		if err != nil {
 			return fmt.Errorf("Failed to fetch cog base image: %w", err)
 		}
@@ -232,21 +313,94 @@ func Build(cfg *config.Config, dir, imageName string, secrets []string, noCache,
 		console.Info("Unable to determine Git tag")
 	}
 
-	if err := docker.BuildAddLabelsAndSchemaToImage(imageName, labels, bundledSchemaFile, bundledSchemaPy); err != nil {
-		return fmt.Errorf("Failed to add labels to image: %w", err)
+	baseImages := []string{pinnedBaseImage}
+	if cogBaseImageName != "" {
+		if pinned := dockerfile.PinnedImage(cogBaseImageName, manifest.BaseImages); pinned != pinnedBaseImage {
+			baseImages = append(baseImages, pinned)
+		}
+	}
+	predicateJSON, err := buildProvenance(cfg, dir, imageName, baseImages, fetchedWeights, startedOn)
+	if err != nil {
+		return fmt.Errorf("Failed to record provenance: %w", err)
+	}
+	labels[provenance.Label] = predicateJSON
+
+	relBundleDir, err := filepath.Rel(dir, bundleDir)
+	if err != nil {
+		return err
+	}
+	relBundleDir = filepath.ToSlash(relBundleDir)
+	if err := docker.BuildAddLabelsAndSchemaToImage(ctx, dir, imageName, labels, path.Join(relBundleDir, bundledSchemaFile), path.Join(relBundleDir, bundledSchemaPy), path.Join(relBundleDir, bundledModelCardFile)); err != nil {
+		return buildError(cogerrors.BuildStageLabels, fmt.Errorf("Failed to add labels to image: %w", err))
 	}
 	return nil
 }
 
-func BuildBase(cfg *config.Config, dir string, useCudaBaseImage string, useCogBaseImage *bool, progressOutput string) (string, error) {
+// buildWithSeparateWeights builds the model's weights into their own image, if they've changed, then builds the rest
+// of the model on top of it
+func buildWithSeparateWeights(ctx context.Context, generator dockerfile.Generator, dir, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string) error {
+	weightsDockerfile, runnerDockerfile, dockerignore, err := generator.GenerateModelBaseWithSeparateWeights(imageName)
+	if err != nil {
+		return buildError(cogerrors.BuildStageDockerfile, fmt.Errorf("Failed to generate Dockerfile: %w", err))
+	}
+
+	// The build's .dockerignore replaces the project's, and the weights manifest is shared, so builds in the project
+	// take turns
+	unlock, err := lockState(ctx, dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := backupDockerignore(dir); err != nil {
+		return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
+	}
+	// Restore it even if the build fails or is interrupted, so the project isn't left with the build's
+	// .dockerignore
+	defer func() {
+		if err := restoreDockerignore(dir); err != nil {
+			console.Warnf("Failed to restore backup .dockerignore file: %s", err)
+		}
+	}()
+
+	weightsManifest, err := generator.GenerateWeightsManifest()
+	if err != nil {
+		return fmt.Errorf("Failed to generate weights manifest: %w", err)
+	}
+	cachedManifest, _ := weights.LoadManifest(filepath.Join(dir, weightsManifestPath))
+	changed := cachedManifest == nil || !weightsManifest.Equal(cachedManifest)
+	if changed {
+		if err := buildWeightsImage(ctx, dir, weightsDockerfile, imageName+"-weights", secrets, buildArgs, noCache, progressOutput); err != nil {
+			return fmt.Errorf("Failed to build model weights Docker image: %w", err)
+		}
+		err := weightsManifest.Save(filepath.Join(dir, weightsManifestPath))
+		if err != nil {
+			return fmt.Errorf("Failed to save weights hash: %w", err)
+		}
+	} else {
+		console.Info("Weights unchanged, skip rebuilding and use cached image...")
+	}
+
+	if err := buildRunnerImage(ctx, dir, runnerDockerfile, dockerignore, imageName, secrets, buildArgs, noCache, progressOutput); err != nil {
+		return fmt.Errorf("Failed to build runner Docker image: %w", err)
+	}
+	return nil
+}
+
+func BuildBase(ctx context.Context, cfg *config.Config, dir string, useCudaBaseImage string, useCogBaseImage *bool, progressOutput string) (string, error) {
 	// TODO: better image management so we don't eat up disk space
 	// https://github.com/replicate/cog/issues/80
 	imageName := config.BaseDockerImageName(dir)
 
+	// The project is mounted into the container, so the weights need to be in it
+	if _, err := FetchWeights(ctx, cfg, dir); err != nil {
+		return "", buildError(cogerrors.BuildStageWeights, fmt.Errorf("Failed to download weights: %w", err))
+	}
+
 	console.Info("Building Docker image from environment in cog.yaml...")
 	generator, err := dockerfile.NewGenerator(cfg, dir, false)
 	if err != nil {
-		return "", fmt.Errorf("Error creating Dockerfile generator: %w", err)
+		return "", buildError(cogerrors.BuildStageDockerfile, fmt.Errorf("Error creating Dockerfile generator: %w", err))
 	}
 	defer func() {
 		if err := generator.Cleanup(); err != nil {
@@ -258,17 +412,74 @@ func BuildBase(cfg *config.Config, dir string, useCudaBaseImage string, useCogBa
 	if useCogBaseImage != nil {
 		generator.SetUseCogBaseImage(*useCogBaseImage)
 	}
+	manifest, err := LoadBuildManifest(dir)
+	if err != nil {
+		return "", buildError(cogerrors.BuildStageDockerfile, err)
+	}
+	generator.SetBaseImageDigests(manifest.BaseImages)
 
 	dockerfileContents, err := generator.GenerateModelBase()
 	if err != nil {
-		return "", fmt.Errorf("Failed to generate Dockerfile: %w", err)
+		return "", buildError(cogerrors.BuildStageDockerfile, fmt.Errorf("Failed to generate Dockerfile: %w", err))
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, []string{}, false, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
+	if err := docker.Build(ctx, dir, dockerfileContents, imageName, []string{}, nil, false, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
 		return "", fmt.Errorf("Failed to build Docker image: %w", err)
 	}
 	return imageName, nil
 }
 
+// resolvePinnedBaseImage returns the generator's base image pinned to its digest in the build manifest, or "" if it
+// isn't pinned. If it isn't pinned yet and pin is true, it's pinned to the digest its tag points to now, so later
+// builds use the same base image rather than whatever the tag points to then.
+func resolvePinnedBaseImage(ctx context.Context, generator dockerfile.Generator, manifest *BuildManifest, dir string, pin bool) (string, error) {
+	baseImage, err := generator.BaseImage()
+	if err != nil {
+		return "", fmt.Errorf("Failed to get base image name: %w", err)
+	}
+	if _, ok := manifest.BaseImages[baseImage]; !ok && pin {
+		digest, err := registry.ResolveDigest(ctx, baseImage)
+		switch {
+		case ctx.Err() != nil:
+			return "", ctx.Err()
+		case err != nil:
+			// Building offline with a base image Docker already has still works, it just isn't pinned
+			console.Warnf("Failed to pin base image %s to a digest, so it might change between builds: %s", baseImage, err)
+		default:
+			pinned := false
+			updated, err := updateBuildManifest(ctx, dir, func(m *BuildManifest) bool {
+				// Another build in the project might have pinned it since the manifest was loaded
+				if _, ok := m.BaseImages[baseImage]; ok {
+					return false
+				}
+				pinned = m.PinBaseImage(baseImage, digest) != nil
+				return pinned
+			})
+			if err != nil {
+				return "", err
+			}
+			*manifest = *updated
+			generator.SetBaseImageDigests(manifest.BaseImages)
+			if pinned {
+				console.Infof("Pinned base image %s to %s in %s", baseImage, digest, BuildManifestPath)
+			}
+		}
+	}
+	pinned := dockerfile.PinnedImage(baseImage, manifest.BaseImages)
+	if pinned == baseImage {
+		return "", nil
+	}
+	console.Infof("Using base image %s", pinned)
+	return pinned, nil
+}
+
+// buildError records the stage of the build that err happened in, so the CLI can say how to fix it
+func buildError(stage string, err error) error {
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &cogerrors.BuildError{Stage: stage, Err: err}
+}
+
 func isGitWorkTree(dir string) bool {
 	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
 	defer cancel()
@@ -321,55 +532,54 @@ func gitTag(dir string) (string, error) {
 	return "", fmt.Errorf("Failed to find ref name: %w", errGit)
 }
 
-func buildWeightsImage(dir, dockerfileContents, imageName string, secrets []string, noCache bool, progressOutput string) error {
-	if err := makeDockerignoreForWeightsImage(); err != nil {
+func buildWeightsImage(ctx context.Context, dir, dockerfileContents, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string) error {
+	if err := makeDockerignoreForWeightsImage(dir); err != nil {
 		return fmt.Errorf("Failed to create .dockerignore file: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
+	if err := docker.Build(ctx, dir, dockerfileContents, imageName, secrets, buildArgs, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
 		return fmt.Errorf("Failed to build Docker image for model weights: %w", err)
 	}
 	return nil
 }
 
-func buildRunnerImage(dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, noCache bool, progressOutput string) error {
-	if err := writeDockerignore(dockerignoreContents); err != nil {
+func buildRunnerImage(ctx context.Context, dir, dockerfileContents, dockerignoreContents, imageName string, secrets []string, buildArgs []string, noCache bool, progressOutput string) error {
+	if err := writeDockerignore(dir, dockerignoreContents); err != nil {
 		return fmt.Errorf("Failed to write .dockerignore file with weights included: %w", err)
 	}
-	if err := docker.Build(dir, dockerfileContents, imageName, secrets, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
+	if err := docker.Build(ctx, dir, dockerfileContents, imageName, secrets, buildArgs, noCache, progressOutput, config.BuildSourceEpochTimestamp); err != nil {
 		return fmt.Errorf("Failed to build Docker image: %w", err)
 	}
-	if err := restoreDockerignore(); err != nil {
-		return fmt.Errorf("Failed to restore backup .dockerignore file: %w", err)
-	}
 	return nil
 }
 
-func makeDockerignoreForWeightsImage() error {
-	if err := backupDockerignore(); err != nil {
+func makeDockerignoreForWeightsImage(dir string) error {
+	if err := backupDockerignore(dir); err != nil {
 		return fmt.Errorf("Failed to backup .dockerignore file: %w", err)
 	}
 
-	if err := writeDockerignore(dockerfile.DockerignoreHeader); err != nil {
+	if err := writeDockerignore(dir, dockerfile.DockerignoreHeader); err != nil {
 		return fmt.Errorf("Failed to write .dockerignore file: %w", err)
 	}
 	return nil
 }
 
-func writeDockerignore(contents string) error {
+func writeDockerignore(dir string, contents string) error {
 	// read existing file contents from .dockerignore.cog.bak if it exists, and append to the new contents
-	if _, err := os.Stat(dockerignoreBackupPath); err == nil {
-		existingContents, err := os.ReadFile(dockerignoreBackupPath)
+	backupPath := filepath.Join(dir, dockerignoreBackupPath)
+	if _, err := os.Stat(backupPath); err == nil {
+		existingContents, err := os.ReadFile(backupPath)
 		if err != nil {
 			return err
 		}
 		contents = string(existingContents) + "\n" + contents
 	}
 
-	return os.WriteFile(".dockerignore", []byte(contents), 0o644)
+	return os.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(contents), 0o644)
 }
 
-func backupDockerignore() error {
-	if _, err := os.Stat(".dockerignore"); err != nil {
+func backupDockerignore(dir string) error {
+	path := filepath.Join(dir, ".dockerignore")
+	if _, err := os.Stat(path); err != nil {
 		if os.IsNotExist(err) {
 			// .dockerignore file does not exist, nothing to backup
 			return nil
@@ -378,15 +588,17 @@ func backupDockerignore() error {
 	}
 
 	// rename the .dockerignore file to a new name
-	return os.Rename(".dockerignore", dockerignoreBackupPath)
+	return os.Rename(path, filepath.Join(dir, dockerignoreBackupPath))
 }
 
-func restoreDockerignore() error {
-	if err := os.Remove(".dockerignore"); err != nil {
+func restoreDockerignore(dir string) error {
+	path := filepath.Join(dir, ".dockerignore")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 
-	if _, err := os.Stat(dockerignoreBackupPath); err != nil {
+	backupPath := filepath.Join(dir, dockerignoreBackupPath)
+	if _, err := os.Stat(backupPath); err != nil {
 		if os.IsNotExist(err) {
 			// .dockerignore backup file does not exist, nothing to restore
 			return nil
@@ -394,5 +606,5 @@ func restoreDockerignore() error {
 		return err
 	}
 
-	return os.Rename(dockerignoreBackupPath, ".dockerignore")
+	return os.Rename(backupPath, path)
 }
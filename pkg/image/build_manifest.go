@@ -0,0 +1,144 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/registry"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// BuildManifestPath is where the build manifest is saved, relative to the project. Commit it to build with the same
+// base images everywhere.
+const BuildManifestPath = ".cog/build_manifest.json"
+
+// BuildManifest records how a model is built, so later builds are the same
+type BuildManifest struct {
+	// BaseImages are the digests base images are pinned to, by tag
+	BaseImages map[string]string `json:"base_images"`
+	// BaseImageUpdates are the changes to the pinned base images, oldest first
+	BaseImageUpdates []BaseImageUpdate `json:"base_image_updates,omitempty"`
+}
+
+// BaseImageUpdate is a base image being pinned to a new digest
+type BaseImageUpdate struct {
+	Image string `json:"image"`
+	// OldDigest is the digest it was pinned to before, or "" if it wasn't pinned
+	OldDigest string    `json:"old_digest,omitempty"`
+	NewDigest string    `json:"new_digest"`
+	Time      time.Time `json:"time"`
+}
+
+// LoadBuildManifest loads the build manifest in a project, or returns an empty one if there isn't one
+func LoadBuildManifest(dir string) (*BuildManifest, error) {
+	m := &BuildManifest{BaseImages: map[string]string{}}
+	contents, err := os.ReadFile(filepath.Join(dir, BuildManifestPath))
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read build manifest: %w", err)
+	}
+	if err := json.Unmarshal(contents, m); err != nil {
+		return nil, fmt.Errorf("Failed to parse build manifest %s: %w", BuildManifestPath, err)
+	}
+	if m.BaseImages == nil {
+		m.BaseImages = map[string]string{}
+	}
+	return m, nil
+}
+
+// Save saves the build manifest in a project
+func (m *BuildManifest) Save(dir string) error {
+	contents, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, BuildManifestPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("Failed to save build manifest: %w", err)
+	}
+	// Write it atomically, so other Cog commands in the project never read part of it
+	if err := files.WriteFileAtomic(path, append(contents, '\n'), 0o644); err != nil {
+		return fmt.Errorf("Failed to save build manifest: %w", err)
+	}
+	return nil
+}
+
+// PinBaseImage pins a base image to a digest, and records the update if it changed. It returns the update, or nil
+// if it was already pinned to the digest.
+func (m *BuildManifest) PinBaseImage(image string, digest string) *BaseImageUpdate {
+	old := m.BaseImages[image]
+	if old == digest {
+		return nil
+	}
+	m.BaseImages[image] = digest
+	update := BaseImageUpdate{Image: image, OldDigest: old, NewDigest: digest, Time: time.Now().UTC()}
+	m.BaseImageUpdates = append(m.BaseImageUpdates, update)
+	return &update
+}
+
+// UpdateBaseImage pins a model's base image to the digest its tag points to now, so the next build uses the newest
+// version of it, with any security fixes. It returns the update, or nil if it was already pinned to the newest version,
+// and the base image.
+func UpdateBaseImage(ctx context.Context, cfg *config.Config, dir string, useCudaBaseImage string, useCogBaseImage *bool) (*BaseImageUpdate, string, error) {
+	generator, err := dockerfile.NewGenerator(cfg, dir, false)
+	if err != nil {
+		return nil, "", fmt.Errorf("Error creating Dockerfile generator: %w", err)
+	}
+	defer func() {
+		if err := generator.Cleanup(); err != nil {
+			console.Warnf("Error cleaning up Dockerfile generator: %s", err)
+		}
+	}()
+	generator.SetUseCudaBaseImage(useCudaBaseImage)
+	if useCogBaseImage != nil {
+		generator.SetUseCogBaseImage(*useCogBaseImage)
+	}
+	baseImage, err := generator.BaseImage()
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to get base image name: %w", err)
+	}
+
+	console.Infof("Checking for a newer version of %s...", baseImage)
+	digest, err := registry.ResolveDigest(ctx, baseImage)
+	if err != nil {
+		return nil, "", err
+	}
+	var update *BaseImageUpdate
+	if _, err := updateBuildManifest(ctx, dir, func(manifest *BuildManifest) bool {
+		update = manifest.PinBaseImage(baseImage, digest)
+		return update != nil
+	}); err != nil {
+		return nil, "", err
+	}
+	return update, baseImage, nil
+}
+
+// updateBuildManifest loads the build manifest in a project, changes it with update, and saves it if update returns
+// true. The project's state is locked while it does, so builds running at the same time don't lose each other's
+// changes. It returns the manifest.
+func updateBuildManifest(ctx context.Context, dir string, update func(manifest *BuildManifest) bool) (*BuildManifest, error) {
+	unlock, err := lockState(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	manifest, err := LoadBuildManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if update(manifest) {
+		if err := manifest.Save(dir); err != nil {
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
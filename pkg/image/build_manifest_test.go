@@ -0,0 +1,151 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+// stubGenerator is a generator with a base image of its own
+type stubGenerator struct {
+	dockerfile.Generator
+	baseImage string
+	digests   map[string]string
+}
+
+func (g *stubGenerator) BaseImage() (string, error) {
+	return g.baseImage, nil
+}
+
+func (g *stubGenerator) SetBaseImageDigests(digests map[string]string) {
+	g.digests = digests
+}
+
+// pushBaseImage pushes a random image to a test registry, and returns its name and digest
+func pushBaseImage(t *testing.T) (string, string) {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	imageName := strings.Replace(strings.TrimPrefix(server.URL, "http://"), "127.0.0.1", "localhost", 1) + "/python:3.12-slim"
+	img, err := random.Image(100, 1)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(imageName)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	return imageName, digest.String()
+}
+
+func TestBuildManifest(t *testing.T) {
+	dir := t.TempDir()
+	manifest, err := LoadBuildManifest(dir)
+	require.NoError(t, err)
+	require.Empty(t, manifest.BaseImages)
+
+	update := manifest.PinBaseImage("python:3.12-slim", "sha256:abc123")
+	require.NotNil(t, update)
+	require.Equal(t, "", update.OldDigest)
+	require.Nil(t, manifest.PinBaseImage("python:3.12-slim", "sha256:abc123"))
+	update = manifest.PinBaseImage("python:3.12-slim", "sha256:def456")
+	require.NotNil(t, update)
+	require.Equal(t, "sha256:abc123", update.OldDigest)
+	require.Equal(t, "sha256:def456", update.NewDigest)
+	require.NoError(t, manifest.Save(dir))
+
+	manifest, err = LoadBuildManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"python:3.12-slim": "sha256:def456"}, manifest.BaseImages)
+	require.Len(t, manifest.BaseImageUpdates, 2)
+	require.Equal(t, "sha256:def456", manifest.BaseImageUpdates[1].NewDigest)
+}
+
+func TestResolvePinnedBaseImage(t *testing.T) {
+	baseImage, digest := pushBaseImage(t)
+	dir := t.TempDir()
+	manifest, err := LoadBuildManifest(dir)
+	require.NoError(t, err)
+	generator := &stubGenerator{baseImage: baseImage}
+
+	pinned, err := resolvePinnedBaseImage(context.Background(), generator, manifest, dir, true)
+	require.NoError(t, err)
+	require.Equal(t, baseImage+"@"+digest, pinned)
+	require.Equal(t, digest, generator.digests[baseImage])
+
+	manifest, err = LoadBuildManifest(dir)
+	require.NoError(t, err)
+	require.Equal(t, digest, manifest.BaseImages[baseImage])
+}
+
+func TestResolvePinnedBaseImageReusesPin(t *testing.T) {
+	baseImage, _ := pushBaseImage(t)
+	dir := t.TempDir()
+	manifest, err := LoadBuildManifest(dir)
+	require.NoError(t, err)
+	manifest.PinBaseImage(baseImage, "sha256:abc123")
+
+	// The tag points to a different image now, but the build still uses the pinned one
+	pinned, err := resolvePinnedBaseImage(context.Background(), &stubGenerator{baseImage: baseImage}, manifest, dir, true)
+	require.NoError(t, err)
+	require.Equal(t, baseImage+"@sha256:abc123", pinned)
+}
+
+func TestResolvePinnedBaseImageWithoutPinning(t *testing.T) {
+	baseImage, _ := pushBaseImage(t)
+	dir := t.TempDir()
+	manifest, err := LoadBuildManifest(dir)
+	require.NoError(t, err)
+
+	pinned, err := resolvePinnedBaseImage(context.Background(), &stubGenerator{baseImage: baseImage}, manifest, dir, false)
+	require.NoError(t, err)
+	require.Equal(t, "", pinned)
+	require.Empty(t, manifest.BaseImages)
+}
+
+func TestResolvePinnedBaseImageOffline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	manifest, err := LoadBuildManifest(dir)
+	require.NoError(t, err)
+
+	// A registry that can't be reached doesn't stop the build
+	pinned, err := resolvePinnedBaseImage(context.Background(), &stubGenerator{baseImage: "localhost:1/python:3.12-slim"}, manifest, dir, true)
+	require.NoError(t, err)
+	require.Equal(t, "", pinned)
+}
+
+func TestUpdateBuildManifestConcurrently(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := updateBuildManifest(context.Background(), dir, func(m *BuildManifest) bool {
+				return m.PinBaseImage(fmt.Sprintf("python:3.%d-slim", i), "sha256:abc123") != nil
+			})
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	// Each update is made to the manifest the one before it saved, so none are lost
+	manifest, err := LoadBuildManifest(dir)
+	require.NoError(t, err)
+	require.Len(t, manifest.BaseImages, 10)
+	require.Len(t, manifest.BaseImageUpdates, 10)
+}
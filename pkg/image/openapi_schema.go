@@ -2,19 +2,26 @@ package image
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/getkin/kin-openapi/openapi3"
 
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/predict"
 	"github.com/replicate/cog/pkg/util/console"
 )
 
+// serverSchemaTimeout is how long to wait for a runner's server to start when getting its schema
+const serverSchemaTimeout = 5 * time.Minute
+
 // GenerateOpenAPISchema by running the image and executing Cog
 // This will be run as part of the build process then added as a label to the image. It can be retrieved more efficiently with the label by using GetOpenAPISchema
-func GenerateOpenAPISchema(imageName string, enableGPU bool) (map[string]any, error) {
+func GenerateOpenAPISchema(ctx context.Context, imageName string, enableGPU bool) (map[string]any, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
@@ -24,7 +31,7 @@ func GenerateOpenAPISchema(imageName string, enableGPU bool) (map[string]any, er
 		gpus = "all"
 	}
 
-	err := docker.RunWithIO(docker.RunOptions{
+	err := docker.RunWithIO(ctx, docker.RunOptions{
 		Image: imageName,
 		Args: []string{
 			"python", "-m", "cog.command.openapi_schema",
@@ -36,7 +43,7 @@ func GenerateOpenAPISchema(imageName string, enableGPU bool) (map[string]any, er
 		console.Debug(stdout.String())
 		console.Debug(stderr.String())
 		console.Debug("Missing device driver, re-trying without GPU")
-		return GenerateOpenAPISchema(imageName, false)
+		return GenerateOpenAPISchema(ctx, imageName, false)
 	}
 
 	if err != nil {
@@ -55,8 +62,49 @@ func GenerateOpenAPISchema(imageName string, enableGPU bool) (map[string]any, er
 	return schema, nil
 }
 
-func GetOpenAPISchema(imageName string) (*openapi3.T, error) {
-	image, err := docker.ImageInspect(imageName)
+// GenerateOpenAPISchemaFromServer starts the image's server and gets the schema from its /openapi.json, for models
+// with a runner in cog.yaml, which Cog can't get the schema from by running Python
+func GenerateOpenAPISchemaFromServer(ctx context.Context, imageName string, enableGPU bool) (map[string]any, error) {
+	gpus := ""
+	if enableGPU {
+		gpus = "all"
+	}
+	var logs bytes.Buffer
+	predictor := predict.NewPredictor(docker.RunOptions{Image: imageName, GPUs: gpus}, false, false)
+	if err := predictor.Start(ctx, &logs, serverSchemaTimeout); err != nil {
+		if enableGPU && errors.Is(err, docker.ErrMissingDeviceDriver) {
+			console.Debug("Missing device driver, re-trying without GPU")
+			return GenerateOpenAPISchemaFromServer(ctx, imageName, false)
+		}
+		// The container is still running if the server didn't become ready in time
+		_ = predictor.Stop(context.WithoutCancel(ctx))
+		console.Info(logs.String())
+		return nil, err
+	}
+	defer func() {
+		if err := predictor.Stop(context.WithoutCancel(ctx)); err != nil {
+			console.Warnf("Failed to stop container: %s", err)
+		}
+	}()
+
+	doc, err := predictor.GetSchema()
+	if err != nil {
+		console.Info(logs.String())
+		return nil, fmt.Errorf("Failed to get the schema from the server's /openapi.json: %w", err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+func GetOpenAPISchema(ctx context.Context, imageName string) (*openapi3.T, error) {
+	image, err := docker.ImageInspect(ctx, imageName)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
 	}
@@ -2,6 +2,7 @@ package image
 
 import (
 	"bytes"
+	"context"
 
 	"github.com/replicate/cog/pkg/docker"
 	"github.com/replicate/cog/pkg/util/console"
@@ -9,11 +10,11 @@ import (
 
 // GeneratePipFreeze by running a pip freeze on the image.
 // This will be run as part of the build process then added as a label to the image.
-func GeneratePipFreeze(imageName string) (string, error) {
+func GeneratePipFreeze(ctx context.Context, imageName string) (string, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
 
-	err := docker.RunWithIO(docker.RunOptions{
+	err := docker.RunWithIO(ctx, docker.RunOptions{
 		Image: imageName,
 		Args: []string{
 			"python", "-m", "pip", "freeze",
@@ -0,0 +1,109 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/provenance"
+)
+
+// buildProvenance returns the provenance of a build of the project in dir as JSON, for the provenance label. images
+// are the base images it was built on, pinned to digests if they're pinned.
+func buildProvenance(cfg *config.Config, dir string, imageName string, images []string, fetchedWeights []FetchedWeights, startedOn time.Time) (string, error) {
+	build := provenance.Build{
+		Config:     global.ConfigFilename,
+		Image:      imageName,
+		StartedOn:  startedOn,
+		FinishedOn: time.Now(),
+	}
+	if commit, err := gitHead(dir); err == nil {
+		build.Commit = commit
+		build.Repository = gitRepository(dir)
+		build.UncommittedChanges = gitUncommittedChanges(dir)
+		if prefix := gitPrefix(dir); prefix != "" {
+			build.Config = path.Join(prefix, global.ConfigFilename)
+		}
+	}
+
+	files := []string{global.ConfigFilename}
+	if cfg.Build.PythonRequirements != "" {
+		files = append(files, cfg.Build.PythonRequirements)
+	}
+	for _, file := range files {
+		dependency, err := provenance.FileDescriptor(dir, file)
+		if err != nil {
+			return "", err
+		}
+		build.Dependencies = append(build.Dependencies, dependency)
+	}
+	for _, image := range images {
+		if dependency, ok := provenance.ImageDescriptor(image); ok {
+			build.Dependencies = append(build.Dependencies, dependency)
+		}
+	}
+	for _, w := range fetchedWeights {
+		build.Dependencies = append(build.Dependencies, provenance.ResourceDescriptor{
+			Name:   w.Path,
+			URI:    w.Source,
+			Digest: map[string]string{"gitCommit": w.Revision},
+		})
+	}
+
+	predicateJSON, err := json.Marshal(provenance.NewPredicate(build))
+	if err != nil {
+		return "", fmt.Errorf("Failed to convert provenance to JSON: %w", err)
+	}
+	return string(predicateJSON), nil
+}
+
+// gitRepository returns the URL of the Git repository dir is in, without any credentials in it, or "" if it hasn't
+// got one
+func gitRepository(dir string) string {
+	if server, repository := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"); server != "" && repository != "" {
+		return server + "/" + repository
+	}
+	out, err := gitOutput(dir, "remote", "get-url", "origin")
+	if err != nil {
+		return ""
+	}
+	if u, err := url.Parse(out); err == nil && u.User != nil {
+		u.User = nil
+		return u.String()
+	}
+	return out
+}
+
+// gitUncommittedChanges returns whether the Git repository dir is in has changes that aren't committed
+func gitUncommittedChanges(dir string) bool {
+	out, err := gitOutput(dir, "status", "--porcelain")
+	return err == nil && out != ""
+}
+
+// gitPrefix returns the path of dir in the Git repository it's in, like "models/hotdog", or "" if it's the root
+func gitPrefix(dir string) string {
+	out, err := gitOutput(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(out, "/")
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.TODO(), 3*time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
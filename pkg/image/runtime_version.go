@@ -0,0 +1,69 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/version"
+)
+
+// releaseVersionPattern matches the release a version of Cog is or is a pre-release of, like 0.14.0 in
+// "v0.14.0-alpha1". Development builds, like "dev", don't match.
+var releaseVersionPattern = regexp.MustCompile(`^v?([0-9]+\.[0-9]+\.[0-9]+)`)
+
+// RuntimeVersion returns the version of Cog that built the image, and so the version of the runtime in it, from its
+// run.cog.version label. It's "" if the image doesn't have the label.
+func RuntimeVersion(ctx context.Context, imageName string) (string, error) {
+	image, err := docker.ImageInspect(ctx, imageName)
+	if err != nil {
+		return "", fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	return image.Config.Labels[global.LabelNamespace+"version"], nil
+}
+
+// CheckRuntimeVersion returns an error if the image was built by a version of Cog whose runtime isn't compatible with
+// this version of Cog, unless force is true, in which case it warns. It also warns if the image was built by a newer,
+// compatible version of Cog.
+func CheckRuntimeVersion(ctx context.Context, imageName string, force bool) error {
+	runtimeVersion, err := RuntimeVersion(ctx, imageName)
+	if err != nil {
+		return err
+	}
+	compatible, newer := runtimeCompatibility(runtimeVersion, global.Version)
+	switch {
+	case !compatible && !force:
+		return fmt.Errorf("%s was built with Cog %s, which isn't compatible with this version of Cog (%s). Upgrade its runtime with 'cog upgrade-image %s', or pass --force to use it anyway", imageName, runtimeVersion, global.Version, imageName)
+	case !compatible:
+		console.Warnf("%s was built with Cog %s, which isn't compatible with this version of Cog (%s)", imageName, runtimeVersion, global.Version)
+	case newer:
+		console.Warnf("%s was built with a newer version of Cog (%s) than this one (%s). If it doesn't work, upgrade Cog", imageName, runtimeVersion, global.Version)
+	}
+	return nil
+}
+
+// runtimeCompatibility returns whether the runtime of an image that was built by Cog runtimeVersion is compatible
+// with Cog cliVersion, and whether it's newer. They're compatible if they're the same major version, or the same
+// minor version before 1.0, like semver's caret ranges. Development builds are compatible with everything, and
+// so are images that weren't labelled with the version of Cog that built them.
+func runtimeCompatibility(runtimeVersion string, cliVersion string) (compatible bool, newer bool) {
+	runtime := releaseVersion(runtimeVersion)
+	cli := releaseVersion(cliVersion)
+	if runtime == nil || cli == nil {
+		return true, false
+	}
+	compatible = runtime.Major == cli.Major && (runtime.Major > 0 || runtime.Minor == cli.Minor)
+	return compatible, runtime.Greater(cli)
+}
+
+// releaseVersion returns the release that v is or is a pre-release of, or nil if v is a development build
+func releaseVersion(v string) *version.Version {
+	match := releaseVersionPattern.FindStringSubmatch(v)
+	if match == nil {
+		return nil
+	}
+	return version.MustVersion(match[1])
+}
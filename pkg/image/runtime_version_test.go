@@ -0,0 +1,34 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuntimeCompatibility(t *testing.T) {
+	for _, tt := range []struct {
+		runtimeVersion string
+		cliVersion     string
+		compatible     bool
+		newer          bool
+	}{
+		{"0.14.0", "0.14.0", true, false},
+		{"0.14.0", "0.14.3", true, false},
+		{"0.14.3", "0.14.0", true, true},
+		{"0.13.7", "0.14.0", false, false},
+		{"0.15.0", "0.14.0", false, true},
+		{"v0.14.0-alpha1", "0.14.2", true, false},
+		{"1.2.0", "1.0.0", true, true},
+		{"1.0.0", "2.1.0", false, false},
+		{"0.14.0", "dev", true, false},
+		{"dev", "0.14.0", true, false},
+		{"", "0.14.0", true, false},
+	} {
+		t.Run(tt.runtimeVersion+" "+tt.cliVersion, func(t *testing.T) {
+			compatible, newer := runtimeCompatibility(tt.runtimeVersion, tt.cliVersion)
+			require.Equal(t, tt.compatible, compatible)
+			require.Equal(t, tt.newer, newer)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package image
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+)
+
+// stateLockPath is the file that's locked while Cog changes the state it keeps in .cog/, like the build manifest and
+// the weights manifest, relative to the project. It's in .cog/tmp, with the other files that are only needed while
+// Cog runs.
+const stateLockPath = ".cog/tmp/state.lock"
+
+// lockState locks the state in a project's .cog/ directory, waiting for other Cog commands in the project, like
+// builds in a matrix of CI jobs in the same checkout, to unlock it first. Call the function it returns to unlock it.
+// It isn't reentrant, so locking it again before unlocking it waits until ctx is done.
+func lockState(ctx context.Context, dir string) (func(), error) {
+	path := filepath.Join(dir, stateLockPath)
+	lock, err := files.LockFile(ctx, path, func() {
+		console.Info("Waiting for another Cog command in this project to finish with .cog/...")
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := lock.Unlock(); err != nil {
+			console.Warnf("Failed to unlock %s: %s", path, err)
+		}
+	}, nil
+}
@@ -0,0 +1,50 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/dockerfile"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// UpgradeRuntime builds newImageName from imageName, a Cog model, with the Cog runtime replaced by the one in this
+// version of Cog. Only the runtime is rebuilt, on top of the image, so the model's environment, code and weights stay
+// the same. The labels that record the version of Cog and the Python packages in the image are updated.
+func UpgradeRuntime(ctx context.Context, imageName string, newImageName string, progressOutput string) error {
+	// Check it's a Cog model
+	if _, err := GetConfig(ctx, imageName); err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "cog-upgrade-image-")
+	if err != nil {
+		return fmt.Errorf("Failed to create build directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	dockerfileContents, err := dockerfile.RuntimeUpgrade(imageName, dir)
+	if err != nil {
+		return fmt.Errorf("Failed to generate Dockerfile: %w", err)
+	}
+	console.Infof("Installing the Cog %s runtime in %s...", global.Version, imageName)
+	if err := docker.Build(ctx, dir, dockerfileContents, newImageName, []string{}, nil, false, progressOutput, -1); err != nil {
+		return fmt.Errorf("Failed to build Docker image: %w", err)
+	}
+
+	pipFreeze, err := GeneratePipFreeze(ctx, newImageName)
+	if err != nil {
+		return fmt.Errorf("Failed to generate pip freeze from image: %w", err)
+	}
+	labels := map[string]string{
+		global.LabelNamespace + "version":    global.Version,
+		global.LabelNamespace + "pip_freeze": pipFreeze,
+	}
+	if err := docker.BuildAddLabelsToImage(ctx, dir, newImageName, labels); err != nil {
+		return fmt.Errorf("Failed to add labels to image: %w", err)
+	}
+	return nil
+}
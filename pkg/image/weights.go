@@ -0,0 +1,298 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/weights"
+)
+
+// FetchedWeights records which files were downloaded for a weights source in cog.yaml, so an image says exactly
+// which weights it was built with even if the source's revision is a branch
+type FetchedWeights struct {
+	Source string `json:"source"`
+	// Revision is the commit the source's revision resolved to
+	Revision string   `json:"revision"`
+	Path     string   `json:"path"`
+	Files    []string `json:"files"`
+	// Shared weights aren't in the image, and are mounted from the weights cache when it runs
+	Shared bool `json:"shared,omitempty"`
+}
+
+// FetchWeights downloads the weights in cog.yaml into the project in dir. Shared weights are only downloaded into the
+// weights cache, because they're mounted from there when the model runs.
+func FetchWeights(ctx context.Context, cfg *config.Config, dir string) ([]FetchedWeights, error) {
+	if len(cfg.Weights) == 0 {
+		return nil, nil
+	}
+	hf, err := newWeightsClient()
+	if err != nil {
+		return nil, err
+	}
+
+	fetched := []FetchedWeights{}
+	for _, w := range cfg.Weights {
+		repo, err := weights.ParseHuggingFaceURL(w.Source)
+		if err != nil {
+			return nil, err
+		}
+		commit, files, err := hf.Resolve(ctx, repo)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to resolve %s: %w", w.Source, err)
+		}
+		if !repo.IsPinned() {
+			console.Infof("Resolved %s to commit %s. Use %s@%s to pin it.", w.Source, commit, weights.HuggingFaceScheme+repo.Repo, commit)
+		}
+		files = filterWeightsFiles(files, w.Include)
+		if len(files) == 0 {
+			return nil, fmt.Errorf("No files in %s match include: %s", w.Source, strings.Join(w.Include, ", "))
+		}
+
+		destDir := filepath.Join(dir, w.Dir())
+		for _, file := range files {
+			cached, err := downloadWeightsFile(ctx, hf, repo.Repo, commit, file)
+			if err != nil {
+				return nil, err
+			}
+			if w.Shared {
+				continue
+			}
+			if err := linkWeightsFile(cached, filepath.Join(destDir, filepath.FromSlash(file))); err != nil {
+				return nil, fmt.Errorf("Failed to copy %s into %s: %w", file, w.Dir(), err)
+			}
+		}
+		if w.Shared {
+			warnSharedWeightsInProject(destDir, w)
+		} else {
+			warnExtraWeightsFiles(destDir, w, files)
+		}
+
+		fetched = append(fetched, FetchedWeights{
+			Source:   w.Source,
+			Revision: commit,
+			Path:     filepath.ToSlash(w.Dir()),
+			Files:    files,
+			Shared:   w.Shared,
+		})
+	}
+	return fetched, nil
+}
+
+// SharedWeightsMounts downloads the shared weights in cog.yaml into the weights cache, if they aren't there already,
+// and returns the volumes that mount them read-only into the model's container where the model expects them. If
+// imageName was built by `cog build`, the weights are the ones it was built with. Otherwise, they're resolved again.
+func SharedWeightsMounts(ctx context.Context, cfg *config.Config, imageName string) ([]config.Volume, error) {
+	if len(cfg.SharedWeights()) == 0 {
+		return nil, nil
+	}
+	hf, err := newWeightsClient()
+	if err != nil {
+		return nil, err
+	}
+
+	var fetched []FetchedWeights
+	if imageName != "" {
+		if fetched, err = getFetchedWeights(ctx, imageName); err != nil {
+			return nil, err
+		}
+	}
+	if fetched == nil {
+		// The model is run from its project, so its weights haven't been recorded in an image
+		for _, w := range cfg.SharedWeights() {
+			repo, err := weights.ParseHuggingFaceURL(w.Source)
+			if err != nil {
+				return nil, err
+			}
+			commit, files, err := hf.Resolve(ctx, repo)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to resolve %s: %w", w.Source, err)
+			}
+			fetched = append(fetched, FetchedWeights{
+				Source:   w.Source,
+				Revision: commit,
+				Path:     filepath.ToSlash(w.Dir()),
+				Files:    filterWeightsFiles(files, w.Include),
+				Shared:   true,
+			})
+		}
+	}
+
+	volumes := []config.Volume{}
+	for _, f := range fetched {
+		if !f.Shared {
+			continue
+		}
+		repo, err := weights.ParseHuggingFaceURL(f.Source)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range f.Files {
+			if _, err := downloadWeightsFile(ctx, hf, repo.Repo, f.Revision, file); err != nil {
+				return nil, err
+			}
+		}
+		source := hf.CachePath(repo.Repo, f.Revision, "")
+		// Pruning the cache keeps weights that have been used recently
+		if err := weights.TouchCached(source); err != nil {
+			return nil, err
+		}
+		volumes = append(volumes, config.Volume{Source: source, Destination: path.Join("/src", f.Path), ReadOnly: true})
+	}
+	return volumes, nil
+}
+
+// RuntimeVolumes returns the volumes to mount into the model's container: its shared weights, then the volumes in
+// cog.yaml and extra ones, like config.VolumeMounts. Extra volumes replace shared weights with the same destination.
+func RuntimeVolumes(ctx context.Context, cfg *config.Config, imageName string, projectDir string, extra []string) ([]config.Volume, error) {
+	shared, err := SharedWeightsMounts(ctx, cfg, imageName)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := cfg.VolumeMounts(projectDir, extra)
+	if err != nil {
+		return nil, err
+	}
+	shared = slices.DeleteFunc(shared, func(s config.Volume) bool {
+		return slices.ContainsFunc(volumes, func(v config.Volume) bool { return v.Destination == s.Destination })
+	})
+	return append(shared, volumes...), nil
+}
+
+// getFetchedWeights returns the weights an image was built with, or nil if it doesn't say
+func getFetchedWeights(ctx context.Context, imageName string) ([]FetchedWeights, error) {
+	image, err := docker.ImageInspect(ctx, imageName)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to inspect %s: %w", imageName, err)
+	}
+	label := image.Config.Labels[global.LabelNamespace+"weights"]
+	if label == "" {
+		return nil, nil
+	}
+	fetched := []FetchedWeights{}
+	if err := json.Unmarshal([]byte(label), &fetched); err != nil {
+		return nil, fmt.Errorf("Failed to parse the weights %s was built with: %w", imageName, err)
+	}
+	return fetched, nil
+}
+
+func newWeightsClient() (*weights.HuggingFace, error) {
+	cacheDir, err := weights.CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	return weights.NewHuggingFace(cacheDir)
+}
+
+// downloadWeightsFile downloads a file into the weights cache, unless it's already there, and returns its path
+func downloadWeightsFile(ctx context.Context, hf *weights.HuggingFace, repo string, commit string, file string) (string, error) {
+	if _, err := os.Stat(hf.CachePath(repo, commit, file)); err != nil {
+		console.Infof("Downloading %s from %s...", file, repo)
+	}
+	return hf.Download(ctx, repo, commit, file)
+}
+
+// filterWeightsFiles returns the files that match any of the patterns. A pattern without a slash matches a file's
+// name in any directory, and one with a slash matches its whole path.
+func filterWeightsFiles(files []string, include []string) []string {
+	if len(include) == 0 {
+		return files
+	}
+	filtered := []string{}
+	for _, file := range files {
+		for _, pattern := range include {
+			name := file
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(file)
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				filtered = append(filtered, file)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// linkWeightsFile hard links a cached file into the project, so it doesn't take up space twice, or copies it if
+// the cache is on a different filesystem
+func linkWeightsFile(cached string, dest string) error {
+	cachedInfo, err := os.Stat(cached)
+	if err != nil {
+		return err
+	}
+	if destInfo, err := os.Stat(dest); err == nil {
+		if os.SameFile(cachedInfo, destInfo) {
+			return nil
+		}
+		if err := os.Remove(dest); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	if err := os.Link(cached, dest); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(cached)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// warnExtraWeightsFiles warns about files in a weights directory that aren't part of the weights, like ones left
+// from an earlier revision, because they'd be built into the image too
+func warnExtraWeightsFiles(destDir string, w config.WeightsSource, files []string) {
+	wanted := map[string]bool{}
+	for _, file := range files {
+		wanted[filepath.FromSlash(file)] = true
+	}
+	extra := []string{}
+	_ = filepath.Walk(destDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(destDir, p)
+		if err == nil && !wanted[rel] {
+			extra = append(extra, rel)
+		}
+		return nil
+	})
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		console.Warnf("%s has files that aren't in %s, which will be built into the image: %s", w.Dir(), w.Source, strings.Join(extra, ", "))
+	}
+}
+
+// warnSharedWeightsInProject warns about files in the project where shared weights are mounted, because they'd be
+// built into the image even though the model never sees them
+func warnSharedWeightsInProject(destDir string, w config.WeightsSource) {
+	entries, err := os.ReadDir(destDir)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	console.Warnf("%s has files in it, which will be built into the image, but %s is shared so it's mounted there instead. Delete %s or add it to .dockerignore.", w.Dir(), w.Source, w.Dir())
+}
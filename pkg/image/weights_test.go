@@ -0,0 +1,99 @@
+package image
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestFetchWeights(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/org/repo/revision/main":
+			_, _ = w.Write([]byte(`{"sha": "` + commit + `", "siblings": [{"rfilename": "README.md"}, {"rfilename": "unet/model.safetensors"}]}`))
+		case "/org/repo/resolve/" + commit + "/unet/model.safetensors":
+			_, _ = w.Write([]byte("weights"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("HF_ENDPOINT", server.URL)
+	t.Setenv("HF_TOKEN", "")
+	t.Setenv("HF_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	dir := t.TempDir()
+	cfg := &config.Config{Weights: []config.WeightsSource{{Source: "hf://org/repo@main", Include: []string{"*.safetensors"}}}}
+
+	for i := 0; i < 2; i++ {
+		fetched, err := FetchWeights(context.Background(), cfg, dir)
+		require.NoError(t, err)
+		require.Equal(t, []FetchedWeights{{
+			Source:   "hf://org/repo@main",
+			Revision: commit,
+			Path:     "weights/repo",
+			Files:    []string{"unet/model.safetensors"},
+		}}, fetched)
+		contents, err := os.ReadFile(filepath.Join(dir, "weights", "repo", "unet", "model.safetensors"))
+		require.NoError(t, err)
+		require.Equal(t, "weights", string(contents))
+	}
+
+	cfg.Weights[0].Include = []string{"*.bin"}
+	_, err := FetchWeights(context.Background(), cfg, dir)
+	require.ErrorContains(t, err, "No files in hf://org/repo@main match include: *.bin")
+}
+
+func TestSharedWeights(t *testing.T) {
+	commit := "0123456789abcdef0123456789abcdef01234567"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/models/org/repo/revision/main":
+			_, _ = w.Write([]byte(`{"sha": "` + commit + `", "siblings": [{"rfilename": "model.safetensors"}]}`))
+		case "/org/repo/resolve/" + commit + "/model.safetensors":
+			_, _ = w.Write([]byte("weights"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("HF_ENDPOINT", server.URL)
+	t.Setenv("HF_TOKEN", "")
+	t.Setenv("HF_HOME", t.TempDir())
+	cacheDir := t.TempDir()
+	t.Setenv("COG_WEIGHTS_CACHE", cacheDir)
+
+	dir := t.TempDir()
+	cfg := &config.Config{Weights: []config.WeightsSource{{Source: "hf://org/repo@main", Shared: true}}}
+
+	// Shared weights aren't put in the project, so they aren't built into the image
+	fetched, err := FetchWeights(context.Background(), cfg, dir)
+	require.NoError(t, err)
+	require.True(t, fetched[0].Shared)
+	_, err = os.Stat(filepath.Join(dir, "weights", "repo"))
+	require.True(t, os.IsNotExist(err))
+
+	volumes, err := SharedWeightsMounts(context.Background(), cfg, "")
+	require.NoError(t, err)
+	source := filepath.Join(cacheDir, "org", "repo", commit)
+	require.Equal(t, []config.Volume{{Source: source, Destination: "/src/weights/repo", ReadOnly: true}}, volumes)
+	contents, err := os.ReadFile(filepath.Join(source, "model.safetensors"))
+	require.NoError(t, err)
+	require.Equal(t, "weights", string(contents))
+}
+
+func TestFilterWeightsFiles(t *testing.T) {
+	files := []string{"config.json", "model.safetensors", "unet/model.safetensors", "vae/model.bin"}
+	require.Equal(t, files, filterWeightsFiles(files, nil))
+	require.Equal(t, []string{"model.safetensors", "unet/model.safetensors"}, filterWeightsFiles(files, []string{"*.safetensors"}))
+	require.Equal(t, []string{"unet/model.safetensors", "vae/model.bin"}, filterWeightsFiles(files, []string{"unet/*", "vae/*.bin"}))
+}
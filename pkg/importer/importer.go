@@ -0,0 +1,97 @@
+// Package importer has what the importers of models saved with other tools, like MLflow, BentoML and TorchServe,
+// have in common: the environment the model needs, and the cog.yaml and requirements file that set it up.
+package importer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultPythonVersion is the version of Python a model runs with if it doesn't say which it needs
+const DefaultPythonVersion = "3.11"
+
+// Environment is what a model needs to run
+type Environment struct {
+	// PythonVersion is the version of Python, like 3.10.12
+	PythonVersion string
+	// Requirements are the model's pip requirements
+	Requirements []string
+	// SystemPackages are the model's apt packages
+	SystemPackages []string
+	GPU            bool
+}
+
+// CogYaml returns a cog.yaml that sets up an environment, with its requirements in requirements.txt, and runs the
+// predictor in predict.py. generatedBy is the command that imported the model, and source is where it came from.
+func CogYaml(env Environment, generatedBy string, source string) []byte {
+	var b strings.Builder
+	b.WriteString("# Configuration for Cog ⚙️\n# Reference: https://cog.run/yaml\n")
+	fmt.Fprintf(&b, "# Generated by %s from %s\n\nbuild:\n", generatedBy, source)
+	fmt.Fprintf(&b, "  # set to true if your model requires a GPU\n  gpu: %t\n\n", env.GPU)
+	fmt.Fprintf(&b, "  # the version of Python the model was saved with\n  python_version: %q\n\n", PythonVersion(env.PythonVersion))
+	b.WriteString("  # the model's pip requirements, and what the predictor loads it with\n  python_requirements: requirements.txt\n\n")
+	if len(env.SystemPackages) > 0 {
+		b.WriteString("  # the model's ubuntu apt packages\n  system_packages:\n")
+		for _, pkg := range env.SystemPackages {
+			fmt.Fprintf(&b, "    - %q\n", pkg)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("# predict.py defines how predictions are run on your model\npredict: \"predict.py:Predictor\"\n")
+	return []byte(b.String())
+}
+
+// RequirementsFile returns the contents of requirements.txt for an environment
+func RequirementsFile(env Environment, generatedBy string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by %s from the model's requirements\n", generatedBy)
+	for _, requirement := range env.Requirements {
+		fmt.Fprintln(&b, requirement)
+	}
+	return []byte(b.String())
+}
+
+// PythonVersion returns the major and minor version of Python in a version like 3.10.12, or DefaultPythonVersion if
+// it isn't a version
+func PythonVersion(version string) string {
+	parts := strings.Split(strings.TrimSpace(version), ".")
+	if len(parts) < 2 {
+		return DefaultPythonVersion
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// RequirementLines returns the requirements in a requirements file, without comments or blank lines
+func RequirementLines(contents string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(contents, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// AddRequirements returns requirements with the packages added, if they aren't already required
+func AddRequirements(requirements []string, packages ...string) []string {
+	result := append([]string{}, requirements...)
+	for _, pkg := range packages {
+		required := false
+		for _, requirement := range requirements {
+			required = required || RequirementName(requirement) == RequirementName(pkg)
+		}
+		if !required {
+			result = append(result, pkg)
+		}
+	}
+	return result
+}
+
+// RequirementName returns the name of the package in a requirement, like mlflow for mlflow[extras]==2.9.2
+func RequirementName(requirement string) string {
+	if i := strings.IndexAny(requirement, "=<>!~[;@ "); i >= 0 {
+		requirement = requirement[:i]
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(requirement)), "_", "-")
+}
@@ -0,0 +1,44 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCogYaml(t *testing.T) {
+	env := Environment{PythonVersion: "3.10.12", SystemPackages: []string{"libgl1"}, GPU: true}
+	require.Equal(t, `# Configuration for Cog ⚙️
+# Reference: https://cog.run/yaml
+# Generated by cog import bento from iris_classifier:latest
+
+build:
+  # set to true if your model requires a GPU
+  gpu: true
+
+  # the version of Python the model was saved with
+  python_version: "3.10"
+
+  # the model's pip requirements, and what the predictor loads it with
+  python_requirements: requirements.txt
+
+  # the model's ubuntu apt packages
+  system_packages:
+    - "libgl1"
+
+# predict.py defines how predictions are run on your model
+predict: "predict.py:Predictor"
+`, string(CogYaml(env, "cog import bento", "iris_classifier:latest")))
+}
+
+func TestPythonVersion(t *testing.T) {
+	require.Equal(t, "3.10", PythonVersion("3.10.12"))
+	require.Equal(t, "3.9", PythonVersion("3.9\n"))
+	require.Equal(t, DefaultPythonVersion, PythonVersion(""))
+}
+
+func TestAddRequirements(t *testing.T) {
+	requirements := []string{"MLflow[extras]==2.9.2", "scikit_learn>=1.3"}
+	require.Equal(t, []string{"MLflow[extras]==2.9.2", "scikit_learn>=1.3", "torch"}, AddRequirements(requirements, "mlflow", "scikit-learn", "torch"))
+	require.Equal(t, []string{"mlflow==2.9.2", "scikit-learn"}, RequirementLines("# comment\nmlflow==2.9.2  # pinned\n\nscikit-learn\n"))
+}
@@ -0,0 +1,180 @@
+// Package lambda deploys models built with build.target set to lambda to AWS Lambda, as container image functions.
+// It uses the aws CLI, so it uses the same credentials, profiles and region as the CLI does.
+package lambda
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// MaxImageSize is the largest image Lambda can run, uncompressed
+const MaxImageSize = 10 * 1024 * 1024 * 1024
+
+// The memory, in MB, Lambda functions can have. Lambda gives functions CPUs in proportion to their memory.
+const (
+	MinMemory = 128
+	MaxMemory = 10240
+	// DefaultMemory is the memory functions get if resources.memory isn't set in cog.yaml. Lambda's own default of
+	// 128MB is too little for almost any model.
+	DefaultMemory = 3008
+)
+
+// MaxTimeout is the longest, in seconds, Lambda lets a function run for
+const MaxTimeout = 900
+
+// Function is a Lambda function that runs a model
+type Function struct {
+	Name string
+	// Image is the model's image in Amazon ECR, which is the only registry Lambda runs images from
+	Image string
+	// Role is the ARN of the IAM role the function runs as. It's only needed to create the function.
+	Role string
+	// Memory is in MB
+	Memory int
+	// Timeout is in seconds
+	Timeout int
+	// Architecture is "x86_64" or "arm64"
+	Architecture string
+}
+
+var ecrPattern = regexp.MustCompile(`^\d{12}\.dkr\.ecr\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?/`)
+
+// ImageRegion returns the region of an image in Amazon ECR, like us-east-1, or an error if it isn't in ECR
+func ImageRegion(imageName string) (string, error) {
+	m := ecrPattern.FindStringSubmatch(imageName)
+	if m == nil {
+		return "", fmt.Errorf("%s isn't in Amazon ECR, which is the only registry Lambda runs images from. Push it to an ECR repository, like 123456789012.dkr.ecr.us-east-1.amazonaws.com/my-model", imageName)
+	}
+	return m[1], nil
+}
+
+// CheckImageSize returns an error if an image is too big for Lambda to run
+func CheckImageSize(imageName string, size int64) error {
+	if size > MaxImageSize {
+		return fmt.Errorf("%s is %s, but Lambda can't run images bigger than %s. Make it smaller, like by downloading the model's weights in setup() instead of building them into the image", imageName, units.BytesSize(float64(size)), units.BytesSize(MaxImageSize))
+	}
+	return nil
+}
+
+// Memory returns the memory, in MB, a function needs for resources.memory in cog.yaml
+func Memory(resources *config.Resources) (int, error) {
+	memoryBytes := resources.MemoryBytes()
+	if memoryBytes == 0 {
+		return DefaultMemory, nil
+	}
+	memory := int((memoryBytes + 1024*1024 - 1) / (1024 * 1024))
+	if memory > MaxMemory {
+		return 0, fmt.Errorf("resources.memory is %s, but Lambda functions can't have more than %dMB", resources.Memory, MaxMemory)
+	}
+	return max(memory, MinMemory), nil
+}
+
+// Architecture returns the Lambda architecture for the architecture of a Docker image
+func Architecture(imageArchitecture string) (string, error) {
+	switch imageArchitecture {
+	case "amd64", "":
+		return "x86_64", nil
+	case "arm64":
+		return "arm64", nil
+	}
+	return "", fmt.Errorf("Lambda can't run images for %s. Build the image for amd64 or arm64", imageArchitecture)
+}
+
+// DeployArgs returns the arguments to the aws commands Deploy runs: the one that checks whether the function exists,
+// the ones that create it if it doesn't, and the ones that update it if it does. There are no create commands if
+// f.Role isn't set, because a function can't be created without it.
+func DeployArgs(f Function) (get []string, create [][]string, update [][]string, err error) {
+	region, err := ImageRegion(f.Image)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if f.Timeout < 1 || f.Timeout > MaxTimeout {
+		return nil, nil, nil, fmt.Errorf("Invalid timeout %d, expected between 1 and %d seconds", f.Timeout, MaxTimeout)
+	}
+	memory := strconv.Itoa(f.Memory)
+	timeout := strconv.Itoa(f.Timeout)
+
+	get = []string{"lambda", "get-function", "--function-name", f.Name, "--region", region}
+	if f.Role != "" {
+		create = [][]string{
+			{"lambda", "create-function", "--function-name", f.Name, "--package-type", "Image", "--code", "ImageUri=" + f.Image, "--role", f.Role, "--memory-size", memory, "--timeout", timeout, "--architectures", f.Architecture, "--region", region},
+			{"lambda", "wait", "function-active-v2", "--function-name", f.Name, "--region", region},
+		}
+	}
+	updateConfiguration := []string{"lambda", "update-function-configuration", "--function-name", f.Name, "--memory-size", memory, "--timeout", timeout, "--region", region}
+	if f.Role != "" {
+		updateConfiguration = append(updateConfiguration, "--role", f.Role)
+	}
+	wait := []string{"lambda", "wait", "function-updated-v2", "--function-name", f.Name, "--region", region}
+	update = [][]string{
+		{"lambda", "update-function-code", "--function-name", f.Name, "--image-uri", f.Image, "--architectures", f.Architecture, "--region", region},
+		// Lambda doesn't let a function's configuration be changed until it's finished updating its code
+		wait,
+		updateConfiguration,
+		wait,
+	}
+	return get, create, update, nil
+}
+
+// Deploy creates the function, or updates its image and configuration if it already exists. It returns whether the
+// function was created.
+func Deploy(f Function) (created bool, err error) {
+	get, create, update, err := DeployArgs(f)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = runAWS(get...)
+	if err != nil && !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		return false, fmt.Errorf("Failed to get Lambda function %s: %w", f.Name, err)
+	}
+
+	if err != nil {
+		if f.Role == "" {
+			return false, fmt.Errorf("Lambda function %s doesn't exist. Pass the ARN of the IAM role to run it as with --role to create it", f.Name)
+		}
+		console.Infof("Creating Lambda function %s...", f.Name)
+		for _, args := range create {
+			if _, err := runAWS(args...); err != nil {
+				return false, fmt.Errorf("Failed to create Lambda function %s: %w", f.Name, err)
+			}
+		}
+		return true, nil
+	}
+
+	console.Infof("Updating Lambda function %s...", f.Name)
+	for _, args := range update {
+		if _, err := runAWS(args...); err != nil {
+			return false, fmt.Errorf("Failed to update Lambda function %s: %w", f.Name, err)
+		}
+	}
+	return false, nil
+}
+
+// runAWS is a variable so tests can replace the aws CLI
+var runAWS = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("aws", args...)
+	cmd.Env = os.Environ()
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	console.Debug("$ aws " + strings.Join(args, " "))
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the aws CLI isn't installed. See https://aws.amazon.com/cli/")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
@@ -0,0 +1,106 @@
+package lambda
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+const testImage = "123456789012.dkr.ecr.us-west-2.amazonaws.com/hotdog-detector:latest"
+
+func fakeAWS(t *testing.T, exists bool) *[][]string {
+	calls := [][]string{}
+	original := runAWS
+	t.Cleanup(func() { runAWS = original })
+	runAWS = func(args ...string) ([]byte, error) {
+		calls = append(calls, args)
+		if args[1] == "get-function" && !exists {
+			return nil, errors.New("exit status 254: An error occurred (ResourceNotFoundException) when calling the GetFunction operation")
+		}
+		return []byte("{}"), nil
+	}
+	return &calls
+}
+
+func commands(calls [][]string) []string {
+	names := []string{}
+	for _, call := range calls {
+		names = append(names, strings.Join(call[:3], " "))
+	}
+	return names
+}
+
+func TestDeployCreatesFunction(t *testing.T) {
+	calls := fakeAWS(t, false)
+	created, err := Deploy(Function{Name: "hotdog-detector", Image: testImage, Role: "arn:aws:iam::123456789012:role/lambda", Memory: 4096, Timeout: 300, Architecture: "x86_64"})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, []string{"lambda get-function --function-name", "lambda create-function --function-name", "lambda wait function-active-v2"}, commands(*calls))
+	require.Equal(t, []string{"lambda", "create-function", "--function-name", "hotdog-detector", "--package-type", "Image", "--code", "ImageUri=" + testImage, "--role", "arn:aws:iam::123456789012:role/lambda", "--memory-size", "4096", "--timeout", "300", "--architectures", "x86_64", "--region", "us-west-2"}, (*calls)[1])
+
+	_, err = Deploy(Function{Name: "hotdog-detector", Image: testImage, Memory: 4096, Timeout: 300, Architecture: "x86_64"})
+	require.ErrorContains(t, err, "--role")
+}
+
+func TestDeployUpdatesFunction(t *testing.T) {
+	calls := fakeAWS(t, true)
+	created, err := Deploy(Function{Name: "hotdog-detector", Image: testImage, Memory: 4096, Timeout: 300, Architecture: "arm64"})
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, []string{"lambda get-function --function-name", "lambda update-function-code --function-name", "lambda wait function-updated-v2", "lambda update-function-configuration --function-name", "lambda wait function-updated-v2"}, commands(*calls))
+	require.Equal(t, []string{"lambda", "update-function-code", "--function-name", "hotdog-detector", "--image-uri", testImage, "--architectures", "arm64", "--region", "us-west-2"}, (*calls)[1])
+}
+
+func TestDeployArgs(t *testing.T) {
+	// They're what a dry run prints, so they mustn't run anything
+	calls := fakeAWS(t, true)
+	get, create, update, err := DeployArgs(Function{Name: "hotdog-detector", Image: testImage, Memory: 4096, Timeout: 300, Architecture: "arm64"})
+	require.NoError(t, err)
+	require.Empty(t, *calls)
+	require.Equal(t, []string{"lambda", "get-function", "--function-name", "hotdog-detector", "--region", "us-west-2"}, get)
+	require.Empty(t, create, "a function can't be created without a role")
+	require.Equal(t, []string{"lambda update-function-code --function-name", "lambda wait function-updated-v2", "lambda update-function-configuration --function-name", "lambda wait function-updated-v2"}, commands(update))
+
+	_, create, _, err = DeployArgs(Function{Name: "hotdog-detector", Image: testImage, Role: "arn:aws:iam::123456789012:role/lambda", Memory: 4096, Timeout: 300, Architecture: "arm64"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"lambda create-function --function-name", "lambda wait function-active-v2"}, commands(create))
+}
+
+func TestDeployValidates(t *testing.T) {
+	fakeAWS(t, true)
+	_, err := Deploy(Function{Name: "hotdog-detector", Image: "r8.im/alice/hotdog-detector", Memory: 4096, Timeout: 300})
+	require.ErrorContains(t, err, "isn't in Amazon ECR")
+	_, err = Deploy(Function{Name: "hotdog-detector", Image: testImage, Memory: 4096, Timeout: 3600})
+	require.ErrorContains(t, err, "Invalid timeout 3600")
+}
+
+func TestMemory(t *testing.T) {
+	for _, tt := range []struct {
+		memory   string
+		expected int
+		err      string
+	}{
+		{"", DefaultMemory, ""},
+		{"4Gi", 4096, ""},
+		{"64Mi", MinMemory, ""},
+		{"1500M", 1431, ""},
+		{"16Gi", 0, "can't have more than 10240MB"},
+	} {
+		memory, err := Memory(&config.Resources{Memory: tt.memory})
+		if tt.err != "" {
+			require.ErrorContains(t, err, tt.err, tt.memory)
+			continue
+		}
+		require.NoError(t, err, tt.memory)
+		require.Equal(t, tt.expected, memory, tt.memory)
+	}
+}
+
+func TestCheckImageSize(t *testing.T) {
+	require.NoError(t, CheckImageSize(testImage, 4*1024*1024*1024))
+	require.ErrorContains(t, CheckImageSize(testImage, 12*1024*1024*1024), "is 12GiB, but Lambda can't run images bigger than 10GiB")
+}
@@ -0,0 +1,248 @@
+package licenses
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// expression is a license expression, like "MIT OR Apache-2.0". It's an SPDX expression if the package says so
+// precisely, but packages often use free text, like "Apache 2.0" or "GPL-3+ with Bison exception", so words between
+// operators are one license and are normalized to SPDX identifiers where they can be.
+type expression struct {
+	// license is set if this is a single license
+	license string
+	// operator is "AND" or "OR", for expressions of several licenses
+	operator string
+	operands []*expression
+}
+
+// parseExpression parses a license expression, or returns nil if it's empty
+func parseExpression(s string) *expression {
+	p := &expressionParser{tokens: tokenize(s)}
+	return p.parseOr()
+}
+
+// allowed returns whether the expression lets the package be used without any license that forbidden returns true
+// for. Either side of an OR can be chosen, but both sides of an AND apply.
+func (e *expression) allowed(forbidden func(license string) bool) bool {
+	switch e.operator {
+	case "OR":
+		for _, operand := range e.operands {
+			if operand.allowed(forbidden) {
+				return true
+			}
+		}
+		return false
+	case "AND":
+		for _, operand := range e.operands {
+			if !operand.allowed(forbidden) {
+				return false
+			}
+		}
+		return true
+	}
+	return !forbidden(e.license)
+}
+
+// licenses returns every license in the expression
+func (e *expression) licenses() []string {
+	if e.operator == "" {
+		return []string{e.license}
+	}
+	licenses := []string{}
+	for _, operand := range e.operands {
+		licenses = append(licenses, operand.licenses()...)
+	}
+	return licenses
+}
+
+func (e *expression) String() string {
+	if e.operator == "" {
+		return e.license
+	}
+	parts := []string{}
+	for _, operand := range e.operands {
+		s := operand.String()
+		if operand.operator != "" && operand.operator != e.operator {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " "+e.operator+" ")
+}
+
+type expressionParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *expressionParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *expressionParser) parseOr() *expression {
+	return p.parseOperator("OR", p.parseAnd)
+}
+
+func (p *expressionParser) parseAnd() *expression {
+	return p.parseOperator("AND", p.parseLicense)
+}
+
+// parseOperator parses operands joined by an operator, leaving out duplicates and empty operands
+func (p *expressionParser) parseOperator(operator string, parseOperand func() *expression) *expression {
+	operands := []*expression{}
+	seen := map[string]bool{}
+	for {
+		if operand := parseOperand(); operand != nil && !seen[operand.String()] {
+			seen[operand.String()] = true
+			operands = append(operands, operand)
+		}
+		if !strings.EqualFold(p.peek(), operator) {
+			break
+		}
+		p.pos++
+	}
+	switch len(operands) {
+	case 0:
+		return nil
+	case 1:
+		return operands[0]
+	}
+	return &expression{operator: operator, operands: operands}
+}
+
+func (p *expressionParser) parseLicense() *expression {
+	if p.peek() == "(" {
+		p.pos++
+		e := p.parseOr()
+		if p.peek() == ")" {
+			p.pos++
+		}
+		return e
+	}
+	words := []string{}
+	for ; p.pos < len(p.tokens); p.pos++ {
+		token := p.tokens[p.pos]
+		if isOperator(token) {
+			break
+		}
+		// Exceptions, like "GPL-2.0-only WITH Classpath-exception-2.0", only ever allow more, so they're left out
+		if strings.EqualFold(token, "WITH") {
+			for p.pos+1 < len(p.tokens) && !isOperator(p.tokens[p.pos+1]) {
+				p.pos++
+			}
+			continue
+		}
+		words = append(words, token)
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	return &expression{license: normalize(strings.Join(words, " "))}
+}
+
+func isOperator(token string) bool {
+	return token == "(" || token == ")" || strings.EqualFold(token, "AND") || strings.EqualFold(token, "OR")
+}
+
+// tokenize splits an expression into words and parentheses. "/" between licenses, like "MIT/Apache-2.0", means
+// either, so it's an OR.
+func tokenize(s string) []string {
+	// "or later" is part of a license, like "GPL v3 or later", not an OR
+	s = orLaterPattern.ReplaceAllString(s, "or-later")
+	// Debian separates groups of licenses with commas, like "GPL-1+ or Artistic, and Expat"
+	if groups := commaPattern.Split(s, -1); len(groups) > 1 {
+		s = "(" + strings.Join(groups, ") AND (") + ")"
+	}
+	s = strings.NewReplacer("(", " ( ", ")", " ) ", "/", " OR ").Replace(s)
+	tokens := strings.Fields(s)
+	// Parentheses in free text, like "GNU General Public License v3 (GPLv3)", name the license before them
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i] == "(" && tokens[i+2] == ")" && i > 0 && !isOperator(tokens[i-1]) && (i+3 == len(tokens) || isOperator(tokens[i+3])) {
+			start := licenseStart(tokens, i)
+			tokens = slices.Concat(tokens[:start], tokens[i+1:i+2], tokens[i+3:])
+			i = start
+		}
+	}
+	return tokens
+}
+
+// licenseStart returns where the words of the license that ends before tokens[end] start
+func licenseStart(tokens []string, end int) int {
+	start := end
+	for start > 0 && !isOperator(tokens[start-1]) {
+		start--
+	}
+	return start
+}
+
+var orLaterPattern = regexp.MustCompile(`(?i)\bor later\b`)
+
+var commaPattern = regexp.MustCompile(`(?i),\s+and\s+`)
+
+// gplPattern matches the ways GPL licenses are written, like "GPL-2+" in Debian and "GPLv3" in Python packages
+var gplPattern = regexp.MustCompile(`(?i)^(a|l)?gpl[- ]?v?(\d)(?:\.(\d))?(\+| or-later)?$`)
+
+// aliases are SPDX identifiers for licenses that are usually written some other way, in lower case. Names that could
+// be several licenses, like "BSD License", are left as they're written.
+var aliases = map[string]string{
+	"mit":                                "MIT",
+	"mit license":                        "MIT",
+	"expat":                              "MIT",
+	"apache 2":                           "Apache-2.0",
+	"apache 2.0":                         "Apache-2.0",
+	"apache-2":                           "Apache-2.0",
+	"apache license 2.0":                 "Apache-2.0",
+	"apache license, version 2.0":        "Apache-2.0",
+	"apache license version 2.0":         "Apache-2.0",
+	"apache software license 2.0":        "Apache-2.0",
+	"new bsd":                            "BSD-3-Clause",
+	"new bsd license":                    "BSD-3-Clause",
+	"3-clause bsd":                       "BSD-3-Clause",
+	"bsd-1-clause":                       "BSD-1-Clause",
+	"bsd-2-clause":                       "BSD-2-Clause",
+	"bsd-3-clause":                       "BSD-3-Clause",
+	"bsd-4-clause":                       "BSD-4-Clause",
+	"bsd 3-clause":                       "BSD-3-Clause",
+	"2-clause bsd":                       "BSD-2-Clause",
+	"bsd 2-clause":                       "BSD-2-Clause",
+	"isc":                                "ISC",
+	"isc license":                        "ISC",
+	"iscl":                               "ISC",
+	"mpl 2.0":                            "MPL-2.0",
+	"mpl-2":                              "MPL-2.0",
+	"mozilla public license 2.0":         "MPL-2.0",
+	"psf":                                "PSF-2.0",
+	"psfl":                               "PSF-2.0",
+	"psf license":                        "PSF-2.0",
+	"python software foundation license": "PSF-2.0",
+	"unlicense":                          "Unlicense",
+	"the unlicense":                      "Unlicense",
+	"zlib":                               "Zlib",
+	"public-domain":                      "Public Domain",
+	"public domain":                      "Public Domain",
+}
+
+// normalize returns the SPDX identifier of a license, if it's written in a way Cog knows about, or the license as
+// it's written if it isn't
+func normalize(license string) string {
+	if alias, ok := aliases[strings.ToLower(license)]; ok {
+		return alias
+	}
+	if m := gplPattern.FindStringSubmatch(license); m != nil {
+		minor := m[3]
+		if minor == "" {
+			minor = "0"
+		}
+		suffix := "-only"
+		if m[4] != "" {
+			suffix = "-or-later"
+		}
+		return strings.ToUpper(m[1]) + "GPL-" + m[2] + "." + minor + suffix
+	}
+	return license
+}
@@ -0,0 +1,51 @@
+package licenses
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExpression(t *testing.T) {
+	for _, tt := range []struct {
+		license  string
+		expected string
+	}{
+		{"MIT", "MIT"},
+		{"MIT License", "MIT"},
+		{"Apache 2.0", "Apache-2.0"},
+		{"Apache License, Version 2.0", "Apache-2.0"},
+		{"MIT OR Apache-2.0", "MIT OR Apache-2.0"},
+		{"MIT/Apache-2.0", "MIT OR Apache-2.0"},
+		{"GNU General Public License v3 (GPLv3)", "GPL-3.0-only"},
+		{"GNU Lesser General Public License v3 or later (LGPLv3+)", "LGPL-3.0-or-later"},
+		{"BSD License", "BSD License"},
+		{"GPL-2+ and LGPL-2.1+ AND GPL-2+ AND Expat", "GPL-2.0-or-later AND LGPL-2.1-or-later AND MIT"},
+		{"GPL-3+ with Bison exception AND public-domain", "GPL-3.0-or-later AND Public Domain"},
+		{"GPL-2.0-only WITH Classpath-exception-2.0", "GPL-2.0-only"},
+		{"(GPL-2+ or Artistic) AND BSD-3-clause", "(GPL-2.0-or-later OR Artistic) AND BSD-3-Clause"},
+		{"GPL-1+ or Artistic, and Expat", "(GPL-1.0-or-later OR Artistic) AND MIT"},
+		{"MIT AND Apache-2.0 OR BSD-2-Clause", "(MIT AND Apache-2.0) OR BSD-2-Clause"},
+	} {
+		t.Run(tt.license, func(t *testing.T) {
+			e := parseExpression(tt.license)
+			require.NotNil(t, e)
+			require.Equal(t, tt.expected, e.String())
+		})
+	}
+	require.Nil(t, parseExpression(""))
+	require.Nil(t, parseExpression("  "))
+}
+
+func TestExpressionAllowed(t *testing.T) {
+	forbidden := func(license string) bool { return strings.HasPrefix(license, "GPL-") }
+	require.True(t, parseExpression("MIT").allowed(forbidden))
+	require.False(t, parseExpression("GPL-3.0-only").allowed(forbidden))
+	// Either license of an OR can be chosen, so it's allowed if one of them is
+	require.True(t, parseExpression("GPL-3.0-only OR MIT").allowed(forbidden))
+	// Every license of an AND applies
+	require.False(t, parseExpression("GPL-2+ AND MIT").allowed(forbidden))
+	require.True(t, parseExpression("(GPL-2+ or Artistic) AND MIT").allowed(forbidden))
+	require.Equal(t, []string{"GPL-2.0-or-later", "Artistic", "MIT"}, parseExpression("(GPL-2+ or Artistic) AND MIT").licenses())
+}
@@ -0,0 +1,122 @@
+// Package licenses finds the licenses of the Python and system packages installed in a model's image, and checks
+// them against the licenses cog.yaml forbids.
+package licenses
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/docker"
+)
+
+//go:embed scan.py
+var scanScript string
+
+// Unknown is the license of packages that don't say what their license is
+const Unknown = "UNKNOWN"
+
+// The types of packages
+const (
+	TypePython = "python"
+	TypeSystem = "system"
+)
+
+// Package is a package installed in an image
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	// Type is TypePython or TypeSystem
+	Type string `json:"type"`
+	// License is an SPDX expression, like "MIT OR Apache-2.0", as near as it can be made from what the package says,
+	// or Unknown
+	License string `json:"license"`
+	// Forbidden is whether the package can't be used without a forbidden license
+	Forbidden bool `json:"forbidden,omitempty"`
+	// Exception is whether the package is allowed whatever its license is, because cog.yaml says so
+	Exception bool `json:"exception,omitempty"`
+}
+
+// Report is the licenses of the packages in an image
+type Report struct {
+	Image string `json:"image"`
+	// Forbidden are the licenses cog.yaml forbids
+	Forbidden []string  `json:"forbidden_licenses"`
+	Packages  []Package `json:"packages"`
+}
+
+// Scan returns the packages installed in an image, with their licenses as the packages say them
+func Scan(ctx context.Context, imageName string) ([]Package, error) {
+	var stdout, stderr bytes.Buffer
+	err := docker.RunWithIO(ctx, docker.RunOptions{
+		Image: imageName,
+		Args:  []string{"python", "-c", scanScript},
+	}, nil, &stdout, &stderr)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list the packages in %s: %w\n%s", imageName, err, stderr.String())
+	}
+	packages := []Package{}
+	if err := json.Unmarshal(stdout.Bytes(), &packages); err != nil {
+		return nil, fmt.Errorf("Failed to read the packages in %s: %w", imageName, err)
+	}
+	return packages, nil
+}
+
+// Check normalizes the packages' licenses to SPDX expressions and marks the packages that can't be used without a
+// license policy forbids. It returns a report of them, sorted by type and name.
+func Check(imageName string, packages []Package, policy *config.Licenses) *Report {
+	report := &Report{Image: imageName, Forbidden: []string{}, Packages: []Package{}}
+	if policy != nil {
+		report.Forbidden = policy.Forbidden
+	}
+	for _, pkg := range packages {
+		e := parseExpression(pkg.License)
+		if e == nil {
+			pkg.License = Unknown
+		} else {
+			pkg.License = e.String()
+			if !e.allowed(policy.IsForbidden) {
+				if policy.IsException(pkg.Name) {
+					pkg.Exception = true
+				} else {
+					pkg.Forbidden = true
+				}
+			}
+		}
+		report.Packages = append(report.Packages, pkg)
+	}
+	sort.SliceStable(report.Packages, func(i, j int) bool {
+		a, b := report.Packages[i], report.Packages[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.Name < b.Name
+	})
+	return report
+}
+
+// ForbiddenPackages returns the packages that can't be used without a forbidden license
+func (r *Report) ForbiddenPackages() []Package {
+	forbidden := []Package{}
+	for _, pkg := range r.Packages {
+		if pkg.Forbidden {
+			forbidden = append(forbidden, pkg)
+		}
+	}
+	return forbidden
+}
+
+// UnknownPackages returns the packages that don't say what their license is
+func (r *Report) UnknownPackages() []Package {
+	unknown := []Package{}
+	for _, pkg := range r.Packages {
+		if pkg.License == Unknown {
+			unknown = append(unknown, pkg)
+		}
+	}
+	return unknown
+}
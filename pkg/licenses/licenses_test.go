@@ -0,0 +1,38 @@
+package licenses
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestCheck(t *testing.T) {
+	packages := []Package{
+		{Name: "torch", Version: "2.3.0", Type: TypePython, License: "BSD License"},
+		{Name: "bash", Version: "5.2.15", Type: TypeSystem, License: "GPL-3+ AND GPL-2+"},
+		{Name: "pyqt5", Version: "5.15.10", Type: TypePython, License: "GPL v3"},
+		{Name: "chardet", Version: "5.2.0", Type: TypePython, License: "GNU Lesser General Public License v2 or later (LGPLv2+)"},
+		{Name: "regex", Version: "2024.5.15", Type: TypePython, License: "Apache-2.0 OR CNRI-Python"},
+		{Name: "mystery", Version: "1.0", Type: TypePython, License: ""},
+	}
+	policy := &config.Licenses{Forbidden: []string{"GPL-3.0-*", "lgpl-*"}, Exceptions: []string{"Bash"}}
+	report := Check("r8.im/alice/hotdog-detector", packages, policy)
+
+	require.Equal(t, "r8.im/alice/hotdog-detector", report.Image)
+	require.Equal(t, []string{"GPL-3.0-*", "lgpl-*"}, report.Forbidden)
+	require.Equal(t, []Package{
+		{Name: "chardet", Version: "5.2.0", Type: TypePython, License: "LGPL-2.0-or-later", Forbidden: true},
+		{Name: "mystery", Version: "1.0", Type: TypePython, License: Unknown},
+		{Name: "pyqt5", Version: "5.15.10", Type: TypePython, License: "GPL-3.0-only", Forbidden: true},
+		{Name: "regex", Version: "2024.5.15", Type: TypePython, License: "Apache-2.0 OR CNRI-Python"},
+		{Name: "torch", Version: "2.3.0", Type: TypePython, License: "BSD License"},
+		{Name: "bash", Version: "5.2.15", Type: TypeSystem, License: "GPL-3.0-or-later AND GPL-2.0-or-later", Exception: true},
+	}, report.Packages)
+	require.Len(t, report.ForbiddenPackages(), 2)
+	require.Equal(t, "mystery", report.UnknownPackages()[0].Name)
+
+	// Without a policy, nothing is forbidden
+	require.Empty(t, Check("r8.im/alice/hotdog-detector", packages, nil).ForbiddenPackages())
+}
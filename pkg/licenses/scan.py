@@ -0,0 +1,71 @@
+# Lists the Python and Debian packages installed in an image, and their licenses, as JSON.
+# Run by 'cog licenses' with the image's Python, so it only uses the standard library.
+import json
+import os
+from importlib import metadata
+
+
+def python_license(dist):
+    # PEP 639's License-Expression is an SPDX expression, so it's the most precise
+    expression = dist.metadata.get("License-Expression")
+    if expression:
+        return expression
+    # License is free text, which is sometimes the whole license, so only use it if it looks like a name
+    license = (dist.metadata.get("License") or "").strip()
+    if license and license.upper() != "UNKNOWN" and "\n" not in license and len(license) <= 64:
+        return license
+    classifiers = [
+        c.split(" :: ")[-1]
+        for c in dist.metadata.get_all("Classifier") or []
+        if c.startswith("License :: ") and c != "License :: OSI Approved"
+    ]
+    return " OR ".join(classifiers)
+
+
+def debian_packages():
+    try:
+        with open("/var/lib/dpkg/status", encoding="utf-8", errors="replace") as f:
+            status = f.read()
+    except OSError:
+        return
+    for paragraph in status.split("\n\n"):
+        fields = {}
+        for line in paragraph.splitlines():
+            if line and not line[0].isspace() and ":" in line:
+                key, _, value = line.partition(":")
+                fields[key] = value.strip()
+        if "Package" not in fields or not fields.get("Status", "").endswith(" installed"):
+            continue
+        yield fields["Package"], fields.get("Version", "")
+
+
+def debian_license(name):
+    # Machine-readable copyright files list the license of each part of the package in License: fields. Other
+    # copyright files are free text, which can't be read reliably, so their packages' licenses are unknown.
+    licenses = []
+    try:
+        with open(f"/usr/share/doc/{name}/copyright", encoding="utf-8", errors="replace") as f:
+            if not f.readline().startswith("Format:"):
+                return ""
+            for line in f:
+                if line.startswith("License:"):
+                    license = line[len("License:"):].strip()
+                    # The license's name is on the first line. Some files put its text there instead.
+                    if license and len(license.split()) <= 8 and license not in licenses:
+                        licenses.append(license)
+    except OSError:
+        pass
+    return " AND ".join(f"({l})" if " or " in l.lower() else l for l in licenses)
+
+
+packages = []
+seen = set()
+for dist in metadata.distributions():
+    name = dist.metadata.get("Name")
+    if not name or name.lower() in seen:
+        continue
+    seen.add(name.lower())
+    packages.append({"name": name, "version": dist.version, "type": "python", "license": python_license(dist)})
+for name, version in debian_packages():
+    packages.append({"name": name, "version": version, "type": "system", "license": debian_license(name)})
+print(json.dumps(packages))
@@ -0,0 +1,43 @@
+package lint
+
+import (
+	"fmt"
+	"io/fs"
+
+	"github.com/docker/go-units"
+
+	"github.com/replicate/cog/pkg/dockerfile"
+)
+
+// largeFileSize is the size of files in the build context that are worth keeping out of it
+const largeFileSize = 100 * 1024 * 1024
+
+// buildContextProblems returns the problems with the files that are sent to Docker when the model is built: whether
+// there's a .dockerignore, and the large files that it doesn't exclude
+func buildContextProblems(dir string) ([]Problem, error) {
+	problems := []Problem{}
+	hasDockerignore, err := dockerfile.WalkBuildContext(dir, func(rel string, info fs.FileInfo) error {
+		if info.Size() >= largeFileSize {
+			problems = append(problems, Problem{
+				Rule:     RuleLargeFile,
+				Severity: SeverityWarning,
+				File:     rel,
+				Message: fmt.Sprintf("%s is %s, and it's sent to Docker each time the model is built. If it's model weights, add it to .dockerignore and download it with weights in cog.yaml, or build with --separate-weights",
+					rel, units.HumanSize(float64(info.Size()))),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !hasDockerignore {
+		problems = append([]Problem{{
+			Rule:     RuleDockerignore,
+			Severity: SeverityWarning,
+			File:     ".dockerignore",
+			Message:  "There's no .dockerignore, so everything in the project, like .git and virtualenvs, is sent to Docker each time the model is built",
+		}}, problems...)
+	}
+	return problems, nil
+}
@@ -0,0 +1,27 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{".dockerignore": "ignored.bin\n", "predict.py": ""})
+	for _, name := range []string{"model.bin", "ignored.bin"} {
+		f, err := os.Create(filepath.Join(dir, name))
+		require.NoError(t, err)
+		require.NoError(t, f.Truncate(largeFileSize))
+		require.NoError(t, f.Close())
+	}
+
+	problems, err := buildContextProblems(dir)
+	require.NoError(t, err)
+	require.Len(t, problems, 1)
+	require.Equal(t, RuleLargeFile, problems[0].Rule)
+	require.Equal(t, "model.bin", problems[0].File)
+	require.Contains(t, problems[0].Message, "model.bin is 104.9MB")
+}
@@ -0,0 +1,70 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// unpinnedDependencies returns the Python packages in build.python_packages and the requirements file in
+// build.python_requirements that aren't pinned to a version, so each build can install a different one
+func unpinnedDependencies(cfg *config.Config, dir string, doc *yaml.Node) ([]Problem, error) {
+	problems := []Problem{}
+	for _, requirement := range cfg.Build.PythonPackages {
+		if !isPinned(requirement) {
+			problems = append(problems, unpinnedProblem(global.ConfigFilename, keyLine(doc, "build", "python_packages"), requirement))
+		}
+	}
+	if cfg.Build.PythonRequirements == "" {
+		return problems, nil
+	}
+
+	contents, err := os.ReadFile(filepath.Join(dir, cfg.Build.PythonRequirements))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", cfg.Build.PythonRequirements, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for line := 1; scanner.Scan(); line++ {
+		requirement, _, _ := strings.Cut(scanner.Text(), "#")
+		requirement = strings.TrimSpace(requirement)
+		if requirement != "" && !isPinned(requirement) {
+			problems = append(problems, unpinnedProblem(cfg.Build.PythonRequirements, line, requirement))
+		}
+	}
+	return problems, nil
+}
+
+func unpinnedProblem(file string, line int, requirement string) Problem {
+	message := fmt.Sprintf("%s isn't pinned to a version, so each build might install a different one. Pin it like %s==<version>", requirement, config.PythonPackageName(requirement))
+	if config.PythonPackageName(requirement) == "" {
+		message = fmt.Sprintf("%s isn't pinned to a version, so each build might install a different one", requirement)
+	}
+	return Problem{
+		Rule:     RuleUnpinnedDependency,
+		Severity: SeverityWarning,
+		File:     file,
+		Line:     line,
+		Message:  message,
+	}
+}
+
+// isPinned returns whether a pip requirement is pinned to a version, or isn't a package from an index, like a
+// pip option or a URL
+func isPinned(requirement string) bool {
+	if strings.HasPrefix(requirement, "-") || strings.Contains(requirement, "://") || strings.Contains(requirement, " @ ") {
+		return true
+	}
+	if strings.HasPrefix(requirement, ".") || strings.HasPrefix(requirement, "/") || strings.HasSuffix(requirement, ".whl") {
+		return true
+	}
+	specifier, _, _ := strings.Cut(requirement, ";")
+	return strings.Contains(specifier, "==")
+}
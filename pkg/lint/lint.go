@@ -0,0 +1,154 @@
+// Package lint checks a Cog project for common mistakes, like unpinned dependencies and secrets in cog.yaml
+package lint
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// The rules that problems are found by
+const (
+	RuleUnpinnedDependency = "unpinned-dependency"
+	RuleDockerignore       = "dockerignore"
+	RuleLargeFile          = "large-file"
+	RuleDeprecatedLayout   = "deprecated-layout"
+	RulePreInstall         = "pre-install"
+	RuleInsecure           = "insecure"
+)
+
+// Problem is something in a project that lint found
+type Problem struct {
+	Rule     string
+	Severity Severity
+	// File is the path of the file the problem is in, relative to the project
+	File string
+	// Line is the line of File the problem is on, starting at 1, or 0 if it isn't on a line
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location = fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", location, p.Severity, p.Message, p.Rule)
+}
+
+// Lint returns the problems in the project in dir, which has the config cfg, in the order of the files they're in
+func Lint(cfg *config.Config, dir string) ([]Problem, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, global.ConfigFilename))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", global.ConfigFilename, err)
+	}
+	doc := &yaml.Node{}
+	if err := yaml.Unmarshal(contents, doc); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", global.ConfigFilename, err)
+	}
+
+	problems := []Problem{}
+	dependencies, err := unpinnedDependencies(cfg, dir, doc)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, dependencies...)
+
+	deprecated, err := deprecatedConfig(cfg, contents, doc)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, deprecated...)
+
+	problems = append(problems, insecureConfig(cfg, dir, doc)...)
+
+	buildContext, err := buildContextProblems(dir)
+	if err != nil {
+		return nil, err
+	}
+	problems = append(problems, buildContext...)
+
+	slices.SortStableFunc(problems, func(a, b Problem) int {
+		switch {
+		case a.File == b.File:
+		case a.File == global.ConfigFilename:
+			// cog.yaml first
+			return -1
+		case b.File == global.ConfigFilename:
+			return 1
+		default:
+			return strings.Compare(a.File, b.File)
+		}
+		return cmp.Compare(a.Line, b.Line)
+	})
+	return problems, nil
+}
+
+// deprecatedConfig returns the keys in cog.yaml that are deprecated
+func deprecatedConfig(cfg *config.Config, contents []byte, doc *yaml.Node) ([]Problem, error) {
+	problems := []Problem{}
+	_, changes, err := config.Migrate(contents)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		problems = append(problems, Problem{
+			Rule:     RuleDeprecatedLayout,
+			Severity: SeverityWarning,
+			File:     global.ConfigFilename,
+			Message:  fmt.Sprintf("cog.yaml has an old layout, which needs upgrading: %s", change),
+		})
+	}
+	if len(cfg.Build.PreInstall) > 0 {
+		problems = append(problems, Problem{
+			Rule:     RulePreInstall,
+			Severity: SeverityWarning,
+			File:     global.ConfigFilename,
+			Line:     keyLine(doc, "build", "pre_install"),
+			Message:  "build.pre_install is deprecated. Put the commands at the end of build.run instead",
+		})
+	}
+	return problems, nil
+}
+
+// keyLine returns the line of a key in a YAML document, like keyLine(doc, "build", "args"), or 0 if it isn't there
+func keyLine(doc *yaml.Node, path ...string) int {
+	if len(doc.Content) == 0 {
+		return 0
+	}
+	node := doc.Content[0]
+	line := 0
+	for _, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return 0
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				line = node.Content[i].Line
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0
+		}
+	}
+	return line
+}
@@ -0,0 +1,85 @@
+package lint
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	}
+}
+
+func lintProject(t *testing.T, files map[string]string) []Problem {
+	t.Helper()
+	dir := t.TempDir()
+	writeFiles(t, dir, files)
+	cfg, _, err := config.GetConfig(dir)
+	require.NoError(t, err)
+	problems, err := Lint(cfg, dir)
+	require.NoError(t, err)
+	return problems
+}
+
+func TestLint(t *testing.T) {
+	problems := lintProject(t, map[string]string{
+		"cog.yaml": `build:
+  python_version: "3.12"
+  python_requirements: requirements.txt
+  args:
+    HF_TOKEN: hf_abc
+    MODEL_NAME: sdxl
+  run:
+    - curl -fsSL https://example.com/install.sh | sh
+  pre_install:
+    - pip install --upgrade pip
+environment_variables:
+  OPENAI_API_KEY: sk-abc
+predict: predict.py:Predictor
+serve:
+  cors:
+    allowed_origins: ["*"]
+`,
+		"requirements.txt": "--extra-index-url https://download.pytorch.org/whl/cu121\ntorch==2.3.1\nnumpy>=1.26 # arrays\n\n./vendor/package\n",
+		"predict.py":       "",
+	})
+
+	require.Equal(t, []Problem{
+		{Rule: RuleInsecure, Severity: SeverityError, File: "cog.yaml", Line: 5, Message: "build.args.HF_TOKEN looks like a secret. Build args end up in the image's history, so anyone who can pull the image can read it. Use a secret mount in build.run instead"},
+		{Rule: RuleInsecure, Severity: SeverityWarning, File: "cog.yaml", Line: 7, Message: `"curl -fsSL https://example.com/install.sh | sh" runs a script that it downloads without checking it. Download it, check its checksum, then run it`},
+		{Rule: RulePreInstall, Severity: SeverityWarning, File: "cog.yaml", Line: 9, Message: "build.pre_install is deprecated. Put the commands at the end of build.run instead"},
+		{Rule: RuleInsecure, Severity: SeverityError, File: "cog.yaml", Line: 12, Message: "environment_variables.OPENAI_API_KEY looks like a secret. cog.yaml is copied into the image, so anyone who can pull the image can read it. Put it in secrets instead"},
+		{Rule: RuleInsecure, Severity: SeverityWarning, File: "cog.yaml", Line: 16, Message: "serve.cors.allowed_origins lets any web page call the model from a browser. List the origins that need to instead"},
+		{Rule: RuleDockerignore, Severity: SeverityWarning, File: ".dockerignore", Message: "There's no .dockerignore, so everything in the project, like .git and virtualenvs, is sent to Docker each time the model is built"},
+		{Rule: RuleUnpinnedDependency, Severity: SeverityWarning, File: "requirements.txt", Line: 3, Message: "numpy>=1.26 isn't pinned to a version, so each build might install a different one. Pin it like numpy==<version>"},
+	}, problems)
+}
+
+func TestLintDeprecatedLayout(t *testing.T) {
+	problems := lintProject(t, map[string]string{
+		"cog.yaml":      "environment:\n  python_version: \"3.12\"\n  python_packages:\n    - torch\nmodel: predict.py:Predictor\n",
+		".dockerignore": ".git\n",
+	})
+	require.Len(t, problems, 3)
+	require.Equal(t, RuleUnpinnedDependency, problems[0].Rule)
+	require.Equal(t, "cog.yaml", problems[0].File)
+	require.Equal(t, RuleDeprecatedLayout, problems[1].Rule)
+	require.Equal(t, RuleDeprecatedLayout, problems[2].Rule)
+}
+
+func TestLintNoProblems(t *testing.T) {
+	problems := lintProject(t, map[string]string{
+		"cog.yaml":      "build:\n  python_version: \"3.12\"\n  python_packages:\n    - torch==2.3.1\npredict: predict.py:Predictor\n",
+		".dockerignore": ".git\n",
+	})
+	require.Empty(t, problems)
+}
@@ -0,0 +1,87 @@
+package lint
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/global"
+)
+
+var (
+	// pipeToShellPattern matches commands that run a script they download, like "curl -fsSL https://... | sh"
+	pipeToShellPattern = regexp.MustCompile(`\b(curl|wget)\b[^|]*\|\s*(sudo\s+)?(ba|z)?sh\b`)
+	// noTLSVerifyPattern matches options that turn off TLS certificate verification
+	noTLSVerifyPattern = regexp.MustCompile(`(^|\s)(-k|--insecure|--no-check-certificate|--trusted-host)(\s|=|$)`)
+)
+
+// insecureConfig returns the settings in cog.yaml, and the options in the requirements file, that put secrets in the
+// image or make the model's build or server insecure
+func insecureConfig(cfg *config.Config, dir string, doc *yaml.Node) []Problem {
+	problems := []Problem{}
+	insecure := func(file string, line int, severity Severity, format string, a ...any) {
+		problems = append(problems, Problem{Rule: RuleInsecure, Severity: severity, File: file, Line: line, Message: fmt.Sprintf(format, a...)})
+	}
+
+	for _, name := range sortedKeys(cfg.Build.Args) {
+		if config.IsSecretName(name) && cfg.Build.Args[name] != "" {
+			insecure(global.ConfigFilename, keyLine(doc, "build", "args", name), SeverityError,
+				"build.args.%s looks like a secret. Build args end up in the image's history, so anyone who can pull the image can read it. Use a secret mount in build.run instead", name)
+		}
+	}
+	for _, name := range sortedKeys(cfg.EnvironmentVariables) {
+		if config.IsSecretName(name) && cfg.EnvironmentVariables[name] != "" {
+			insecure(global.ConfigFilename, keyLine(doc, "environment_variables", name), SeverityError,
+				"environment_variables.%s looks like a secret. cog.yaml is copied into the image, so anyone who can pull the image can read it. Put it in secrets instead", name)
+		}
+	}
+
+	for _, run := range cfg.Build.Run {
+		if pipeToShellPattern.MatchString(run.Command) {
+			insecure(global.ConfigFilename, keyLine(doc, "build", "run"), SeverityWarning,
+				"%q runs a script that it downloads without checking it. Download it, check its checksum, then run it", run.Command)
+		}
+		if noTLSVerifyPattern.MatchString(run.Command) {
+			insecure(global.ConfigFilename, keyLine(doc, "build", "run"), SeverityWarning,
+				"%q turns off TLS certificate verification, so what it downloads could be tampered with", run.Command)
+		}
+	}
+	if cfg.Build.PythonRequirements != "" {
+		if contents, err := os.ReadFile(filepath.Join(dir, cfg.Build.PythonRequirements)); err == nil {
+			for i, line := range strings.Split(string(contents), "\n") {
+				if strings.HasPrefix(strings.TrimSpace(line), "--trusted-host") {
+					insecure(cfg.Build.PythonRequirements, i+1, SeverityWarning,
+						"--trusted-host turns off TLS certificate verification for the package index, so the packages pip installs could be tampered with")
+				}
+			}
+		}
+	}
+
+	if cfg.Serve != nil {
+		if cfg.Serve.CORS != nil && slices.Contains(cfg.Serve.CORS.AllowedOrigins, "*") {
+			insecure(global.ConfigFilename, keyLine(doc, "serve", "cors", "allowed_origins"), SeverityWarning,
+				"serve.cors.allowed_origins lets any web page call the model from a browser. List the origins that need to instead")
+		}
+		if strings.HasPrefix(cfg.Serve.OutputUploadURL, "http://") {
+			insecure(global.ConfigFilename, keyLine(doc, "serve", "output_upload_url"), SeverityWarning,
+				"serve.output_upload_url isn't HTTPS, so outputs are uploaded unencrypted")
+		}
+	}
+	return problems
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,94 @@
+package manifests
+
+import (
+	"fmt"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// DefaultDevicePluginNamespace is the namespace NVIDIA's GPU operator runs the device plugin in, which reads its
+// configs from a ConfigMap there
+const DefaultDevicePluginNamespace = "gpu-operator"
+
+// A Kubernetes ConfigMap
+type configMap struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   map[string]string `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+}
+
+// The config file of NVIDIA's device plugin, as much of it as sharing GPUs needs
+type devicePluginConfig struct {
+	Version string               `yaml:"version"`
+	Flags   map[string]string    `yaml:"flags,omitempty"`
+	Sharing *devicePluginSharing `yaml:"sharing,omitempty"`
+}
+
+type devicePluginSharing struct {
+	TimeSlicing *sharedGPUs `yaml:"timeSlicing,omitempty"`
+	MPS         *sharedGPUs `yaml:"mps,omitempty"`
+}
+
+type sharedGPUs struct {
+	// RenameByDefault gives pods shares of GPUs as config.SharedGPUResource rather than config.GPUResource, so pods
+	// that need a whole GPU don't get a share of one
+	RenameByDefault bool `yaml:"renameByDefault"`
+	// FailRequestsGreaterThanOne stops pods asking for more than one share, which could be shares of the same GPU
+	FailRequestsGreaterThanOne bool              `yaml:"failRequestsGreaterThanOne"`
+	Resources                  []sharedGPUsEntry `yaml:"resources"`
+}
+
+type sharedGPUsEntry struct {
+	Name     string `yaml:"name"`
+	Replicas int    `yaml:"replicas"`
+}
+
+// DevicePluginConfigKey returns the name of the device plugin config that shares GPUs the way the model does, like
+// mps-4. Nodes are labelled with it to share their GPUs that way.
+func DevicePluginConfigKey(sharing *config.GPUSharing) string {
+	if sharing.Strategy == config.GPUSharingMIG {
+		return "mig-mixed"
+	}
+	return fmt.Sprintf("%s-%d", sharing.Strategy, sharing.ReplicasOrDefault())
+}
+
+// DevicePluginConfig returns a ConfigMap with a config for NVIDIA's device plugin that shares GPUs the way
+// resources.gpu_sharing in cog.yaml says, which the GPU operator can read the device plugin's configs from
+func DevicePluginConfig(cfg *config.Config, name string, namespace string) ([]byte, error) {
+	if cfg.Resources == nil || cfg.Resources.GPUSharing == nil {
+		return nil, fmt.Errorf("resources.gpu_sharing isn't set in cog.yaml, so the model doesn't share GPUs")
+	}
+	sharing := cfg.Resources.GPUSharing
+
+	c := devicePluginConfig{Version: "v1"}
+	switch sharing.Strategy {
+	case config.GPUSharingMIG:
+		// With the mixed strategy, each size of MIG partition is a resource of its own, like nvidia.com/mig-1g.10gb
+		c.Flags = map[string]string{"migStrategy": "mixed"}
+	case config.GPUSharingTimeSlicing, config.GPUSharingMPS:
+		shared := &sharedGPUs{
+			RenameByDefault:            true,
+			FailRequestsGreaterThanOne: true,
+			Resources:                  []sharedGPUsEntry{{Name: config.GPUResource, Replicas: sharing.ReplicasOrDefault()}},
+		}
+		c.Sharing = &devicePluginSharing{}
+		if sharing.Strategy == config.GPUSharingMPS {
+			c.Sharing.MPS = shared
+		} else {
+			c.Sharing.TimeSlicing = shared
+		}
+	}
+	data, err := encode(c)
+	if err != nil {
+		return nil, err
+	}
+
+	m := configMap{
+		APIVersion: "v1",
+		Kind:       "ConfigMap",
+		Metadata:   map[string]string{"name": name, "namespace": namespace},
+		Data:       map[string]string{DevicePluginConfigKey(sharing): string(data)},
+	}
+	return marshal(m, "cog export device-plugin-config")
+}
@@ -0,0 +1,50 @@
+package manifests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+func TestDevicePluginConfig(t *testing.T) {
+	cfg := &config.Config{
+		Build:     &config.Build{GPU: true},
+		Resources: &config.Resources{GPUSharing: &config.GPUSharing{Strategy: config.GPUSharingMPS, Replicas: 4}},
+	}
+	require.Equal(t, "mps-4", DevicePluginConfigKey(cfg.Resources.GPUSharing))
+	manifest, err := DevicePluginConfig(cfg, "cog-device-plugin-config", DefaultDevicePluginNamespace)
+	require.NoError(t, err)
+	require.Equal(t, `# Generated by cog export device-plugin-config
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cog-device-plugin-config
+  namespace: gpu-operator
+data:
+  mps-4: |
+    version: v1
+    sharing:
+      mps:
+        renameByDefault: true
+        failRequestsGreaterThanOne: true
+        resources:
+          - name: nvidia.com/gpu
+            replicas: 4
+`, string(manifest))
+
+	cfg.Resources.GPUSharing = &config.GPUSharing{Strategy: config.GPUSharingTimeSlicing}
+	manifest, err = DevicePluginConfig(cfg, "cog-device-plugin-config", DefaultDevicePluginNamespace)
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), "  time-slicing-2: |\n    version: v1\n    sharing:\n      timeSlicing:\n")
+
+	cfg.Resources.GPUSharing = &config.GPUSharing{Strategy: config.GPUSharingMIG, MIGProfile: "1g.10gb"}
+	manifest, err = DevicePluginConfig(cfg, "cog-device-plugin-config", DefaultDevicePluginNamespace)
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), "  mig-mixed: |\n    version: v1\n    flags:\n      migStrategy: mixed\n")
+
+	cfg.Resources = nil
+	_, err = DevicePluginConfig(cfg, "cog-device-plugin-config", DefaultDevicePluginNamespace)
+	require.ErrorContains(t, err, "resources.gpu_sharing isn't set")
+}
@@ -0,0 +1,48 @@
+package manifests
+
+import (
+	"github.com/replicate/cog/pkg/config"
+)
+
+// KServe's InferenceService, as much of it as models need
+type inferenceService struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   map[string]string `yaml:"metadata"`
+	Spec       struct {
+		Predictor struct {
+			MinReplicas          int               `yaml:"minReplicas"`
+			MaxReplicas          int               `yaml:"maxReplicas"`
+			ContainerConcurrency int               `yaml:"containerConcurrency"`
+			ProtocolVersion      string            `yaml:"protocolVersion,omitempty"`
+			NodeSelector         map[string]string `yaml:"nodeSelector,omitempty"`
+			Containers           []container       `yaml:"containers"`
+		} `yaml:"predictor"`
+	} `yaml:"spec"`
+}
+
+// InferenceService returns a KServe InferenceService that runs a model with a custom predictor
+func InferenceService(cfg *config.Config, o Options) ([]byte, error) {
+	if err := o.validate(cfg); err != nil {
+		return nil, err
+	}
+	s := inferenceService{
+		APIVersion: "serving.kserve.io/v1beta1",
+		Kind:       "InferenceService",
+		Metadata:   map[string]string{"name": o.Name},
+	}
+	p := &s.Spec.Predictor
+	p.MinReplicas = o.MinReplicas
+	p.MaxReplicas = o.MaxReplicas
+	// KServe scales on how many requests each replica is running, so it needs to know how many it can run at once
+	p.ContainerConcurrency = concurrency(cfg)
+	if o.Protocol == ProtocolV2 {
+		p.ProtocolVersion = "v2"
+	}
+	p.NodeSelector = cfg.Resources.KubernetesNodeSelector()
+	// KServe sends requests to the container named kserve-container, on the port it listens on
+	c := modelContainer(cfg, o, "kserve-container")
+	c.Ports = []port{{ContainerPort: config.RunnerPort, Protocol: "TCP"}}
+	p.Containers = []container{c}
+	return marshal(s, "cog export kserve")
+}
@@ -0,0 +1,166 @@
+// Package manifests generates Kubernetes manifests that run a model with a model serving operator, like KServe or
+// Seldon Core, for clusters that serve all their models with one.
+package manifests
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// The protocols the operator can send requests to the model in
+const (
+	// ProtocolCog is Cog's HTTP API, POST /predictions
+	ProtocolCog = "cog"
+	// ProtocolV2 is the Open Inference Protocol, POST /v2/models/<name>/infer, which KServe calls V2
+	ProtocolV2 = "v2"
+)
+
+// GPUResource is the Kubernetes resource NVIDIA's device plugin gives pods GPUs with
+const GPUResource = config.GPUResource
+
+// Options are how the operator runs a model
+type Options struct {
+	// Name is the name of the model's resource, and of the model in the Open Inference Protocol
+	Name string
+	// Image is the model's image, in a registry the cluster can pull from
+	Image string
+	// MinReplicas and MaxReplicas are how many copies of the model the operator scales between
+	MinReplicas int
+	MaxReplicas int
+	// Protocol is the protocol the operator sends requests in, ProtocolCog or ProtocolV2
+	Protocol string
+	// SecretName is the Secret the model reads the secrets in cog.yaml from, with a key for each of them. Defaults
+	// to Name.
+	SecretName string
+}
+
+var resourceNameIllegalChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// ResourceName returns a Kubernetes resource name for an image, like hotdog-detector for
+// r8.im/alice/hotdog_detector:latest
+func ResourceName(imageName string) (string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	resourceName := resourceNameIllegalChars.ReplaceAllString(path.Base(ref.Context().RepositoryStr()), "-")
+	return strings.Trim(resourceName, "-"), nil
+}
+
+func (o Options) validate(cfg *config.Config) error {
+	if cfg.Build.Target != "" {
+		return fmt.Errorf("The model is built to run on %s, not a server, so it can't run on Kubernetes. Remove build.target from cog.yaml", cfg.Build.Target)
+	}
+	if o.Protocol != ProtocolCog && o.Protocol != ProtocolV2 {
+		return fmt.Errorf("Invalid protocol %q, expected %s or %s", o.Protocol, ProtocolCog, ProtocolV2)
+	}
+	if o.MinReplicas < 0 || o.MaxReplicas < 1 || o.MinReplicas > o.MaxReplicas {
+		return fmt.Errorf("Invalid replicas %d to %d, expected the most to be at least 1 and at least the fewest", o.MinReplicas, o.MaxReplicas)
+	}
+	return nil
+}
+
+type container struct {
+	Name           string         `yaml:"name"`
+	Image          string         `yaml:"image"`
+	Ports          []port         `yaml:"ports,omitempty"`
+	Env            []envVar       `yaml:"env,omitempty"`
+	Resources      *resources     `yaml:"resources,omitempty"`
+	ReadinessProbe map[string]any `yaml:"readinessProbe"`
+}
+
+type port struct {
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type envVar struct {
+	Name      string         `yaml:"name"`
+	Value     string         `yaml:"value,omitempty"`
+	ValueFrom map[string]any `yaml:"valueFrom,omitempty"`
+}
+
+type resources struct {
+	Requests map[string]string `yaml:"requests,omitempty"`
+	Limits   map[string]string `yaml:"limits,omitempty"`
+}
+
+// modelContainer returns the container that runs the model's HTTP server, with the resources, environment variables
+// and secrets in cog.yaml
+func modelContainer(cfg *config.Config, o Options, containerName string) container {
+	c := container{Name: containerName, Image: o.Image}
+
+	names := make([]string, 0, len(cfg.EnvironmentVariables))
+	for n := range cfg.EnvironmentVariables {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		c.Env = append(c.Env, envVar{Name: n, Value: cfg.EnvironmentVariables[n]})
+	}
+	secretName := o.SecretName
+	if secretName == "" {
+		secretName = o.Name
+	}
+	for _, secret := range cfg.Secrets {
+		c.Env = append(c.Env, envVar{Name: secret.Name, ValueFrom: map[string]any{
+			"secretKeyRef": map[string]string{"name": secretName, "key": secret.Name},
+		}})
+	}
+
+	requests, limits := cfg.Resources.KubernetesResources(cfg.Build.GPU)
+	if len(requests) > 0 || len(limits) > 0 {
+		c.Resources = &resources{Requests: requests, Limits: limits}
+	}
+
+	// Cog creates the ready file when setup() has finished, so the model only gets requests once it can run them
+	probeDir := "/var/run/cog"
+	if stateDir := cfg.StateDir(); stateDir != "" {
+		probeDir = path.Join(stateDir, "cog")
+	}
+	c.ReadinessProbe = map[string]any{
+		"exec":          map[string]any{"command": []string{"test", "-f", path.Join(probeDir, "ready")}},
+		"periodSeconds": 10,
+	}
+	return c
+}
+
+// marshal returns a manifest as YAML, with a comment saying where it came from
+func marshal(manifest any, generatedBy string) ([]byte, error) {
+	data, err := encode(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(fmt.Sprintf("# Generated by %s\n", generatedBy)), data...), nil
+}
+
+// encode returns v as YAML, indented with two spaces like Kubernetes' manifests are
+func encode(v any) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func concurrency(cfg *config.Config) int {
+	// Cog's server runs one prediction at a time, unless concurrency.max says it can run more
+	if cfg.Concurrency != nil && cfg.Concurrency.Max > 0 {
+		return cfg.Concurrency.Max
+	}
+	return 1
+}
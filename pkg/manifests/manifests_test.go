@@ -0,0 +1,184 @@
+package manifests
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "properties": {
+          "steps": {"type": "integer", "x-order": 1},
+          "prompt": {"type": "string", "x-order": 0},
+          "image": {"type": "string", "format": "uri", "x-order": 2},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "x-order": 3},
+          "weights": {"type": "array", "items": {"type": "number"}, "x-order": 4},
+          "options": {"type": "object", "x-order": 5}
+        }
+      },
+      "scheduler": {"type": "string", "title": "scheduler", "enum": ["DDIM", "K_EULER"]},
+      "Output": {"type": "array", "title": "Output", "items": {"type": "string", "format": "uri"}}
+    }
+  }
+}`
+
+const testImage = "r8.im/alice/hotdog-detector:v2"
+
+func TestV2Metadata(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	metadata, unmapped := V2Metadata("hotdog-detector", schema)
+	require.Equal(t, ModelMetadata{
+		Name:     "hotdog-detector",
+		Platform: "cog",
+		Inputs: []Tensor{
+			{Name: "prompt", Datatype: "BYTES", Shape: []int64{1}},
+			{Name: "steps", Datatype: "INT64", Shape: []int64{1}},
+			{Name: "image", Datatype: "BYTES", Shape: []int64{1}},
+			{Name: "scheduler", Datatype: "BYTES", Shape: []int64{1}},
+			{Name: "weights", Datatype: "FP64", Shape: []int64{-1}},
+		},
+		Outputs: []Tensor{{Name: "output", Datatype: "BYTES", Shape: []int64{-1}}},
+	}, metadata)
+	require.Equal(t, []string{"options"}, unmapped)
+}
+
+func TestInferenceService(t *testing.T) {
+	cfg := &config.Config{
+		Build:                &config.Build{GPU: true},
+		Resources:            &config.Resources{CPU: 4, Memory: "16Gi"},
+		Concurrency:          &config.Concurrency{Max: 4},
+		EnvironmentVariables: map[string]string{"MODEL_SIZE": "large"},
+		Secrets:              []config.Secret{{Name: "HF_TOKEN", Env: "HF_TOKEN"}},
+	}
+	manifest, err := InferenceService(cfg, Options{Name: "hotdog-detector", Image: testImage, MinReplicas: 0, MaxReplicas: 3, Protocol: ProtocolCog})
+	require.NoError(t, err)
+	require.Equal(t, `# Generated by cog export kserve
+apiVersion: serving.kserve.io/v1beta1
+kind: InferenceService
+metadata:
+  name: hotdog-detector
+spec:
+  predictor:
+    minReplicas: 0
+    maxReplicas: 3
+    containerConcurrency: 4
+    containers:
+      - name: kserve-container
+        image: r8.im/alice/hotdog-detector:v2
+        ports:
+          - containerPort: 5000
+            protocol: TCP
+        env:
+          - name: MODEL_SIZE
+            value: large
+          - name: HF_TOKEN
+            valueFrom:
+              secretKeyRef:
+                key: HF_TOKEN
+                name: hotdog-detector
+        resources:
+          requests:
+            cpu: "4"
+            memory: 16384Mi
+          limits:
+            memory: 16384Mi
+            nvidia.com/gpu: "1"
+        readinessProbe:
+          exec:
+            command:
+              - test
+              - -f
+              - /var/run/cog/ready
+          periodSeconds: 10
+`, string(manifest))
+
+	manifest, err = InferenceService(cfg, Options{Name: "hotdog-detector", Image: testImage, MaxReplicas: 1, Protocol: ProtocolV2})
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), "protocolVersion: v2\n")
+
+	_, err = InferenceService(cfg, Options{Name: "hotdog-detector", Image: testImage, MinReplicas: 2, MaxReplicas: 1, Protocol: ProtocolCog})
+	require.ErrorContains(t, err, "Invalid replicas")
+}
+
+func TestInferenceServiceWithGPUSharing(t *testing.T) {
+	cfg := &config.Config{
+		Build:     &config.Build{GPU: true},
+		Resources: &config.Resources{GPUSharing: &config.GPUSharing{Strategy: config.GPUSharingTimeSlicing}},
+	}
+	manifest, err := InferenceService(cfg, Options{Name: "hotdog-detector", Image: testImage, MaxReplicas: 1, Protocol: ProtocolCog})
+	require.NoError(t, err)
+	require.Contains(t, string(manifest), "    nodeSelector:\n      nvidia.com/gpu.sharing-strategy: time-slicing\n")
+	require.Contains(t, string(manifest), "            nvidia.com/gpu.shared: \"1\"\n")
+
+	cfg.Resources.GPUSharing = &config.GPUSharing{Strategy: config.GPUSharingMIG, MIGProfile: "1g.10gb"}
+	manifest, err = SeldonDeployment(cfg, Options{Name: "hotdog-detector", Image: testImage, MaxReplicas: 1, Protocol: ProtocolV2})
+	require.NoError(t, err)
+	require.NotContains(t, string(manifest), "nodeSelector")
+	require.Contains(t, string(manifest), "nvidia.com/mig-1g.10gb: \"1\"\n")
+}
+
+func TestSeldonDeployment(t *testing.T) {
+	cfg := &config.Config{Build: &config.Build{ReadOnlyRootFilesystem: true}}
+	manifest, err := SeldonDeployment(cfg, Options{Name: "hotdog-detector", Image: testImage, MinReplicas: 1, MaxReplicas: 3, Protocol: ProtocolV2})
+	require.NoError(t, err)
+	require.Equal(t, `# Generated by cog export seldon
+apiVersion: machinelearning.seldon.io/v1
+kind: SeldonDeployment
+metadata:
+  name: hotdog-detector
+spec:
+  protocol: v2
+  predictors:
+    - name: default
+      replicas: 1
+      componentSpecs:
+        - spec:
+            containers:
+              - name: model
+                image: r8.im/alice/hotdog-detector:v2
+                env:
+                  - name: PORT
+                    value: "9000"
+                readinessProbe:
+                  exec:
+                    command:
+                      - test
+                      - -f
+                      - /tmp/cog/ready
+                  periodSeconds: 10
+          hpaSpec:
+            maxReplicas: 3
+            metrics:
+              - resource:
+                  name: cpu
+                  target:
+                    averageUtilization: 80
+                    type: Utilization
+                type: Resource
+            minReplicas: 1
+      graph:
+        name: model
+        type: MODEL
+`, string(manifest))
+
+	_, err = SeldonDeployment(cfg, Options{Name: "hotdog-detector", Image: testImage, MaxReplicas: 1, Protocol: ProtocolCog})
+	require.ErrorContains(t, err, "Open Inference Protocol")
+}
+
+func TestResourceName(t *testing.T) {
+	resourceName, err := ResourceName("r8.im/alice/hotdog_detector:latest")
+	require.NoError(t, err)
+	require.Equal(t, "hotdog-detector", resourceName)
+}
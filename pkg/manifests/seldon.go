@@ -0,0 +1,79 @@
+package manifests
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/replicate/cog/pkg/config"
+)
+
+// seldonPort is the port Seldon Core sends requests to the model's container on
+const seldonPort = 9000
+
+// Seldon Core's SeldonDeployment, as much of it as models need
+type seldonDeployment struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   map[string]string `yaml:"metadata"`
+	Spec       struct {
+		Protocol   string            `yaml:"protocol"`
+		Predictors []seldonPredictor `yaml:"predictors"`
+	} `yaml:"spec"`
+}
+
+type seldonPredictor struct {
+	Name           string                `yaml:"name"`
+	Replicas       int                   `yaml:"replicas"`
+	ComponentSpecs []seldonComponentSpec `yaml:"componentSpecs"`
+	Graph          map[string]any        `yaml:"graph"`
+}
+
+type seldonComponentSpec struct {
+	Spec struct {
+		NodeSelector map[string]string `yaml:"nodeSelector,omitempty"`
+		Containers   []container       `yaml:"containers"`
+	} `yaml:"spec"`
+	HPASpec map[string]any `yaml:"hpaSpec,omitempty"`
+}
+
+// SeldonDeployment returns a Seldon Core SeldonDeployment that runs a model as a custom model server. Seldon Core
+// sends it requests in the Open Inference Protocol, so o.Protocol must be ProtocolV2.
+func SeldonDeployment(cfg *config.Config, o Options) ([]byte, error) {
+	if err := o.validate(cfg); err != nil {
+		return nil, err
+	}
+	if o.Protocol != ProtocolV2 {
+		return nil, fmt.Errorf("Seldon Core sends requests to models in the Open Inference Protocol, so the protocol must be %s", ProtocolV2)
+	}
+	d := seldonDeployment{
+		APIVersion: "machinelearning.seldon.io/v1",
+		Kind:       "SeldonDeployment",
+		Metadata:   map[string]string{"name": o.Name},
+	}
+	d.Spec.Protocol = "v2"
+
+	// The graph's one node is the container with the same name
+	c := modelContainer(cfg, o, "model")
+	c.Env = append([]envVar{{Name: "PORT", Value: strconv.Itoa(seldonPort)}}, c.Env...)
+	predictor := seldonPredictor{
+		Name:     "default",
+		Replicas: max(o.MinReplicas, 1),
+		Graph:    map[string]any{"name": "model", "type": "MODEL"},
+	}
+	component := seldonComponentSpec{}
+	component.Spec.NodeSelector = cfg.Resources.KubernetesNodeSelector()
+	component.Spec.Containers = []container{c}
+	if o.MaxReplicas > predictor.Replicas {
+		component.HPASpec = map[string]any{
+			"minReplicas": predictor.Replicas,
+			"maxReplicas": o.MaxReplicas,
+			"metrics": []map[string]any{{
+				"type":     "Resource",
+				"resource": map[string]any{"name": "cpu", "target": map[string]any{"type": "Utilization", "averageUtilization": 80}},
+			}},
+		}
+	}
+	predictor.ComponentSpecs = []seldonComponentSpec{component}
+	d.Spec.Predictors = []seldonPredictor{predictor}
+	return marshal(d, "cog export seldon")
+}
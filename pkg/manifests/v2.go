@@ -0,0 +1,94 @@
+package manifests
+
+import (
+	"github.com/getkin/kin-openapi/openapi3"
+
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+// Tensor is an input or output of a model in the Open Inference Protocol (KServe's V2 protocol), as it appears in
+// the model's metadata
+type Tensor struct {
+	Name     string  `json:"name" yaml:"name"`
+	Datatype string  `json:"datatype" yaml:"datatype"`
+	Shape    []int64 `json:"shape" yaml:"shape"`
+}
+
+// ModelMetadata is a model's metadata in the Open Inference Protocol, which GET /v2/models/<name> returns
+type ModelMetadata struct {
+	Name     string   `json:"name" yaml:"name"`
+	Platform string   `json:"platform" yaml:"platform"`
+	Inputs   []Tensor `json:"inputs" yaml:"inputs"`
+	Outputs  []Tensor `json:"outputs" yaml:"outputs"`
+}
+
+// Platform is the platform of Cog models in their Open Inference Protocol metadata
+const Platform = "cog"
+
+// V2Metadata maps a model's inputs and outputs to Open Inference Protocol tensors. Scalars are tensors with one
+// element, lists are tensors of any length, and strings and files are BYTES, with files passed as URLs. It also
+// returns the names of the inputs and outputs that can't be tensors, like dictionaries.
+func V2Metadata(name string, schema *openapi3.T) (metadata ModelMetadata, unmapped []string) {
+	metadata = ModelMetadata{Name: name, Platform: Platform, Inputs: []Tensor{}, Outputs: []Tensor{}}
+	if input := cogschema.Component(schema, "Input"); input != nil {
+		for _, in := range cogschema.SortedProperties(input) {
+			if tensor, ok := toTensor(in.Name, in.Schema); ok {
+				metadata.Inputs = append(metadata.Inputs, tensor)
+			} else {
+				unmapped = append(unmapped, in.Name)
+			}
+		}
+	}
+
+	if output := cogschema.Component(schema, "Output"); output != nil {
+		// Outputs that are objects, like a BaseModel, are a tensor for each of their fields
+		if cogschema.IsObject(output) {
+			for _, out := range cogschema.SortedProperties(output) {
+				if tensor, ok := toTensor(out.Name, out.Schema); ok {
+					metadata.Outputs = append(metadata.Outputs, tensor)
+				} else {
+					unmapped = append(unmapped, out.Name)
+				}
+			}
+		} else if tensor, ok := toTensor("output", output); ok {
+			metadata.Outputs = append(metadata.Outputs, tensor)
+		} else {
+			unmapped = append(unmapped, "output")
+		}
+	}
+	return metadata, unmapped
+}
+
+func toTensor(name string, schema *openapi3.Schema) (Tensor, bool) {
+	if schema.Type != nil && schema.Type.Is("array") {
+		if schema.Items == nil || schema.Items.Value == nil {
+			return Tensor{}, false
+		}
+		datatype, ok := datatype(schema.Items.Value)
+		return Tensor{Name: name, Datatype: datatype, Shape: []int64{-1}}, ok
+	}
+	datatype, ok := datatype(schema)
+	return Tensor{Name: name, Datatype: datatype, Shape: []int64{1}}, ok
+}
+
+// datatype returns the Open Inference Protocol datatype of a scalar
+func datatype(schema *openapi3.Schema) (string, bool) {
+	// Choices are a reference to an enum schema
+	if len(schema.AllOf) == 1 && schema.AllOf[0].Value != nil {
+		return datatype(schema.AllOf[0].Value)
+	}
+	if schema.Type == nil {
+		return "", false
+	}
+	switch {
+	case schema.Type.Is("string"):
+		return "BYTES", true
+	case schema.Type.Is("integer"):
+		return "INT64", true
+	case schema.Type.Is("number"):
+		return "FP64", true
+	case schema.Type.Is("boolean"):
+		return "BOOL", true
+	}
+	return "", false
+}
@@ -0,0 +1,236 @@
+// Package metrics reads the prediction metrics a model's HTTP server serves at /metrics, with serve.metrics in
+// cog.yaml, and compares two versions of a model by them, like a canary and the version it's replacing.
+package metrics
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Bucket is a bucket of the prediction duration histogram: how many predictions took UpperBound seconds or less
+type Bucket struct {
+	UpperBound float64
+	Count      float64
+}
+
+// Metrics is the prediction metrics of a model's server, counted since it started
+type Metrics struct {
+	// Predictions is the number of predictions that have finished, by status
+	Predictions map[string]float64
+	// Buckets is the duration histogram of the predictions that succeeded, sorted by upper bound
+	Buckets       []Bucket
+	DurationSum   float64
+	DurationCount float64
+}
+
+// Total returns the number of predictions that have finished
+func (m *Metrics) Total() float64 {
+	total := 0.0
+	for _, count := range m.Predictions {
+		total += count
+	}
+	return total
+}
+
+// ErrorRate returns the fraction of predictions that failed, or NaN if none have finished
+func (m *Metrics) ErrorRate() float64 {
+	total := m.Total()
+	if total == 0 {
+		return math.NaN()
+	}
+	return m.Predictions["failed"] / total
+}
+
+// MeanDuration returns the mean number of seconds predictions that succeeded took, or NaN if none have
+func (m *Metrics) MeanDuration() float64 {
+	if m.DurationCount == 0 {
+		return math.NaN()
+	}
+	return m.DurationSum / m.DurationCount
+}
+
+// Quantile returns an estimate of the q quantile of how long predictions took, in seconds, from the histogram, the
+// same way Prometheus's histogram_quantile() does. It's NaN if no predictions have succeeded.
+func (m *Metrics) Quantile(q float64) float64 {
+	if len(m.Buckets) == 0 || m.DurationCount == 0 {
+		return math.NaN()
+	}
+	rank := q * m.DurationCount
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, b := range m.Buckets {
+		if b.Count >= rank {
+			if math.IsInf(b.UpperBound, 1) {
+				// It's somewhere above the largest bucket, which is as much as can be said
+				return lowerBound
+			}
+			if b.Count == lowerCount {
+				return b.UpperBound
+			}
+			return lowerBound + (b.UpperBound-lowerBound)*(rank-lowerCount)/(b.Count-lowerCount)
+		}
+		lowerBound, lowerCount = b.UpperBound, b.Count
+	}
+	return lowerBound
+}
+
+// Scrape reads the metrics of the model's server at baseURL, like "http://localhost:5000"
+func Scrape(ctx context.Context, baseURL string, token string) (*Metrics, error) {
+	url := strings.TrimSuffix(baseURL, "/") + "/metrics"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s doesn't serve metrics. Set serve.metrics to true in cog.yaml, or run it with COG_METRICS=true", baseURL)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
+
+// Parse reads prediction metrics from Prometheus's text format. Other metrics are ignored. Predictions that are part
+// of an experiment are counted by variant, and are added up here.
+func Parse(r io.Reader) (*Metrics, error) {
+	m := &Metrics{Predictions: map[string]float64{}}
+	buckets := map[float64]float64{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, labels, value, err := parseSample(line)
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "cog_predictions_total":
+			m.Predictions[labels["status"]] += value
+		case "cog_prediction_duration_seconds_bucket":
+			upperBound, err := strconv.ParseFloat(labels["le"], 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid histogram bucket %q: %w", line, err)
+			}
+			buckets[upperBound] += value
+		case "cog_prediction_duration_seconds_sum":
+			m.DurationSum += value
+		case "cog_prediction_duration_seconds_count":
+			m.DurationCount += value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for upperBound, count := range buckets {
+		m.Buckets = append(m.Buckets, Bucket{UpperBound: upperBound, Count: count})
+	}
+	sort.Slice(m.Buckets, func(i, j int) bool { return m.Buckets[i].UpperBound < m.Buckets[j].UpperBound })
+	return m, nil
+}
+
+// parseSample parses a line like `cog_predictions_total{status="failed"} 3`
+func parseSample(line string) (name string, labels map[string]string, value float64, err error) {
+	labels = map[string]string{}
+	rest := line
+	if i := strings.IndexAny(line, "{ "); i >= 0 && line[i] == '{' {
+		name = line[:i]
+		if rest, err = parseLabels(line[i+1:], labels); err != nil {
+			return "", nil, 0, fmt.Errorf("Invalid metric %q: %w", line, err)
+		}
+	} else {
+		var ok bool
+		if name, rest, ok = strings.Cut(line, " "); !ok {
+			return "", nil, 0, fmt.Errorf("Invalid metric %q", line)
+		}
+	}
+	// Samples can have a timestamp after the value
+	valueStr, _, _ := strings.Cut(strings.TrimSpace(rest), " ")
+	if value, err = strconv.ParseFloat(valueStr, 64); err != nil {
+		return "", nil, 0, fmt.Errorf("Invalid metric %q: %w", line, err)
+	}
+	return name, labels, value, nil
+}
+
+// parseLabels parses labels like `status="failed",variant="b"}`, up to the closing brace, into labels, and returns
+// the rest of the line
+func parseLabels(s string, labels map[string]string) (string, error) {
+	for {
+		s = strings.TrimLeft(s, " ,")
+		if strings.HasPrefix(s, "}") {
+			return s[1:], nil
+		}
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return "", fmt.Errorf("expected a label")
+		}
+		var val strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			if rest[i] == '\\' && i+1 < len(rest) {
+				i++
+				if rest[i] == 'n' {
+					val.WriteByte('\n')
+					continue
+				}
+			}
+			val.WriteByte(rest[i])
+		}
+		if i == len(rest) {
+			return "", fmt.Errorf("unterminated label value")
+		}
+		labels[strings.TrimSpace(key)] = val.String()
+		s = rest[i+1:]
+	}
+}
+
+// Comparison is one of the metrics two versions of a model are compared by
+type Comparison struct {
+	Name   string
+	Stable float64
+	Canary float64
+	// Unit is "s" for durations, "%" for rates, or "" for counts
+	Unit string
+}
+
+// Change returns how much higher the canary's metric is than the stable version's, as a fraction of the stable
+// version's, or NaN if it can't be worked out
+func (c Comparison) Change() float64 {
+	if c.Stable == 0 || math.IsNaN(c.Stable) || math.IsNaN(c.Canary) {
+		return math.NaN()
+	}
+	return (c.Canary - c.Stable) / c.Stable
+}
+
+// Compare compares the metrics of the stable version of a model with a canary's
+func Compare(stable *Metrics, canary *Metrics) []Comparison {
+	comparisons := []Comparison{
+		{Name: "Predictions", Stable: stable.Total(), Canary: canary.Total()},
+		{Name: "Error rate", Stable: stable.ErrorRate() * 100, Canary: canary.ErrorRate() * 100, Unit: "%"},
+		{Name: "Mean duration", Stable: stable.MeanDuration(), Canary: canary.MeanDuration(), Unit: "s"},
+	}
+	for _, q := range []float64{0.5, 0.95, 0.99} {
+		comparisons = append(comparisons, Comparison{
+			Name:   fmt.Sprintf("p%g duration", q*100),
+			Stable: stable.Quantile(q),
+			Canary: canary.Quantile(q),
+			Unit:   "s",
+		})
+	}
+	return comparisons
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const stableMetrics = `# HELP cog_predictions_total Predictions that have finished, by status.
+# TYPE cog_predictions_total counter
+cog_predictions_total{status="succeeded"} 95
+cog_predictions_total{status="failed"} 5
+cog_predictions_total{status="canceled"} 0
+# HELP cog_prediction_duration_seconds How long predictions that succeeded took.
+# TYPE cog_prediction_duration_seconds histogram
+cog_prediction_duration_seconds_bucket{le="1"} 50
+cog_prediction_duration_seconds_bucket{le="2"} 90
+cog_prediction_duration_seconds_bucket{le="+Inf"} 95
+cog_prediction_duration_seconds_sum 114
+cog_prediction_duration_seconds_count 95
+# HELP cog_cache_hits_total Predictions returned from the cache.
+# TYPE cog_cache_hits_total counter
+cog_cache_hits_total 12
+`
+
+func TestParse(t *testing.T) {
+	m, err := Parse(strings.NewReader(stableMetrics))
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"succeeded": 95, "failed": 5, "canceled": 0}, m.Predictions)
+	require.Equal(t, []Bucket{{1, 50}, {2, 90}, {math.Inf(1), 95}}, m.Buckets)
+	require.Equal(t, 100.0, m.Total())
+	require.InDelta(t, 0.05, m.ErrorRate(), 1e-9)
+	require.InDelta(t, 1.2, m.MeanDuration(), 1e-9)
+
+	// Half of the predictions took up to 1 second
+	require.InDelta(t, 0.95, m.Quantile(0.5), 1e-9)
+	require.InDelta(t, 1.53125, m.Quantile(0.75), 1e-9)
+	// The slowest are somewhere over the largest bucket
+	require.Equal(t, 2.0, m.Quantile(0.99))
+
+	_, err = Parse(strings.NewReader("cog_predictions_total{status=\"failed\"} lots\n"))
+	require.ErrorContains(t, err, "Invalid metric")
+}
+
+func TestParseExperiment(t *testing.T) {
+	m, err := Parse(strings.NewReader(`cog_predictions_total{status="succeeded"} 2
+cog_predictions_total{status="succeeded",experiment="checkout",variant="a, \"plain\""} 3
+cog_predictions_total{status="failed",experiment="checkout",variant="b"} 1
+cog_prediction_duration_seconds_bucket{le="1"} 1
+cog_prediction_duration_seconds_bucket{le="+Inf"} 2
+cog_prediction_duration_seconds_sum 1.5
+cog_prediction_duration_seconds_count 2
+cog_prediction_duration_seconds_bucket{experiment="checkout",variant="a, \"plain\"",le="1"} 3
+cog_prediction_duration_seconds_bucket{experiment="checkout",variant="a, \"plain\"",le="+Inf"} 3
+cog_prediction_duration_seconds_sum{experiment="checkout",variant="a, \"plain\""} 1.5
+cog_prediction_duration_seconds_count{experiment="checkout",variant="a, \"plain\""} 3
+`))
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"succeeded": 5, "failed": 1}, m.Predictions)
+	require.Equal(t, []Bucket{{1, 4}, {math.Inf(1), 5}}, m.Buckets)
+	require.Equal(t, 3.0, m.DurationSum)
+	require.Equal(t, 5.0, m.DurationCount)
+
+	labels := map[string]string{}
+	_, err = parseLabels(`variant="a, \"plain\"\nline"} 1`, labels)
+	require.NoError(t, err)
+	require.Equal(t, "a, \"plain\"\nline", labels["variant"])
+	_, err = Parse(strings.NewReader(`cog_predictions_total{status="failed} 1` + "\n"))
+	require.ErrorContains(t, err, "unterminated label value")
+}
+
+func TestParseEmpty(t *testing.T) {
+	m, err := Parse(strings.NewReader(""))
+	require.NoError(t, err)
+	require.True(t, math.IsNaN(m.ErrorRate()))
+	require.True(t, math.IsNaN(m.MeanDuration()))
+	require.True(t, math.IsNaN(m.Quantile(0.5)))
+}
+
+func TestCompare(t *testing.T) {
+	stable, err := Parse(strings.NewReader(stableMetrics))
+	require.NoError(t, err)
+	canary, err := Parse(strings.NewReader(`cog_predictions_total{status="succeeded"} 10
+cog_prediction_duration_seconds_bucket{le="1"} 10
+cog_prediction_duration_seconds_bucket{le="2"} 10
+cog_prediction_duration_seconds_bucket{le="+Inf"} 10
+cog_prediction_duration_seconds_sum 6
+cog_prediction_duration_seconds_count 10
+`))
+	require.NoError(t, err)
+
+	comparisons := Compare(stable, canary)
+	names := []string{}
+	for _, c := range comparisons {
+		names = append(names, c.Name)
+	}
+	require.Equal(t, []string{"Predictions", "Error rate", "Mean duration", "p50 duration", "p95 duration", "p99 duration"}, names)
+	require.Equal(t, Comparison{Name: "Predictions", Stable: 100, Canary: 10}, comparisons[0])
+	require.InDelta(t, -0.9, comparisons[0].Change(), 1e-9)
+	require.InDelta(t, 5, comparisons[1].Stable, 1e-9)
+	require.InDelta(t, -1, comparisons[1].Change(), 1e-9)
+	require.InDelta(t, -0.5, comparisons[2].Change(), 1e-9)
+	require.True(t, math.IsNaN(Comparison{Stable: 0, Canary: 1}.Change()))
+}
+
+func TestScrape(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte(stableMetrics))
+	}))
+	defer server.Close()
+
+	m, err := Scrape(context.Background(), server.URL+"/", "secret")
+	require.NoError(t, err)
+	require.Equal(t, 100.0, m.Total())
+
+	_, err = Scrape(context.Background(), server.URL+"/other", "secret")
+	require.ErrorContains(t, err, "doesn't serve metrics")
+}
@@ -0,0 +1,123 @@
+package mlflow
+
+import (
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/replicate/cog/pkg/importer"
+)
+
+//go:embed templates/predict.py.tmpl
+var predictorTemplate string
+
+// inputTypes are the Python types of inputs for the MLflow types of columns, and how the predictor converts them to
+// the column's value
+var inputTypes = map[string]struct {
+	pythonType string
+	value      string
+}{
+	"string":   {"str", "%s"},
+	"integer":  {"int", "%s"},
+	"long":     {"int", "%s"},
+	"float":    {"float", "%s"},
+	"double":   {"float", "%s"},
+	"boolean":  {"bool", "%s"},
+	"binary":   {"Path", "%s.read_bytes()"},
+	"datetime": {"str", "pd.Timestamp(%s)"},
+}
+
+// pythonKeywords are the words that can't be the names of the predictor's inputs, so they're prefixed with input_
+var pythonKeywords = map[string]bool{
+	"and": true, "as": true, "assert": true, "async": true, "await": true, "break": true, "class": true,
+	"continue": true, "def": true, "del": true, "elif": true, "else": true, "except": true, "finally": true,
+	"for": true, "from": true, "global": true, "if": true, "import": true, "in": true, "is": true, "lambda": true,
+	"nonlocal": true, "not": true, "or": true, "pass": true, "raise": true, "return": true, "try": true,
+	"while": true, "with": true, "yield": true, "self": true,
+}
+
+var nonIdentifierChars = regexp.MustCompile(`[^a-z0-9_]+`)
+
+type predictorInput struct {
+	// Name is the column's name
+	Name string
+	// Param is the name of the predictor's input
+	Param    string
+	Type     string
+	Required bool
+	// Value is the Python expression for the column's value
+	Value string
+}
+
+// Environment returns what the model needs to run, which is its requirements and MLflow
+func (m *Model) Environment() importer.Environment {
+	return importer.Environment{
+		PythonVersion: m.PythonVersion,
+		Requirements:  importer.AddRequirements(m.Requirements, "mlflow"),
+	}
+}
+
+// Predictor returns a predictor that loads the model with its python_function flavor. If the model's signature has
+// a column for each of its inputs, the predictor has an input for each column and runs the model on one row of them.
+// Otherwise, it has one input, which is the model's input as JSON.
+func Predictor(model *Model) ([]byte, error) {
+	tmpl, err := template.New("predict.py").Parse(predictorTemplate)
+	if err != nil {
+		return nil, err
+	}
+	inputs := predictorInputs(model.Columns)
+	usesPath := false
+	for _, input := range inputs {
+		usesPath = usesPath || input.Type == "Path"
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]any{
+		"ModelDir": ModelDir,
+		"Inputs":   inputs,
+		"UsesPath": usesPath,
+	}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// predictorInputs returns the predictor's inputs for the columns in a model's signature, or nil if any of them can't
+// be an input
+func predictorInputs(columns []Column) []predictorInput {
+	inputs := []predictorInput{}
+	params := map[string]bool{}
+	for _, column := range columns {
+		t, ok := inputTypes[column.Type]
+		if !ok {
+			return nil
+		}
+		param := parameterName(column.Name)
+		if param == "" || params[param] {
+			return nil
+		}
+		params[param] = true
+		value := fmt.Sprintf(t.value, param)
+		if !column.Required && value != param {
+			value = fmt.Sprintf("None if %s is None else %s", param, value)
+		}
+		inputs = append(inputs, predictorInput{Name: column.Name, Param: param, Type: t.pythonType, Required: column.Required, Value: value})
+	}
+	return inputs
+}
+
+// parameterName returns the name of the input for a column, like sepal_length_cm for "sepal length (cm)" and
+// input_class for "class", or an empty string if it hasn't got one
+func parameterName(column string) string {
+	param := strings.Trim(nonIdentifierChars.ReplaceAllString(strings.ToLower(column), "_"), "_")
+	if param == "" {
+		return ""
+	}
+	if pythonKeywords[param] || (param[0] >= '0' && param[0] <= '9') {
+		param = "input_" + param
+	}
+	return param
+}
@@ -0,0 +1,255 @@
+// Package mlflow imports models saved with MLflow, by generating a predictor that loads them with their
+// python_function flavor. It reads the model's environment and signature from its MLmodel file, and downloads models
+// in a tracking server or registry with the mlflow CLI.
+package mlflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/replicate/cog/pkg/importer"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// ModelFile is the file in a model's directory that describes it
+const ModelFile = "MLmodel"
+
+// ModelDir is the directory in the project the model is copied to, which the predictor loads it from
+const ModelDir = "model"
+
+// pyfuncFlavor is the flavor every model MLflow can serve has, which loads it as a generic Python function
+const pyfuncFlavor = "python_function"
+
+// Column is a named input in a model's signature
+type Column struct {
+	Name string
+	// Type is the column's MLflow type, like string, long or double
+	Type     string
+	Required bool
+}
+
+// Model is a model saved with MLflow
+type Model struct {
+	// Flavors are the names of the model's flavors, like python_function and sklearn
+	Flavors []string
+	// LoaderModule is the module the python_function flavor loads the model with, like mlflow.sklearn
+	LoaderModule string
+	// PythonVersion is the version of Python the model was saved with, like 3.10.12
+	PythonVersion string
+	// Requirements are the model's pip requirements
+	Requirements []string
+	// CondaPackages are the packages in the model's conda environment that aren't pip packages, other than Python
+	// and pip, which Cog can't install
+	CondaPackages []string
+	// Columns are the model's inputs, if its signature has a column for each of them, or nil if it hasn't got a
+	// signature or its inputs are tensors or unnamed
+	Columns []Column
+}
+
+type mlModel struct {
+	Flavors   map[string]yaml.Node `yaml:"flavors"`
+	Signature *struct {
+		Inputs string `yaml:"inputs"`
+	} `yaml:"signature"`
+}
+
+type pyfunc struct {
+	LoaderModule string `yaml:"loader_module"`
+	// PythonVersion is a string, so versions like 3.10 aren't read as numbers
+	PythonVersion string `yaml:"python_version"`
+	Env           any    `yaml:"env"`
+}
+
+type colSpec struct {
+	Name     *string `json:"name"`
+	Type     string  `json:"type"`
+	Required *bool   `json:"required"`
+}
+
+// ReadModel reads the MLflow model in a directory
+func ReadModel(dir string) (*Model, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, ModelFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s isn't an MLflow model, because it hasn't got an %s file", dir, ModelFile)
+	} else if err != nil {
+		return nil, err
+	}
+	mlm := mlModel{}
+	if err := yaml.Unmarshal(contents, &mlm); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", ModelFile, err)
+	}
+
+	model := &Model{}
+	for flavor := range mlm.Flavors {
+		model.Flavors = append(model.Flavors, flavor)
+	}
+	sort.Strings(model.Flavors)
+	node, ok := mlm.Flavors[pyfuncFlavor]
+	if !ok {
+		return nil, fmt.Errorf("The model hasn't got a %s flavor, so it can't be loaded without the code that saved it", pyfuncFlavor)
+	}
+	flavor := pyfunc{}
+	if err := node.Decode(&flavor); err != nil {
+		return nil, fmt.Errorf("Failed to parse the model's %s flavor: %w", pyfuncFlavor, err)
+	}
+	model.LoaderModule = flavor.LoaderModule
+	model.PythonVersion = flavor.PythonVersion
+
+	if err := model.readEnvironment(dir, flavor.Env); err != nil {
+		return nil, err
+	}
+	if mlm.Signature != nil && mlm.Signature.Inputs != "" {
+		model.Columns = columns(mlm.Signature.Inputs)
+	}
+	return model, nil
+}
+
+// readEnvironment reads the model's requirements from requirements.txt, or from its conda environment if it hasn't
+// got one. The python_function flavor's env is the conda environment's file in older models, and a map of them in
+// newer ones.
+func (m *Model) readEnvironment(dir string, env any) error {
+	condaFile := "conda.yaml"
+	switch env := env.(type) {
+	case string:
+		condaFile = env
+	case map[string]any:
+		if conda, ok := env["conda"].(string); ok {
+			condaFile = conda
+		}
+		if virtualenv, ok := env["virtualenv"].(string); ok {
+			if err := m.readPythonEnv(filepath.Join(dir, virtualenv)); err != nil {
+				return err
+			}
+		}
+	}
+
+	requirements, err := os.ReadFile(filepath.Join(dir, "requirements.txt"))
+	if err == nil {
+		m.Requirements = importer.RequirementLines(string(requirements))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return m.readConda(filepath.Join(dir, condaFile), m.Requirements == nil)
+}
+
+func (m *Model) readPythonEnv(path string) error {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	pythonEnv := struct {
+		Python string `yaml:"python"`
+	}{}
+	if err := yaml.Unmarshal(contents, &pythonEnv); err != nil {
+		return fmt.Errorf("Failed to parse %s: %w", filepath.Base(path), err)
+	}
+	if pythonEnv.Python != "" {
+		m.PythonVersion = pythonEnv.Python
+	}
+	return nil
+}
+
+func (m *Model) readConda(path string, usePip bool) error {
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	conda := struct {
+		Dependencies []any `yaml:"dependencies"`
+	}{}
+	if err := yaml.Unmarshal(contents, &conda); err != nil {
+		return fmt.Errorf("Failed to parse %s: %w", filepath.Base(path), err)
+	}
+	for _, dependency := range conda.Dependencies {
+		switch dependency := dependency.(type) {
+		case string:
+			name, version := dependency, ""
+			if i := strings.IndexAny(dependency, "=<>! "); i >= 0 {
+				name, version = dependency[:i], strings.TrimLeft(dependency[i:], "=<>! ")
+			}
+			switch name {
+			case "python":
+				if m.PythonVersion == "" {
+					m.PythonVersion = version
+				}
+			case "pip":
+			default:
+				m.CondaPackages = append(m.CondaPackages, dependency)
+			}
+		case map[string]any:
+			pip, _ := dependency["pip"].([]any)
+			for _, requirement := range pip {
+				if usePip {
+					m.Requirements = append(m.Requirements, fmt.Sprint(requirement))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// columns returns the named inputs in a signature's inputs, which are JSON, or nil if they're tensors or unnamed
+func columns(inputs string) []Column {
+	specs := []colSpec{}
+	if err := json.Unmarshal([]byte(inputs), &specs); err != nil {
+		return nil
+	}
+	result := []Column{}
+	for _, spec := range specs {
+		if spec.Name == nil || spec.Type == "tensor" {
+			return nil
+		}
+		result = append(result, Column{Name: *spec.Name, Type: spec.Type, Required: spec.Required == nil || *spec.Required})
+	}
+	return result
+}
+
+// Download downloads a model in a tracking server or registry, like models:/hotdog-detector/3 or
+// runs:/<run id>/model, to a directory, and returns the model's directory in it. It uses the mlflow CLI, which reads
+// the tracking server from MLFLOW_TRACKING_URI.
+func Download(uri string, dst string) (string, error) {
+	console.Infof("Downloading %s...", uri)
+	out, err := runMLflow("artifacts", "download", "--artifact-uri", uri, "--dst-path", dst)
+	if err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", uri, err)
+	}
+	// The mlflow CLI prints the path it downloaded the model to
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if path := strings.TrimSpace(lines[len(lines)-1]); path != "" {
+		return path, nil
+	}
+	return dst, nil
+}
+
+// runMLflow is a variable so tests can replace the mlflow CLI. Its progress goes to the terminal, and its output is
+// returned.
+var runMLflow = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("mlflow", args...)
+	cmd.Env = os.Environ()
+	cmd.Stderr = os.Stderr
+	console.Debug("$ mlflow " + strings.Join(args, " "))
+	stdout := new(bytes.Buffer)
+	cmd.Stdout = stdout
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the mlflow CLI isn't installed. Install it with 'pip install mlflow'")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,148 @@
+package mlflow
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testMLmodel = `artifact_path: model
+flavors:
+  python_function:
+    env:
+      conda: conda.yaml
+      virtualenv: python_env.yaml
+    loader_module: mlflow.sklearn
+    model_path: model.pkl
+    predict_fn: predict
+    python_version: 3.10.12
+  sklearn:
+    pickled_model: model.pkl
+    serialization_format: cloudpickle
+    sklearn_version: 1.3.0
+mlflow_version: 2.9.2
+signature:
+  inputs: '[{"type": "double", "name": "sepal length (cm)", "required": true}, {"type":
+    "long", "name": "class", "required": true}, {"type": "binary", "name": "image",
+    "required": false}]'
+  outputs: '[{"type": "tensor", "tensor-spec": {"dtype": "int64", "shape": [-1]}}]'
+`
+
+func writeModel(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, contents := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+	}
+	return dir
+}
+
+func TestReadModel(t *testing.T) {
+	dir := writeModel(t, map[string]string{
+		ModelFile:          testMLmodel,
+		"python_env.yaml":  "python: 3.10\nbuild_dependencies:\n  - pip==23.3.1\ndependencies:\n  - -r requirements.txt\n",
+		"requirements.txt": "# comment\nmlflow==2.9.2\nscikit-learn==1.3.0\n",
+		"conda.yaml":       "dependencies:\n  - python=3.10.12\n  - pip<=23.3.1\n  - libgomp\n  - pip:\n    - mlflow==2.9.2\n",
+	})
+	model, err := ReadModel(dir)
+	require.NoError(t, err)
+	require.Equal(t, &Model{
+		Flavors:       []string{"python_function", "sklearn"},
+		LoaderModule:  "mlflow.sklearn",
+		PythonVersion: "3.10",
+		Requirements:  []string{"mlflow==2.9.2", "scikit-learn==1.3.0"},
+		CondaPackages: []string{"libgomp"},
+		Columns: []Column{
+			{Name: "sepal length (cm)", Type: "double", Required: true},
+			{Name: "class", Type: "long", Required: true},
+			{Name: "image", Type: "binary", Required: false},
+		},
+	}, model)
+}
+
+func TestReadModelConda(t *testing.T) {
+	// Older models only have a conda environment, and a tensor signature
+	dir := writeModel(t, map[string]string{
+		ModelFile: `flavors:
+  python_function:
+    env: conda.yaml
+    loader_module: mlflow.pytorch
+signature:
+  inputs: '[{"type": "tensor", "tensor-spec": {"dtype": "float32", "shape": [-1, 4]}}]'
+`,
+		"conda.yaml": "dependencies:\n  - python=3.9.7\n  - pip\n  - pip:\n    - torch==2.0.1\n",
+	})
+	model, err := ReadModel(dir)
+	require.NoError(t, err)
+	require.Equal(t, "3.9.7", model.PythonVersion)
+	require.Equal(t, []string{"torch==2.0.1"}, model.Requirements)
+	require.Empty(t, model.CondaPackages)
+	require.Nil(t, model.Columns)
+	require.Equal(t, []string{"torch==2.0.1", "mlflow"}, model.Environment().Requirements)
+}
+
+func TestReadModelErrors(t *testing.T) {
+	_, err := ReadModel(t.TempDir())
+	require.ErrorContains(t, err, "isn't an MLflow model")
+
+	dir := writeModel(t, map[string]string{ModelFile: "flavors:\n  keras:\n    keras_version: 2.13.1\n"})
+	_, err = ReadModel(dir)
+	require.ErrorContains(t, err, "hasn't got a python_function flavor")
+}
+
+func TestPredictor(t *testing.T) {
+	predictor, err := Predictor(&Model{Columns: []Column{
+		{Name: "sepal length (cm)", Type: "double", Required: true},
+		{Name: "class", Type: "long", Required: true},
+		{Name: "image", Type: "binary", Required: false},
+	}})
+	require.NoError(t, err)
+	require.Contains(t, string(predictor), "from cog import BasePredictor, Input, Path\n")
+	require.Contains(t, string(predictor), `
+    def predict(
+        self,
+        sepal_length_cm: float = Input(description="sepal length (cm)"),
+        input_class: int = Input(description="class"),
+        image: Path = Input(description="image", default=None),
+    ) -> Any:
+        """Run a single prediction on the model"""
+        row = {
+            "sepal length (cm)": sepal_length_cm,
+            "class": input_class,
+            "image": None if image is None else image.read_bytes(),
+        }
+`)
+	require.NotContains(t, string(predictor), "import json")
+
+	// Models without a signature, or with tensor or unsupported inputs, take JSON
+	for _, columns := range [][]Column{nil, {{Name: "tags", Type: "array", Required: true}}} {
+		predictor, err = Predictor(&Model{Columns: columns})
+		require.NoError(t, err)
+		require.Contains(t, string(predictor), "import json\n")
+		require.Contains(t, string(predictor), "from cog import BasePredictor, Input\n")
+		require.Contains(t, string(predictor), "        input: str = Input(\n")
+	}
+}
+
+func TestParameterName(t *testing.T) {
+	require.Equal(t, "sepal_length_cm", parameterName("sepal length (cm)"))
+	require.Equal(t, "input_1st_feature", parameterName("1st feature"))
+	require.Equal(t, "input_class", parameterName("class"))
+	require.Equal(t, "", parameterName("???"))
+}
+
+func TestDownload(t *testing.T) {
+	var gotArgs []string
+	original := runMLflow
+	t.Cleanup(func() { runMLflow = original })
+	runMLflow = func(args ...string) ([]byte, error) {
+		gotArgs = args
+		return []byte("/tmp/download/model\n"), nil
+	}
+	dir, err := Download("models:/hotdog-detector/3", "/tmp/download")
+	require.NoError(t, err)
+	require.Equal(t, "/tmp/download/model", dir)
+	require.Equal(t, []string{"artifacts", "download", "--artifact-uri", "models:/hotdog-detector/3", "--dst-path", "/tmp/download"}, gotArgs)
+}
@@ -0,0 +1,370 @@
+// Package modelcard renders a model card, a Markdown document describing what a model does and what it needs to
+// run, from cog.yaml and the model's OpenAPI schema.
+package modelcard
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/examples"
+	cogschema "github.com/replicate/cog/pkg/schema"
+)
+
+// Card is the information a model card is rendered from
+type Card struct {
+	// Name is the model's name, usually its image
+	Name   string
+	Config *config.Config
+	Schema *openapi3.T
+	// PythonPackages is the Python packages the model installs, if they're known
+	PythonPackages []string
+	// License is the model's license, as an SPDX identifier if it's a well known one
+	License string
+	// Examples are the predictions saved with `cog predict --save-example`
+	Examples []*examples.Example
+}
+
+// Render returns the model card as Markdown
+func (c *Card) Render() string {
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "# %s\n", c.Name)
+
+	if input := cogschema.Component(c.Schema, "Input"); input != nil {
+		b.WriteString("\n## Inputs\n\n")
+		writeInputs(b, input)
+	}
+	if output := cogschema.Component(c.Schema, "Output"); output != nil {
+		b.WriteString("\n## Output\n\n")
+		fmt.Fprintf(b, "%s\n", capitalize(typeName(output)))
+		if output.Description != "" {
+			fmt.Fprintf(b, "\n%s\n", output.Description)
+		}
+	}
+	if c.Config != nil && c.Config.Train != "" {
+		if input := cogschema.Component(c.Schema, "TrainingInput"); input != nil {
+			b.WriteString("\n## Training inputs\n\n")
+			writeInputs(b, input)
+		}
+	}
+	if len(c.Examples) > 0 {
+		b.WriteString("\n## Examples\n\n")
+		c.writeSavedExamples(b)
+	} else if input := cogschema.Component(c.Schema, "Input"); input != nil {
+		b.WriteString("\n## Example\n\n")
+		writeExample(b, c.Name, input)
+	}
+	if c.Config != nil {
+		b.WriteString("\n## Environment\n\n")
+		c.writeEnvironment(b)
+		b.WriteString("\n## Hardware requirements\n\n")
+		c.writeHardware(b)
+	}
+	if c.License != "" {
+		fmt.Fprintf(b, "\n## License\n\n%s\n", c.License)
+	}
+	return b.String()
+}
+
+// SchemaSummary summarizes a model's inputs and output on one line, like "image, scale -> file"
+func SchemaSummary(schema *openapi3.T) string {
+	c := &Card{Schema: schema}
+	inputs := []string{}
+	if input := cogschema.Component(c.Schema, "Input"); input != nil {
+		for _, in := range cogschema.SortedProperties(input) {
+			inputs = append(inputs, in.Name)
+		}
+	}
+	output := "any"
+	if o := cogschema.Component(c.Schema, "Output"); o != nil {
+		output = strings.ReplaceAll(typeName(o), "`", "")
+	}
+	return strings.Join(inputs, ", ") + " -> " + output
+}
+
+func writeInputs(b *strings.Builder, schema *openapi3.Schema) {
+	b.WriteString("| Name | Type | Default | Description |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, in := range cogschema.SortedProperties(schema) {
+		def := ""
+		switch {
+		case in.Required:
+			def = "Required"
+		case in.Schema.Default != nil:
+			def = "`" + formatValue(in.Schema.Default) + "`"
+		}
+		fmt.Fprintf(b, "| `%s` | %s | %s | %s |\n", in.Name, typeName(in.Schema), def, escapeCell(in.Schema.Description))
+	}
+}
+
+func writeExample(b *strings.Builder, name string, schema *openapi3.Schema) {
+	args := []string{}
+	for _, in := range cogschema.SortedProperties(schema) {
+		if !in.Required {
+			continue
+		}
+		args = append(args, fmt.Sprintf("-i %s=%s", in.Name, examplePlaceholder(in.Schema)))
+	}
+	b.WriteString("```console\n")
+	fmt.Fprintf(b, "cog predict %s", name)
+	for _, arg := range args {
+		fmt.Fprintf(b, " \\\n  %s", arg)
+	}
+	b.WriteString("\n```\n")
+}
+
+func (c *Card) writeSavedExamples(b *strings.Builder) {
+	hasFiles := false
+	for i, example := range c.Examples {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "`%s`:\n\n", example.Name)
+		names := make([]string, 0, len(example.Inputs))
+		for name := range example.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		b.WriteString("```console\n")
+		fmt.Fprintf(b, "cog predict %s", c.Name)
+		for _, name := range names {
+			values, ok := example.Inputs[name].([]any)
+			if !ok {
+				values = []any{example.Inputs[name]}
+			}
+			for _, value := range values {
+				hasFiles = hasFiles || strings.HasPrefix(formatValue(value), "@")
+				fmt.Fprintf(b, " \\\n  -i %s=%s", name, shellQuote(formatValue(value)))
+			}
+		}
+		b.WriteString("\n```\n")
+	}
+	if hasFiles {
+		fmt.Fprintf(b, "\nThe files these examples use are in `%s/<name>` in the model's source.\n", examples.Dir)
+	}
+}
+
+func (c *Card) writeEnvironment(b *strings.Builder) {
+	build := c.Config.Build
+	if build == nil {
+		return
+	}
+	if build.PythonVersion != "" {
+		fmt.Fprintf(b, "- Python %s\n", build.PythonVersion)
+	}
+	if build.GPU && build.CUDA != "" {
+		cuda := "CUDA " + build.CUDA
+		if build.CuDNN != "" {
+			cuda += ", cuDNN " + build.CuDNN
+		}
+		fmt.Fprintf(b, "- %s\n", cuda)
+	}
+	packages := c.PythonPackages
+	if len(packages) == 0 {
+		packages = build.PythonPackages
+	}
+	switch {
+	case len(packages) > 0:
+		fmt.Fprintf(b, "- Python packages: %s\n", codeList(packages))
+	case build.PythonRequirements != "":
+		fmt.Fprintf(b, "- Python packages from `%s`\n", build.PythonRequirements)
+	}
+	if len(build.SystemPackages) > 0 {
+		fmt.Fprintf(b, "- System packages: %s\n", codeList(build.SystemPackages))
+	}
+	for _, w := range c.Config.Weights {
+		fmt.Fprintf(b, "- Weights from `%s` in `%s`\n", w.Source, w.Dir())
+	}
+}
+
+func (c *Card) writeHardware(b *strings.Builder) {
+	gpu := c.Config.Build != nil && c.Config.Build.GPU
+	r := c.Config.Resources
+	switch {
+	case !gpu:
+		b.WriteString("- CPU only\n")
+	case r != nil && r.GPUCount > 1:
+		fmt.Fprintf(b, "- %d NVIDIA GPUs%s\n", r.GPUCount, gpuType(r))
+	default:
+		fmt.Fprintf(b, "- NVIDIA GPU%s\n", gpuType(r))
+	}
+	if r == nil {
+		return
+	}
+	if r.CPU > 0 {
+		fmt.Fprintf(b, "- %v CPUs\n", r.CPU)
+	}
+	if r.Memory != "" {
+		fmt.Fprintf(b, "- %s of memory\n", r.Memory)
+	}
+	if r.Disk != "" {
+		fmt.Fprintf(b, "- %s of disk\n", r.Disk)
+	}
+}
+
+func gpuType(r *config.Resources) string {
+	if r == nil || r.GPUType == "" {
+		return ""
+	}
+	return " (" + r.GPUType + ")"
+}
+
+// typeName describes a schema's type for people, like "list of files" or "one of: small, large"
+func typeName(schema *openapi3.Schema) string {
+	// Choices are a reference to an enum schema
+	if len(schema.AllOf) == 1 && schema.AllOf[0].Value != nil {
+		return typeName(schema.AllOf[0].Value)
+	}
+	if len(schema.Enum) > 0 {
+		choices := make([]string, len(schema.Enum))
+		for i, v := range schema.Enum {
+			choices[i] = "`" + formatValue(v) + "`"
+		}
+		return "one of: " + strings.Join(choices, ", ")
+	}
+	if schema.Type == nil {
+		return "any"
+	}
+	switch {
+	case schema.Type.Is("string") && schema.Format == "uri":
+		return "file"
+	case schema.Type.Is("string") && schema.Format == "password":
+		return "secret"
+	case schema.Type.Is("array"):
+		if schema.Items != nil && schema.Items.Value != nil {
+			item := typeName(schema.Items.Value)
+			if !strings.Contains(item, " ") {
+				item += "s"
+			}
+			if schema.Extensions["x-cog-array-type"] == "iterator" {
+				return "iterator of " + item
+			}
+			return "list of " + item
+		}
+		return "list"
+	case schema.Type.Is("integer") || schema.Type.Is("number"):
+		name := strings.Join(schema.Type.Slice(), ", ")
+		switch {
+		case schema.Min != nil && schema.Max != nil:
+			return fmt.Sprintf("%s (%s to %s)", name, formatValue(*schema.Min), formatValue(*schema.Max))
+		case schema.Min != nil:
+			return fmt.Sprintf("%s (at least %s)", name, formatValue(*schema.Min))
+		case schema.Max != nil:
+			return fmt.Sprintf("%s (at most %s)", name, formatValue(*schema.Max))
+		}
+		return name
+	}
+	return strings.Join(schema.Type.Slice(), ", ")
+}
+
+func examplePlaceholder(schema *openapi3.Schema) string {
+	if len(schema.AllOf) == 1 && schema.AllOf[0].Value != nil {
+		return examplePlaceholder(schema.AllOf[0].Value)
+	}
+	if len(schema.Enum) > 0 {
+		return formatValue(schema.Enum[0])
+	}
+	switch {
+	case schema.Type == nil:
+		return "..."
+	case schema.Type.Is("string") && schema.Format == "uri":
+		return "@input.jpg"
+	case schema.Type.Is("integer") || schema.Type.Is("number"):
+		if schema.Min != nil {
+			return formatValue(*schema.Min)
+		}
+		return "1"
+	case schema.Type.Is("boolean"):
+		return "true"
+	}
+	return `"..."`
+}
+
+func formatValue(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// shellQuote quotes a value for a shell, unless it's made of characters that are safe without quotes
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("@%+,-./:_", r))
+	}) == -1 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+func codeList(items []string) string {
+	quoted := make([]string, len(items))
+	for i, item := range items {
+		quoted[i] = "`" + item + "`"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+var licenseFiles = []string{"LICENSE", "LICENSE.md", "LICENSE.txt", "COPYING"}
+
+// licensesByText identifies common licenses by a phrase in their text, in the order they're checked
+var licensesByText = []struct {
+	spdx    string
+	phrases []string
+}{
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"AGPL-3.0", []string{"GNU AFFERO GENERAL PUBLIC LICENSE"}},
+	{"GPL-3.0", []string{"GNU GENERAL PUBLIC LICENSE", "Version 3"}},
+	{"MPL-2.0", []string{"Mozilla Public License Version 2.0"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+}
+
+// DetectLicense returns the license of the project in dir, from its LICENSE file. It returns an SPDX identifier
+// for well known licenses, "See <file>" for others, and "" if the project doesn't have a license file.
+func DetectLicense(dir string) string {
+	for _, name := range licenseFiles {
+		contents, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		text := string(contents)
+		for _, license := range licensesByText {
+			matches := true
+			for _, phrase := range license.phrases {
+				if !strings.Contains(text, phrase) {
+					matches = false
+					break
+				}
+			}
+			if matches {
+				return license.spdx
+			}
+		}
+		return "See " + name
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package modelcard
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/examples"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["prompt"],
+        "properties": {
+          "steps": {"type": "integer", "title": "Steps", "default": 20, "minimum": 1, "maximum": 50, "x-order": 1, "description": "Number of denoising steps"},
+          "prompt": {"type": "string", "title": "Prompt", "x-order": 0, "description": "What to draw | in detail"},
+          "image": {"type": "string", "format": "uri", "title": "Image", "x-order": 2},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 3}
+        }
+      },
+      "scheduler": {"type": "string", "title": "scheduler", "enum": ["DDIM", "K_EULER"]},
+      "Output": {"type": "array", "title": "Output", "items": {"type": "string", "format": "uri"}}
+    }
+  }
+}`
+
+const expectedCard = "# r8.im/test/sdxl\n" +
+	"\n" +
+	"## Inputs\n" +
+	"\n" +
+	"| Name | Type | Default | Description |\n" +
+	"| --- | --- | --- | --- |\n" +
+	"| `prompt` | string | Required | What to draw \\| in detail |\n" +
+	"| `steps` | integer (1 to 50) | `20` | Number of denoising steps |\n" +
+	"| `image` | file |  |  |\n" +
+	"| `scheduler` | one of: `DDIM`, `K_EULER` | `DDIM` |  |\n" +
+	"\n" +
+	"## Output\n" +
+	"\n" +
+	"List of files\n" +
+	"\n" +
+	"## Example\n" +
+	"\n" +
+	"```console\n" +
+	"cog predict r8.im/test/sdxl \\\n" +
+	"  -i prompt=\"...\"\n" +
+	"```\n" +
+	"\n" +
+	"## Environment\n" +
+	"\n" +
+	"- Python 3.11\n" +
+	"- CUDA 12.1, cuDNN 8\n" +
+	"- Python packages: `torch==2.3.0`, `diffusers==0.27.2`\n" +
+	"- System packages: `ffmpeg`\n" +
+	"\n" +
+	"## Hardware requirements\n" +
+	"\n" +
+	"- NVIDIA GPU (A100)\n" +
+	"- 16Gi of memory\n" +
+	"\n" +
+	"## License\n" +
+	"\n" +
+	"MIT\n"
+
+func TestRender(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	card := Card{
+		Name: "r8.im/test/sdxl",
+		Config: &config.Config{
+			Build: &config.Build{
+				GPU:            true,
+				PythonVersion:  "3.11",
+				CUDA:           "12.1",
+				CuDNN:          "8",
+				SystemPackages: []string{"ffmpeg"},
+			},
+			Resources: &config.Resources{Memory: "16Gi", GPUType: "A100"},
+		},
+		Schema:         schema,
+		PythonPackages: []string{"torch==2.3.0", "diffusers==0.27.2"},
+		License:        "MIT",
+	}
+	require.Equal(t, expectedCard, card.Render())
+}
+
+func TestSchemaSummary(t *testing.T) {
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	require.Equal(t, "prompt, steps, image, scheduler -> list of files", SchemaSummary(schema))
+	require.Equal(t, " -> any", SchemaSummary(nil))
+}
+
+func TestRenderCPUOnly(t *testing.T) {
+	card := Card{
+		Name:   "my-model",
+		Config: &config.Config{Build: &config.Build{PythonVersion: "3.12", PythonRequirements: "requirements.txt"}},
+	}
+	require.Equal(t, "# my-model\n\n## Environment\n\n- Python 3.12\n- Python packages from `requirements.txt`\n\n## Hardware requirements\n\n- CPU only\n", card.Render())
+}
+
+func TestDetectLicense(t *testing.T) {
+	for _, tc := range []struct {
+		file     string
+		contents string
+		expected string
+	}{
+		{"LICENSE", "MIT License\n\nPermission is hereby granted, free of charge, to any person", "MIT"},
+		{"LICENSE.md", "                                 Apache License\n                           Version 2.0, January 2004", "Apache-2.0"},
+		{"LICENSE", "GNU AFFERO GENERAL PUBLIC LICENSE\nVersion 3, 19 November 2007", "AGPL-3.0"},
+		{"COPYING", "Some custom terms", "See COPYING"},
+	} {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, tc.file), []byte(tc.contents), 0o644))
+		require.Equal(t, tc.expected, DetectLicense(dir), tc.file)
+	}
+	require.Equal(t, "", DetectLicense(t.TempDir()))
+}
+
+func TestArtifact(t *testing.T) {
+	subject := v1.Descriptor{
+		MediaType: "application/vnd.oci.image.manifest.v1+json",
+		Size:      1234,
+		Digest:    v1.Hash{Algorithm: "sha256", Hex: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"},
+	}
+	artifact, err := Artifact("# my-model\n", subject)
+	require.NoError(t, err)
+
+	manifest, err := artifact.Manifest()
+	require.NoError(t, err)
+	require.Equal(t, ArtifactType, string(manifest.Config.MediaType))
+	require.Equal(t, subject.Digest, manifest.Subject.Digest)
+	require.Len(t, manifest.Layers, 1)
+	require.Equal(t, MediaType, string(manifest.Layers[0].MediaType))
+	require.Equal(t, "MODEL_CARD.md", manifest.Layers[0].Annotations["org.opencontainers.image.title"])
+}
+
+func TestRenderSavedExamples(t *testing.T) {
+	card := Card{
+		Name: "my-model",
+		Examples: []*examples.Example{
+			{Name: "cat", Inputs: map[string]any{"prompt": "a cat's hat", "image": "@image.jpg", "tags": []any{"a", "b"}}},
+		},
+	}
+	require.Equal(t, "# my-model\n"+
+		"\n"+
+		"## Examples\n"+
+		"\n"+
+		"`cat`:\n"+
+		"\n"+
+		"```console\n"+
+		"cog predict my-model \\\n"+
+		"  -i image=@image.jpg \\\n"+
+		"  -i prompt='a cat'\\''s hat' \\\n"+
+		"  -i tags=a \\\n"+
+		"  -i tags=b\n"+
+		"```\n"+
+		"\n"+
+		"The files these examples use are in `.cog/examples/<name>` in the model's source.\n", card.Render())
+}
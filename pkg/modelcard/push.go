@@ -0,0 +1,74 @@
+package modelcard
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/registry"
+)
+
+// ArtifactType is the media type of model card artifacts in a registry
+const ArtifactType = "application/vnd.cog.modelcard.v1+json"
+
+// MediaType is the media type of the model card in the artifact
+const MediaType = "text/markdown"
+
+// Artifact returns an OCI artifact containing a model card, that refers to the image it describes
+func Artifact(card string, subject v1.Descriptor) (v1.Image, error) {
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, ArtifactType)
+	img, err := mutate.Append(img, mutate.Addendum{
+		Layer: static.NewLayer([]byte(card), MediaType),
+		Annotations: map[string]string{
+			"org.opencontainers.image.title": "MODEL_CARD.md",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mutate.Subject(img, subject).(v1.Image), nil
+}
+
+// Push pushes a model card to the registry as an artifact that refers to imageName, so registries that support
+// the OCI referrers API list it alongside the image. It returns the artifact's reference.
+func Push(ctx context.Context, imageName string, card string) (string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	auth := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	subject, err := remote.Head(ref, auth, remote.WithContext(ctx))
+	if registry.IsAuthError(err) {
+		return "", &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: fmt.Errorf("Failed to find %s in the registry: %w", imageName, err)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to find %s in the registry. Push it with 'cog push' first: %w", imageName, err)
+	}
+	artifact, err := Artifact(card, *subject)
+	if err != nil {
+		return "", err
+	}
+	digest, err := artifact.Digest()
+	if err != nil {
+		return "", err
+	}
+	dest := ref.Context().Digest(digest.String())
+	if err := remote.Write(dest, artifact, auth, remote.WithContext(ctx)); err != nil {
+		err = fmt.Errorf("Failed to push model card: %w", err)
+		if registry.IsAuthError(err) {
+			return "", &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: err}
+		}
+		return "", err
+	}
+	return dest.String(), nil
+}
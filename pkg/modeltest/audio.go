@@ -0,0 +1,155 @@
+package modeltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+const (
+	wavFormatPCM   = 1
+	wavFormatFloat = 3
+	// wavFormatExtensible has the real format in the first 2 bytes of its sub-format GUID
+	wavFormatExtensible = 0xfffe
+)
+
+// maxDurationDifference is how much audio files' durations may differ by, as a fraction of the expected duration
+const maxDurationDifference = 0.01
+
+// wav is decoded WAV audio, with samples from -1 to 1, interleaved by channel
+type wav struct {
+	sampleRate int
+	channels   int
+	samples    []float64
+}
+
+func (w wav) duration() float64 {
+	return float64(len(w.samples)) / float64(w.channels*w.sampleRate)
+}
+
+func isWAV(data []byte) bool {
+	return len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE"
+}
+
+func compareAudio(path string, expected []byte, actual []byte, opts Options) error {
+	exp, err := decodeWAV(expected)
+	if err != nil {
+		return fmt.Errorf("%s: the files are different, and the expected audio couldn't be decoded to compare them: %w", path, err)
+	}
+	act, err := decodeWAV(actual)
+	if err != nil {
+		return fmt.Errorf("%s: failed to decode audio: %w", path, err)
+	}
+	if exp.sampleRate != act.sampleRate || exp.channels != act.channels {
+		return fmt.Errorf("%s: expected %d channels at %d Hz, got %d channels at %d Hz", path, exp.channels, exp.sampleRate, act.channels, act.sampleRate)
+	}
+	if math.Abs(exp.duration()-act.duration()) > exp.duration()*maxDurationDifference {
+		return fmt.Errorf("%s: expected %.2fs of audio, got %.2fs", path, exp.duration(), act.duration())
+	}
+
+	var signal, noise float64
+	for i := 0; i < len(exp.samples) && i < len(act.samples); i++ {
+		signal += exp.samples[i] * exp.samples[i]
+		diff := exp.samples[i] - act.samples[i]
+		noise += diff * diff
+	}
+	if noise == 0 {
+		return nil
+	}
+	if snr := 10 * math.Log10(signal/noise); snr < opts.MinSNR {
+		return fmt.Errorf("%s: the audio sounds different (its signal-to-noise ratio is %.1f dB, less than %g dB)", path, snr, opts.MinSNR)
+	}
+	return nil
+}
+
+func decodeWAV(data []byte) (*wav, error) {
+	if !isWAV(data) {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+	var format, bitsPerSample int
+	w := &wav{}
+	chunks := data[12:]
+	for len(chunks) >= 8 {
+		id := string(chunks[0:4])
+		size := int(binary.LittleEndian.Uint32(chunks[4:8]))
+		if size > len(chunks)-8 {
+			// Streamed WAV files can have the wrong size, so read what's there
+			size = len(chunks) - 8
+		}
+		body := chunks[8 : 8+size]
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("invalid fmt chunk")
+			}
+			format = int(binary.LittleEndian.Uint16(body[0:2]))
+			w.channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			w.sampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(body[14:16]))
+			if format == wavFormatExtensible && size >= 26 {
+				format = int(binary.LittleEndian.Uint16(body[24:26]))
+			}
+		case "data":
+			if w.channels == 0 {
+				return nil, fmt.Errorf("data chunk before fmt chunk")
+			}
+			samples, err := decodeSamples(body, format, bitsPerSample)
+			if err != nil {
+				return nil, err
+			}
+			w.samples = samples
+			if w.sampleRate == 0 {
+				return nil, fmt.Errorf("invalid sample rate")
+			}
+			return w, nil
+		}
+		// Chunks are padded to an even size
+		next := 8 + size + size%2
+		if next > len(chunks) {
+			break
+		}
+		chunks = chunks[next:]
+	}
+	return nil, fmt.Errorf("no data chunk")
+}
+
+func decodeSamples(data []byte, format int, bitsPerSample int) ([]float64, error) {
+	bytesPerSample := bitsPerSample / 8
+	if bytesPerSample == 0 {
+		return nil, fmt.Errorf("unsupported sample size of %d bits", bitsPerSample)
+	}
+	samples := make([]float64, 0, len(data)/bytesPerSample)
+	r := bytes.NewReader(data)
+	for r.Len() >= bytesPerSample {
+		switch {
+		case format == wavFormatPCM && bitsPerSample == 8:
+			b, _ := r.ReadByte()
+			samples = append(samples, (float64(b)-128)/128)
+		case format == wavFormatPCM && bitsPerSample == 16:
+			var v int16
+			_ = binary.Read(r, binary.LittleEndian, &v)
+			samples = append(samples, float64(v)/(1<<15))
+		case format == wavFormatPCM && bitsPerSample == 24:
+			b := make([]byte, 3)
+			_, _ = r.Read(b)
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			samples = append(samples, float64(v)/(1<<23))
+		case format == wavFormatPCM && bitsPerSample == 32:
+			var v int32
+			_ = binary.Read(r, binary.LittleEndian, &v)
+			samples = append(samples, float64(v)/(1<<31))
+		case format == wavFormatFloat && bitsPerSample == 32:
+			var v float32
+			_ = binary.Read(r, binary.LittleEndian, &v)
+			samples = append(samples, float64(v))
+		case format == wavFormatFloat && bitsPerSample == 64:
+			var v float64
+			_ = binary.Read(r, binary.LittleEndian, &v)
+			samples = append(samples, v)
+		default:
+			return nil, fmt.Errorf("unsupported WAV format %d with %d bits per sample", format, bitsPerSample)
+		}
+	}
+	return samples, nil
+}
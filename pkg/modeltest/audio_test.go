@@ -0,0 +1,63 @@
+package modeltest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+)
+
+// testWAV returns a mono 16-bit WAV of a sine wave, with random noise of up to noise added
+func testWAV(t *testing.T, frequency float64, seconds float64, noise float64) string {
+	t.Helper()
+	const sampleRate = 8000
+	rng := rand.New(rand.NewSource(1)) //#nosec G404
+	n := int(seconds * sampleRate)
+	var data bytes.Buffer
+	for i := 0; i < n; i++ {
+		v := 0.5*math.Sin(2*math.Pi*frequency*float64(i)/sampleRate) + noise*(2*rng.Float64()-1)
+		require.NoError(t, binary.Write(&data, binary.LittleEndian, int16(v*math.MaxInt16)))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, uint32(36+data.Len())))
+	buf.WriteString("WAVEfmt ")
+	for _, v := range []any{uint32(16), uint16(wavFormatPCM), uint16(1), uint32(sampleRate), uint32(sampleRate * 2), uint16(2), uint16(16)} {
+		require.NoError(t, binary.Write(&buf, binary.LittleEndian, v))
+	}
+	buf.WriteString("data")
+	require.NoError(t, binary.Write(&buf, binary.LittleEndian, uint32(data.Len())))
+	buf.Write(data.Bytes())
+	return dataurl.New(buf.Bytes(), "audio/wav").String()
+}
+
+func TestCompareAudio(t *testing.T) {
+	original := testWAV(t, 440, 1, 0)
+
+	require.NoError(t, Compare(original, testWAV(t, 440, 1, 0.001), DefaultMediaOptions))
+
+	err := Compare(original, testWAV(t, 880, 1, 0), DefaultMediaOptions)
+	require.ErrorContains(t, err, "output: the audio sounds different")
+
+	err = Compare(original, testWAV(t, 440, 2, 0), DefaultMediaOptions)
+	require.EqualError(t, err, "output: expected 1.00s of audio, got 2.00s")
+}
+
+func TestDecodeWAV(t *testing.T) {
+	u, err := dataurl.DecodeString(testWAV(t, 440, 0.5, 0))
+	require.NoError(t, err)
+	w, err := decodeWAV(u.Data)
+	require.NoError(t, err)
+	require.Equal(t, 8000, w.sampleRate)
+	require.Equal(t, 1, w.channels)
+	require.Len(t, w.samples, 4000)
+	require.InDelta(t, 0.5, w.duration(), 1e-9)
+
+	_, err = decodeWAV([]byte("RIFF\x00\x00\x00\x00WAVE"))
+	require.EqualError(t, err, "no data chunk")
+}
@@ -0,0 +1,198 @@
+// Package modeltest checks the outputs of a model's predictions, for `cog test`.
+package modeltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/replicate/cog/pkg/util/mime"
+)
+
+// SeedEnvVar is the environment variable Cog passes to models to make their predictions repeatable. Cog seeds
+// Python's random module, NumPy and PyTorch with it before setup() and before every prediction. Models that use
+// other sources of randomness should seed them from it too.
+const SeedEnvVar = "COG_SEED"
+
+// Options are how closely outputs must match
+type Options struct {
+	// Tolerance is how much numbers may differ by, including numbers in JSON files
+	Tolerance float64
+	// Media compares images and audio by how similar they look and sound, rather than byte for byte. Images must be
+	// PNG, JPEG or GIF, and audio must be WAV. Other files must be identical.
+	Media bool
+	// MinSSIM is the lowest structural similarity (SSIM) between images, from 0 to 1, when Media is set
+	MinSSIM float64
+	// MaxHashDistance is how many of the 64 bits of images' perceptual hashes may differ, when Media is set
+	MaxHashDistance int
+	// MinSNR is the lowest signal-to-noise ratio between audio files, in decibels, when Media is set
+	MinSNR float64
+}
+
+// DefaultMediaOptions are the options for comparing outputs with golden outputs
+var DefaultMediaOptions = Options{
+	Media:           true,
+	MinSSIM:         0.95,
+	MaxHashDistance: 6,
+	MinSNR:          30,
+}
+
+// Compare compares an output with the expected output, and returns an error describing the first difference.
+// Files are data URLs, like the model server returns.
+func Compare(expected any, actual any, opts Options) error {
+	return compare("output", expected, actual, opts)
+}
+
+func compare(path string, expected any, actual any, opts Options) error {
+	switch exp := expected.(type) {
+	case []any:
+		act, ok := actual.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected a list, got %s", path, describe(actual))
+		}
+		if len(act) != len(exp) {
+			return fmt.Errorf("%s: expected %d items, got %d", path, len(exp), len(act))
+		}
+		for i := range exp {
+			if err := compare(fmt.Sprintf("%s[%d]", path, i), exp[i], act[i], opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		act, ok := actual.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %s", path, describe(actual))
+		}
+		keys := make([]string, 0, len(exp))
+		for key := range exp {
+			keys = append(keys, key)
+		}
+		for key := range act {
+			if _, ok := exp[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := compare(path+"."+key, exp[key], act[key], opts); err != nil {
+				return err
+			}
+		}
+		return nil
+	case float64:
+		act, ok := actual.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected a number, got %s", path, describe(actual))
+		}
+		if math.Abs(exp-act) > opts.Tolerance {
+			return fmt.Errorf("%s: expected %v, got %v (a difference of %g)", path, exp, act, math.Abs(exp-act))
+		}
+		return nil
+	case string:
+		act, ok := actual.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string, got %s", path, describe(actual))
+		}
+		if exp == act {
+			return nil
+		}
+		if strings.HasPrefix(exp, "data:") && strings.HasPrefix(act, "data:") {
+			return compareFiles(path, exp, act, opts)
+		}
+		return fmt.Errorf("%s: expected %q, got %q", path, truncate(exp), truncate(act))
+	}
+	if describe(expected) != describe(actual) {
+		return fmt.Errorf("%s: expected %s, got %s", path, describe(expected), describe(actual))
+	}
+	if expected != actual {
+		return fmt.Errorf("%s: expected %v, got %v", path, expected, actual)
+	}
+	return nil
+}
+
+func compareFiles(path string, expected string, actual string, opts Options) error {
+	exp, err := dataurl.DecodeString(expected)
+	if err != nil {
+		return fmt.Errorf("%s: failed to decode file: %w", path, err)
+	}
+	act, err := dataurl.DecodeString(actual)
+	if err != nil {
+		return fmt.Errorf("%s: failed to decode file: %w", path, err)
+	}
+	if !sameType(exp.ContentType(), act.ContentType()) {
+		return fmt.Errorf("%s: expected a %s file, got %s", path, exp.ContentType(), act.ContentType())
+	}
+	if bytes.Equal(exp.Data, act.Data) {
+		return nil
+	}
+
+	switch {
+	case isJSON(exp.ContentType()):
+		var expValue, actValue any
+		if err := json.Unmarshal(exp.Data, &expValue); err != nil {
+			return fmt.Errorf("%s: failed to parse expected JSON: %w", path, err)
+		}
+		if err := json.Unmarshal(act.Data, &actValue); err != nil {
+			return fmt.Errorf("%s: failed to parse JSON: %w", path, err)
+		}
+		return compare(path, expValue, actValue, opts)
+	case opts.Media && strings.HasPrefix(exp.ContentType(), "image/"):
+		return compareImages(path, exp.Data, act.Data, opts)
+	case opts.Media && isWAV(exp.Data):
+		return compareAudio(path, exp.Data, act.Data, opts)
+	}
+
+	if len(exp.Data) != len(act.Data) {
+		return fmt.Errorf("%s: the files are different sizes (%d and %d bytes)", path, len(exp.Data), len(act.Data))
+	}
+	for i := range exp.Data {
+		if exp.Data[i] != act.Data[i] {
+			return fmt.Errorf("%s: the files are different, from byte %d", path, i)
+		}
+	}
+	return nil
+}
+
+// sameType returns whether two media types are the same, or are aliases like audio/wav and audio/x-wav
+func sameType(a string, b string) bool {
+	return a == b || (mime.ExtensionByType(a) != "" && mime.ExtensionByType(a) == mime.ExtensionByType(b))
+}
+
+func isJSON(contentType string) bool {
+	return contentType == "application/json" || strings.HasSuffix(contentType, "+json")
+}
+
+func truncate(s string) string {
+	const maxLen = 80
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
+
+func describe(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "nothing"
+	case string:
+		if strings.HasPrefix(v, "data:") {
+			return "a file"
+		}
+		return "a string"
+	case bool:
+		return "a boolean"
+	case float64:
+		return "a number"
+	case []any:
+		return "a list"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,48 @@
+package modeltest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+)
+
+func jsonURL(data string) string {
+	return dataurl.New([]byte(data), "application/json").String()
+}
+
+func TestCompare(t *testing.T) {
+	png := func(data string) string {
+		return dataurl.New([]byte(data), "image/png").String()
+	}
+	testCases := []struct {
+		name        string
+		expected    any
+		actual      any
+		tolerance   float64
+		expectedErr string
+	}{
+		{name: "identical", expected: map[string]any{"image": png("cat"), "score": 0.5}, actual: map[string]any{"image": png("cat"), "score": 0.5}},
+		{name: "within tolerance", expected: []any{1.0, 2.0}, actual: []any{1.0001, 2.0}, tolerance: 0.001},
+		{name: "outside tolerance", expected: []any{1.0, 2.0}, actual: []any{1.0, 2.5}, tolerance: 0.001, expectedErr: "output[1]: expected 2, got 2.5 (a difference of 0.5)"},
+		{name: "bitwise numbers", expected: 0.1, actual: 0.10000000000000002, expectedErr: "output: expected 0.1, got 0.10000000000000002 (a difference of 1.3877787807814457e-17)"},
+		{name: "different file", expected: png("cat"), actual: png("cap"), tolerance: 1, expectedErr: "output: the files are different, from byte 2"},
+		{name: "different file type", expected: png("cat"), actual: dataurl.New([]byte("cat"), "image/jpeg").String(), expectedErr: "output: expected a image/png file, got image/jpeg"},
+		{name: "different string", expected: "a cat", actual: "a dog", expectedErr: `output: expected "a cat", got "a dog"`},
+		{name: "extra key", expected: map[string]any{}, actual: map[string]any{"seed": 1.0}, expectedErr: "output.seed: expected nothing, got a number"},
+		{name: "different length", expected: []any{"a"}, actual: []any{"a", "b"}, expectedErr: "output: expected 1 items, got 2"},
+		{name: "different boolean", expected: true, actual: false, expectedErr: "output: expected true, got false"},
+		{name: "equivalent JSON files", expected: jsonURL(`{"a": [1, 2]}`), actual: jsonURL(`{"a":[1,2.001]}`), tolerance: 0.01},
+		{name: "different JSON files", expected: jsonURL(`{"a": [1, 2]}`), actual: jsonURL(`{"a": [1, 3]}`), expectedErr: "output.a[1]: expected 2, got 3 (a difference of 1)"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Compare(tc.expected, tc.actual, Options{Tolerance: tc.tolerance})
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package modeltest
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register GIF decoder
+	_ "image/jpeg" // Register JPEG decoder
+	_ "image/png"  // Register PNG decoder
+	"math"
+	"math/bits"
+)
+
+// ssimWindow is the size of the windows SSIM is calculated over, in pixels
+const ssimWindow = 8
+
+func compareImages(path string, expected []byte, actual []byte, opts Options) error {
+	exp, _, err := image.Decode(bytes.NewReader(expected))
+	if err != nil {
+		return fmt.Errorf("%s: the files are different, and the expected image couldn't be decoded to compare them: %w", path, err)
+	}
+	act, _, err := image.Decode(bytes.NewReader(actual))
+	if err != nil {
+		return fmt.Errorf("%s: failed to decode image: %w", path, err)
+	}
+	expSize, actSize := exp.Bounds().Size(), act.Bounds().Size()
+	if expSize != actSize {
+		return fmt.Errorf("%s: expected a %dx%d image, got %dx%d", path, expSize.X, expSize.Y, actSize.X, actSize.Y)
+	}
+	if expSize.X == 0 || expSize.Y == 0 {
+		return nil
+	}
+
+	expGray, actGray := grayscale(exp), grayscale(act)
+	if distance := bits.OnesCount64(dHash(expGray) ^ dHash(actGray)); distance > opts.MaxHashDistance {
+		return fmt.Errorf("%s: the images look different (%d of 64 bits of their perceptual hashes differ, more than %d)", path, distance, opts.MaxHashDistance)
+	}
+	if similarity := ssim(expGray, actGray); similarity < opts.MinSSIM {
+		return fmt.Errorf("%s: the images look different (their SSIM is %.4f, less than %g)", path, similarity, opts.MinSSIM)
+	}
+	return nil
+}
+
+// grayImage is an image's luma, from 0 to 255
+type grayImage struct {
+	width, height int
+	pix           []float64
+}
+
+func (g grayImage) at(x, y int) float64 {
+	return g.pix[y*g.width+x]
+}
+
+func grayscale(img image.Image) grayImage {
+	bounds := img.Bounds()
+	g := grayImage{width: bounds.Dx(), height: bounds.Dy(), pix: make([]float64, bounds.Dx()*bounds.Dy())}
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			r, gr, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			// ITU-R BT.601 luma, scaled from 16 bits to 8
+			g.pix[y*g.width+x] = (0.299*float64(r) + 0.587*float64(gr) + 0.114*float64(b)) / 257
+		}
+	}
+	return g
+}
+
+// ssim returns the mean structural similarity of two images of the same size, over windows of ssimWindow pixels
+func ssim(a grayImage, b grayImage) float64 {
+	const (
+		c1 = (0.01 * 255) * (0.01 * 255)
+		c2 = (0.03 * 255) * (0.03 * 255)
+	)
+	windowWidth, windowHeight := min(ssimWindow, a.width), min(ssimWindow, a.height)
+	total, windows := 0.0, 0
+	for y0 := 0; y0+windowHeight <= a.height; y0 += windowHeight {
+		for x0 := 0; x0+windowWidth <= a.width; x0 += windowWidth {
+			var sumA, sumB, sumAA, sumBB, sumAB float64
+			for y := y0; y < y0+windowHeight; y++ {
+				for x := x0; x < x0+windowWidth; x++ {
+					pa, pb := a.at(x, y), b.at(x, y)
+					sumA += pa
+					sumB += pb
+					sumAA += pa * pa
+					sumBB += pb * pb
+					sumAB += pa * pb
+				}
+			}
+			n := float64(windowWidth * windowHeight)
+			meanA, meanB := sumA/n, sumB/n
+			varA, varB := sumAA/n-meanA*meanA, sumBB/n-meanB*meanB
+			covariance := sumAB/n - meanA*meanB
+			total += ((2*meanA*meanB + c1) * (2*covariance + c2)) / ((meanA*meanA + meanB*meanB + c1) * (varA + varB + c2))
+			windows++
+		}
+	}
+	if windows == 0 {
+		return 1
+	}
+	return total / float64(windows)
+}
+
+// dHash returns the difference hash of an image: whether each pixel is brighter than the next, when the image is
+// shrunk to 9x8 pixels
+func dHash(g grayImage) uint64 {
+	const width, height = 9, 8
+	var small [height][width]float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			small[y][x] = boxAverage(g, x*g.width/width, y*g.height/height, (x+1)*g.width/width, (y+1)*g.height/height)
+		}
+	}
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if small[y][x] > small[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// boxAverage returns the average of the pixels from (x0, y0) up to (x1, y1), or the nearest pixel if that's empty
+func boxAverage(g grayImage, x0, y0, x1, y1 int) float64 {
+	x1, y1 = max(x1, x0+1), max(y1, y0+1)
+	x0, y0 = min(x0, g.width-1), min(y0, g.height-1)
+	x1, y1 = min(x1, g.width), min(y1, g.height)
+	sum := 0.0
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			sum += g.at(x, y)
+		}
+	}
+	return sum / math.Max(1, float64((x1-x0)*(y1-y0)))
+}
@@ -0,0 +1,68 @@
+package modeltest
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vincent-petithory/dataurl"
+)
+
+// testImage returns a PNG of a gradient with a square in it, with random noise of up to noise levels added
+func testImage(t *testing.T, squareX int, noise int) string {
+	t.Helper()
+	rng := rand.New(rand.NewSource(1)) //#nosec G404
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	for y := 0; y < 48; y++ {
+		for x := 0; x < 64; x++ {
+			v := x * 3
+			if x >= squareX && x < squareX+16 && y >= 16 && y < 32 {
+				v = 255 - v
+			}
+			if noise > 0 {
+				v = min(255, max(0, v+rng.Intn(2*noise+1)-noise))
+			}
+			img.Set(x, y, color.RGBA{R: uint8(v), G: uint8(v), B: uint8(v), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return dataurl.New(buf.Bytes(), "image/png").String()
+}
+
+func TestCompareImages(t *testing.T) {
+	original := testImage(t, 8, 0)
+
+	require.NoError(t, Compare(original, testImage(t, 8, 2), DefaultMediaOptions))
+
+	err := Compare(original, testImage(t, 40, 0), DefaultMediaOptions)
+	require.ErrorContains(t, err, "output: the images look different")
+
+	// Without Media, images must be identical
+	err = Compare(original, testImage(t, 8, 2), Options{})
+	require.ErrorContains(t, err, "output: the files are different")
+
+	small := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, small))
+	err = Compare(original, dataurl.New(buf.Bytes(), "image/png").String(), DefaultMediaOptions)
+	require.EqualError(t, err, "output: expected a 64x48 image, got 32x32")
+}
+
+func TestSSIM(t *testing.T) {
+	a := grayImage{width: 16, height: 16, pix: make([]float64, 256)}
+	for i := range a.pix {
+		a.pix[i] = float64(i % 256)
+	}
+	require.InDelta(t, 1.0, ssim(a, a), 1e-9)
+
+	inverted := grayImage{width: 16, height: 16, pix: make([]float64, 256)}
+	for i := range a.pix {
+		inverted.pix[i] = 255 - a.pix[i]
+	}
+	require.Less(t, ssim(a, inverted), 0.0)
+}
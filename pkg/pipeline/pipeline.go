@@ -0,0 +1,110 @@
+// Package pipeline runs pipelines of Cog images, where the outputs of earlier models are inputs to later ones, like
+// speech recognition, then translation, then text to speech. Each step runs in a container of its own.
+//
+// Pipelines of predictors in the project are built into one image instead, and run by the Python server.
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// Predictor runs predictions for a step of a pipeline. *predict.Predictor is one.
+type Predictor interface {
+	PredictInput(ctx context.Context, input map[string]any) (*predict.Response, error)
+}
+
+// StepError is returned when a step of a pipeline fails
+type StepError struct {
+	Step string
+	Err  error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("Pipeline step %s failed: %s", e.Step, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Run runs the steps of a pipeline one after another with the pipeline's input, and returns the last step's
+// prediction. predictors has the predictor for each step, by name. onStep is called before each step is run, if it
+// isn't nil.
+func Run(ctx context.Context, steps []config.PipelineStep, predictors map[string]Predictor, input map[string]any, onStep func(step config.PipelineStep)) (*predict.Response, error) {
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("The pipeline doesn't have any steps")
+	}
+	outputs := map[string]any{}
+	var prediction *predict.Response
+	for _, step := range steps {
+		predictor, ok := predictors[step.Name]
+		if !ok {
+			return nil, fmt.Errorf("No predictor for pipeline step %s", step.Name)
+		}
+		stepInput, err := StepInput(step, input, outputs)
+		if err != nil {
+			return nil, &StepError{Step: step.Name, Err: err}
+		}
+		if onStep != nil {
+			onStep(step)
+		}
+		prediction, err = predictor.PredictInput(ctx, stepInput)
+		if err != nil {
+			return nil, &StepError{Step: step.Name, Err: err}
+		}
+		if prediction.Status == "failed" {
+			return prediction, &StepError{Step: step.Name, Err: fmt.Errorf("%s", prediction.Error)}
+		}
+		if prediction.Output != nil {
+			outputs[step.Name] = *prediction.Output
+		} else {
+			outputs[step.Name] = nil
+		}
+	}
+	return prediction, nil
+}
+
+// StepInput returns the input for a step of a pipeline, from the pipeline's input and the outputs of the steps before
+// it, by name. Inputs of the pipeline that weren't passed are left out, so the model uses its defaults.
+func StepInput(step config.PipelineStep, input map[string]any, outputs map[string]any) (map[string]any, error) {
+	stepInput := map[string]any{}
+	for _, name := range slices.Sorted(maps.Keys(step.Inputs)) {
+		value := step.Inputs[name]
+		ref, ok, err := config.ParsePipelineReference(value)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			stepInput[name] = config.PipelineLiteral(value)
+			continue
+		}
+		if ref.Step == config.PipelineInput {
+			if v, ok := input[ref.Field]; ok {
+				stepInput[name] = v
+			}
+			continue
+		}
+		output, ok := outputs[ref.Step]
+		if !ok {
+			return nil, fmt.Errorf("Input %s refers to the output of %s, which hasn't run", name, ref.Step)
+		}
+		if ref.Field == "" {
+			stepInput[name] = output
+			continue
+		}
+		object, ok := output.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("Input %s refers to $%s.output.%s, but the output of %s isn't an object", name, ref.Step, ref.Field, ref.Step)
+		}
+		if stepInput[name], ok = object[ref.Field]; !ok {
+			return nil, fmt.Errorf("Input %s refers to $%s.output.%s, but the output of %s doesn't have %s", name, ref.Step, ref.Field, ref.Step, ref.Field)
+		}
+	}
+	return stepInput, nil
+}
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/config"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+type fakePredictor struct {
+	input  map[string]any
+	output any
+	err    error
+}
+
+func (p *fakePredictor) PredictInput(ctx context.Context, input map[string]any) (*predict.Response, error) {
+	p.input = input
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &predict.Response{Status: "succeeded", Output: &p.output}, nil
+}
+
+func TestRun(t *testing.T) {
+	steps := []config.PipelineStep{
+		{Name: "transcribe", Image: "asr", Inputs: map[string]any{"audio": "$input.audio", "language": "$input.language"}},
+		{Name: "translate", Image: "translate", Inputs: map[string]any{"text": "$transcribe.output.text", "target": "fr", "prefix": "$$5"}},
+		{Name: "speak", Image: "tts", Inputs: map[string]any{"text": "$translate.output"}},
+	}
+	transcribe := &fakePredictor{output: map[string]any{"text": "hello", "language": "en"}}
+	translate := &fakePredictor{output: "bonjour"}
+	speak := &fakePredictor{output: "data:audio/wav;base64,AAAA"}
+	predictors := map[string]Predictor{"transcribe": transcribe, "translate": translate, "speak": speak}
+
+	ran := []string{}
+	prediction, err := Run(context.Background(), steps, predictors, map[string]any{"audio": "data:audio/wav;base64,BBBB"}, func(step config.PipelineStep) {
+		ran = append(ran, step.Name)
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"transcribe", "translate", "speak"}, ran)
+
+	// Pipeline inputs that weren't passed are left out
+	require.Equal(t, map[string]any{"audio": "data:audio/wav;base64,BBBB"}, transcribe.input)
+	require.Equal(t, map[string]any{"text": "hello", "target": "fr", "prefix": "$5"}, translate.input)
+	require.Equal(t, map[string]any{"text": "bonjour"}, speak.input)
+	require.Equal(t, "data:audio/wav;base64,AAAA", *prediction.Output)
+}
+
+func TestRunStepFails(t *testing.T) {
+	steps := []config.PipelineStep{
+		{Name: "transcribe", Image: "asr", Inputs: map[string]any{"audio": "$input.audio"}},
+		{Name: "translate", Image: "translate", Inputs: map[string]any{"text": "$transcribe.output"}},
+	}
+	translate := &fakePredictor{}
+	predictors := map[string]Predictor{
+		"transcribe": &fakePredictor{err: errors.New("connection refused")},
+		"translate":  translate,
+	}
+	_, err := Run(context.Background(), steps, predictors, map[string]any{}, nil)
+	var stepErr *StepError
+	require.ErrorAs(t, err, &stepErr)
+	require.Equal(t, "transcribe", stepErr.Step)
+	require.EqualError(t, err, "Pipeline step transcribe failed: connection refused")
+	require.Nil(t, translate.input)
+}
+
+func TestStepInputErrors(t *testing.T) {
+	outputs := map[string]any{"transcribe": "hello"}
+	for _, tt := range []struct {
+		value any
+		err   string
+	}{
+		{"$transcribe.output.text", "the output of transcribe isn't an object"},
+		{"$translate.output", "refers to the output of translate, which hasn't run"},
+		{"$transcribe", "Invalid reference"},
+	} {
+		step := config.PipelineStep{Name: "speak", Inputs: map[string]any{"text": tt.value}}
+		_, err := StepInput(step, nil, outputs)
+		require.ErrorContains(t, err, tt.err)
+	}
+
+	step := config.PipelineStep{Name: "speak", Inputs: map[string]any{"text": "$transcribe.output.text"}}
+	_, err := StepInput(step, nil, map[string]any{"transcribe": map[string]any{"language": "en"}})
+	require.ErrorContains(t, err, "the output of transcribe doesn't have text")
+}
@@ -55,7 +55,9 @@ func NewInputsWithBaseDir(keyVals map[string]string, baseDir string) Inputs {
 	return input
 }
 
-func (inputs *Inputs) toMap() (map[string]any, error) {
+// ToMap returns the inputs as they're sent to the model, like the input in the prediction API. Files are read
+// into data URLs.
+func (inputs *Inputs) ToMap() (map[string]any, error) {
 	keyVals := map[string]any{}
 	for key, input := range *inputs {
 		switch {
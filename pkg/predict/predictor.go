@@ -2,7 +2,10 @@ package predict
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -18,8 +21,19 @@ import (
 
 type status string
 
+var errHealthcheckInvalid = errors.New("Container healthcheck returned invalid response")
+
 type HealthcheckResponse struct {
-	Status string `json:"status"`
+	Status string      `json:"status"`
+	Setup  SetupResult `json:"setup"`
+	// CogVersion is the version of Cog's runtime that's serving the model
+	CogVersion string `json:"cog_version"`
+}
+
+type SetupResult struct {
+	Status  string             `json:"status"`
+	Logs    string             `json:"logs"`
+	Metrics map[string]float64 `json:"metrics"`
 }
 
 type Request struct {
@@ -31,6 +45,15 @@ type Response struct {
 	Status status       `json:"status"`
 	Output *interface{} `json:"output"`
 	Error  string       `json:"error"`
+	// Metrics are the prediction's metrics, like predict_time, and the cpu_time, gpu_time and energy it used
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+}
+
+// ReloadResponse is the response from /admin/reload
+type ReloadResponse struct {
+	Setup SetupResult `json:"setup"`
+	// Detail says why the model failed to reload
+	Detail string `json:"detail"`
 }
 
 type ValidationErrorResponse struct {
@@ -44,6 +67,9 @@ type ValidationErrorResponse struct {
 type Predictor struct {
 	runOptions docker.RunOptions
 	isTrain    bool
+	method     string
+	token      string
+	tls        bool
 
 	// Running state
 	containerID string
@@ -63,24 +89,61 @@ func NewPredictor(runOptions docker.RunOptions, isTrain bool, fastFlag bool) Pre
 	return Predictor{runOptions: runOptions, isTrain: isTrain}
 }
 
-func (p *Predictor) Start(logsWriter io.Writer, timeout time.Duration) error {
+// NewServerPredictor returns a Predictor for a prediction server that is already running on the given port,
+// such as one started by `cog serve`. It doesn't need to be started or stopped.
+func NewServerPredictor(port int, isTrain bool) Predictor {
+	return Predictor{isTrain: isTrain, port: port}
+}
+
+// SetTLS makes the predictor talk to the server over HTTPS. The server is on localhost and typically uses a
+// self-signed certificate from `cog serve --tls`, so its certificate isn't verified.
+func (p *Predictor) SetTLS(tls bool) {
+	p.tls = tls
+}
+
+// SetMethod makes the predictor call one of the model's other predict methods, listed in predict_methods in cog.yaml,
+// instead of predict()
+func (p *Predictor) SetMethod(method string) {
+	p.method = method
+}
+
+// SetToken sets the token sent to the server in the Authorization header, for servers that require authentication
+func (p *Predictor) SetToken(token string) {
+	p.token = token
+}
+
+// Token returns the token sent to the server, or "" if it doesn't require one
+func (p *Predictor) Token() string {
+	return p.token
+}
+
+// Port returns the port on the host that the prediction server is listening on
+func (p *Predictor) Port() int {
+	return p.port
+}
+
+// Start starts the model's container, and waits for its setup() to finish. If ctx is canceled before then, the
+// container is stopped.
+func (p *Predictor) Start(ctx context.Context, logsWriter io.Writer, timeout time.Duration) error {
 	var err error
 	containerPort := 5000
 
 	p.runOptions.Ports = append(p.runOptions.Ports, docker.Port{HostPort: 0, ContainerPort: containerPort})
 
-	p.containerID, err = docker.RunDaemon(p.runOptions, logsWriter)
+	p.containerID, err = docker.RunDaemon(ctx, p.runOptions, logsWriter)
 	if err != nil {
 		return fmt.Errorf("Failed to start container: %w", err)
 	}
 
-	p.port, err = docker.GetPort(p.containerID, containerPort)
+	p.port, err = docker.GetPort(ctx, p.containerID, containerPort)
 	if err != nil {
+		p.stopIfCanceled(ctx)
 		return fmt.Errorf("Failed to determine container port: %w", err)
 	}
 
 	go func() {
-		if err := docker.ContainerLogsFollow(p.containerID, logsWriter); err != nil {
+		// The logs end when the container stops, so they outlive ctx
+		if err := docker.ContainerLogsFollow(context.WithoutCancel(ctx), p.containerID, logsWriter); err != nil {
 			// if user hits ctrl-c we expect an error signal
 			if !strings.Contains(err.Error(), "signal: interrupt") {
 				console.Warnf("Error getting container logs: %s", err)
@@ -88,22 +151,38 @@ func (p *Predictor) Start(logsWriter io.Writer, timeout time.Duration) error {
 		}
 	}()
 
-	return p.waitForContainerReady(timeout)
+	if err := p.waitForContainerReady(ctx, timeout); err != nil {
+		p.stopIfCanceled(ctx)
+		return err
+	}
+	return nil
 }
 
-func (p *Predictor) waitForContainerReady(timeout time.Duration) error {
-	url := fmt.Sprintf("http://localhost:%d/health-check", p.port)
+// stopIfCanceled stops the container if it's starting up and ctx was canceled, so it isn't left running
+func (p *Predictor) stopIfCanceled(ctx context.Context) {
+	if ctx.Err() == nil {
+		return
+	}
+	if err := p.Stop(context.WithoutCancel(ctx)); err != nil {
+		console.Warnf("Failed to stop container: %s", err)
+	}
+}
 
+func (p *Predictor) waitForContainerReady(ctx context.Context, timeout time.Duration) error {
 	start := time.Now()
 	for {
 		now := time.Now()
 		if now.Sub(start) > timeout {
-			return fmt.Errorf("Timed out")
+			return fmt.Errorf("Timed out after %s waiting for setup() to complete. Set --setup-timeout or serve.setup_timeout in cog.yaml to wait longer", timeout)
 		}
 
-		time.Sleep(100 * time.Millisecond)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
 
-		cont, err := docker.ContainerInspect(p.containerID)
+		cont, err := docker.ContainerInspect(ctx, p.containerID)
 		if err != nil {
 			return fmt.Errorf("Failed to get container status: %w", err)
 		}
@@ -111,17 +190,13 @@ func (p *Predictor) waitForContainerReady(timeout time.Duration) error {
 			return fmt.Errorf("Container exited unexpectedly")
 		}
 
-		resp, err := http.Get(url) //#nosec G107
+		healthcheck, err := p.healthcheck()
 		if err != nil {
+			if errors.Is(err, errHealthcheckInvalid) {
+				return err
+			}
 			continue
 		}
-		if resp.StatusCode != http.StatusOK {
-			continue
-		}
-		healthcheck := &HealthcheckResponse{}
-		if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
-			return fmt.Errorf("Container healthcheck returned invalid response: %w", err)
-		}
 		// These status values are defined in python/cog/server/http.py
 		switch healthcheck.Status {
 		case "STARTING":
@@ -129,6 +204,9 @@ func (p *Predictor) waitForContainerReady(timeout time.Duration) error {
 		case "SETUP_FAILED":
 			return fmt.Errorf("Model setup failed")
 		case "READY":
+			if setupTime, ok := healthcheck.Setup.Metrics["setup_time"]; ok {
+				console.Infof("Model setup took %.1fs", setupTime)
+			}
 			return nil
 		default:
 			return fmt.Errorf("Container healthcheck returned unexpected status: %s", healthcheck.Status)
@@ -136,15 +214,48 @@ func (p *Predictor) waitForContainerReady(timeout time.Duration) error {
 	}
 }
 
-func (p *Predictor) Stop() error {
-	return docker.Stop(p.containerID)
+// IsReady returns whether the prediction server is ready to take predictions
+func (p *Predictor) IsReady() bool {
+	healthcheck, err := p.healthcheck()
+	return err == nil && healthcheck.Status == "READY"
+}
+
+func (p *Predictor) healthcheck() (*HealthcheckResponse, error) {
+	url := p.BaseURL() + "/health-check"
+	resp, err := p.client().Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("/health-check returned status %d", resp.StatusCode)
+	}
+	healthcheck := &HealthcheckResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(healthcheck); err != nil {
+		return nil, fmt.Errorf("%w: %w", errHealthcheckInvalid, err)
+	}
+	return healthcheck, nil
+}
+
+func (p *Predictor) Stop(ctx context.Context) error {
+	if p.containerID == "" {
+		// Not started by us, so not ours to stop
+		return nil
+	}
+	return docker.Stop(ctx, p.containerID)
 }
 
-func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
-	inputMap, err := inputs.toMap()
+func (p *Predictor) Predict(ctx context.Context, inputs Inputs) (*Response, error) {
+	inputMap, err := inputs.ToMap()
 	if err != nil {
 		return nil, err
 	}
+	return p.PredictInput(ctx, inputMap)
+}
+
+// PredictInput runs a prediction with an input that's sent to the model as it is, like the input in the
+// prediction API. Files are data URLs or URLs.
+func (p *Predictor) PredictInput(ctx context.Context, inputMap map[string]any) (*Response, error) {
 	request := Request{Input: inputMap}
 	requestBody, err := json.Marshal(request)
 	if err != nil {
@@ -152,15 +263,17 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	}
 
 	url := p.url()
-	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(requestBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBody))
 	if err != nil {
 		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
 	req.Close = true
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(req)
+	resp, err := p.client().Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
 	}
@@ -169,14 +282,21 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	if resp.StatusCode == http.StatusUnprocessableEntity {
 		errorResponse := &ValidationErrorResponse{}
 		if err := json.NewDecoder(resp.Body).Decode(errorResponse); err != nil {
-			return nil, fmt.Errorf("/%s call returned status 422, and the response body failed to decode: %w", p.endpoint(), err)
+			return nil, fmt.Errorf("/%s call returned status 422, and the response body failed to decode: %w", p.Endpoint(), err)
 		}
 
 		return nil, p.buildInputValidationErrorMessage(errorResponse)
 	}
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		if p.token == "" {
+			return nil, fmt.Errorf("/%s call returned status 401. The server requires authentication, pass a token with --token", p.Endpoint())
+		}
+		return nil, fmt.Errorf("/%s call returned status 401. The server didn't accept the token passed with --token", p.Endpoint())
+	}
+
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("/%s call returned status %d", p.endpoint(), resp.StatusCode)
+		return nil, fmt.Errorf("/%s call returned status %d", p.Endpoint(), resp.StatusCode)
 	}
 
 	prediction := &Response{}
@@ -186,8 +306,60 @@ func (p *Predictor) Predict(inputs Inputs) (*Response, error) {
 	return prediction, nil
 }
 
+// Reload loads the model on the server again, with new weights if weights isn't "", and returns the result of its
+// setup(). The server carries on running predictions on the old model until the new one is set up. If setup() fails,
+// the result is returned with the error, and the old model keeps serving.
+func (p *Predictor) Reload(ctx context.Context, weights string) (*SetupResult, error) {
+	body := map[string]string{}
+	if weights != "" {
+		body["weights"] = weights
+	}
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	url := p.BaseURL() + "/admin/reload"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create HTTP request to %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to POST HTTP request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		if p.token == "" {
+			return nil, fmt.Errorf("/admin/reload call returned status 401. The server requires authentication, pass a token with --token")
+		}
+		return nil, fmt.Errorf("/admin/reload call returned status 401. The server didn't accept the token passed with --token")
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("The server doesn't support reloading the model. Rebuild it with this version of Cog.")
+	}
+
+	reload := &ReloadResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(reload); err != nil {
+		return nil, fmt.Errorf("/admin/reload call returned status %d, and the response body failed to decode: %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if reload.Setup.Status == "" {
+			return nil, fmt.Errorf("Failed to reload the model: %s", reload.Detail)
+		}
+		return &reload.Setup, fmt.Errorf("Failed to reload the model: %s", reload.Detail)
+	}
+	return &reload.Setup, nil
+}
+
 func (p *Predictor) GetSchema() (*openapi3.T, error) {
-	resp, err := http.Get(fmt.Sprintf("http://localhost:%d/openapi.json", p.port))
+	resp, err := p.client().Get(p.BaseURL() + "/openapi.json")
 	if err != nil {
 		return nil, err
 	}
@@ -202,15 +374,39 @@ func (p *Predictor) GetSchema() (*openapi3.T, error) {
 	return openapi3.NewLoader().LoadFromData(body)
 }
 
-func (p *Predictor) endpoint() string {
+// Endpoint returns the path on the server that predictions are created at, like "predictions" or
+// "predictions/generate"
+func (p *Predictor) Endpoint() string {
 	if p.isTrain {
 		return "trainings"
 	}
+	if p.method != "" && p.method != "predict" {
+		return "predictions/" + p.method
+	}
 	return "predictions"
 }
 
 func (p *Predictor) url() string {
-	return fmt.Sprintf("http://localhost:%d/%s", p.port, p.endpoint())
+	return fmt.Sprintf("%s/%s", p.BaseURL(), p.Endpoint())
+}
+
+// BaseURL returns the URL of the prediction server, like "http://localhost:8393"
+func (p *Predictor) BaseURL() string {
+	if p.tls {
+		return fmt.Sprintf("https://localhost:%d", p.port)
+	}
+	return fmt.Sprintf("http://localhost:%d", p.port)
+}
+
+func (p *Predictor) client() *http.Client {
+	if !p.tls {
+		return &http.Client{}
+	}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //#nosec G402
+		},
+	}
 }
 
 func (p *Predictor) buildInputValidationErrorMessage(errorResponse *ValidationErrorResponse) error {
@@ -219,7 +415,7 @@ func (p *Predictor) buildInputValidationErrorMessage(errorResponse *ValidationEr
 	for _, validationError := range errorResponse.Detail {
 		if len(validationError.Location) != 3 || validationError.Location[0] != "body" || validationError.Location[1] != "input" {
 			responseBody, _ := json.MarshalIndent(errorResponse, "", "\t")
-			return fmt.Errorf("/%s call returned status 422, and there was an unexpected message in response:\n\n%s", p.endpoint(), responseBody)
+			return fmt.Errorf("/%s call returned status 422, and there was an unexpected message in response:\n\n%s", p.Endpoint(), responseBody)
 		}
 
 		errorMessages = append(errorMessages, fmt.Sprintf("- %s: %s", validationError.Location[2], validationError.Message))
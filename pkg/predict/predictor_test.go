@@ -0,0 +1,51 @@
+package predict
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReload(t *testing.T) {
+	var requests []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/admin/reload", r.URL.Path)
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		body := map[string]string{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		requests = append(requests, body)
+		if body["weights"] == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"detail": "The model failed to reload", "setup": {"status": "failed", "logs": "ValueError: broken weights"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"setup": {"status": "succeeded", "logs": ""}}`))
+	}))
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+
+	predictor := NewServerPredictor(port, false)
+	predictor.SetToken("secret")
+
+	setup, err := predictor.Reload(context.Background(), "https://example.com/lora.tar")
+	require.NoError(t, err)
+	require.Equal(t, "succeeded", setup.Status)
+
+	_, err = predictor.Reload(context.Background(), "")
+	require.NoError(t, err)
+
+	setup, err = predictor.Reload(context.Background(), "broken")
+	require.EqualError(t, err, "Failed to reload the model: The model failed to reload")
+	require.Equal(t, "ValueError: broken weights", setup.Logs)
+
+	require.Equal(t, []map[string]string{{"weights": "https://example.com/lora.tar"}, {}, {"weights": "broken"}}, requests)
+}
@@ -0,0 +1,245 @@
+// Package provenance records how an image was built, as SLSA provenance in an in-toto statement: the commit it was
+// built from, the builder that built it, and the files and images it was built with. See https://slsa.dev/provenance/v1
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/replicate/cog/pkg/global"
+)
+
+const (
+	// StatementType is the type of in-toto statements
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType is the type of SLSA provenance predicates
+	PredicateType = "https://slsa.dev/provenance/v1"
+	// BuildType is the type of builds by Cog, which says how to read a predicate's parameters
+	BuildType = "https://cog.run/build/v1"
+	// DefaultBuilderID is the builder of images built outside of CI systems Cog knows about
+	DefaultBuilderID = "https://cog.run"
+)
+
+// Label is the image label cog build saves the provenance predicate in, for cog push to attach to the image
+var Label = global.LabelNamespace + "provenance"
+
+// Statement is an in-toto statement that a predicate is true of its subjects
+type Statement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     Predicate            `json:"predicate"`
+}
+
+// Predicate is SLSA provenance: what was built from, and what built it
+type Predicate struct {
+	BuildDefinition BuildDefinition `json:"buildDefinition"`
+	RunDetails      RunDetails      `json:"runDetails"`
+}
+
+// BuildDefinition is what a build was given
+type BuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   ExternalParameters   `json:"externalParameters"`
+	InternalParameters   InternalParameters   `json:"internalParameters"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// ExternalParameters are what the person who ran the build chose
+type ExternalParameters struct {
+	// Source is the repository and commit the project was built from
+	Source *ResourceDescriptor `json:"source,omitempty"`
+	// Config is the path of cog.yaml in the source
+	Config string `json:"config"`
+	// Image is the name the image was built as
+	Image string `json:"image"`
+}
+
+// InternalParameters are what Cog chose
+type InternalParameters struct {
+	CogVersion string `json:"cogVersion"`
+	// UncommittedChanges is whether the project had changes that weren't committed, so it wasn't built from only
+	// the source's commit
+	UncommittedChanges bool `json:"uncommittedChanges,omitempty"`
+}
+
+// RunDetails is what ran a build, and when
+type RunDetails struct {
+	Builder  Builder  `json:"builder"`
+	Metadata Metadata `json:"metadata"`
+}
+
+// Builder is the CI workflow, or Cog, that ran a build
+type Builder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// Metadata is when a build ran, and the CI run that ran it
+type Metadata struct {
+	InvocationID string    `json:"invocationId,omitempty"`
+	StartedOn    time.Time `json:"startedOn"`
+	FinishedOn   time.Time `json:"finishedOn"`
+}
+
+// ResourceDescriptor is a file, image or commit, identified by its digests
+type ResourceDescriptor struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Build is what a build was built from, for NewPredicate
+type Build struct {
+	// Repository is the URL of the Git repository the project was built from, or "" if it isn't in one
+	Repository string
+	// Commit is the commit the project was built from, or "" if it isn't in a Git repository
+	Commit             string
+	UncommittedChanges bool
+	// Config is the path of cog.yaml, relative to the repository's root
+	Config string
+	Image  string
+	// Dependencies are the files and images the build used, like cog.yaml and the base image
+	Dependencies []ResourceDescriptor
+	StartedOn    time.Time
+	FinishedOn   time.Time
+}
+
+// NewPredicate returns the provenance of a build. The builder is the CI workflow that ran it, if it ran in GitHub
+// Actions.
+func NewPredicate(build Build) Predicate {
+	predicate := Predicate{
+		BuildDefinition: BuildDefinition{
+			BuildType: BuildType,
+			ExternalParameters: ExternalParameters{
+				Config: build.Config,
+				Image:  build.Image,
+			},
+			InternalParameters: InternalParameters{
+				CogVersion:         global.Version,
+				UncommittedChanges: build.UncommittedChanges,
+			},
+			ResolvedDependencies: build.Dependencies,
+		},
+		RunDetails: RunDetails{
+			Builder: Builder{ID: DefaultBuilderID, Version: map[string]string{"cog": global.Version}},
+			Metadata: Metadata{
+				StartedOn:  build.StartedOn.UTC(),
+				FinishedOn: build.FinishedOn.UTC(),
+			},
+		},
+	}
+	if build.Commit != "" {
+		predicate.BuildDefinition.ExternalParameters.Source = &ResourceDescriptor{
+			URI:    sourceURI(build.Repository),
+			Digest: map[string]string{"gitCommit": build.Commit},
+		}
+	}
+
+	// GitHub Actions sets these in workflows. See
+	// https://docs.github.com/en/actions/writing-workflows/choosing-what-your-workflow-does/store-information-in-variables#default-environment-variables
+	server := os.Getenv("GITHUB_SERVER_URL")
+	if workflowRef := os.Getenv("GITHUB_WORKFLOW_REF"); server != "" && workflowRef != "" {
+		predicate.RunDetails.Builder.ID = server + "/" + workflowRef
+		if runID := os.Getenv("GITHUB_RUN_ID"); runID != "" {
+			predicate.RunDetails.Metadata.InvocationID = fmt.Sprintf("%s/%s/actions/runs/%s/attempts/%s", server, os.Getenv("GITHUB_REPOSITORY"), runID, os.Getenv("GITHUB_RUN_ATTEMPT"))
+		}
+	}
+	return predicate
+}
+
+// NewStatement returns a statement that an image, with a digest like "sha256:...", was built as predicate says
+func NewStatement(predicate Predicate, imageName string, digest string) (*Statement, error) {
+	algorithm, hash, ok := strings.Cut(digest, ":")
+	if !ok {
+		return nil, fmt.Errorf("Invalid digest %q", digest)
+	}
+	return &Statement{
+		Type:          StatementType,
+		Subject:       []ResourceDescriptor{{Name: imageName, Digest: map[string]string{algorithm: hash}}},
+		PredicateType: PredicateType,
+		Predicate:     predicate,
+	}, nil
+}
+
+// FileDescriptor returns a descriptor of the file at path, relative to dir, with its SHA-256 digest
+func FileDescriptor(dir string, path string) (ResourceDescriptor, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, path))
+	if err != nil {
+		return ResourceDescriptor{}, fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	sum := sha256.Sum256(contents)
+	return ResourceDescriptor{Name: filepath.ToSlash(path), Digest: map[string]string{"sha256": hex.EncodeToString(sum[:])}}, nil
+}
+
+// ImageDescriptor returns a descriptor of an image pinned to a digest, like "python:3.12-slim@sha256:...", or false
+// if it isn't pinned
+func ImageDescriptor(image string) (ResourceDescriptor, bool) {
+	name, digest, ok := strings.Cut(image, "@")
+	if !ok {
+		return ResourceDescriptor{}, false
+	}
+	algorithm, hash, ok := strings.Cut(digest, ":")
+	if !ok {
+		return ResourceDescriptor{}, false
+	}
+	return ResourceDescriptor{Name: name, URI: "docker://" + image, Digest: map[string]string{algorithm: hash}}, true
+}
+
+// Verify checks that a statement is SLSA provenance of the image with a digest like "sha256:..."
+func (s *Statement) Verify(digest string) error {
+	if s.Type != StatementType {
+		return fmt.Errorf("The provenance is a statement of type %q, not %q", s.Type, StatementType)
+	}
+	if s.PredicateType != PredicateType {
+		return fmt.Errorf("The provenance has a predicate of type %q, not %q", s.PredicateType, PredicateType)
+	}
+	algorithm, hash, _ := strings.Cut(digest, ":")
+	for _, subject := range s.Subject {
+		if subject.Digest[algorithm] == hash {
+			return nil
+		}
+	}
+	return fmt.Errorf("The provenance isn't about the image %s", digest)
+}
+
+// Commit returns the commit the image was built from, or "" if it wasn't built from a Git repository
+func (p *Predicate) Commit() string {
+	if source := p.BuildDefinition.ExternalParameters.Source; source != nil {
+		return source.Digest["gitCommit"]
+	}
+	return ""
+}
+
+// Dependency returns the dependency with a name, like "cog.yaml", or nil if the build didn't use it
+func (p *Predicate) Dependency(name string) *ResourceDescriptor {
+	for i, dependency := range p.BuildDefinition.ResolvedDependencies {
+		if dependency.Name == name {
+			return &p.BuildDefinition.ResolvedDependencies[i]
+		}
+	}
+	return nil
+}
+
+// ParsePredicate parses a predicate from the label cog build saves it in
+func ParsePredicate(label string) (*Predicate, error) {
+	predicate := &Predicate{}
+	if err := json.Unmarshal([]byte(label), predicate); err != nil {
+		return nil, fmt.Errorf("Failed to parse provenance: %w", err)
+	}
+	return predicate, nil
+}
+
+// sourceURI returns the URI of a Git repository in the form SLSA uses, like "git+https://github.com/alice/hotdog"
+func sourceURI(repository string) string {
+	if repository == "" || strings.HasPrefix(repository, "git+") {
+		return repository
+	}
+	return "git+" + repository
+}
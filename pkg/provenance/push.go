@@ -0,0 +1,158 @@
+package provenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/registry"
+)
+
+// ArtifactType is the media type of provenance artifacts in a registry, and of the statement in them
+const ArtifactType = "application/vnd.in-toto+json"
+
+// ErrNotFound is returned by Fetch when an image has no provenance
+var ErrNotFound = errors.New("The image has no provenance")
+
+// Artifact returns an OCI artifact containing a statement, that refers to the image it's about
+func Artifact(statement *Statement, subject v1.Descriptor) (v1.Image, error) {
+	contents, err := json.Marshal(statement)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to convert provenance to JSON: %w", err)
+	}
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img = mutate.ConfigMediaType(img, ArtifactType)
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer: static.NewLayer(contents, ArtifactType),
+		Annotations: map[string]string{
+			"in-toto.io/predicate-type": PredicateType,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mutate.Subject(img, subject).(v1.Image), nil
+}
+
+// Push pushes the provenance of an image to the registry as an artifact that refers to imageName, so registries
+// that support the OCI referrers API list it alongside the image. It returns the artifact's reference.
+func Push(ctx context.Context, imageName string, predicate Predicate) (string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	auth := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	subject, err := remote.Head(ref, auth, remote.WithContext(ctx))
+	if registry.IsAuthError(err) {
+		return "", &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: fmt.Errorf("Failed to find %s in the registry: %w", imageName, err)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to find %s in the registry. Push it with 'cog push' first: %w", imageName, err)
+	}
+	statement, err := NewStatement(predicate, ref.Context().Name(), subject.Digest.String())
+	if err != nil {
+		return "", err
+	}
+	artifact, err := Artifact(statement, *subject)
+	if err != nil {
+		return "", err
+	}
+	digest, err := artifact.Digest()
+	if err != nil {
+		return "", err
+	}
+	dest := ref.Context().Digest(digest.String())
+	if err := remote.Write(dest, artifact, auth, remote.WithContext(ctx)); err != nil {
+		err = fmt.Errorf("Failed to push provenance: %w", err)
+		if registry.IsAuthError(err) {
+			return "", &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: err}
+		}
+		return "", err
+	}
+	return dest.String(), nil
+}
+
+// Fetch returns the statements in the provenance artifacts that refer to an image in its registry, and the digest of
+// the image they're about. It returns ErrNotFound if there aren't any.
+func Fetch(ctx context.Context, imageName string) ([]*Statement, string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return nil, "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	auth := remote.WithAuthFromKeychain(authn.DefaultKeychain)
+	subject, err := remote.Head(ref, auth, remote.WithContext(ctx))
+	if registry.IsAuthError(err) {
+		return nil, "", &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: fmt.Errorf("Failed to find %s in the registry: %w", imageName, err)}
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to find %s in the registry: %w", imageName, err)
+	}
+	digest := subject.Digest.String()
+
+	referrers, err := remote.Referrers(ref.Context().Digest(digest), auth, remote.WithContext(ctx), remote.WithFilter("artifactType", ArtifactType))
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to list the artifacts that refer to %s: %w", imageName, err)
+	}
+	index, err := referrers.IndexManifest()
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to list the artifacts that refer to %s: %w", imageName, err)
+	}
+
+	statements := []*Statement{}
+	for _, manifest := range index.Manifests {
+		// Registries that don't support filtering return every referrer
+		if manifest.ArtifactType != ArtifactType {
+			continue
+		}
+		statement, err := fetchStatement(ctx, ref.Context().Digest(manifest.Digest.String()), auth)
+		if err != nil {
+			return nil, "", err
+		}
+		statements = append(statements, statement)
+	}
+	if len(statements) == 0 {
+		return nil, digest, ErrNotFound
+	}
+	return statements, digest, nil
+}
+
+// fetchStatement returns the statement in a provenance artifact
+func fetchStatement(ctx context.Context, ref name.Digest, auth remote.Option) (*Statement, error) {
+	artifact, err := remote.Image(ref, auth, remote.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch provenance %s: %w", ref, err)
+	}
+	layers, err := artifact.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch provenance %s: %w", ref, err)
+	}
+	if len(layers) != 1 {
+		return nil, fmt.Errorf("Provenance %s has %d layers, expected 1", ref, len(layers))
+	}
+	r, err := layers[0].Uncompressed()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch provenance %s: %w", ref, err)
+	}
+	defer r.Close()
+	contents, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to fetch provenance %s: %w", ref, err)
+	}
+	statement := &Statement{}
+	if err := json.Unmarshal(contents, statement); err != nil {
+		return nil, fmt.Errorf("Failed to parse provenance %s: %w", ref, err)
+	}
+	return statement, nil
+}
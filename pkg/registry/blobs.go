@@ -0,0 +1,90 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// maxReposPerBlob is how many repositories are remembered for each blob. Only one is needed to mount it from.
+const maxReposPerBlob = 5
+
+// blobIndex is the repositories that layers have been pushed to, by digest. When a layer is pushed to a new
+// repository, like a new model with the same weights, it can be mounted from a repository it's already in on the
+// same registry rather than uploaded again.
+type blobIndex struct {
+	path string
+	mu   sync.Mutex
+	// Repositories are the repositories each blob has been pushed to, most recent first, by digest
+	Repositories map[string][]string `json:"repositories"`
+}
+
+// loadBlobIndex loads the blob index. If it can't be read, it returns an empty index that can still be saved, along with
+// the error.
+func loadBlobIndex() (*blobIndex, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	index := &blobIndex{
+		path:         filepath.Join(cacheDir, "cog", "blobs.json"),
+		Repositories: map[string][]string{},
+	}
+	contents, err := os.ReadFile(index.path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return index, fmt.Errorf("Failed to read blob index: %w", err)
+	}
+	if err := json.Unmarshal(contents, index); err != nil || index.Repositories == nil {
+		index.Repositories = map[string][]string{}
+		if err != nil {
+			return index, fmt.Errorf("Failed to parse blob index in %s: %w", index.path, err)
+		}
+	}
+	return index, nil
+}
+
+// source returns a repository on the same registry as repo that a blob has been pushed to, or "" if there isn't one
+func (i *blobIndex) source(digest v1.Hash, repo name.Repository) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, r := range i.Repositories[digest.String()] {
+		other, err := name.NewRepository(r)
+		if err != nil || other.Name() == repo.Name() {
+			continue
+		}
+		if other.RegistryStr() == repo.RegistryStr() {
+			return other.RepositoryStr()
+		}
+	}
+	return ""
+}
+
+// add records that a blob is in repo
+func (i *blobIndex) add(digest v1.Hash, repo name.Repository) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	repos := slices.DeleteFunc(i.Repositories[digest.String()], func(r string) bool { return r == repo.Name() })
+	repos = append([]string{repo.Name()}, repos...)
+	i.Repositories[digest.String()] = repos[:min(len(repos), maxReposPerBlob)]
+
+	contents, err := json.Marshal(i)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(i.path), 0o700); err != nil {
+		return fmt.Errorf("Failed to save blob index: %w", err)
+	}
+	if err := os.WriteFile(i.path, contents, 0o600); err != nil {
+		return fmt.Errorf("Failed to save blob index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBlobIndex(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	digest := v1.Hash{Algorithm: "sha256", Hex: "abc123"}
+	hotdog, err := name.NewRepository("r8.im/alice/hotdog")
+	require.NoError(t, err)
+	hotdogV2, err := name.NewRepository("r8.im/alice/hotdog-v2")
+	require.NoError(t, err)
+	elsewhere, err := name.NewRepository("ghcr.io/alice/hotdog")
+	require.NoError(t, err)
+
+	index, err := loadBlobIndex()
+	require.NoError(t, err)
+	require.Equal(t, "", index.source(digest, hotdogV2))
+	require.NoError(t, index.add(digest, hotdog))
+
+	// It's saved, and the blob can be mounted from hotdog, but not into hotdog itself or from another registry
+	index, err = loadBlobIndex()
+	require.NoError(t, err)
+	require.Equal(t, "alice/hotdog", index.source(digest, hotdogV2))
+	require.Equal(t, "", index.source(digest, hotdog))
+	require.Equal(t, "", index.source(digest, elsewhere))
+}
+
+func TestBlobIndexLimit(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	digest := v1.Hash{Algorithm: "sha256", Hex: "abc123"}
+	index, err := loadBlobIndex()
+	require.NoError(t, err)
+	for _, r := range []string{"a", "b", "c", "d", "e", "f", "a"} {
+		repo, err := name.NewRepository("r8.im/alice/" + r)
+		require.NoError(t, err)
+		require.NoError(t, index.add(digest, repo))
+	}
+	require.Equal(t, []string{"r8.im/alice/a", "r8.im/alice/f", "r8.im/alice/e", "r8.im/alice/d", "r8.im/alice/c"}, index.Repositories[digest.String()])
+}
+
+func TestBlobIndexInvalid(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	index, err := loadBlobIndex()
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(index.path), 0o700))
+	require.NoError(t, os.WriteFile(index.path, []byte("not json"), 0o600))
+
+	index, err = loadBlobIndex()
+	require.Error(t, err)
+	require.NotNil(t, index)
+	require.Empty(t, index.Repositories)
+}
@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"golang.org/x/sync/errgroup"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
+)
+
+// listJobs is how many images are inspected at once when listing models
+const listJobs = 8
+
+// Model is a version of a model in a registry, which is an image with Cog's labels
+type Model struct {
+	// Repository is the model's repository, like "r8.im/alice/hotdog"
+	Repository string
+	Tag        string
+	Digest     string
+	// Size is the size of the image's layers and config, compressed as they are in the registry
+	Size       int64
+	Created    time.Time
+	CogVersion string
+	// Schema is the model's OpenAPI schema, or nil if it doesn't have one
+	Schema *openapi3.T
+}
+
+// ListModels lists the models in a registry, like "localhost:5000", or in a namespace of it, like
+// "localhost:5000/alice". Images that weren't built by Cog are skipped. They're sorted by repository, newest first.
+func ListModels(ctx context.Context, target string) ([]Model, error) {
+	host, namespace, _ := strings.Cut(strings.TrimSuffix(target, "/"), "/")
+	reg, err := name.NewRegistry(host)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid registry %s: %w", host, err)
+	}
+	opts := []remote.Option{remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithContext(ctx)}
+
+	repos, err := listRepositories(ctx, reg, namespace, opts)
+	if IsAuthError(err) {
+		return nil, &cogerrors.RegistryAuthError{Registry: reg.RegistryStr(), Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tags, err := listTags(ctx, repos, opts)
+	if IsAuthError(err) {
+		return nil, &cogerrors.RegistryAuthError{Registry: reg.RegistryStr(), Err: err}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	models := []Model{}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(listJobs)
+	opts = append(opts, remote.WithContext(gctx))
+	for _, tag := range tags {
+		g.Go(func() error {
+			model, ok, err := inspectModel(tag, opts)
+			if err != nil || !ok {
+				return err
+			}
+			mu.Lock()
+			models = append(models, model)
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(models, func(i, j int) bool {
+		if models[i].Repository != models[j].Repository {
+			return models[i].Repository < models[j].Repository
+		}
+		if !models[i].Created.Equal(models[j].Created) {
+			return models[i].Created.After(models[j].Created)
+		}
+		return models[i].Tag < models[j].Tag
+	})
+	return models, nil
+}
+
+// listRepositories lists the repositories in a namespace of a registry, or all of them if namespace is "". If the
+// registry doesn't let its repositories be listed, namespace is treated as a repository.
+func listRepositories(ctx context.Context, reg name.Registry, namespace string, opts []remote.Option) ([]name.Repository, error) {
+	names, err := remote.Catalog(ctx, reg, opts...)
+	if err != nil {
+		if namespace == "" || IsAuthError(err) {
+			return nil, fmt.Errorf("Failed to list repositories in %s. The registry might not support listing them, so try listing a model like '%s/your-username/your-model': %w", reg.RegistryStr(), reg.RegistryStr(), err)
+		}
+		names = []string{namespace}
+	}
+	repos := []name.Repository{}
+	for _, n := range names {
+		if namespace != "" && n != namespace && !strings.HasPrefix(n, namespace+"/") {
+			continue
+		}
+		repo, err := name.NewRepository(reg.RegistryStr()+"/"+n, name.WeakValidation)
+		if err != nil {
+			return nil, fmt.Errorf("Registry returned an invalid repository %s: %w", n, err)
+		}
+		repos = append(repos, repo)
+	}
+	return repos, nil
+}
+
+// listTags lists the tags of repositories
+func listTags(ctx context.Context, repos []name.Repository, opts []remote.Option) ([]name.Tag, error) {
+	var mu sync.Mutex
+	tags := []name.Tag{}
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(listJobs)
+	opts = append(opts, remote.WithContext(gctx))
+	for _, repo := range repos {
+		g.Go(func() error {
+			names, err := remote.List(repo, opts...)
+			if err != nil {
+				return fmt.Errorf("Failed to list tags of %s: %w", repo, err)
+			}
+			mu.Lock()
+			for _, n := range names {
+				tags = append(tags, repo.Tag(n))
+			}
+			mu.Unlock()
+			return nil
+		})
+	}
+	return tags, g.Wait()
+}
+
+// inspectModel reads a model's metadata from its image, and returns false if the image wasn't built by Cog
+func inspectModel(ref name.Tag, opts []remote.Option) (Model, bool, error) {
+	img, err := remote.Image(ref, opts...)
+	if err != nil {
+		return Model{}, false, fmt.Errorf("Failed to get %s: %w", ref, err)
+	}
+	config, err := img.ConfigFile()
+	if err != nil {
+		return Model{}, false, fmt.Errorf("Failed to get config of %s: %w", ref, err)
+	}
+	labels := config.Config.Labels
+	cogVersion, ok := labels[global.LabelNamespace+"version"]
+	if !ok {
+		return Model{}, false, nil
+	}
+	manifest, err := img.Manifest()
+	if err != nil {
+		return Model{}, false, fmt.Errorf("Failed to get manifest of %s: %w", ref, err)
+	}
+	digest, err := img.Digest()
+	if err != nil {
+		return Model{}, false, fmt.Errorf("Failed to get digest of %s: %w", ref, err)
+	}
+
+	model := Model{
+		Repository: ref.Context().Name(),
+		Tag:        ref.TagStr(),
+		Digest:     digest.String(),
+		Size:       manifest.Config.Size,
+		Created:    config.Created.Time,
+		CogVersion: cogVersion,
+	}
+	for _, layer := range manifest.Layers {
+		model.Size += layer.Size
+	}
+	if schemaJSON := labels[global.LabelNamespace+"openapi_schema"]; schemaJSON != "" {
+		// An image with a schema that can't be parsed is still listed, just without its schema
+		if schema, err := openapi3.NewLoader().LoadFromData([]byte(schemaJSON)); err == nil {
+			model.Schema = schema
+		}
+	}
+	return model, true, nil
+}
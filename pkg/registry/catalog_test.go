@@ -0,0 +1,77 @@
+package registry
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+)
+
+const catalogTestSchema = `{"openapi": "3.0.2", "info": {"title": "Cog", "version": "0.1.0"}, "paths": {}, "components": {"schemas": {"Output": {"type": "string"}}}}`
+
+func pushTestImage(t *testing.T, imageName string, created time.Time, labels map[string]string) v1.Image {
+	t.Helper()
+	img, err := random.Image(100, 1)
+	require.NoError(t, err)
+	config, err := img.ConfigFile()
+	require.NoError(t, err)
+	config = config.DeepCopy()
+	config.Created = v1.Time{Time: created}
+	config.Config.Labels = labels
+	img, err = mutate.ConfigFile(img, config)
+	require.NoError(t, err)
+	ref, err := name.ParseReference(imageName)
+	require.NoError(t, err)
+	require.NoError(t, remote.Write(ref, img))
+	return img
+}
+
+func TestListModels(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server := httptest.NewServer(ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))))
+	t.Cleanup(server.Close)
+	host := strings.Replace(strings.TrimPrefix(server.URL, "http://"), "127.0.0.1", "localhost", 1)
+
+	built := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	v1Image := pushTestImage(t, host+"/alice/hotdog:v1", built, map[string]string{"run.cog.version": "0.9.0", "run.cog.openapi_schema": catalogTestSchema})
+	pushTestImage(t, host+"/alice/hotdog:v2", built.Add(time.Hour), map[string]string{"run.cog.version": "0.9.1"})
+	pushTestImage(t, host+"/alice/not-a-model:latest", built, nil)
+	pushTestImage(t, host+"/bob/hotdog:latest", built, map[string]string{"run.cog.version": "0.9.0"})
+
+	models, err := ListModels(context.Background(), host+"/alice")
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+
+	require.Equal(t, host+"/alice/hotdog", models[0].Repository)
+	require.Equal(t, "v2", models[0].Tag)
+	require.Equal(t, "0.9.1", models[0].CogVersion)
+	require.Nil(t, models[0].Schema)
+
+	require.Equal(t, "v1", models[1].Tag)
+	require.True(t, built.Equal(models[1].Created))
+	require.NotNil(t, models[1].Schema)
+	digest, err := v1Image.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest.String(), models[1].Digest)
+	require.Equal(t, layersSize(t, v1Image)+configSize(t, v1Image), models[1].Size)
+
+	models, err = ListModels(context.Background(), host)
+	require.NoError(t, err)
+	require.Len(t, models, 3)
+
+	// A model can be listed on its own
+	models, err = ListModels(context.Background(), host+"/bob/hotdog")
+	require.NoError(t, err)
+	require.Len(t, models, 1)
+}
@@ -0,0 +1,180 @@
+// Package registry pushes images to registries, in chunks that are retried and resumed if the connection fails, and
+// lists the models in them.
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"golang.org/x/sync/errgroup"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/retry"
+)
+
+const (
+	// DefaultChunkSize is how much of a layer is uploaded in each request, if PushOptions.ChunkSize isn't set
+	DefaultChunkSize = 64 << 20
+	// DefaultJobs is how many layers are uploaded at once, if PushOptions.Jobs isn't set. It's the same as Docker.
+	DefaultJobs = 5
+)
+
+// PushOptions are how to push an image
+type PushOptions struct {
+	// Resume carries on uploading layers from where an earlier push that was interrupted got to, rather than
+	// starting them again
+	Resume bool
+	// ChunkSize is how much of a layer to upload in each request, so a dropped connection only loses one chunk. It
+	// defaults to DefaultChunkSize.
+	ChunkSize int64
+	// Backoff is how many times to try requests that fail with a network error or a server error. It defaults to
+	// retry.DefaultBackoff.
+	Backoff retry.Backoff
+	// Jobs is how many layers to upload at once. It defaults to DefaultJobs.
+	Jobs int
+	// BandwidthLimit is the most bytes per second to upload, across all layers, or 0 for no limit
+	BandwidthLimit int64
+}
+
+// Push pushes an image from Docker to its registry. Layers that are already in the registry aren't uploaded again.
+// Each layer is read from Docker as it's uploaded, rather than exporting the whole image first.
+func Push(ctx context.Context, imageName string, opts PushOptions) error {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+
+	img, err := daemonImage(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	stats, err := pushImage(ctx, ref, img, opts)
+	if IsAuthError(err) {
+		return &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: err}
+	}
+	if err != nil {
+		return err
+	}
+	if stats.skipped > 0 {
+		console.Infof("Uploaded %s of layers, and skipped %s that were already in the registry", formatBytes(stats.uploaded), formatBytes(stats.skipped))
+	} else {
+		console.Infof("Uploaded %s of layers", formatBytes(stats.uploaded))
+	}
+	return nil
+}
+
+// daemonImage returns an image in Docker. Its layers are streamed from Docker each time they're read, so the image
+// doesn't have to fit in memory or on disk. Layers Docker has compressed already, like with its containerd image store,
+// keep their digests, so they match the layers of the base image in the registry.
+func daemonImage(ctx context.Context, ref name.Reference) (v1.Image, error) {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to connect to Docker: %w", err)
+	}
+	img, err := daemon.Image(ref, daemon.WithClient(cli), daemon.WithContext(ctx), daemon.WithUnbufferedOpener())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s from Docker: %w", ref, err)
+	}
+	return img, nil
+}
+
+// pushStats is how many bytes of layers a push uploaded, and how many it skipped because they were already in the
+// registry
+type pushStats struct {
+	uploaded int64
+	skipped  int64
+}
+
+func pushImage(ctx context.Context, ref name.Reference, img v1.Image, opts PushOptions) (pushStats, error) {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultChunkSize
+	}
+	if opts.Backoff.Attempts == 0 {
+		opts.Backoff = retry.DefaultBackoff
+	}
+	if opts.Jobs <= 0 {
+		opts.Jobs = DefaultJobs
+	}
+
+	repo := ref.Context()
+	auth, err := authn.DefaultKeychain.Resolve(repo)
+	if err != nil {
+		return pushStats{}, fmt.Errorf("Failed to get credentials for %s: %w", repo.RegistryStr(), err)
+	}
+	var tr http.RoundTripper
+	err = retry.Do(ctx, opts.Backoff, func() error {
+		tr, err = transport.NewWithContext(ctx, repo.Registry, auth, http.DefaultTransport, []string{repo.Scope(transport.PushScope)})
+		return classifyError(ctx, err)
+	})
+	if err != nil {
+		return pushStats{}, fmt.Errorf("Failed to connect to %s: %w", repo.RegistryStr(), err)
+	}
+
+	state, err := loadUploadState(repo, opts.Resume)
+	if err != nil {
+		return pushStats{}, err
+	}
+	index, err := loadBlobIndex()
+	if index == nil {
+		return pushStats{}, err
+	}
+	if err != nil {
+		console.Warnf("%s", err)
+	}
+	if opts.Resume && len(state.Uploads) > 0 {
+		console.Infof("Resuming %d interrupted layer uploads...", len(state.Uploads))
+	}
+	u := &uploader{
+		client:    &http.Client{Transport: tr},
+		repo:      repo,
+		chunkSize: opts.ChunkSize,
+		backoff:   opts.Backoff,
+		state:     state,
+		limiter:   newLimiter(opts.BandwidthLimit),
+		index:     index,
+	}
+
+	layers, err := img.Layers()
+	if err != nil {
+		return pushStats{}, fmt.Errorf("Failed to read image layers: %w", err)
+	}
+	// If a layer fails, the others are canceled
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(opts.Jobs)
+	for _, layer := range layers {
+		g.Go(func() error {
+			return u.upload(gctx, layer)
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return pushStats{}, err
+	}
+	stats := pushStats{uploaded: u.uploaded.Load(), skipped: u.skipped.Load()}
+
+	// The layers are in the registry now, so this only uploads the image's config and manifest
+	err = retry.Do(ctx, opts.Backoff, func() error {
+		return classifyError(ctx, remote.Write(ref, img, remote.WithTransport(tr), remote.WithContext(ctx)))
+	})
+	if err != nil {
+		return pushStats{}, fmt.Errorf("Failed to push image manifest: %w", err)
+	}
+	return stats, nil
+}
+
+// IsAuthError returns whether err is a registry refusing access, because the credentials are wrong or don't have
+// access to the repository
+func IsAuthError(err error) bool {
+	var terr *transport.Error
+	return errors.As(err, &terr) && (terr.StatusCode == http.StatusUnauthorized || terr.StatusCode == http.StatusForbidden)
+}
@@ -0,0 +1,292 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/stretchr/testify/require"
+
+	"github.com/replicate/cog/pkg/util/retry"
+)
+
+// testRegistry is an in-memory registry that reports the status of uploads, and fails chunks when it's told to
+type testRegistry struct {
+	handler http.Handler
+	mu      sync.Mutex
+	// received is how many bytes of each upload have been received, by upload path
+	received map[string]int64
+	// patchedBytes is how many bytes have been uploaded in chunks
+	patchedBytes int64
+	// failPatch returns whether to fail a chunk, given how many chunks there have been
+	failPatch func(n int) bool
+	patches   int
+	// patchDelay is how long each chunk takes
+	patchDelay time.Duration
+	// inFlight and maxInFlight are how many chunks are being uploaded at once, and the most there have been
+	inFlight    int
+	maxInFlight int
+	// isolated is a repository that only has the blobs that have been mounted into it, rather than all of them
+	isolated string
+	mounted  map[string]bool
+}
+
+func newTestRegistry(t *testing.T) (*testRegistry, string) {
+	t.Helper()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	r := &testRegistry{handler: ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0))), received: map[string]int64{}, mounted: map[string]bool{}, failPatch: func(int) bool { return false }}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	return r, u.Host
+}
+
+func (r *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.isolated != "" && strings.HasPrefix(req.URL.Path, "/v2/"+r.isolated+"/blobs/") {
+		if digest := req.URL.Query().Get("mount"); req.Method == http.MethodPost && digest != "" {
+			r.mu.Lock()
+			r.mounted[digest] = true
+			r.mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		digest := strings.TrimPrefix(req.URL.Path, "/v2/"+r.isolated+"/blobs/")
+		r.mu.Lock()
+		mounted := r.mounted[digest]
+		r.mu.Unlock()
+		if req.Method == http.MethodHead && strings.HasPrefix(digest, "sha256:") && !mounted {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	isUpload := strings.Contains(req.URL.Path, "/blobs/uploads/") && !strings.HasSuffix(req.URL.Path, "/blobs/uploads/")
+	if isUpload && req.Method == http.MethodGet {
+		r.mu.Lock()
+		received, ok := r.received[req.URL.Path]
+		r.mu.Unlock()
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Location", req.URL.Path)
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(received-1, 0)))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if isUpload && req.Method == http.MethodPatch {
+		r.mu.Lock()
+		r.patches++
+		fail := r.failPatch(r.patches)
+		if !fail {
+			r.patchedBytes += req.ContentLength
+			r.received[req.URL.Path] += req.ContentLength
+		}
+		r.inFlight++
+		r.maxInFlight = max(r.maxInFlight, r.inFlight)
+		r.mu.Unlock()
+		time.Sleep(r.patchDelay)
+		r.mu.Lock()
+		r.inFlight--
+		r.mu.Unlock()
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+	}
+	r.handler.ServeHTTP(w, req)
+}
+
+func testOptions() PushOptions {
+	return PushOptions{ChunkSize: 1000, Backoff: retry.Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond}}
+}
+
+func requirePushed(t *testing.T, ref name.Reference, img v1.Image) {
+	t.Helper()
+	pushed, err := remote.Image(ref)
+	require.NoError(t, err)
+	pushedDigest, err := pushed.Digest()
+	require.NoError(t, err)
+	digest, err := img.Digest()
+	require.NoError(t, err)
+	require.Equal(t, digest, pushedDigest)
+}
+
+// configSize is the size of an image's config, which is uploaded along with its layers
+func configSize(t *testing.T, img v1.Image) int64 {
+	t.Helper()
+	config, err := img.RawConfigFile()
+	require.NoError(t, err)
+	return int64(len(config))
+}
+
+// layersSize is the total size of an image's layers
+func layersSize(t *testing.T, img v1.Image) int64 {
+	t.Helper()
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	total := int64(0)
+	for _, layer := range layers {
+		size, err := layer.Size()
+		require.NoError(t, err)
+		total += size
+	}
+	return total
+}
+
+func TestPushInChunks(t *testing.T) {
+	reg, host := newTestRegistry(t)
+	ref, err := name.ParseReference(host+"/alice/hotdog:latest", name.Insecure)
+	require.NoError(t, err)
+	img, err := random.Image(4500, 2)
+	require.NoError(t, err)
+
+	// The second chunk fails once, and is retried
+	reg.failPatch = func(n int) bool { return n == 2 }
+	stats, err := pushImage(context.Background(), ref, img, testOptions())
+	require.NoError(t, err)
+	require.Equal(t, pushStats{uploaded: layersSize(t, img), skipped: 0}, stats)
+	requirePushed(t, ref, img)
+
+	// Pushing again, like a new version with the same weights, doesn't upload the layers again
+	patched := reg.patchedBytes
+	stats, err = pushImage(context.Background(), ref, img, testOptions())
+	require.NoError(t, err)
+	require.Equal(t, patched, reg.patchedBytes)
+	require.Equal(t, pushStats{uploaded: 0, skipped: layersSize(t, img)}, stats)
+}
+
+func TestPushLayersInParallel(t *testing.T) {
+	reg, host := newTestRegistry(t)
+	ref, err := name.ParseReference(host+"/alice/hotdog:latest", name.Insecure)
+	require.NoError(t, err)
+	img, err := random.Image(4500, 4)
+	require.NoError(t, err)
+
+	reg.patchDelay = 10 * time.Millisecond
+	opts := testOptions()
+	opts.Jobs = 2
+	_, err = pushImage(context.Background(), ref, img, opts)
+	require.NoError(t, err)
+	requirePushed(t, ref, img)
+	require.Equal(t, 2, reg.maxInFlight)
+}
+
+func TestPushMountsLayersFromOtherRepositories(t *testing.T) {
+	reg, host := newTestRegistry(t)
+	img, err := random.Image(4500, 2)
+	require.NoError(t, err)
+
+	ref, err := name.ParseReference(host+"/alice/hotdog:latest", name.Insecure)
+	require.NoError(t, err)
+	_, err = pushImage(context.Background(), ref, img, testOptions())
+	require.NoError(t, err)
+
+	// A new model with the same layers mounts them from the first one
+	reg.isolated = "alice/hotdog-v2"
+	patched := reg.patchedBytes
+	ref, err = name.ParseReference(host+"/alice/hotdog-v2:latest", name.Insecure)
+	require.NoError(t, err)
+	stats, err := pushImage(context.Background(), ref, img, testOptions())
+	require.NoError(t, err)
+	require.Equal(t, pushStats{uploaded: 0, skipped: layersSize(t, img)}, stats)
+	require.Len(t, reg.mounted, 2)
+	require.Equal(t, patched+configSize(t, img), reg.patchedBytes)
+}
+
+func TestPushResume(t *testing.T) {
+	reg, host := newTestRegistry(t)
+	ref, err := name.ParseReference(host+"/alice/hotdog:latest", name.Insecure)
+	require.NoError(t, err)
+	img, err := random.Image(4500, 1)
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	size, err := layers[0].Size()
+	require.NoError(t, err)
+
+	// The connection drops for good after two chunks
+	reg.failPatch = func(n int) bool { return n > 2 }
+	_, err = pushImage(context.Background(), ref, img, testOptions())
+	require.Error(t, err)
+	require.Equal(t, int64(2000), reg.patchedBytes)
+
+	state, err := loadUploadState(ref.Context(), true)
+	require.NoError(t, err)
+	require.Len(t, state.Uploads, 1)
+
+	// Resuming only uploads the rest of the layer
+	reg.failPatch = func(int) bool { return false }
+	opts := testOptions()
+	opts.Resume = true
+	_, err = pushImage(context.Background(), ref, img, opts)
+	require.NoError(t, err)
+	require.Equal(t, size+configSize(t, img), reg.patchedBytes)
+	requirePushed(t, ref, img)
+
+	_, err = os.Stat(state.path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestPushWithoutResumeStartsAgain(t *testing.T) {
+	reg, host := newTestRegistry(t)
+	ref, err := name.ParseReference(host+"/alice/hotdog:latest", name.Insecure)
+	require.NoError(t, err)
+	img, err := random.Image(4500, 1)
+	require.NoError(t, err)
+	layers, err := img.Layers()
+	require.NoError(t, err)
+	size, err := layers[0].Size()
+	require.NoError(t, err)
+
+	reg.failPatch = func(n int) bool { return n > 2 }
+	_, err = pushImage(context.Background(), ref, img, testOptions())
+	require.Error(t, err)
+
+	reg.failPatch = func(int) bool { return false }
+	_, err = pushImage(context.Background(), ref, img, testOptions())
+	require.NoError(t, err)
+	require.Equal(t, 2000+size+configSize(t, img), reg.patchedBytes)
+	requirePushed(t, ref, img)
+}
+
+func TestParseRange(t *testing.T) {
+	for header, expected := range map[string]int64{"": 0, "0-0": 0, "0-999": 1000, "0-1": 2} {
+		offset, err := parseRange(header)
+		require.NoError(t, err)
+		require.Equal(t, expected, offset, header)
+	}
+	_, err := parseRange("bytes")
+	require.Error(t, err)
+}
+
+func TestFormatBytes(t *testing.T) {
+	require.Equal(t, "999 B", formatBytes(999))
+	require.Equal(t, "1.5 kB", formatBytes(1500))
+	require.Equal(t, "15.0 GB", formatBytes(15_000_000_000))
+}
+
+func TestUploadStatePath(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	repo, err := name.NewRepository("r8.im/alice/hotdog")
+	require.NoError(t, err)
+	state, err := loadUploadState(repo, false)
+	require.NoError(t, err)
+	require.Equal(t, "r8.im_alice_hotdog.json", filepath.Base(state.path))
+}
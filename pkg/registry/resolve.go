@@ -0,0 +1,29 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+// ResolveDigest returns the digest an image's tag points to in its registry, like "sha256:...". For images with
+// several platforms, it's the digest of the index, so it pins every platform.
+func ResolveDigest(ctx context.Context, imageName string) (string, error) {
+	ref, err := name.ParseReference(imageName)
+	if err != nil {
+		return "", fmt.Errorf("Invalid image name %s: %w", imageName, err)
+	}
+	desc, err := remote.Head(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain), remote.WithContext(ctx))
+	if IsAuthError(err) {
+		return "", &cogerrors.RegistryAuthError{Registry: ref.Context().RegistryStr(), Err: err}
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to get digest of %s: %w", imageName, err)
+	}
+	return desc.Digest.String(), nil
+}
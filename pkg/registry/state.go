@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// uploadState is the layer uploads in progress to a repository. It's saved as uploads progress, so a push that's
+// interrupted can be resumed by the next one.
+type uploadState struct {
+	path string
+	mu   sync.Mutex
+	// Uploads are the locations of uploads in progress, by layer digest
+	Uploads map[string]string `json:"uploads"`
+}
+
+// loadUploadState loads the uploads in progress to a repository if resume is true, or otherwise starts afresh
+func loadUploadState(repo name.Repository, resume bool) (*uploadState, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return nil, err
+	}
+	filename := strings.NewReplacer("/", "_", ":", "_").Replace(repo.Name()) + ".json"
+	s := &uploadState{
+		path:    filepath.Join(cacheDir, "cog", "uploads", filename),
+		Uploads: map[string]string{},
+	}
+	if !resume {
+		return s, nil
+	}
+	contents, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read upload state: %w", err)
+	}
+	if err := json.Unmarshal(contents, s); err != nil {
+		return nil, fmt.Errorf("Failed to parse upload state in %s: %w", s.path, err)
+	}
+	if s.Uploads == nil {
+		s.Uploads = map[string]string{}
+	}
+	return s, nil
+}
+
+func (s *uploadState) get(digest v1.Hash) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Uploads[digest.String()]
+}
+
+func (s *uploadState) set(digest v1.Hash, location string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Uploads[digest.String()] = location
+	return s.save()
+}
+
+func (s *uploadState) remove(digest v1.Hash) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.Uploads, digest.String())
+	return s.save()
+}
+
+func (s *uploadState) save() error {
+	if len(s.Uploads) == 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove upload state: %w", err)
+		}
+		return nil
+	}
+	contents, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("Failed to save upload state: %w", err)
+	}
+	if err := os.WriteFile(s.path, contents, 0o600); err != nil {
+		return fmt.Errorf("Failed to save upload state: %w", err)
+	}
+	return nil
+}
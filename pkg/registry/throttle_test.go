@@ -0,0 +1,35 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter(t *testing.T) {
+	l := newLimiter(1_000_000)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, l.reader(context.Background(), bytes.NewReader(make([]byte, 200_000))))
+	require.NoError(t, err)
+	require.Equal(t, int64(200_000), n)
+	// The last read doesn't wait, so it's at least 168 kB at 1 MB/s
+	require.GreaterOrEqual(t, time.Since(start), 160*time.Millisecond)
+}
+
+func TestLimiterCanceled(t *testing.T) {
+	l := newLimiter(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := io.Copy(io.Discard, l.reader(ctx, bytes.NewReader(make([]byte, 100_000))))
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestNoLimit(t *testing.T) {
+	r := bytes.NewReader(nil)
+	require.Nil(t, newLimiter(0))
+	require.Equal(t, io.Reader(r), newLimiter(0).reader(context.Background(), r))
+}
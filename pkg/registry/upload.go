@@ -0,0 +1,357 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/retry"
+)
+
+// uploader uploads layers to a repository in chunks, with the OCI distribution API's chunked uploads. If a chunk
+// fails, the registry is asked how much of the layer it has, and the upload carries on from there.
+type uploader struct {
+	client    *http.Client
+	repo      name.Repository
+	chunkSize int64
+	backoff   retry.Backoff
+	state     *uploadState
+	// limiter limits the upload bandwidth, or is nil if it's unlimited
+	limiter *limiter
+	// index is the repositories layers have been pushed to before, to mount them from
+	index *blobIndex
+
+	// uploaded is how many bytes of layers have been uploaded, and skipped is how many weren't because they were
+	// already in the registry
+	uploaded atomic.Int64
+	skipped  atomic.Int64
+}
+
+// upload uploads a layer, unless it's already in the registry
+func (u *uploader) upload(ctx context.Context, layer v1.Layer) error {
+	digest, err := layer.Digest()
+	if err != nil {
+		return fmt.Errorf("Failed to get layer digest: %w", err)
+	}
+	size, err := layer.Size()
+	if err != nil {
+		return fmt.Errorf("Failed to get layer size: %w", err)
+	}
+
+	var exists bool
+	err = retry.Do(ctx, u.backoff, func() (err error) {
+		exists, err = u.exists(ctx, digest)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to check if layer %s exists: %w", digest, err)
+	}
+	if exists {
+		console.Infof("%s: Layer already exists", shortDigest(digest))
+		u.skipped.Add(size)
+		u.remember(digest)
+		return nil
+	}
+
+	if from := u.index.source(digest, u.repo); from != "" && u.state.get(digest) == "" {
+		var mounted bool
+		err := retry.Do(ctx, u.backoff, func() (err error) {
+			mounted, err = u.mount(ctx, digest, from)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("Failed to mount layer %s from %s: %w", digest, from, err)
+		}
+		if mounted {
+			console.Infof("%s: Mounted from %s", shortDigest(digest), from)
+			u.skipped.Add(size)
+			u.remember(digest)
+			return nil
+		}
+	}
+
+	console.Infof("%s: Pushing %s...", shortDigest(digest), formatBytes(size))
+	err = retry.Do(ctx, u.backoff, func() error {
+		return u.tryUpload(ctx, layer, digest, size)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to push layer %s: %w", digest, err)
+	}
+	console.Infof("%s: Pushed", shortDigest(digest))
+	u.remember(digest)
+	return nil
+}
+
+// remember records that a layer is in the repository, so it can be mounted from it when it's pushed to another one
+func (u *uploader) remember(digest v1.Hash) {
+	if err := u.index.add(digest, u.repo); err != nil {
+		console.Warnf("%s", err)
+	}
+}
+
+// tryUpload uploads a layer, carrying on from an upload that's in progress if there is one
+func (u *uploader) tryUpload(ctx context.Context, layer v1.Layer, digest v1.Hash, size int64) error {
+	location, offset := u.state.get(digest), int64(0)
+	if location != "" {
+		var err error
+		if location, offset, err = u.status(ctx, location); err != nil {
+			return err
+		}
+		if offset > 0 {
+			console.Infof("%s: Resuming from %s of %s", shortDigest(digest), formatBytes(offset), formatBytes(size))
+		}
+	}
+	if location == "" {
+		var err error
+		if location, err = u.start(ctx); err != nil {
+			return err
+		}
+		if err := u.state.set(digest, location); err != nil {
+			return err
+		}
+	}
+
+	rc, err := layer.Compressed()
+	if err != nil {
+		return fmt.Errorf("Failed to read layer: %w", err)
+	}
+	defer rc.Close()
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		return fmt.Errorf("Failed to read layer: %w", err)
+	}
+
+	chunk := make([]byte, min(u.chunkSize, size-offset))
+	for offset < size {
+		n, err := io.ReadFull(rc, chunk[:min(int64(len(chunk)), size-offset)])
+		if err != nil {
+			return fmt.Errorf("Failed to read layer: %w", err)
+		}
+		if location, err = u.patch(ctx, location, chunk[:n], offset); err != nil {
+			return err
+		}
+		u.uploaded.Add(int64(n))
+		if err := u.state.set(digest, location); err != nil {
+			return err
+		}
+		if (offset+int64(n))*10/size > offset*10/size && offset+int64(n) < size {
+			console.Infof("%s: Pushed %s of %s", shortDigest(digest), formatBytes(offset+int64(n)), formatBytes(size))
+		}
+		offset += int64(n)
+	}
+
+	if err := u.finish(ctx, location, digest); err != nil {
+		return err
+	}
+	return u.state.remove(digest)
+}
+
+func (u *uploader) exists(ctx context.Context, digest v1.Hash) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, u.url("blobs/"+digest.String()), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := u.do(ctx, req, http.StatusOK, http.StatusNotFound)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK, nil
+}
+
+// start starts an upload, and returns its location
+func (u *uploader) start(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url("blobs/uploads/"), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := u.do(ctx, req, http.StatusAccepted)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return location(resp)
+}
+
+// mount mounts a layer from another repository on the same registry, and returns whether it was mounted. If the
+// registry can't mount it, it starts an upload instead, which is saved to carry on with.
+func (u *uploader) mount(ctx context.Context, digest v1.Hash, from string) (bool, error) {
+	query := url.Values{"mount": {digest.String()}, "from": {from}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url("blobs/uploads/?"+query.Encode()), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := u.do(ctx, req, http.StatusCreated, http.StatusAccepted)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated {
+		return true, nil
+	}
+	loc, err := location(resp)
+	if err != nil {
+		return false, err
+	}
+	return false, u.state.set(digest, loc)
+}
+
+// status returns an upload's location and how much of the layer the registry has. The location is "" if the
+// registry doesn't know about the upload, because it expired or was never started.
+func (u *uploader) status(ctx context.Context, loc string) (string, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, loc, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := u.do(ctx, req, http.StatusNoContent, http.StatusNotFound)
+	if err != nil {
+		return "", 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return "", 0, nil
+	}
+	offset, err := parseRange(resp.Header.Get("Range"))
+	if err != nil {
+		return "", 0, err
+	}
+	if resp.Header.Get("Location") == "" {
+		return loc, offset, nil
+	}
+	newLoc, err := location(resp)
+	return newLoc, offset, err
+}
+
+// patch uploads a chunk of a layer that starts at offset, and returns the upload's new location
+func (u *uploader) patch(ctx context.Context, loc string, chunk []byte, offset int64) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPatch, loc, u.limiter.reader(ctx, bytes.NewReader(chunk)))
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = int64(len(chunk))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Range", fmt.Sprintf("%d-%d", offset, offset+int64(len(chunk))-1))
+	resp, err := u.do(ctx, req, http.StatusAccepted, http.StatusNoContent)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return location(resp)
+}
+
+// finish completes an upload, once the registry has all of the layer
+func (u *uploader) finish(ctx context.Context, loc string, digest v1.Hash) error {
+	finishURL, err := url.Parse(loc)
+	if err != nil {
+		return err
+	}
+	query := finishURL.Query()
+	query.Set("digest", digest.String())
+	finishURL.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, finishURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := u.do(ctx, req, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (u *uploader) do(ctx context.Context, req *http.Request, expected ...int) (*http.Response, error) {
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, classifyError(ctx, err)
+	}
+	if err := transport.CheckError(resp, expected...); err != nil {
+		resp.Body.Close()
+		return nil, classifyError(ctx, err)
+	}
+	return resp, nil
+}
+
+func (u *uploader) url(path string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/%s", u.repo.Registry.Scheme(), u.repo.RegistryStr(), u.repo.RepositoryStr(), path)
+}
+
+// classifyError marks errors that are worth retrying, like dropped connections and server errors
+func classifyError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var terr *transport.Error
+	if errors.As(err, &terr) {
+		if terr.Temporary() || terr.StatusCode >= http.StatusInternalServerError || terr.StatusCode == http.StatusTooManyRequests || terr.StatusCode == http.StatusRequestTimeout {
+			return retry.Retryable(err)
+		}
+		return err
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || errors.Is(err, syscall.ECONNRESET) {
+		return retry.Retryable(err)
+	}
+	return err
+}
+
+// location returns the absolute URL of the upload in a response's Location header
+func location(resp *http.Response) (string, error) {
+	loc, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("Registry didn't return the location of the upload: %w", err)
+	}
+	return loc.String(), nil
+}
+
+// parseRange returns how many bytes the registry has from the Range header of an upload, like "0-1023"
+func parseRange(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	var start, end int64
+	if _, err := fmt.Sscanf(header, "%d-%d", &start, &end); err != nil {
+		return 0, fmt.Errorf("Registry returned an invalid Range for the upload: %s", header)
+	}
+	if end <= 0 {
+		// "0-0" is an empty upload
+		return 0, nil
+	}
+	return end + 1, nil
+}
+
+func shortDigest(digest v1.Hash) string {
+	if len(digest.Hex) < 12 {
+		return digest.Hex
+	}
+	return digest.Hex[:12]
+}
+
+// formatBytes formats a size in bytes for people to read, like "1.5 GB"
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var nonIdentifierPattern = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// protoField is a field of a Protocol Buffers message
+type protoField struct {
+	name    string
+	comment string
+	// protoType is the field's type, with "repeated" or "optional" if it has them
+	protoType string
+}
+
+// Proto returns a proto3 file with a message for each of a model's inputs and output, and its training inputs and
+// output if it can be trained. Fields are numbered in the order they're defined in the predictor. Files are strings,
+// which are URLs, choices are strings, and values that can't be typed, like dictionaries, are google.protobuf types.
+func Proto(doc *openapi3.T, name string) ([]byte, error) {
+	if doc == nil || doc.Components == nil || doc.Components.Schemas["Input"] == nil {
+		return nil, fmt.Errorf("The model's schema hasn't got its inputs. Build it with a newer version of Cog")
+	}
+
+	messages := []string{}
+	usesStruct := false
+	for _, c := range interfaceComponents {
+		ref := doc.Components.Schemas[c.name]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+		fields := []protoField{}
+		if c.name == "Input" || c.name == "TrainingInput" || IsObject(ref.Value) {
+			for _, p := range SortedProperties(ref.Value) {
+				fields = append(fields, protoFieldFor(p.Name, p.Schema, !p.Required))
+			}
+		} else {
+			// Outputs that aren't objects are the message's one field
+			fields = append(fields, protoFieldFor("output", ref.Value, false))
+		}
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "// %s is the model's %s\n", c.name, strings.ReplaceAll(c.property, "_", " "))
+		fmt.Fprintf(&b, "message %s {\n", c.name)
+		for i, f := range fields {
+			if f.comment != "" {
+				fmt.Fprintf(&b, "  // %s\n", f.comment)
+			}
+			fmt.Fprintf(&b, "  %s %s = %d;\n", f.protoType, f.name, i+1)
+			usesStruct = usesStruct || strings.Contains(f.protoType, "google.protobuf.")
+		}
+		b.WriteString("}\n")
+		messages = append(messages, b.String())
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Generated by cog schema from the schema of %s\n", name)
+	b.WriteString("syntax = \"proto3\";\n\n")
+	fmt.Fprintf(&b, "package %s;\n", ProtoPackage(name))
+	if usesStruct {
+		b.WriteString("\nimport \"google/protobuf/struct.proto\";\n")
+	}
+	for _, message := range messages {
+		b.WriteString("\n" + message)
+	}
+	return []byte(b.String()), nil
+}
+
+// ProtoPackage returns the Protocol Buffers package for a model's messages, which is the name of its image's
+// repository, like "hotdog_detector" for r8.im/alice/hotdog-detector:v2
+func ProtoPackage(image string) string {
+	name := image
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	if i := strings.IndexAny(name, ":@"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Trim(nonIdentifierPattern.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "model_" + name
+	}
+	return strings.TrimSuffix(name, "_")
+}
+
+func protoFieldFor(name string, schema *openapi3.Schema, optional bool) protoField {
+	f := protoField{name: name}
+	comments := []string{}
+	if schema.Description != "" {
+		comments = append(comments, strings.TrimSuffix(strings.Join(strings.Fields(schema.Description), " "), "."))
+	}
+	schema = Resolve(schema)
+	if len(schema.Enum) > 0 {
+		choices := make([]string, len(schema.Enum))
+		for i, v := range schema.Enum {
+			choices[i] = fmt.Sprint(v)
+		}
+		comments = append(comments, "One of: "+strings.Join(choices, ", "))
+	}
+
+	if Is(schema, "array") {
+		item := "google.protobuf.Value"
+		if schema.Items != nil && schema.Items.Value != nil {
+			if t, ok := scalarType(schema.Items.Value); ok {
+				item = t
+				if IsFile(schema.Items.Value) {
+					comments = append(comments, "Files, as URLs")
+				}
+			}
+		}
+		f.protoType = "repeated " + item
+	} else if t, ok := scalarType(schema); ok {
+		f.protoType = t
+		if IsFile(schema) {
+			comments = append(comments, "A file, as a URL")
+		}
+		if optional {
+			f.protoType = "optional " + t
+		}
+	} else if Is(schema, "object") {
+		f.protoType = "google.protobuf.Struct"
+	} else {
+		f.protoType = "google.protobuf.Value"
+	}
+	f.comment = strings.Join(comments, ". ")
+	return f
+}
+
+// scalarType returns the Protocol Buffers type of a scalar
+func scalarType(schema *openapi3.Schema) (string, bool) {
+	schema = Resolve(schema)
+	switch {
+	case Is(schema, "string"):
+		return "string", true
+	case Is(schema, "integer"):
+		return "int64", true
+	case Is(schema, "number"):
+		return "double", true
+	case Is(schema, "boolean"):
+		return "bool", true
+	}
+	return "", false
+}
@@ -0,0 +1,44 @@
+package schema
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// PythonString returns a string as a Python string literal. JSON's escapes are all valid in Python.
+func PythonString(s string) string {
+	j, _ := json.Marshal(s)
+	return string(j)
+}
+
+// PythonLiteral returns a value from a model's schema, like a default or a choice, as a Python literal. It returns
+// false for values that aren't strings, booleans, numbers or lists of them.
+func PythonLiteral(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return PythonString(v), true
+	case bool:
+		if v {
+			return "True", true
+		}
+		return "False", true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case []any:
+		items := []string{}
+		for _, item := range v {
+			literal, ok := PythonLiteral(item)
+			if !ok {
+				return "", false
+			}
+			items = append(items, literal)
+		}
+		return "[" + strings.Join(items, ", ") + "]", true
+	}
+	return "", false
+}
@@ -0,0 +1,220 @@
+// Package schema exports a model's typed interface, its inputs and output, from the OpenAPI schema Cog generates when
+// it builds the model, as OpenAPI, JSON Schema or Protocol Buffers, for gateways, form builders and validation layers.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Formats are the formats a model's schema can be exported in
+var Formats = []string{"jsonschema", "openapi", "proto"}
+
+// interfaceComponents are the schemas in a model's OpenAPI schema that make up its interface, with the names of the
+// properties they are in the JSON Schema
+var interfaceComponents = []struct {
+	name     string
+	property string
+}{
+	{"Input", "input"},
+	{"Output", "output"},
+	{"TrainingInput", "training_input"},
+	{"TrainingOutput", "training_output"},
+}
+
+const (
+	openAPIRefPrefix    = "#/components/schemas/"
+	jsonSchemaRefPrefix = "#/$defs/"
+	// JSONSchemaDialect is the version of JSON Schema models' schemas are exported as
+	JSONSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+)
+
+// Export exports a model's schema in one of Formats. name is the model's name, like its image.
+func Export(doc *openapi3.T, format string, name string) ([]byte, error) {
+	switch format {
+	case "openapi":
+		return json.MarshalIndent(doc, "", "  ")
+	case "jsonschema":
+		return JSONSchema(doc, name)
+	case "proto":
+		return Proto(doc, name)
+	}
+	return nil, fmt.Errorf("The schema can't be exported as %s. Choose one of %s", format, strings.Join(Formats, ", "))
+}
+
+// JSONSchema returns a JSON Schema of a model's inputs and output. It's an object with a property for each of them,
+// input and output, and for training_input and training_output if the model can be trained, which refer to their
+// schemas in $defs. Nullable schemas are converted to a type that includes "null", which is how JSON Schema says it.
+func JSONSchema(doc *openapi3.T, name string) ([]byte, error) {
+	schemas, err := componentSchemas(doc)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := schemas["Input"]; !ok {
+		return nil, fmt.Errorf("The model's schema hasn't got its inputs. Build it with a newer version of Cog")
+	}
+
+	properties := map[string]any{}
+	defs := map[string]any{}
+	for _, c := range interfaceComponents {
+		if _, ok := schemas[c.name]; !ok {
+			continue
+		}
+		properties[c.property] = map[string]any{"$ref": jsonSchemaRefPrefix + c.name}
+		addReachable(schemas, c.name, defs)
+	}
+	for defName, def := range defs {
+		defs[defName] = toJSONSchema(def)
+	}
+	return json.MarshalIndent(map[string]any{
+		"$schema":    JSONSchemaDialect,
+		"title":      name,
+		"type":       "object",
+		"properties": properties,
+		"$defs":      defs,
+	}, "", "  ")
+}
+
+// componentSchemas returns the schemas in an OpenAPI schema's components as JSON values
+func componentSchemas(doc *openapi3.T) (map[string]any, error) {
+	if doc == nil || doc.Components == nil {
+		return map[string]any{}, nil
+	}
+	data, err := json.Marshal(doc.Components.Schemas)
+	if err != nil {
+		return nil, err
+	}
+	schemas := map[string]any{}
+	if err := json.Unmarshal(data, &schemas); err != nil {
+		return nil, err
+	}
+	return schemas, nil
+}
+
+// addReachable adds a component's schema to defs, and the schemas it refers to
+func addReachable(schemas map[string]any, name string, defs map[string]any) {
+	if _, ok := defs[name]; ok {
+		return
+	}
+	schema, ok := schemas[name]
+	if !ok {
+		return
+	}
+	defs[name] = schema
+	walk(schema, func(v map[string]any) {
+		if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, openAPIRefPrefix) {
+			addReachable(schemas, strings.TrimPrefix(ref, openAPIRefPrefix), defs)
+		}
+	})
+}
+
+// walk calls f with each object in a JSON value
+func walk(v any, f func(map[string]any)) {
+	switch v := v.(type) {
+	case map[string]any:
+		f(v)
+		for _, child := range v {
+			walk(child, f)
+		}
+	case []any:
+		for _, child := range v {
+			walk(child, f)
+		}
+	}
+}
+
+// toJSONSchema converts an OpenAPI 3.0 schema to JSON Schema, in place
+func toJSONSchema(schema any) any {
+	walk(schema, func(v map[string]any) {
+		if ref, ok := v["$ref"].(string); ok && strings.HasPrefix(ref, openAPIRefPrefix) {
+			v["$ref"] = jsonSchemaRefPrefix + strings.TrimPrefix(ref, openAPIRefPrefix)
+		}
+		if nullable, ok := v["nullable"].(bool); ok {
+			delete(v, "nullable")
+			if t, ok := v["type"].(string); ok && nullable {
+				v["type"] = []any{t, "null"}
+			}
+		}
+	})
+	return schema
+}
+
+// Property is a property of an object in a model's schema, like one of its inputs
+type Property struct {
+	Name     string
+	Schema   *openapi3.Schema
+	Required bool
+	// Order is where the property is defined in the predictor, from its x-order
+	Order float64
+}
+
+// SortedProperties returns an object's properties in the order they're defined in the predictor
+func SortedProperties(schema *openapi3.Schema) []Property {
+	properties := []Property{}
+	for name, ref := range schema.Properties {
+		if ref.Value == nil {
+			continue
+		}
+		order, _ := ref.Value.Extensions["x-order"].(float64)
+		p := Property{Name: name, Schema: ref.Value, Order: order}
+		for _, r := range schema.Required {
+			if r == name {
+				p.Required = true
+			}
+		}
+		properties = append(properties, p)
+	}
+	sort.Slice(properties, func(i, j int) bool {
+		if properties[i].Order != properties[j].Order {
+			return properties[i].Order < properties[j].Order
+		}
+		return properties[i].Name < properties[j].Name
+	})
+	return properties
+}
+
+// Resolve returns the schema a choice refers to, which is an enum, or schema itself if it isn't a choice
+func Resolve(schema *openapi3.Schema) *openapi3.Schema {
+	if len(schema.AllOf) == 1 && schema.AllOf[0].Value != nil {
+		return schema.AllOf[0].Value
+	}
+	return schema
+}
+
+// Component returns the schema of one of a model's components, like Input or Output, or nil if it hasn't got it
+func Component(doc *openapi3.T, name string) *openapi3.Schema {
+	if doc == nil || doc.Components == nil {
+		return nil
+	}
+	ref, ok := doc.Components.Schemas[name]
+	if !ok || ref.Value == nil {
+		return nil
+	}
+	return ref.Value
+}
+
+// Is returns whether a schema has the JSON type t, like string or array
+func Is(schema *openapi3.Schema, t string) bool {
+	return schema.Type != nil && schema.Type.Is(t)
+}
+
+// IsFile returns whether a schema is a file, which is a URI, or a choice of them
+func IsFile(schema *openapi3.Schema) bool {
+	schema = Resolve(schema)
+	return Is(schema, "string") && schema.Format == "uri"
+}
+
+// IsFileList returns whether a schema is a list of files
+func IsFileList(schema *openapi3.Schema) bool {
+	schema = Resolve(schema)
+	return Is(schema, "array") && schema.Items != nil && schema.Items.Value != nil && IsFile(schema.Items.Value)
+}
+
+// IsObject returns whether a schema is an object with properties, like a BaseModel output
+func IsObject(schema *openapi3.Schema) bool {
+	return Is(schema, "object") && len(schema.Properties) > 0
+}
@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/require"
+)
+
+const testSchema = `{
+  "openapi": "3.0.2",
+  "info": {"title": "Cog", "version": "0.1.0"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "Input": {
+        "type": "object",
+        "title": "Input",
+        "required": ["prompt"],
+        "properties": {
+          "steps": {"type": "integer", "title": "Steps", "default": 20, "x-order": 1, "description": "Number of denoising steps."},
+          "prompt": {"type": "string", "title": "Prompt", "x-order": 0, "description": "What to draw"},
+          "image": {"type": "string", "format": "uri", "title": "Image", "x-order": 2},
+          "scheduler": {"allOf": [{"$ref": "#/components/schemas/scheduler"}], "default": "DDIM", "x-order": 3},
+          "options": {"type": "object", "title": "Options", "x-order": 4}
+        }
+      },
+      "scheduler": {"type": "string", "title": "scheduler", "enum": ["DDIM", "K_EULER"]},
+      "Output": {
+        "type": "object",
+        "title": "Output",
+        "required": ["images"],
+        "properties": {
+          "images": {"type": "array", "items": {"type": "string", "format": "uri"}, "title": "Images"},
+          "seed": {"type": "integer", "title": "Seed", "nullable": true}
+        }
+      },
+      "Status": {"type": "string", "enum": ["starting", "succeeded"]}
+    }
+  }
+}`
+
+func loadSchema(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(testSchema))
+	require.NoError(t, err)
+	return doc
+}
+
+func TestJSONSchema(t *testing.T) {
+	data, err := Export(loadSchema(t), "jsonschema", "r8.im/test/sdxl")
+	require.NoError(t, err)
+	exported := map[string]any{}
+	require.NoError(t, json.Unmarshal(data, &exported))
+
+	require.Equal(t, JSONSchemaDialect, exported["$schema"])
+	require.Equal(t, map[string]any{
+		"input":  map[string]any{"$ref": "#/$defs/Input"},
+		"output": map[string]any{"$ref": "#/$defs/Output"},
+	}, exported["properties"])
+
+	defs := exported["$defs"].(map[string]any)
+	require.ElementsMatch(t, []string{"Input", "Output", "scheduler"}, keys(defs))
+	scheduler := defs["Input"].(map[string]any)["properties"].(map[string]any)["scheduler"].(map[string]any)
+	require.Equal(t, []any{map[string]any{"$ref": "#/$defs/scheduler"}}, scheduler["allOf"])
+	seed := defs["Output"].(map[string]any)["properties"].(map[string]any)["seed"].(map[string]any)
+	require.Equal(t, []any{"integer", "null"}, seed["type"])
+	require.NotContains(t, seed, "nullable")
+}
+
+func TestProto(t *testing.T) {
+	data, err := Export(loadSchema(t), "proto", "r8.im/test/sdxl-turbo:v2")
+	require.NoError(t, err)
+	require.Equal(t, `// Generated by cog schema from the schema of r8.im/test/sdxl-turbo:v2
+syntax = "proto3";
+
+package sdxl_turbo;
+
+import "google/protobuf/struct.proto";
+
+// Input is the model's input
+message Input {
+  // What to draw
+  string prompt = 1;
+  // Number of denoising steps
+  optional int64 steps = 2;
+  // A file, as a URL
+  optional string image = 3;
+  // One of: DDIM, K_EULER
+  optional string scheduler = 4;
+  google.protobuf.Struct options = 5;
+}
+
+// Output is the model's output
+message Output {
+  // Files, as URLs
+  repeated string images = 1;
+  optional int64 seed = 2;
+}
+`, string(data))
+}
+
+func TestExportErrors(t *testing.T) {
+	_, err := Export(loadSchema(t), "graphql", "sdxl")
+	require.ErrorContains(t, err, "Choose one of jsonschema, openapi, proto")
+
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(`{"openapi": "3.0.2", "info": {"title": "Cog", "version": "0.1.0"}, "paths": {}}`))
+	require.NoError(t, err)
+	_, err = Export(doc, "proto", "sdxl")
+	require.ErrorContains(t, err, "hasn't got its inputs")
+}
+
+func TestProtoPackage(t *testing.T) {
+	require.Equal(t, "hotdog_detector", ProtoPackage("r8.im/alice/hotdog-detector:v2"))
+	require.Equal(t, "model_3d_gen", ProtoPackage("3D-gen"))
+	require.Equal(t, "model", ProtoPackage("---"))
+}
+
+func TestComponentTypes(t *testing.T) {
+	doc := loadSchema(t)
+	input := Component(doc, "Input")
+	require.NotNil(t, input)
+	require.Nil(t, Component(doc, "TrainingInput"))
+	require.Nil(t, Component(nil, "Input"))
+	require.True(t, IsObject(input))
+	require.False(t, IsObject(input.Properties["options"].Value), "objects without properties aren't outputs with fields")
+
+	require.True(t, IsFile(input.Properties["image"].Value))
+	require.False(t, IsFile(input.Properties["prompt"].Value))
+	require.False(t, IsFile(input.Properties["scheduler"].Value))
+	choice := &openapi3.Schema{AllOf: openapi3.SchemaRefs{{Value: input.Properties["image"].Value}}}
+	require.True(t, IsFile(choice), "a choice of files is a file")
+
+	output := Component(doc, "Output")
+	require.True(t, IsFileList(output.Properties["images"].Value))
+	require.False(t, IsFileList(output.Properties["seed"].Value))
+	require.True(t, Is(output.Properties["seed"].Value, "integer"))
+}
+
+func keys(m map[string]any) []string {
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,65 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager with the aws CLI, so it uses the same credentials,
+// profiles and region as the CLI does. The path is the secret's name or ARN.
+type AWSSecretsManager struct{}
+
+// runAWS is a variable so tests can replace the aws CLI
+var runAWS = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("aws", args...)
+	cmd.Env = os.Environ()
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	console.Debug("$ aws " + strings.Join(args, " "))
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the aws CLI isn't installed. See https://aws.amazon.com/cli/")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (a *AWSSecretsManager) Get(path string, field string) (string, error) {
+	args := []string{"secretsmanager", "get-secret-value", "--secret-id", path, "--query", "SecretString", "--output", "text"}
+	// A secret's ARN says which region it's in, which might not be the default region
+	if region := arnRegion(path); region != "" {
+		args = append(args, "--region", region)
+	}
+	out, err := runAWS(args...)
+	if err != nil {
+		return "", err
+	}
+	value := strings.TrimSuffix(string(out), "\n")
+	if field == "" {
+		return value, nil
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("the secret isn't a JSON object, so it has no field %q", field)
+	}
+	return pickField(data, field)
+}
+
+// arnRegion returns the region in an ARN like arn:aws:secretsmanager:us-east-1:123456789012:secret:name,
+// or "" if s isn't an ARN
+func arnRegion(s string) string {
+	parts := strings.Split(s, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[3]
+}
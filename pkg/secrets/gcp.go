@@ -0,0 +1,67 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// GCPSecretManager reads secrets from Google Cloud Secret Manager with the gcloud CLI, so it uses the same
+// credentials and project as the CLI does. The path is the secret's name, or its resource name, like
+// projects/my-project/secrets/hf-token, optionally followed by /versions/<version>. It reads the latest version if
+// the path doesn't say which.
+type GCPSecretManager struct{}
+
+// runGcloud is a variable so tests can replace the gcloud CLI
+var runGcloud = func(args ...string) ([]byte, error) {
+	cmd := exec.Command("gcloud", args...)
+	cmd.Env = os.Environ()
+	stderr := new(bytes.Buffer)
+	cmd.Stderr = stderr
+	console.Debug("$ gcloud " + strings.Join(args, " "))
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("the gcloud CLI isn't installed. See https://cloud.google.com/sdk/docs/install")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (g *GCPSecretManager) Get(path string, field string) (string, error) {
+	secret, version := SplitGCPSecretVersion(path)
+	args := []string{"secrets", "versions", "access", version, "--secret", secret}
+	if strings.HasPrefix(secret, "projects/") {
+		args = []string{"secrets", "versions", "access", secret + "/versions/" + version}
+	}
+	out, err := runGcloud(args...)
+	if err != nil {
+		return "", err
+	}
+	value := string(out)
+	if field == "" {
+		return value, nil
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("the secret isn't a JSON object, so it has no field %q", field)
+	}
+	return pickField(data, field)
+}
+
+// SplitGCPSecretVersion splits the path of a secret in Google Cloud Secret Manager into the secret and its version,
+// which is "latest" if the path doesn't have one
+func SplitGCPSecretVersion(path string) (secret string, version string) {
+	path = strings.Trim(path, "/")
+	if secret, version, ok := strings.Cut(path, "/versions/"); ok {
+		return secret, version
+	}
+	return path, "latest"
+}
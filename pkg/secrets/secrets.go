@@ -0,0 +1,102 @@
+// Package secrets reads secrets from external secrets managers, for the `from` field of secrets in cog.yaml.
+//
+// A secret is referred to as "<provider>:<path>", optionally followed by "#<field>" to pick one field of a secret
+// that holds several, like "vault:kv/models/hf#token".
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Provider reads secrets from a secrets manager
+type Provider interface {
+	// Get returns the value of the secret at path. If field isn't empty, the secret holds several values and
+	// field picks one of them.
+	Get(path string, field string) (string, error)
+}
+
+var providers = map[string]Provider{
+	"vault":               &Vault{},
+	"aws-secrets-manager": &AWSSecretsManager{},
+	"gcp-secret-manager":  &GCPSecretManager{},
+}
+
+// Providers returns the names of the supported secrets managers
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Ref is a parsed reference to a secret in a secrets manager
+type Ref struct {
+	Provider string
+	Path     string
+	Field    string
+}
+
+// ParseRef parses a reference like "vault:kv/models/hf#token"
+func ParseRef(ref string) (*Ref, error) {
+	provider, rest, ok := strings.Cut(ref, ":")
+	if !ok || rest == "" {
+		return nil, fmt.Errorf("Invalid secret reference %q, expected the form <provider>:<path>", ref)
+	}
+	if _, ok := providers[provider]; !ok {
+		return nil, fmt.Errorf("Unknown secrets provider %q in %q, expected one of: %s", provider, ref, strings.Join(Providers(), ", "))
+	}
+	path, field, _ := strings.Cut(rest, "#")
+	if path == "" {
+		return nil, fmt.Errorf("Invalid secret reference %q, the path is empty", ref)
+	}
+	return &Ref{Provider: provider, Path: path, Field: field}, nil
+}
+
+// Get reads the secret that ref refers to
+func Get(ref string) (string, error) {
+	r, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+	value, err := providers[r.Provider].Get(r.Path, r.Field)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read %s: %w", ref, err)
+	}
+	return value, nil
+}
+
+// pickField returns the field of a secret that holds several values. If field is empty, the secret must hold
+// exactly one value.
+func pickField(data map[string]interface{}, field string) (string, error) {
+	if field == "" {
+		if len(data) != 1 {
+			keys := make([]string, 0, len(data))
+			for k := range data {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return "", fmt.Errorf("the secret has the fields %s, so add #<field> to say which one to use", strings.Join(keys, ", "))
+		}
+		for k := range data {
+			field = k
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("the secret has no field %q", field)
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	// Numbers and booleans are passed on as JSON
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
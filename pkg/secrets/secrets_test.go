@@ -0,0 +1,141 @@
+package secrets
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRef(t *testing.T) {
+	testCases := []struct {
+		ref         string
+		expected    *Ref
+		expectedErr string
+	}{
+		{ref: "vault:kv/models/hf", expected: &Ref{Provider: "vault", Path: "kv/models/hf"}},
+		{ref: "vault:kv/models/hf#token", expected: &Ref{Provider: "vault", Path: "kv/models/hf", Field: "token"}},
+		{
+			ref:      "aws-secrets-manager:arn:aws:secretsmanager:us-east-1:123456789012:secret:hf",
+			expected: &Ref{Provider: "aws-secrets-manager", Path: "arn:aws:secretsmanager:us-east-1:123456789012:secret:hf"},
+		},
+		{ref: "kv/models/hf", expectedErr: "expected the form <provider>:<path>"},
+		{ref: "keychain:hf", expectedErr: `Unknown secrets provider "keychain"`},
+		{ref: "vault:#token", expectedErr: "the path is empty"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.ref, func(t *testing.T) {
+			ref, err := ParseRef(tc.ref)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, ref)
+		})
+	}
+}
+
+func newVaultServer(t *testing.T, version string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/kv/models/hf", "/v1/sys/internal/ui/mounts/kv/models/other":
+			_, _ = w.Write([]byte(`{"data": {"path": "kv/", "options": {"version": "` + version + `"}}}`))
+		case "/v1/kv/data/models/hf":
+			_, _ = w.Write([]byte(`{"data": {"data": {"token": "hf_v2", "user": "me"}}}`))
+		case "/v1/kv/models/hf":
+			_, _ = w.Write([]byte(`{"data": {"token": "hf_v1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestVault(t *testing.T) {
+	server := newVaultServer(t, "2")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	value, err := Get("vault:kv/models/hf#token")
+	require.NoError(t, err)
+	require.Equal(t, "hf_v2", value)
+
+	_, err = Get("vault:kv/models/hf")
+	require.ErrorContains(t, err, "the secret has the fields token, user, so add #<field>")
+
+	_, err = Get("vault:kv/models/hf#password")
+	require.ErrorContains(t, err, `the secret has no field "password"`)
+
+	_, err = Get("vault:kv/models/other")
+	require.ErrorContains(t, err, "Vault has no secret at kv/data/models/other")
+
+	t.Setenv("VAULT_TOKEN", "wrong-token")
+	_, err = Get("vault:kv/models/hf#token")
+	require.ErrorContains(t, err, "Vault denied access")
+}
+
+func TestVaultKVVersion1(t *testing.T) {
+	server := newVaultServer(t, "1")
+	t.Setenv("VAULT_ADDR", server.URL)
+	t.Setenv("VAULT_TOKEN", "test-token")
+
+	// A secret with a single field doesn't need #<field>
+	value, err := Get("vault:kv/models/hf")
+	require.NoError(t, err)
+	require.Equal(t, "hf_v1", value)
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	var calledWith []string
+	original := runAWS
+	t.Cleanup(func() { runAWS = original })
+	runAWS = func(args ...string) ([]byte, error) {
+		calledWith = args
+		return []byte(`{"token": "hf_aws", "retries": 3}` + "\n"), nil
+	}
+
+	value, err := Get("aws-secrets-manager:models/hf")
+	require.NoError(t, err)
+	require.Equal(t, `{"token": "hf_aws", "retries": 3}`, value)
+	require.Equal(t, []string{"secretsmanager", "get-secret-value", "--secret-id", "models/hf", "--query", "SecretString", "--output", "text"}, calledWith)
+
+	value, err = Get("aws-secrets-manager:models/hf#token")
+	require.NoError(t, err)
+	require.Equal(t, "hf_aws", value)
+
+	value, err = Get("aws-secrets-manager:models/hf#retries")
+	require.NoError(t, err)
+	require.Equal(t, "3", value)
+
+	_, err = Get("aws-secrets-manager:arn:aws:secretsmanager:eu-west-1:123456789012:secret:hf#token")
+	require.NoError(t, err)
+	require.Equal(t, []string{"--region", "eu-west-1"}, calledWith[len(calledWith)-2:])
+}
+
+func TestGCPSecretManager(t *testing.T) {
+	var calledWith []string
+	original := runGcloud
+	t.Cleanup(func() { runGcloud = original })
+	runGcloud = func(args ...string) ([]byte, error) {
+		calledWith = args
+		return []byte(`{"token": "hf_gcp"}`), nil
+	}
+
+	value, err := Get("gcp-secret-manager:hf#token")
+	require.NoError(t, err)
+	require.Equal(t, "hf_gcp", value)
+	require.Equal(t, []string{"secrets", "versions", "access", "latest", "--secret", "hf"}, calledWith)
+
+	_, err = Get("gcp-secret-manager:projects/my-project/secrets/hf/versions/3")
+	require.NoError(t, err)
+	require.Equal(t, []string{"secrets", "versions", "access", "projects/my-project/secrets/hf/versions/3"}, calledWith)
+}
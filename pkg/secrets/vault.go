@@ -0,0 +1,122 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Vault reads secrets from HashiCorp Vault's key/value secrets engine, version 1 or 2. It's configured with the
+// same environment variables as the vault CLI: VAULT_ADDR, VAULT_TOKEN (or the token `vault login` saves in
+// ~/.vault-token) and VAULT_NAMESPACE.
+type Vault struct {
+	// Client is the HTTP client to use. Defaults to one with a timeout.
+	Client *http.Client
+}
+
+type vaultMount struct {
+	Data struct {
+		Path    string            `json:"path"`
+		Options map[string]string `json:"options"`
+	} `json:"data"`
+}
+
+type vaultSecret struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+func (v *Vault) Get(path string, field string) (string, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR isn't set")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return "", err
+	}
+	path = strings.Trim(path, "/")
+
+	// Version 2 of the key/value engine keeps secrets under <mount>/data/, so find out which version the mount is
+	mount := vaultMount{}
+	if err := v.get(addr, token, "sys/internal/ui/mounts/"+path, &mount); err != nil {
+		return "", err
+	}
+	apiPath := path
+	mountPath := strings.Trim(mount.Data.Path, "/")
+	isV2 := mount.Data.Options["version"] == "2"
+	if isV2 {
+		apiPath = mountPath + "/data/" + strings.TrimPrefix(strings.TrimPrefix(path, mountPath), "/")
+	}
+
+	secret := vaultSecret{}
+	if err := v.get(addr, token, apiPath, &secret); err != nil {
+		return "", err
+	}
+	data := secret.Data
+	if isV2 {
+		inner, ok := data["data"].(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("Vault returned a secret without data")
+		}
+		data = inner
+	}
+	return pickField(data, field)
+}
+
+func (v *Vault) get(addr string, token string, path string, out interface{}) error {
+	u, err := url.JoinPath(addr, "v1", path)
+	if err != nil {
+		return fmt.Errorf("Invalid VAULT_ADDR %q: %w", addr, err)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if namespace := os.Getenv("VAULT_NAMESPACE"); namespace != "" {
+		req.Header.Set("X-Vault-Namespace", namespace)
+	}
+	client := v.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return fmt.Errorf("Vault has no secret at %s", path)
+	case http.StatusForbidden:
+		return fmt.Errorf("Vault denied access to %s. Check VAULT_TOKEN or run 'vault login'", path)
+	default:
+		return fmt.Errorf("Vault returned status %d for %s", resp.StatusCode, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Failed to parse Vault response: %w", err)
+	}
+	return nil
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	path, err := homedir.Expand("~/.vault-token")
+	if err != nil {
+		return "", err
+	}
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("VAULT_TOKEN isn't set and there's no token from 'vault login' in %s", path)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
@@ -0,0 +1,154 @@
+// Package servers keeps a registry of the prediction servers started by `cog serve` and `cog predict --keep-alive`,
+// so other commands can find the server for a project without knowing which port it ended up on.
+package servers
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+
+	"github.com/replicate/cog/pkg/util/console"
+	"github.com/replicate/cog/pkg/util/files"
+	"github.com/replicate/cog/pkg/util/shell"
+)
+
+type Server struct {
+	ProjectDir string    `json:"projectDir"`
+	Port       int       `json:"port"`
+	PID        int       `json:"pid"`
+	StartedAt  time.Time `json:"startedAt"`
+	TLS        bool      `json:"tls,omitempty"`
+	// KeepAlive is set for containers left running by `cog predict --keep-alive`
+	KeepAlive bool `json:"keepAlive,omitempty"`
+	// Token is the API key generated for the container, if its server requires one
+	Token string `json:"token,omitempty"`
+}
+
+type registry struct {
+	Servers []Server `json:"servers"`
+}
+
+// statePath is a variable so tests can point it at a temporary directory
+var statePath = func() (string, error) {
+	dir, err := homedir.Expand("~/.config/cog")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "servers.json"), nil
+}
+
+// Register records a server for a project, replacing any server previously registered for it
+func Register(server Server) error {
+	r, err := load()
+	if err != nil {
+		return err
+	}
+	r.remove(server.ProjectDir)
+	r.Servers = append(r.Servers, server)
+	return r.save()
+}
+
+// Unregister removes the server for a project, if it is still registered on the given port
+func Unregister(projectDir string, port int) error {
+	r, err := load()
+	if err != nil {
+		return err
+	}
+	servers := []Server{}
+	for _, s := range r.Servers {
+		if s.ProjectDir != projectDir || s.Port != port {
+			servers = append(servers, s)
+		}
+	}
+	r.Servers = servers
+	return r.save()
+}
+
+// Lookup returns the active server for a project, or nil if there isn't one.
+// Servers that are no longer listening are pruned from the registry.
+func Lookup(projectDir string) (*Server, error) {
+	servers, err := List()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range servers {
+		if s.ProjectDir == projectDir {
+			return &s, nil
+		}
+	}
+	return nil, nil
+}
+
+// List returns all active servers, pruning any that are no longer listening
+func List() ([]Server, error) {
+	r, err := load()
+	if err != nil {
+		return nil, err
+	}
+	active := []Server{}
+	for _, s := range r.Servers {
+		if shell.PortIsOpen(s.Port) {
+			active = append(active, s)
+		}
+	}
+	if len(active) != len(r.Servers) {
+		r.Servers = active
+		if err := r.save(); err != nil {
+			console.Debugf("Failed to prune server registry: %s", err)
+		}
+	}
+	return active, nil
+}
+
+func (r *registry) remove(projectDir string) {
+	servers := []Server{}
+	for _, s := range r.Servers {
+		if s.ProjectDir != projectDir {
+			servers = append(servers, s)
+		}
+	}
+	r.Servers = servers
+}
+
+func load() (*registry, error) {
+	r := registry{}
+
+	p, err := statePath()
+	if err != nil {
+		return nil, err
+	}
+	exists, err := files.Exists(p)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return &r, nil
+	}
+	text, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(text, &r); err != nil {
+		console.Debugf("Ignoring invalid server registry %s: %s", p, err)
+		return &registry{}, nil
+	}
+	return &r, nil
+}
+
+func (r *registry) save() error {
+	p, err := statePath()
+	if err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(r, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(p, bytes, 0o600)
+}
@@ -0,0 +1,92 @@
+package servers
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func useTempState(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	original := statePath
+	statePath = func() (string, error) {
+		return filepath.Join(dir, "servers.json"), nil
+	}
+	t.Cleanup(func() { statePath = original })
+}
+
+func listen(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestRegisterAndLookup(t *testing.T) {
+	useTempState(t)
+	port := listen(t)
+
+	require.NoError(t, Register(Server{ProjectDir: "/src/model", Port: port, StartedAt: time.Now()}))
+
+	server, err := Lookup("/src/model")
+	require.NoError(t, err)
+	require.NotNil(t, server)
+	require.Equal(t, port, server.Port)
+
+	server, err = Lookup("/src/other")
+	require.NoError(t, err)
+	require.Nil(t, server)
+}
+
+func TestRegisterReplacesProject(t *testing.T) {
+	useTempState(t)
+	first := listen(t)
+	second := listen(t)
+
+	require.NoError(t, Register(Server{ProjectDir: "/src/model", Port: first}))
+	require.NoError(t, Register(Server{ProjectDir: "/src/model", Port: second}))
+
+	servers, err := List()
+	require.NoError(t, err)
+	require.Len(t, servers, 1)
+	require.Equal(t, second, servers[0].Port)
+}
+
+func TestLookupPrunesStaleServers(t *testing.T) {
+	useTempState(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	require.NoError(t, Register(Server{ProjectDir: "/src/model", Port: port}))
+	listener.Close()
+
+	server, err := Lookup("/src/model")
+	require.NoError(t, err)
+	require.Nil(t, server)
+
+	r, err := load()
+	require.NoError(t, err)
+	require.Empty(t, r.Servers)
+}
+
+func TestUnregister(t *testing.T) {
+	useTempState(t)
+	port := listen(t)
+
+	require.NoError(t, Register(Server{ProjectDir: "/src/model", Port: port}))
+	require.NoError(t, Unregister("/src/model", port+1))
+	server, err := Lookup("/src/model")
+	require.NoError(t, err)
+	require.NotNil(t, server)
+
+	require.NoError(t, Unregister("/src/model", port))
+	server, err = Lookup("/src/model")
+	require.NoError(t, err)
+	require.Nil(t, server)
+}
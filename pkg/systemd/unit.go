@@ -0,0 +1,75 @@
+// Package systemd renders systemd service units that run a model's HTTP server in a Docker container, for
+// machines without a container orchestrator.
+package systemd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RestartPolicies are the values systemd accepts for Restart=
+var RestartPolicies = []string{"no", "always", "on-success", "on-failure", "on-abnormal", "on-abort", "on-watchdog"}
+
+type Unit struct {
+	Description string
+	// DockerPath is the absolute path to the docker binary, because systemd doesn't search PATH
+	DockerPath string
+	// ContainerName is the name of the container the unit runs, so it can be stopped and cleaned up
+	ContainerName string
+	// DockerRunArgs are the arguments to docker that start the container in the foreground, starting with "run"
+	DockerRunArgs []string
+	Restart       string
+	RestartSec    int
+}
+
+// Render returns the contents of a .service file for the unit
+func (u Unit) Render() string {
+	docker := quote(u.DockerPath)
+	name := quote(u.ContainerName)
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", escape(u.Description))
+	b.WriteString("After=docker.service network-online.target\n")
+	b.WriteString("Requires=docker.service\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("\n")
+	b.WriteString("[Service]\n")
+	b.WriteString("Type=simple\n")
+	// Pulling the image on first start can take a long time
+	b.WriteString("TimeoutStartSec=0\n")
+	// Remove a container left over from an unclean shutdown, which would stop the new one starting. The leading "-"
+	// ignores the error when there isn't one.
+	fmt.Fprintf(&b, "ExecStartPre=-%s rm --force %s\n", docker, name)
+	fmt.Fprintf(&b, "ExecStart=%s", docker)
+	for _, arg := range u.DockerRunArgs {
+		fmt.Fprintf(&b, " \\\n    %s", quote(arg))
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "ExecStop=%s stop %s\n", docker, name)
+	fmt.Fprintf(&b, "Restart=%s\n", u.Restart)
+	fmt.Fprintf(&b, "RestartSec=%d\n", u.RestartSec)
+	b.WriteString("\n")
+	b.WriteString("[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// escape escapes the characters systemd expands in unit files: % specifiers and $ environment variables
+func escape(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	return strings.ReplaceAll(s, "$", "$$")
+}
+
+// quote escapes an argument to a command line in a unit file, double quoting it if it has characters systemd would
+// otherwise split on or interpret
+func quote(arg string) string {
+	arg = escape(arg)
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+		return arg
+	}
+	arg = strings.ReplaceAll(arg, `\`, `\\`)
+	arg = strings.ReplaceAll(arg, `"`, `\"`)
+	arg = strings.ReplaceAll(arg, "\n", `\n`)
+	return `"` + arg + `"`
+}
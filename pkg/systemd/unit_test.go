@@ -0,0 +1,60 @@
+package systemd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	unit := Unit{
+		Description:   "Cog model server for r8.im/user/model",
+		DockerPath:    "/usr/bin/docker",
+		ContainerName: "cog-model",
+		DockerRunArgs: []string{"run", "--rm", "--name", "cog-model", "--publish", "5000:5000", "r8.im/user/model"},
+		Restart:       "always",
+		RestartSec:    10,
+	}
+	require.Equal(t, `[Unit]
+Description=Cog model server for r8.im/user/model
+After=docker.service network-online.target
+Requires=docker.service
+Wants=network-online.target
+
+[Service]
+Type=simple
+TimeoutStartSec=0
+ExecStartPre=-/usr/bin/docker rm --force cog-model
+ExecStart=/usr/bin/docker \
+    run \
+    --rm \
+    --name \
+    cog-model \
+    --publish \
+    5000:5000 \
+    r8.im/user/model
+ExecStop=/usr/bin/docker stop cog-model
+Restart=always
+RestartSec=10
+
+[Install]
+WantedBy=multi-user.target
+`, unit.Render())
+}
+
+func TestQuote(t *testing.T) {
+	for _, tc := range []struct {
+		arg      string
+		expected string
+	}{
+		{"--publish", "--publish"},
+		{"", `""`},
+		{"KEY=a value", `"KEY=a value"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"100%", "100%%"},
+		{"$HOME", "$$HOME"},
+		{`C:\path`, `"C:\\path"`},
+	} {
+		require.Equal(t, tc.expected, quote(tc.arg), tc.arg)
+	}
+}
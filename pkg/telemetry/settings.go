@@ -0,0 +1,91 @@
+package telemetry
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// Settings are whether telemetry is on, and where it's sent. They're stored in ~/.config/cog/telemetry.json.
+type Settings struct {
+	Enabled bool `json:"enabled"`
+	// ID is a random ID for this installation of Cog, so events from it can be counted together. It isn't derived
+	// from anything about the user or their machine.
+	ID string `json:"id,omitempty"`
+	// Endpoint is the URL events are sent to. Nothing is sent if it's "" and COG_TELEMETRY_ENDPOINT isn't set.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// LoadSettings loads the telemetry settings, which are off if they haven't been saved
+func LoadSettings() (*Settings, error) {
+	path, err := settingsPath()
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Settings{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	settings := &Settings{}
+	if err := json.Unmarshal(contents, settings); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// Save saves the settings, giving the installation an ID if it hasn't got one
+func (s *Settings) Save() error {
+	if s.ID == "" {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		s.ID = hex.EncodeToString(id)
+	}
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+	contents, err := json.MarshalIndent(s, "", " ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, contents, 0o600); err != nil {
+		return fmt.Errorf("Failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// EndpointURL returns the URL that events are sent to: COG_TELEMETRY_ENDPOINT, or the endpoint in the settings. It's
+// "" if neither is set.
+func (s *Settings) EndpointURL() string {
+	if endpoint := os.Getenv(EndpointEnvVar); endpoint != "" {
+		return endpoint
+	}
+	return s.Endpoint
+}
+
+// IsEnabled returns whether events are sent, which they are if telemetry has been turned on, it has an endpoint, and
+// it isn't turned off in the environment
+func (s *Settings) IsEnabled() bool {
+	return s.Enabled && s.EndpointURL() != "" && !DisabledByEnvironment()
+}
+
+func settingsPath() (string, error) {
+	dir, err := homedir.Expand("~/.config/cog")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "telemetry.json"), nil
+}
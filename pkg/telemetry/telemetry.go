@@ -0,0 +1,124 @@
+// Package telemetry sends anonymous usage events, like which commands are run and how long builds take, to help
+// prioritize work on Cog. It's off unless it's turned on with 'cog telemetry on'.
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+	"github.com/replicate/cog/pkg/global"
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+const (
+	// EndpointEnvVar sets the URL events are sent to, overriding the one in the settings
+	EndpointEnvVar = "COG_TELEMETRY_ENDPOINT"
+	// DisableEnvVar turns telemetry off when it's set to anything, even if it has been turned on
+	DisableEnvVar = "COG_NO_TELEMETRY"
+)
+
+// sendTimeout is how long Cog waits for an event to be sent before it exits
+const sendTimeout = 2 * time.Second
+
+// The categories of errors in events, apart from the codes of coded errors
+const (
+	ErrorInterrupted = "INTERRUPTED"
+	ErrorOther       = "OTHER"
+)
+
+// Event is what's sent about each command that's run. It doesn't have the command's arguments, or anything about
+// the model, the project, or the user.
+type Event struct {
+	// ID is the installation's random ID from the settings
+	ID      string `json:"id"`
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+	// Command is the command that was run, like "cog build"
+	Command    string `json:"command"`
+	DurationMS int64  `json:"duration_ms"`
+	// Error is the category of error the command failed with, like "BUILD_FAILED", or "" if it succeeded
+	Error string `json:"error,omitempty"`
+	// BuildStage is the stage of the build that failed, like "image", if the command failed to build a model
+	BuildStage string `json:"build_stage,omitempty"`
+}
+
+// DisabledByEnvironment returns whether telemetry is turned off with COG_NO_TELEMETRY or DO_NOT_TRACK
+func DisabledByEnvironment() bool {
+	return os.Getenv(DisableEnvVar) != "" || (os.Getenv("DO_NOT_TRACK") != "" && os.Getenv("DO_NOT_TRACK") != "0")
+}
+
+// NewEvent returns the event for a command that took duration to run, and failed with err if it isn't nil
+func NewEvent(id string, command string, duration time.Duration, err error) Event {
+	event := Event{
+		ID:         id,
+		Version:    global.Version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		Command:    command,
+		DurationMS: duration.Milliseconds(),
+	}
+	if err == nil {
+		return event
+	}
+	var buildErr *cogerrors.BuildError
+	if errors.As(err, &buildErr) {
+		event.BuildStage = buildErr.Stage
+	}
+	switch code := cogerrors.Code(err); {
+	case errors.Is(err, context.Canceled):
+		event.Error = ErrorInterrupted
+	case code != "":
+		event.Error = code
+	default:
+		event.Error = ErrorOther
+	}
+	return event
+}
+
+// Record sends the event for a command, if telemetry is turned on and has an endpoint. It never fails the command, so errors are only
+// logged.
+func Record(command string, duration time.Duration, err error) {
+	settings, loadErr := LoadSettings()
+	if loadErr != nil {
+		console.Debugf("Failed to load telemetry settings: %s", loadErr)
+		return
+	}
+	if !settings.IsEnabled() {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	if sendErr := send(ctx, settings.EndpointURL(), NewEvent(settings.ID, command, duration, err)); sendErr != nil {
+		console.Debugf("Failed to send telemetry: %s", sendErr)
+	}
+}
+
+func send(ctx context.Context, endpoint string, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %s", endpoint, resp.Status)
+	}
+	return nil
+}
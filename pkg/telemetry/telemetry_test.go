@@ -0,0 +1,80 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/stretchr/testify/require"
+
+	cogerrors "github.com/replicate/cog/pkg/errors"
+)
+
+func TestNewEvent(t *testing.T) {
+	event := NewEvent("abc", "cog build", 1500*time.Millisecond, nil)
+	require.Equal(t, "abc", event.ID)
+	require.Equal(t, "cog build", event.Command)
+	require.Equal(t, int64(1500), event.DurationMS)
+	require.Empty(t, event.Error)
+
+	for _, tt := range []struct {
+		err        error
+		category   string
+		buildStage string
+	}{
+		{fmt.Errorf("Failed to build: %w", &cogerrors.BuildError{Stage: cogerrors.BuildStageImage, Err: errors.New("pip failed")}), cogerrors.CodeBuildFailed, cogerrors.BuildStageImage},
+		{cogerrors.ConfigNotFound("no cog.yaml"), cogerrors.CodeConfigNotFound, ""},
+		{context.Canceled, ErrorInterrupted, ""},
+		{errors.New("/home/someone/model is private"), ErrorOther, ""},
+	} {
+		event := NewEvent("abc", "cog build", time.Second, tt.err)
+		require.Equal(t, tt.category, event.Error)
+		require.Equal(t, tt.buildStage, event.BuildStage)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(DisableEnvVar, "")
+	t.Setenv("DO_NOT_TRACK", "")
+	t.Setenv(EndpointEnvVar, "")
+
+	events := []Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := Event{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&event))
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	// Off until it's turned on
+	Record("cog build", time.Second, nil)
+	require.Empty(t, events)
+
+	// Nothing is sent without an endpoint, because there's no default
+	settings, err := LoadSettings()
+	require.NoError(t, err)
+	settings.Enabled = true
+	require.NoError(t, settings.Save())
+	require.False(t, settings.IsEnabled())
+	require.Empty(t, settings.EndpointURL())
+
+	settings.Endpoint = server.URL
+	require.NoError(t, settings.Save())
+	Record("cog build", time.Second, nil)
+	require.Len(t, events, 1)
+	require.Equal(t, "cog build", events[0].Command)
+	require.Len(t, events[0].ID, 32)
+
+	t.Setenv("DO_NOT_TRACK", "1")
+	Record("cog build", time.Second, nil)
+	require.Len(t, events, 1)
+}
@@ -0,0 +1,119 @@
+// Package testharness builds and runs Cog models from Go, so they can be tested end to end.
+//
+// In a Go test:
+//
+//	func TestModel(t *testing.T) {
+//		model := testharness.Start(t, testharness.Options{ProjectDir: "../my-model"})
+//		prediction, err := model.Predict(map[string]any{"prompt": "a cat"})
+//		require.NoError(t, err)
+//		require.Equal(t, "succeeded", string(prediction.Status))
+//	}
+//
+// The model's container is stopped when the test finishes. Docker must be running.
+package testharness
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/replicate/cog/pkg/cog"
+	"github.com/replicate/cog/pkg/predict"
+)
+
+// Options are how to build and run a model
+type Options = cog.RunOptions
+
+// Model is a running model
+type Model struct {
+	*cog.Model
+}
+
+// New builds a model, or uses Options.Image, then starts it and waits for its setup() to finish. Stop it with Close.
+func New(opts Options) (*Model, error) {
+	if opts.ContainerCommand == "" {
+		opts.ContainerCommand = "testharness"
+	}
+	m, err := cog.Run(context.Background(), opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Model{m}, nil
+}
+
+// Start is like New, but fails the test if the model doesn't start, and stops the model when the test finishes.
+// The model's logs are written to the test's log.
+func Start(t testing.TB, opts Options) *Model {
+	t.Helper()
+	var logs *testLogWriter
+	if opts.Logs == nil {
+		logs = &testLogWriter{t: t}
+		opts.Logs = logs
+	}
+	m, err := New(opts)
+	if err != nil {
+		logs.close()
+		t.Fatalf("Failed to start model: %s", err)
+	}
+	t.Cleanup(func() {
+		// Logging after a test finishes panics, so stop before the container's last logs arrive
+		logs.close()
+		if err := m.Close(); err != nil {
+			t.Errorf("Failed to stop model: %s", err)
+		}
+	})
+	return m
+}
+
+// Predict runs a prediction. The input is sent to the model as it is, like the input in the prediction API, so
+// numbers are numbers and files are URLs or data URLs. Use File to pass a local file.
+func (m *Model) Predict(input map[string]any) (*predict.Response, error) {
+	return m.Model.Predict(context.Background(), input)
+}
+
+// File returns a local file as a data URL, to pass as an input to Predict
+func File(path string) (string, error) {
+	return cog.File(path)
+}
+
+// testLogWriter writes a model's logs to a test's log, a line at a time, until it's closed
+type testLogWriter struct {
+	t      testing.TB
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (w *testLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return len(p), nil
+	}
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line until the rest of it is written
+			w.buf.Reset()
+			w.buf.WriteString(line)
+			break
+		}
+		w.t.Log(strings.TrimRight(line, "\r\n"))
+	}
+	return len(p), nil
+}
+
+func (w *testLogWriter) close() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed && w.buf.Len() > 0 {
+		w.t.Log(w.buf.String())
+	}
+	w.closed = true
+}
@@ -0,0 +1,37 @@
+package testharness
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewWithoutConfig(t *testing.T) {
+	_, err := New(Options{ProjectDir: t.TempDir()})
+	require.ErrorContains(t, err, "cog.yaml")
+}
+
+// recordingTB records what's logged to it
+type recordingTB struct {
+	testing.TB
+	logs []string
+}
+
+func (r *recordingTB) Log(args ...any) {
+	r.logs = append(r.logs, args[0].(string))
+}
+
+func TestTestLogWriter(t *testing.T) {
+	tb := &recordingTB{}
+	w := &testLogWriter{t: tb}
+	_, err := w.Write([]byte("first line\nsecond "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("line\r\nthird"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"first line", "second line"}, tb.logs)
+
+	w.close()
+	_, err = w.Write([]byte("after close\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"first line", "second line", "third"}, tb.logs)
+}
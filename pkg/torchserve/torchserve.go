@@ -0,0 +1,182 @@
+// Package torchserve imports TorchServe model archives (.mar files), by generating a cog.yaml and a predictor that
+// runs the archive's handler with TorchServe's Python library, without TorchServe's Java frontend.
+package torchserve
+
+import (
+	"archive/zip"
+	"bytes"
+	// blank import for embeds
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/replicate/cog/pkg/importer"
+)
+
+// ManifestFile is the file in a model archive that describes it
+const ManifestFile = "MAR-INF/MANIFEST.json"
+
+// ModelDir is the directory in the project the archive is extracted to, which the predictor loads the model from
+const ModelDir = "model"
+
+// fileHandlers are TorchServe's default handlers that take files, like images, rather than text or JSON
+var fileHandlers = map[string]bool{
+	"image_classifier": true,
+	"image_segmenter":  true,
+	"object_detector":  true,
+}
+
+//go:embed templates/predict.py.tmpl
+var predictorTemplate string
+
+// Archive is a TorchServe model archive
+type Archive struct {
+	ModelName    string
+	ModelVersion string
+	// Handler is the handler that runs the model, which is one of TorchServe's default handlers, like
+	// image_classifier, or a Python file in the archive, like handler.py or handler.py:handle
+	Handler string
+	// Runtime is what the handler runs with, which is python
+	Runtime string
+	// Requirements are the pip requirements in the archive's requirements file
+	Requirements []string
+	// ConfigFile is the archive's model configuration, like model-config.yaml
+	ConfigFile string
+}
+
+type manifest struct {
+	Runtime string `json:"runtime"`
+	Model   struct {
+		ModelName        string `json:"modelName"`
+		ModelVersion     string `json:"modelVersion"`
+		Handler          string `json:"handler"`
+		RequirementsFile string `json:"requirementsFile"`
+		ConfigFile       string `json:"configFile"`
+	} `json:"model"`
+}
+
+// Read reads the model archive extracted in a directory
+func Read(dir string) (*Archive, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ManifestFile)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%s isn't a TorchServe model archive, because it hasn't got a %s file", dir, ManifestFile)
+	} else if err != nil {
+		return nil, err
+	}
+	m := manifest{}
+	if err := json.Unmarshal(contents, &m); err != nil {
+		return nil, fmt.Errorf("Failed to parse %s: %w", ManifestFile, err)
+	}
+	if m.Runtime != "" && m.Runtime != "python" && m.Runtime != "python3" {
+		return nil, fmt.Errorf("The model archive's runtime is %s, but only Python handlers can be imported", m.Runtime)
+	}
+	if m.Model.Handler == "" {
+		return nil, fmt.Errorf("The model archive hasn't got a handler")
+	}
+
+	a := &Archive{
+		ModelName:    m.Model.ModelName,
+		ModelVersion: m.Model.ModelVersion,
+		Handler:      m.Model.Handler,
+		Runtime:      m.Runtime,
+		ConfigFile:   m.Model.ConfigFile,
+	}
+	if m.Model.RequirementsFile != "" {
+		requirements, err := os.ReadFile(filepath.Join(dir, m.Model.RequirementsFile))
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read the model archive's requirements: %w", err)
+		}
+		a.Requirements = importer.RequirementLines(string(requirements))
+	}
+	return a, nil
+}
+
+// TakesFiles is whether the archive's handler takes files, like images, rather than text or JSON
+func (a *Archive) TakesFiles() bool {
+	return fileHandlers[a.Handler]
+}
+
+// Environment returns what the archive needs to run, which is its requirements, PyTorch and TorchServe's Python
+// library. The default handlers for images also need torchvision, and model configurations need PyYAML.
+func (a *Archive) Environment() importer.Environment {
+	packages := []string{"torch"}
+	if a.TakesFiles() {
+		packages = append(packages, "torchvision")
+	}
+	packages = append(packages, "torchserve")
+	if a.ConfigFile != "" {
+		packages = append(packages, "pyyaml")
+	}
+	return importer.Environment{Requirements: importer.AddRequirements(a.Requirements, packages...)}
+}
+
+// Predictor returns a predictor that runs the archive's handler on one request at a time. It takes a file if the
+// handler is one of TorchServe's default handlers for images, and text otherwise, which is passed to the handler as
+// JSON if it's valid JSON.
+func Predictor(a *Archive) ([]byte, error) {
+	tmpl, err := template.New("predict.py").Parse(predictorTemplate)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, map[string]any{
+		"ModelDir":   ModelDir,
+		"Archive":    a,
+		"TakesFiles": a.TakesFiles(),
+	}); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Extract extracts a model archive, which is a zip file, to a directory
+func Extract(path string, dst string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %w", path, err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		target := filepath.Join(dst, f.Name)
+		if !strings.HasPrefix(target, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("%s has a file outside the archive, %s", path, f.Name)
+		}
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := extractFile(f, target); err != nil {
+			return fmt.Errorf("Failed to extract %s from %s: %w", f.Name, path, err)
+		}
+	}
+	return nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	in, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil { //#nosec G110
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,98 @@
+package torchserve
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testManifest = `{
+  "createdOn": "28/05/2024 09:12:35",
+  "runtime": "python",
+  "model": {
+    "modelName": "densenet161",
+    "serializedFile": "model.pt",
+    "handler": "image_classifier",
+    "modelVersion": "1.0",
+    "requirementsFile": "requirements.txt"
+  },
+  "archiverVersion": "0.11.0"
+}`
+
+func writeArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "densenet161.mar")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	w := zip.NewWriter(f)
+	for name, contents := range files {
+		fw, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = fw.Write([]byte(contents))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, f.Close())
+	return path
+}
+
+func TestExtractAndRead(t *testing.T) {
+	path := writeArchive(t, map[string]string{
+		ManifestFile:         testManifest,
+		"model.pt":           "weights",
+		"index_to_name.json": "{}",
+		"requirements.txt":   "pillow==10.3.0\n",
+	})
+	dir := t.TempDir()
+	require.NoError(t, Extract(path, dir))
+	require.FileExists(t, filepath.Join(dir, "model.pt"))
+
+	a, err := Read(dir)
+	require.NoError(t, err)
+	require.Equal(t, &Archive{
+		ModelName:    "densenet161",
+		ModelVersion: "1.0",
+		Handler:      "image_classifier",
+		Runtime:      "python",
+		Requirements: []string{"pillow==10.3.0"},
+	}, a)
+	require.True(t, a.TakesFiles())
+	require.Equal(t, []string{"pillow==10.3.0", "torch", "torchvision", "torchserve"}, a.Environment().Requirements)
+
+	predictor, err := Predictor(a)
+	require.NoError(t, err)
+	require.Contains(t, string(predictor), `HANDLER = "image_classifier"`)
+	require.Contains(t, string(predictor), `        input: Path = Input(description="The model's input file"),`)
+	require.NotContains(t, string(predictor), "import yaml\n")
+}
+
+func TestPredictorText(t *testing.T) {
+	a := &Archive{ModelName: "bert", Handler: "handler.py:handle", ConfigFile: "model-config.yaml"}
+	require.False(t, a.TakesFiles())
+	require.Equal(t, []string{"torch", "torchserve", "pyyaml"}, a.Environment().Requirements)
+	predictor, err := Predictor(a)
+	require.NoError(t, err)
+	require.Contains(t, string(predictor), "from cog import BasePredictor, Input\n")
+	require.Contains(t, string(predictor), `CONFIG_FILE = "model-config.yaml"`)
+	require.Contains(t, string(predictor), "import yaml\n")
+	require.Contains(t, string(predictor), `        input: str = Input(description="The model's input, as text or JSON"),`)
+}
+
+func TestReadErrors(t *testing.T) {
+	_, err := Read(t.TempDir())
+	require.ErrorContains(t, err, "isn't a TorchServe model archive")
+
+	path := writeArchive(t, map[string]string{ManifestFile: `{"runtime": "LSP", "model": {"modelName": "llm", "handler": "handler.py"}}`})
+	dir := t.TempDir()
+	require.NoError(t, Extract(path, dir))
+	_, err = Read(dir)
+	require.ErrorContains(t, err, "only Python handlers")
+}
+
+func TestExtractOutside(t *testing.T) {
+	path := writeArchive(t, map[string]string{"../evil.py": "import os\n"})
+	require.ErrorContains(t, Extract(path, t.TempDir()), "outside the archive")
+}
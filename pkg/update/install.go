@@ -0,0 +1,201 @@
+package update
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// The release channels that Cog can be updated from
+const (
+	// ChannelStable is the latest release
+	ChannelStable = "stable"
+	// ChannelBeta is the latest release or pre-release
+	ChannelBeta = "beta"
+)
+
+// releasesURL is the GitHub API URL of Cog's releases
+var releasesURL = "https://api.github.com/repos/replicate/cog/releases"
+
+// checksumsAsset is the asset of each release with the SHA-256 checksums of its binaries
+const checksumsAsset = "checksums.txt"
+
+type Release struct {
+	TagName    string  `json:"tag_name"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []Asset `json:"assets"`
+}
+
+type Asset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Version returns the release's version, like "0.14.0" for the tag "v0.14.0"
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.TagName, "v")
+}
+
+// IsNewerThan returns whether the release is newer than the version of Cog that's running. Development builds are
+// older than every release.
+func (r *Release) IsNewerThan(current string) bool {
+	releaseVersion, err := version.NewVersion(r.Version())
+	if err != nil {
+		return false
+	}
+	currentVersion, err := version.NewVersion(current)
+	if err != nil {
+		return true
+	}
+	return releaseVersion.GreaterThan(currentVersion)
+}
+
+func (r *Release) asset(name string) (Asset, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, nil
+		}
+	}
+	return Asset{}, fmt.Errorf("Cog %s hasn't got a %s download", r.Version(), name)
+}
+
+// LatestRelease returns the latest release of Cog in a channel
+func LatestRelease(ctx context.Context, channel string) (*Release, error) {
+	switch channel {
+	case ChannelStable:
+		release := &Release{}
+		if err := getJSON(ctx, releasesURL+"/latest", release); err != nil {
+			return nil, fmt.Errorf("Failed to get the latest release of Cog: %w", err)
+		}
+		return release, nil
+	case ChannelBeta:
+		releases := []*Release{}
+		if err := getJSON(ctx, releasesURL+"?per_page=10", &releases); err != nil {
+			return nil, fmt.Errorf("Failed to get the latest release of Cog: %w", err)
+		}
+		if len(releases) == 0 {
+			return nil, fmt.Errorf("Cog hasn't got any releases")
+		}
+		return releases[0], nil
+	}
+	return nil, fmt.Errorf("Invalid channel %q, expected %s or %s", channel, ChannelStable, ChannelBeta)
+}
+
+// BinaryName returns the name of the release asset with the Cog binary for an operating system and architecture,
+// like "cog_Linux_x86_64"
+func BinaryName(goos string, goarch string) string {
+	arch := goarch
+	if goarch == "amd64" {
+		arch = "x86_64"
+	}
+	name := "cog_" + strings.ToUpper(goos[:1]) + goos[1:] + "_" + arch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// Install downloads the Cog binary in a release, checks it against the release's checksums, and replaces the
+// binary at executable with it
+func Install(ctx context.Context, release *Release, executable string) error {
+	name := BinaryName(runtime.GOOS, runtime.GOARCH)
+	binary, err := release.asset(name)
+	if err != nil {
+		return err
+	}
+	checksums, err := release.asset(checksumsAsset)
+	if err != nil {
+		return err
+	}
+	expected, err := downloadChecksum(ctx, checksums.URL, name)
+	if err != nil {
+		return err
+	}
+
+	// Download next to the binary, so it can be renamed over it
+	tmp, err := os.CreateTemp(filepath.Dir(executable), ".cog-update-*")
+	if err != nil {
+		return fmt.Errorf("Failed to download Cog %s: %w", release.Version(), err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	hash := sha256.New()
+	if err := download(ctx, binary.URL, io.MultiWriter(tmp, hash)); err != nil {
+		return fmt.Errorf("Failed to download Cog %s: %w", release.Version(), err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to download Cog %s: %w", release.Version(), err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("The checksum of the downloaded %s is %s, but %s says it should be %s, so it wasn't installed", name, actual, checksumsAsset, expected)
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return fmt.Errorf("Failed to install Cog %s: %w", release.Version(), err)
+	}
+
+	if runtime.GOOS == "windows" {
+		// Windows can't replace a running executable, but it can rename it
+		old := executable + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(executable, old); err != nil {
+			return fmt.Errorf("Failed to install Cog %s: %w", release.Version(), err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), executable); err != nil {
+		return fmt.Errorf("Failed to install Cog %s: %w", release.Version(), err)
+	}
+	return nil
+}
+
+// downloadChecksum returns the SHA-256 checksum of name in a checksums file, which has lines like
+// "<checksum>  cog_Linux_x86_64"
+func downloadChecksum(ctx context.Context, url string, name string) (string, error) {
+	var b strings.Builder
+	if err := download(ctx, url, &b); err != nil {
+		return "", fmt.Errorf("Failed to download %s: %w", checksumsAsset, err)
+	}
+	scanner := bufio.NewScanner(strings.NewReader(b.String()))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("%s hasn't got a checksum for %s", checksumsAsset, name)
+}
+
+func getJSON(ctx context.Context, url string, v any) error {
+	var b strings.Builder
+	if err := download(ctx, url, &b); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(b.String()), v)
+}
+
+func download(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with %s", url, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
@@ -0,0 +1,108 @@
+package update
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBinaryName(t *testing.T) {
+	require.Equal(t, "cog_Linux_x86_64", BinaryName("linux", "amd64"))
+	require.Equal(t, "cog_Darwin_arm64", BinaryName("darwin", "arm64"))
+	require.Equal(t, "cog_Windows_x86_64.exe", BinaryName("windows", "amd64"))
+}
+
+func TestReleaseIsNewerThan(t *testing.T) {
+	release := &Release{TagName: "v0.14.1"}
+	require.True(t, release.IsNewerThan("0.14.0"))
+	require.True(t, release.IsNewerThan("0.14.1-beta1"))
+	require.True(t, release.IsNewerThan("dev"))
+	require.False(t, release.IsNewerThan("0.14.1"))
+	require.False(t, release.IsNewerThan("0.15.0"))
+}
+
+// releaseServer serves releases of Cog with a binary that has contents, and a checksums file with checksum
+func releaseServer(t *testing.T, contents string, checksum string) *httptest.Server {
+	t.Helper()
+	name := BinaryName(runtime.GOOS, runtime.GOARCH)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stable := &Release{TagName: "v0.14.0", Assets: []Asset{
+			{Name: name, URL: server.URL + "/download/" + name},
+			{Name: checksumsAsset, URL: server.URL + "/download/" + checksumsAsset},
+		}}
+		switch r.URL.Path {
+		case "/releases/latest":
+			require.NoError(t, json.NewEncoder(w).Encode(stable))
+		case "/releases":
+			require.NoError(t, json.NewEncoder(w).Encode([]*Release{{TagName: "v0.15.0-beta1", Prerelease: true}, stable}))
+		case "/download/" + name:
+			_, _ = w.Write([]byte(contents))
+		case "/download/" + checksumsAsset:
+			_, _ = w.Write([]byte("0123  cog_Other_arch\n" + checksum + "  " + name + "\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	original := releasesURL
+	releasesURL = server.URL + "/releases"
+	t.Cleanup(func() { releasesURL = original })
+	return server
+}
+
+func TestLatestRelease(t *testing.T) {
+	releaseServer(t, "", "")
+
+	release, err := LatestRelease(context.Background(), ChannelStable)
+	require.NoError(t, err)
+	require.Equal(t, "0.14.0", release.Version())
+
+	release, err = LatestRelease(context.Background(), ChannelBeta)
+	require.NoError(t, err)
+	require.Equal(t, "0.15.0-beta1", release.Version())
+
+	_, err = LatestRelease(context.Background(), "nightly")
+	require.ErrorContains(t, err, `Invalid channel "nightly"`)
+}
+
+func TestInstall(t *testing.T) {
+	sum := sha256.Sum256([]byte("new cog"))
+	releaseServer(t, "new cog", hex.EncodeToString(sum[:]))
+	release, err := LatestRelease(context.Background(), ChannelStable)
+	require.NoError(t, err)
+
+	executable := filepath.Join(t.TempDir(), "cog")
+	require.NoError(t, os.WriteFile(executable, []byte("old cog"), 0o755))
+	require.NoError(t, Install(context.Background(), release, executable))
+	contents, err := os.ReadFile(executable)
+	require.NoError(t, err)
+	require.Equal(t, "new cog", string(contents))
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	releaseServer(t, "tampered cog", "0000")
+	release, err := LatestRelease(context.Background(), ChannelStable)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	executable := filepath.Join(dir, "cog")
+	require.NoError(t, os.WriteFile(executable, []byte("old cog"), 0o755))
+	err = Install(context.Background(), release, executable)
+	require.ErrorContains(t, err, "but checksums.txt says it should be 0000, so it wasn't installed")
+	contents, err := os.ReadFile(executable)
+	require.NoError(t, err)
+	require.Equal(t, "old cog", string(contents))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -41,6 +41,7 @@ func DisplayAndCheckForRelease() error {
 	}
 	if s.Message != "" {
 		console.Info(s.Message)
+		console.Info("Run 'cog update' to update.")
 		console.Info("")
 	}
 	return nil
@@ -0,0 +1,86 @@
+// Package certs generates self-signed TLS certificates for serving models locally over HTTPS.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	CertFilename = "localhost.crt"
+	KeyFilename  = "localhost.key"
+
+	validFor = 365 * 24 * time.Hour
+	// Certificates are regenerated when they have less than this long left
+	renewBefore = 7 * 24 * time.Hour
+)
+
+// SelfSigned returns the paths to a self-signed certificate and key for localhost in dir,
+// generating them if they don't exist or are about to expire
+func SelfSigned(dir string) (certPath string, keyPath string, err error) {
+	certPath = filepath.Join(dir, CertFilename)
+	keyPath = filepath.Join(dir, KeyFilename)
+
+	if pair, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil {
+		cert, err := x509.ParseCertificate(pair.Certificate[0])
+		if err == nil && time.Until(cert.NotAfter) > renewBefore {
+			return certPath, keyPath, nil
+		}
+	}
+
+	if err := generate(certPath, keyPath); err != nil {
+		return "", "", fmt.Errorf("Failed to generate self-signed certificate: %w", err)
+	}
+	return certPath, keyPath, nil
+}
+
+func generate(certPath string, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Cog"}, CommonName: "localhost"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validFor),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644) //#nosec G306
+}
@@ -0,0 +1,30 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+
+	certPath, keyPath, err := SelfSigned(dir)
+	require.NoError(t, err)
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+	require.NoError(t, cert.VerifyHostname("localhost"))
+	require.NoError(t, cert.VerifyHostname("127.0.0.1"))
+
+	// The certificate is reused while it's still valid
+	_, _, err = SelfSigned(dir)
+	require.NoError(t, err)
+	pair2, err := tls.LoadX509KeyPair(certPath, keyPath)
+	require.NoError(t, err)
+	require.Equal(t, pair.Certificate[0], pair2.Certificate[0])
+}
@@ -3,6 +3,7 @@ package console
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"sync"
@@ -19,7 +20,9 @@ type Console struct {
 	Color     bool
 	IsMachine bool
 	Level     Level
-	mu        sync.Mutex
+	// Out is where messages are written. It defaults to standard error.
+	Out io.Writer
+	mu  sync.Mutex
 }
 
 // Debug prints a verbose debugging message, that is not displayed by default to the user.
@@ -107,6 +110,14 @@ func (c *Console) log(level Level, msg string) {
 			line = aurora.Faint(line).String()
 		}
 		line = prompt + line
-		fmt.Fprintln(os.Stderr, line)
+		fmt.Fprintln(c.Writer(), line)
 	}
 }
+
+// Writer returns where messages are written, for the output of subcommands that is messaging
+func (c *Console) Writer() io.Writer {
+	if c.Out == nil {
+		return os.Stderr
+	}
+	return c.Out
+}
@@ -1,6 +1,7 @@
 package console
 
 import (
+	"io"
 	"os"
 
 	"github.com/mattn/go-isatty"
@@ -23,6 +24,18 @@ func SetColor(color bool) {
 	ConsoleInstance.Color = color
 }
 
+// SetOutput sets where messages are written, instead of standard error
+func SetOutput(w io.Writer) {
+	ConsoleInstance.mu.Lock()
+	defer ConsoleInstance.mu.Unlock()
+	ConsoleInstance.Out = w
+}
+
+// Writer returns where messages are written
+func Writer() io.Writer {
+	return ConsoleInstance.Writer()
+}
+
 // Debug level message.
 func Debug(msg string) {
 	ConsoleInstance.Debug(msg)
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package files
+
+import "golang.org/x/sys/unix"
+
+func IsExecutable(path string) bool {
+	return unix.Access(path, unix.X_OK) == nil
+}
+
+// CheckWritable returns an error if path, a file or directory, can't be written to
+func CheckWritable(path string) error {
+	return unix.Access(path, unix.W_OK)
+}
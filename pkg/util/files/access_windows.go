@@ -0,0 +1,37 @@
+package files
+
+import (
+	"fmt"
+	"os"
+)
+
+// IsExecutable returns whether path is a file that Windows can run. Windows doesn't have an executable permission, so
+// this goes by its extension.
+func IsExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	return hasExecutableExtension(path, os.Getenv("PATHEXT"))
+}
+
+// CheckWritable returns an error if path, a file or directory, can't be written to. Windows doesn't have an access()
+// call, so this checks whether a file is read-only, and whether a file can be created in a directory.
+func CheckWritable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		if info.Mode().Perm()&0o200 == 0 {
+			return fmt.Errorf("%s is read-only", path)
+		}
+		return nil
+	}
+	f, err := os.CreateTemp(path, ".cog-write-check-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
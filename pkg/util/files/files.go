@@ -3,9 +3,10 @@ package files
 import (
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-
-	"golang.org/x/sys/unix"
+	"path/filepath"
+	"strings"
 )
 
 func Exists(path string) (bool, error) {
@@ -26,8 +27,22 @@ func IsDir(path string) (bool, error) {
 	return file.Mode().IsDir(), nil
 }
 
-func IsExecutable(path string) bool {
-	return unix.Access(path, unix.X_OK) == nil
+// hasExecutableExtension returns whether path has one of the extensions in pathext, a list like Windows' PATHEXT
+// environment variable, which is how Windows decides what's executable
+func hasExecutableExtension(path string, pathext string) bool {
+	if pathext == "" {
+		pathext = ".com;.exe;.bat;.cmd"
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == "" {
+		return false
+	}
+	for _, e := range strings.Split(strings.ToLower(pathext), ";") {
+		if e == ext {
+			return true
+		}
+	}
+	return false
 }
 
 func CopyFile(src string, dest string) error {
@@ -49,3 +64,21 @@ func CopyFile(src string, dest string) error {
 	}
 	return out.Close()
 }
+
+// CopyDir copies a directory and everything in it to dest
+func CopyDir(src string, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		return CopyFile(path, target)
+	})
+}
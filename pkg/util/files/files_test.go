@@ -3,12 +3,16 @@ package files
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
 func TestIsExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows doesn't have an executable permission")
+	}
 	dir := t.TempDir()
 	path := filepath.Join(dir, "test-file")
 	err := os.WriteFile(path, []byte{}, 0o644)
@@ -18,3 +22,33 @@ func TestIsExecutable(t *testing.T) {
 	require.NoError(t, os.Chmod(path, 0o744))
 	require.True(t, IsExecutable(path))
 }
+
+func TestHasExecutableExtension(t *testing.T) {
+	for _, tt := range []struct {
+		path     string
+		pathext  string
+		expected bool
+	}{
+		{`C:\Users\alice\run.exe`, "", true},
+		{`C:\Users\alice\run.BAT`, "", true},
+		{`C:\Users\alice\run`, "", false},
+		{`C:\Users\alice\run.sh`, "", false},
+		{`C:\Users\alice\run.ps1`, ".COM;.EXE;.PS1", true},
+		{`C:\Users\alice\run.bat`, ".COM;.EXE;.PS1", false},
+	} {
+		require.Equal(t, tt.expected, hasExecutableExtension(tt.path, tt.pathext), tt.path)
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "weights"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "MLmodel"), []byte("flavors: {}\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "weights", "model.pkl"), []byte("pickle"), 0o644))
+
+	dest := filepath.Join(t.TempDir(), "model")
+	require.NoError(t, CopyDir(src, dest))
+	contents, err := os.ReadFile(filepath.Join(dest, "weights", "model.pkl"))
+	require.NoError(t, err)
+	require.Equal(t, "pickle", string(contents))
+}
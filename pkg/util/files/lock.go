@@ -0,0 +1,94 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockPollInterval is how often LockFile checks whether another process has unlocked a file
+const lockPollInterval = 100 * time.Millisecond
+
+// Lock is an advisory lock on a file. Processes that lock the same file wait for each other, so they can take turns
+// with the files it protects. It's unlocked if the process exits without unlocking it.
+type Lock struct {
+	file *os.File
+}
+
+// TryLock locks the file at path, creating it if it doesn't exist. It returns nil, without waiting, if another
+// process has it locked.
+func TryLock(path string) (*Lock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("Failed to lock %s: %w", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to lock %s: %w", path, err)
+	}
+	locked, err := tryLockFile(file)
+	if err != nil || !locked {
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to lock %s: %w", path, err)
+		}
+		return nil, nil
+	}
+	return &Lock{file: file}, nil
+}
+
+// LockFile locks the file at path, waiting for other processes to unlock it, or until ctx is done. If it has to
+// wait, it calls waiting first, so the user can be told why nothing's happening.
+func LockFile(ctx context.Context, path string, waiting func()) (*Lock, error) {
+	lock, err := TryLock(path)
+	if lock != nil || err != nil {
+		return lock, err
+	}
+	if waiting != nil {
+		waiting()
+	}
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+			lock, err := TryLock(path)
+			if lock != nil || err != nil {
+				return lock, err
+			}
+		}
+	}
+}
+
+// Unlock unlocks the file, so other processes can lock it
+func (l *Lock) Unlock() error {
+	err := unlockFile(l.file)
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// WriteFileAtomic writes data to a file like os.WriteFile, but readers see either the old contents or the new
+// contents, never a partly written file
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
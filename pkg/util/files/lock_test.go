@@ -0,0 +1,75 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".cog", "tmp", "state.lock")
+
+	lock, err := TryLock(path)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+
+	// Locks on separate open files conflict, even in the same process
+	other, err := TryLock(path)
+	require.NoError(t, err)
+	require.Nil(t, other)
+
+	require.NoError(t, lock.Unlock())
+	other, err = TryLock(path)
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	require.NoError(t, other.Unlock())
+}
+
+func TestLockFileWaits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.lock")
+	lock, err := TryLock(path)
+	require.NoError(t, err)
+
+	waited := make(chan struct{})
+	go func() {
+		<-waited
+		time.Sleep(2 * lockPollInterval)
+		require.NoError(t, lock.Unlock())
+	}()
+	other, err := LockFile(context.Background(), path, func() { close(waited) })
+	require.NoError(t, err)
+	require.NotNil(t, other)
+	require.NoError(t, other.Unlock())
+}
+
+func TestLockFileCanceled(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.lock")
+	lock, err := TryLock(path)
+	require.NoError(t, err)
+	defer lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*lockPollInterval)
+	defer cancel()
+	_, err = LockFile(ctx, path, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "build_manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte("old"), 0o644))
+
+	require.NoError(t, WriteFileAtomic(path, []byte("new"), 0o644))
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "new", string(contents))
+
+	// The temporary file is renamed over it, so nothing's left behind
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
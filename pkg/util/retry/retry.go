@@ -0,0 +1,72 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/replicate/cog/pkg/util/console"
+)
+
+// Backoff is how many times to try something, and how long to wait between tries. The wait starts at Initial and
+// doubles each time, up to Max.
+type Backoff struct {
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+// DefaultBackoff tries 5 times over about a minute, which rides out most dropped connections and registry blips
+var DefaultBackoff = Backoff{Attempts: 5, Initial: 2 * time.Second, Max: 30 * time.Second}
+
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// Retryable marks err as temporary, like a dropped connection, so Do tries again
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &retryableError{err: err}
+}
+
+// IsRetryable returns whether err was marked with Retryable
+func IsRetryable(err error) bool {
+	var rerr *retryableError
+	return errors.As(err, &rerr)
+}
+
+// Do calls fn until it succeeds, it returns an error that isn't retryable, it has been called b.Attempts times, or
+// ctx is canceled. It returns fn's last error.
+func Do(ctx context.Context, b Backoff, fn func() error) error {
+	delay := b.Initial
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !IsRetryable(err) || attempt >= b.Attempts {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Jitter, so parallel retries don't all hit the server at once
+		wait := delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1)) //#nosec G404
+		console.Warnf("%s. Retrying in %s (attempt %d of %d)...", err, wait.Round(time.Second), attempt+1, b.Attempts)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		delay = min(delay*2, b.Max)
+	}
+}
@@ -0,0 +1,53 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testBackoff = Backoff{Attempts: 3, Initial: time.Millisecond, Max: time.Millisecond}
+
+func TestDo(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		errs     []error
+		calls    int
+		expected error
+	}{
+		{"succeeds", []error{nil}, 1, nil},
+		{"retries temporary errors", []error{Retryable(errors.New("reset")), nil}, 2, nil},
+		{"gives up after attempts", []error{Retryable(errors.New("reset")), Retryable(errors.New("reset")), Retryable(errors.New("timeout"))}, 3, errors.New("timeout")},
+		{"doesn't retry other errors", []error{errors.New("denied")}, 1, errors.New("denied")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := Do(context.Background(), testBackoff, func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			require.Equal(t, tt.calls, calls)
+			if tt.expected == nil {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tt.expected.Error())
+			}
+		})
+	}
+}
+
+func TestDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := Do(ctx, Backoff{Attempts: 5, Initial: time.Hour, Max: time.Hour}, func() error {
+		calls++
+		cancel()
+		return Retryable(errors.New("reset"))
+	})
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 1, calls)
+}
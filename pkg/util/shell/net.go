@@ -55,3 +55,13 @@ func PortIsOpen(port int) bool {
 	}
 	return err == nil
 }
+
+// FreePort asks the kernel for a free TCP port on localhost
+func FreePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
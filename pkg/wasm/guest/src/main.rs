@@ -0,0 +1,73 @@
+//! Runs an ONNX model with wasi-nn. It reads the inputs from stdin as JSON, like {"input": [0.1, 0.2, ...]}, with
+//! each tensor flattened, and writes the outputs to stdout the same way. The model and the shapes of its tensors
+//! are in cog-wasm.json, in the directory it's run in.
+
+use std::collections::HashMap;
+use std::error::Error;
+use std::io::Read;
+
+use serde::Deserialize;
+
+const MANIFEST_FILE: &str = "cog-wasm.json";
+
+#[derive(Deserialize)]
+struct Tensor {
+    name: String,
+    shape: Vec<usize>,
+}
+
+impl Tensor {
+    fn size(&self) -> usize {
+        self.shape.iter().product()
+    }
+}
+
+#[derive(Deserialize)]
+struct Manifest {
+    model: String,
+    inputs: Vec<Tensor>,
+    outputs: Vec<Tensor>,
+}
+
+fn main() {
+    if let Err(err) = run() {
+        eprintln!("{err}");
+        std::process::exit(1);
+    }
+}
+
+fn run() -> Result<(), Box<dyn Error>> {
+    let manifest: Manifest = serde_json::from_slice(&std::fs::read(MANIFEST_FILE)?)
+        .map_err(|err| format!("Failed to read {MANIFEST_FILE}: {err}"))?;
+    let model = std::fs::read(&manifest.model)
+        .map_err(|err| format!("Failed to read {}: {err}", manifest.model))?;
+
+    let mut request = String::new();
+    std::io::stdin().read_to_string(&mut request)?;
+    let inputs: HashMap<String, Vec<f32>> =
+        serde_json::from_str(&request).map_err(|err| format!("Failed to read the inputs: {err}"))?;
+
+    let graph = wasi_nn::GraphBuilder::new(wasi_nn::GraphEncoding::Onnx, wasi_nn::ExecutionTarget::CPU)
+        .build_from_bytes([&model])?;
+    let mut context = graph.init_execution_context()?;
+    for (index, tensor) in manifest.inputs.iter().enumerate() {
+        let data = inputs
+            .get(&tensor.name)
+            .ok_or_else(|| format!("Missing input {}", tensor.name))?;
+        if data.len() != tensor.size() {
+            return Err(format!("Input {} has {} values, expected {}", tensor.name, data.len(), tensor.size()).into());
+        }
+        context.set_input(index, wasi_nn::TensorType::F32, &tensor.shape, data.as_slice())?;
+    }
+    context.compute()?;
+
+    let mut outputs = HashMap::new();
+    for (index, tensor) in manifest.outputs.iter().enumerate() {
+        let mut data = vec![0f32; tensor.size()];
+        context.get_output(index, data.as_mut_slice())?;
+        outputs.insert(tensor.name.as_str(), data);
+    }
+    serde_json::to_writer(std::io::stdout(), &outputs)?;
+    println!();
+    Ok(())
+}
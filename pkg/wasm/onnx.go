@@ -0,0 +1,218 @@
+package wasm
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Field numbers in ONNX's protobuf messages, from onnx.proto
+const (
+	modelGraph = 7
+
+	graphInitializer = 5
+	graphInput       = 11
+	graphOutput      = 12
+
+	tensorName = 8
+
+	valueInfoName = 1
+	valueInfoType = 2
+
+	typeTensorType = 1
+
+	tensorTypeElemType = 1
+	tensorTypeShape    = 2
+
+	shapeDim = 1
+
+	dimValue = 1
+	dimParam = 2
+)
+
+// elemTypes are the names of ONNX's tensor element types
+var elemTypes = map[uint64]string{
+	1:  "float32",
+	2:  "uint8",
+	3:  "int8",
+	4:  "uint16",
+	5:  "int16",
+	6:  "int32",
+	7:  "int64",
+	8:  "string",
+	9:  "bool",
+	10: "float16",
+	11: "float64",
+	12: "uint32",
+	13: "uint64",
+	16: "bfloat16",
+}
+
+// Dim is a dimension of a tensor in an ONNX model. Param is the name of a dimension that's set when the model is run,
+// like "batch_size", and Value is 0 if it's set.
+type Dim struct {
+	Value int64
+	Param string
+}
+
+// ModelTensor is an input or output of an ONNX model
+type ModelTensor struct {
+	Name string
+	Type string
+	Dims []Dim
+}
+
+// ReadModel returns the inputs and outputs of an ONNX model. Weights that older models list as inputs aren't
+// included.
+func ReadModel(data []byte) (inputs, outputs []ModelTensor, err error) {
+	graph, err := field(data, modelGraph)
+	if err != nil {
+		return nil, nil, err
+	}
+	if graph == nil {
+		return nil, nil, fmt.Errorf("It isn't an ONNX model, or it has no graph")
+	}
+
+	initializers := map[string]bool{}
+	err = walk(graph, func(num protowire.Number, value []byte) error {
+		if num == graphInitializer {
+			name, err := field(value, tensorName)
+			if err != nil {
+				return err
+			}
+			initializers[string(name)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inputs, outputs = []ModelTensor{}, []ModelTensor{}
+	err = walk(graph, func(num protowire.Number, value []byte) error {
+		if num != graphInput && num != graphOutput {
+			return nil
+		}
+		tensor, err := readValueInfo(value)
+		if err != nil {
+			return err
+		}
+		if num == graphOutput {
+			outputs = append(outputs, tensor)
+		} else if !initializers[tensor.Name] {
+			inputs = append(inputs, tensor)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return inputs, outputs, nil
+}
+
+func readValueInfo(data []byte) (ModelTensor, error) {
+	tensor := ModelTensor{}
+	name, err := field(data, valueInfoName)
+	if err != nil {
+		return tensor, err
+	}
+	tensor.Name = string(name)
+	typeProto, err := field(data, valueInfoType)
+	if err != nil {
+		return tensor, err
+	}
+	tensorType, err := field(typeProto, typeTensorType)
+	if err != nil {
+		return tensor, err
+	}
+	if tensorType == nil {
+		return tensor, fmt.Errorf("%s isn't a tensor", tensor.Name)
+	}
+	err = walkAll(tensorType, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch {
+		case num == tensorTypeElemType && typ == protowire.VarintType:
+			tensor.Type = elemTypes[varint]
+			if tensor.Type == "" {
+				tensor.Type = fmt.Sprintf("type %d", varint)
+			}
+		case num == tensorTypeShape && typ == protowire.BytesType:
+			return walk(value, func(num protowire.Number, dim []byte) error {
+				if num == shapeDim {
+					d, err := readDim(dim)
+					if err != nil {
+						return err
+					}
+					tensor.Dims = append(tensor.Dims, d)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return tensor, err
+}
+
+func readDim(data []byte) (Dim, error) {
+	dim := Dim{}
+	err := walkAll(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch {
+		case num == dimValue && typ == protowire.VarintType:
+			dim.Value = int64(varint)
+		case num == dimParam && typ == protowire.BytesType:
+			dim.Param = string(value)
+		}
+		return nil
+	})
+	return dim, err
+}
+
+// field returns the last value of a length-delimited field in a message, like protobuf does, or nil if it isn't set
+func field(data []byte, want protowire.Number) ([]byte, error) {
+	var found []byte
+	err := walk(data, func(num protowire.Number, value []byte) error {
+		if num == want {
+			found = value
+		}
+		return nil
+	})
+	return found, err
+}
+
+// walk calls fn with each length-delimited field in a message
+func walk(data []byte, fn func(num protowire.Number, value []byte) error) error {
+	return walkAll(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		return fn(num, value)
+	})
+}
+
+// walkAll calls fn with each field in a message, with its value if it's length-delimited or varint if it's a varint
+func walkAll(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("Failed to read ONNX model: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+		}
+		if n < 0 {
+			return fmt.Errorf("Failed to read ONNX model: %w", protowire.ParseError(n))
+		}
+		data = data[n:]
+		if err := fn(num, typ, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Package wasm exports ONNX models to WebAssembly bundles, which run the model with wasi-nn in runtimes like
+// wasmtime. It's experimental, and only for small models whose inputs and outputs are float32 tensors.
+package wasm
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/replicate/cog/pkg/docker"
+)
+
+//go:embed guest
+var guest embed.FS
+
+// The files in a bundle
+const (
+	ManifestFile = "cog-wasm.json"
+	ModuleFile   = "model.wasm"
+	ModelFile    = "model.onnx"
+)
+
+// guestDockerfile builds the module that runs the model, which is in the guest directory
+const guestDockerfile = `FROM rust:1.82-slim AS build
+RUN rustup target add wasm32-wasip1
+WORKDIR /guest
+COPY . .
+RUN cargo build --release --target wasm32-wasip1
+
+FROM scratch
+COPY --from=build /guest/target/wasm32-wasip1/release/cog-wasm.wasm /` + ModuleFile + `
+`
+
+// Tensor is an input or output of the model in a bundle, with its shape
+type Tensor struct {
+	Name  string  `json:"name"`
+	Type  string  `json:"type"`
+	Shape []int64 `json:"shape"`
+}
+
+// Manifest describes a bundle. The module reads it to find the model and the shapes of its tensors.
+type Manifest struct {
+	Model   string   `json:"model"`
+	Module  string   `json:"module"`
+	Inputs  []Tensor `json:"inputs"`
+	Outputs []Tensor `json:"outputs"`
+}
+
+// NewManifest returns the manifest for an ONNX model. shapes sets the shapes of tensors whose dimensions are set
+// when the model is run, like the batch size, by name. Outputs with the same named dimensions as the inputs get the
+// same sizes.
+func NewManifest(model []byte, shapes map[string][]int64) (*Manifest, error) {
+	modelInputs, modelOutputs, err := ReadModel(model)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{Model: ModelFile, Module: ModuleFile, Inputs: []Tensor{}, Outputs: []Tensor{}}
+	params := map[string]int64{}
+	for _, input := range modelInputs {
+		tensor, err := resolve(input, shapes, params)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Inputs = append(manifest.Inputs, tensor)
+	}
+	for _, output := range modelOutputs {
+		tensor, err := resolve(output, shapes, params)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Outputs = append(manifest.Outputs, tensor)
+	}
+	for name := range shapes {
+		if !manifest.hasTensor(name) {
+			return nil, fmt.Errorf("The model has no input or output called %s", name)
+		}
+	}
+	return manifest, nil
+}
+
+// resolve returns the shape of a tensor, from shapes if it's in there, or from its dimensions in the model. It adds
+// the sizes of named dimensions it finds to params, and uses them for dimensions with the same name.
+func resolve(t ModelTensor, shapes map[string][]int64, params map[string]int64) (Tensor, error) {
+	tensor := Tensor{Name: t.Name, Type: t.Type, Shape: []int64{}}
+	if t.Type != "float32" {
+		return tensor, fmt.Errorf("%s is a tensor of %s values, but only float32 tensors are supported", t.Name, t.Type)
+	}
+	shape, ok := shapes[t.Name]
+	if ok && len(shape) != len(t.Dims) {
+		return tensor, fmt.Errorf("%s has %d dimensions, but --shape has %d", t.Name, len(t.Dims), len(shape))
+	}
+	for i, dim := range t.Dims {
+		switch {
+		case ok:
+			if dim.Value > 0 && dim.Value != shape[i] {
+				return tensor, fmt.Errorf("Dimension %d of %s is %d in the model, but --shape sets it to %d", i, t.Name, dim.Value, shape[i])
+			}
+			if dim.Param != "" {
+				params[dim.Param] = shape[i]
+			}
+			tensor.Shape = append(tensor.Shape, shape[i])
+		case dim.Value > 0:
+			tensor.Shape = append(tensor.Shape, dim.Value)
+		case dim.Param != "" && params[dim.Param] > 0:
+			tensor.Shape = append(tensor.Shape, params[dim.Param])
+		default:
+			return tensor, fmt.Errorf("The size of dimension %d of %s is set when the model is run. Set the shape of %s with --shape %s=%s", i, t.Name, t.Name, t.Name, exampleShape(t.Dims))
+		}
+	}
+	return tensor, nil
+}
+
+// exampleShape returns a shape for --shape, with 1 for dimensions that are set when the model is run
+func exampleShape(dims []Dim) string {
+	parts := []string{}
+	for _, dim := range dims {
+		size := dim.Value
+		if size <= 0 {
+			size = 1
+		}
+		parts = append(parts, fmt.Sprint(size))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (m *Manifest) hasTensor(name string) bool {
+	for _, tensor := range append(append([]Tensor{}, m.Inputs...), m.Outputs...) {
+		if tensor.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Export writes a bundle for the ONNX model at modelPath to dir: the model, the module that runs it, which is built
+// with Docker, and the manifest.
+func Export(ctx context.Context, modelPath string, dir string, shapes map[string][]int64, progressOutput string) (*Manifest, error) {
+	model, err := os.ReadFile(modelPath)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", modelPath, err)
+	}
+	manifest, err := NewManifest(model, shapes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read %s: %w", modelPath, err)
+	}
+
+	guestDir, err := os.MkdirTemp("", "cog-wasm-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(guestDir)
+	guestFiles, err := fs.Sub(guest, "guest")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.CopyFS(guestDir, guestFiles); err != nil {
+		return nil, fmt.Errorf("Failed to write the module's source: %w", err)
+	}
+	if err := docker.BuildFiles(ctx, guestDir, guestDockerfile, dir, progressOutput); err != nil {
+		return nil, fmt.Errorf("Failed to build the module: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, ModelFile), model, 0o644); err != nil { //#nosec G306
+		return nil, fmt.Errorf("Failed to write %s: %w", ModelFile, err)
+	}
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFile), append(manifestJSON, '\n'), 0o644); err != nil { //#nosec G306
+		return nil, fmt.Errorf("Failed to write %s: %w", ManifestFile, err)
+	}
+	return manifest, nil
+}
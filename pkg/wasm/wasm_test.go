@@ -0,0 +1,94 @@
+package wasm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func message(fields ...[]byte) []byte {
+	b := []byte{}
+	for _, f := range fields {
+		b = append(b, f...)
+	}
+	return b
+}
+
+func bytesField(num protowire.Number, value []byte) []byte {
+	b := protowire.AppendTag(nil, num, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+func varintField(num protowire.Number, value uint64) []byte {
+	b := protowire.AppendTag(nil, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+// valueInfo returns an ONNX ValueInfoProto for a tensor. Dimensions are sizes, or names if they're strings.
+func valueInfo(name string, elemType uint64, dims ...any) []byte {
+	shape := []byte{}
+	for _, d := range dims {
+		switch d := d.(type) {
+		case int:
+			shape = append(shape, bytesField(shapeDim, varintField(dimValue, uint64(d)))...)
+		case string:
+			shape = append(shape, bytesField(shapeDim, bytesField(dimParam, []byte(d)))...)
+		}
+	}
+	tensorType := message(varintField(tensorTypeElemType, elemType), bytesField(tensorTypeShape, shape))
+	return message(bytesField(valueInfoName, []byte(name)), bytesField(valueInfoType, bytesField(typeTensorType, tensorType)))
+}
+
+func model(inputs [][]byte, outputs [][]byte, initializers ...string) []byte {
+	graph := []byte{}
+	for _, name := range initializers {
+		graph = append(graph, bytesField(graphInitializer, bytesField(tensorName, []byte(name)))...)
+	}
+	for _, input := range inputs {
+		graph = append(graph, bytesField(graphInput, input)...)
+	}
+	for _, output := range outputs {
+		graph = append(graph, bytesField(graphOutput, output)...)
+	}
+	// ir_version and the graph, like a real model
+	return message(varintField(1, 8), bytesField(modelGraph, graph))
+}
+
+func TestReadModel(t *testing.T) {
+	inputs, outputs, err := ReadModel(model(
+		[][]byte{valueInfo("pixels", 1, "batch", 3, 224, 224), valueInfo("fc.weight", 1, 1000, 512)},
+		[][]byte{valueInfo("logits", 1, "batch", 1000)},
+		"fc.weight",
+	))
+	require.NoError(t, err)
+	require.Equal(t, []ModelTensor{{Name: "pixels", Type: "float32", Dims: []Dim{{Param: "batch"}, {Value: 3}, {Value: 224}, {Value: 224}}}}, inputs)
+	require.Equal(t, []ModelTensor{{Name: "logits", Type: "float32", Dims: []Dim{{Param: "batch"}, {Value: 1000}}}}, outputs)
+
+	_, _, err = ReadModel([]byte("not a model"))
+	require.Error(t, err)
+}
+
+func TestNewManifest(t *testing.T) {
+	onnx := model([][]byte{valueInfo("pixels", 1, "batch", 3, 224, 224)}, [][]byte{valueInfo("logits", 1, "batch", 1000)})
+
+	_, err := NewManifest(onnx, nil)
+	require.ErrorContains(t, err, "Set the shape of pixels with --shape pixels=1,3,224,224")
+
+	manifest, err := NewManifest(onnx, map[string][]int64{"pixels": {2, 3, 224, 224}})
+	require.NoError(t, err)
+	require.Equal(t, &Manifest{
+		Model:   ModelFile,
+		Module:  ModuleFile,
+		Inputs:  []Tensor{{Name: "pixels", Type: "float32", Shape: []int64{2, 3, 224, 224}}},
+		Outputs: []Tensor{{Name: "logits", Type: "float32", Shape: []int64{2, 1000}}},
+	}, manifest)
+
+	_, err = NewManifest(onnx, map[string][]int64{"pixels": {1, 1, 224, 224}})
+	require.ErrorContains(t, err, "Dimension 1 of pixels is 3 in the model")
+	_, err = NewManifest(onnx, map[string][]int64{"pixels": {1, 3, 224, 224}, "image": {1}})
+	require.ErrorContains(t, err, "no input or output called image")
+
+	_, err = NewManifest(model([][]byte{valueInfo("tokens", 7, 1, 128)}, nil), nil)
+	require.ErrorContains(t, err, "tokens is a tensor of int64 values, but only float32 tensors are supported")
+}
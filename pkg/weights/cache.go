@@ -0,0 +1,115 @@
+package weights
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheDirEnvVar overrides the directory weights are cached in, so every user on a host can share one cache, like
+// /var/cache/cog/weights
+const CacheDirEnvVar = "COG_WEIGHTS_CACHE"
+
+// CacheDir returns the directory weights are cached in: $COG_WEIGHTS_CACHE, or cog/huggingface in the user's cache
+// directory
+func CacheDir() (string, error) {
+	if dir := os.Getenv(CacheDirEnvVar); dir != "" {
+		return filepath.Abs(dir)
+	}
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "cog", "huggingface"), nil
+}
+
+// CachedRevision is the files of a repository at a commit in the weights cache
+type CachedRevision struct {
+	// Repo is the repository ID, like "stabilityai/sdxl-turbo"
+	Repo   string
+	Commit string
+	// Path is the directory the files are in
+	Path  string
+	Files int
+	Size  int64
+	// LastUsed is when the files were last downloaded, or mounted into a container
+	LastUsed time.Time
+}
+
+// ListCache returns the revisions in the weights cache in dir, sorted by repository and commit
+func ListCache(dir string) ([]CachedRevision, error) {
+	// The cache is laid out like <dir>/<org>/<repo>/<commit>/<file>
+	commits, err := filepath.Glob(filepath.Join(dir, "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	revisions := []CachedRevision{}
+	for _, path := range commits {
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() || !commitRegexp.MatchString(filepath.Base(path)) {
+			continue
+		}
+		repoDir := filepath.Dir(path)
+		revision := CachedRevision{
+			Repo:     filepath.Base(filepath.Dir(repoDir)) + "/" + filepath.Base(repoDir),
+			Commit:   filepath.Base(path),
+			Path:     path,
+			LastUsed: info.ModTime(),
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			// Downloads in progress aren't in the cache yet
+			if d.IsDir() || strings.HasSuffix(d.Name(), ".incomplete") {
+				return nil
+			}
+			fileInfo, err := d.Info()
+			if err != nil {
+				return err
+			}
+			revision.Files++
+			revision.Size += fileInfo.Size()
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		if revisions[i].Repo != revisions[j].Repo {
+			return revisions[i].Repo < revisions[j].Repo
+		}
+		return revisions[i].Commit < revisions[j].Commit
+	})
+	return revisions, nil
+}
+
+// TouchCached records that a revision in the cache was used now, so pruning the cache keeps it
+func TouchCached(path string) error {
+	now := time.Now()
+	return os.Chtimes(path, now, now)
+}
+
+// RemoveCached removes a revision from the cache in dir, and the directories of its repository if it was the last
+// revision in them
+func RemoveCached(dir string, revision CachedRevision) error {
+	if err := os.RemoveAll(revision.Path); err != nil {
+		return err
+	}
+	for parent := filepath.Dir(revision.Path); parent != dir && strings.HasPrefix(parent, dir); parent = filepath.Dir(parent) {
+		// Remove fails if the directory isn't empty
+		if err := os.Remove(parent); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package weights
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheDir(t *testing.T) {
+	t.Setenv(CacheDirEnvVar, "/var/cache/cog/weights")
+	dir, err := CacheDir()
+	require.NoError(t, err)
+	require.Equal(t, "/var/cache/cog/weights", dir)
+
+	t.Setenv(CacheDirEnvVar, "")
+	t.Setenv("XDG_CACHE_HOME", "/home/alice/.cache")
+	dir, err = CacheDir()
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("/home/alice/.cache", "cog", "huggingface"), dir)
+}
+
+func TestListCache(t *testing.T) {
+	dir := t.TempDir()
+	hf := &HuggingFace{CacheDir: dir}
+	otherCommit := "fedcba9876543210fedcba9876543210fedcba98"
+	for path, contents := range map[string]string{
+		hf.CachePath("org/repo", testCommit, "unet/model.safetensors"):          "weights",
+		hf.CachePath("org/repo", testCommit, "config.json"):                     "{}",
+		hf.CachePath("org/repo", testCommit, "vae.safetensors.1234.incomplete"): "partial",
+		hf.CachePath("org/other", otherCommit, "model.bin"):                     "model",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0o644))
+	}
+	used := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(hf.CachePath("org/repo", testCommit, ""), used, used))
+
+	revisions, err := ListCache(dir)
+	require.NoError(t, err)
+	require.Len(t, revisions, 2)
+	require.Equal(t, CachedRevision{Repo: "org/other", Commit: otherCommit, Path: hf.CachePath("org/other", otherCommit, ""), Files: 1, Size: 5, LastUsed: revisions[0].LastUsed}, revisions[0])
+	require.Equal(t, CachedRevision{Repo: "org/repo", Commit: testCommit, Path: hf.CachePath("org/repo", testCommit, ""), Files: 2, Size: 9, LastUsed: revisions[1].LastUsed}, revisions[1])
+	require.True(t, revisions[1].LastUsed.Equal(used))
+
+	require.NoError(t, TouchCached(revisions[1].Path))
+	info, err := os.Stat(revisions[1].Path)
+	require.NoError(t, err)
+	require.True(t, info.ModTime().After(used))
+
+	require.NoError(t, RemoveCached(dir, revisions[0]))
+	_, err = os.Stat(filepath.Join(dir, "org", "other"))
+	require.True(t, os.IsNotExist(err))
+	revisions, err = ListCache(dir)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	require.Equal(t, "org/repo", revisions[0].Repo)
+}
+
+func TestListCacheMissing(t *testing.T) {
+	revisions, err := ListCache(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	require.Empty(t, revisions)
+}
@@ -0,0 +1,222 @@
+package weights
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+const HuggingFaceScheme = "hf://"
+
+const defaultHuggingFaceEndpoint = "https://huggingface.co"
+
+var huggingFaceRepoRegexp = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*/[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// HuggingFaceRepo is a model repository on the Hugging Face Hub at a revision
+type HuggingFaceRepo struct {
+	// Repo is the repository ID, like "stabilityai/sdxl-turbo"
+	Repo string
+	// Revision is a branch, tag or commit. Defaults to "main".
+	Revision string
+}
+
+// ParseHuggingFaceURL parses a URL like hf://stabilityai/sdxl-turbo@main
+func ParseHuggingFaceURL(s string) (*HuggingFaceRepo, error) {
+	rest, ok := strings.CutPrefix(s, HuggingFaceScheme)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported weights source %q, expected hf://<org>/<repo>[@<revision>]", s)
+	}
+	repo, revision, hasRevision := strings.Cut(rest, "@")
+	if !huggingFaceRepoRegexp.MatchString(repo) {
+		return nil, fmt.Errorf("Invalid Hugging Face repository %q in %q, expected <org>/<repo>", repo, s)
+	}
+	if hasRevision && revision == "" {
+		return nil, fmt.Errorf("Invalid weights source %q, the revision after @ is empty", s)
+	}
+	if revision == "" {
+		revision = "main"
+	}
+	return &HuggingFaceRepo{Repo: repo, Revision: revision}, nil
+}
+
+// IsPinned returns whether the revision is a commit, so it always refers to the same files
+func (r *HuggingFaceRepo) IsPinned() bool {
+	return commitRegexp.MatchString(r.Revision)
+}
+
+// HuggingFace downloads files from the Hugging Face Hub, and caches them so they're only downloaded once
+type HuggingFace struct {
+	Endpoint string
+	Token    string
+	CacheDir string
+	Client   *http.Client
+}
+
+// NewHuggingFace returns a client configured like the huggingface_hub library: the token is read from HF_TOKEN or
+// the file `huggingface-cli login` saves it in, and HF_ENDPOINT overrides the Hub's URL
+func NewHuggingFace(cacheDir string) (*HuggingFace, error) {
+	endpoint := os.Getenv("HF_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultHuggingFaceEndpoint
+	}
+	token, err := huggingFaceToken()
+	if err != nil {
+		return nil, err
+	}
+	return &HuggingFace{
+		Endpoint: strings.TrimRight(endpoint, "/"),
+		Token:    token,
+		CacheDir: cacheDir,
+		// Weights can take a long time to download, so there's no timeout
+		Client: &http.Client{},
+	}, nil
+}
+
+func huggingFaceToken() (string, error) {
+	if token := os.Getenv("HF_TOKEN"); token != "" {
+		return token, nil
+	}
+	home := os.Getenv("HF_HOME")
+	if home == "" {
+		home = "~/.cache/huggingface"
+	}
+	path, err := homedir.Expand(filepath.Join(home, "token"))
+	if err != nil {
+		return "", err
+	}
+	token, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		// Public repositories don't need a token
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Failed to read Hugging Face token: %w", err)
+	}
+	return strings.TrimSpace(string(token)), nil
+}
+
+type huggingFaceModelInfo struct {
+	SHA      string `json:"sha"`
+	Siblings []struct {
+		RFilename string `json:"rfilename"`
+	} `json:"siblings"`
+}
+
+// Resolve returns the commit the repository's revision points to, and the files in the repository at that commit
+func (h *HuggingFace) Resolve(ctx context.Context, repo *HuggingFaceRepo) (commit string, files []string, err error) {
+	u := h.Endpoint + "/api/models/" + repo.Repo + "/revision/" + url.PathEscape(repo.Revision)
+	resp, err := h.get(ctx, u)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if err := h.checkResponse(resp, repo.Repo); err != nil {
+		return "", nil, err
+	}
+	info := huggingFaceModelInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", nil, fmt.Errorf("Failed to parse Hugging Face response: %w", err)
+	}
+	if info.SHA == "" {
+		return "", nil, fmt.Errorf("Hugging Face didn't return a commit for %s@%s", repo.Repo, repo.Revision)
+	}
+	for _, sibling := range info.Siblings {
+		files = append(files, sibling.RFilename)
+	}
+	return info.SHA, files, nil
+}
+
+// CachePath returns where a file in the repository at a commit is cached
+func (h *HuggingFace) CachePath(repo string, commit string, file string) string {
+	return filepath.Join(h.CacheDir, filepath.FromSlash(repo), commit, filepath.FromSlash(file))
+}
+
+// Download downloads a file in the repository at a commit, unless it's already cached, and returns its path in
+// the cache
+func (h *HuggingFace) Download(ctx context.Context, repo string, commit string, file string) (string, error) {
+	dest := h.CachePath(repo, commit, file)
+	if _, err := os.Stat(dest); err == nil {
+		return dest, nil
+	}
+
+	u := h.Endpoint + "/" + repo + "/resolve/" + commit + "/" + escapePath(file)
+	resp, err := h.get(ctx, u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := h.checkResponse(resp, repo); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", err
+	}
+	// Download to a temporary file, so an interrupted download isn't mistaken for a cached file
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.incomplete")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("Failed to download %s from %s: %w", file, repo, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return "", err
+	}
+	return dest, nil
+}
+
+func (h *HuggingFace) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(req)
+}
+
+func (h *HuggingFace) checkResponse(resp *http.Response, repo string) error {
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		if h.Token == "" {
+			return fmt.Errorf("Hugging Face denied access to %s. If it's private or gated, set HF_TOKEN or run 'huggingface-cli login'", repo)
+		}
+		return fmt.Errorf("Hugging Face denied access to %s. Check that your token can read it, and that you've accepted its terms if it's gated", repo)
+	case http.StatusNotFound:
+		return fmt.Errorf("%s or the revision doesn't exist on Hugging Face", repo)
+	default:
+		return fmt.Errorf("Hugging Face returned status %d for %s", resp.StatusCode, resp.Request.URL)
+	}
+}
+
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,87 @@
+package weights
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+func TestParseHuggingFaceURL(t *testing.T) {
+	testCases := []struct {
+		url         string
+		expected    *HuggingFaceRepo
+		expectedErr string
+	}{
+		{url: "hf://stabilityai/sdxl-turbo", expected: &HuggingFaceRepo{Repo: "stabilityai/sdxl-turbo", Revision: "main"}},
+		{url: "hf://stabilityai/sdxl-turbo@v1.0", expected: &HuggingFaceRepo{Repo: "stabilityai/sdxl-turbo", Revision: "v1.0"}},
+		{url: "hf://org/repo@refs/pr/1", expected: &HuggingFaceRepo{Repo: "org/repo", Revision: "refs/pr/1"}},
+		{url: "https://huggingface.co/org/repo", expectedErr: "Unsupported weights source"},
+		{url: "hf://repo", expectedErr: "expected <org>/<repo>"},
+		{url: "hf://org/repo@", expectedErr: "the revision after @ is empty"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			repo, err := ParseHuggingFaceURL(tc.url)
+			if tc.expectedErr != "" {
+				require.ErrorContains(t, err, tc.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, repo)
+		})
+	}
+
+	repo, err := ParseHuggingFaceURL("hf://org/repo@" + testCommit)
+	require.NoError(t, err)
+	require.True(t, repo.IsPinned())
+}
+
+func TestHuggingFace(t *testing.T) {
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer hf_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/models/org/repo/revision/main":
+			_, _ = w.Write([]byte(`{"sha": "` + testCommit + `", "siblings": [{"rfilename": "config.json"}, {"rfilename": "unet/model.safetensors"}]}`))
+		case "/org/repo/resolve/" + testCommit + "/unet/model.safetensors":
+			downloads++
+			_, _ = w.Write([]byte("weights"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	hf := &HuggingFace{Endpoint: server.URL, Token: "hf_test", CacheDir: t.TempDir()}
+
+	commit, files, err := hf.Resolve(context.Background(), &HuggingFaceRepo{Repo: "org/repo", Revision: "main"})
+	require.NoError(t, err)
+	require.Equal(t, testCommit, commit)
+	require.Equal(t, []string{"config.json", "unet/model.safetensors"}, files)
+
+	for i := 0; i < 2; i++ {
+		path, err := hf.Download(context.Background(), "org/repo", commit, "unet/model.safetensors")
+		require.NoError(t, err)
+		require.Equal(t, hf.CachePath("org/repo", commit, "unet/model.safetensors"), path)
+		contents, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "weights", string(contents))
+	}
+	require.Equal(t, 1, downloads, "the second download should be cached")
+
+	_, _, err = hf.Resolve(context.Background(), &HuggingFaceRepo{Repo: "org/missing", Revision: "main"})
+	require.ErrorContains(t, err, "org/missing or the revision doesn't exist on Hugging Face")
+
+	hf.Token = ""
+	_, _, err = hf.Resolve(context.Background(), &HuggingFaceRepo{Repo: "org/repo", Revision: "main"})
+	require.ErrorContains(t, err, "set HF_TOKEN or run 'huggingface-cli login'")
+}
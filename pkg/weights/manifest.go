@@ -8,7 +8,7 @@ import (
 	"hash/crc32"
 	"io"
 	"os"
-	"path"
+	"path/filepath"
 )
 
 // Manifest contains metadata about weights files in a model
@@ -48,7 +48,7 @@ func LoadManifest(filename string) (*Manifest, error) {
 
 // Save saves a manifest to a file
 func (m *Manifest) Save(filename string) error {
-	if err := os.MkdirAll(path.Dir(filename), 0o755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
 		return err
 	}
 
@@ -2,7 +2,9 @@ package weights
 
 import (
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 )
@@ -30,6 +32,8 @@ func FindWeights(fw FileWalker) ([]string, []string, error) {
 		if info.IsDir() {
 			return nil
 		}
+		// These paths end up in the Dockerfile, which needs forward slashes, even on Windows
+		path = filepath.ToSlash(path)
 		if isGitFile(path) {
 			return nil
 		}
@@ -101,14 +105,8 @@ func isCodeFile(path string) bool {
 }
 
 func isGitFile(path string) bool {
-	dir, _ := filepath.Split(path)
-	folders := strings.Split(filepath.Clean(dir), string(filepath.Separator))
-	for _, folder := range folders {
-		if folder == ".git" {
-			return true
-		}
-	}
-	return false
+	folders := strings.Split(path, "/")
+	return slices.Contains(folders[:len(folders)-1], ".git")
 }
 
 // filterDirsContainingCode filters out directories that contain code files.
@@ -141,7 +139,7 @@ func getDirsAndRootfiles(files []string) ([]string, []string) {
 	// for large model files in root directory, we should not add the "." to dirs
 	var rootFiles []string
 	for _, f := range files {
-		dir := filepath.Dir(f)
+		dir := path.Dir(f)
 		if dir == "." || dir == "/" {
 			rootFiles = append(rootFiles, f)
 			continue
@@ -157,8 +155,8 @@ func getDirsAndRootfiles(files []string) ([]string, []string) {
 
 func hasParent(dir string, dirs []string) bool {
 	for _, d := range dirs {
-		parent := d + string(filepath.Separator)
-		child := dir + string(filepath.Separator)
+		parent := d + "/"
+		child := dir + "/"
 		if strings.HasPrefix(child, parent) {
 			return true
 		}
@@ -0,0 +1,66 @@
+"""
+python -m cog.command.check_imports
+
+This imports the modules of the predictors in cog.yaml, without running their
+setup(), so that missing packages and syntax errors fail the build with a clear
+message, instead of the model's container when it starts.
+"""
+
+import os
+import sys
+import traceback
+from typing import List
+
+from ..config import Config
+from ..predictor import load_full_predictor_from_file
+
+
+def import_error(module_path: str) -> str:
+    """Import the module at module_path, and return why it failed, or "" if it didn't."""
+    module_name = os.path.basename(module_path).split(".py", 1)[0]
+    try:
+        load_full_predictor_from_file(module_path, module_name)
+    except ModuleNotFoundError as e:
+        package = (e.name or "").split(".", 1)[0]
+        return (
+            f"{module_path} imports {e.name}, which isn't installed. Add the "
+            f"package that {package} is in to build.python_packages or "
+            "build.python_requirements in cog.yaml."
+        )
+    except SyntaxError as e:
+        return f"{e.filename}:{e.lineno}: {e.msg}"
+    except ImportError as e:
+        if "cannot open shared object file" in str(e):
+            return (
+                f"Failed to import {module_path}: {e}. Add the system package "
+                "that has this library to build.system_packages in cog.yaml."
+            )
+        return f"Failed to import {module_path}:\n{traceback.format_exc()}"
+    except Exception:  # pylint: disable=broad-exception-caught
+        return f"Failed to import {module_path}:\n{traceback.format_exc()}"
+    return ""
+
+
+def check_imports(config: Config) -> List[str]:
+    """Import the modules of the predictors in config, and return the errors."""
+    errors = []
+    module_paths = []
+    for ref in (config.predictor_predict_ref, config.predictor_train_ref):
+        if not ref:
+            continue
+        module_path = ref.split(":", 1)[0]
+        if module_path in module_paths:
+            continue
+        module_paths.append(module_path)
+        error = import_error(module_path)
+        if error:
+            errors.append(error)
+    return errors
+
+
+if __name__ == "__main__":
+    import_errors = check_imports(Config())
+    for import_error_message in import_errors:
+        print(import_error_message, file=sys.stderr)
+    if import_errors:
+        sys.exit(1)
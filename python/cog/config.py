@@ -1,8 +1,9 @@
 import inspect
+import json
 import os
 import sys
 import uuid
-from typing import Any, Callable, Optional, Tuple, Type
+from typing import Any, Callable, Dict, List, Optional, Tuple, Type
 
 import structlog
 import yaml
@@ -10,6 +11,7 @@ from pydantic import BaseModel
 
 from .base_input import BaseInput
 from .base_predictor import BasePredictor
+from .downloads import parse_quantity
 from .code_xforms import load_module_from_string, strip_model_source_code
 from .env_property import env_property
 from .errors import ConfigDoesNotExist
@@ -34,7 +36,19 @@ COG_PREDICT_CODE_STRIP_ENV_VAR = "COG_PREDICT_CODE_STRIP"
 COG_TRAIN_CODE_STRIP_ENV_VAR = "COG_TRAIN_CODE_STRIP"
 COG_GPU_ENV_VAR = "COG_GPU"
 COG_MAX_CONCURRENCY_ENV_VAR = "COG_MAX_CONCURRENCY"
+COG_MAX_REQUEST_SIZE_ENV_VAR = "COG_MAX_REQUEST_SIZE"
+COG_METRICS_ENV_VAR = "COG_METRICS"
+COG_OUTPUT_ENV_VAR = "COG_OUTPUT"
+COG_OUTPUT_UPLOAD_URL_ENV_VAR = "COG_OUTPUT_UPLOAD_URL"
+COG_SETUP_TIMEOUT_ENV_VAR = "COG_SETUP_TIMEOUT"
+COG_PIPELINE_ENV_VAR = "COG_PIPELINE"
+# The predictor that runs the pipeline in cog.yaml, if it has one
+PIPELINE_PREDICTOR_REF = (
+    os.path.join(os.path.dirname(os.path.abspath(__file__)), "pipeline.py")
+    + ":Pipeline"
+)
 PREDICT_METHOD_NAME = "predict"
+DEFAULT_MAX_BATCH_LATENCY_MS = 10
 TRAIN_METHOD_NAME = "train"
 
 log = structlog.get_logger("cog.config")
@@ -88,6 +102,8 @@ class Config:
     @env_property(COG_PREDICT_TYPE_STUB_ENV_VAR)
     def predictor_predict_ref(self) -> Optional[str]:
         """Find the predictor ref for the predict mode."""
+        if self._cog_config.get("pipeline"):
+            return PIPELINE_PREDICTOR_REF
         return self._cog_config.get(str(Mode.PREDICT))
 
     @property
@@ -96,6 +112,32 @@ class Config:
         """Find the predictor ref for the train mode."""
         return self._cog_config.get(str(Mode.TRAIN))
 
+    @property
+    def pipeline(self) -> List[Dict[str, Any]]:
+        """
+        The steps of the pipeline in cog.yaml, if it has one. The server passes
+        them to the worker as JSON in COG_PIPELINE.
+        """
+        steps = os.environ.get(COG_PIPELINE_ENV_VAR)
+        if steps is not None:
+            return json.loads(steps)
+        return list(self._cog_config.get("pipeline") or [])
+
+    @property
+    def models(self) -> List[Dict[str, Any]]:
+        """The models, other than the one in predict, that the server loads when they're first used."""
+        return list(self._cog_config.get("models") or [])
+
+    @property
+    def model_limits(self) -> Dict[str, Any]:
+        """How many of the models in `models` the server keeps loaded at once."""
+        return self._cog_config.get("serve", {}).get("models") or {}
+
+    @property
+    def predict_methods(self) -> List[str]:
+        """The predictor's methods, other than predict(), that are served as their own endpoints."""
+        return list(self._cog_config.get("predict_methods") or [])
+
     @property
     @env_property(COG_GPU_ENV_VAR)
     def requires_gpu(self) -> bool:
@@ -108,6 +150,123 @@ class Config:
         """The maximum concurrency of predictions supported by this model. Defaults to 1."""
         return int(self._cog_config.get("concurrency", {}).get("max", 1))
 
+    @property
+    def max_batch_size(self) -> int:
+        """The most predictions that are run in one call to predict_batch(), or 1 if predictions aren't batched."""
+        return int((self._cog_config.get("batching") or {}).get("max_batch_size", 1))
+
+    @property
+    def max_batch_latency(self) -> float:
+        """The number of seconds to wait for more predictions to batch with the first one."""
+        batching = self._cog_config.get("batching") or {}
+        return float(batching.get("max_latency_ms", DEFAULT_MAX_BATCH_LATENCY_MS)) / 1000
+
+    @property
+    @env_property(COG_MAX_REQUEST_SIZE_ENV_VAR)
+    def max_request_size(self) -> Optional[int]:
+        """The largest request body the server accepts in bytes, or None if there's no limit."""
+        max_request_size = self._cog_config.get("serve", {}).get("max_request_size")
+        if not max_request_size:
+            return None
+        return parse_quantity(str(max_request_size))
+
+    @property
+    @env_property(COG_OUTPUT_ENV_VAR)
+    def output(self) -> str:
+        """Whether file outputs are returned "inline" as data URLs or "upload"ed by default."""
+        return str(self._cog_config.get("serve", {}).get("output", "inline"))
+
+    @property
+    @env_property(COG_OUTPUT_UPLOAD_URL_ENV_VAR)
+    def output_upload_url(self) -> Optional[str]:
+        """The URL to upload file outputs to, if one isn't passed on the command line."""
+        return self._cog_config.get("serve", {}).get("output_upload_url")
+
+    @property
+    @env_property(COG_SETUP_TIMEOUT_ENV_VAR)
+    def setup_timeout(self) -> Optional[float]:
+        """The number of seconds setup() may take before it fails, or None if there's no limit."""
+        setup_timeout = self._cog_config.get("serve", {}).get("setup_timeout")
+        if not setup_timeout:
+            return None
+        return float(setup_timeout)
+
+    @property
+    def auth(self) -> Dict[str, Any]:
+        """How the server authenticates requests to its prediction endpoints."""
+        return self._cog_config.get("serve", {}).get("auth") or {}
+
+    @property
+    def rate_limit(self) -> Dict[str, Any]:
+        """How many prediction and training requests the server accepts."""
+        return self._cog_config.get("serve", {}).get("rate_limit") or {}
+
+    @property
+    def cache(self) -> Dict[str, Any]:
+        """How prediction responses are cached."""
+        return self._cog_config.get("serve", {}).get("cache") or {}
+
+    @property
+    def dead_letter(self) -> Dict[str, Any]:
+        """Whether inputs that crash the model are quarantined, and where to."""
+        return self._cog_config.get("serve", {}).get("dead_letter") or {}
+
+    @property
+    def results(self) -> Dict[str, Any]:
+        """Where the responses of asynchronous predictions are stored."""
+        return self._cog_config.get("serve", {}).get("results") or {}
+
+    @property
+    @env_property(COG_METRICS_ENV_VAR)
+    def metrics(self) -> bool:
+        """Whether the server counts predictions and serves the counts at /metrics."""
+        return bool(self._cog_config.get("serve", {}).get("metrics", False))
+
+    @property
+    def restart_on_crash(self) -> bool:
+        """Whether the model is restarted when a prediction crashes it."""
+        return bool(self._cog_config.get("serve", {}).get("restart_on_crash", False))
+
+    @property
+    def retry_on_oom(self) -> bool:
+        """Whether predictions that run out of GPU memory are run again once."""
+        return bool(self._cog_config.get("serve", {}).get("retry_on_oom", False))
+
+    @property
+    def oom_batch_size_input(self) -> Optional[str]:
+        """The input that's halved when a prediction is retried, like batch_size."""
+        return self._cog_config.get("serve", {}).get("oom_batch_size_input")
+
+    @property
+    def record(self) -> Dict[str, Any]:
+        """Which predictions' inputs and outputs are recorded, and where to."""
+        return self._cog_config.get("serve", {}).get("record") or {}
+
+    @property
+    def input_limits(self) -> Dict[str, Any]:
+        """The limits on inputs, like images' resolution, by input name."""
+        return self._cog_config.get("serve", {}).get("input_limits") or {}
+
+    @property
+    def filters(self) -> Dict[str, Any]:
+        """The content filters that check inputs and outputs of predictions."""
+        return self._cog_config.get("serve", {}).get("filters") or {}
+
+    @property
+    def cors(self) -> Dict[str, Any]:
+        """Which web pages can call the server from a browser."""
+        return self._cog_config.get("serve", {}).get("cors") or {}
+
+    @property
+    def environment_variables(self) -> Dict[str, str]:
+        """The environment variables to set when the model runs."""
+        return self._cog_config.get("environment_variables") or {}
+
+    @property
+    def downloads(self) -> Dict[str, Any]:
+        """The limits on downloading input files passed as URLs."""
+        return self._cog_config.get("downloads") or {}
+
     def _predictor_code(
         self,
         module_path: str,
@@ -115,9 +274,18 @@ class Config:
         method_name: str,
         mode: Mode,
         module_name: str,
+        other_predictor: bool = False,
     ) -> Optional[str]:
+        # The stripped source code in the environment only has the mode's
+        # method, like predict(), of the mode's predictor in it, so it's no
+        # use for other predictors, like the steps of a pipeline or the models
+        # in `models`
         source_code = os.environ.get(_env_var_from_mode(mode))
-        if source_code is not None:
+        if (
+            source_code is not None
+            and method_name == _method_name_from_mode(mode)
+            and not other_predictor
+        ):
             return source_code
         if sys.version_info >= (3, 9):
             wait_for_env(include_imports=False)
@@ -128,12 +296,12 @@ class Config:
         return None
 
     def _load_predictor_for_types(
-        self, ref: str, method_name: str, mode: Mode
+        self, ref: str, method_name: str, mode: Mode, other_predictor: bool = False
     ) -> BasePredictor:
         module_path, class_name = ref.split(":", 1)
         module_name = os.path.basename(module_path).split(".py", 1)[0]
         code = self._predictor_code(
-            module_path, class_name, method_name, mode, module_name
+            module_path, class_name, method_name, mode, module_name, other_predictor
         )
         module = None
         if code is not None:
@@ -147,6 +315,25 @@ class Config:
             module = load_full_predictor_from_file(module_path, module_name)
         return get_predictor(module, class_name)
 
+    def _load_pipeline_for_types(self, mode: Mode) -> Any:
+        # Each step's predictor is loaded the same way as any other, rather
+        # than importing all of them, which the pipeline itself does
+        from .pipeline import Pipeline  # pylint: disable=import-outside-toplevel
+
+        steps = self.pipeline
+        return Pipeline(
+            steps=steps,
+            predictors={
+                step["name"]: self._load_predictor_for_types(
+                    step["predict"],
+                    _method_name_from_mode(mode=mode),
+                    mode,
+                    other_predictor=True,
+                )
+                for step in steps
+            },
+        )
+
     def get_predictor_ref(self, mode: Mode) -> str:
         """Find the predictor reference for a given mode."""
         predictor_ref = None
@@ -161,25 +348,29 @@ class Config:
         return predictor_ref
 
     def get_predictor_types(
-        self, mode: Mode
+        self, mode: Mode, method: Optional[str] = None
     ) -> Tuple[Type[BaseInput], Type[BaseModel], bool]:
         """
         Find the input & output types of a predictor/train function as well
-        as determining if the function is an async function.
+        as determining if the function is an async function. In predict mode,
+        method is one of predict_methods, or None for predict().
         """
         predictor_ref = self.get_predictor_ref(mode=mode)
-        predictor = self._load_predictor_for_types(
-            predictor_ref, _method_name_from_mode(mode=mode), mode
-        )
+        if predictor_ref == PIPELINE_PREDICTOR_REF:
+            predictor = self._load_pipeline_for_types(mode)
+        else:
+            predictor = self._load_predictor_for_types(
+                predictor_ref, method or _method_name_from_mode(mode=mode), mode
+            )
 
         def is_async(fn: Callable[[Any], Any]) -> bool:
             return inspect.iscoroutinefunction(fn) or inspect.isasyncgenfunction(fn)
 
         if mode == Mode.PREDICT:
             return (
-                get_input_type(predictor),
-                get_output_type(predictor),
-                is_async(get_predict(predictor)),
+                get_input_type(predictor, method),
+                get_output_type(predictor, method),
+                is_async(get_predict(predictor, method)),
             )
         elif mode == Mode.TRAIN:
             return (
@@ -188,3 +379,21 @@ class Config:
                 is_async(get_train(predictor)),
             )
         raise ValueError(f"Mode {mode} not found for generating input/output types.")
+
+    def get_model_types(
+        self, name: str, predictor_ref: str
+    ) -> Tuple[Type[BaseInput], Type[BaseModel], bool]:
+        """
+        Find the input & output types of the predict() method of one of the
+        models in `models`, which are named after it, and whether it's an
+        async function.
+        """
+        predictor = self._load_predictor_for_types(
+            predictor_ref, PREDICT_METHOD_NAME, Mode.PREDICT, other_predictor=True
+        )
+        predict = get_predict(predictor)
+        return (
+            get_input_type(predictor, type_prefix=name),
+            get_output_type(predictor, type_prefix=name),
+            inspect.iscoroutinefunction(predict) or inspect.isasyncgenfunction(predict),
+        )
@@ -0,0 +1,159 @@
+import fnmatch
+import io
+import re
+import urllib.parse
+from dataclasses import dataclass
+from typing import Any, Dict, List, Optional
+
+import requests
+
+from .errors import ConfigDoesNotExist
+
+DEFAULT_TIMEOUT = 10.0
+
+# How many redirects are followed when downloading an input
+MAX_REDIRECTS = 10
+
+_QUANTITY_RE = re.compile(r"^([0-9]+(?:\.[0-9]+)?)\s*([kKmMgGtT]?)(i?)[bB]?$")
+_QUANTITY_EXPONENTS = {"": 0, "k": 1, "m": 2, "g": 3, "t": 4}
+
+
+class DownloadError(ValueError):
+    """Raised when an input URL breaks the `downloads` rules in cog.yaml."""
+
+
+def parse_quantity(s: str) -> int:
+    """
+    Parse a size like "512M", "16GB" or "16Gi" into bytes, the same way the
+    Cog CLI does.
+    """
+    match = _QUANTITY_RE.match(s.strip())
+    if match is None or (match.group(3) and not match.group(2)):
+        raise ValueError(f"{s!r} is not a valid size")
+    base = 1024 if match.group(3) else 1000
+    exponent = _QUANTITY_EXPONENTS[match.group(2).lower()]
+    return int(float(match.group(1)) * base**exponent)
+
+
+@dataclass(frozen=True)
+class DownloadPolicy:
+    """
+    DownloadPolicy holds the limits on downloading input files passed as URLs.
+    Unset limits allow anything.
+    """
+
+    max_size: Optional[int] = None
+    timeout: float = DEFAULT_TIMEOUT
+    allowed_schemes: Optional[List[str]] = None
+    allowed_hosts: Optional[List[str]] = None
+    allowed_content_types: Optional[List[str]] = None
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "DownloadPolicy":
+        max_size = config.get("max_size")
+        return cls(
+            max_size=parse_quantity(str(max_size)) if max_size else None,
+            timeout=float(config.get("timeout") or DEFAULT_TIMEOUT),
+            allowed_schemes=config.get("allowed_schemes"),
+            allowed_hosts=config.get("allowed_hosts"),
+            allowed_content_types=config.get("allowed_content_types"),
+        )
+
+    def check_url(self, url: str) -> None:
+        parsed = urllib.parse.urlparse(url)
+        if (
+            self.allowed_schemes is not None
+            and parsed.scheme not in self.allowed_schemes
+        ):
+            raise DownloadError(
+                f"URL scheme '{parsed.scheme}' is not allowed. Allowed schemes: {', '.join(self.allowed_schemes)}"
+            )
+        if parsed.scheme == "data" or self.allowed_hosts is None:
+            return
+        host = (parsed.hostname or "").lower()
+        if not any(_host_matches(host, pattern) for pattern in self.allowed_hosts):
+            raise DownloadError(f"Downloading from host '{host}' is not allowed")
+
+    def get(self, url: str) -> requests.Response:
+        """
+        Start downloading url. Redirects are followed one at a time, so each
+        URL they go to is checked, and an allowed host can't redirect to one
+        that isn't.
+        """
+        for _ in range(MAX_REDIRECTS + 1):
+            self.check_url(url)
+            resp = requests.get(
+                url, stream=True, timeout=self.timeout, allow_redirects=False
+            )
+            if not resp.is_redirect:
+                return resp
+            resp.close()
+            url = urllib.parse.urljoin(url, resp.headers["Location"])
+        raise DownloadError(f"Too many redirects, more than {MAX_REDIRECTS}")
+
+    def check_content_type(self, content_type: Optional[str]) -> None:
+        if self.allowed_content_types is None:
+            return
+        mime_type = (content_type or "").split(";")[0].strip().lower()
+        if not any(
+            fnmatch.fnmatchcase(mime_type, pattern.lower())
+            for pattern in self.allowed_content_types
+        ):
+            raise DownloadError(
+                f"Content type '{mime_type}' is not allowed. Allowed content types: {', '.join(self.allowed_content_types)}"
+            )
+
+    def check_size(self, size: int) -> None:
+        if self.max_size is not None and size > self.max_size:
+            raise DownloadError(
+                f"Download is larger than the maximum size of {self.max_size} bytes"
+            )
+
+
+def _host_matches(host: str, pattern: str) -> bool:
+    pattern = pattern.lower()
+    if pattern.startswith("*."):
+        return host.endswith(pattern[1:])
+    return host == pattern
+
+
+class LimitedReader(io.RawIOBase):
+    """
+    LimitedReader wraps a raw response and raises DownloadError once more than
+    the policy's max_size bytes have been read from it, for responses without
+    a trustworthy Content-Length.
+    """
+
+    def __init__(self, raw: Any, policy: DownloadPolicy) -> None:
+        super().__init__()
+        self._raw = raw
+        self._policy = policy
+        self._bytes_read = 0
+
+    def readable(self) -> bool:
+        return True
+
+    def readinto(self, b: Any) -> int:
+        n = self._raw.readinto(b)
+        self._bytes_read += n
+        self._policy.check_size(self._bytes_read)
+        return n
+
+    def __getattr__(self, name: str) -> Any:
+        return getattr(self._raw, name)
+
+
+_policy: Optional[DownloadPolicy] = None
+
+
+def get_policy() -> DownloadPolicy:
+    """Return the download policy from the `downloads` section of cog.yaml."""
+    global _policy  # pylint: disable=global-statement
+    if _policy is None:
+        from .config import Config  # pylint: disable=import-outside-toplevel
+
+        try:
+            _policy = DownloadPolicy.from_config(Config().downloads)
+        except ConfigDoesNotExist:
+            _policy = DownloadPolicy()
+    return _policy
@@ -40,6 +40,30 @@ def guess_filename(obj: io.IOBase) -> str:
     return os.path.basename(name)
 
 
+def put_file_to_presigned_url(
+    fh: io.IOBase, url: str, client: requests.Session, prediction_id: Optional[str]
+) -> str:
+    """
+    Upload a file to a presigned URL, like an S3 or GCS signed PUT URL, and
+    return the URL without the signature.
+    """
+    if fh.seekable():
+        fh.seek(0)
+
+    content_type, _ = mimetypes.guess_type(guess_filename(fh))
+
+    headers = {}
+    if content_type is not None:
+        headers["Content-Type"] = content_type
+    if prediction_id is not None:
+        headers["X-Prediction-ID"] = prediction_id
+
+    resp = client.put(url, fh, headers=headers, timeout=(10, 15))  # type: ignore
+    resp.raise_for_status()
+
+    return str(urlparse(url)._replace(query="").geturl())
+
+
 def put_file_to_signed_endpoint(
     fh: io.IOBase, endpoint: str, client: requests.Session, prediction_id: Optional[str]
 ) -> str:
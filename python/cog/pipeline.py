@@ -0,0 +1,182 @@
+"""
+Runs a pipeline of predictors in the project, set with `pipeline` in cog.yaml,
+as if it were one predictor. The outputs of earlier steps are inputs to later
+ones.
+
+The worker loads this file by its path, like any other predictor, so it uses
+absolute imports.
+"""
+
+import inspect
+import types
+from typing import Any, Callable, Dict, List, Optional, Tuple, get_origin
+
+from cog.base_predictor import BasePredictor
+from cog.predictor import (
+    extract_setup_weights,
+    get_input_type,
+    get_predict,
+    has_setup_weights,
+    load_predictor_from_ref,
+)
+from cog.types import PYDANTIC_V2, ConcatenateIterator, URLPath
+
+PIPELINE_INPUT = "input"
+
+
+def parse_reference(value: Any) -> Optional[Tuple[str, Optional[str]]]:
+    """
+    Returns the step and field a value in a step's inputs refers to, like
+    ("input", "audio") for $input.audio or ("transcribe", None) for
+    $transcribe.output, or None if it's a literal value. cog.yaml is
+    validated when the model is built, so references are well formed.
+    """
+    if not isinstance(value, str) or not value.startswith("$"):
+        return None
+    if value.startswith("$$"):
+        return None
+    parts = value[1:].split(".")
+    if parts[0] == PIPELINE_INPUT:
+        return (PIPELINE_INPUT, parts[1])
+    return (parts[0], parts[2] if len(parts) > 2 else None)
+
+
+def literal(value: Any) -> Any:
+    if isinstance(value, str) and value.startswith("$$"):
+        return value[1:]
+    return value
+
+
+def collect(output: Any, predict: Callable[..., Any]) -> Any:
+    """
+    Returns a step's output as it's passed to later steps. Iterators are
+    collected into a list, or a string if they're a ConcatenateIterator.
+    """
+    if not isinstance(output, types.GeneratorType):
+        return output
+    items = list(output)
+    return_annotation = inspect.signature(predict).return_annotation
+    if get_origin(return_annotation) is ConcatenateIterator:
+        return "".join(items)
+    return items
+
+
+class Pipeline(BasePredictor):
+    def __init__(
+        self,
+        steps: Optional[List[Dict[str, Any]]] = None,
+        predictors: Optional[Dict[str, Any]] = None,
+    ) -> None:
+        if steps is None:
+            from cog.config import Config  # pylint: disable=import-outside-toplevel
+
+            steps = Config().pipeline
+        self.steps = steps
+        if predictors is None:
+            predictors = {
+                step["name"]: load_predictor_from_ref(step["predict"])
+                for step in steps
+            }
+        self.predictors = predictors
+        self.input_types = {
+            name: get_input_type(predictor) for name, predictor in predictors.items()
+        }
+
+        for step in steps:
+            step_predict = get_predict(predictors[step["name"]])
+            if inspect.iscoroutinefunction(step_predict) or inspect.isasyncgenfunction(
+                step_predict
+            ):
+                raise TypeError(
+                    f"The predictor for pipeline step {step['name']} is async, but pipelines only support predictors that aren't"
+                )
+
+        def predict(**kwargs: Any) -> Any:
+            return self._run(kwargs)
+
+        predict.__signature__ = self._signature()  # type: ignore
+        self.predict = predict  # type: ignore
+
+    def _signature(self) -> inspect.Signature:
+        """
+        The pipeline's inputs are the inputs of the steps that its inputs are
+        passed to, and its output is the last step's output.
+        """
+        parameters: Dict[str, inspect.Parameter] = {}
+        for step in self.steps:
+            step_parameters = inspect.signature(
+                get_predict(self.predictors[step["name"]])
+            ).parameters
+            for name, value in (step.get("inputs") or {}).items():
+                ref = parse_reference(value)
+                if ref is None or ref[0] != PIPELINE_INPUT or ref[1] in parameters:
+                    continue
+                if name not in step_parameters:
+                    raise TypeError(
+                        f"Pipeline step {step['name']} has an input {name}, but its predict() method doesn't"
+                    )
+                parameters[ref[1]] = step_parameters[name].replace(
+                    name=ref[1], kind=inspect.Parameter.KEYWORD_ONLY
+                )
+        last = get_predict(self.predictors[self.steps[-1]["name"]])
+        return inspect.Signature(
+            list(parameters.values()),
+            return_annotation=inspect.signature(last).return_annotation,
+        )
+
+    def setup(self) -> None:
+        for step in self.steps:
+            predictor = self.predictors[step["name"]]
+            if not hasattr(predictor, "setup"):
+                continue
+            if has_setup_weights(predictor):
+                predictor.setup(weights=extract_setup_weights(predictor))
+            else:
+                predictor.setup()
+
+    def _run(self, pipeline_input: Dict[str, Any]) -> Any:
+        outputs: Dict[str, Any] = {}
+        output = None
+        for i, step in enumerate(self.steps):
+            predictor = self.predictors[step["name"]]
+            step_predict = get_predict(predictor)
+            step_input = self._step_input(step, pipeline_input, outputs)
+            output = step_predict(**step_input)
+            if i < len(self.steps) - 1:
+                outputs[step["name"]] = collect(output, step_predict)
+        return output
+
+    def _step_input(
+        self,
+        step: Dict[str, Any],
+        pipeline_input: Dict[str, Any],
+        outputs: Dict[str, Any],
+    ) -> Dict[str, Any]:
+        kwargs = {}
+        for name, value in (step.get("inputs") or {}).items():
+            ref = parse_reference(value)
+            if ref is None:
+                kwargs[name] = literal(value)
+            elif ref[0] == PIPELINE_INPUT:
+                if ref[1] in pipeline_input:
+                    kwargs[name] = pipeline_input[ref[1]]
+            elif ref[1] is None:
+                kwargs[name] = outputs[ref[0]]
+            elif isinstance(outputs[ref[0]], dict):
+                kwargs[name] = outputs[ref[0]][ref[1]]
+            else:
+                kwargs[name] = getattr(outputs[ref[0]], ref[1])
+
+        # Validate the input like the server does, so literal values are
+        # converted to the step's types and its defaults are filled in
+        validated = self.input_types[step["name"]](**kwargs)
+        if PYDANTIC_V2:
+            step_input = validated.model_dump()
+        else:
+            step_input = validated.dict()  # type: ignore
+        for k, v in step_input.items():
+            if isinstance(v, URLPath):
+                step_input[k] = v.convert()
+            elif isinstance(v, list) and v and all(isinstance(x, URLPath) for x in v):
+                step_input[k] = [x.convert() for x in v]
+        return step_input
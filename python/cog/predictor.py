@@ -3,6 +3,7 @@ import enum
 import importlib.util
 import inspect
 import os.path
+import re
 import sys
 import types
 import uuid
@@ -262,13 +263,51 @@ def get_input_create_model_kwargs(signature: inspect.Signature) -> Dict[str, Any
     return create_model_kwargs
 
 
-def get_predict(predictor: Any) -> Callable[..., Any]:
+def get_predict(predictor: Any, method: Optional[str] = None) -> Callable[..., Any]:
+    """
+    Returns the predictor's predict() method, or if method is set, one of the other predict methods listed in
+    predict_methods in cog.yaml.
+    """
+    if method is not None:
+        if not hasattr(predictor, method):
+            raise AttributeError(
+                f"predict_methods in cog.yaml includes {method}, but the predictor doesn't have a {method}() method"
+            )
+        return getattr(predictor, method)
     if hasattr(predictor, "predict"):
         return predictor.predict
     return predictor
 
 
-def get_input_type(predictor: BasePredictor) -> Type[BaseInput]:
+def get_predict_batch(predictor: Any) -> Callable[..., Any]:
+    """
+    Returns the predictor's predict_batch() method, which the server calls with a list of values for each of
+    predict()'s arguments when batching is set in cog.yaml.
+    """
+    if not hasattr(predictor, "predict_batch"):
+        raise AttributeError(
+            "batching is set in cog.yaml, but the predictor doesn't have a predict_batch() method"
+        )
+    return predictor.predict_batch
+
+
+def method_type_name(method: Optional[str], name: str) -> str:
+    """
+    Returns the name of a type for a predict method, so each method's types have their own names in the schema.
+    For example, the input type of a method called generate_image is GenerateImageInput. It's used for the names of
+    the models in `models` too, so the input type of a model called image-upscaler is ImageUpscalerInput.
+    """
+    if method is None:
+        return name
+    parts = re.split(r"[^A-Za-z0-9]+", method)
+    return "".join(part.capitalize() for part in parts) + name
+
+
+def get_input_type(
+    predictor: BasePredictor,
+    method: Optional[str] = None,
+    type_prefix: Optional[str] = None,
+) -> Type[BaseInput]:
     """
     Creates a Pydantic Input model from the arguments of a Predictor's predict() method.
 
@@ -280,13 +319,15 @@ def get_input_type(predictor: BasePredictor) -> Type[BaseInput]:
 
     class Input(BaseModel):
         text: str
+
+    The model is named after type_prefix, or the method if it isn't set, like GenerateImageInput.
     """
 
-    predict = get_predict(predictor)
+    predict = get_predict(predictor, method)
     signature = inspect.signature(predict)
 
     return create_model(
-        "Input",
+        method_type_name(type_prefix or method, "Input"),
         __config__=None,
         __base__=BaseInput,
         __module__=__name__,
@@ -295,12 +336,17 @@ def get_input_type(predictor: BasePredictor) -> Type[BaseInput]:
     )  # type: ignore
 
 
-def get_output_type(predictor: BasePredictor) -> Type[BaseModel]:
+def get_output_type(
+    predictor: BasePredictor,
+    method: Optional[str] = None,
+    type_prefix: Optional[str] = None,
+) -> Type[BaseModel]:
     """
     Creates a Pydantic Output model from the return type annotation of a Predictor's predict() method.
     """
+    type_prefix = type_prefix or method
 
-    predict = get_predict(predictor)
+    predict = get_predict(predictor, method)
     signature = inspect.signature(predict)
     OutputType: Type[BaseModel]
     if signature.return_annotation is inspect.Signature.empty:
@@ -333,6 +379,24 @@ For example:
 
     name = OutputType.__name__ if hasattr(OutputType, "__name__") else ""
 
+    if type_prefix is not None:
+        # Other predict methods' outputs are wrapped in the same way as
+        # predict()'s below, but in classes named after the method
+        output_name = method_type_name(type_prefix, "Output")
+        if name == "TrainingOutput":
+            return type(output_name, (OutputType,), {"__module__": __name__})  # type: ignore
+        if PYDANTIC_V2:
+            return type(
+                output_name,
+                (pydantic.RootModel[OutputType],),  # type: ignore
+                {"__module__": __name__},
+            )
+        return type(
+            output_name,
+            (BaseModel,),
+            {"__annotations__": {"__root__": OutputType}, "__module__": __name__},
+        )
+
     if name == "Output":
         return OutputType
 
@@ -65,10 +65,22 @@ else:
     WebhookUrl = pydantic.AnyUrl
 
 
+class Experiment(pydantic.BaseModel):
+    """
+    The A/B experiment a prediction is part of, and which variant of it the
+    prediction ran, so the prediction can be attributed to the variant
+    """
+
+    id: Optional[str] = None
+    variant: Optional[str] = None
+
+
 class PredictionRequest(PredictionBaseModel):
     id: Optional[str] = None
     created_at: Optional[datetime] = None
 
+    experiment: Optional[Experiment] = None
+
     # TODO: deprecate this
     output_file_prefix: Optional[str] = None
 
@@ -78,12 +90,12 @@ class PredictionRequest(PredictionBaseModel):
     )
 
     @classmethod
-    def with_types(cls, input_type: Type[Any]) -> Any:
+    def with_types(cls, input_type: Type[Any], name: Optional[str] = None) -> Any:
         # [compat] Input is implicitly optional -- previous versions of the
         # Cog HTTP API allowed input to be omitted (e.g. for models that don't
         # have any inputs). We should consider changing this in future.
         return pydantic.create_model(
-            cls.__name__, __base__=cls, input=(Optional[input_type], None)
+            name or cls.__name__, __base__=cls, input=(Optional[input_type], None)
         )
 
 
@@ -99,10 +111,15 @@ class PredictionResponse(PredictionBaseModel):
 
     logs: str = ""
     error: Optional[str] = None
+    # The kind of error the prediction failed with, like "cuda_out_of_memory",
+    # if it's one Cog recognises
+    error_type: Optional[str] = None
     status: Optional[Status] = None
 
     metrics: Optional[Dict[str, Any]] = None
 
+    experiment: Optional[Experiment] = None
+
     # This is used to track a fatal exception that occurs during a prediction.
     # "Fatal" means that we require the worker to be shut down to recover:
     # regular exceptions raised during predict are handled and do not use this
@@ -110,12 +127,14 @@ class PredictionResponse(PredictionBaseModel):
     _fatal_exception: Optional[BaseException] = pydantic.PrivateAttr(default=None)
 
     @classmethod
-    def with_types(cls, input_type: Type[Any], output_type: Type[Any]) -> Any:
+    def with_types(
+        cls, input_type: Type[Any], output_type: Type[Any], name: Optional[str] = None
+    ) -> Any:
         # [compat] Input is implicitly optional -- previous versions of the
         # Cog HTTP API allowed input to be omitted (e.g. for models that don't
         # have any inputs). We should consider changing this in future.
         return pydantic.create_model(
-            cls.__name__,
+            name or cls.__name__,
             __base__=cls,
             input=(Optional[input_type], None),
             output=(Optional[output_type], None),
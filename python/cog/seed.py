@@ -0,0 +1,37 @@
+import os
+import random
+import sys
+
+import structlog
+
+COG_SEED_ENV_VAR = "COG_SEED"
+
+log = structlog.get_logger("cog.seed")
+
+
+def seed_from_env() -> None:
+    """
+    Seed random number generators with the seed in COG_SEED, if it's set, so
+    predictions with the same inputs return the same outputs. `cog test
+    --determinism` sets it.
+
+    NumPy and PyTorch are only seeded if the model has imported them, so they
+    aren't imported unnecessarily.
+    """
+    value = os.environ.get(COG_SEED_ENV_VAR)
+    if not value:
+        return
+    try:
+        seed = int(value)
+    except ValueError:
+        log.warning(f"Ignoring {COG_SEED_ENV_VAR}, which isn't an integer: {value}")
+        return
+
+    random.seed(seed)
+    if "numpy" in sys.modules:
+        sys.modules["numpy"].random.seed(seed % 2**32)
+    if "torch" in sys.modules:
+        torch = sys.modules["torch"]
+        torch.manual_seed(seed)
+        if torch.cuda.is_available():
+            torch.cuda.manual_seed_all(seed)
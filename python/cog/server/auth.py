@@ -0,0 +1,297 @@
+import base64
+import hashlib
+import hmac
+import json
+import math
+import os
+import threading
+import time
+from typing import Any, Dict, List, Optional
+
+import requests
+import structlog
+from starlette.concurrency import run_in_threadpool
+from starlette.datastructures import Headers
+from starlette.responses import JSONResponse
+from starlette.types import ASGIApp, Receive, Scope, Send
+
+log = structlog.get_logger("cog.server.auth")
+
+COG_API_KEYS_ENV_VAR = "COG_API_KEYS"
+
+# Paths that need authentication. Health checks, the OpenAPI schema and docs
+# stay open so that orchestrators and clients can discover the model.
+PROTECTED_PATH_PREFIXES = (
+    "/predictions",
+    "/trainings",
+    "/uploads",
+    "/models",
+    "/admin",
+    "/shutdown",
+    # The Open Inference Protocol's endpoints, apart from /v2/health
+    "/v2/models",
+)
+
+# The key in the ASGI scope's state where AuthMiddleware records who made a
+# request, for later middleware like rate limiting
+CLIENT_ID_STATE_KEY = "cog_client_id"
+
+# Clock skew allowed when checking a JWT's exp and nbf claims
+JWT_LEEWAY_SECONDS = 60
+
+JWKS_CACHE_SECONDS = 300
+
+# DER-encoded DigestInfo prefixes for RSASSA-PKCS1-v1_5 signatures (RFC 8017)
+_DIGEST_INFO_PREFIXES = {
+    "RS256": (
+        hashlib.sha256,
+        bytes.fromhex("3031300d060960864801650304020105000420"),
+    ),
+    "RS384": (
+        hashlib.sha384,
+        bytes.fromhex("3041300d060960864801650304020205000430"),
+    ),
+    "RS512": (
+        hashlib.sha512,
+        bytes.fromhex("3051300d060960864801650304020305000440"),
+    ),
+}
+
+
+class AuthenticationError(Exception):
+    pass
+
+
+class Authenticator:
+    def authenticate(self, token: str) -> str:
+        """
+        Return an ID for the client that token belongs to, or raise
+        AuthenticationError if token isn't valid.
+        """
+        raise NotImplementedError
+
+
+class APIKeyAuthenticator(Authenticator):
+    def __init__(self, api_keys: List[str]) -> None:
+        self.api_keys = [k.encode("utf-8") for k in api_keys]
+
+    def authenticate(self, token: str) -> str:
+        token_bytes = token.encode("utf-8")
+        # Compare against every key so timing doesn't leak which one matched
+        matched = False
+        for key in self.api_keys:
+            matched |= hmac.compare_digest(key, token_bytes)
+        if not matched:
+            raise AuthenticationError("Invalid API key")
+        # Don't keep the key itself around in memory or logs
+        return "key:" + hashlib.sha256(token_bytes).hexdigest()[:16]
+
+
+class JWTAuthenticator(Authenticator):
+    """
+    JWTAuthenticator accepts JSON Web Tokens signed with RS256, RS384 or RS512
+    by a key from a JSON Web Key Set.
+    """
+
+    def __init__(
+        self,
+        jwks_url: str,
+        issuer: Optional[str] = None,
+        audience: Optional[str] = None,
+    ) -> None:
+        self.jwks_url = jwks_url
+        self.issuer = issuer
+        self.audience = audience
+        self._keys: List[Dict[str, Any]] = []
+        self._keys_fetched_at = 0.0
+        self._lock = threading.Lock()
+
+    def authenticate(self, token: str) -> str:
+        try:
+            header_b64, payload_b64, signature_b64 = token.split(".")
+            header = json.loads(_b64decode(header_b64))
+            claims = json.loads(_b64decode(payload_b64))
+            signature = _b64decode(signature_b64)
+            signed = f"{header_b64}.{payload_b64}".encode("ascii")
+        except (ValueError, RecursionError) as e:
+            raise AuthenticationError("Malformed token") from e
+        if not isinstance(header, dict) or not isinstance(claims, dict):
+            raise AuthenticationError("Malformed token")
+
+        alg = header.get("alg")
+        if not isinstance(alg, str) or alg not in _DIGEST_INFO_PREFIXES:
+            raise AuthenticationError(f"Unsupported token algorithm {alg!r}")
+
+        key = self._find_key(header.get("kid"))
+        if not _verify_rsa(key, alg, signed, signature):
+            raise AuthenticationError("Invalid token signature")
+
+        self._check_claims(claims)
+        if "sub" in claims:
+            return f"sub:{claims['sub']}"
+        return "token:" + hashlib.sha256(signed).hexdigest()[:16]
+
+    def _check_claims(self, claims: Dict[str, Any]) -> None:
+        now = time.time()
+        exp = _time_claim(claims, "exp")
+        if exp is not None and now > exp + JWT_LEEWAY_SECONDS:
+            raise AuthenticationError("Token has expired")
+        nbf = _time_claim(claims, "nbf")
+        if nbf is not None and now < nbf - JWT_LEEWAY_SECONDS:
+            raise AuthenticationError("Token is not valid yet")
+        if self.issuer is not None and claims.get("iss") != self.issuer:
+            raise AuthenticationError("Token has the wrong issuer")
+        if self.audience is not None:
+            audience = claims.get("aud")
+            audiences = audience if isinstance(audience, list) else [audience]
+            if self.audience not in audiences:
+                raise AuthenticationError("Token has the wrong audience")
+
+    def _find_key(self, kid: Optional[str]) -> Dict[str, Any]:
+        key = self._lookup_key(kid, refresh=False)
+        if key is None:
+            # The key might have been rotated since we last fetched the set
+            key = self._lookup_key(kid, refresh=True)
+        if key is None:
+            raise AuthenticationError("Token was signed by an unknown key")
+        return key
+
+    def _lookup_key(
+        self, kid: Optional[str], refresh: bool
+    ) -> Optional[Dict[str, Any]]:
+        with self._lock:
+            expired = time.time() - self._keys_fetched_at > JWKS_CACHE_SECONDS
+            if refresh or expired:
+                self._keys = self._fetch_keys()
+                self._keys_fetched_at = time.time()
+            rsa_keys = [k for k in self._keys if k.get("kty") == "RSA"]
+        if kid is None and len(rsa_keys) == 1:
+            return rsa_keys[0]
+        for k in rsa_keys:
+            if k.get("kid") == kid:
+                return k
+        return None
+
+    def _fetch_keys(self) -> List[Dict[str, Any]]:
+        try:
+            resp = requests.get(self.jwks_url, timeout=10)
+            resp.raise_for_status()
+            keys = resp.json().get("keys", [])
+            if not isinstance(keys, list):
+                raise ValueError("keys isn't a list")
+            return [k for k in keys if isinstance(k, dict)]
+        except (requests.RequestException, ValueError, AttributeError) as e:
+            log.error("failed to fetch JWKS", url=self.jwks_url, exc_info=e)
+            return self._keys
+
+
+def _b64decode(s: str) -> bytes:
+    return base64.urlsafe_b64decode(s + "=" * (-len(s) % 4))
+
+
+def _time_claim(claims: Dict[str, Any], name: str) -> Optional[float]:
+    """
+    Return a claim that's a time in seconds since the epoch, like exp, or None
+    if it isn't set.
+    """
+    if name not in claims:
+        return None
+    value = claims[name]
+    # bool is an int, but true isn't a time
+    if isinstance(value, (int, float)) and not isinstance(value, bool):
+        try:
+            seconds = float(value)
+        except OverflowError:
+            seconds = math.inf
+        if math.isfinite(seconds):
+            return seconds
+    raise AuthenticationError(f"Token's {name} claim isn't a number")
+
+
+def _verify_rsa(
+    key: Dict[str, Any], alg: str, message: bytes, signature: bytes
+) -> bool:
+    """Verify an RSASSA-PKCS1-v1_5 signature with a public key in JWK form."""
+    try:
+        n = int.from_bytes(_b64decode(key["n"]), "big")
+        e = int.from_bytes(_b64decode(key["e"]), "big")
+    except (KeyError, ValueError, TypeError):
+        return False
+    key_length = (n.bit_length() + 7) // 8
+    if n == 0 or len(signature) != key_length:
+        return False
+
+    hash_fn, prefix = _DIGEST_INFO_PREFIXES[alg]
+    digest_info = prefix + hash_fn(message).digest()
+    padding = b"\xff" * (key_length - len(digest_info) - 3)
+    expected = b"\x00\x01" + padding + b"\x00" + digest_info
+
+    decrypted = pow(int.from_bytes(signature, "big"), e, n)
+    return hmac.compare_digest(decrypted.to_bytes(key_length, "big"), expected)
+
+
+def make_authenticator(auth_config: Dict[str, Any]) -> Optional[Authenticator]:
+    """
+    Return the authenticator configured by the `serve.auth` section of cog.yaml
+    and the COG_API_KEYS environment variable, or None if requests don't need
+    authenticating.
+    """
+    api_keys = [
+        k.strip()
+        for k in os.environ.get(COG_API_KEYS_ENV_VAR, "").split(",")
+        if k.strip()
+    ]
+    auth_type = auth_config.get("type")
+    if auth_type == "jwt":
+        return JWTAuthenticator(
+            jwks_url=auth_config["jwks_url"],
+            issuer=auth_config.get("issuer"),
+            audience=auth_config.get("audience"),
+        )
+    if auth_type == "api_key" or api_keys:
+        if not api_keys:
+            log.error(
+                f"serve.auth.type is 'api_key' but {COG_API_KEYS_ENV_VAR} is not set, so all requests will be rejected"
+            )
+        return APIKeyAuthenticator(api_keys)
+    return None
+
+
+class AuthMiddleware:
+    """
+    AuthMiddleware rejects requests to prediction, training and upload
+    endpoints without a valid `Authorization: Bearer <token>` header.
+    """
+
+    def __init__(self, app: ASGIApp, authenticator: Authenticator) -> None:
+        self.app = app
+        self.authenticator = authenticator
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        is_protected = scope["type"] == "http" and scope["path"].startswith(
+            PROTECTED_PATH_PREFIXES
+        )
+        if not is_protected:
+            await self.app(scope, receive, send)
+            return
+
+        authorization = Headers(scope=scope).get("authorization", "")
+        scheme, _, token = authorization.partition(" ")
+        try:
+            if scheme.lower() != "bearer" or not token:
+                raise AuthenticationError("Missing bearer token")
+            # Authenticating can block on fetching keys
+            client_id = await run_in_threadpool(
+                self.authenticator.authenticate, token.strip()
+            )
+        except AuthenticationError as e:
+            response = JSONResponse(
+                {"detail": str(e)},
+                status_code=401,
+                headers={"WWW-Authenticate": "Bearer"},
+            )
+            await response(scope, receive, send)
+            return
+
+        scope.setdefault("state", {})[CLIENT_ID_STATE_KEY] = client_id
+        await self.app(scope, receive, send)
@@ -0,0 +1,502 @@
+import collections
+import hashlib
+import json
+import os
+import socket
+import ssl
+import tempfile
+import threading
+import time
+import urllib.parse
+from pathlib import Path
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import structlog
+from starlette.concurrency import run_in_threadpool
+from starlette.datastructures import Headers
+from starlette.responses import Response
+from starlette.types import ASGIApp, Message, Receive, Scope, Send
+
+from .request_body import _read_body, _replay
+
+log = structlog.get_logger("cog.server.cache")
+
+COG_CACHE_REDIS_URL_ENV_VAR = "COG_CACHE_REDIS_URL"
+COG_MODEL_VERSION_ENV_VAR = "COG_MODEL_VERSION"
+
+# The response header that says whether a prediction came from the cache
+CACHE_HEADER = "Cog-Cache"
+
+DEFAULT_MAX_ENTRIES = 1000
+DEFAULT_DISK_PATH = "/tmp/cog/cache"
+REDIS_KEY_PREFIX = "cog:cache:"
+
+
+class CacheBackend:
+    """
+    CacheBackend stores prediction responses by key. Entries expire after ttl
+    seconds, or never if ttl is None.
+    """
+
+    def get(self, key: str) -> Optional[bytes]:
+        raise NotImplementedError
+
+    def set(self, key: str, value: bytes, ttl: Optional[float]) -> None:
+        raise NotImplementedError
+
+
+class MemoryBackend(CacheBackend):
+    """
+    MemoryBackend keeps responses in the server's memory, forgetting the least
+    recently used ones once there are max_entries of them.
+    """
+
+    def __init__(
+        self,
+        max_entries: int = DEFAULT_MAX_ENTRIES,
+        clock: Callable[[], float] = time.monotonic,
+    ) -> None:
+        self._max_entries = max_entries
+        self._clock = clock
+        self._lock = threading.Lock()
+        self._entries: "collections.OrderedDict[str, Tuple[bytes, Optional[float]]]" = (
+            collections.OrderedDict()
+        )
+
+    def get(self, key: str) -> Optional[bytes]:
+        with self._lock:
+            entry = self._entries.get(key)
+            if entry is None:
+                return None
+            value, expires_at = entry
+            if expires_at is not None and self._clock() >= expires_at:
+                del self._entries[key]
+                return None
+            self._entries.move_to_end(key)
+            return value
+
+    def set(self, key: str, value: bytes, ttl: Optional[float]) -> None:
+        with self._lock:
+            expires_at = self._clock() + ttl if ttl else None
+            self._entries[key] = (value, expires_at)
+            self._entries.move_to_end(key)
+            while len(self._entries) > self._max_entries:
+                self._entries.popitem(last=False)
+
+
+class DiskBackend(CacheBackend):
+    """
+    DiskBackend keeps responses in files in a directory, so they're kept when
+    the server restarts if the directory is a volume.
+    """
+
+    def __init__(self, path: str, clock: Callable[[], float] = time.time) -> None:
+        self._path = Path(path)
+        self._path.mkdir(parents=True, exist_ok=True)
+        self._clock = clock
+
+    def get(self, key: str) -> Optional[bytes]:
+        path = self._path / key
+        try:
+            entry = json.loads(path.read_bytes())
+        except FileNotFoundError:
+            return None
+        except ValueError:
+            path.unlink(missing_ok=True)
+            return None
+        expires_at = entry.get("expires_at")
+        if expires_at is not None and self._clock() >= expires_at:
+            path.unlink(missing_ok=True)
+            return None
+        return entry["response"].encode("utf-8")
+
+    def set(self, key: str, value: bytes, ttl: Optional[float]) -> None:
+        entry = {
+            "expires_at": self._clock() + ttl if ttl else None,
+            "response": value.decode("utf-8"),
+        }
+        # Written to a temporary file and renamed, so other processes sharing
+        # the directory never read half a response
+        fd, tmp = tempfile.mkstemp(dir=self._path, prefix=".tmp-")
+        try:
+            with os.fdopen(fd, "w", encoding="utf-8") as f:
+                json.dump(entry, f)
+            os.replace(tmp, self._path / key)
+        except BaseException:
+            Path(tmp).unlink(missing_ok=True)
+            raise
+
+
+class RedisError(Exception):
+    pass
+
+
+class RedisClient:
+    """
+    RedisClient is a minimal client for the Redis protocol, for the commands
+    the cache uses. It connects to a redis:// or rediss:// URL, like
+    redis://:password@localhost:6379/0.
+    """
+
+    def __init__(self, url: str, timeout: float = 5.0) -> None:
+        u = urllib.parse.urlparse(url)
+        if u.scheme not in ("redis", "rediss"):
+            raise ValueError(
+                f"Invalid Redis URL {url!r}, expected redis:// or rediss://"
+            )
+        self._host = u.hostname or "localhost"
+        self._port = u.port or 6379
+        self._tls = u.scheme == "rediss"
+        self._username = urllib.parse.unquote(u.username) if u.username else None
+        self._password = urllib.parse.unquote(u.password) if u.password else None
+        self._db = int(u.path.lstrip("/") or 0)
+        self._timeout = timeout
+        self._lock = threading.Lock()
+        self._sock: Optional[socket.socket] = None
+        self._file: Any = None
+
+    def command(self, *args: Any) -> Any:
+        with self._lock:
+            try:
+                if self._sock is None:
+                    self._connect()
+                return self._command(*args)
+            except (OSError, RedisError):
+                # Reconnect on the next command, in case the connection broke
+                self._close()
+                raise
+
+    def _connect(self) -> None:
+        sock = socket.create_connection((self._host, self._port), self._timeout)
+        if self._tls:
+            sock = ssl.create_default_context().wrap_socket(
+                sock, server_hostname=self._host
+            )
+        self._sock = sock
+        self._file = sock.makefile("rb")
+        if self._password is not None:
+            if self._username is not None:
+                self._command("AUTH", self._username, self._password)
+            else:
+                self._command("AUTH", self._password)
+        if self._db:
+            self._command("SELECT", self._db)
+
+    def _close(self) -> None:
+        if self._sock is not None:
+            self._sock.close()
+        self._sock = None
+        self._file = None
+
+    def _command(self, *args: Any) -> Any:
+        assert self._sock is not None
+        self._sock.sendall(encode_command(args))
+        return read_reply(self._file)
+
+
+def encode_command(args: Tuple[Any, ...]) -> bytes:
+    """Return a command in the Redis protocol"""
+    parts = [b"*%d\r\n" % len(args)]
+    for arg in args:
+        if isinstance(arg, bytes):
+            data = arg
+        else:
+            data = str(arg).encode("utf-8")
+        parts.append(b"$%d\r\n%s\r\n" % (len(data), data))
+    return b"".join(parts)
+
+
+def read_reply(f: Any) -> Any:
+    """Read a reply in the Redis protocol from a file"""
+    line = f.readline()
+    if not line.endswith(b"\r\n"):
+        raise RedisError("Connection closed by Redis")
+    kind, rest = line[:1], line[1:-2]
+    if kind == b"+":
+        return rest.decode("utf-8")
+    if kind == b"-":
+        raise RedisError(rest.decode("utf-8"))
+    if kind == b":":
+        return int(rest)
+    if kind == b"$":
+        length = int(rest)
+        if length < 0:
+            return None
+        data = f.read(length + 2)
+        return data[:-2]
+    if kind == b"*":
+        length = int(rest)
+        if length < 0:
+            return None
+        return [read_reply(f) for _ in range(length)]
+    raise RedisError(f"Unexpected reply from Redis: {line!r}")
+
+
+class RedisBackend(CacheBackend):
+    """
+    RedisBackend keeps responses in Redis, so servers running the same model
+    share them.
+    """
+
+    def __init__(self, client: RedisClient, prefix: str = REDIS_KEY_PREFIX) -> None:
+        self._client = client
+        self._prefix = prefix
+
+    def get(self, key: str) -> Optional[bytes]:
+        return self._client.command("GET", self._prefix + key)
+
+    def set(self, key: str, value: bytes, ttl: Optional[float]) -> None:
+        if ttl:
+            self._client.command(
+                "SET", self._prefix + key, value, "PX", int(ttl * 1000)
+            )
+        else:
+            self._client.command("SET", self._prefix + key, value)
+
+
+class PredictionCache:
+    """
+    PredictionCache looks up and stores the responses of predictions by their
+    endpoint and inputs, and the version of the model, and counts hits and
+    misses. If the backend fails, predictions run as if they weren't cached.
+    """
+
+    def __init__(
+        self, backend: CacheBackend, model_version: str, ttl: Optional[float] = None
+    ) -> None:
+        self.backend = backend
+        self.model_version = model_version
+        self.ttl = ttl
+        self.hits = 0
+        self.misses = 0
+        self.errors = 0
+        self._lock = threading.Lock()
+
+    def key(self, endpoint: str, request: Dict[str, Any], headers: Headers) -> str:
+        """Return the key of a prediction request"""
+        data = {
+            "model_version": self.model_version,
+            "endpoint": endpoint,
+            "input": request.get("input") or {},
+            # Outputs are returned differently when they're uploaded
+            "output": headers.get("cog-output"),
+            "output_upload_urls": headers.getlist("cog-output-upload-url"),
+        }
+        encoded = json.dumps(data, sort_keys=True, separators=(",", ":"))
+        return hashlib.sha256(encoded.encode("utf-8")).hexdigest()
+
+    def get(self, key: str) -> Optional[bytes]:
+        try:
+            value = self.backend.get(key)
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            log.warning("failed to read from the prediction cache", error=str(e))
+            self._count("errors")
+            value = None
+        self._count("misses" if value is None else "hits")
+        return value
+
+    def set(self, key: str, value: bytes) -> None:
+        try:
+            self.backend.set(key, value, self.ttl)
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            log.warning("failed to write to the prediction cache", error=str(e))
+            self._count("errors")
+
+    def _count(self, counter: str) -> None:
+        with self._lock:
+            setattr(self, counter, getattr(self, counter) + 1)
+
+    def metrics(self) -> str:
+        """Return the cache's counters in Prometheus's text format"""
+        counters = [
+            ("cog_cache_hits_total", "Predictions returned from the cache.", self.hits),
+            (
+                "cog_cache_misses_total",
+                "Predictions that weren't in the cache.",
+                self.misses,
+            ),
+            (
+                "cog_cache_errors_total",
+                "Failed reads and writes to the cache.",
+                self.errors,
+            ),
+        ]
+        lines: List[str] = []
+        for name, help_text, value in counters:
+            lines += [
+                f"# HELP {name} {help_text}",
+                f"# TYPE {name} counter",
+                f"{name} {value}",
+            ]
+        return "\n".join(lines) + "\n"
+
+
+def model_version(predictor_ref: str) -> str:
+    """
+    Return the version of the model that cached responses are for. It's
+    COG_MODEL_VERSION, or a hash of the predictor's code if it isn't set.
+    """
+    version = os.environ.get(COG_MODEL_VERSION_ENV_VAR)
+    if version:
+        return version
+    from .._version import __version__  # pylint: disable=import-outside-toplevel
+
+    h = hashlib.sha256(f"{__version__}\n{predictor_ref}\n".encode("utf-8"))
+    module_path = predictor_ref.split(":", 1)[0]
+    try:
+        h.update(Path(module_path).read_bytes())
+    except OSError:
+        pass
+    return h.hexdigest()
+
+
+def make_prediction_cache(
+    cache_config: Dict[str, Any], predictor_ref: str
+) -> Optional[PredictionCache]:
+    """
+    Return the prediction cache configured by the `serve.cache` section of
+    cog.yaml, or None if predictions aren't cached.
+    """
+    backend_name = cache_config.get("backend")
+    if not backend_name:
+        return None
+    backend: CacheBackend
+    if backend_name == "memory":
+        backend = MemoryBackend(
+            cache_config.get("max_entries") or DEFAULT_MAX_ENTRIES
+        )
+    elif backend_name == "disk":
+        backend = DiskBackend(cache_config.get("path") or DEFAULT_DISK_PATH)
+    elif backend_name == "redis":
+        url = os.environ.get(COG_CACHE_REDIS_URL_ENV_VAR)
+        if not url:
+            log.error(
+                f"serve.cache.backend is 'redis' but {COG_CACHE_REDIS_URL_ENV_VAR} is not set, so predictions won't be cached"
+            )
+            return None
+        backend = RedisBackend(RedisClient(url))
+    else:
+        raise ValueError(f"Unknown serve.cache.backend {backend_name!r}")
+    return PredictionCache(
+        backend, model_version(predictor_ref), ttl=cache_config.get("ttl") or None
+    )
+
+
+class CacheMiddleware:
+    """
+    CacheMiddleware returns the response of an earlier prediction with the same
+    inputs, instead of running the model again. Only synchronous predictions
+    that succeed are cached: ones that respond asynchronously or have a webhook
+    always run.
+    """
+
+    def __init__(self, app: ASGIApp, cache: PredictionCache) -> None:
+        self.app = app
+        self.cache = cache
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        endpoint, prediction_id = _cached_endpoint(scope)
+        headers = Headers(scope=scope)
+        if endpoint is None or headers.get("prefer") == "respond-async":
+            await self.app(scope, receive, send)
+            return
+
+        body = await _read_body(receive)
+        receive = _replay(body, receive)
+        try:
+            request = json.loads(body) if body else {}
+        except ValueError:
+            request = None
+        if not isinstance(request, dict) or request.get("webhook"):
+            await self.app(scope, receive, send)
+            return
+
+        key = self.cache.key(endpoint, request, headers)
+        cached = await run_in_threadpool(self.cache.get, key)
+        if cached is not None:
+            response = Response(
+                _for_request(
+                    cached,
+                    prediction_id or request.get("id"),
+                    _experiment(request, headers),
+                ),
+                media_type="application/json",
+                headers={CACHE_HEADER: "hit"},
+            )
+            await response(scope, receive, send)
+            return
+
+        status = 0
+        chunks: List[bytes] = []
+
+        async def send_wrapper(message: Message) -> None:
+            nonlocal status
+            if message["type"] == "http.response.start":
+                status = message["status"]
+                message["headers"] = list(message.get("headers", [])) + [
+                    (CACHE_HEADER.lower().encode("latin-1"), b"miss")
+                ]
+            elif message["type"] == "http.response.body":
+                chunks.append(message.get("body", b""))
+            await send(message)
+
+        await self.app(scope, receive, send_wrapper)
+
+        if status != 200:
+            return
+        response_body = b"".join(chunks)
+        try:
+            succeeded = json.loads(response_body).get("status") == "succeeded"
+        except (ValueError, AttributeError):
+            succeeded = False
+        if succeeded:
+            await run_in_threadpool(self.cache.set, key, response_body)
+
+
+def _cached_endpoint(scope: Scope) -> Tuple[Optional[str], Optional[str]]:
+    """
+    Return the prediction endpoint a request runs, like /predictions or
+    /predictions/generate, and the prediction's ID if it's in the path. The
+    endpoint is None if the request doesn't create a prediction.
+    """
+    if scope["type"] != "http":
+        return None, None
+    path: str = scope["path"].rstrip("/")
+    if not (path == "/predictions" or path.startswith("/predictions/")):
+        return None, None
+    if path.endswith("/cancel"):
+        return None, None
+    if scope["method"] == "POST":
+        return path, None
+    if scope["method"] == "PUT":
+        # The last part of the path is the prediction's ID
+        endpoint, prediction_id = path.rsplit("/", 1)
+        return endpoint, prediction_id
+    return None, None
+
+
+def _experiment(request: Dict[str, Any], headers: Headers) -> Optional[Any]:
+    """Return the experiment a request is part of, from its headers or body"""
+    if headers.get("cog-experiment") or headers.get("cog-variant"):
+        return {
+            "id": headers.get("cog-experiment"),
+            "variant": headers.get("cog-variant"),
+        }
+    return request.get("experiment")
+
+
+def _for_request(
+    response: bytes, prediction_id: Optional[str], experiment: Optional[Any]
+) -> bytes:
+    """
+    Return a cached response with the ID of the prediction it's for, and the
+    experiment it's part of, rather than the ones of the prediction that was
+    cached
+    """
+    prediction = json.loads(response)
+    if prediction_id is None:
+        prediction.pop("id", None)
+    else:
+        prediction["id"] = prediction_id
+    prediction["experiment"] = experiment
+    return json.dumps(prediction).encode("utf-8")
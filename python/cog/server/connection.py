@@ -103,3 +103,6 @@ class LockedConnection:
 
     def recv(self) -> Any:
         return self.connection.recv()
+
+    def poll(self, timeout: float = 0.0) -> bool:
+        return self.connection.poll(timeout)
@@ -0,0 +1,122 @@
+import hashlib
+import json
+import threading
+from datetime import datetime, timezone
+from typing import Any, Callable, Dict, List, Optional, Set
+
+import structlog
+from fastapi.encoders import jsonable_encoder
+
+from .. import schema
+from .recorder import RecordSink, make_sink
+
+log = structlog.get_logger("cog.server.dead_letter")
+
+# How many times an input can crash the model when serve.dead_letter.max_crashes
+# isn't set
+DEFAULT_MAX_CRASHES = 3
+
+
+def input_key(inputs: Dict[str, Any]) -> str:
+    """Return the ID inputs are quarantined by, which is the same for equal inputs"""
+    encoded = json.dumps(inputs, sort_keys=True, separators=(",", ":"))
+    return hashlib.sha256(encoded.encode("utf-8")).hexdigest()
+
+
+class DeadLetterQueue:
+    """
+    DeadLetterQueue counts how many times each input has crashed the model.
+    Once an input has crashed it max_crashes times, it's quarantined: it's
+    written to the sink as `<id>.json`, with the logs and errors of the
+    predictions it crashed, and is_quarantined() is true for it until the
+    queue is cleared, like when the model is reloaded.
+    """
+
+    def __init__(
+        self,
+        sink: RecordSink,
+        max_crashes: int = DEFAULT_MAX_CRASHES,
+        clock: Callable[[], datetime] = lambda: datetime.now(tz=timezone.utc),
+    ) -> None:
+        self.sink = sink
+        self.max_crashes = max_crashes
+        self._clock = clock
+        self._lock = threading.Lock()
+        # The predictions each input has crashed, by input key
+        self._crashes: Dict[str, List[Dict[str, Any]]] = {}
+        self._quarantined: Set[str] = set()
+
+    def is_quarantined(self, inputs: Dict[str, Any]) -> bool:
+        with self._lock:
+            return input_key(inputs) in self._quarantined
+
+    def observe(
+        self, inputs: Dict[str, Any], response: schema.PredictionResponse
+    ) -> None:
+        """
+        Count a finished prediction if it crashed the model, and quarantine
+        its input if it's crashed the model max_crashes times
+        """
+        if not response._fatal_exception:
+            return
+        key = input_key(inputs)
+        crash = {
+            "prediction_id": response.id,
+            "started_at": response.started_at,
+            "completed_at": response.completed_at,
+            "error": response.error,
+            "logs": response.logs,
+        }
+        with self._lock:
+            if key in self._quarantined:
+                return
+            crashes = self._crashes.setdefault(key, [])
+            crashes.append(crash)
+            if len(crashes) < self.max_crashes:
+                return
+            self._quarantined.add(key)
+            del self._crashes[key]
+
+        log.error(
+            "quarantined input that crashed the model", id=key, crashes=len(crashes)
+        )
+        entry = {
+            "id": key,
+            "quarantined_at": self._clock(),
+            "input": inputs,
+            "crashes": crashes,
+        }
+        try:
+            self.sink.write(
+                f"{key}.json",
+                json.dumps(jsonable_encoder(entry), indent=2).encode("utf-8"),
+            )
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            log.warning("failed to write quarantined input", id=key, error=str(e))
+
+    def clear(self) -> None:
+        """Forget every crash, so quarantined inputs are accepted again"""
+        with self._lock:
+            self._crashes.clear()
+            self._quarantined.clear()
+
+
+def make_dead_letter_queue(
+    dead_letter_config: Dict[str, Any],
+) -> Optional[DeadLetterQueue]:
+    """
+    Return the queue configured by the `serve.dead_letter` section of
+    cog.yaml, or None if inputs that crash the model aren't quarantined.
+    """
+    destination = dead_letter_config.get("destination")
+    if not destination:
+        return None
+    sink = make_sink(destination)
+    if sink is None:
+        log.error(
+            "serve.dead_letter.destination is in S3 but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set, so inputs that crash the model won't be quarantined"
+        )
+        return None
+    return DeadLetterQueue(
+        sink, max_crashes=dead_letter_config.get("max_crashes") or DEFAULT_MAX_CRASHES
+    )
@@ -13,6 +13,8 @@ class Cancel:
 @define
 class PredictionInput:
     payload: Dict[str, Any]
+    # The name of the predictor method to run, or None for predict()
+    method: Optional[str] = None
 
 
 @define
@@ -39,6 +41,14 @@ class PredictionOutput:
     payload: Any
 
 
+@define
+class PredictionStarted:
+    """
+    Sent when a batching worker starts running a prediction, so the parent
+    knows which predictions are running and which are still queued
+    """
+
+
 @define
 class PredictionOutputType:
     multi: bool = False
@@ -49,6 +59,8 @@ class Done:
     canceled: bool = False
     error: bool = False
     error_detail: str = ""
+    # The kind of error, like oom.CUDA_OUT_OF_MEMORY, if it's one Cog recognises
+    error_type: Optional[str] = None
 
 
 @define
@@ -66,6 +78,7 @@ class Envelope:
         PredictionMetric,
         PredictionOutput,
         PredictionOutputType,
+        PredictionStarted,
         Done,
     ]
     tag: Optional[str] = None
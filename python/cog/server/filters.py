@@ -0,0 +1,151 @@
+import os
+from dataclasses import dataclass
+from typing import Any, Callable, Dict, Optional
+
+import requests
+import structlog
+
+from ..predictor import get_predictor, load_full_predictor_from_file
+
+log = structlog.get_logger("cog.server.filters")
+
+DEFAULT_TIMEOUT = 10.0
+
+
+class FilterError(Exception):
+    """Raised when a content filter can't check a prediction."""
+
+
+@dataclass
+class FilterResult:
+    """
+    FilterResult is what a content filter decided about a prediction's input
+    or output. If `replaced` is set, the output is replaced with `output`,
+    like when the filter masks words rather than rejecting them.
+    """
+
+    allowed: bool
+    reason: Optional[str] = None
+    replaced: bool = False
+    output: Any = None
+
+    @classmethod
+    def from_dict(cls, result: Optional[Dict[str, Any]]) -> "FilterResult":
+        if result is None:
+            return cls(allowed=True)
+        if not isinstance(result, dict) or not isinstance(
+            result.get("allowed"), bool
+        ):
+            raise FilterError(
+                f"Content filters must return an object with a boolean 'allowed', got {result!r}"
+            )
+        return cls(
+            allowed=result["allowed"],
+            reason=result.get("reason"),
+            replaced="output" in result,
+            output=result.get("output"),
+        )
+
+
+class ContentFilter:
+    """
+    A ContentFilter checks a prediction's input before the model runs, or its
+    output before it's returned. It's sent an object like
+    {"stage": "output", "id": ..., "input": {...}, "output": ...}, and returns
+    one like {"allowed": false, "reason": "..."}.
+    """
+
+    def check(
+        self,
+        stage: str,
+        prediction_id: Optional[str],
+        inputs: Any,
+        output: Any = None,
+    ) -> FilterResult:
+        payload: Dict[str, Any] = {
+            "stage": stage, "id": prediction_id, "input": inputs
+        }
+        if stage == "output":
+            payload["output"] = output
+        return FilterResult.from_dict(self.call(payload))
+
+    def call(self, payload: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+        raise NotImplementedError
+
+
+class CallableFilter(ContentFilter):
+    """
+    CallableFilter calls a function in the model's code, or an instance of a
+    class, like a classifier that's loaded once when the server starts.
+    """
+
+    def __init__(self, fn: Callable[[Dict[str, Any]], Any]) -> None:
+        self.fn = fn
+
+    @classmethod
+    def from_ref(cls, ref: str) -> "CallableFilter":
+        module_path, name = ref.split(":", 1)
+        module_name = os.path.basename(module_path).split(".py", 1)[0]
+        module = load_full_predictor_from_file(module_path, module_name)
+        return cls(get_predictor(module, name))
+
+    def call(self, payload: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+        try:
+            return self.fn(payload)
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            raise FilterError(str(e)) from e
+
+
+class HTTPFilter(ContentFilter):
+    """
+    HTTPFilter sends predictions to a filter running as a separate service,
+    like a sidecar container, in POST requests.
+    """
+
+    def __init__(
+        self,
+        url: str,
+        timeout: float = DEFAULT_TIMEOUT,
+        session: Optional[requests.Session] = None,
+    ) -> None:
+        self.url = url
+        self.timeout = timeout
+        self.session = session or requests.Session()
+
+    def call(self, payload: Dict[str, Any]) -> Optional[Dict[str, Any]]:
+        try:
+            resp = self.session.post(self.url, json=payload, timeout=self.timeout)
+            resp.raise_for_status()
+            return resp.json()
+        except (requests.RequestException, ValueError) as e:
+            raise FilterError(f"Request to {self.url} failed: {e}") from e
+
+
+@dataclass
+class ContentFilters:
+    input: Optional[ContentFilter] = None
+    output: Optional[ContentFilter] = None
+
+
+def make_content_filters(config: Dict[str, Any]) -> Optional[ContentFilters]:
+    """
+    Return the filters in the `serve.filters` section of cog.yaml, or None if
+    there aren't any.
+    """
+    timeout = config.get("timeout") or DEFAULT_TIMEOUT
+    filters = ContentFilters(
+        input=_make_filter(config.get("input"), timeout),
+        output=_make_filter(config.get("output"), timeout),
+    )
+    if filters.input is None and filters.output is None:
+        return None
+    return filters
+
+
+def _make_filter(ref: Optional[str], timeout: float) -> Optional[ContentFilter]:
+    if not ref:
+        return None
+    if ref.startswith(("http://", "https://")):
+        return HTTPFilter(ref, timeout=timeout)
+    log.info("loading content filter", filter=ref)
+    return CallableFilter.from_ref(ref)
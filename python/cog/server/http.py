@@ -1,6 +1,7 @@
 import argparse
 import asyncio
 import functools
+import json
 import logging
 import os
 import signal
@@ -11,24 +12,27 @@ import threading
 import traceback
 from datetime import datetime, timezone
 from enum import Enum, auto, unique
-from typing import TYPE_CHECKING, Any, Awaitable, Callable, Dict, Optional, Type
+from typing import TYPE_CHECKING, Any, Awaitable, Callable, Dict, List, Optional, Type
 
 import structlog
 import uvicorn
-from fastapi import Body, FastAPI, Header, Path, Response
+from fastapi import Body, FastAPI, Header, Path, Request, Response
+from fastapi.concurrency import run_in_threadpool
 from fastapi.encoders import jsonable_encoder
+from fastapi.middleware.cors import CORSMiddleware
 from fastapi.exceptions import HTTPException
 from fastapi.openapi.utils import get_openapi
 from fastapi.responses import JSONResponse
 from pydantic import ValidationError
 
-from .. import schema
-from ..config import Config
+from .. import schema, uploads
+from ..config import COG_PIPELINE_ENV_VAR, PIPELINE_PREDICTOR_REF, Config
 from ..errors import PredictorNotSet
 from ..files import upload_file
 from ..json import upload_files
 from ..logging import setup_logging
 from ..mode import Mode
+from ..predictor import method_type_name
 from ..types import PYDANTIC_V2
 
 try:
@@ -42,13 +46,39 @@ if PYDANTIC_V2:
         update_openapi_schema_for_pydantic_2,
     )
 
+from .auth import AuthMiddleware, make_authenticator
+from . import oip
+from .cache import (
+    CacheMiddleware,
+    PredictionCache,
+    make_prediction_cache,
+    model_version,
+)
+from .dead_letter import DeadLetterQueue, make_dead_letter_queue
+from .filters import ContentFilters, FilterError, make_content_filters
+from .idle import IdleMiddleware, IdleMonitor
+from .input_limits import InputLimits, make_input_limits
+from .metrics import PredictionMetrics
+from .models import (
+    ModelNotFoundError,
+    ModelPool,
+    ModelPoolFullError,
+    ModelSetupError,
+    make_model_pool,
+)
 from .probes import ProbeHelper
+from .recorder import PredictionRecorder, make_prediction_recorder
+from .rate_limit import RateLimitMiddleware, make_rate_limiter
+from .reload import ReloadableRunner, ReloadError, ReloadInProgressError
+from .request_body import RequestBodyMiddleware
+from .results import PredictionResults, make_prediction_results
 from .runner import (
-    PredictionRunner,
     RunnerBusyError,
     SetupResult,
+    SetupTask,
     UnknownPredictionError,
 )
+from .scheduler import Schedule, ScheduledPredictions, make_scheduled_predictions
 from .telemetry import make_trace_context, trace_context
 from .worker import make_worker
 
@@ -60,6 +90,12 @@ if TYPE_CHECKING:
 
 log = structlog.get_logger("cog.server.http")
 
+# The methods browsers may use when serve.cors doesn't list them
+CORS_DEFAULT_METHODS = ["GET", "POST", "PUT", "PATCH"]
+
+# Response headers that browsers let pages read
+CORS_EXPOSE_HEADERS = ["Cog-Cache", "Location", "Retry-After", "WWW-Authenticate"]
+
 
 @unique
 class Health(Enum):
@@ -105,6 +141,7 @@ def add_setup_failed_routes(
             {
                 "status": app.state.health.name,
                 "setup": app.state.setup_result.to_dict(),
+                "cog_version": __version__,
             }
         )
 
@@ -117,6 +154,8 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
     mode: Mode = Mode.PREDICT,
     is_build: bool = False,
     await_explicit_shutdown: bool = False,  # pylint: disable=redefined-outer-name
+    idle_timeout: Optional[float] = None,
+    schedule: Optional[Schedule] = None,
 ) -> MyFastAPI:
     app = MyFastAPI(  # pylint: disable=redefined-outer-name
         title="Cog",  # TODO: mention model name?
@@ -143,6 +182,54 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
 
     app.openapi = custom_openapi
 
+    # The cache runs after request bodies are converted to JSON, so it sees
+    # the same inputs however they were sent
+    prediction_cache: Optional[PredictionCache] = None
+    if mode == Mode.PREDICT:
+        prediction_cache = make_prediction_cache(
+            cog_config.cache, cog_config.get_predictor_ref(mode=mode)
+        )
+    if prediction_cache is not None:
+        app.add_middleware(CacheMiddleware, cache=prediction_cache)
+    prediction_metrics = PredictionMetrics() if cog_config.metrics else None
+    prediction_recorder: Optional[PredictionRecorder] = None
+    input_limits: Optional[InputLimits] = None
+    content_filters: Optional[ContentFilters] = None
+    prediction_results: Optional[PredictionResults] = None
+    dead_letter: Optional[DeadLetterQueue] = None
+    if mode == Mode.PREDICT:
+        prediction_recorder = make_prediction_recorder(
+            cog_config.record, model_version(cog_config.get_predictor_ref(mode=mode))
+        )
+        input_limits = make_input_limits(cog_config.input_limits)
+        content_filters = make_content_filters(cog_config.filters)
+        prediction_results = make_prediction_results(cog_config.results)
+        dead_letter = make_dead_letter_queue(cog_config.dead_letter)
+    app.add_middleware(
+        RequestBodyMiddleware, max_request_size=cog_config.max_request_size
+    )
+    # Middleware added later runs first, so requests are authenticated, then
+    # rate limited by client, before their bodies are read
+    rate_limiter = make_rate_limiter(cog_config.rate_limit)
+    if rate_limiter is not None:
+        app.add_middleware(RateLimitMiddleware, rate_limiter=rate_limiter)
+    authenticator = make_authenticator(cog_config.auth)
+    if authenticator is not None:
+        app.add_middleware(AuthMiddleware, authenticator=authenticator)
+    # CORS runs before everything else so that preflight requests don't need a
+    # token, and so that errors like 401 and 429 are readable by browsers
+    cors = cog_config.cors
+    if cors:
+        app.add_middleware(
+            CORSMiddleware,
+            allow_origins=cors.get("allowed_origins") or [],
+            allow_methods=cors.get("allowed_methods") or CORS_DEFAULT_METHODS,
+            allow_headers=cors.get("allowed_headers") or ["*"],
+            expose_headers=CORS_EXPOSE_HEADERS,
+        )
+
+    upload_url = upload_url or cog_config.output_upload_url
+
     app.state.health = Health.STARTING
     app.state.setup_result = None
     started_at = datetime.now(tz=timezone.utc)
@@ -159,17 +246,80 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         InputType, OutputType, is_async = cog_config.get_predictor_types(
             mode=Mode.PREDICT
         )
+        # The predictor's other predict methods, by name. They run in the same
+        # worker as predict(), so they have to be async if it is.
+        method_types = {}
+        if mode == Mode.PREDICT:
+            for method in cog_config.predict_methods:
+                method_types[method] = cog_config.get_predictor_types(
+                    mode=Mode.PREDICT, method=method
+                )
+                if method_types[method][2] != is_async:
+                    raise TypeError(
+                        f"{method}() must be async if predict() is, and not async if predict() isn't"
+                    )
+        # The models in `models`, by name, which run in workers of their own
+        model_types = {}
+        if mode == Mode.PREDICT:
+            for model in cog_config.models:
+                model_types[model["name"]] = cog_config.get_model_types(
+                    model["name"], model["predict"]
+                )
     except Exception:  # pylint: disable=broad-exception-caught
         msg = "Error while loading predictor:\n\n" + traceback.format_exc()
         add_setup_failed_routes(app, started_at, msg)
         return app
 
-    worker = make_worker(
-        predictor_ref=cog_config.get_predictor_ref(mode=mode),
-        is_async=is_async,
-        max_concurrency=cog_config.max_concurrency,
+    if cog_config.get_predictor_ref(mode=mode) == PIPELINE_PREDICTOR_REF:
+        # The worker runs the pipeline, so it needs its steps
+        os.environ[COG_PIPELINE_ENV_VAR] = json.dumps(cog_config.pipeline)
+
+    # Only predictions are batched, not training
+    max_batch_size = cog_config.max_batch_size if mode == Mode.PREDICT else 1
+    runner = ReloadableRunner(
+        lambda env: make_worker(
+            predictor_ref=cog_config.get_predictor_ref(mode=mode),
+            is_async=is_async,
+            max_concurrency=cog_config.max_concurrency,
+            max_batch_size=max_batch_size,
+            max_batch_latency=cog_config.max_batch_latency,
+            env=env,
+            retry_on_oom=cog_config.retry_on_oom,
+            oom_batch_size_input=cog_config.oom_batch_size_input,
+        ),
+        max_concurrency=cog_config.max_concurrency * max_batch_size,
+        setup_timeout=cog_config.setup_timeout,
     )
-    runner = PredictionRunner(worker=worker, max_concurrency=cog_config.max_concurrency)
+
+    # The model is always restarted when inputs that crash it are quarantined
+    restart_on_crash = cog_config.restart_on_crash or dead_letter is not None
+    # Set while the worker restarts after a prediction crashed it
+    worker_restarting = threading.Event()
+    worker_restarting_lock = threading.Lock()
+
+    model_pool: Optional[ModelPool] = None
+    if model_types:
+        model_pool = make_model_pool(
+            cog_config.models,
+            cog_config.model_limits,
+            is_async={name: types[2] for name, types in model_types.items()},
+            max_concurrency=cog_config.max_concurrency,
+            setup_timeout=cog_config.setup_timeout,
+        )
+
+    def is_busy() -> bool:
+        return (
+            runner.is_busy()
+            or runner.is_reloading()
+            or (model_pool is not None and model_pool.is_busy())
+        )
+
+    idle_monitor: Optional[IdleMonitor] = None
+    if idle_timeout and shutdown_event:
+        idle_monitor = IdleMonitor(
+            idle_timeout, is_busy=is_busy, on_idle=shutdown_event.set
+        )
+        app.add_middleware(IdleMiddleware, monitor=idle_monitor)
 
     class PredictionRequest(schema.PredictionRequest.with_types(input_type=InputType)):
         pass
@@ -178,6 +328,28 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         input_type=InputType, output_type=OutputType
     )
 
+    def run_scheduled_prediction(inputs: Dict[str, Any]) -> Dict[str, Any]:
+        request = PredictionRequest(input=inputs)
+        task_kwargs: Dict[str, Any] = {}
+        if content_filters is not None and content_filters.output is not None:
+            task_kwargs["output_filter"] = content_filters.output
+        predict_task = runner.predict(request, task_kwargs=task_kwargs)
+        if hasattr(request.input, "cleanup"):
+            predict_task.add_done_callback(lambda _: request.input.cleanup())
+        predict_task.add_done_callback(_handle_predict_done)
+        predict_task.wait()
+        if PYDANTIC_V2:
+            return unwrap_pydantic_serialization_iterators(
+                predict_task.result.model_dump()
+            )
+        return predict_task.result.dict()
+
+    scheduled_predictions: Optional[ScheduledPredictions] = None
+    if mode == Mode.PREDICT:
+        scheduled_predictions = make_scheduled_predictions(
+            schedule, run_scheduled_prediction
+        )
+
     if app_threads is None:
         app_threads = 1 if cog_config.requires_gpu else _cpu_count()
     http_semaphore = asyncio.Semaphore(app_threads)
@@ -199,6 +371,7 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         "predictions_url": "/predictions",
         "predictions_idempotent_url": "/predictions/{prediction_id}",
         "predictions_cancel_url": "/predictions/{prediction_id}/cancel",
+        "uploads_url": "/uploads",
     }
 
     if cog_config.predictor_train_ref:
@@ -230,6 +403,14 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
                 tracestate: Optional[str] = Header(
                     default=None, include_in_schema=False
                 ),
+                cog_output: Optional[str] = Header(default=None),
+                cog_output_upload_url: Optional[List[str]] = Header(default=None),
+                cog_experiment: Optional[str] = Header(
+                    default=None, include_in_schema=False
+                ),
+                cog_variant: Optional[str] = Header(
+                    default=None, include_in_schema=False
+                ),
             ) -> Any:  # type: ignore
                 respond_async = prefer == "respond-async"
 
@@ -238,6 +419,10 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
                         request=request,
                         response_type=TrainingResponse,
                         respond_async=respond_async,
+                        output=cog_output,
+                        output_upload_urls=cog_output_upload_url,
+                        experiment_id=cog_experiment,
+                        variant=cog_variant,
                     )
 
             @app.put(
@@ -255,6 +440,14 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
                 tracestate: Optional[str] = Header(
                     default=None, include_in_schema=False
                 ),
+                cog_output: Optional[str] = Header(default=None),
+                cog_output_upload_url: Optional[List[str]] = Header(default=None),
+                cog_experiment: Optional[str] = Header(
+                    default=None, include_in_schema=False
+                ),
+                cog_variant: Optional[str] = Header(
+                    default=None, include_in_schema=False
+                ),
             ) -> Any:
                 if request.id is not None and request.id != training_id:
                     body = {
@@ -286,6 +479,10 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
                         request=request,
                         response_type=TrainingResponse,
                         respond_async=respond_async,
+                        output=cog_output,
+                        output_upload_urls=cog_output_upload_url,
+                        experiment_id=cog_experiment,
+                        variant=cog_variant,
                     )
 
             @app.post("/trainings/{training_id}/cancel")
@@ -313,6 +510,8 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
 
     @app.on_event("startup")
     def startup() -> None:
+        if prediction_recorder is not None:
+            prediction_recorder.start()
         # check for early setup failures
         if (
             app.state.setup_result
@@ -324,10 +523,27 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         else:
             setup_task = runner.setup()
             setup_task.add_done_callback(_handle_setup_done)
+            if cog_config.setup_timeout:
+                timer = threading.Timer(
+                    cog_config.setup_timeout, _handle_setup_timeout, args=(setup_task,)
+                )
+                timer.daemon = True
+                timer.start()
 
     @app.on_event("shutdown")
     def shutdown() -> None:
-        worker.terminate()
+        if idle_monitor:
+            idle_monitor.stop()
+        if scheduled_predictions is not None:
+            scheduled_predictions.stop()
+        runner.terminate()
+        if model_pool is not None:
+            model_pool.unload_all()
+        # After the runner, so the predictions it finishes are written
+        if prediction_recorder is not None:
+            prediction_recorder.stop()
+        if prediction_results is not None:
+            prediction_results.stop()
 
     @app.get("/")
     async def root() -> Any:
@@ -340,7 +556,21 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         else:
             health = app.state.health
         setup = app.state.setup_result.to_dict() if app.state.setup_result else {}
-        return jsonable_encoder({"status": health.name, "setup": setup})
+        return jsonable_encoder(
+            {"status": health.name, "setup": setup, "cog_version": __version__}
+        )
+
+    if prediction_cache is not None or prediction_metrics is not None:
+        index_document["metrics_url"] = "/metrics"
+
+        @app.get("/metrics", include_in_schema=False)
+        async def metrics() -> Any:
+            body = ""
+            if prediction_metrics is not None:
+                body += prediction_metrics.metrics()
+            if prediction_cache is not None:
+                body += prediction_cache.metrics()
+            return Response(body, media_type="text/plain; version=0.0.4")
 
     @limited
     @app.post(
@@ -353,6 +583,10 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         prefer: Optional[str] = Header(default=None),
         traceparent: Optional[str] = Header(default=None, include_in_schema=False),
         tracestate: Optional[str] = Header(default=None, include_in_schema=False),
+        cog_output: Optional[str] = Header(default=None),
+        cog_output_upload_url: Optional[List[str]] = Header(default=None),
+        cog_experiment: Optional[str] = Header(default=None, include_in_schema=False),
+        cog_variant: Optional[str] = Header(default=None, include_in_schema=False),
     ) -> Any:  # type: ignore
         """
         Run a single prediction on the model
@@ -365,6 +599,10 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
                 request=request,
                 response_type=PredictionResponse,
                 respond_async=respond_async,
+                output=cog_output,
+                output_upload_urls=cog_output_upload_url,
+                experiment_id=cog_experiment,
+                variant=cog_variant,
             )
 
     @limited
@@ -379,6 +617,10 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         prefer: Optional[str] = Header(default=None),
         traceparent: Optional[str] = Header(default=None, include_in_schema=False),
         tracestate: Optional[str] = Header(default=None, include_in_schema=False),
+        cog_output: Optional[str] = Header(default=None),
+        cog_output_upload_url: Optional[List[str]] = Header(default=None),
+        cog_experiment: Optional[str] = Header(default=None, include_in_schema=False),
+        cog_variant: Optional[str] = Header(default=None, include_in_schema=False),
     ) -> Any:
         """
         Run a single prediction on the model (idempotent creation).
@@ -413,44 +655,417 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
                 request=request,
                 response_type=PredictionResponse,
                 respond_async=respond_async,
+                output=cog_output,
+                output_upload_urls=cog_output_upload_url,
+                experiment_id=cog_experiment,
+                variant=cog_variant,
+            )
+
+    def add_predict_method_routes(
+        method: str, method_input_type: Any, method_output_type: Any
+    ) -> None:
+        method_request_type = schema.PredictionRequest.with_types(
+            input_type=method_input_type,
+            name=method_type_name(method, "PredictionRequest"),
+        )
+        method_response_type = schema.PredictionResponse.with_types(
+            input_type=method_input_type,
+            output_type=method_output_type,
+            name=method_type_name(method, "PredictionResponse"),
+        )
+
+        @app.post(
+            f"/predictions/{method}",
+            name=f"predict_{method}",
+            description=f"Run a single prediction with the model's {method}() method",
+            response_model=method_response_type,
+            response_model_exclude_unset=True,
+        )
+        async def predict_method(
+            request: method_request_type = Body(default=None),  # type: ignore
+            prefer: Optional[str] = Header(default=None),
+            traceparent: Optional[str] = Header(default=None, include_in_schema=False),
+            tracestate: Optional[str] = Header(default=None, include_in_schema=False),
+            cog_output: Optional[str] = Header(default=None),
+            cog_output_upload_url: Optional[List[str]] = Header(default=None),
+            cog_experiment: Optional[str] = Header(
+                default=None, include_in_schema=False
+            ),
+            cog_variant: Optional[str] = Header(default=None, include_in_schema=False),
+        ) -> Any:
+            respond_async = prefer == "respond-async"
+
+            with trace_context(make_trace_context(traceparent, tracestate)):
+                return await _predict(
+                    request=request,
+                    request_type=method_request_type,
+                    response_type=method_response_type,
+                    respond_async=respond_async,
+                    output=cog_output,
+                    output_upload_urls=cog_output_upload_url,
+                    experiment_id=cog_experiment,
+                    variant=cog_variant,
+                    method=method,
+                )
+
+        @app.put(
+            f"/predictions/{method}/{{prediction_id}}",
+            name=f"predict_{method}_idempotent",
+            description=f"Run a single prediction with the model's {method}() method (idempotent creation).",
+            response_model=method_response_type,
+            response_model_exclude_unset=True,
+        )
+        async def predict_method_idempotent(
+            prediction_id: str = Path(..., title="Prediction ID"),
+            request: method_request_type = Body(..., title="Prediction Request"),  # type: ignore
+            prefer: Optional[str] = Header(default=None),
+            traceparent: Optional[str] = Header(default=None, include_in_schema=False),
+            tracestate: Optional[str] = Header(default=None, include_in_schema=False),
+            cog_output: Optional[str] = Header(default=None),
+            cog_output_upload_url: Optional[List[str]] = Header(default=None),
+            cog_experiment: Optional[str] = Header(
+                default=None, include_in_schema=False
+            ),
+            cog_variant: Optional[str] = Header(default=None, include_in_schema=False),
+        ) -> Any:
+            if request.id is not None and request.id != prediction_id:
+                body = {
+                    "loc": ("body", "id"),
+                    "msg": "prediction ID must match the ID supplied in the URL",
+                    "type": "value_error",
+                }
+                raise HTTPException(422, [body])
+            request.id = prediction_id
+
+            if runner.is_busy():
+                task = runner.get_predict_task(request.id)
+                if task:
+                    return JSONResponse(
+                        jsonable_encoder(task.result),
+                        status_code=202,
+                    )
+
+            respond_async = prefer == "respond-async"
+
+            with trace_context(make_trace_context(traceparent, tracestate)):
+                return await _predict(
+                    request=request,
+                    request_type=method_request_type,
+                    response_type=method_response_type,
+                    respond_async=respond_async,
+                    output=cog_output,
+                    output_upload_urls=cog_output_upload_url,
+                    experiment_id=cog_experiment,
+                    variant=cog_variant,
+                    method=method,
+                )
+
+    for method, (method_input_type, method_output_type, _) in method_types.items():
+        add_predict_method_routes(method, method_input_type, method_output_type)
+    if method_types:
+        index_document["predict_method_urls"] = {
+            method: f"/predictions/{method}" for method in method_types
+        }
+
+    def add_model_routes(
+        name: str, model_input_type: Any, model_output_type: Any
+    ) -> None:
+        model_request_type = schema.PredictionRequest.with_types(
+            input_type=model_input_type,
+            name=method_type_name(name, "PredictionRequest"),
+        )
+        model_response_type = schema.PredictionResponse.with_types(
+            input_type=model_input_type,
+            output_type=model_output_type,
+            name=method_type_name(name, "PredictionResponse"),
+        )
+
+        @app.post(
+            f"/models/{name}/predictions",
+            name=f"predict_model_{name}",
+            description=f"Run a single prediction on the {name} model",
+            response_model=model_response_type,
+            response_model_exclude_unset=True,
+        )
+        async def predict_model(
+            request: model_request_type = Body(default=None),  # type: ignore
+            prefer: Optional[str] = Header(default=None),
+            traceparent: Optional[str] = Header(default=None, include_in_schema=False),
+            tracestate: Optional[str] = Header(default=None, include_in_schema=False),
+            cog_output: Optional[str] = Header(default=None),
+            cog_output_upload_url: Optional[List[str]] = Header(default=None),
+            cog_experiment: Optional[str] = Header(
+                default=None, include_in_schema=False
+            ),
+            cog_variant: Optional[str] = Header(default=None, include_in_schema=False),
+        ) -> Any:
+            respond_async = prefer == "respond-async"
+
+            with trace_context(make_trace_context(traceparent, tracestate)):
+                return await _predict(
+                    request=request,
+                    request_type=model_request_type,
+                    response_type=model_response_type,
+                    respond_async=respond_async,
+                    output=cog_output,
+                    output_upload_urls=cog_output_upload_url,
+                    experiment_id=cog_experiment,
+                    variant=cog_variant,
+                    model=name,
+                )
+
+        @app.put(
+            f"/models/{name}/predictions/{{prediction_id}}",
+            name=f"predict_model_{name}_idempotent",
+            description=f"Run a single prediction on the {name} model (idempotent creation).",
+            response_model=model_response_type,
+            response_model_exclude_unset=True,
+        )
+        async def predict_model_idempotent(
+            prediction_id: str = Path(..., title="Prediction ID"),
+            request: model_request_type = Body(..., title="Prediction Request"),  # type: ignore
+            prefer: Optional[str] = Header(default=None),
+            traceparent: Optional[str] = Header(default=None, include_in_schema=False),
+            tracestate: Optional[str] = Header(default=None, include_in_schema=False),
+            cog_output: Optional[str] = Header(default=None),
+            cog_output_upload_url: Optional[List[str]] = Header(default=None),
+            cog_experiment: Optional[str] = Header(
+                default=None, include_in_schema=False
+            ),
+            cog_variant: Optional[str] = Header(default=None, include_in_schema=False),
+        ) -> Any:
+            if request.id is not None and request.id != prediction_id:
+                body = {
+                    "loc": ("body", "id"),
+                    "msg": "prediction ID must match the ID supplied in the URL",
+                    "type": "value_error",
+                }
+                raise HTTPException(422, [body])
+            request.id = prediction_id
+
+            assert model_pool is not None
+            task = model_pool.get_predict_task(name, request.id)
+            if task and not task.done():
+                return JSONResponse(
+                    jsonable_encoder(task.result),
+                    status_code=202,
+                )
+
+            respond_async = prefer == "respond-async"
+
+            with trace_context(make_trace_context(traceparent, tracestate)):
+                return await _predict(
+                    request=request,
+                    request_type=model_request_type,
+                    response_type=model_response_type,
+                    respond_async=respond_async,
+                    output=cog_output,
+                    output_upload_urls=cog_output_upload_url,
+                    experiment_id=cog_experiment,
+                    variant=cog_variant,
+                    model=name,
+                )
+
+    for name, (model_input_type, model_output_type, _) in model_types.items():
+        add_model_routes(name, model_input_type, model_output_type)
+
+    if model_pool is not None:
+        index_document["models_url"] = "/models"
+
+        @app.get("/models")
+        async def list_models() -> Any:
+            """
+            List the models in `models` and whether they're loaded
+            """
+            assert model_pool is not None
+            return jsonable_encoder(
+                [model.to_dict() for model in model_pool.models.values()]
             )
 
+        @app.post("/models/{name}/predictions/{prediction_id}/cancel")
+        async def cancel_model_prediction(
+            name: str = Path(..., title="Model name"),
+            prediction_id: str = Path(..., title="Prediction ID"),
+        ) -> Any:
+            """
+            Cancel a running prediction on one of the models
+            """
+            assert model_pool is not None
+            try:
+                model_pool.cancel(name, prediction_id)
+            except (ModelNotFoundError, UnknownPredictionError):
+                return JSONResponse({}, status_code=404)
+            return JSONResponse({}, status_code=200)
+
     async def _predict(
         *,
         request: Optional[PredictionRequest],
         response_type: Type[schema.PredictionResponse],
+        request_type: Optional[Type[schema.PredictionRequest]] = None,
         respond_async: bool = False,
+        output: Optional[str] = None,
+        output_upload_urls: Optional[List[str]] = None,
+        method: Optional[str] = None,
+        model: Optional[str] = None,
+        experiment_id: Optional[str] = None,
+        variant: Optional[str] = None,
     ) -> Response:
         # [compat] If no body is supplied, assume that this model can be run
         # with empty input. This will throw a ValidationError if that's not
         # possible.
         if request is None:
-            request = PredictionRequest(input={})
+            request = (request_type or PredictionRequest)(input={})
         # [compat] If body is supplied but input is None, set it to an empty
         # dictionary so that later code can be simpler.
         if request.input is None:
             request.input = {}  # pylint: disable=attribute-defined-outside-init
+        # The experiment headers take precedence over the request's body
+        if experiment_id or variant:
+            request.experiment = schema.Experiment(id=experiment_id, variant=variant)
 
-        task_kwargs = {}
-        if respond_async:
+        output = output or cog_config.output
+        if output not in ("inline", "upload"):
+            return JSONResponse(
+                {"detail": "Cog-Output must be either 'inline' or 'upload'"},
+                status_code=400,
+            )
+        if output_upload_urls:
+            output = "upload"
+        if output == "upload" and not (upload_url or output_upload_urls):
+            return JSONResponse(
+                {
+                    "detail": "Uploading outputs requires a Cog-Output-Upload-Url header, or an upload URL configured on the server"
+                },
+                status_code=400,
+            )
+
+        if model is None and worker_restarting.is_set():
+            if hasattr(request.input, "cleanup"):
+                request.input.cleanup()
+            return JSONResponse(
+                {"detail": "The model is restarting after a prediction crashed it"},
+                status_code=503,
+            )
+        dead_letter_input: Optional[Dict[str, Any]] = None
+        if model is None and dead_letter is not None:
+            dead_letter_input = jsonable_encoder(request.input)
+            if dead_letter.is_quarantined(dead_letter_input):
+                if hasattr(request.input, "cleanup"):
+                    request.input.cleanup()
+                return JSONResponse(
+                    {
+                        "detail": [
+                            {
+                                "loc": ["body", "input"],
+                                "msg": f"The input was quarantined because it crashed the model {dead_letter.max_crashes} times",
+                                "type": "value_error.quarantined",
+                            }
+                        ]
+                    },
+                    status_code=422,
+                )
+
+        if input_limits is not None:
+            # Files are downloaded to check them, so it's done off the event loop
+            limit_errors = await run_in_threadpool(
+                input_limits.check, dict(request.input)
+            )
+            if limit_errors:
+                if hasattr(request.input, "cleanup"):
+                    request.input.cleanup()
+                return JSONResponse(
+                    {"detail": [e.to_dict() for e in limit_errors]}, status_code=422
+                )
+
+        if content_filters is not None and content_filters.input is not None:
+            try:
+                filter_result = await run_in_threadpool(
+                    content_filters.input.check,
+                    "input",
+                    request.id,
+                    jsonable_encoder(request.input),
+                )
+            except FilterError as e:
+                log.error("failed to check input with content filter", error=str(e))
+                if hasattr(request.input, "cleanup"):
+                    request.input.cleanup()
+                return JSONResponse(
+                    {
+                        "detail": f"The input couldn't be checked by the content filter: {e}"
+                    },
+                    status_code=503,
+                )
+            if not filter_result.allowed:
+                if hasattr(request.input, "cleanup"):
+                    request.input.cleanup()
+                msg = "The input was rejected by the content filter"
+                if filter_result.reason:
+                    msg += f": {filter_result.reason}"
+                return JSONResponse(
+                    {
+                        "detail": [
+                            {
+                                "loc": ["body", "input"],
+                                "msg": msg,
+                                "type": "value_error.content_filter",
+                            }
+                        ]
+                    },
+                    status_code=422,
+                )
+
+        task_kwargs: Dict[str, Any] = {}
+        if content_filters is not None and content_filters.output is not None:
+            task_kwargs["output_filter"] = content_filters.output
+        if respond_async or output == "upload":
             # For now, we only ask PredictionService to handle file uploads for
-            # async predictions. This is unfortunate but required to ensure
-            # backwards-compatible behaviour for synchronous predictions.
+            # async predictions, or when uploads are asked for. This is
+            # unfortunate but required to ensure backwards-compatible behaviour
+            # for synchronous predictions.
             task_kwargs["upload_url"] = upload_url
+            task_kwargs["output_upload_urls"] = output_upload_urls
 
         try:
-            predict_task = runner.predict(request, task_kwargs=task_kwargs)
+            if model is not None:
+                # The model is loaded if it isn't already, which can take a while
+                assert model_pool is not None
+                predict_task = await run_in_threadpool(
+                    model_pool.predict, model, request, task_kwargs
+                )
+            else:
+                predict_task = runner.predict(
+                    request, task_kwargs=task_kwargs, method=method
+                )
         except RunnerBusyError:
             return JSONResponse(
                 {"detail": "Already running a prediction"}, status_code=409
             )
+        except ModelPoolFullError as e:
+            return JSONResponse({"detail": str(e)}, status_code=503)
+        except ModelSetupError as e:
+            body: Dict[str, Any] = {"detail": str(e)}
+            if e.setup_result is not None:
+                body["setup"] = e.setup_result.to_dict()
+            return JSONResponse(jsonable_encoder(body), status_code=500)
 
         if hasattr(request.input, "cleanup"):
             predict_task.add_done_callback(lambda _: request.input.cleanup())
 
-        predict_task.add_done_callback(_handle_predict_done)
+        if model is not None:
+            predict_task.add_done_callback(
+                functools.partial(_handle_model_predict_done, model)
+            )
+        else:
+            if dead_letter is not None and dead_letter_input is not None:
+                predict_task.add_done_callback(
+                    functools.partial(dead_letter.observe, dead_letter_input)
+                )
+            predict_task.add_done_callback(_handle_predict_done)
 
         if respond_async:
+            if prediction_results is not None:
+                prediction_results.save(predict_task.result)
+                predict_task.add_done_callback(prediction_results.save)
             return JSONResponse(
                 jsonable_encoder(predict_task.result),
                 status_code=202,
@@ -481,12 +1096,119 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
         encoded_response = jsonable_encoder(response_object)
         return JSONResponse(content=encoded_response)
 
+    def add_inference_protocol_routes() -> None:
+        """
+        Serve the Open Inference Protocol alongside Cog's own API, so the model
+        can run behind KServe, Seldon Core and Triton-compatible routers. The
+        model serves any model name it's asked for, because there's only one.
+        """
+
+        def is_ready() -> bool:
+            return app.state.health in (Health.READY, Health.BUSY)
+
+        @app.get("/v2", include_in_schema=False)
+        async def inference_server_metadata() -> Any:
+            return {"name": "cog", "version": __version__, "extensions": []}
+
+        @app.get("/v2/health/live", include_in_schema=False)
+        async def inference_server_live() -> Any:
+            return {"live": True}
+
+        @app.get("/v2/health/ready", include_in_schema=False)
+        @app.get("/v2/models/{model_name}/ready", include_in_schema=False)
+        @app.get(
+            "/v2/models/{model_name}/versions/{model_version}/ready",
+            include_in_schema=False,
+        )
+        async def inference_model_ready() -> Any:
+            ready = is_ready()
+            return JSONResponse({"ready": ready}, status_code=200 if ready else 503)
+
+        @app.get("/v2/models/{model_name}", include_in_schema=False)
+        @app.get(
+            "/v2/models/{model_name}/versions/{model_version}", include_in_schema=False
+        )
+        async def inference_model_metadata(model_name: str) -> Any:
+            return oip.model_metadata(model_name, app.openapi())
+
+        @app.post("/v2/models/{model_name}/infer", include_in_schema=False)
+        @app.post(
+            "/v2/models/{model_name}/versions/{model_version}/infer",
+            include_in_schema=False,
+        )
+        async def inference_infer(
+            model_name: str,
+            request: Request,
+            traceparent: Optional[str] = Header(default=None),
+            tracestate: Optional[str] = Header(default=None),
+        ) -> Any:
+            try:
+                body = await request.json()
+                inputs = oip.decode_inputs(body, app.openapi())
+            except (ValueError, oip.InferenceError) as e:
+                return JSONResponse({"error": str(e)}, status_code=400)
+            try:
+                prediction_request = PredictionRequest(input=inputs, id=body.get("id"))
+            except ValidationError as e:
+                return JSONResponse({"error": str(e)}, status_code=400)
+
+            with trace_context(make_trace_context(traceparent, tracestate)):
+                response = await _predict(
+                    request=prediction_request, response_type=PredictionResponse
+                )
+            result = json.loads(bytes(response.body))
+            if response.status_code != 200:
+                return JSONResponse(
+                    {"error": result.get("detail")}, status_code=response.status_code
+                )
+            if result.get("status") != schema.Status.SUCCEEDED:
+                return JSONResponse(
+                    {"error": result.get("error") or "The prediction didn't succeed"},
+                    status_code=500,
+                )
+            try:
+                outputs = oip.encode_outputs(result.get("output"), app.openapi())
+            except oip.InferenceError as e:
+                return JSONResponse({"error": str(e)}, status_code=500)
+            response_body: Dict[str, Any] = {
+                "model_name": model_name,
+                "outputs": outputs,
+            }
+            if result.get("id") is not None:
+                response_body["id"] = result["id"]
+            return JSONResponse(jsonable_encoder(response_body))
+
+    if mode == Mode.PREDICT:
+        add_inference_protocol_routes()
+        index_document["inference_protocol_url"] = "/v2"
+
+    @app.get(
+        "/predictions/{prediction_id}",
+        response_model=PredictionResponse,
+        response_model_exclude_unset=True,
+    )
+    async def get_prediction(
+        prediction_id: str = Path(..., title="Prediction ID"),
+    ) -> Any:
+        """
+        Get a prediction, while it's running, or after it's finished if
+        serve.results is set in cog.yaml
+        """
+        task = runner.get_predict_task(prediction_id)
+        if task is not None:
+            return JSONResponse(jsonable_encoder(task.result))
+        if prediction_results is not None:
+            result = await run_in_threadpool(prediction_results.get, prediction_id)
+            if result is not None:
+                return JSONResponse(result)
+        return JSONResponse({"detail": "Prediction not found"}, status_code=404)
+
     @app.post("/predictions/{prediction_id}/cancel")
     async def cancel(prediction_id: str = Path(..., title="Prediction ID")) -> Any:
         """
         Cancel a running prediction
         """
-        if not runner.is_busy():
+        if not runner.is_busy() and not runner.is_reloading():
             return JSONResponse({}, status_code=404)
         try:
             runner.cancel(prediction_id)
@@ -494,11 +1216,158 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
             return JSONResponse({}, status_code=404)
         return JSONResponse({}, status_code=200)
 
+    @app.post("/admin/reload")
+    async def reload(weights: Optional[str] = Body(default=None, embed=True)) -> Any:
+        """
+        Load the model again, with new weights if they're passed, and swap it in once setup has finished
+        """
+        if app.state.health != Health.READY:
+            return JSONResponse(
+                {"detail": "The model can't be reloaded until setup has finished"},
+                status_code=409,
+            )
+        try:
+            setup_result = await run_in_threadpool(runner.reload, weights)
+        except ReloadInProgressError as e:
+            return JSONResponse({"detail": str(e)}, status_code=409)
+        except ReloadError as e:
+            body: Dict[str, Any] = {"detail": str(e)}
+            if e.setup_result is not None:
+                body["setup"] = e.setup_result.to_dict()
+            return JSONResponse(jsonable_encoder(body), status_code=500)
+
+        app.state.setup_result = setup_result
+        if dead_letter is not None:
+            # The reloaded model could handle the inputs that crashed it
+            dead_letter.clear()
+        if prediction_cache is not None:
+            # Outputs cached before the reload could be from the old weights
+            version = model_version(cog_config.get_predictor_ref(mode=mode))
+            prediction_cache.model_version = f"{version}/reload-{runner.generation}"
+        return JSONResponse(jsonable_encoder({"setup": setup_result.to_dict()}))
+
+    @app.post("/uploads", status_code=201)
+    async def create_upload(
+        request: Request,
+        upload_filename: Optional[str] = Header(default=None),
+    ) -> Any:
+        """
+        Start a file upload, with the first chunk of the file as the request body
+        """
+        upload_id = uploads.create_upload(upload_filename or "file")
+        offset = await _write_upload_chunk(upload_id, 0, request)
+        return JSONResponse(
+            _upload_document(upload_id, offset),
+            status_code=201,
+            headers={"Location": f"/uploads/{upload_id}"},
+        )
+
+    @app.patch("/uploads/{upload_id}")
+    async def append_upload(
+        request: Request,
+        upload_id: str = Path(..., title="Upload ID"),
+        upload_offset: int = Header(...),
+    ) -> Any:
+        """
+        Append the request body to a file upload, starting at the Upload-Offset header
+        """
+        try:
+            offset = await _write_upload_chunk(upload_id, upload_offset, request)
+        except uploads.UploadNotFoundError:
+            return JSONResponse({}, status_code=404)
+        except uploads.UploadOffsetMismatchError as e:
+            return JSONResponse(
+                {"detail": str(e), **_upload_document(upload_id, e.offset)},
+                status_code=409,
+            )
+        return JSONResponse(_upload_document(upload_id, offset))
+
+    @app.get("/uploads/{upload_id}")
+    async def get_upload(upload_id: str = Path(..., title="Upload ID")) -> Any:
+        """
+        Get how much of a file upload has been received, to resume an interrupted upload
+        """
+        try:
+            offset = uploads.upload_offset(upload_id)
+        except uploads.UploadNotFoundError:
+            return JSONResponse({}, status_code=404)
+        return JSONResponse(_upload_document(upload_id, offset))
+
+    async def _write_upload_chunk(
+        upload_id: str, offset: int, request: Request
+    ) -> int:
+        with uploads.open_upload(upload_id, offset) as f:
+            async for chunk in request.stream():
+                f.write(chunk)
+        return uploads.upload_offset(upload_id)
+
+    def _upload_document(upload_id: str, offset: int) -> Dict[str, Any]:
+        return {
+            "id": upload_id,
+            "url": uploads.upload_url(upload_id),
+            "offset": offset,
+        }
+
     def _handle_predict_done(response: schema.PredictionResponse) -> None:
+        if prediction_metrics is not None:
+            prediction_metrics.observe(response)
+        if prediction_recorder is not None:
+            prediction_recorder.record(response)
         if response._fatal_exception:
-            _maybe_shutdown(response._fatal_exception)
+            if restart_on_crash:
+                _restart_worker(response._fatal_exception)
+            else:
+                _maybe_shutdown(response._fatal_exception)
+
+    def _restart_worker(exc: BaseException) -> None:
+        # Every prediction running on the worker fails when it crashes, but it
+        # only needs restarting once
+        with worker_restarting_lock:
+            if worker_restarting.is_set():
+                return
+            worker_restarting.set()
+        log.error("prediction crashed the model, restarting it", exc_info=exc)
+        app.state.health = Health.STARTING
+        threading.Thread(target=_run_worker_restart, daemon=True).start()
+
+    def _run_worker_restart() -> None:
+        try:
+            setup_result = runner.reload()
+        except ReloadInProgressError:
+            # The model is already being reloaded, which replaces the worker
+            log.info("model is already reloading, so it isn't restarted")
+        except ReloadError as e:
+            if e.setup_result is not None:
+                app.state.setup_result = e.setup_result
+            worker_restarting.clear()
+            _maybe_shutdown(e, status=Health.SETUP_FAILED)
+            return
+        else:
+            app.state.setup_result = setup_result
+            log.info("restarted model")
+        app.state.health = Health.READY
+        worker_restarting.clear()
+
+    def _handle_model_predict_done(
+        name: str, response: schema.PredictionResponse
+    ) -> None:
+        if prediction_recorder is not None:
+            prediction_recorder.record(response, model=name)
+        # The server keeps running if one of the models in `models` fails, and
+        # the model is loaded again for its next prediction
+        if response._fatal_exception:
+            log.error(
+                "model encountered fatal error",
+                model=name,
+                exc_info=response._fatal_exception,
+            )
+            assert model_pool is not None
+            model_pool.unload(name)
 
     def _handle_setup_done(setup_result: SetupResult) -> None:
+        if app.state.health == Health.SETUP_FAILED:
+            # Setup already timed out
+            return
         app.state.setup_result = setup_result
 
         if app.state.setup_result.status == schema.Status.SUCCEEDED:
@@ -507,9 +1376,28 @@ def create_app(  # pylint: disable=too-many-arguments,too-many-locals,too-many-s
             # In kubernetes, mark the pod as ready now setup has completed.
             probes = ProbeHelper()
             probes.ready()
+
+            # Only start counting idle time once the model can take predictions
+            if idle_monitor:
+                idle_monitor.start()
+            if scheduled_predictions is not None:
+                scheduled_predictions.start()
         else:
             _maybe_shutdown(Exception("setup failed"), status=Health.SETUP_FAILED)
 
+    def _handle_setup_timeout(setup_task: SetupTask) -> None:
+        if setup_task.done():
+            return
+        msg = f"Setup did not complete within {cog_config.setup_timeout:g} seconds\n"
+        result = setup_task.result
+        app.state.setup_result = SetupResult(
+            started_at=result.started_at,
+            completed_at=datetime.now(tz=timezone.utc),
+            logs=[*result.logs, msg],
+            status=schema.Status.FAILED,
+        )
+        _maybe_shutdown(Exception("setup timed out"), status=Health.SETUP_FAILED)
+
     def _maybe_shutdown(exc: BaseException, *, status: Health = Health.DEFUNCT) -> None:
         log.error("encountered fatal error", exc_info=exc)
         app.state.health = status
@@ -626,7 +1514,59 @@ if __name__ == "__main__":
         choices=list(Mode),
         help="Experimental: Run in 'predict' or 'train' mode",
     )
+    parser.add_argument(
+        "--tls-cert",
+        dest="tls_cert",
+        type=str,
+        default=os.environ.get("COG_TLS_CERT"),
+        help="Path to a PEM certificate to serve HTTPS with. Requires --tls-key.",
+    )
+    parser.add_argument(
+        "--tls-key",
+        dest="tls_key",
+        type=str,
+        default=os.environ.get("COG_TLS_KEY"),
+        help="Path to the PEM private key for --tls-cert",
+    )
+    parser.add_argument(
+        "--idle-timeout",
+        dest="idle_timeout",
+        type=float,
+        default=os.environ.get("COG_IDLE_TIMEOUT"),
+        help="Shut down after this many seconds without requests or running predictions",
+    )
+    parser.add_argument(
+        "--schedule",
+        dest="schedule",
+        type=str,
+        default=os.environ.get("COG_SCHEDULE"),
+        help="Run a prediction on this cron schedule, in UTC, like '0 * * * *' for every hour",
+    )
+    parser.add_argument(
+        "--schedule-input",
+        dest="schedule_input",
+        type=str,
+        default=os.environ.get("COG_SCHEDULE_INPUT", "{}"),
+        help="The scheduled prediction's inputs, as a JSON object, or @ and the path to a JSON file",
+    )
+    parser.add_argument(
+        "--schedule-destination",
+        dest="schedule_destination",
+        type=str,
+        default=os.environ.get("COG_SCHEDULE_DESTINATION", "outputs"),
+        help="A directory, or an s3:// URL, to write scheduled predictions and their output files to",
+    )
     args = parser.parse_args()
+    if bool(args.tls_cert) != bool(args.tls_key):
+        parser.error("--tls-cert and --tls-key must be set together")
+    schedule: Optional[Schedule] = None
+    if args.schedule:
+        try:
+            schedule = Schedule.parse(
+                args.schedule, args.schedule_input, args.schedule_destination
+            )
+        except (OSError, ValueError) as e:
+            parser.error(str(e))
 
     if args.version:
         print(f"cog.server.http {__version__}")
@@ -647,13 +1587,21 @@ if __name__ == "__main__":
     else:
         signal.signal(signal.SIGTERM, signal_set_event(shutdown_event))
 
+    cog_config = Config()
+    # The Cog CLI passes these to the container, but images can be run without it.
+    # Variables that are already set, like with `docker run --env`, take precedence.
+    for name, value in cog_config.environment_variables.items():
+        os.environ.setdefault(name, value)
+
     app = create_app(
-        cog_config=Config(),
+        cog_config=cog_config,
         shutdown_event=shutdown_event,
         app_threads=args.threads,
         upload_url=args.upload_url,
         mode=args.mode,
         await_explicit_shutdown=await_explicit_shutdown,
+        idle_timeout=args.idle_timeout,
+        schedule=schedule,
     )
 
     host: str = args.host
@@ -670,6 +1618,8 @@ if __name__ == "__main__":
         log_config=None,
         # This is the default, but to be explicit: only run a single worker
         workers=1,
+        ssl_certfile=args.tls_cert,
+        ssl_keyfile=args.tls_key,
     )
 
     s = Server(config=server_config)
@@ -0,0 +1,74 @@
+import threading
+import time
+from typing import Callable
+
+import structlog
+from starlette.types import ASGIApp, Receive, Scope, Send
+
+log = structlog.get_logger("cog.server.idle")
+
+# Requests to these paths don't count as activity, so that something polling
+# the server's health doesn't keep it alive.
+IGNORED_PATHS = ("/health-check",)
+
+
+class IdleMonitor:
+    """
+    IdleMonitor calls on_idle once the server has had no requests and no
+    running predictions for `timeout` seconds.
+    """
+
+    def __init__(
+        self,
+        timeout: float,
+        is_busy: Callable[[], bool],
+        on_idle: Callable[[], None],
+        clock: Callable[[], float] = time.monotonic,
+    ) -> None:
+        self.timeout = timeout
+        self._is_busy = is_busy
+        self._on_idle = on_idle
+        self._clock = clock
+        self._last_active = clock()
+        self._stopped = threading.Event()
+        self._thread = threading.Thread(target=self._run, daemon=True)
+
+    def start(self) -> None:
+        self.touch()
+        self._thread.start()
+
+    def stop(self) -> None:
+        self._stopped.set()
+
+    def touch(self) -> None:
+        self._last_active = self._clock()
+
+    def check(self) -> bool:
+        """Call on_idle and return True if the server has been idle for too long."""
+        if self._is_busy():
+            self.touch()
+            return False
+        if self._clock() - self._last_active < self.timeout:
+            return False
+        log.info(f"shutting down after being idle for {self.timeout:g} seconds")
+        self._on_idle()
+        return True
+
+    def _run(self) -> None:
+        interval = min(self.timeout, 5.0)
+        while not self._stopped.wait(interval):
+            if self.check():
+                return
+
+
+class IdleMiddleware:
+    """IdleMiddleware tells an IdleMonitor about every request."""
+
+    def __init__(self, app: ASGIApp, monitor: IdleMonitor) -> None:
+        self.app = app
+        self.monitor = monitor
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        if scope["type"] == "http" and scope["path"] not in IGNORED_PATHS:
+            self.monitor.touch()
+        await self.app(scope, receive, send)
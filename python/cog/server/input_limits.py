@@ -0,0 +1,323 @@
+import json
+import re
+import shutil
+import struct
+import subprocess
+from dataclasses import dataclass
+from pathlib import Path
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import structlog
+
+from ..types import URLPath
+
+log = structlog.get_logger("cog.server.input_limits")
+
+_RESOLUTION_RE = re.compile(r"^([0-9]+)x([0-9]+)$")
+# Words, numbers and punctuation, which roughly matches how tokenizers split
+# text, if there's no tokenizer to count with
+_TOKEN_RE = re.compile(r"\w+|[^\w\s]", re.UNICODE)
+# How much of a file is read to find an image's size
+_IMAGE_HEADER_SIZE = 256 * 1024
+
+
+class InputLimitError(Exception):
+    """Raised when an input breaks its limits in cog.yaml."""
+
+    def __init__(
+        self, name: str, kind: str, message: str, limit: Optional[Any]
+    ) -> None:
+        super().__init__(message)
+        self.name = name
+        self.kind = kind
+        self.limit = limit
+
+    def to_dict(self) -> Dict[str, Any]:
+        """Return the error in the shape of FastAPI's validation errors"""
+        error = {
+            "loc": ["body", "input", self.name],
+            "msg": str(self),
+            "type": f"value_error.{self.kind}",
+        }
+        if self.limit is not None:
+            error["ctx"] = {"limit_value": self.limit}
+        return error
+
+
+@dataclass
+class InputLimit:
+    """
+    InputLimit holds the limits on one of the model's inputs. Unset limits
+    allow anything.
+    """
+
+    max_resolution: Optional[Tuple[int, int]] = None
+    max_duration: Optional[float] = None
+    max_tokens: Optional[int] = None
+    tokenizer: Optional[str] = None
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "InputLimit":
+        max_resolution = None
+        if config.get("max_resolution"):
+            match = _RESOLUTION_RE.match(str(config["max_resolution"]))
+            if match is None:
+                raise ValueError(
+                    f"Invalid max_resolution {config['max_resolution']!r}, expected a resolution like 1024x1024"
+                )
+            max_resolution = (int(match.group(1)), int(match.group(2)))
+        max_duration = config.get("max_duration")
+        max_tokens = config.get("max_tokens")
+        return cls(
+            max_resolution=max_resolution,
+            max_duration=float(max_duration) if max_duration else None,
+            max_tokens=int(max_tokens) if max_tokens else None,
+            tokenizer=config.get("tokenizer"),
+        )
+
+
+class InputLimits:
+    """
+    InputLimits checks the inputs of predictions against the limits in the
+    `serve.input_limits` section of cog.yaml before the model runs, so
+    pathological inputs, like huge images, never reach it.
+    """
+
+    def __init__(self, limits: Dict[str, InputLimit]) -> None:
+        self.limits = limits
+        self._count_tokens: Dict[str, Callable[[str], int]] = {}
+
+    @classmethod
+    def from_config(cls, config: Dict[str, Any]) -> "InputLimits":
+        return cls(
+            {name: InputLimit.from_config(c or {}) for name, c in config.items()}
+        )
+
+    def check(self, inputs: Dict[str, Any]) -> List[InputLimitError]:
+        """
+        Return the ways inputs break their limits. File inputs with limits
+        are downloaded, if they're URLs, to check them.
+        """
+        errors: List[InputLimitError] = []
+        for name, limit in self.limits.items():
+            value = inputs.get(name)
+            if value is None:
+                continue
+            values = value if isinstance(value, list) else [value]
+            for v in values:
+                try:
+                    self._check_value(name, limit, v)
+                except InputLimitError as e:
+                    errors.append(e)
+                    break
+        return errors
+
+    def _check_value(self, name: str, limit: InputLimit, value: Any) -> None:
+        if isinstance(value, str):
+            if limit.max_tokens is not None:
+                tokens = self._tokens(limit)(value)
+                if tokens > limit.max_tokens:
+                    raise InputLimitError(
+                        name,
+                        "max_tokens",
+                        f"{name} is {tokens} tokens long, which is more than the maximum of {limit.max_tokens}",
+                        limit.max_tokens,
+                    )
+            return
+        if not isinstance(value, Path):
+            return
+        try:
+            path = value.convert() if isinstance(value, URLPath) else value
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            raise InputLimitError(
+                name, "download", f"Couldn't download {name}: {e}", None
+            ) from e
+
+        if limit.max_resolution is not None:
+            size = image_size(path)
+            max_width, max_height = limit.max_resolution
+            resolution = f"{max_width}x{max_height}"
+            if size is None:
+                raise InputLimitError(
+                    name,
+                    "max_resolution",
+                    f"Couldn't read the resolution of {name}. It must be a PNG, JPEG, GIF, WebP or BMP image",
+                    resolution,
+                )
+            width, height = size
+            if width > max_width or height > max_height:
+                raise InputLimitError(
+                    name,
+                    "max_resolution",
+                    f"{name} is {width}x{height}, which is larger than the maximum resolution of {resolution}",
+                    resolution,
+                )
+
+        if limit.max_duration is not None:
+            duration = audio_duration(path)
+            if duration is None:
+                raise InputLimitError(
+                    name,
+                    "max_duration",
+                    f"Couldn't read the duration of {name}. It must be a WAV or FLAC file, or ffprobe must be installed to read other formats",
+                    limit.max_duration,
+                )
+            if duration > limit.max_duration:
+                raise InputLimitError(
+                    name,
+                    "max_duration",
+                    f"{name} is {duration:g} seconds long, which is longer than the maximum of {limit.max_duration:g} seconds",
+                    limit.max_duration,
+                )
+
+    def _tokens(self, limit: InputLimit) -> Callable[[str], int]:
+        if limit.tokenizer is None:
+            return count_tokens
+        if limit.tokenizer not in self._count_tokens:
+            # pylint: disable=import-outside-toplevel
+            from tokenizers import Tokenizer  # type: ignore
+
+            tokenizer = Tokenizer.from_file(limit.tokenizer)
+
+            def count_with_tokenizer(text: str) -> int:
+                return len(tokenizer.encode(text).ids)
+
+            self._count_tokens[limit.tokenizer] = count_with_tokenizer
+        return self._count_tokens[limit.tokenizer]
+
+
+def make_input_limits(config: Dict[str, Any]) -> Optional[InputLimits]:
+    """
+    Return the limits in the `serve.input_limits` section of cog.yaml, or None
+    if there aren't any.
+    """
+    if not config:
+        return None
+    return InputLimits.from_config(config)
+
+
+def count_tokens(text: str) -> int:
+    """Return an estimate of how many tokens text is"""
+    return len(_TOKEN_RE.findall(text))
+
+
+def image_size(path: Path) -> Optional[Tuple[int, int]]:
+    """
+    Return the width and height of a PNG, JPEG, GIF, WebP or BMP image from
+    its header, or None if it isn't one
+    """
+    with open(path, "rb") as f:
+        head = f.read(_IMAGE_HEADER_SIZE)
+    try:
+        if head.startswith(b"\x89PNG\r\n\x1a\n") and head[12:16] == b"IHDR":
+            width, height = struct.unpack(">II", head[16:24])
+            return width, height
+        if head[:6] in (b"GIF87a", b"GIF89a"):
+            width, height = struct.unpack("<HH", head[6:10])
+            return width, height
+        if head.startswith(b"BM"):
+            width, height = struct.unpack("<ii", head[18:26])
+            return width, abs(height)
+        if head.startswith(b"RIFF") and head[8:12] == b"WEBP":
+            return _webp_size(head)
+        if head.startswith(b"\xff\xd8"):
+            return _jpeg_size(head)
+    except struct.error:
+        pass
+    return None
+
+
+def _webp_size(head: bytes) -> Optional[Tuple[int, int]]:
+    chunk = head[12:16]
+    if chunk == b"VP8 ":
+        width, height = struct.unpack("<HH", head[26:30])
+        return width & 0x3FFF, height & 0x3FFF
+    if chunk == b"VP8L":
+        bits = struct.unpack("<I", head[21:25])[0]
+        return (bits & 0x3FFF) + 1, ((bits >> 14) & 0x3FFF) + 1
+    if chunk == b"VP8X":
+        width = int.from_bytes(head[24:27], "little") + 1
+        height = int.from_bytes(head[27:30], "little") + 1
+        return width, height
+    return None
+
+
+def _jpeg_size(head: bytes) -> Optional[Tuple[int, int]]:
+    i = 2
+    while i + 9 < len(head):
+        if head[i] != 0xFF:
+            return None
+        marker = head[i + 1]
+        if marker == 0xFF:
+            # Padding
+            i += 1
+            continue
+        length = struct.unpack(">H", head[i + 2 : i + 4])[0]
+        # Start of frame markers, apart from DHT, JPG and DAC
+        if 0xC0 <= marker <= 0xCF and marker not in (0xC4, 0xC8, 0xCC):
+            height, width = struct.unpack(">HH", head[i + 5 : i + 9])
+            return width, height
+        i += 2 + length
+    return None
+
+
+def audio_duration(path: Path) -> Optional[float]:
+    """
+    Return the number of seconds a WAV or FLAC file is long from its header,
+    or of any other format ffprobe can read, or None if it can't be read
+    """
+    with open(path, "rb") as f:
+        head = f.read(64)
+        try:
+            if head.startswith(b"RIFF") and head[8:12] == b"WAVE":
+                return _wav_duration(f)
+            if head.startswith(b"fLaC"):
+                return _flac_duration(head)
+        except struct.error:
+            return None
+    return _ffprobe_duration(path)
+
+
+def _wav_duration(f: Any) -> Optional[float]:
+    f.seek(12)
+    byte_rate = None
+    while True:
+        header = f.read(8)
+        if len(header) < 8:
+            return None
+        chunk_id, size = struct.unpack("<4sI", header)
+        if chunk_id == b"data":
+            return size / byte_rate if byte_rate else None
+        chunk = f.read(size + (size & 1))  # Chunks are padded to an even length
+        if chunk_id == b"fmt ":
+            byte_rate = struct.unpack("<I", chunk[8:12])[0]
+
+
+def _flac_duration(head: bytes) -> Optional[float]:
+    # The STREAMINFO block comes first
+    if head[4] & 0x7F != 0:
+        return None
+    info = int.from_bytes(head[18:26], "big")
+    sample_rate = info >> 44
+    total_samples = info & 0xFFFFFFFFF
+    if not sample_rate or not total_samples:
+        return None
+    return total_samples / sample_rate
+
+
+def _ffprobe_duration(path: Path) -> Optional[float]:
+    ffprobe = shutil.which("ffprobe")
+    if ffprobe is None:
+        return None
+    try:
+        result = subprocess.run(
+            [ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "json"]
+            + [str(path)],
+            capture_output=True,
+            check=True,
+            timeout=30,
+        )
+        return float(json.loads(result.stdout)["format"]["duration"])
+    except (subprocess.SubprocessError, OSError, ValueError, KeyError):
+        log.warning("failed to read the duration of an input with ffprobe")
+        return None
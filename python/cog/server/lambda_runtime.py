@@ -0,0 +1,149 @@
+"""
+Runs a model on AWS Lambda. It's the command of images built with
+`build.target: lambda`: it starts the model's server, then passes the events
+Lambda's runtime API gives it to the server as predictions.
+
+See https://docs.aws.amazon.com/lambda/latest/dg/runtimes-api.html
+"""
+
+import base64
+import json
+import os
+import subprocess
+import sys
+import time
+import urllib.error
+import urllib.request
+from typing import Any, Dict, List, Optional
+
+import structlog
+
+log = structlog.get_logger("cog.server.lambda_runtime")
+
+RUNTIME_API_VERSION = "2018-06-01"
+
+# How long to wait for setup() to finish. Lambda gives up on a function whose
+# initialization takes longer than its timeout anyway.
+SETUP_TIMEOUT = 900
+
+
+def parse_event(event: Any) -> Dict[str, Any]:
+    """
+    Returns the inputs of the prediction an event asks for. Events from a
+    function URL or API Gateway have the request in their body. The inputs can
+    be under "input", like they are when the server is called directly, or be
+    the whole event.
+    """
+    if isinstance(event, dict) and isinstance(event.get("body"), str):
+        body = event["body"]
+        if event.get("isBase64Encoded"):
+            body = base64.b64decode(body).decode("utf-8")
+        event = json.loads(body) if body else {}
+    if not isinstance(event, dict):
+        raise ValueError(f"expected the event to be a JSON object, got {event!r}")
+    inputs = event.get("input", event)
+    if not isinstance(inputs, dict):
+        raise ValueError(f"expected the input to be a JSON object, got {inputs!r}")
+    return inputs
+
+
+def error_body(e: BaseException) -> Dict[str, Any]:
+    return {"errorMessage": str(e), "errorType": type(e).__name__}
+
+
+class Runtime:
+    def __init__(self, runtime_api: str, port: str) -> None:
+        self.runtime_url = f"http://{runtime_api}/{RUNTIME_API_VERSION}/runtime"
+        self.server_url = f"http://127.0.0.1:{port}"
+
+    def wait_until_ready(self, server: subprocess.Popen) -> None:
+        deadline = time.monotonic() + SETUP_TIMEOUT
+        while time.monotonic() < deadline:
+            if server.poll() is not None:
+                raise RuntimeError(
+                    f"the model's server exited with code {server.returncode}"
+                )
+            try:
+                with urllib.request.urlopen(
+                    f"{self.server_url}/health-check", timeout=5
+                ) as resp:
+                    status = json.load(resp).get("status")
+            except (urllib.error.URLError, OSError, ValueError):
+                status = None
+            if status in ("READY", "BUSY"):
+                return
+            if status == "SETUP_FAILED":
+                raise RuntimeError("the model's setup() failed")
+            time.sleep(0.2)
+        raise RuntimeError(f"the model wasn't ready after {SETUP_TIMEOUT} seconds")
+
+    def predict(self, event: Any) -> Dict[str, Any]:
+        request = urllib.request.Request(
+            f"{self.server_url}/predictions",
+            data=json.dumps({"input": parse_event(event)}).encode("utf-8"),
+            headers={"Content-Type": "application/json"},
+            method="POST",
+        )
+        try:
+            with urllib.request.urlopen(request) as resp:
+                prediction = json.load(resp)
+        except urllib.error.HTTPError as e:
+            raise RuntimeError(e.read().decode("utf-8", "replace")) from e
+        if prediction.get("status") != "succeeded":
+            raise RuntimeError(prediction.get("error") or "the prediction failed")
+        return prediction
+
+    def post(
+        self, path: str, body: Any, headers: Optional[Dict[str, str]] = None
+    ) -> None:
+        request = urllib.request.Request(
+            f"{self.runtime_url}{path}",
+            data=json.dumps(body).encode("utf-8"),
+            headers={"Content-Type": "application/json", **(headers or {})},
+            method="POST",
+        )
+        with urllib.request.urlopen(request) as resp:
+            resp.read()
+
+    def serve(self) -> None:
+        while True:
+            # This blocks until Lambda has an event for the function
+            with urllib.request.urlopen(f"{self.runtime_url}/invocation/next") as resp:
+                request_id = resp.headers["Lambda-Runtime-Aws-Request-Id"]
+                event = json.load(resp)
+            try:
+                prediction = self.predict(event)
+            except Exception as e:  # pylint: disable=broad-exception-caught
+                log.error("prediction failed", request_id=request_id, error=str(e))
+                self.post(
+                    f"/invocation/{request_id}/error",
+                    error_body(e),
+                    {"Lambda-Runtime-Function-Error-Type": "Runtime.PredictionError"},
+                )
+                continue
+            self.post(f"/invocation/{request_id}/response", prediction)
+
+
+def main(argv: List[str]) -> None:
+    # The rest of the arguments are the command that starts the model's server
+    command = argv[1:] or [sys.executable, "-m", "cog.server.http"]
+    runtime = Runtime(
+        os.environ["AWS_LAMBDA_RUNTIME_API"], os.environ.get("PORT", "5000")
+    )
+    server = subprocess.Popen(command)
+    try:
+        runtime.wait_until_ready(server)
+    except Exception as e:  # pylint: disable=broad-exception-caught
+        log.error("failed to start the model", error=str(e))
+        runtime.post(
+            "/init/error",
+            error_body(e),
+            {"Lambda-Runtime-Function-Error-Type": "Runtime.InitError"},
+        )
+        server.kill()
+        sys.exit(1)
+    runtime.serve()
+
+
+if __name__ == "__main__":
+    main(sys.argv)
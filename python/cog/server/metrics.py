@@ -0,0 +1,158 @@
+import threading
+from typing import Dict, List, Optional, Sequence, Tuple
+
+from .. import schema
+from .oom import CUDA_OUT_OF_MEMORY
+
+# The upper bounds of the prediction duration histogram's buckets, in seconds
+DURATION_BUCKETS = (0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600)
+
+# The prediction metrics of the resources predictions used, and the counters
+# they're added up in
+USAGE_COUNTERS = {
+    "cpu_time": (
+        "cog_prediction_cpu_seconds_total",
+        "CPU time predictions used.",
+    ),
+    "gpu_time": (
+        "cog_prediction_gpu_seconds_total",
+        "GPU time predictions held GPUs for.",
+    ),
+    "energy": (
+        "cog_prediction_energy_joules_total",
+        "Energy the GPUs and CPUs used while predictions ran, where it can be measured.",
+    ),
+}
+
+
+class _Histogram:
+    def __init__(self, buckets: int) -> None:
+        self.bucket_counts = [0] * buckets
+        self.sum = 0.0
+        self.count = 0
+
+
+class PredictionMetrics:
+    """
+    PredictionMetrics counts the predictions the server has finished by
+    status, and how long the ones that succeeded took, so two versions of a
+    model can be compared on live traffic. Predictions that are part of an
+    experiment are counted separately for each of its variants. The resources
+    predictions used, like CPU and GPU time, are added up too, for chargeback,
+    and predictions that failed with errors Cog recognises, like running out of
+    GPU memory, are counted by the type of error.
+    """
+
+    def __init__(self, buckets: Sequence[float] = DURATION_BUCKETS) -> None:
+        self.buckets = list(buckets)
+        # Keyed by the experiment's labels, which are "" outside an experiment
+        self.counts: Dict[Tuple[str, str], int] = {
+            ("", status.value): 0
+            for status in (
+                schema.Status.SUCCEEDED,
+                schema.Status.FAILED,
+                schema.Status.CANCELED,
+            )
+        }
+        # Keyed by the experiment's labels and the type of error
+        self.errors: Dict[Tuple[str, str], int] = {("", CUDA_OUT_OF_MEMORY): 0}
+        self.durations: Dict[str, _Histogram] = {"": _Histogram(len(self.buckets))}
+        # Keyed by metric, then by the experiment's labels
+        self.usage: Dict[str, Dict[str, float]] = {
+            name: {"": 0.0} for name in USAGE_COUNTERS
+        }
+        self._lock = threading.Lock()
+
+    def observe(self, response: schema.PredictionResponse) -> None:
+        """Record a prediction that has finished"""
+        if response.status is None:
+            return
+        status = schema.Status(response.status).value
+        labels = experiment_labels(response.experiment)
+        duration: Optional[float] = None
+        if response.metrics and "predict_time" in response.metrics:
+            duration = float(response.metrics["predict_time"])
+        with self._lock:
+            self.counts[(labels, status)] = self.counts.get((labels, status), 0) + 1
+            if response.error_type:
+                key = (labels, response.error_type)
+                self.errors[key] = self.errors.get(key, 0) + 1
+            for name, totals in self.usage.items():
+                if response.metrics and name in response.metrics:
+                    value = float(response.metrics[name])
+                    totals[labels] = totals.get(labels, 0.0) + value
+            if duration is None:
+                return
+            histogram = self.durations.get(labels)
+            if histogram is None:
+                histogram = self.durations[labels] = _Histogram(len(self.buckets))
+            histogram.sum += duration
+            histogram.count += 1
+            for i, bound in enumerate(self.buckets):
+                if duration <= bound:
+                    histogram.bucket_counts[i] += 1
+
+    def metrics(self) -> str:
+        """Return the metrics in Prometheus's text format"""
+        with self._lock:
+            lines: List[str] = [
+                "# HELP cog_predictions_total Predictions that have finished, by status.",
+                "# TYPE cog_predictions_total counter",
+            ]
+            for (labels, status), count in self.counts.items():
+                series = _series(f'status="{status}"', labels)
+                lines.append(f"cog_predictions_total{series} {count}")
+            lines += [
+                "# HELP cog_prediction_errors_total Predictions that failed, by the type of error.",
+                "# TYPE cog_prediction_errors_total counter",
+            ]
+            for (labels, error_type), count in self.errors.items():
+                series = _series(f'type="{_escape(error_type)}"', labels)
+                lines.append(f"cog_prediction_errors_total{series} {count}")
+            lines += [
+                "# HELP cog_prediction_duration_seconds How long predictions that succeeded took.",
+                "# TYPE cog_prediction_duration_seconds histogram",
+            ]
+            for labels, histogram in self.durations.items():
+                for bound, count in zip(self.buckets, histogram.bucket_counts):
+                    series = _series(labels, f'le="{bound:g}"')
+                    lines.append(
+                        f"cog_prediction_duration_seconds_bucket{series} {count}"
+                    )
+                series = _series(labels, 'le="+Inf"')
+                lines += [
+                    f"cog_prediction_duration_seconds_bucket{series} {histogram.count}",
+                    f"cog_prediction_duration_seconds_sum{_series(labels)} {histogram.sum}",
+                    f"cog_prediction_duration_seconds_count{_series(labels)} {histogram.count}",
+                ]
+            for name, (counter, description) in USAGE_COUNTERS.items():
+                lines += [
+                    f"# HELP {counter} {description}", f"# TYPE {counter} counter"
+                ]
+                for labels, total in self.usage[name].items():
+                    lines.append(f"{counter}{_series(labels)} {total}")
+        return "\n".join(lines) + "\n"
+
+
+def experiment_labels(experiment: Optional[schema.Experiment]) -> str:
+    """
+    Return the Prometheus labels of the experiment a prediction is part of,
+    like 'experiment="checkout",variant="b"', or "" if it isn't part of one
+    """
+    if experiment is None:
+        return ""
+    labels = []
+    if experiment.id:
+        labels.append(f'experiment="{_escape(experiment.id)}"')
+    if experiment.variant:
+        labels.append(f'variant="{_escape(experiment.variant)}"')
+    return ",".join(labels)
+
+
+def _series(*labels: str) -> str:
+    joined = ",".join(label for label in labels if label)
+    return f"{{{joined}}}" if joined else ""
+
+
+def _escape(value: str) -> str:
+    return value.replace("\\", "\\\\").replace('"', '\\"').replace("\n", "\\n")
@@ -0,0 +1,308 @@
+import threading
+import time
+from concurrent import futures
+from typing import Any, Callable, Dict, List, Optional
+
+import structlog
+
+from .. import schema
+from ..downloads import parse_quantity
+from .runner import PredictionRunner, PredictTask, SetupResult
+from .worker import Worker, make_worker
+
+log = structlog.get_logger("cog.server.models")
+
+
+class ModelNotFoundError(Exception):
+    pass
+
+
+class ModelSetupError(Exception):
+    def __init__(self, message: str, setup_result: Optional[SetupResult] = None):
+        super().__init__(message)
+        self.setup_result = setup_result
+
+
+class ModelPoolFullError(Exception):
+    pass
+
+
+class Model:
+    """
+    Model is one of the models in `models` in cog.yaml. It runs in a worker
+    process of its own, which is started when the model is loaded and stopped
+    when it's unloaded.
+    """
+
+    def __init__(
+        self,
+        name: str,
+        predictor_ref: str,
+        *,
+        is_async: bool,
+        memory: Optional[int] = None,
+        max_concurrency: int = 1,
+        setup_timeout: Optional[float] = None,
+    ) -> None:
+        self.name = name
+        self.predictor_ref = predictor_ref
+        self.is_async = is_async
+        # How much memory the model says it uses, or None to measure it
+        self.memory = memory
+        self.max_concurrency = max_concurrency
+        self.setup_timeout = setup_timeout
+
+        self.runner: Optional[PredictionRunner] = None
+        self.loading = False
+        self.last_used = 0.0
+        self.setup_result: Optional[SetupResult] = None
+        # Held while the model loads, so it's only loaded once
+        self.load_lock = threading.Lock()
+        self._worker: Optional[Worker] = None
+
+    @property
+    def status(self) -> str:
+        if self.loading:
+            return "loading"
+        if self.runner is not None:
+            return "loaded"
+        return "unloaded"
+
+    def load(self) -> None:
+        """Start the model's worker and run setup(), or raise ModelSetupError"""
+        log.info("loading model", model=self.name)
+        worker = make_worker(
+            predictor_ref=self.predictor_ref,
+            is_async=self.is_async,
+            max_concurrency=self.max_concurrency,
+        )
+        runner = PredictionRunner(worker=worker, max_concurrency=self.max_concurrency)
+        setup_task = runner.setup()
+        try:
+            setup_task.wait(timeout=self.setup_timeout)
+        except futures.TimeoutError as e:
+            worker.terminate()
+            raise ModelSetupError(
+                f"Model {self.name} didn't finish setup within {self.setup_timeout:g} seconds"
+            ) from e
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            worker.terminate()
+            self.setup_result = setup_task.result
+            raise ModelSetupError(
+                f"Model {self.name} failed to load: {e}", setup_task.result
+            ) from e
+        self.setup_result = setup_task.result
+        self._worker = worker
+        self.runner = runner
+        log.info("loaded model", model=self.name)
+
+    def unload(self) -> None:
+        """Stop the model's worker, freeing the memory it uses"""
+        if self._worker is None:
+            return
+        log.info("unloading model", model=self.name)
+        self._worker.terminate()
+        self._worker = None
+        self.runner = None
+
+    def is_busy(self) -> bool:
+        return self.loading or (self.runner is not None and self.runner.is_busy())
+
+    def memory_used(self) -> int:
+        """
+        The memory the model uses in bytes: what it says it uses, or the
+        resident memory of its worker process if it doesn't say. It's 0 if it
+        isn't loaded and doesn't say.
+        """
+        if self.memory is not None:
+            return self.memory
+        if self._worker is None or self._worker.pid is None:
+            return 0
+        return _resident_memory(self._worker.pid)
+
+    def to_dict(self) -> Dict[str, Any]:
+        result: Dict[str, Any] = {
+            "name": self.name,
+            "status": self.status,
+            "predictions_url": f"/models/{self.name}/predictions",
+        }
+        if self.runner is not None or self.memory is not None:
+            result["memory"] = self.memory_used()
+        if self.setup_result is not None:
+            result["setup"] = self.setup_result.to_dict()
+        return result
+
+
+class ModelPool:
+    """
+    ModelPool loads models when predictions are first run on them. When
+    loading a model would put the pool over its limits, it unloads the least
+    recently used models that aren't running predictions to make room.
+    """
+
+    def __init__(
+        self,
+        models: List[Model],
+        max_loaded: Optional[int] = None,
+        max_memory: Optional[int] = None,
+        clock: Callable[[], float] = time.monotonic,
+    ) -> None:
+        self.models = {model.name: model for model in models}
+        self.max_loaded = max_loaded
+        self.max_memory = max_memory
+        self._clock = clock
+        # Held while models are loaded, unloaded or start predictions, so a
+        # model is never unloaded while a prediction starts on it
+        self._lock = threading.Lock()
+
+    def model(self, name: str) -> Model:
+        model = self.models.get(name)
+        if model is None:
+            raise ModelNotFoundError(f"There's no model called {name}")
+        return model
+
+    def predict(
+        self,
+        name: str,
+        request: schema.PredictionRequest,
+        task_kwargs: Optional[Dict[str, Any]] = None,
+    ) -> PredictTask:
+        """
+        Start a prediction on a model, loading it first if it isn't loaded.
+        This blocks while the model loads.
+        """
+        model = self.model(name)
+        while True:
+            self._load(model)
+            with self._lock:
+                # Another model could have unloaded it while this one waited
+                # for the lock, in which case it's loaded again
+                if model.runner is not None:
+                    model.last_used = self._clock()
+                    return model.runner.predict(request, task_kwargs=task_kwargs)
+
+    def get_predict_task(self, name: str, prediction_id: str) -> Optional[PredictTask]:
+        runner = self.model(name).runner
+        if runner is None:
+            return None
+        return runner.get_predict_task(prediction_id)
+
+    def cancel(self, name: str, prediction_id: str) -> None:
+        runner = self.model(name).runner
+        if runner is None:
+            raise ModelNotFoundError(f"Model {name} isn't loaded")
+        runner.cancel(prediction_id)
+
+    def unload(self, name: str) -> None:
+        with self._lock:
+            self.model(name).unload()
+
+    def unload_all(self) -> None:
+        with self._lock:
+            for model in self.models.values():
+                model.unload()
+
+    def is_busy(self) -> bool:
+        return any(model.is_busy() for model in self.models.values())
+
+    def _load(self, model: Model) -> None:
+        with model.load_lock:
+            with self._lock:
+                if model.runner is not None:
+                    return
+                self._make_room(model, strict=True)
+                model.loading = True
+            try:
+                model.load()
+            finally:
+                model.loading = False
+            # Now the model's memory can be measured, others might have to be
+            # unloaded after all
+            with self._lock:
+                model.last_used = self._clock()
+                self._make_room(model, strict=False)
+
+    def _make_room(self, model: Model, *, strict: bool) -> None:
+        """
+        Unload models until there's room for model. If strict is True, raise
+        ModelPoolFullError if there can't be, because the other models are
+        busy; otherwise, make as much room as possible.
+        """
+        while not self._has_room(model):
+            candidates = [
+                m
+                for m in self.models.values()
+                if m is not model and m.runner is not None and not m.is_busy()
+            ]
+            if not candidates:
+                if strict:
+                    raise ModelPoolFullError(
+                        f"Can't load model {model.name}: the models that are loaded are running predictions"
+                    )
+                log.warning(
+                    "models use more memory than serve.models.max_memory",
+                    model=model.name,
+                )
+                return
+            victim = min(candidates, key=lambda m: m.last_used)
+            victim.unload()
+
+    def _has_room(self, model: Model) -> bool:
+        others = [
+            m
+            for m in self.models.values()
+            if m is not model and (m.runner is not None or m.loading)
+        ]
+        if self.max_loaded is not None and len(others) + 1 > self.max_loaded:
+            return False
+        if self.max_memory is not None:
+            used = sum(m.memory_used() for m in others) + model.memory_used()
+            if used > self.max_memory:
+                return False
+        return True
+
+
+def make_model_pool(
+    models_config: List[Dict[str, Any]],
+    limits: Dict[str, Any],
+    is_async: Dict[str, bool],
+    max_concurrency: int = 1,
+    setup_timeout: Optional[float] = None,
+) -> ModelPool:
+    """
+    Return the pool of the models in `models` in cog.yaml, with the limits in
+    serve.models. is_async says whether each model's predict() is async.
+    """
+    models = []
+    for config in models_config:
+        name = config["name"]
+        memory = config.get("memory")
+        models.append(
+            Model(
+                name,
+                config["predict"],
+                is_async=is_async[name],
+                memory=parse_quantity(str(memory)) if memory else None,
+                # Only async predictors can run predictions concurrently
+                max_concurrency=max_concurrency if is_async[name] else 1,
+                setup_timeout=setup_timeout,
+            )
+        )
+    max_memory = limits.get("max_memory")
+    return ModelPool(
+        models,
+        max_loaded=limits.get("max_loaded") or None,
+        max_memory=parse_quantity(str(max_memory)) if max_memory else None,
+    )
+
+
+def _resident_memory(pid: int) -> int:
+    """Return the resident memory of a process in bytes, or 0 if it can't be read"""
+    try:
+        with open(f"/proc/{pid}/status", encoding="utf-8") as f:
+            for line in f:
+                if line.startswith("VmRSS:"):
+                    return int(line.split()[1]) * 1024
+    except (OSError, ValueError, IndexError):
+        pass
+    return 0
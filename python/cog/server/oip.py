@@ -0,0 +1,200 @@
+"""
+The Open Inference Protocol, which KServe calls V2, for running predictions
+behind KServe, Seldon Core and Triton-compatible routers.
+
+The model's inputs and outputs are tensors with the same names. Strings,
+choices and files are BYTES, with files as URLs, integers are INT64, numbers
+are FP64 and booleans are BOOL. Each is a tensor with one element, or any
+number for lists. Inputs that can't be tensors, like dictionaries, can be
+passed in the request's parameters.
+
+See https://github.com/kserve/open-inference-protocol
+"""
+
+from typing import Any, Dict, List, Optional, Tuple
+
+PLATFORM = "cog"
+
+_DATATYPES = {
+    "string": "BYTES",
+    "integer": "INT64",
+    "number": "FP64",
+    "boolean": "BOOL",
+}
+
+
+class InferenceError(Exception):
+    """
+    A request that can't be translated to the model's inputs
+    """
+
+
+def _resolve(schema: Dict[str, Any], openapi_schema: Dict[str, Any]) -> Dict[str, Any]:
+    # Choices are a reference to an enum schema
+    all_of = schema.get("allOf")
+    if isinstance(all_of, list) and len(all_of) == 1:
+        schema = all_of[0]
+    ref = schema.get("$ref")
+    if isinstance(ref, str) and ref.startswith("#/components/schemas/"):
+        name = ref[len("#/components/schemas/") :]
+        return openapi_schema.get("components", {}).get("schemas", {}).get(name, {})
+    return schema
+
+
+def _tensor_type(
+    schema: Dict[str, Any], openapi_schema: Dict[str, Any]
+) -> Optional[Tuple[str, bool]]:
+    """
+    Returns the datatype of a property and whether it's a list, or None if it
+    can't be a tensor
+    """
+    schema = _resolve(schema, openapi_schema)
+    is_list = schema.get("type") == "array"
+    if is_list:
+        schema = _resolve(schema.get("items") or {}, openapi_schema)
+    datatype = _DATATYPES.get(schema.get("type", ""))
+    if datatype is None:
+        return None
+    return datatype, is_list
+
+
+def _sorted_properties(schema: Dict[str, Any]) -> List[Tuple[str, Dict[str, Any]]]:
+    properties = schema.get("properties") or {}
+    return sorted(properties.items(), key=lambda p: (p[1].get("x-order", 0), p[0]))
+
+
+def _component(openapi_schema: Dict[str, Any], name: str) -> Dict[str, Any]:
+    return openapi_schema.get("components", {}).get("schemas", {}).get(name) or {}
+
+
+def _output_properties(
+    openapi_schema: Dict[str, Any],
+) -> List[Tuple[str, Dict[str, Any]]]:
+    output = _resolve(_component(openapi_schema, "Output"), openapi_schema)
+    # Outputs that are objects, like a BaseModel, are a tensor for each of their fields
+    if output.get("type") == "object" and output.get("properties"):
+        return _sorted_properties(output)
+    return [("output", output)]
+
+
+def model_metadata(name: str, openapi_schema: Dict[str, Any]) -> Dict[str, Any]:
+    """
+    Returns the model's metadata, with its inputs and outputs as tensors
+    """
+
+    def tensors(properties: List[Tuple[str, Dict[str, Any]]]) -> List[Dict[str, Any]]:
+        result = []
+        for prop_name, prop in properties:
+            tensor_type = _tensor_type(prop, openapi_schema)
+            if tensor_type is None:
+                continue
+            datatype, is_list = tensor_type
+            result.append(
+                {
+                    "name": prop_name,
+                    "datatype": datatype,
+                    "shape": [-1] if is_list else [1],
+                }
+            )
+        return result
+
+    return {
+        "name": name,
+        "platform": PLATFORM,
+        "inputs": tensors(_sorted_properties(_component(openapi_schema, "Input"))),
+        "outputs": tensors(_output_properties(openapi_schema)),
+    }
+
+
+def _flatten(data: Any) -> List[Any]:
+    if not isinstance(data, list):
+        return [data]
+    flat = []
+    for d in data:
+        flat.extend(_flatten(d))
+    return flat
+
+
+def decode_inputs(
+    request: Dict[str, Any], openapi_schema: Dict[str, Any]
+) -> Dict[str, Any]:
+    """
+    Returns the model's inputs from an inference request's input tensors, and
+    its parameters for inputs that aren't tensors
+    """
+    if not isinstance(request, dict):
+        raise InferenceError("The request must be a JSON object")
+    properties = dict(_sorted_properties(_component(openapi_schema, "Input")))
+
+    inputs: Dict[str, Any] = {}
+    parameters = request.get("parameters") or {}
+    if not isinstance(parameters, dict):
+        raise InferenceError("parameters must be an object")
+    for name, value in parameters.items():
+        if name in properties:
+            inputs[name] = value
+
+    tensors = request.get("inputs") or []
+    if not isinstance(tensors, list):
+        raise InferenceError("inputs must be a list of tensors")
+    for tensor in tensors:
+        if not isinstance(tensor, dict) or not isinstance(tensor.get("name"), str):
+            raise InferenceError("Each input must be a tensor with a name")
+        name = tensor["name"]
+        if name not in properties:
+            raise InferenceError(f"The model doesn't have an input named {name}")
+        tensor_type = _tensor_type(properties[name], openapi_schema)
+        if tensor_type is None:
+            raise InferenceError(
+                f"Input {name} can't be a tensor. Pass it in the request's parameters"
+            )
+        _, is_list = tensor_type
+        data = _flatten(tensor.get("data"))
+        if is_list:
+            inputs[name] = data
+        elif len(data) == 1:
+            inputs[name] = data[0]
+        else:
+            raise InferenceError(
+                f"Input {name} has {len(data)} elements, but it's a single value"
+            )
+    return inputs
+
+
+def _datatype_of(value: Any) -> str:
+    if isinstance(value, bool):
+        return "BOOL"
+    if isinstance(value, int):
+        return "INT64"
+    if isinstance(value, float):
+        return "FP64"
+    return "BYTES"
+
+
+def _encode_tensor(
+    name: str, value: Any, schema: Dict[str, Any], openapi_schema: Dict[str, Any]
+) -> Dict[str, Any]:
+    data = value if isinstance(value, list) else [value]
+    tensor_type = _tensor_type(schema, openapi_schema)
+    if tensor_type is not None:
+        datatype = tensor_type[0]
+    else:
+        datatype = _datatype_of(data[0]) if data else "BYTES"
+    return {"name": name, "datatype": datatype, "shape": [len(data)], "data": data}
+
+
+def encode_outputs(output: Any, openapi_schema: Dict[str, Any]) -> List[Dict[str, Any]]:
+    """
+    Returns a prediction's output as output tensors. Files must already have
+    been converted to URLs.
+    """
+    properties = _output_properties(openapi_schema)
+    if len(properties) == 1 and properties[0][0] == "output":
+        return [_encode_tensor("output", output, properties[0][1], openapi_schema)]
+    if not isinstance(output, dict):
+        raise InferenceError("The model's output isn't an object")
+    return [
+        _encode_tensor(name, output[name], prop, openapi_schema)
+        for name, prop in properties
+        if name in output
+    ]
@@ -0,0 +1,43 @@
+import gc
+import sys
+
+# The error type of predictions that failed because the GPU ran out of memory
+CUDA_OUT_OF_MEMORY = "cuda_out_of_memory"
+
+# What frameworks put in the messages of their out of memory errors
+_OUT_OF_MEMORY_MESSAGES = (
+    # PyTorch
+    "CUDA out of memory",
+    # CUDA's driver API, like in CuPy
+    "CUDA_ERROR_OUT_OF_MEMORY",
+    "cudaErrorMemoryAllocation",
+    # TensorFlow and JAX
+    "RESOURCE_EXHAUSTED: Out of memory",
+)
+
+
+def is_cuda_out_of_memory(e: BaseException) -> bool:
+    """Whether an exception is the GPU running out of memory"""
+    # torch.cuda.OutOfMemoryError, and torch.OutOfMemoryError since 2.5
+    if type(e).__name__ == "OutOfMemoryError":
+        return True
+    message = str(e)
+    return any(m in message for m in _OUT_OF_MEMORY_MESSAGES)
+
+
+def empty_cuda_cache() -> None:
+    """
+    Release the GPU memory PyTorch has cached, if the model uses PyTorch, so
+    the next prediction has as much as possible
+    """
+    torch = sys.modules.get("torch")
+    if torch is None:
+        return
+    try:
+        if torch.cuda.is_available():
+            # Tensors the failed prediction still refers to, like in its
+            # traceback, are only freed once they're collected
+            gc.collect()
+            torch.cuda.empty_cache()
+    except Exception:  # pylint: disable=broad-exception-caught
+        pass
@@ -17,6 +17,9 @@ class ProbeHelper:
             log.info("Not running in Kubernetes: disabling probe helpers.")
             return
 
+        # Models with a read-only root filesystem write their state somewhere else
+        if root is None:
+            root = os.environ.get("COG_PROBE_DIR")
         if root is not None:
             self._root = Path(root)
 
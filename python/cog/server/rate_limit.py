@@ -0,0 +1,184 @@
+import math
+import threading
+import time
+from typing import Any, Callable, Dict, Optional
+
+from starlette.responses import JSONResponse
+from starlette.types import ASGIApp, Receive, Scope, Send
+
+from .auth import CLIENT_ID_STATE_KEY
+
+# Paths whose POST and PUT requests start predictions or trainings, and so
+# count towards rate limits.
+RATE_LIMITED_PATH_PREFIXES = (
+    "/predictions",
+    "/trainings",
+    "/models/",
+    # The Open Inference Protocol's infer endpoint
+    "/v2/models/",
+)
+
+# Per-client buckets are forgotten once there are this many of them, so that
+# lots of one-off clients can't use up memory.
+MAX_CLIENTS = 10000
+
+
+class TokenBucket:
+    """
+    TokenBucket allows bursts of up to `burst` requests, refilled at `rate`
+    requests per second.
+    """
+
+    def __init__(self, rate: float, burst: int, now: float) -> None:
+        self.rate = rate
+        self.burst = burst
+        self.tokens = float(burst)
+        self.updated_at = now
+
+    def _refill(self, now: float) -> None:
+        elapsed = max(0.0, now - self.updated_at)
+        self.tokens = min(float(self.burst), self.tokens + elapsed * self.rate)
+        self.updated_at = now
+
+    def wait_time(self, now: float) -> float:
+        """Return how many seconds until a request is allowed, or 0 if it is."""
+        self._refill(now)
+        if self.tokens >= 1:
+            return 0.0
+        return (1 - self.tokens) / self.rate
+
+    def take(self) -> None:
+        self.tokens -= 1
+
+
+class RateLimiter:
+    """
+    RateLimiter enforces a limit on requests from all clients together, and a
+    separate limit on requests from each client.
+    """
+
+    def __init__(
+        self,
+        requests_per_second: Optional[float] = None,
+        burst: Optional[int] = None,
+        per_client_requests_per_second: Optional[float] = None,
+        per_client_burst: Optional[int] = None,
+        clock: Callable[[], float] = time.monotonic,
+    ) -> None:
+        self._clock = clock
+        self._lock = threading.Lock()
+        self._global: Optional[TokenBucket] = None
+        if requests_per_second:
+            self._global = TokenBucket(
+                requests_per_second,
+                burst or _default_burst(requests_per_second),
+                clock(),
+            )
+        self._per_client_rate = per_client_requests_per_second
+        self._per_client_burst = per_client_burst or (
+            _default_burst(per_client_requests_per_second)
+            if per_client_requests_per_second
+            else 0
+        )
+        self._clients: Dict[str, TokenBucket] = {}
+
+    def acquire(self, client_id: str) -> float:
+        """
+        Count a request from client_id. Returns 0 if the request is allowed, or
+        the number of seconds to wait before retrying if it isn't.
+        """
+        with self._lock:
+            now = self._clock()
+            buckets = []
+            if self._global is not None:
+                buckets.append(self._global)
+            if self._per_client_rate:
+                buckets.append(self._client_bucket(client_id, now))
+
+            wait = max((b.wait_time(now) for b in buckets), default=0.0)
+            if wait > 0:
+                return wait
+            for b in buckets:
+                b.take()
+            return 0.0
+
+    def _client_bucket(self, client_id: str, now: float) -> TokenBucket:
+        bucket = self._clients.get(client_id)
+        if bucket is None:
+            if len(self._clients) >= MAX_CLIENTS:
+                self._clients.clear()
+            assert self._per_client_rate
+            bucket = TokenBucket(self._per_client_rate, self._per_client_burst, now)
+            self._clients[client_id] = bucket
+        return bucket
+
+
+def _default_burst(rate: float) -> int:
+    return max(1, math.ceil(rate))
+
+
+def make_rate_limiter(rate_limit_config: Dict[str, Any]) -> Optional[RateLimiter]:
+    """
+    Return the rate limiter configured by the `serve.rate_limit` section of
+    cog.yaml, or None if requests aren't rate limited.
+    """
+    requests_per_second = rate_limit_config.get("requests_per_second")
+    per_client_requests_per_second = rate_limit_config.get(
+        "per_client_requests_per_second"
+    )
+    if not requests_per_second and not per_client_requests_per_second:
+        return None
+    return RateLimiter(
+        requests_per_second=requests_per_second,
+        burst=rate_limit_config.get("burst"),
+        per_client_requests_per_second=per_client_requests_per_second,
+        per_client_burst=rate_limit_config.get("per_client_burst"),
+    )
+
+
+class RateLimitMiddleware:
+    """
+    RateLimitMiddleware responds to requests that start predictions or
+    trainings with 429 once a client, or all clients together, go over the
+    rate limit. Clients are identified by the ID AuthMiddleware records, or by
+    IP address if requests aren't authenticated.
+    """
+
+    def __init__(self, app: ASGIApp, rate_limiter: RateLimiter) -> None:
+        self.app = app
+        self.rate_limiter = rate_limiter
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        if not _is_rate_limited(scope):
+            await self.app(scope, receive, send)
+            return
+
+        wait = self.rate_limiter.acquire(_client_id(scope))
+        if wait > 0:
+            response = JSONResponse(
+                {"detail": "Too many requests"},
+                status_code=429,
+                headers={"Retry-After": str(math.ceil(wait))},
+            )
+            await response(scope, receive, send)
+            return
+
+        await self.app(scope, receive, send)
+
+
+def _is_rate_limited(scope: Scope) -> bool:
+    if scope["type"] != "http" or scope["method"] not in ("POST", "PUT"):
+        return False
+    path: str = scope["path"]
+    # Cancelling a prediction frees up capacity, so it's never limited
+    return path.startswith(RATE_LIMITED_PATH_PREFIXES) and not path.endswith(
+        "/cancel"
+    )
+
+
+def _client_id(scope: Scope) -> str:
+    client_id = scope.get("state", {}).get(CLIENT_ID_STATE_KEY)
+    if client_id:
+        return client_id
+    client = scope.get("client")
+    return f"ip:{client[0]}" if client else "unknown"
@@ -0,0 +1,379 @@
+import hashlib
+import hmac
+import importlib.util
+import io
+import json
+import os
+import random
+import threading
+import urllib.parse
+import uuid
+from datetime import datetime, timezone
+from pathlib import Path
+from typing import Any, Callable, Dict, List, Mapping, Optional, Sequence
+
+import requests
+import structlog
+from fastapi.encoders import jsonable_encoder
+
+from .. import schema
+
+log = structlog.get_logger("cog.server.recorder")
+
+DEFAULT_FLUSH_INTERVAL = 60.0
+# The most predictions written to one file
+MAX_BATCH_SIZE = 1000
+# What the values of masked fields are replaced with
+MASKED = "[masked]"
+
+
+class RecordSink:
+    """A RecordSink stores files of recorded predictions."""
+
+    def write(self, name: str, data: bytes) -> None:
+        raise NotImplementedError
+
+
+class DirectorySink(RecordSink):
+    def __init__(self, path: str) -> None:
+        self.path = Path(path)
+
+    def write(self, name: str, data: bytes) -> None:
+        path = self.path / name
+        path.parent.mkdir(parents=True, exist_ok=True)
+        # Written under another name first, so nothing reads half a file
+        tmp_path = path.with_name(f".{path.name}.tmp")
+        tmp_path.write_bytes(data)
+        os.replace(tmp_path, path)
+
+
+class S3Sink(RecordSink):
+    """
+    S3Sink uploads files to a prefix in an S3 bucket, with the credentials in
+    the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+    environment variables. AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL point it
+    at an S3-compatible service instead, like MinIO or R2.
+    """
+
+    def __init__(
+        self,
+        bucket: str,
+        prefix: str,
+        environ: Mapping[str, str] = os.environ,
+        session: Optional[requests.Session] = None,
+        clock: Callable[[], datetime] = lambda: datetime.now(tz=timezone.utc),
+    ) -> None:
+        self.bucket = bucket
+        self.prefix = prefix.strip("/")
+        self.access_key_id = environ.get("AWS_ACCESS_KEY_ID", "")
+        self.secret_access_key = environ.get("AWS_SECRET_ACCESS_KEY", "")
+        self.session_token = environ.get("AWS_SESSION_TOKEN")
+        self.region = (
+            environ.get("AWS_REGION")
+            or environ.get("AWS_DEFAULT_REGION")
+            or "us-east-1"
+        )
+        self.endpoint_url = environ.get("AWS_ENDPOINT_URL_S3") or environ.get(
+            "AWS_ENDPOINT_URL"
+        )
+        self.session = session or requests.Session()
+        self._clock = clock
+
+    def url(self, key: str) -> str:
+        quoted_key = urllib.parse.quote(key, safe="/-_.~")
+        if self.endpoint_url:
+            # S3-compatible services are addressed by path
+            return f"{self.endpoint_url.rstrip('/')}/{self.bucket}/{quoted_key}"
+        return f"https://{self.bucket}.s3.{self.region}.amazonaws.com/{quoted_key}"
+
+    def write(self, name: str, data: bytes) -> None:
+        key = f"{self.prefix}/{name}" if self.prefix else name
+        url = self.url(key)
+        headers = sign_request(
+            "PUT",
+            url,
+            {},
+            hashlib.sha256(data).hexdigest(),
+            access_key_id=self.access_key_id,
+            secret_access_key=self.secret_access_key,
+            session_token=self.session_token,
+            region=self.region,
+            now=self._clock(),
+        )
+        resp = self.session.put(url, data=data, headers=headers, timeout=60)
+        resp.raise_for_status()
+
+    def read(self, name: str) -> Optional[bytes]:
+        """Return the contents of a file, or None if it doesn't exist"""
+        key = f"{self.prefix}/{name}" if self.prefix else name
+        url = self.url(key)
+        headers = sign_request(
+            "GET",
+            url,
+            {},
+            hashlib.sha256(b"").hexdigest(),
+            access_key_id=self.access_key_id,
+            secret_access_key=self.secret_access_key,
+            session_token=self.session_token,
+            region=self.region,
+            now=self._clock(),
+        )
+        resp = self.session.get(url, headers=headers, timeout=60)
+        if resp.status_code == 404:
+            return None
+        resp.raise_for_status()
+        return resp.content
+
+
+def make_sink(destination: str) -> Optional[RecordSink]:
+    """
+    Return the sink for a directory or an s3:// URL, or None if it's in S3
+    and there are no credentials for it.
+    """
+    if not destination.startswith("s3://"):
+        return DirectorySink(destination)
+    bucket, _, prefix = destination[len("s3://") :].partition("/")
+    sink = S3Sink(bucket, prefix)
+    if not sink.access_key_id or not sink.secret_access_key:
+        return None
+    return sink
+
+
+def sign_request(
+    method: str,
+    url: str,
+    headers: Dict[str, str],
+    payload_hash: str,
+    *,
+    access_key_id: str,
+    secret_access_key: str,
+    session_token: Optional[str],
+    region: str,
+    now: datetime,
+) -> Dict[str, str]:
+    """
+    Return the headers of an S3 request signed with AWS Signature Version 4,
+    including `headers`, which are signed too.
+    See: https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+    """
+    parsed = urllib.parse.urlsplit(url)
+    amz_date = now.strftime("%Y%m%dT%H%M%SZ")
+    date = now.strftime("%Y%m%d")
+    signed = {k.lower(): v.strip() for k, v in headers.items()}
+    signed["host"] = parsed.netloc
+    signed["x-amz-content-sha256"] = payload_hash
+    signed["x-amz-date"] = amz_date
+    if session_token:
+        signed["x-amz-security-token"] = session_token
+    signed_headers = ";".join(sorted(signed))
+    query = "&".join(
+        f"{urllib.parse.quote(k, safe='-_.~')}={urllib.parse.quote(v, safe='-_.~')}"
+        for k, v in sorted(urllib.parse.parse_qsl(parsed.query, keep_blank_values=True))
+    )
+    canonical_request = "\n".join(
+        [
+            method,
+            parsed.path or "/",
+            query,
+            "".join(f"{k}:{signed[k]}\n" for k in sorted(signed)),
+            signed_headers,
+            payload_hash,
+        ]
+    )
+    scope = f"{date}/{region}/s3/aws4_request"
+    string_to_sign = "\n".join(
+        [
+            "AWS4-HMAC-SHA256",
+            amz_date,
+            scope,
+            hashlib.sha256(canonical_request.encode("utf-8")).hexdigest(),
+        ]
+    )
+    key = ("AWS4" + secret_access_key).encode("utf-8")
+    for part in (date, region, "s3", "aws4_request"):
+        key = hmac.new(key, part.encode("utf-8"), hashlib.sha256).digest()
+    signature = hmac.new(
+        key, string_to_sign.encode("utf-8"), hashlib.sha256
+    ).hexdigest()
+    signed["authorization"] = (
+        f"AWS4-HMAC-SHA256 Credential={access_key_id}/{scope}, "
+        f"SignedHeaders={signed_headers}, Signature={signature}"
+    )
+    return signed
+
+
+def mask_fields(value: Any, names: Sequence[str]) -> Any:
+    """Return value with the values of fields called any of `names` masked"""
+    if isinstance(value, dict):
+        return {
+            k: MASKED if k in names else mask_fields(v, names) for k, v in value.items()
+        }
+    if isinstance(value, list):
+        return [mask_fields(v, names) for v in value]
+    return value
+
+
+def encode_jsonl(records: List[Dict[str, Any]]) -> bytes:
+    return "".join(json.dumps(r) + "\n" for r in records).encode("utf-8")
+
+
+def encode_parquet(records: List[Dict[str, Any]]) -> bytes:
+    # pylint: disable=import-outside-toplevel
+    import pyarrow as pa  # type: ignore
+    import pyarrow.parquet as pq  # type: ignore
+
+    # Inputs and outputs are different shapes for each model, so they're
+    # stored as JSON
+    rows = [
+        {**r, "input": json.dumps(r["input"]), "output": json.dumps(r["output"])}
+        for r in records
+    ]
+    buf = io.BytesIO()
+    pq.write_table(pa.Table.from_pylist(rows), buf)
+    return buf.getvalue()
+
+
+# The formats predictions can be written in, which are their files' extensions
+ENCODERS: Dict[str, Callable[[List[Dict[str, Any]]], bytes]] = {
+    "jsonl": encode_jsonl,
+    "parquet": encode_parquet,
+}
+
+
+class PredictionRecorder:
+    """
+    PredictionRecorder records the inputs and outputs of a sample of the
+    predictions the server finishes, with sensitive fields masked, to build
+    datasets from production traffic. Predictions are written in batches by a
+    background thread, one file per batch, so predictions never wait for it.
+    """
+
+    def __init__(  # pylint: disable=too-many-arguments
+        self,
+        sink: RecordSink,
+        *,
+        model_version: str,
+        fmt: str = "jsonl",
+        sample_rate: float = 1.0,
+        mask: Sequence[str] = (),
+        flush_interval: float = DEFAULT_FLUSH_INTERVAL,
+        max_batch_size: int = MAX_BATCH_SIZE,
+        rng: Callable[[], float] = random.random,
+        clock: Callable[[], datetime] = lambda: datetime.now(tz=timezone.utc),
+    ) -> None:
+        self.sink = sink
+        self.model_version = model_version
+        self.sample_rate = sample_rate
+        self.mask = list(mask)
+        self.flush_interval = flush_interval
+        self.max_batch_size = max_batch_size
+        self.dropped = 0
+        self.fmt = fmt
+        self._rng = rng
+        self._clock = clock
+        self._records: List[Dict[str, Any]] = []
+        self._lock = threading.Lock()
+        self._wake = threading.Event()
+        self._stopped = threading.Event()
+        self._thread = threading.Thread(target=self._run, daemon=True)
+
+    def start(self) -> None:
+        self._thread.start()
+
+    def stop(self) -> None:
+        """Stop, and write the predictions that haven't been written yet"""
+        self._stopped.set()
+        self._wake.set()
+        if self._thread.is_alive():
+            self._thread.join()
+        else:
+            self.flush()
+
+    def record(
+        self, response: schema.PredictionResponse, model: Optional[str] = None
+    ) -> None:
+        """Record a prediction that has finished, if it's sampled"""
+        if self._rng() >= self.sample_rate:
+            return
+        encoded = jsonable_encoder(response)
+        metrics = encoded.get("metrics") or {}
+        record = {
+            "id": encoded.get("id"),
+            "model": model,
+            "model_version": self.model_version,
+            "created_at": encoded.get("created_at"),
+            "completed_at": encoded.get("completed_at"),
+            "status": encoded.get("status"),
+            "input": mask_fields(encoded.get("input"), self.mask),
+            "output": mask_fields(encoded.get("output"), self.mask),
+            "error": encoded.get("error"),
+            "predict_time": metrics.get("predict_time"),
+            "experiment": encoded.get("experiment"),
+        }
+        with self._lock:
+            self._records.append(record)
+            full = len(self._records) >= self.max_batch_size
+        if full:
+            self._wake.set()
+
+    def flush(self) -> None:
+        """Write the predictions that have been recorded to a file"""
+        with self._lock:
+            records, self._records = self._records, []
+        if not records:
+            return
+        now = self._clock()
+        name = f"date={now:%Y-%m-%d}/{now:%H%M%S}-{uuid.uuid4().hex[:8]}.{self.fmt}"
+        try:
+            self.sink.write(name, ENCODERS[self.fmt](records))
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            self.dropped += len(records)
+            log.error(
+                "failed to write recorded predictions",
+                error=str(e),
+                predictions=len(records),
+            )
+
+    def _run(self) -> None:
+        while not self._stopped.is_set():
+            self._wake.wait(self.flush_interval)
+            self._wake.clear()
+            self.flush()
+        self.flush()
+
+
+def make_prediction_recorder(
+    record_config: Dict[str, Any], model_version: str
+) -> Optional[PredictionRecorder]:
+    """
+    Return the recorder configured by the `serve.record` section of cog.yaml,
+    or None if predictions aren't recorded.
+    """
+    destination = record_config.get("destination")
+    if not destination:
+        return None
+    fmt = record_config.get("format") or "jsonl"
+    if fmt not in ENCODERS:
+        raise ValueError(f"Unknown serve.record.format {fmt!r}")
+    if fmt == "parquet" and importlib.util.find_spec("pyarrow") is None:
+        log.error(
+            "serve.record.format is 'parquet' but pyarrow isn't installed, so predictions won't be recorded. Add pyarrow to build.python_packages in cog.yaml."
+        )
+        return None
+
+    sink = make_sink(destination)
+    if sink is None:
+        log.error(
+            "serve.record.destination is in S3 but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set, so predictions won't be recorded"
+        )
+        return None
+
+    sample_rate = record_config.get("sample_rate")
+    return PredictionRecorder(
+        sink,
+        model_version=model_version,
+        fmt=fmt,
+        sample_rate=1.0 if sample_rate is None else float(sample_rate),
+        mask=record_config.get("mask") or (),
+        flush_interval=record_config.get("flush_interval") or DEFAULT_FLUSH_INTERVAL,
+    )
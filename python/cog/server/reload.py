@@ -0,0 +1,164 @@
+import threading
+import time
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import structlog
+
+from .. import schema
+from .runner import (
+    PredictionRunner,
+    PredictTask,
+    SetupResult,
+    SetupTask,
+    UnknownPredictionError,
+)
+from .worker import Worker
+
+log = structlog.get_logger("cog.server.reload")
+
+
+class ReloadInProgressError(Exception):
+    pass
+
+
+class ReloadError(Exception):
+    def __init__(self, message: str, setup_result: Optional[SetupResult] = None):
+        super().__init__(message)
+        self.setup_result = setup_result
+
+
+class ReloadableRunner:
+    """
+    ReloadableRunner runs predictions on the model's current worker. When the
+    model is reloaded, a new worker is started and set up while the current
+    one keeps running predictions, then the new one takes over. The old
+    worker finishes the predictions it was running before it's stopped, so no
+    predictions are dropped.
+    """
+
+    def __init__(
+        self,
+        make_worker: Callable[[Dict[str, str]], Worker],
+        *,
+        max_concurrency: int = 1,
+        setup_timeout: Optional[float] = None,
+        drain_interval: float = 0.1,
+    ) -> None:
+        self._make_worker = make_worker
+        self._max_concurrency = max_concurrency
+        self._setup_timeout = setup_timeout
+        self._drain_interval = drain_interval
+
+        # The environment variables the current worker was started with
+        self._env: Dict[str, str] = {}
+        self._worker = make_worker(self._env)
+        self._runner = PredictionRunner(
+            worker=self._worker, max_concurrency=max_concurrency
+        )
+        # How many times the model has been reloaded
+        self.generation = 0
+        # Old workers that are finishing their predictions
+        self._draining: List[Tuple[Worker, PredictionRunner]] = []
+        # Held while predictions start and workers are swapped, so no
+        # prediction starts on a worker after it's been swapped out
+        self._lock = threading.Lock()
+        # Held while the model reloads, so it only reloads once at a time
+        self._reload_lock = threading.Lock()
+
+    def setup(self) -> SetupTask:
+        return self._runner.setup()
+
+    def predict(
+        self,
+        prediction: schema.PredictionRequest,
+        task_kwargs: Optional[Dict[str, Any]] = None,
+        method: Optional[str] = None,
+    ) -> PredictTask:
+        with self._lock:
+            return self._runner.predict(
+                prediction, task_kwargs=task_kwargs, method=method
+            )
+
+    def get_predict_task(self, id: str) -> Optional[PredictTask]:
+        for runner in self._runners():
+            task = runner.get_predict_task(id)
+            if task is not None:
+                return task
+        return None
+
+    def is_busy(self) -> bool:
+        return self._runner.is_busy()
+
+    def is_reloading(self) -> bool:
+        """Whether a new worker is being set up, or old ones are still running"""
+        return self._reload_lock.locked() or bool(self._draining)
+
+    def cancel(self, prediction_id: str) -> None:
+        for runner in self._runners():
+            if runner.get_predict_task(prediction_id) is not None:
+                runner.cancel(prediction_id)
+                return
+        raise UnknownPredictionError("unknown prediction id")
+
+    def reload(self, weights: Optional[str] = None) -> SetupResult:
+        """
+        Start a new worker and run setup(), then swap it in for the current
+        one. If weights is passed, setup() loads them instead of the weights
+        the current worker loaded. This blocks until setup() finishes, and
+        raises ReloadError if it fails, in which case the current worker
+        carries on.
+        """
+        if not self._reload_lock.acquire(blocking=False):
+            raise ReloadInProgressError("The model is already reloading")
+        try:
+            env = dict(self._env)
+            if weights:
+                env["COG_WEIGHTS"] = weights
+            log.info("reloading model", weights=weights)
+            worker = self._make_worker(env)
+            runner = PredictionRunner(
+                worker=worker, max_concurrency=self._max_concurrency
+            )
+            setup_task = runner.setup()
+            # Callbacks run in the order they're added, so the setup result is
+            # complete once this one has run
+            done = threading.Event()
+            setup_task.add_done_callback(lambda _: done.set())
+            if not done.wait(timeout=self._setup_timeout):
+                worker.terminate()
+                raise ReloadError(
+                    f"The model didn't finish setup within {self._setup_timeout:g} seconds",
+                    setup_task.result,
+                )
+            if setup_task.result.status != schema.Status.SUCCEEDED:
+                worker.terminate()
+                raise ReloadError("The model failed to reload", setup_task.result)
+
+            with self._lock:
+                old = (self._worker, self._runner)
+                self._worker, self._runner, self._env = worker, runner, env
+                self._draining.append(old)
+                self.generation += 1
+            threading.Thread(target=self._drain, args=old, daemon=True).start()
+            log.info("reloaded model", weights=weights)
+            return setup_task.result
+        finally:
+            self._reload_lock.release()
+
+    def terminate(self) -> None:
+        with self._lock:
+            for worker, _ in self._draining:
+                worker.terminate()
+            self._worker.terminate()
+
+    def _runners(self) -> List[PredictionRunner]:
+        with self._lock:
+            return [self._runner, *(runner for _, runner in self._draining)]
+
+    def _drain(self, worker: Worker, runner: PredictionRunner) -> None:
+        while not runner.is_idle():
+            time.sleep(self._drain_interval)
+        log.info("stopping old worker")
+        worker.terminate()
+        with self._lock:
+            self._draining.remove((worker, runner))
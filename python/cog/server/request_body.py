@@ -0,0 +1,191 @@
+import email.parser
+import email.policy
+import json
+from typing import Any, Dict, Optional
+
+from starlette.datastructures import Headers
+from starlette.responses import JSONResponse
+from starlette.types import ASGIApp, Message, Receive, Scope, Send
+
+from ..uploads import create_upload, upload_path, upload_url
+
+# Paths whose request body is a prediction or training request, and so can be
+# sent as multipart/form-data.
+MULTIPART_PATH_PREFIXES = ("/predictions", "/trainings", "/models/")
+
+
+class RequestTooLargeError(Exception):
+    pass
+
+
+class RequestBodyMiddleware:
+    """
+    RequestBodyMiddleware rejects request bodies larger than max_request_size
+    with 413, and converts prediction requests sent as multipart/form-data into
+    the JSON the prediction endpoints expect.
+    """
+
+    def __init__(
+        self, app: ASGIApp, max_request_size: Optional[int] = None
+    ) -> None:
+        self.app = app
+        self.max_request_size = max_request_size
+
+    async def __call__(self, scope: Scope, receive: Receive, send: Send) -> None:
+        if scope["type"] != "http":
+            await self.app(scope, receive, send)
+            return
+
+        headers = Headers(scope=scope)
+        content_length = headers.get("content-length", "")
+        if (
+            self.max_request_size is not None
+            and content_length.isdigit()
+            and int(content_length) > self.max_request_size
+        ):
+            await self._too_large(scope, receive, send)
+            return
+
+        if self.max_request_size is not None:
+            receive = self._limit(receive)
+
+        response_started = False
+
+        async def send_wrapper(message: Message) -> None:
+            nonlocal response_started
+            if message["type"] == "http.response.start":
+                response_started = True
+            await send(message)
+
+        try:
+            content_type = headers.get("content-type", "")
+            is_multipart = content_type.startswith("multipart/form-data")
+            if is_multipart and scope["path"].startswith(MULTIPART_PATH_PREFIXES):
+                body = await _read_body(receive)
+                try:
+                    body = multipart_to_json(body, content_type)
+                except ValueError as e:
+                    response = JSONResponse({"detail": str(e)}, status_code=422)
+                    await response(scope, receive, send)
+                    return
+                scope = _with_json_body(scope, len(body))
+                receive = _replay(body, receive)
+
+            await self.app(scope, receive, send_wrapper)
+        except RequestTooLargeError:
+            if response_started:
+                raise
+            await self._too_large(scope, receive, send)
+
+    def _limit(self, receive: Receive) -> Receive:
+        received = 0
+
+        async def limited_receive() -> Message:
+            nonlocal received
+            message = await receive()
+            if message["type"] == "http.request":
+                received += len(message.get("body", b""))
+                if (
+                    self.max_request_size is not None
+                    and received > self.max_request_size
+                ):
+                    raise RequestTooLargeError()
+            return message
+
+        return limited_receive
+
+    async def _too_large(self, scope: Scope, receive: Receive, send: Send) -> None:
+        response = JSONResponse(
+            {
+                "detail": f"Request body is larger than the maximum of {self.max_request_size} bytes"
+            },
+            status_code=413,
+        )
+        await response(scope, receive, send)
+
+
+def multipart_to_json(body: bytes, content_type: str) -> bytes:
+    """
+    Convert a multipart/form-data prediction request into a JSON one.
+
+    File parts are saved as uploads and passed as inputs by upload URL. A part
+    called "input" is a JSON object of inputs, and a part called "request" is
+    a JSON object of other request fields like "id" and "webhook". Any other
+    part is a string input.
+    """
+    message = email.parser.BytesParser(policy=email.policy.HTTP).parsebytes(
+        b"Content-Type: " + content_type.encode("latin-1") + b"\r\n\r\n" + body
+    )
+    if not message.is_multipart():
+        raise ValueError("Invalid multipart/form-data request body")
+
+    request: Dict[str, Any] = {}
+    inputs: Dict[str, Any] = {}
+    for part in message.iter_parts():  # type: ignore
+        name = part.get_param("name", header="content-disposition")
+        if not name:
+            continue
+        payload = part.get_payload(decode=True) or b""
+        filename = part.get_filename()
+        if filename is not None:
+            upload_id = create_upload(filename)
+            with open(upload_path(upload_id), "wb") as f:
+                f.write(payload)
+            inputs[name] = upload_url(upload_id)
+        elif name in ("input", "request"):
+            value = _json_object(name, payload)
+            if name == "input":
+                inputs.update(value)
+            else:
+                request.update(value)
+        else:
+            inputs[name] = payload.decode("utf-8")
+
+    request["input"] = {**(request.get("input") or {}), **inputs}
+    return json.dumps(request).encode("utf-8")
+
+
+def _json_object(name: str, payload: bytes) -> Dict[str, Any]:
+    try:
+        value = json.loads(payload)
+    except json.JSONDecodeError as e:
+        raise ValueError(f"The '{name}' part must be a JSON object: {e}") from e
+    if not isinstance(value, dict):
+        raise ValueError(f"The '{name}' part must be a JSON object")
+    return value
+
+
+async def _read_body(receive: Receive) -> bytes:
+    chunks = []
+    while True:
+        message = await receive()
+        if message["type"] != "http.request":
+            break
+        chunks.append(message.get("body", b""))
+        if not message.get("more_body", False):
+            break
+    return b"".join(chunks)
+
+
+def _replay(body: bytes, receive: Receive) -> Receive:
+    sent = False
+
+    async def replay_receive() -> Message:
+        nonlocal sent
+        if sent:
+            return await receive()
+        sent = True
+        return {"type": "http.request", "body": body, "more_body": False}
+
+    return replay_receive
+
+
+def _with_json_body(scope: Scope, length: int) -> Scope:
+    headers = [
+        (k, v)
+        for k, v in scope["headers"]
+        if k.lower() not in (b"content-type", b"content-length")
+    ]
+    headers.append((b"content-type", b"application/json"))
+    headers.append((b"content-length", str(length).encode("latin-1")))
+    return {**scope, "headers": headers}
@@ -0,0 +1,240 @@
+import importlib
+import importlib.util
+import json
+import os
+import threading
+import time
+from concurrent.futures import ThreadPoolExecutor
+from typing import Any, Callable, Dict, List, Optional
+
+import structlog
+from fastapi.encoders import jsonable_encoder
+
+from .. import schema
+from .cache import (
+    DEFAULT_MAX_ENTRIES,
+    CacheBackend,
+    MemoryBackend,
+    RedisBackend,
+    RedisClient,
+)
+from .recorder import S3Sink
+
+log = structlog.get_logger("cog.server.results")
+
+COG_RESULTS_REDIS_URL_ENV_VAR = "COG_RESULTS_REDIS_URL"
+COG_RESULTS_POSTGRES_URL_ENV_VAR = "COG_RESULTS_POSTGRES_URL"
+
+# How long results are kept when serve.results.ttl isn't set
+DEFAULT_TTL = 24 * 60 * 60
+REDIS_KEY_PREFIX = "cog:predictions:"
+POSTGRES_TABLE = "cog_predictions"
+
+
+class S3Backend(CacheBackend):
+    """
+    S3Backend keeps prediction responses in an S3 bucket, one JSON file per
+    prediction. Expired files are ignored, but S3 only deletes them if the
+    bucket has a lifecycle rule that expires them.
+    """
+
+    def __init__(self, sink: S3Sink, clock: Callable[[], float] = time.time) -> None:
+        self._sink = sink
+        self._clock = clock
+
+    def get(self, key: str) -> Optional[bytes]:
+        data = self._sink.read(f"{key}.json")
+        if data is None:
+            return None
+        entry = json.loads(data)
+        expires_at = entry.get("expires_at")
+        if expires_at is not None and self._clock() >= expires_at:
+            return None
+        return json.dumps(entry["response"]).encode("utf-8")
+
+    def set(self, key: str, value: bytes, ttl: Optional[float]) -> None:
+        entry = {
+            "expires_at": self._clock() + ttl if ttl else None,
+            "response": json.loads(value),
+        }
+        self._sink.write(f"{key}.json", json.dumps(entry).encode("utf-8"))
+
+
+class PostgresBackend(CacheBackend):
+    """
+    PostgresBackend keeps prediction responses in a table in Postgres, which
+    it creates if it doesn't exist, with psycopg or psycopg2. Expired rows are
+    deleted when predictions are written.
+    """
+
+    def __init__(
+        self,
+        url: str,
+        table: str = POSTGRES_TABLE,
+        connect: Optional[Callable[[str], Any]] = None,
+    ) -> None:
+        self._url = url
+        self._table = table
+        self._connect = connect or _connect_postgres
+        self._lock = threading.Lock()
+        self._conn: Any = None
+
+    def get(self, key: str) -> Optional[bytes]:
+        rows = self._execute(
+            f"SELECT response::text FROM {self._table} WHERE id = %s AND (expires_at IS NULL OR expires_at > now())",
+            (key,),
+        )
+        return rows[0][0].encode("utf-8") if rows else None
+
+    def set(self, key: str, value: bytes, ttl: Optional[float]) -> None:
+        self._execute(
+            f"INSERT INTO {self._table} (id, response, expires_at) VALUES (%s, %s::jsonb, now() + %s * interval '1 second') "
+            "ON CONFLICT (id) DO UPDATE SET response = excluded.response, expires_at = excluded.expires_at",
+            (key, value.decode("utf-8"), ttl),
+        )
+        self._execute(f"DELETE FROM {self._table} WHERE expires_at <= now()", ())
+
+    def _execute(self, sql: str, params: Any) -> List[Any]:
+        with self._lock:
+            try:
+                if self._conn is None:
+                    self._conn = self._connect(self._url)
+                    self._conn.autocommit = True
+                    self._run(
+                        f"CREATE TABLE IF NOT EXISTS {self._table} (id text PRIMARY KEY, response jsonb NOT NULL, expires_at timestamptz)",
+                        (),
+                    )
+                return self._run(sql, params)
+            except Exception:
+                # Reconnect next time, in case the connection broke
+                self._close()
+                raise
+
+    def _run(self, sql: str, params: Any) -> List[Any]:
+        with self._conn.cursor() as cur:
+            cur.execute(sql, params)
+            return cur.fetchall() if cur.description else []
+
+    def _close(self) -> None:
+        if self._conn is not None:
+            try:
+                self._conn.close()
+            except Exception:  # pylint: disable=broad-exception-caught
+                pass
+        self._conn = None
+
+
+def postgres_driver() -> Optional[str]:
+    """Return the name of the Postgres driver that's installed, if any"""
+    for name in ("psycopg", "psycopg2"):
+        if importlib.util.find_spec(name) is not None:
+            return name
+    return None
+
+
+def _connect_postgres(url: str) -> Any:
+    driver = postgres_driver()
+    assert driver is not None
+    return importlib.import_module(driver).connect(url)
+
+
+class PredictionResults:
+    """
+    PredictionResults stores the responses of asynchronous predictions, so they
+    can be fetched with GET /predictions/{id} after they finish, and from other
+    servers running the same model. They're written by a background thread, in
+    order, so predictions never wait for the store. If the store fails, it's
+    logged, and the prediction carries on.
+    """
+
+    def __init__(
+        self, backend: CacheBackend, ttl: Optional[float] = DEFAULT_TTL
+    ) -> None:
+        self.backend = backend
+        self.ttl = ttl
+        self._executor = ThreadPoolExecutor(
+            max_workers=1, thread_name_prefix="cog-results"
+        )
+
+    def save(self, response: schema.PredictionResponse) -> None:
+        """Store the current state of a prediction"""
+        if not response.id:
+            return
+        value = json.dumps(jsonable_encoder(response)).encode("utf-8")
+        self._executor.submit(self._set, response.id, value)
+
+    def get(self, prediction_id: str) -> Optional[Dict[str, Any]]:
+        """Return a stored prediction, or None if it isn't stored or expired"""
+        try:
+            value = self.backend.get(prediction_id)
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            log.warning(
+                "failed to read from the prediction results store", error=str(e)
+            )
+            return None
+        return json.loads(value) if value is not None else None
+
+    def stop(self) -> None:
+        """Wait for the predictions that haven't been stored yet"""
+        self._executor.shutdown(wait=True)
+
+    def _set(self, prediction_id: str, value: bytes) -> None:
+        try:
+            self.backend.set(prediction_id, value, self.ttl)
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            log.warning(
+                "failed to write to the prediction results store",
+                prediction_id=prediction_id,
+                error=str(e),
+            )
+
+
+def make_prediction_results(
+    results_config: Dict[str, Any],
+) -> Optional[PredictionResults]:
+    """
+    Return the store configured by the `serve.results` section of cog.yaml, or
+    None if the results of predictions aren't stored.
+    """
+    backend_name = results_config.get("backend")
+    if not backend_name:
+        return None
+    backend: CacheBackend
+    if backend_name == "memory":
+        backend = MemoryBackend(
+            results_config.get("max_entries") or DEFAULT_MAX_ENTRIES
+        )
+    elif backend_name == "redis":
+        url = os.environ.get(COG_RESULTS_REDIS_URL_ENV_VAR)
+        if not url:
+            log.error(
+                f"serve.results.backend is 'redis' but {COG_RESULTS_REDIS_URL_ENV_VAR} is not set, so the results of predictions won't be stored"
+            )
+            return None
+        backend = RedisBackend(RedisClient(url), prefix=REDIS_KEY_PREFIX)
+    elif backend_name == "s3":
+        url = results_config.get("url") or ""
+        bucket, _, prefix = url[len("s3://") :].partition("/")
+        sink = S3Sink(bucket, prefix)
+        if not sink.access_key_id or not sink.secret_access_key:
+            log.error(
+                "serve.results.backend is 's3' but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set, so the results of predictions won't be stored"
+            )
+            return None
+        backend = S3Backend(sink)
+    elif backend_name == "postgres":
+        url = os.environ.get(COG_RESULTS_POSTGRES_URL_ENV_VAR)
+        if not url:
+            log.error(
+                f"serve.results.backend is 'postgres' but {COG_RESULTS_POSTGRES_URL_ENV_VAR} is not set, so the results of predictions won't be stored"
+            )
+            return None
+        if postgres_driver() is None:
+            log.error(
+                "serve.results.backend is 'postgres' but neither psycopg nor psycopg2 is installed, so the results of predictions won't be stored. Add psycopg[binary] to build.python_packages in cog.yaml."
+            )
+            return None
+        backend = PostgresBackend(url)
+    else:
+        raise ValueError(f"Unknown serve.results.backend {backend_name!r}")
+    return PredictionResults(backend, ttl=results_config.get("ttl") or DEFAULT_TTL)
@@ -11,12 +11,13 @@ from typing import Any, Callable, Dict, Generic, List, Literal, Optional, TypeVa
 import requests
 import structlog
 from attrs import define, field
+from fastapi.encoders import jsonable_encoder
 from requests.adapters import HTTPAdapter
 from urllib3.util.retry import Retry
 
 from .. import schema
 from ..base_input import BaseInput
-from ..files import put_file_to_signed_endpoint
+from ..files import put_file_to_presigned_url, put_file_to_signed_endpoint
 from ..json import upload_files
 from ..types import PYDANTIC_V2
 from .errors import FileUploadError, RunnerBusyError, UnknownPredictionError
@@ -27,6 +28,7 @@ from .eventtypes import (
     PredictionOutput,
     PredictionOutputType,
 )
+from .filters import ContentFilter, FilterError
 
 if PYDANTIC_V2:
     from .helpers import unwrap_pydantic_serialization_iterators
@@ -46,12 +48,17 @@ class SetupResult:
     status: Optional[Literal[schema.Status.FAILED, schema.Status.SUCCEEDED]] = None
 
     def to_dict(self) -> Dict[str, Any]:
-        return {
+        result = {
             "started_at": self.started_at,
             "completed_at": self.completed_at,
             "logs": "".join(self.logs),
             "status": self.status,
         }
+        if self.completed_at is not None:
+            result["metrics"] = {
+                "setup_time": (self.completed_at - self.started_at).total_seconds()
+            }
+        return result
 
 
 class PredictionRunner:
@@ -88,6 +95,7 @@ class PredictionRunner:
         self,
         prediction: schema.PredictionRequest,
         task_kwargs: Optional[Dict[str, Any]] = None,
+        method: Optional[str] = None,
     ) -> "PredictTask":
         self._raise_if_busy()
 
@@ -113,7 +121,7 @@ class PredictionRunner:
             payload = prediction.input.copy()
 
         sid = self._worker.subscribe(task.handle_event, tag=tag)
-        task.track(self._worker.predict(payload, tag=tag))
+        task.track(self._worker.predict(payload, tag=tag, method=method))
         task.add_done_callback(self._task_done_callback(tag, sid))
 
         return task
@@ -137,6 +145,11 @@ class PredictionRunner:
             return True
         return False
 
+    def is_idle(self) -> bool:
+        """Whether no predictions are running"""
+        with self._predict_tasks_lock:
+            return all(task.done() for task in self._predict_tasks.values())
+
     def cancel(self, prediction_id: str) -> None:
         if not prediction_id:
             raise ValueError("prediction_id is required")
@@ -262,12 +275,26 @@ class SetupTask(Task[SetupResult]):
 
 
 def generate_file_uploader(
-    upload_url: str, prediction_id: Optional[str]
+    upload_url: Optional[str],
+    prediction_id: Optional[str],
+    output_upload_urls: Optional[List[str]] = None,
 ) -> Callable[[Any], Any]:
     client = _make_file_upload_http_client()
+    # Presigned URLs sent with the request are used for file outputs in order,
+    # before falling back to the server's upload URL.
+    presigned_urls = list(output_upload_urls or [])
 
     def file_uploader(output: Any) -> Any:
         def upload_file(fh: io.IOBase) -> str:
+            if presigned_urls:
+                return put_file_to_presigned_url(
+                    fh,
+                    url=presigned_urls.pop(0),
+                    prediction_id=prediction_id,
+                    client=client,
+                )
+            if upload_url is None:
+                raise ValueError("Not enough output upload URLs for file outputs")
             return put_file_to_signed_endpoint(
                 fh, endpoint=upload_url, prediction_id=prediction_id, client=client
             )
@@ -282,8 +309,15 @@ class PredictTask(Task[schema.PredictionResponse]):
         self,
         prediction_request: schema.PredictionRequest,
         upload_url: Optional[str] = None,
+        output_upload_urls: Optional[List[str]] = None,
+        output_filter: Optional[ContentFilter] = None,
     ) -> None:
         self._log = log.bind(prediction_id=prediction_request.id)
+        if prediction_request.experiment is not None:
+            self._log = self._log.bind(
+                experiment=prediction_request.experiment.id,
+                variant=prediction_request.experiment.variant,
+            )
 
         self._log.info("starting prediction")
 
@@ -313,10 +347,14 @@ class PredictTask(Task[schema.PredictionResponse]):
                 ),
             )
 
+        self._output_filter = output_filter
+
         self._file_uploader = None
-        if upload_url:
+        if upload_url or output_upload_urls:
             self._file_uploader = generate_file_uploader(
-                upload_url, prediction_id=self._p.id
+                upload_url,
+                prediction_id=self._p.id,
+                output_upload_urls=output_upload_urls,
             )
 
     @property
@@ -393,6 +431,8 @@ class PredictTask(Task[schema.PredictionResponse]):
         self._p.metrics[key] = value
 
     def succeeded(self) -> None:
+        if self._output_filter is not None and not self._filter_output():
+            return
         self._log.info("prediction succeeded")
         self._p.status = schema.Status.SUCCEEDED
         self._set_completed_at()
@@ -406,13 +446,44 @@ class PredictTask(Task[schema.PredictionResponse]):
         )
         self._send_webhook(schema.WebhookEvent.COMPLETED)
 
-    def failed(self, error: str) -> None:
-        self._log.info("prediction failed", error=error)
+    def failed(self, error: str, error_type: Optional[str] = None) -> None:
+        self._log.info("prediction failed", error=error, error_type=error_type)
         self._p.status = schema.Status.FAILED
         self._p.error = error
+        self._p.error_type = error_type
         self._set_completed_at()
         self._send_webhook(schema.WebhookEvent.COMPLETED)
 
+    def _filter_output(self) -> bool:
+        """
+        Check the output with the output filter, and fail the prediction if
+        it's rejected. Returns whether it was allowed.
+        """
+        assert self._output_filter is not None
+        try:
+            result = self._output_filter.check(
+                "output",
+                self._p.id,
+                jsonable_encoder(self._p.input),
+                jsonable_encoder(self._p.output),
+            )
+        except FilterError as e:
+            self._log.error("failed to check output with content filter", error=str(e))
+            self._p.output = None
+            self.failed(f"The output couldn't be checked by the content filter: {e}")
+            return False
+        if not result.allowed:
+            self._log.info("output rejected by content filter", reason=result.reason)
+            self._p.output = None
+            self.failed(
+                "The output was rejected by the content filter"
+                + (f": {result.reason}" if result.reason else "")
+            )
+            return False
+        if result.replaced:
+            self._p.output = result.output
+        return True
+
     def canceled(self) -> None:
         self._log.info("prediction canceled")
         self._p.status = schema.Status.CANCELED
@@ -433,7 +504,9 @@ class PredictTask(Task[schema.PredictionResponse]):
                 if event.canceled:
                     self.canceled()
                 elif event.error:
-                    self.failed(error=str(event.error_detail))
+                    self.failed(
+                        error=str(event.error_detail), error_type=event.error_type
+                    )
                 else:
                     self.succeeded()
             else:  # shouldn't happen, exhausted the type
@@ -445,8 +518,19 @@ class PredictTask(Task[schema.PredictionResponse]):
         self._p.completed_at = datetime.now(tz=timezone.utc)
 
     def _send_webhook(self, event: schema.WebhookEvent) -> None:
-        if self._webhook_sender is not None:
-            self._webhook_sender(self._p, event)
+        if self._webhook_sender is None:
+            return
+        if self._output_filter is not None and event != schema.WebhookEvent.COMPLETED:
+            # Outputs aren't sent until the output filter has checked them
+            if event == schema.WebhookEvent.OUTPUT:
+                return
+            if PYDANTIC_V2:
+                unchecked = self._p.model_copy(update={"output": None})
+            else:
+                unchecked = self._p.copy(update={"output": None})
+            self._webhook_sender(unchecked, event)
+            return
+        self._webhook_sender(self._p, event)
 
     def _upload_files(self, output: Any) -> Any:
         if self._file_uploader is None:
@@ -0,0 +1,286 @@
+import io
+import json
+import os
+import threading
+from dataclasses import dataclass, field
+from datetime import date, datetime, timedelta, timezone
+from typing import Any, Callable, Dict, List, Optional, Set, Tuple
+
+import structlog
+from fastapi.encoders import jsonable_encoder
+
+from ..json import upload_files
+from .recorder import RecordSink, make_sink
+
+log = structlog.get_logger("cog.server.scheduler")
+
+# The fields of a cron expression, and the values each can take. Sunday is
+# both 0 and 7 in the day of the week, like in cron.
+FIELDS: Tuple[Tuple[str, int, int], ...] = (
+    ("minute", 0, 59),
+    ("hour", 0, 23),
+    ("day of month", 1, 31),
+    ("month", 1, 12),
+    ("day of week", 0, 7),
+)
+
+NAMES: Dict[str, List[str]] = {
+    "month": "jan feb mar apr may jun jul aug sep oct nov dec".split(),
+    "day of week": "sun mon tue wed thu fri sat".split(),
+}
+
+ALIASES = {
+    "@yearly": "0 0 1 1 *",
+    "@annually": "0 0 1 1 *",
+    "@monthly": "0 0 1 * *",
+    "@weekly": "0 0 * * 0",
+    "@daily": "0 0 * * *",
+    "@midnight": "0 0 * * *",
+    "@hourly": "0 * * * *",
+}
+
+# How far ahead to look for the next time a cron expression matches. Leap
+# days can be up to 8 years apart.
+_MAX_LOOKAHEAD = timedelta(days=366 * 8)
+
+
+class CronError(ValueError):
+    pass
+
+
+class Cron:
+    """
+    Cron is a cron expression: minute, hour, day of the month, month and day
+    of the week, with *, ranges, lists, steps and names, like cron's, and the
+    @hourly, @daily, @weekly, @monthly and @yearly shorthands. Times are in
+    UTC.
+    """
+
+    def __init__(self, expression: str) -> None:
+        self.expression = expression
+        fields = ALIASES.get(expression.strip().lower(), expression).split()
+        if len(fields) != len(FIELDS):
+            raise CronError(
+                f"Invalid cron expression {expression!r}: it should have 5 fields, minute, hour, day of month, month and day of week, like '0 * * * *'"
+            )
+        values = [
+            _parse_field(expression, text, *f) for text, f in zip(fields, FIELDS)
+        ]
+        self.minutes, self.hours, self.days, self.months, weekdays = values
+        self.weekdays = {d % 7 for d in weekdays}
+        # Like cron, if both the day of the month and the day of the week are
+        # restricted, a day only has to match one of them
+        any_day, any_weekday = fields[2].startswith("*"), fields[4].startswith("*")
+        self._either_day = not any_day and not any_weekday
+        # Expressions like '0 0 31 2 *' are valid, but never run
+        self.next_after(datetime(2000, 1, 1, tzinfo=timezone.utc))
+
+    def matches_day(self, day: date) -> bool:
+        in_month = day.day in self.days
+        in_week = day.isoweekday() % 7 in self.weekdays
+        if self._either_day:
+            return in_month or in_week
+        return in_month and in_week
+
+    def next_after(self, after: datetime) -> datetime:
+        """Return the first time after `after` that the expression matches"""
+        t = after.astimezone(timezone.utc).replace(second=0, microsecond=0)
+        t += timedelta(minutes=1)
+        limit = t + _MAX_LOOKAHEAD
+        while t < limit:
+            if t.month not in self.months:
+                next_month = t.replace(day=1, hour=0, minute=0) + timedelta(days=32)
+                t = next_month.replace(day=1)
+            elif not self.matches_day(t):
+                t = t.replace(hour=0, minute=0) + timedelta(days=1)
+            elif t.hour not in self.hours:
+                t = t.replace(minute=0) + timedelta(hours=1)
+            elif t.minute not in self.minutes:
+                t += timedelta(minutes=1)
+            else:
+                return t
+        raise CronError(f"Cron expression {self.expression!r} never matches")
+
+
+def _parse_field(  # pylint: disable=too-many-arguments
+    expression: str, text: str, name: str, lo: int, hi: int
+) -> Set[int]:
+    def invalid(reason: str) -> CronError:
+        return CronError(
+            f"Invalid {name} {text!r} in cron expression {expression!r}: {reason}"
+        )
+
+    def value(s: str) -> int:
+        names = NAMES.get(name, [])
+        if s.lower() in names:
+            return names.index(s.lower()) + (1 if name == "month" else 0)
+        if not s.isdigit():
+            raise invalid(f"{s!r} isn't a number")
+        n = int(s)
+        if not lo <= n <= hi:
+            raise invalid(f"it must be between {lo} and {hi}")
+        return n
+
+    values: Set[int] = set()
+    for part in text.split(","):
+        span, slash, step_text = part.partition("/")
+        step = 1
+        if slash:
+            if not step_text.isdigit() or int(step_text) == 0:
+                raise invalid("the step must be a positive number")
+            step = int(step_text)
+        if span == "*":
+            start, end = lo, hi
+        elif "-" in span:
+            first, _, last = span.partition("-")
+            start, end = value(first), value(last)
+            if start > end:
+                raise invalid(f"the range {span!r} is backwards")
+        else:
+            start = value(span)
+            # Like cron, '5/15' means every 15 from 5
+            end = hi if slash else start
+        values.update(range(start, end + 1, step))
+    return values
+
+
+@dataclass
+class Schedule:
+    """A prediction to run on a schedule, and where to write it"""
+
+    cron: Cron
+    inputs: Dict[str, Any] = field(default_factory=dict)
+    destination: str = "outputs"
+
+    @classmethod
+    def parse(cls, cron: str, inputs: str, destination: str) -> "Schedule":
+        """
+        Parse the cron expression and the inputs, which are JSON, or @ and the
+        path to a JSON file
+        """
+        if inputs.startswith("@"):
+            with open(inputs[1:], encoding="utf-8") as f:
+                inputs = f.read()
+        try:
+            parsed = json.loads(inputs or "{}")
+        except json.JSONDecodeError as e:
+            raise ValueError(
+                f"The scheduled prediction's inputs aren't JSON: {e}"
+            ) from e
+        if not isinstance(parsed, dict):
+            raise ValueError("The scheduled prediction's inputs must be a JSON object")
+        return cls(cron=Cron(cron), inputs=parsed, destination=destination)
+
+
+class ScheduledPredictions:
+    """
+    ScheduledPredictions runs a prediction with the same inputs on a cron
+    schedule, for models that need to run periodically, like daily forecasts,
+    and writes each prediction, and its output files, to a directory named
+    after when it was scheduled. Runs that are missed while a prediction is
+    still running are skipped.
+    """
+
+    def __init__(
+        self,
+        cron: Cron,
+        inputs: Dict[str, Any],
+        sink: RecordSink,
+        predict: Callable[[Dict[str, Any]], Dict[str, Any]],
+        clock: Callable[[], datetime] = lambda: datetime.now(tz=timezone.utc),
+    ) -> None:
+        self.cron = cron
+        self.inputs = inputs
+        self.sink = sink
+        self._predict = predict
+        self._clock = clock
+        self._stopped = threading.Event()
+        self._thread = threading.Thread(target=self._run, daemon=True)
+
+    def start(self) -> None:
+        log.info(
+            "scheduled predictions",
+            cron=self.cron.expression,
+            next_run=self.cron.next_after(self._clock()).isoformat(),
+        )
+        self._thread.start()
+
+    def stop(self) -> None:
+        self._stopped.set()
+
+    def run(self, scheduled_at: datetime) -> None:
+        """Run the prediction scheduled at `scheduled_at`, and write it"""
+        name = scheduled_at.strftime("%Y%m%dT%H%MZ")
+        log.info("running scheduled prediction", scheduled_at=scheduled_at.isoformat())
+        try:
+            response = self._predict(dict(self.inputs))
+            filenames: Set[str] = set()
+
+            def write_file(fh: io.IOBase) -> str:
+                filename = _unique(
+                    os.path.basename(getattr(fh, "name", "") or "output"), filenames
+                )
+                if fh.seekable():
+                    fh.seek(0)
+                data = fh.read()
+                if isinstance(data, str):
+                    data = data.encode("utf-8")
+                self.sink.write(f"{name}/{filename}", data)
+                return filename
+
+            response["output"] = upload_files(
+                response.get("output"), upload_file=write_file
+            )
+            self.sink.write(
+                f"{name}/prediction.json",
+                json.dumps(jsonable_encoder(response), indent=2).encode("utf-8"),
+            )
+        except Exception as e:  # pylint: disable=broad-exception-caught
+            log.error(
+                "failed to run scheduled prediction",
+                scheduled_at=scheduled_at.isoformat(),
+                error=str(e),
+            )
+            return
+        log.info(
+            "finished scheduled prediction",
+            id=response.get("id"),
+            status=response.get("status"),
+            path=name,
+        )
+
+    def _run(self) -> None:
+        while True:
+            scheduled_at = self.cron.next_after(self._clock())
+            delay = (scheduled_at - self._clock()).total_seconds()
+            if self._stopped.wait(max(delay, 0)):
+                return
+            self.run(scheduled_at)
+
+
+def _unique(filename: str, taken: Set[str]) -> str:
+    stem, ext = os.path.splitext(filename)
+    unique, n = filename, 1
+    while unique in taken or unique == "prediction.json":
+        unique = f"{stem}-{n}{ext}"
+        n += 1
+    taken.add(unique)
+    return unique
+
+
+def make_scheduled_predictions(
+    schedule: Optional[Schedule],
+    predict: Callable[[Dict[str, Any]], Dict[str, Any]],
+) -> Optional[ScheduledPredictions]:
+    """
+    Return the scheduled predictions for `schedule`, or None if predictions
+    aren't scheduled
+    """
+    if schedule is None:
+        return None
+    sink = make_sink(schedule.destination)
+    if sink is None:
+        raise ValueError(
+            "The scheduled predictions' destination is in S3 but AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set"
+        )
+    return ScheduledPredictions(schedule.cron, schedule.inputs, sink, predict)
@@ -1,7 +1,7 @@
 import warnings
 from contextlib import contextmanager
 from contextvars import ContextVar
-from typing import Any, Callable, Generator, Optional, Union
+from typing import Any, Callable, Generator, Optional, Tuple, Union
 
 from attrs import evolve, frozen
 
@@ -12,6 +12,8 @@ from ..types import ExperimentalFeatureWarning
 class Scope:
     record_metric: Callable[[str, Union[float, int]], None]
     _tag: Optional[str] = None
+    # The tags of the predictions in a batch, which are run together
+    _batch_tags: Optional[Tuple[Optional[str], ...]] = None
 
 
 _current_scope: ContextVar[Optional[Scope]] = ContextVar("scope", default=None)
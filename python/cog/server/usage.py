@@ -0,0 +1,202 @@
+import ctypes
+import glob
+import os
+import resource
+import time
+from typing import Any, Callable, Dict, List, Optional, Tuple
+
+import structlog
+
+log = structlog.get_logger("cog.server.usage")
+
+RAPL_GLOB = "/sys/class/powercap/intel-rapl:[0-9]*"
+
+# The prediction metrics a UsageMeter measures
+USAGE_METRICS = ("cpu_time", "gpu_time", "energy")
+
+_NVML_SUCCESS = 0
+
+# When a prediction started, and the CPU time and energy counters then
+Reading = Tuple[float, float, Optional[float], Optional[Dict[str, int]]]
+
+
+class NVML:
+    """
+    NVML reads the energy NVIDIA GPUs have used from the NVIDIA Management
+    Library, which the NVIDIA container runtime mounts into containers with
+    GPUs, so it works without any Python packages.
+    """
+
+    def __init__(self, lib: Any) -> None:
+        self._lib = lib
+        self.devices: List[ctypes.c_void_p] = []
+        count = ctypes.c_uint()
+        if lib.nvmlDeviceGetCount_v2(ctypes.byref(count)) != _NVML_SUCCESS:
+            return
+        for i in range(count.value):
+            handle = ctypes.c_void_p()
+            if (
+                lib.nvmlDeviceGetHandleByIndex_v2(i, ctypes.byref(handle))
+                == _NVML_SUCCESS
+            ):
+                self.devices.append(handle)
+
+    @classmethod
+    def load(cls) -> Optional["NVML"]:
+        try:
+            lib = ctypes.CDLL("libnvidia-ml.so.1")
+        except OSError:
+            return None
+        if lib.nvmlInit_v2() != _NVML_SUCCESS:
+            return None
+        return cls(lib)
+
+    def energy(self) -> Optional[float]:
+        """
+        Return the joules the GPUs have used since the driver loaded, or None
+        if they can't tell, which is the case before Volta
+        """
+        total = 0.0
+        for handle in self.devices:
+            millijoules = ctypes.c_ulonglong()
+            if (
+                self._lib.nvmlDeviceGetTotalEnergyConsumption(
+                    handle, ctypes.byref(millijoules)
+                )
+                != _NVML_SUCCESS
+            ):
+                return None
+            total += millijoules.value / 1000
+        return total
+
+
+class RAPL:
+    """
+    RAPL reads the energy the CPU packages have used from Linux's powercap
+    interface to Intel's and AMD's Running Average Power Limit counters.
+    """
+
+    def __init__(self, domains: List[str]) -> None:
+        self.domains = domains
+        self._max_energy: Dict[str, int] = {}
+        for domain in domains:
+            self._max_energy[domain] = int(_read(f"{domain}/max_energy_range_uj"))
+
+    @classmethod
+    def load(cls, pattern: str = RAPL_GLOB) -> Optional["RAPL"]:
+        # Only the top-level package domains, which include their subdomains
+        domains = [d for d in sorted(glob.glob(pattern)) if d.count(":") == 1]
+        try:
+            rapl = cls(domains)
+            # They're often only readable by root, so it's checked up front
+            rapl.counters()
+        except (OSError, ValueError):
+            return None
+        return rapl if domains else None
+
+    def counters(self) -> Dict[str, int]:
+        return {d: int(_read(f"{d}/energy_uj")) for d in self.domains}
+
+    def joules_since(self, start: Dict[str, int]) -> float:
+        total = 0
+        for domain, end in self.counters().items():
+            used = end - start[domain]
+            if used < 0:
+                # The counter wrapped around
+                used += self._max_energy[domain]
+            total += used
+        return total / 1_000_000
+
+
+def _read(path: str) -> str:
+    with open(path, encoding="utf-8") as f:
+        return f.read().strip()
+
+
+class UsageMeter:
+    """
+    UsageMeter measures the resources predictions use, for chargeback: the
+    CPU time the model's process, and the processes it waited for, used, the
+    GPU time, which is how long the GPUs the model can use were held for, and
+    the energy the GPUs and CPUs used, if they can measure it.
+
+    Energy is measured for the whole machine, and CPU time for the whole
+    process, so when predictions run concurrently, each is counted with what
+    the others used at the same time.
+    """
+
+    def __init__(
+        self,
+        nvml: Optional[NVML] = None,
+        rapl: Optional[RAPL] = None,
+        gpu_count: int = 0,
+        clock: Callable[[], float] = time.monotonic,
+        cpu_time: Optional[Callable[[], float]] = None,
+    ) -> None:
+        self.nvml = nvml
+        self.rapl = rapl
+        self.gpu_count = gpu_count
+        self._clock = clock
+        self._cpu_time = cpu_time or _cpu_time
+
+    @classmethod
+    def load(cls) -> "UsageMeter":
+        nvml = NVML.load()
+        gpu_count = len(nvml.devices) if nvml is not None else 0
+        visible = os.environ.get("CUDA_VISIBLE_DEVICES")
+        if visible is not None and nvml is not None:
+            gpu_count = min(gpu_count, len([d for d in visible.split(",") if d]))
+        meter = cls(nvml=nvml, rapl=RAPL.load(), gpu_count=gpu_count)
+        log.debug(
+            "measuring prediction usage",
+            gpus=gpu_count,
+            gpu_energy=nvml is not None and nvml.energy() is not None,
+            cpu_energy=meter.rapl is not None,
+        )
+        return meter
+
+    def start(self) -> Reading:
+        return (
+            self._clock(),
+            self._cpu_time(),
+            self.nvml.energy() if self.nvml is not None else None,
+            _safe(self.rapl.counters) if self.rapl is not None else None,
+        )
+
+    def stop(self, start: Reading) -> Dict[str, float]:
+        """
+        Return what was used since start, as prediction metrics: cpu_time and
+        gpu_time in seconds, and energy in joules
+        """
+        started_at, cpu_time, gpu_energy, cpu_energy = start
+        usage = {"cpu_time": self._cpu_time() - cpu_time}
+        if self.gpu_count:
+            usage["gpu_time"] = (self._clock() - started_at) * self.gpu_count
+        energy: Optional[float] = None
+        if self.nvml is not None and gpu_energy is not None:
+            end = self.nvml.energy()
+            if end is not None:
+                energy = end - gpu_energy
+        if self.rapl is not None and cpu_energy is not None:
+            try:
+                energy = (energy or 0.0) + self.rapl.joules_since(cpu_energy)
+            except (OSError, ValueError):
+                pass
+        if energy is not None:
+            usage["energy"] = energy
+        return usage
+
+
+def _cpu_time() -> float:
+    total = 0.0
+    for who in (resource.RUSAGE_SELF, resource.RUSAGE_CHILDREN):
+        usage = resource.getrusage(who)
+        total += usage.ru_utime + usage.ru_stime
+    return total
+
+
+def _safe(fn: Callable[[], Any]) -> Any:
+    try:
+        return fn()
+    except (OSError, ValueError):
+        return None
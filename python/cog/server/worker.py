@@ -1,11 +1,14 @@
 import asyncio
 import contextlib
+import faulthandler
 import inspect
 import multiprocessing
 import os
 import signal
 import sys
+import tempfile
 import threading
+import time
 import traceback
 import types
 import uuid
@@ -20,7 +23,9 @@ from typing import (
     Callable,
     Dict,
     Iterator,
+    List,
     Optional,
+    TextIO,
     Tuple,
     Union,
     cast,
@@ -34,9 +39,11 @@ from ..json import make_encodeable
 from ..predictor import (
     extract_setup_weights,
     get_predict,
+    get_predict_batch,
     has_setup_weights,
     load_predictor_from_ref,
 )
+from ..seed import seed_from_env
 from ..types import PYDANTIC_V2, URLPath
 from ..wait import wait_for_env
 from .connection import AsyncConnection, LockedConnection
@@ -49,6 +56,7 @@ from .eventtypes import (
     PredictionMetric,
     PredictionOutput,
     PredictionOutputType,
+    PredictionStarted,
     Shutdown,
 )
 from .exceptions import (
@@ -57,7 +65,9 @@ from .exceptions import (
     InvalidStateException,
 )
 from .helpers import SimpleStreamRedirector, StreamRedirector
+from .oom import CUDA_OUT_OF_MEMORY, empty_cuda_cache, is_cuda_out_of_memory
 from .scope import Scope, _get_current_scope, evolve_scope, scope
+from .usage import UsageMeter
 
 if PYDANTIC_V2:
     from .helpers import unwrap_pydantic_serialization_iterators
@@ -92,8 +102,16 @@ class PredictionState:
     tag: Optional[str]
     payload: Dict[str, Any]
     result: "Future[Done]"
+    method: Optional[str] = None
 
     cancel_sent: bool = False
+    # Whether the child has started running the prediction, which is only
+    # tracked when it batches predictions
+    started: bool = False
+    # Whether the child has started sending the prediction's output, after
+    # which it can't be retried
+    output_started: bool = False
+    retried: bool = False
 
 
 class Worker:
@@ -101,11 +119,33 @@ class Worker:
     def uses_concurrency(self) -> bool:
         return self._max_concurrency > 1
 
+    @property
+    def pid(self) -> Optional[int]:
+        """The ID of the process that runs the predictor, or None if it hasn't started."""
+        return self._child.pid
+
     def __init__(
-        self, child: "_ChildWorker", events: Connection, max_concurrency: int = 1
+        self,
+        child: "_ChildWorker",
+        events: Connection,
+        max_concurrency: int = 1,
+        crash_log: Optional[str] = None,
+        retry_on_oom: bool = False,
+        oom_batch_size_input: Optional[str] = None,
+        batching: bool = False,
     ) -> None:
         self._child = child
         self._events = events
+        # Whether the child batches predictions, so some can be queued behind
+        # the batch that's running
+        self._batching = batching
+        # Where the child writes the stack of each of its threads if it
+        # crashes, like with a segfault, because it can't send logs once it has
+        self._crash_log = crash_log
+        # Whether predictions that run out of GPU memory are run again once,
+        # with the input named oom_batch_size_input halved if there is one
+        self._retry_on_oom = retry_on_oom
+        self._oom_batch_size_input = oom_batch_size_input
 
         self._sent_shutdown_event = False
         self._state = WorkerState.NEW
@@ -135,7 +175,10 @@ class Worker:
         return self._setup_result
 
     def predict(
-        self, payload: Dict[str, Any], tag: Optional[str] = None
+        self,
+        payload: Dict[str, Any],
+        tag: Optional[str] = None,
+        method: Optional[str] = None,
     ) -> "Future[Done]":
         # TODO: tag is Optional, but it's required when in concurrent mode and
         # basically unnecessary in sequential mode. Should we have a separate
@@ -156,13 +199,17 @@ class Worker:
                 )
             self._assert_state(WorkerState.READY)
             result = Future()
-            self._predictions_in_flight[tag] = PredictionState(tag, payload, result)
+            self._predictions_in_flight[tag] = PredictionState(
+                tag, payload, result, method
+            )
 
-        self._prediction_start_pool.submit(self._start_prediction(tag, payload))
+        self._prediction_start_pool.submit(
+            self._start_prediction(tag, payload, method)
+        )
         return result
 
     def _start_prediction(
-        self, tag: Optional[str], payload: Dict[str, Any]
+        self, tag: Optional[str], payload: Dict[str, Any], method: Optional[str]
     ) -> Callable[[], None]:
         def start_prediction() -> None:
             try:
@@ -213,7 +260,7 @@ class Worker:
                 # send the prediction to the child to start
                 self._events.send(
                     Envelope(
-                        event=PredictionInput(payload=payload),
+                        event=PredictionInput(payload=payload, method=method),
                         tag=tag,
                     )
                 )
@@ -254,6 +301,7 @@ class Worker:
             self._event_consumer.result(timeout=timeout)
 
         self._event_consumer_pool.shutdown()
+        self._remove_crash_log()
 
     def terminate(self) -> None:
         """
@@ -268,12 +316,17 @@ class Worker:
             self._child.join()
 
         self._event_consumer_pool.shutdown(wait=False)
+        self._remove_crash_log()
 
     def cancel(self, tag: Optional[str] = None) -> None:
         with self._predictions_lock:
             predict_state = self._predictions_in_flight.get(tag)
             if predict_state and not predict_state.cancel_sent:
-                self._child.send_cancel_signal()
+                # The signal cancels whatever the child is running, so it's
+                # only sent for a prediction that's running. The child removes
+                # a queued one from its queue when it gets the Cancel event.
+                if not self._batching or predict_state.started:
+                    self._child.send_cancel_signal()
                 self._events.send(Envelope(event=Cancel(), tag=tag))
                 predict_state.cancel_sent = True
 
@@ -307,10 +360,10 @@ class Worker:
         done = self._consume_events_until_done()
         # If we didn't get a done event, the child process died.
         if not done:
-            exitcode = self._child.exitcode
+            self._publish_crash_log([None])
             self._setup_result.set_exception(
                 FatalWorkerException(
-                    f"Predictor setup failed for an unknown reason. It might have run out of memory? (exitcode {exitcode})"
+                    _crash_message("Predictor setup", self._child.exitcode)
                 )
             )
             self._state = WorkerState.DEFUNCT
@@ -336,6 +389,15 @@ class Worker:
                 continue
 
             ev = self._events.recv()
+            if isinstance(ev.event, PredictionStarted):
+                self._mark_started(ev.tag)
+                continue
+            if isinstance(ev.event, PredictionOutputType):
+                self._mark_output_started(ev.tag)
+            elif isinstance(ev.event, Done) and self._retry_out_of_memory(
+                ev.event, ev.tag
+            ):
+                continue
             self._publish(ev)
             if isinstance(ev.event, Done):
                 self._complete_prediction(ev.event, ev.tag)
@@ -344,6 +406,8 @@ class Worker:
         # child process died.  First, process any remaining messages on the connection
         while self._events.poll():
             ev = self._events.recv()
+            if isinstance(ev.event, PredictionStarted):
+                continue
             self._publish(ev)
             if isinstance(ev.event, Done):
                 self._complete_prediction(ev.event, ev.tag)
@@ -351,15 +415,82 @@ class Worker:
         if not self._terminating:
             self._state = WorkerState.DEFUNCT
             with self._predictions_lock:
+                self._publish_crash_log(list(self._predictions_in_flight))
                 for state in self._predictions_in_flight.values():
-                    exitcode = self._child.exitcode
                     state.result.set_exception(
                         FatalWorkerException(
-                            f"Prediction failed for an unknown reason. It might have run out of memory? (exitcode {exitcode})"
+                            _crash_message("Prediction", self._child.exitcode)
                         )
                     )
                 self._predictions_in_flight.clear()
 
+    def _mark_started(self, tag: Optional[str]) -> None:
+        with self._predictions_lock:
+            predict_state = self._predictions_in_flight.get(tag)
+            if predict_state:
+                predict_state.started = True
+
+    def _mark_output_started(self, tag: Optional[str]) -> None:
+        with self._predictions_lock:
+            predict_state = self._predictions_in_flight.get(tag)
+            if predict_state:
+                predict_state.output_started = True
+
+    def _retry_out_of_memory(self, done: Done, tag: Optional[str]) -> bool:
+        """
+        Run a prediction that ran out of GPU memory again, if it can be, and
+        return whether it was
+        """
+        if not self._retry_on_oom or done.error_type != CUDA_OUT_OF_MEMORY:
+            return False
+        with self._predictions_lock:
+            predict_state = self._predictions_in_flight.get(tag)
+            if (
+                predict_state is None
+                or predict_state.retried
+                or predict_state.output_started
+                or predict_state.cancel_sent
+            ):
+                return False
+            predict_state.retried = True
+            # It's queued again until the child starts running it
+            predict_state.started = False
+            payload = dict(predict_state.payload)
+            method = predict_state.method
+
+        message = "CUDA ran out of memory, so the prediction is being retried"
+        name = self._oom_batch_size_input
+        batch_size = payload.get(name) if name else None
+        # bool is an int too, but it isn't a batch size
+        is_int = isinstance(batch_size, int) and not isinstance(batch_size, bool)
+        if name and is_int and batch_size > 1:
+            payload[name] = batch_size // 2
+            message += f" with {name}={payload[name]}"
+        self._publish(Envelope(event=Log(message + "\n", source="stderr"), tag=tag))
+        self._events.send(
+            Envelope(event=PredictionInput(payload=payload, method=method), tag=tag)
+        )
+        return True
+
+    def _publish_crash_log(self, tags: List[Optional[str]]) -> None:
+        """Add what the child wrote to the crash log to the logs of each tag"""
+        if not self._crash_log:
+            return
+        try:
+            with open(self._crash_log, encoding="utf-8", errors="replace") as f:
+                crash_log = f.read()
+        except OSError:
+            return
+        if not crash_log:
+            return
+        for tag in tags:
+            self._publish(Envelope(event=Log(crash_log, source="stderr"), tag=tag))
+
+    def _remove_crash_log(self) -> None:
+        if self._crash_log:
+            with contextlib.suppress(OSError):
+                os.remove(self._crash_log)
+
     def _complete_prediction(self, done: Done, tag: Optional[str]) -> None:
         # We update the in-flight dictionary before completing the prediction
         # future, so that we can immediately accept work.
@@ -392,7 +523,11 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         is_async: bool,
         events: Connection,
         max_concurrency: int = 1,
+        max_batch_size: int = 1,
+        max_batch_latency: float = 0.0,
         tee_output: bool = True,
+        env: Optional[Dict[str, str]] = None,
+        crash_log: Optional[str] = None,
     ) -> None:
         self._predictor_ref = predictor_ref
         self._predictor: Optional[BasePredictor] = None
@@ -402,9 +537,16 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         self._tee_output = tee_output
         self._cancelable = False
         self._max_concurrency = max_concurrency
+        self._max_batch_size = max_batch_size
+        self._max_batch_latency = max_batch_latency
+        # Environment variables to set in the child, like the weights to load
+        self._env = env or {}
+        self._crash_log = crash_log
+        self._crash_log_file: Optional[TextIO] = None
+        self._usage: Optional[UsageMeter] = None
 
         # for synchronous predictors only! async predictors use current_scope()._tag instead
-        self._sync_tag: Optional[str] = None
+        self._sync_tags: List[Optional[str]] = []
         self._has_async_predictor = is_async
 
         super().__init__()
@@ -418,6 +560,17 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         # Initially, we ignore SIGUSR1.
         signal.signal(signal.SIGUSR1, signal.SIG_IGN)
 
+        os.environ.update(self._env)
+        self._usage = UsageMeter.load()
+
+        if self._crash_log:
+            # Crashes in native code, like segfaults, write the Python stack of
+            # each thread to the crash log, which stays open until we exit
+            self._crash_log_file = open(  # pylint: disable=consider-using-with
+                self._crash_log, "w", encoding="utf-8"
+            )
+            faulthandler.enable(file=self._crash_log_file, all_threads=True)
+
         if self._has_async_predictor:
             redirector = SimpleStreamRedirector(
                 callback=self._stream_write_hook,
@@ -442,6 +595,9 @@ class _ChildWorker(_spawn.Process):  # type: ignore
 
             self._predictor.log = self._log  # type: ignore
             predict = get_predict(self._predictor)
+            predict_batch = (
+                get_predict_batch(self._predictor) if self._batching else None
+            )
 
             if self._has_async_predictor:
                 assert isinstance(redirector, SimpleStreamRedirector)
@@ -454,7 +610,7 @@ class _ChildWorker(_spawn.Process):  # type: ignore
                         await self._asetup(redirector)
                     else:
                         self._setup(redirector)
-                    await self._aloop(predict, redirector)
+                    await self._aloop(predict, predict_batch, redirector)
 
                 asyncio.run(_runner())
             else:
@@ -465,6 +621,7 @@ class _ChildWorker(_spawn.Process):  # type: ignore
                 self._setup(redirector)
                 self._loop(
                     predict,
+                    predict_batch,
                     redirector,
                 )
 
@@ -473,15 +630,22 @@ class _ChildWorker(_spawn.Process):  # type: ignore
             os.kill(self.pid, signal.SIGUSR1)
 
     def record_metric(self, name: str, value: Union[float, int]) -> None:
-        self._events.send(
-            Envelope(PredictionMetric(name, value), tag=self._current_tag)
-        )
+        for tag in self._current_tags:
+            self._events.send(Envelope(PredictionMetric(name, value), tag=tag))
 
     @property
-    def _current_tag(self) -> Optional[str]:
+    def _current_tags(self) -> List[Optional[str]]:
+        """The tags of the predictions that are running, which is more than one if they're running in a batch."""
         if self._has_async_predictor:
-            return _get_current_scope()._tag
-        return self._sync_tag
+            s = _get_current_scope()
+            if s._batch_tags is not None:
+                return list(s._batch_tags)
+            return [s._tag]
+        return self._sync_tags or [None]
+
+    @property
+    def _batching(self) -> bool:
+        return self._max_batch_size > 1
 
     def _load_predictor(self) -> Optional[BasePredictor]:
         done = Done()
@@ -532,6 +696,15 @@ class _ChildWorker(_spawn.Process):  # type: ignore
                     "Invalid predictor: to use an async setup method you must use an async predict method"
                 )
 
+            if self._batching:
+                is_async = inspect.iscoroutinefunction(
+                    get_predict_batch(self._predictor)
+                )
+                if is_async != self._has_async_predictor:
+                    raise FatalWorkerException(
+                        "Invalid predictor: predict_batch() must be async if predict() is, and not async if predict() isn't"
+                    )
+
             return True
 
         return False
@@ -542,6 +715,8 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         with self._handle_setup_error(redirector, ensure_done_event=True):
             assert self._predictor
 
+            seed_from_env()
+
             # Could be a function or a class
             if not hasattr(self._predictor, "setup"):
                 return
@@ -559,6 +734,8 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         with self._handle_setup_error(redirector, ensure_done_event=True):
             assert self._predictor
 
+            seed_from_env()
+
             # Could be a function or a class
             if not hasattr(self._predictor, "setup"):
                 return
@@ -573,24 +750,79 @@ class _ChildWorker(_spawn.Process):  # type: ignore
     def _loop(
         self,
         predict: Callable[..., Any],
+        predict_batch: Optional[Callable[..., Any]],
         redirector: StreamRedirector,
     ) -> None:
+        # Events that were received while a batch was collected, which are
+        # handled after it runs
+        deferred: List[Envelope] = []
         while True:
-            e = cast(Envelope, self._events.recv())
+            if deferred:
+                e = deferred.pop(0)
+            else:
+                e = cast(Envelope, self._events.recv())
             if isinstance(e.event, Cancel):
                 # for sync predictors, this is handled via SIGUSR1 signals from
                 # the parent via send_cancel_signal
                 continue
             elif isinstance(e.event, Shutdown):
                 break
+            elif (
+                isinstance(e.event, PredictionInput)
+                and predict_batch is not None
+                and e.event.method is None
+            ):
+                batch, later = self._collect_batch(e)
+                deferred += later
+                if batch:
+                    self._predict_batch(batch, predict_batch, redirector)
             elif isinstance(e.event, PredictionInput):
-                self._predict(e.tag, e.event.payload, predict, redirector)
+                self._predict(
+                    e.tag,
+                    e.event.payload,
+                    self._method(e.event.method, predict),
+                    redirector,
+                )
             else:
                 print(f"Got unexpected event: {e.event}", file=sys.stderr)
 
+    def _collect_batch(self, first: Envelope) -> Tuple[List[Envelope], List[Envelope]]:
+        """
+        Collects the predictions that arrive within the batching latency
+        window of the first one, up to the maximum batch size. Returns the
+        batch, and any events that have to be handled after it, which end the
+        batch early.
+        """
+        batch = [first]
+        deferred: List[Envelope] = []
+        deadline = time.monotonic() + self._max_batch_latency
+        while batch and len(batch) < self._max_batch_size:
+            # Predictions that are already waiting are batched even if the
+            # window has passed
+            timeout = max(deadline - time.monotonic(), 0)
+            if not self._events.poll(timeout):
+                break
+            e = cast(Envelope, self._events.recv())
+            if isinstance(e.event, PredictionInput) and e.event.method is None:
+                batch.append(e)
+            elif isinstance(e.event, Cancel):
+                # A prediction that's canceled before its batch runs never starts
+                for pending in batch:
+                    if pending.tag == e.tag:
+                        batch.remove(pending)
+                        self._events.send(
+                            Envelope(event=Done(canceled=True), tag=e.tag)
+                        )
+                        break
+            else:
+                deferred.append(e)
+                break
+        return batch, deferred
+
     async def _aloop(
         self,
         predict: Callable[..., Any],
+        predict_batch: Optional[Callable[..., Any]],
         redirector: SimpleStreamRedirector,
     ) -> None:
         # Unwrap and replace the events connection with an async one.
@@ -599,9 +831,46 @@ class _ChildWorker(_spawn.Process):  # type: ignore
 
         async with asyncio.TaskGroup() as tg:
             tasks = weakref.WeakValueDictionary[str | None, asyncio.Task[Any]]()
+            # The predictions waiting to be run in the next batch, and the
+            # task that runs it when the batching latency window has passed
+            pending: List[Envelope] = []
+            flush_timer: Optional[asyncio.Task[None]] = None
+
+            def flush() -> None:
+                nonlocal pending, flush_timer
+                if flush_timer is not None:
+                    flush_timer.cancel()
+                    flush_timer = None
+                batch, pending = pending, []
+                if not batch:
+                    return
+                assert predict_batch is not None
+                task = tg.create_task(
+                    self._apredict_batch(batch, predict_batch, redirector)
+                )
+                # Only a batch of one prediction can be canceled, because
+                # canceling it would cancel the others too
+                if len(batch) == 1:
+                    tasks[batch[0].tag] = task
+
+            async def flush_after_latency() -> None:
+                nonlocal flush_timer
+                await asyncio.sleep(self._max_batch_latency)
+                flush_timer = None
+                flush()
+
             while True:
                 e = cast(Envelope, await self._events.recv())
                 if isinstance(e.event, Cancel):
+                    # A prediction that's canceled before its batch runs never starts
+                    waiting = [p for p in pending if p.tag == e.tag]
+                    if waiting:
+                        pending.remove(waiting[0])
+                        self._events.send(
+                            Envelope(event=Done(canceled=True), tag=e.tag)
+                        )
+                        continue
+
                     # NOTE: We don't check the _cancelable flag here, instead we rely
                     # on the presence of the value in the weakmap to determine if
                     # a prediction is actively being processed.
@@ -615,14 +884,38 @@ class _ChildWorker(_spawn.Process):  # type: ignore
 
                     task.cancel()
                 elif isinstance(e.event, Shutdown):
+                    flush()
                     break
+                elif (
+                    isinstance(e.event, PredictionInput)
+                    and predict_batch is not None
+                    and e.event.method is None
+                ):
+                    pending.append(e)
+                    if len(pending) >= self._max_batch_size:
+                        flush()
+                    elif flush_timer is None:
+                        flush_timer = tg.create_task(flush_after_latency())
                 elif isinstance(e.event, PredictionInput):
                     tasks[e.tag] = tg.create_task(
-                        self._apredict(e.tag, e.event.payload, predict, redirector)
+                        self._apredict(
+                            e.tag,
+                            e.event.payload,
+                            self._method(e.event.method, predict),
+                            redirector,
+                        )
                     )
                 else:
                     print(f"Got unexpected event: {e.event}", file=sys.stderr)
 
+    def _method(
+        self, method: Optional[str], predict: Callable[..., Any]
+    ) -> Callable[..., Any]:
+        """Returns the predictor method to run: predict() if method is None, otherwise a method named in cog.yaml."""
+        if method is None:
+            return predict
+        return getattr(self._predictor, method)
+
     def _predict(
         self,
         tag: Optional[str],
@@ -630,7 +923,8 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         predict: Callable[..., Any],
         redirector: StreamRedirector,
     ) -> None:
-        with self._handle_predict_error(redirector, tag=tag):
+        with self._handle_predict_error(redirector, tags=[tag]):
+            seed_from_env()
             result = predict(**payload)
 
             if result:
@@ -681,7 +975,10 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         predict: Callable[..., Any],
         redirector: SimpleStreamRedirector,
     ) -> None:
-        with evolve_scope(tag=tag), self._handle_predict_error(redirector, tag=tag):
+        with evolve_scope(tag=tag), self._handle_predict_error(
+            redirector, tags=[tag]
+        ):
+            seed_from_env()
             future_result = predict(**payload)
 
             if future_result:
@@ -726,6 +1023,56 @@ class _ChildWorker(_spawn.Process):  # type: ignore
                         )
                     )
 
+    def _predict_batch(
+        self,
+        batch: List[Envelope],
+        predict_batch: Callable[..., Any],
+        redirector: StreamRedirector,
+    ) -> None:
+        tags = [e.tag for e in batch]
+        with self._handle_predict_error(redirector, tags=tags):
+            seed_from_env()
+            self._record_batch_size(tags)
+            results = predict_batch(**_batch_inputs(batch))
+            self._send_batch_outputs(tags, results)
+
+    async def _apredict_batch(
+        self,
+        batch: List[Envelope],
+        predict_batch: Callable[..., Any],
+        redirector: SimpleStreamRedirector,
+    ) -> None:
+        tags = [e.tag for e in batch]
+        with evolve_scope(
+            tag=tags[0] if len(tags) == 1 else None, batch_tags=tuple(tags)
+        ), self._handle_predict_error(redirector, tags=tags):
+            seed_from_env()
+            self._record_batch_size(tags)
+            results = await predict_batch(**_batch_inputs(batch))
+            self._send_batch_outputs(tags, results)
+
+    def _record_batch_size(self, tags: List[Optional[str]]) -> None:
+        for tag in tags:
+            self._events.send(
+                Envelope(PredictionMetric("batch_size", len(tags)), tag=tag)
+            )
+
+    def _send_batch_outputs(self, tags: List[Optional[str]], results: Any) -> None:
+        if not isinstance(results, (list, tuple)) or len(results) != len(tags):
+            raise TypeError(
+                f"predict_batch() must return a list with an output for each of the {len(tags)} predictions in the batch"
+            )
+        # All of the outputs are encoded before any are sent, so if one can't
+        # be, all of the predictions fail
+        outputs = [_encode_output(result) if result else None for result in results]
+        for tag, output in zip(tags, outputs):
+            if output is None:
+                continue
+            self._events.send(
+                Envelope(event=PredictionOutputType(multi=False), tag=tag)
+            )
+            self._events.send(Envelope(event=PredictionOutput(payload=output), tag=tag))
+
     @contextlib.contextmanager
     def _handle_setup_error(
         self,
@@ -768,12 +1115,18 @@ class _ChildWorker(_spawn.Process):  # type: ignore
     def _handle_predict_error(
         self,
         redirector: Union[SimpleStreamRedirector, StreamRedirector],
-        tag: Optional[str],
+        tags: List[Optional[str]],
     ) -> Iterator[None]:
         done = Done()
         send_done = True
-        self._cancelable = True
-        self._sync_tag = tag
+        # A batch of predictions can't be canceled, because canceling one of
+        # them would cancel the others too
+        self._cancelable = len(tags) == 1
+        self._sync_tags = tags
+        if self._batching:
+            for tag in tags:
+                self._events.send(Envelope(event=PredictionStarted(), tag=tag))
+        usage_start = self._usage.start() if self._usage is not None else None
         try:
             yield
         # regular cancelation
@@ -791,6 +1144,9 @@ class _ChildWorker(_spawn.Process):  # type: ignore
             traceback.print_exc()
             done.error = True
             done.error_detail = str(e)
+            if is_cuda_out_of_memory(e):
+                done.error_type = CUDA_OUT_OF_MEMORY
+                empty_cuda_cache()
         except BaseException:
             # For SystemExit and friends we attempt to add some useful context
             # to the logs, but reraise to ensure the process dies.
@@ -804,19 +1160,30 @@ class _ChildWorker(_spawn.Process):  # type: ignore
             try:
                 redirector.drain(timeout=10)
             except TimeoutError:
-                self._events.send(
-                    Envelope(
-                        event=Log(
-                            "WARNING: logs may be truncated due to excessive volume.",
-                            source="stderr",
-                        ),
-                        tag=tag,
+                for tag in tags:
+                    self._events.send(
+                        Envelope(
+                            event=Log(
+                                "WARNING: logs may be truncated due to excessive volume.",
+                                source="stderr",
+                            ),
+                            tag=tag,
+                        )
                     )
-                )
                 raise
             if send_done:
-                self._events.send(Envelope(event=done, tag=tag))
-            self._sync_tag = None
+                if self._usage is not None and usage_start is not None:
+                    # A batch's usage is split between its predictions
+                    for name, value in self._usage.stop(usage_start).items():
+                        for tag in tags:
+                            self._events.send(
+                                Envelope(
+                                    PredictionMetric(name, value / len(tags)), tag=tag
+                                )
+                            )
+                for tag in tags:
+                    self._events.send(Envelope(event=done, tag=tag))
+            self._sync_tags = []
 
     def _signal_handler(
         self,
@@ -830,14 +1197,10 @@ class _ChildWorker(_spawn.Process):  # type: ignore
         if len(data) == 0:
             return
 
-        if stream_name == sys.stdout.name:
-            self._events.send(
-                Envelope(event=Log(data, source="stdout"), tag=self._current_tag)
-            )
-        else:
-            self._events.send(
-                Envelope(event=Log(data, source="stderr"), tag=self._current_tag)
-            )
+        source = "stdout" if stream_name == sys.stdout.name else "stderr"
+        # Logs from a batch go to each of the predictions in it
+        for tag in self._current_tags:
+            self._events.send(Envelope(event=Log(data, source=source), tag=tag))
 
     def _log(self, *messages: str, source: str = "stderr") -> None:
         """
@@ -858,14 +1221,61 @@ def make_worker(
     is_async: bool,
     tee_output: bool = True,
     max_concurrency: int = 1,
+    max_batch_size: int = 1,
+    max_batch_latency: float = 0.0,
+    env: Optional[Dict[str, str]] = None,
+    retry_on_oom: bool = False,
+    oom_batch_size_input: Optional[str] = None,
 ) -> Worker:
     parent_conn, child_conn = _spawn.Pipe()
+    fd, crash_log = tempfile.mkstemp(prefix="cog-crash-", suffix=".log")
+    os.close(fd)
     child = _ChildWorker(
         predictor_ref,
         is_async=is_async,
         events=child_conn,
         tee_output=tee_output,
         max_concurrency=max_concurrency,
+        max_batch_size=max_batch_size,
+        max_batch_latency=max_batch_latency,
+        env=env,
+        crash_log=crash_log,
+    )
+    # Each of the predictions the child runs at once can be a batch
+    parent = Worker(
+        child=child,
+        events=parent_conn,
+        max_concurrency=max_concurrency * max_batch_size,
+        crash_log=crash_log,
+        retry_on_oom=retry_on_oom,
+        oom_batch_size_input=oom_batch_size_input,
+        batching=max_batch_size > 1,
     )
-    parent = Worker(child=child, events=parent_conn, max_concurrency=max_concurrency)
     return parent
+
+
+def _crash_message(what: str, exitcode: Optional[int]) -> str:
+    """Say why the child exited, from its exit code"""
+    # Processes that are killed because they run out of memory get SIGKILL
+    if exitcode is not None and exitcode < 0 and -exitcode != signal.SIGKILL:
+        try:
+            name = signal.Signals(-exitcode).name
+        except ValueError:
+            name = f"signal {-exitcode}"
+        return f"{what} failed because the model crashed with {name} (exitcode {exitcode})"
+    return f"{what} failed for an unknown reason. It might have run out of memory? (exitcode {exitcode})"
+
+
+def _batch_inputs(batch: List[Envelope]) -> Dict[str, List[Any]]:
+    """
+    Returns the arguments to call predict_batch() with: a list of each input's
+    values, in the order of the predictions in the batch.
+    """
+    payloads = [cast(PredictionInput, e.event).payload for e in batch]
+    return {name: [payload.get(name) for payload in payloads] for name in payloads[0]}
+
+
+def _encode_output(result: Any) -> Any:
+    if PYDANTIC_V2:
+        return make_encodeable(unwrap_pydantic_serialization_iterators(result))
+    return make_encodeable(result)
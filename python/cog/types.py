@@ -21,9 +21,11 @@ from typing import (
 )
 
 import pydantic
-import requests
 from typing_extensions import NotRequired  # added to typing in python 3.11
 
+from .downloads import LimitedReader, get_policy
+from .uploads import UPLOAD_SCHEME, upload_path_from_url
+
 if pydantic.__version__.startswith("1."):
     PYDANTIC_V2 = False
 else:
@@ -43,11 +45,17 @@ class ExperimentalFeatureWarning(Warning):
 
 
 class CogConfig(TypedDict):  # pylint: disable=too-many-ancestors
+    batching: NotRequired["CogBatchingConfig"]
     build: "CogBuildConfig"
     concurrency: "CogConcurrencyConfig"
+    downloads: NotRequired[Dict[str, Any]]
+    environment_variables: NotRequired[Dict[str, str]]
     image: NotRequired[str]
     predict: NotRequired[str]
+    secrets: NotRequired[List[Dict[str, str]]]
+    serve: NotRequired[Dict[str, Any]]
     train: NotRequired[str]
+    weights: NotRequired[List[Union[str, Dict[str, Any]]]]
 
 
 class CogBuildConfig(TypedDict, total=False):  # pylint: disable=too-many-ancestors
@@ -60,6 +68,11 @@ class CogBuildConfig(TypedDict, total=False):  # pylint: disable=too-many-ancest
     run: Optional[Union[List[str], List[Dict[str, Any]]]]
 
 
+class CogBatchingConfig(TypedDict, total=False):  # pylint: disable=too-many-ancestors
+    max_batch_size: int
+    max_latency_ms: NotRequired[float]
+
+
 class CogConcurrencyConfig(TypedDict, total=False):  # pylint: disable=too-many-ancestors
     max: NotRequired[int]
 
@@ -141,9 +154,16 @@ class File(io.IOBase):
             return value
 
         parsed_url = urllib.parse.urlparse(value)
+        if parsed_url.scheme == UPLOAD_SCHEME:
+            return open(upload_path_from_url(value), "rb")  # pylint: disable=consider-using-with
+        policy = get_policy()
+        policy.check_url(value)
         if parsed_url.scheme == "data":
             with urllib.request.urlopen(value) as res:  # noqa: S310
-                return io.BytesIO(res.read())
+                policy.check_content_type(res.headers.get("Content-Type"))
+                data = res.read()
+                policy.check_size(len(data))
+                return io.BytesIO(data)
         if parsed_url.scheme in ("http", "https"):
             return URLFile(value)
         raise ValueError(
@@ -200,6 +220,9 @@ class Path(pathlib.PosixPath):  # pylint: disable=abstract-method
         if isinstance(value, pathlib.Path):
             return value
 
+        if urllib.parse.urlparse(value).scheme == UPLOAD_SCHEME:
+            return Path(upload_path_from_url(value))
+
         return URLPath(
             source=value,
             filename=get_filename(value),
@@ -372,11 +395,19 @@ class URLFile(io.IOBase):
         except AttributeError:
             pass
         url = object.__getattribute__(self, "__url__")
-        resp = requests.get(url, stream=True, timeout=10)
+        policy = get_policy()
+        resp = policy.get(url)
         resp.raise_for_status()
+        policy.check_content_type(resp.headers.get("Content-Type"))
+        content_length = resp.headers.get("Content-Length")
+        if content_length is not None and content_length.isdigit():
+            policy.check_size(int(content_length))
         resp.raw.decode_content = True
-        object.__setattr__(self, "__target__", resp.raw)
-        return resp.raw
+        target = resp.raw
+        if policy.max_size is not None:
+            target = LimitedReader(resp.raw, policy)
+        object.__setattr__(self, "__target__", target)
+        return target
 
     def __repr__(self) -> str:
         try:
@@ -0,0 +1,91 @@
+import os
+import re
+import secrets
+import tempfile
+import urllib.parse
+from typing import BinaryIO
+
+UPLOAD_SCHEME = "upload"
+COG_UPLOAD_DIR_ENV_VAR = "COG_UPLOAD_DIR"
+
+_UPLOAD_ID_RE = re.compile(r"^[0-9a-f]{32}$")
+_FILENAME_ILLEGAL_CHARS = re.compile(r"[\x00/\\]")
+
+
+class UploadNotFoundError(ValueError):
+    """Raised when an upload ID doesn't refer to an upload on this server."""
+
+    def __init__(self, upload_id: str) -> None:
+        super().__init__(f"Upload '{upload_id}' not found")
+
+
+class UploadOffsetMismatchError(ValueError):
+    """Raised when a chunk doesn't start where the upload currently ends."""
+
+    def __init__(self, offset: int) -> None:
+        super().__init__(f"Upload is at offset {offset}")
+        self.offset = offset
+
+
+def upload_dir() -> str:
+    return os.environ.get(COG_UPLOAD_DIR_ENV_VAR) or os.path.join(
+        tempfile.gettempdir(), "cog-uploads"
+    )
+
+
+def create_upload(filename: str) -> str:
+    """
+    Create an empty upload for a file called filename and return its ID. The
+    file can then be written to in chunks with open_upload().
+    """
+    upload_id = secrets.token_hex(16)
+    directory = os.path.join(upload_dir(), upload_id)
+    os.makedirs(directory)
+    name = _FILENAME_ILLEGAL_CHARS.sub("_", os.path.basename(filename))[:200]
+    with open(os.path.join(directory, name or "file"), "wb"):
+        pass
+    return upload_id
+
+
+def upload_url(upload_id: str) -> str:
+    """Return the URL that refers to an upload when it's passed as an input."""
+    return f"{UPLOAD_SCHEME}://{upload_id}"
+
+
+def upload_path(upload_id: str) -> str:
+    if not _UPLOAD_ID_RE.match(upload_id):
+        raise UploadNotFoundError(upload_id)
+    directory = os.path.join(upload_dir(), upload_id)
+    try:
+        names = os.listdir(directory)
+    except FileNotFoundError:
+        raise UploadNotFoundError(upload_id) from None
+    if len(names) != 1:
+        raise UploadNotFoundError(upload_id)
+    return os.path.join(directory, names[0])
+
+
+def upload_path_from_url(url: str) -> str:
+    parsed = urllib.parse.urlparse(url)
+    if parsed.scheme != UPLOAD_SCHEME:
+        raise ValueError(f"'{url}' is not an upload URL")
+    return upload_path(parsed.netloc)
+
+
+def upload_offset(upload_id: str) -> int:
+    """Return the number of bytes received so far for an upload."""
+    return os.path.getsize(upload_path(upload_id))
+
+
+def open_upload(upload_id: str, offset: int) -> BinaryIO:
+    """
+    Open an upload to append a chunk starting at offset. Raises
+    UploadOffsetMismatchError if offset isn't where the upload currently ends,
+    so that a client resuming an interrupted upload can find out where to
+    continue from.
+    """
+    path = upload_path(upload_id)
+    current = os.path.getsize(path)
+    if offset != current:
+        raise UploadOffsetMismatchError(current)
+    return open(path, "ab")  # pylint: disable=consider-using-with
@@ -28,6 +28,10 @@ class WorkerConfig:
     is_async: bool = False
     setup: bool = True
     max_concurrency: int = 1
+    max_batch_size: int = 1
+    max_batch_latency: float = 0.0
+    retry_on_oom: bool = False
+    oom_batch_size_input: Optional[str] = None
     min_python: Optional[Tuple[int, int]] = None
 
 
@@ -187,6 +191,10 @@ def worker(request):
         is_async=request.param.is_async,
         tee_output=False,
         max_concurrency=request.param.max_concurrency,
+        max_batch_size=request.param.max_batch_size,
+        max_batch_latency=request.param.max_batch_latency,
+        retry_on_oom=request.param.retry_on_oom,
+        oom_batch_size_input=request.param.oom_batch_size_input,
     )
     if request.param.setup:
         assert not w.setup().result().error
@@ -0,0 +1,12 @@
+from typing import List
+
+from cog import BasePredictor
+
+
+class Predictor(BasePredictor):
+    async def predict(self, text: str, repeat: int = 1) -> str:
+        return (await self.predict_batch(text=[text], repeat=[repeat]))[0]
+
+    async def predict_batch(self, text: List[str], repeat: List[int]) -> List[str]:
+        print(f"running a batch of {len(text)}")
+        return [t * r for t, r in zip(text, repeat)]
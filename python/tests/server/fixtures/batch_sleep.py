@@ -0,0 +1,13 @@
+import time
+from typing import List
+
+from cog import BasePredictor
+
+
+class Predictor(BasePredictor):
+    def predict(self, text: str, sleep: float = 0) -> str:
+        return self.predict_batch(text=[text], sleep=[sleep])[0]
+
+    def predict_batch(self, text: List[str], sleep: List[float]) -> List[str]:
+        time.sleep(max(sleep))
+        return text
@@ -0,0 +1,13 @@
+class ContentFilter:
+    def __init__(self):
+        self.blocked_words = {"bad"}
+
+    def __call__(self, prediction):
+        if prediction["stage"] == "input":
+            text = prediction["input"].get("text", "")
+            if self.blocked_words & set(text.split()):
+                return {"allowed": False, "reason": "The text contains blocked words"}
+            return None
+        if "forbidden" in prediction["output"]:
+            return {"allowed": False}
+        return {"allowed": True, "output": prediction["output"].replace("darn", "d***")}
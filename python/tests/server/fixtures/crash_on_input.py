@@ -0,0 +1,12 @@
+import os
+import signal
+
+
+class Predictor:
+    def setup(self):
+        print("did setup")
+
+    def predict(self, text: str) -> str:
+        if text == "crash":
+            os.kill(os.getpid(), signal.SIGKILL)
+        return text
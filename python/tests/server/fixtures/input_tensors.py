@@ -0,0 +1,13 @@
+from typing import List
+
+from cog import BasePredictor, Input
+
+
+class Predictor(BasePredictor):
+    def predict(
+        self,
+        prompt: str,
+        weights: List[int] = Input(default=[1]),
+        scale: float = Input(default=1.0),
+    ) -> List[float]:
+        return [len(prompt) * w * scale for w in weights]
@@ -0,0 +1,14 @@
+from cog import BasePredictor
+
+
+class OutOfMemoryError(RuntimeError):
+    """Like torch.cuda.OutOfMemoryError"""
+
+
+class Predictor(BasePredictor):
+    def predict(self, batch_size: int = 4) -> int:
+        if batch_size > 2:
+            raise OutOfMemoryError(
+                "CUDA out of memory. Tried to allocate 2.00 GiB (GPU 0; 23.69 GiB total capacity)"
+            )
+        return batch_size
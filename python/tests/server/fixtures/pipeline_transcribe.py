@@ -0,0 +1,14 @@
+from cog import BasePredictor, BaseModel, Input
+
+
+class Output(BaseModel):
+    text: str
+    language: str
+
+
+class Predictor(BasePredictor):
+    def setup(self) -> None:
+        self.language = "en"
+
+    def predict(self, audio: str = Input(description="Audio to transcribe")) -> Output:
+        return Output(text=audio.upper(), language=self.language)
@@ -0,0 +1,12 @@
+from cog import BasePredictor, ConcatenateIterator, Input
+
+
+class Predictor(BasePredictor):
+    def predict(
+        self,
+        text: str,
+        target: str = Input(default="fr"),
+        repeat: int = Input(default=1),
+    ) -> ConcatenateIterator[str]:
+        for _ in range(repeat):
+            yield f"[{target}] {text} "
@@ -0,0 +1,11 @@
+from typing import List
+
+from cog import BasePredictor, Input
+
+
+class Predictor(BasePredictor):
+    def predict(self, text: str = Input(default="world")) -> str:
+        return "hello " + text
+
+    def embed(self, text: str, dimensions: int = Input(default=3)) -> List[float]:
+        return [float(len(text))] * dimensions
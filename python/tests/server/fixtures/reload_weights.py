@@ -0,0 +1,14 @@
+import time
+
+from cog import BasePredictor, File
+
+
+class Predictor(BasePredictor):
+    def setup(self, weights: File):
+        self.text = weights.read()
+        if self.text == "broken":
+            raise ValueError("broken weights")
+
+    def predict(self, sleep: float = 0) -> str:
+        time.sleep(sleep)
+        return self.text
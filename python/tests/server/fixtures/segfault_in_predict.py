@@ -0,0 +1,11 @@
+import ctypes
+
+
+class Predictor:
+    def setup(self):
+        print("did setup")
+
+    def predict(self):
+        # Reading from a null pointer crashes the process, like a bug in a
+        # native library would
+        ctypes.string_at(0)
@@ -0,0 +1,222 @@
+import base64
+import hashlib
+import json
+import time
+
+import pytest
+
+from cog.server.auth import (
+    APIKeyAuthenticator,
+    AuthenticationError,
+    JWTAuthenticator,
+    make_authenticator,
+)
+
+from .conftest import uses_predictor_with_client_options
+
+# A 1024-bit RSA key, only for signing test tokens
+TEST_KEY_N = int(
+    "a43b85390047d0ff0ae3578024b6e382a88aa46f6809da4dc54bb576ce5759a0"
+    "a85ad848532825a2bab88aaac7d2972c96646892bfbcacb325118d5a46b26bad"
+    "3abb72736bede277cbcc48606d64a9f0130f96a78c89bbb75fae18d97c790ed0"
+    "414003ffc78fe7fe839d48c08478207e7119a590e7912dcef864d34e93834ecd",
+    16,
+)
+TEST_KEY_D = int(
+    "269775eeb70a292a453cb6cafdd59c108fda4459897107434f21433aefb1c6f5"
+    "e199b74907815f96a599c7bbe9c8aa8d67a9a0891b55129fe60e01d13cdba041"
+    "6c306796b23f653bb58fb4269962305318de47adbc3d9dadfb3be57c4b9918cd"
+    "c66c9d8ba14e9ae1fed8dffbd5421c7437c0843017b806d0952c765469eeca61",
+    16,
+)
+TEST_KEY_E = 65537
+
+
+def _b64(b: bytes) -> str:
+    return base64.urlsafe_b64encode(b).rstrip(b"=").decode("ascii")
+
+
+TEST_JWK = {
+    "kty": "RSA",
+    "kid": "test",
+    "n": _b64(TEST_KEY_N.to_bytes(128, "big")),
+    "e": _b64(TEST_KEY_E.to_bytes(3, "big")),
+}
+
+
+def make_token(claims, kid="test", header=None):
+    if header is None:
+        header = {"alg": "RS256", "kid": kid}
+    header = _b64(json.dumps(header).encode("utf-8"))
+    payload = _b64(json.dumps(claims).encode("utf-8"))
+    digest_info = (
+        bytes.fromhex("3031300d060960864801650304020105000420")
+        + hashlib.sha256(f"{header}.{payload}".encode("ascii")).digest()
+    )
+    padded = b"\x00\x01" + b"\xff" * (128 - len(digest_info) - 3) + b"\x00"
+    message = int.from_bytes(padded + digest_info, "big")
+    signature = pow(message, TEST_KEY_D, TEST_KEY_N).to_bytes(128, "big")
+    return f"{header}.{payload}.{_b64(signature)}"
+
+
+@pytest.fixture
+def jwt_authenticator(monkeypatch):
+    authenticator = JWTAuthenticator(
+        "https://auth.example.com/jwks.json", issuer="me", audience="my-model"
+    )
+    monkeypatch.setattr(authenticator, "_fetch_keys", lambda: [TEST_JWK])
+    return authenticator
+
+
+def test_api_key_authenticator():
+    authenticator = APIKeyAuthenticator(["key1", "key2"])
+    client_id = authenticator.authenticate("key2")
+    assert client_id.startswith("key:")
+    assert "key2" not in client_id
+    with pytest.raises(AuthenticationError):
+        authenticator.authenticate("key3")
+
+
+def test_api_key_authenticator_without_keys():
+    with pytest.raises(AuthenticationError):
+        APIKeyAuthenticator([]).authenticate("")
+
+
+def test_jwt_authenticator(jwt_authenticator):
+    claims = {"iss": "me", "aud": "my-model", "exp": time.time() + 60, "sub": "ada"}
+    assert jwt_authenticator.authenticate(make_token(claims)) == "sub:ada"
+
+
+@pytest.mark.parametrize(
+    "claims,kid,message",
+    [
+        (
+            {"iss": "me", "aud": "my-model", "exp": time.time() - 3600},
+            "test",
+            "expired",
+        ),
+        ({"iss": "you", "aud": "my-model"}, "test", "wrong issuer"),
+        ({"iss": "me", "aud": ["other"]}, "test", "wrong audience"),
+        ({"iss": "me", "aud": "my-model"}, "rotated", "unknown key"),
+    ],
+)
+def test_jwt_authenticator_rejects(jwt_authenticator, claims, kid, message):
+    with pytest.raises(AuthenticationError, match=message):
+        jwt_authenticator.authenticate(make_token(claims, kid=kid))
+
+
+def test_jwt_authenticator_rejects_bad_signature(jwt_authenticator):
+    token = make_token({"iss": "me", "aud": "my-model"})
+    header, _, signature = token.split(".")
+    claims = {"iss": "me", "aud": "my-model", "admin": True}
+    payload = _b64(json.dumps(claims).encode("utf-8"))
+    with pytest.raises(AuthenticationError, match="Invalid token signature"):
+        jwt_authenticator.authenticate(f"{header}.{payload}.{signature}")
+
+
+@pytest.mark.parametrize(
+    "token,message",
+    [
+        ("not-a-token", "Malformed token"),
+        ("a.b.c", "Malformed token"),
+        ("é.é.é", "Malformed token"),
+        (make_token({"iss": "me"}, header=["RS256"]), "Malformed token"),
+        (make_token("me"), "Malformed token"),
+        (make_token(["me"]), "Malformed token"),
+        (make_token({"iss": "me"}, header={"alg": ["RS256"]}), "algorithm"),
+        (make_token({"iss": "me"}, header={"alg": "none"}), "algorithm"),
+        (make_token({"iss": "me", "exp": "tomorrow"}), "exp claim"),
+        (make_token({"iss": "me", "exp": [1]}), "exp claim"),
+        (make_token({"iss": "me", "exp": True}), "exp claim"),
+        (make_token({"iss": "me", "exp": float("inf")}), "exp claim"),
+        (make_token({"iss": "me", "nbf": None}), "nbf claim"),
+        (make_token({"iss": "me", "nbf": {"at": 0}}), "nbf claim"),
+    ],
+)
+def test_jwt_authenticator_rejects_malformed_tokens(jwt_authenticator, token, message):
+    with pytest.raises(AuthenticationError, match=message):
+        jwt_authenticator.authenticate(token)
+
+
+def test_make_authenticator(monkeypatch):
+    monkeypatch.delenv("COG_API_KEYS", raising=False)
+    assert make_authenticator({}) is None
+    assert isinstance(make_authenticator({"type": "api_key"}), APIKeyAuthenticator)
+    assert isinstance(
+        make_authenticator({"type": "jwt", "jwks_url": "https://example.com"}),
+        JWTAuthenticator,
+    )
+
+    monkeypatch.setenv("COG_API_KEYS", "key1, key2")
+    authenticator = make_authenticator({})
+    assert isinstance(authenticator, APIKeyAuthenticator)
+    authenticator.authenticate("key2")
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    env={"COG_API_KEYS": "secret"},
+    additional_config={"serve": {"auth": {"type": "api_key"}}},
+)
+def test_predictions_require_api_key(client):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 401
+    assert resp.headers["WWW-Authenticate"] == "Bearer"
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Authorization": "Bearer wrong"},
+    )
+    assert resp.status_code == 401
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Authorization": "Bearer secret"},
+    )
+    assert resp.status_code == 200
+    assert resp.json()["output"] == "baz"
+
+    # Health checks stay open
+    resp = client.get("/health-check")
+    assert resp.status_code == 200
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    env={"COG_API_KEYS": "secret"},
+    additional_config={"serve": {"auth": {"type": "api_key"}}},
+)
+def test_inference_protocol_requires_api_key(client):
+    body = {
+        "inputs": [
+            {"name": "text", "datatype": "BYTES", "shape": [1], "data": ["baz"]}
+        ]
+    }
+    resp = client.post("/v2/models/my-model/infer", json=body)
+    assert resp.status_code == 401
+
+    resp = client.post(
+        "/v2/models/my-model/infer",
+        json=body,
+        headers={"Authorization": "Bearer secret"},
+    )
+    assert resp.status_code == 200
+
+    # Its health checks stay open
+    resp = client.get("/v2/health/ready")
+    assert resp.status_code == 200
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    env={"COG_API_KEYS": "secret"},
+    additional_config={"serve": {"auth": {"type": "api_key"}}},
+)
+def test_shutdown_requires_api_key(client):
+    resp = client.post("/shutdown")
+    assert resp.status_code == 401
+
+    resp = client.post("/shutdown", headers={"Authorization": "Bearer wrong"})
+    assert resp.status_code == 401
@@ -0,0 +1,237 @@
+import io
+
+import pytest
+from starlette.datastructures import Headers
+
+from cog.server.cache import (
+    DiskBackend,
+    MemoryBackend,
+    PredictionCache,
+    RedisBackend,
+    RedisError,
+    encode_command,
+    make_prediction_cache,
+    read_reply,
+)
+
+from .conftest import uses_predictor_with_client_options
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+class FakeRedisClient:
+    def __init__(self):
+        self.commands = []
+        self.values = {}
+
+    def command(self, *args):
+        self.commands.append(args)
+        if args[0] == "GET":
+            return self.values.get(args[1])
+        self.values[args[1]] = args[2]
+        return "OK"
+
+
+class BrokenBackend:
+    def get(self, key):
+        raise RedisError("connection refused")
+
+    def set(self, key, value, ttl):
+        raise RedisError("connection refused")
+
+
+def test_memory_backend_expires_entries():
+    clock = FakeClock()
+    backend = MemoryBackend(clock=clock)
+    backend.set("a", b"1", ttl=10)
+    backend.set("b", b"2", ttl=None)
+    assert backend.get("a") == b"1"
+
+    clock.now = 10
+    assert backend.get("a") is None
+    assert backend.get("b") == b"2"
+
+
+def test_memory_backend_forgets_least_recently_used():
+    backend = MemoryBackend(max_entries=2)
+    backend.set("a", b"1", ttl=None)
+    backend.set("b", b"2", ttl=None)
+    assert backend.get("a") == b"1"
+    backend.set("c", b"3", ttl=None)
+    assert backend.get("a") == b"1"
+    assert backend.get("b") is None
+    assert backend.get("c") == b"3"
+
+
+def test_disk_backend(tmp_path):
+    clock = FakeClock()
+    backend = DiskBackend(str(tmp_path / "cache"), clock=clock)
+    assert backend.get("a") is None
+    backend.set("a", b'{"output": "hello"}', ttl=10)
+    backend.set("b", b"{}", ttl=None)
+    assert backend.get("a") == b'{"output": "hello"}'
+    # Another server sharing the directory sees the same entries
+    assert DiskBackend(str(tmp_path / "cache"), clock=clock).get("a") is not None
+
+    clock.now = 10
+    assert backend.get("a") is None
+    assert not (tmp_path / "cache" / "a").exists()
+    assert backend.get("b") == b"{}"
+
+
+def test_redis_protocol():
+    assert encode_command(("SET", "key", b"value", "PX", 1000)) == (
+        b"*5\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n$2\r\nPX\r\n$4\r\n1000\r\n"
+    )
+    assert read_reply(io.BytesIO(b"+OK\r\n")) == "OK"
+    assert read_reply(io.BytesIO(b"$5\r\nhello\r\n")) == b"hello"
+    assert read_reply(io.BytesIO(b"$-1\r\n")) is None
+    assert read_reply(io.BytesIO(b"*2\r\n:1\r\n$1\r\na\r\n")) == [1, b"a"]
+    with pytest.raises(RedisError, match="WRONGPASS"):
+        read_reply(io.BytesIO(b"-WRONGPASS invalid password\r\n"))
+    with pytest.raises(RedisError, match="closed"):
+        read_reply(io.BytesIO(b""))
+
+
+def test_redis_backend():
+    client = FakeRedisClient()
+    backend = RedisBackend(client)
+    backend.set("a", b"1", ttl=1.5)
+    backend.set("b", b"2", ttl=None)
+    assert backend.get("a") == b"1"
+    assert client.commands == [
+        ("SET", "cog:cache:a", b"1", "PX", 1500),
+        ("SET", "cog:cache:b", b"2"),
+        ("GET", "cog:cache:a"),
+    ]
+
+
+def test_prediction_cache_key():
+    cache = PredictionCache(MemoryBackend(), model_version="v1")
+    headers = Headers({})
+    key = cache.key("/predictions", {"input": {"a": 1, "b": 2}}, headers)
+    assert key == cache.key("/predictions", {"input": {"b": 2, "a": 1}}, headers)
+    assert key != cache.key(
+        "/predictions/generate", {"input": {"a": 1, "b": 2}}, headers
+    )
+    assert key != cache.key("/predictions", {"input": {"a": 1}}, headers)
+    assert key != cache.key(
+        "/predictions", {"input": {"a": 1, "b": 2}}, Headers({"cog-output": "upload"})
+    )
+    other_version = PredictionCache(MemoryBackend(), model_version="v2")
+    assert key != other_version.key(
+        "/predictions", {"input": {"a": 1, "b": 2}}, headers
+    )
+
+
+def test_prediction_cache_counts_hits_and_misses():
+    cache = PredictionCache(MemoryBackend(), model_version="v1")
+    assert cache.get("a") is None
+    cache.set("a", b"{}")
+    assert cache.get("a") == b"{}"
+    assert (cache.hits, cache.misses, cache.errors) == (1, 1, 0)
+    assert "cog_cache_hits_total 1\n" in cache.metrics()
+
+
+def test_prediction_cache_ignores_backend_errors():
+    cache = PredictionCache(BrokenBackend(), model_version="v1")
+    cache.set("a", b"{}")
+    assert cache.get("a") is None
+    assert (cache.hits, cache.misses, cache.errors) == (0, 1, 2)
+
+
+def test_make_prediction_cache(tmp_path, monkeypatch):
+    assert make_prediction_cache({}, "predict.py:Predictor") is None
+    monkeypatch.setenv("COG_MODEL_VERSION", "abc123")
+    cache = make_prediction_cache(
+        {"backend": "memory", "ttl": 60}, "predict.py:Predictor"
+    )
+    assert isinstance(cache.backend, MemoryBackend)
+    assert cache.ttl == 60
+    assert cache.model_version == "abc123"
+    cache = make_prediction_cache(
+        {"backend": "disk", "path": str(tmp_path)}, "predict.py:Predictor"
+    )
+    assert isinstance(cache.backend, DiskBackend)
+    # Redis needs a URL
+    assert make_prediction_cache({"backend": "redis"}, "predict.py:Predictor") is None
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"cache": {"backend": "memory"}}}
+)
+def test_predictions_are_cached(client):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.headers["Cog-Cache"] == "miss"
+    assert resp.json()["output"] == "baz"
+
+    resp = client.put("/predictions/abc", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.headers["Cog-Cache"] == "hit"
+    assert resp.json()["output"] == "baz"
+    assert resp.json()["id"] == "abc"
+
+    resp = client.post("/predictions", json={"input": {"text": "qux"}})
+    assert resp.headers["Cog-Cache"] == "miss"
+    assert resp.json()["output"] == "qux"
+
+    resp = client.get("/metrics")
+    assert resp.status_code == 200
+    assert "cog_cache_hits_total 1\n" in resp.text
+    assert "cog_cache_misses_total 2\n" in resp.text
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"cache": {"backend": "memory"}}}
+)
+def test_cached_predictions_are_part_of_their_own_experiment(client):
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Cog-Experiment": "checkout", "Cog-Variant": "a"},
+    )
+    assert resp.headers["Cog-Cache"] == "miss"
+    assert resp.json()["experiment"] == {"id": "checkout", "variant": "a"}
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Cog-Experiment": "checkout", "Cog-Variant": "b"},
+    )
+    assert resp.headers["Cog-Cache"] == "hit"
+    assert resp.json()["experiment"] == {"id": "checkout", "variant": "b"}
+
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.headers["Cog-Cache"] == "hit"
+    assert resp.json()["experiment"] is None
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"cache": {"backend": "memory"}}}
+)
+def test_async_predictions_arent_cached(client):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.headers["Cog-Cache"] == "miss"
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Prefer": "respond-async"},
+    )
+    assert resp.status_code == 202
+    assert "Cog-Cache" not in resp.headers
+
+
+@uses_predictor_with_client_options("input_string")
+def test_predictions_arent_cached_by_default(client):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert "Cog-Cache" not in resp.headers
+    assert client.get("/metrics").status_code == 404
@@ -0,0 +1,102 @@
+import json
+from datetime import datetime, timezone
+
+from cog import schema
+from cog.server.dead_letter import (
+    DeadLetterQueue,
+    input_key,
+    make_dead_letter_queue,
+)
+from cog.server.recorder import DirectorySink
+
+from .conftest import make_client, wait_for_setup
+
+
+class FakeSink:
+    def __init__(self):
+        self.files = {}
+
+    def write(self, name, data):
+        self.files[name] = data
+
+
+def crashed(prediction_id):
+    response = schema.PredictionResponse(
+        id=prediction_id,
+        status=schema.Status.FAILED,
+        error="Prediction failed for an unknown reason.",
+        logs="Segmentation fault\n",
+    )
+    response._fatal_exception = Exception("worker died")
+    return response
+
+
+def test_input_key():
+    assert input_key({"a": 1, "b": 2}) == input_key({"b": 2, "a": 1})
+    assert input_key({"a": 1}) != input_key({"a": 2})
+
+
+def test_inputs_are_quarantined_after_max_crashes():
+    sink = FakeSink()
+    queue = DeadLetterQueue(
+        sink,
+        max_crashes=2,
+        clock=lambda: datetime(2024, 5, 24, 6, 0, tzinfo=timezone.utc),
+    )
+    inputs = {"text": "crash"}
+
+    queue.observe(inputs, crashed("a"))
+    assert not queue.is_quarantined(inputs)
+    # Predictions that don't crash the model aren't counted
+    queue.observe(
+        inputs, schema.PredictionResponse(id="b", status=schema.Status.FAILED)
+    )
+    assert not queue.is_quarantined(inputs)
+    queue.observe(inputs, crashed("c"))
+    assert queue.is_quarantined(inputs)
+    assert not queue.is_quarantined({"text": "hello"})
+
+    key = input_key(inputs)
+    entry = json.loads(sink.files[f"{key}.json"])
+    assert entry["id"] == key
+    assert entry["quarantined_at"] == "2024-05-24T06:00:00+00:00"
+    assert entry["input"] == inputs
+    assert [c["prediction_id"] for c in entry["crashes"]] == ["a", "c"]
+    assert entry["crashes"][0]["logs"] == "Segmentation fault\n"
+
+    queue.clear()
+    assert not queue.is_quarantined(inputs)
+
+
+def test_make_dead_letter_queue(tmp_path):
+    assert make_dead_letter_queue({}) is None
+    queue = make_dead_letter_queue({"destination": str(tmp_path)})
+    assert isinstance(queue.sink, DirectorySink)
+    assert queue.max_crashes == 3
+    # S3 needs credentials
+    assert make_dead_letter_queue({"destination": "s3://bucket/dead-letter"}) is None
+
+
+def test_model_restarts_and_quarantines_inputs_that_crash_it(tmp_path):
+    config = {
+        "serve": {"dead_letter": {"destination": str(tmp_path), "max_crashes": 2}}
+    }
+    with make_client("crash_on_input", additional_config=config) as client:
+        wait_for_setup(client)
+        for _ in range(2):
+            resp = client.post("/predictions", json={"input": {"text": "crash"}})
+            assert resp.json()["status"] == "failed"
+            wait_for_setup(client)
+            assert client.get("/health-check").json()["status"] == "READY"
+
+        resp = client.post("/predictions", json={"input": {"text": "crash"}})
+        assert resp.status_code == 422
+        assert resp.json()["detail"][0]["type"] == "value_error.quarantined"
+
+        resp = client.post("/predictions", json={"input": {"text": "hello"}})
+        assert resp.status_code == 200
+        assert resp.json()["output"] == "hello"
+
+    entry = json.loads((tmp_path / f"{input_key({'text': 'crash'})}.json").read_text())
+    assert entry["input"] == {"text": "crash"}
+    assert len(entry["crashes"]) == 2
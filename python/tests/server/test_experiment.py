@@ -0,0 +1,92 @@
+import time
+
+import responses
+from responses import matchers
+
+from .conftest import uses_predictor
+
+
+@uses_predictor("input_string")
+def test_experiment_headers(client, match):
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Cog-Experiment": "checkout", "Cog-Variant": "b"},
+    )
+    assert resp.status_code == 200
+    assert resp.json() == match(
+        {
+            "status": "succeeded",
+            "output": "baz",
+            "experiment": {"id": "checkout", "variant": "b"},
+        }
+    )
+
+
+@uses_predictor("input_string")
+def test_experiment_in_request_body(client, match):
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}, "experiment": {"variant": "a"}},
+    )
+    assert resp.json() == match(
+        {"status": "succeeded", "experiment": {"id": None, "variant": "a"}}
+    )
+
+    # The headers take precedence
+    resp = client.put(
+        "/predictions/abcd1234",
+        json={"input": {"text": "baz"}, "experiment": {"variant": "a"}},
+        headers={"Cog-Variant": "b"},
+    )
+    assert resp.json() == match(
+        {"status": "succeeded", "experiment": {"id": None, "variant": "b"}}
+    )
+
+
+@uses_predictor("input_string")
+def test_no_experiment(client, match):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.json() == match({"status": "succeeded", "experiment": None})
+
+
+@responses.activate
+@uses_predictor("input_string")
+def test_experiment_in_webhooks(client):
+    webhook = responses.post(
+        "https://example.com/webhook",
+        match=[
+            matchers.json_params_matcher(
+                {
+                    "id": "12345abcde",
+                    "status": "succeeded",
+                    "experiment": {"id": "checkout", "variant": "b"},
+                },
+                strict_match=False,
+            )
+        ],
+        status=200,
+    )
+
+    resp = client.post(
+        "/predictions",
+        json={
+            "id": "12345abcde",
+            "input": {"text": "hello world"},
+            "webhook": "https://example.com/webhook",
+            "webhook_events_filter": ["completed"],
+        },
+        headers={
+            "Prefer": "respond-async",
+            "Cog-Experiment": "checkout",
+            "Cog-Variant": "b",
+        },
+    )
+    assert resp.status_code == 202
+    assert resp.json()["experiment"] == {"id": "checkout", "variant": "b"}
+
+    n = 0
+    while webhook.call_count < 1 and n < 10:
+        time.sleep(0.1)
+        n += 1
+    assert webhook.call_count == 1
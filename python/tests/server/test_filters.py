@@ -0,0 +1,135 @@
+import pytest
+import requests
+from cog.server.filters import (
+    CallableFilter,
+    FilterError,
+    FilterResult,
+    HTTPFilter,
+    make_content_filters,
+)
+
+from .conftest import _fixture_path, make_client, wait_for_setup
+
+FILTER = _fixture_path("content_filter.py:ContentFilter")
+
+
+class FakeResponse:
+    def __init__(self, body, status_code=200):
+        self.body = body
+        self.status_code = status_code
+
+    def raise_for_status(self):
+        if self.status_code >= 400:
+            raise requests.HTTPError(f"{self.status_code} error")
+
+    def json(self):
+        return self.body
+
+
+class FakeSession:
+    def __init__(self, response):
+        self.response = response
+        self.requests = []
+
+    def post(self, url, json, timeout):
+        self.requests.append((url, json, timeout))
+        return self.response
+
+
+def test_filter_result_from_dict():
+    assert FilterResult.from_dict(None) == FilterResult(allowed=True)
+    assert FilterResult.from_dict({"allowed": False, "reason": "nope"}) == (
+        FilterResult(allowed=False, reason="nope")
+    )
+    assert FilterResult.from_dict({"allowed": True, "output": None}) == (
+        FilterResult(allowed=True, replaced=True, output=None)
+    )
+    with pytest.raises(FilterError):
+        FilterResult.from_dict({"reason": "nope"})
+
+
+def test_callable_filter():
+    payloads = []
+
+    def check(payload):
+        payloads.append(payload)
+        return {"allowed": payload["output"] != "nope"}
+
+    f = CallableFilter(check)
+    assert f.check("output", "p1", {"text": "a"}, "yes").allowed
+    assert not f.check("output", "p1", {"text": "a"}, "nope").allowed
+    assert payloads[0] == {
+        "stage": "output",
+        "id": "p1",
+        "input": {"text": "a"},
+        "output": "yes",
+    }
+
+    def broken(payload):
+        raise RuntimeError("classifier crashed")
+
+    with pytest.raises(FilterError, match="classifier crashed"):
+        CallableFilter(broken).check("input", "p1", {})
+
+
+def test_http_filter():
+    session = FakeSession(FakeResponse({"allowed": False, "reason": "nsfw"}))
+    f = HTTPFilter("http://localhost:8080/check", timeout=2, session=session)
+    assert f.check("input", "p1", {"text": "a"}) == FilterResult(
+        allowed=False, reason="nsfw"
+    )
+    assert session.requests == [
+        (
+            "http://localhost:8080/check",
+            {"stage": "input", "id": "p1", "input": {"text": "a"}},
+            2,
+        )
+    ]
+
+    session = FakeSession(FakeResponse({}, status_code=500))
+    f = HTTPFilter("http://localhost:8080/check", session=session)
+    with pytest.raises(FilterError, match="500 error"):
+        f.check("input", "p1", {})
+
+
+def test_make_content_filters():
+    assert make_content_filters({}) is None
+    filters = make_content_filters(
+        {"input": FILTER, "output": "http://localhost:8080/check", "timeout": 3}
+    )
+    assert isinstance(filters.input, CallableFilter)
+    assert isinstance(filters.output, HTTPFilter)
+    assert filters.output.timeout == 3
+
+
+def test_inputs_and_outputs_are_filtered():
+    config = {"serve": {"filters": {"input": FILTER, "output": FILTER}}}
+    with make_client("input_string", additional_config=config) as client:
+        wait_for_setup(client)
+        resp = client.post("/predictions", json={"input": {"text": "good dog"}})
+        assert resp.status_code == 200
+        assert resp.json()["output"] == "good dog"
+
+        resp = client.post("/predictions", json={"input": {"text": "bad dog"}})
+        assert resp.status_code == 422
+        assert resp.json() == {
+            "detail": [
+                {
+                    "loc": ["body", "input"],
+                    "msg": "The input was rejected by the content filter: The text contains blocked words",
+                    "type": "value_error.content_filter",
+                }
+            ]
+        }
+
+        resp = client.post("/predictions", json={"input": {"text": "darn dog"}})
+        assert resp.status_code == 200
+        assert resp.json()["output"] == "d*** dog"
+
+        resp = client.post("/predictions", json={"input": {"text": "forbidden"}})
+        assert resp.status_code == 200
+        assert resp.json()["status"] == "failed"
+        assert resp.json()["output"] is None
+        assert (
+            resp.json()["error"] == "The output was rejected by the content filter"
+        )
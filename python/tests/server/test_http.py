@@ -11,10 +11,12 @@ from responses import matchers
 from cog.types import PYDANTIC_V2
 
 from .conftest import (
+    _fixture_path,
     make_client,
     uses_predictor,
     uses_predictor_with_client_options,
     uses_trainer,
+    wait_for_setup,
 )
 
 
@@ -42,6 +44,69 @@ def test_setup_healthcheck():
     data = resp.json()
     assert data["status"] == "STARTING"
     assert data["setup"] == {}
+    assert data["cog_version"]
+
+
+@uses_predictor("slow_setup")
+def test_setup_healthcheck_reports_setup_time(client):
+    data = client.get("/health-check").json()
+    assert data["status"] == "READY"
+    assert data["setup"]["status"] == "succeeded"
+    assert data["setup"]["metrics"]["setup_time"] >= 2
+
+
+@uses_predictor_with_client_options(
+    "slow_setup", additional_config={"serve": {"setup_timeout": 0.5}}
+)
+def test_setup_timeout(client):
+    data = client.get("/health-check").json()
+    assert data["status"] == "SETUP_FAILED"
+    assert data["setup"]["status"] == "failed"
+    assert "Setup did not complete within 0.5 seconds" in data["setup"]["logs"]
+
+    # Setup finishing late doesn't make the model ready
+    time.sleep(2)
+    assert client.get("/health-check").json()["status"] == "SETUP_FAILED"
+
+
+@uses_predictor_with_client_options(
+    "segfault_in_predict", additional_config={"serve": {"restart_on_crash": True}}
+)
+def test_model_restarts_after_a_crash(client):
+    for _ in range(2):
+        resp = client.post("/predictions")
+        assert resp.status_code == 200
+        assert resp.json()["status"] == "failed"
+        assert "crashed with SIGSEGV" in resp.json()["error"]
+        assert "Fatal Python error: Segmentation fault" in resp.json()["logs"]
+
+        wait_for_setup(client)
+        assert client.get("/health-check").json()["status"] == "READY"
+
+
+@uses_predictor("oom_in_predict")
+def test_out_of_memory_errors_are_reported(client, match):
+    resp = client.post("/predictions", json={"input": {"batch_size": 4}})
+    assert resp.status_code == 200
+    assert resp.json() == match(
+        {"status": "failed", "error_type": "cuda_out_of_memory"}
+    )
+    assert "CUDA out of memory" in resp.json()["error"]
+
+
+@uses_predictor_with_client_options(
+    "oom_in_predict",
+    additional_config={
+        "serve": {"retry_on_oom": True, "oom_batch_size_input": "batch_size"}
+    },
+)
+def test_predictions_that_run_out_of_memory_are_retried(client, match):
+    resp = client.post("/predictions", json={"input": {"batch_size": 4}})
+    assert resp.status_code == 200
+    assert resp.json() == match(
+        {"status": "succeeded", "output": 2, "error_type": None}
+    )
+    assert "retried with batch_size=2" in resp.json()["logs"]
 
 
 @uses_predictor("setup")
@@ -468,6 +533,117 @@ def test_yielding_files_from_generator_predictors(client):
     assert image_color(output[2]) == (255, 255, 0)  # yellow
 
 
+@uses_predictor_with_client_options(
+    "predict_methods", additional_config={"predict_methods": ["embed"]}
+)
+def test_predict_methods(client, match):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "hello baz"})
+
+    resp = client.post("/predictions/embed", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": [3.0, 3.0, 3.0]})
+
+    resp = client.put(
+        "/predictions/embed/abcd1234",
+        json={"input": {"text": "baz", "dimensions": 1}},
+    )
+    assert resp.status_code == 200
+    assert resp.json() == match(
+        {"id": "abcd1234", "status": "succeeded", "output": [3.0]}
+    )
+
+    # Each method validates its own input
+    resp = client.post("/predictions/embed", json={"input": {}})
+    assert resp.status_code == 422
+
+    assert client.get("/").json()["predict_method_urls"] == {
+        "embed": "/predictions/embed"
+    }
+
+
+@uses_predictor_with_client_options(
+    "batch",
+    additional_config={"batching": {"max_batch_size": 8, "max_latency_ms": 1}},
+)
+def test_batched_prediction(client, match):
+    resp = client.post("/predictions", json={"input": {"text": "ab", "repeat": 3}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": "ababab"})
+    assert resp.json()["metrics"]["batch_size"] == 1
+    assert resp.json()["logs"] == "running a batch of 1\n"
+
+
+@uses_predictor_with_client_options(
+    "predict_methods", additional_config={"predict_methods": ["embed"]}
+)
+def test_openapi_specification_with_predict_methods(client):
+    schema = client.get("/openapi.json").json()
+    assert "/predictions/embed" in schema["paths"]
+    assert "/predictions/embed/{prediction_id}" in schema["paths"]
+    components = schema["components"]["schemas"]
+    assert components["EmbedInput"]["required"] == ["text"]
+    assert components["EmbedOutput"]["type"] == "array"
+    assert "EmbedPredictionRequest" in components
+    assert "EmbedPredictionResponse" in components
+    assert components["Input"]["properties"]["text"]["default"] == "world"
+
+
+@uses_predictor_with_client_options(
+    "predict_methods", additional_config={"predict_methods": ["generate"]}
+)
+def test_predict_methods_missing_method(client):
+    resp = client.get("/health-check")
+    assert resp.json()["status"] == "SETUP_FAILED"
+
+
+PIPELINE = [
+    {
+        "name": "transcribe",
+        "predict": _fixture_path("pipeline_transcribe"),
+        "inputs": {"audio": "$input.audio"},
+    },
+    {
+        "name": "translate",
+        "predict": _fixture_path("pipeline_translate"),
+        "inputs": {
+            "text": "$transcribe.output.text",
+            "target": "$input.target",
+            "repeat": 2,
+        },
+    },
+    {
+        "name": "speak",
+        "predict": _fixture_path("pipeline_speak"),
+        "inputs": {"text": "$translate.output"},
+    },
+]
+
+
+@uses_predictor_with_client_options(
+    "input_none", additional_config={"pipeline": PIPELINE}
+)
+def test_pipeline(client, match):
+    resp = client.post("/predictions", json={"input": {"audio": "hello"}})
+    assert resp.status_code == 200
+    assert resp.json() == match(
+        {"status": "succeeded", "output": "speaking: [fr] HELLO [fr] HELLO"}
+    )
+
+    resp = client.post("/predictions", json={"input": {"audio": "hi", "target": "de"}})
+    assert resp.json() == match(
+        {"status": "succeeded", "output": "speaking: [de] HI [de] HI"}
+    )
+
+    schema = client.get("/openapi.json").json()
+    properties = schema["components"]["schemas"]["Input"]["properties"]
+    assert list(properties) == ["audio", "target"]
+    assert properties["audio"]["description"] == "Audio to transcribe"
+    assert properties["target"]["default"] == "fr"
+    assert schema["components"]["schemas"]["Output"]["type"] == "string"
+
+
 @uses_predictor("input_none")
 def test_prediction_idempotent_endpoint(client, match):
     resp = client.put("/predictions/abcd1234", json={})
@@ -0,0 +1,84 @@
+from .conftest import uses_predictor_with_client_options
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    additional_config={
+        "serve": {"cors": {"allowed_origins": ["https://demo.example.com"]}}
+    },
+)
+def test_cors_preflight(client):
+    resp = client.options(
+        "/predictions",
+        headers={
+            "Origin": "https://demo.example.com",
+            "Access-Control-Request-Method": "POST",
+            "Access-Control-Request-Headers": "content-type",
+        },
+    )
+    assert resp.status_code == 200
+    assert resp.headers["Access-Control-Allow-Origin"] == "https://demo.example.com"
+    assert "POST" in resp.headers["Access-Control-Allow-Methods"]
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    additional_config={
+        "serve": {"cors": {"allowed_origins": ["https://demo.example.com"]}}
+    },
+)
+def test_cors_prediction(client):
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Origin": "https://demo.example.com"},
+    )
+    assert resp.status_code == 200
+    assert resp.headers["Access-Control-Allow-Origin"] == "https://demo.example.com"
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Origin": "https://evil.example.com"},
+    )
+    assert "Access-Control-Allow-Origin" not in resp.headers
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    env={"COG_API_KEYS": "secret"},
+    additional_config={
+        "serve": {
+            "auth": {"type": "api_key"},
+            "cors": {"allowed_origins": ["*"]},
+        }
+    },
+)
+def test_cors_preflight_does_not_need_token(client):
+    resp = client.options(
+        "/predictions",
+        headers={
+            "Origin": "https://demo.example.com",
+            "Access-Control-Request-Method": "POST",
+            "Access-Control-Request-Headers": "authorization",
+        },
+    )
+    assert resp.status_code == 200
+
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Origin": "https://demo.example.com"},
+    )
+    assert resp.status_code == 401
+    assert resp.headers["Access-Control-Allow-Origin"] == "*"
+
+
+@uses_predictor_with_client_options("input_string")
+def test_no_cors_by_default(client):
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Origin": "https://demo.example.com"},
+    )
+    assert "Access-Control-Allow-Origin" not in resp.headers
@@ -49,6 +49,61 @@ def test_output_file_to_http(client, match):
     assert res.status_code == 200
 
 
+@responses.activate
+@uses_predictor("output_file_named")
+def test_output_file_to_presigned_url(client, match):
+    responses.add(
+        responses.PUT,
+        "https://bucket.example.com/outputs/foo.txt?X-Signature=abc",
+        status=200,
+    )
+
+    res = client.post(
+        "/predictions",
+        headers={
+            "Cog-Output-Upload-Url": "https://bucket.example.com/outputs/foo.txt?X-Signature=abc"
+        },
+    )
+    assert res.json() == match(
+        {
+            "status": "succeeded",
+            "output": "https://bucket.example.com/outputs/foo.txt",
+        }
+    )
+    assert res.status_code == 200
+
+
+@responses.activate
+@uses_predictor_with_client_options(
+    "output_file_named",
+    additional_config={
+        "serve": {"output": "upload", "output_upload_url": "http://example.com/up/"}
+    },
+)
+def test_output_file_upload_by_default(client, match):
+    responses.add(responses.PUT, "http://example.com/up/foo.txt", status=201)
+
+    res = client.post("/predictions")
+    assert res.json() == match(
+        {"status": "succeeded", "output": "http://example.com/up/foo.txt"}
+    )
+
+    # Clients can still ask for outputs inline
+    res = client.post("/predictions", headers={"Cog-Output": "inline"})
+    assert res.json() == match(
+        {"status": "succeeded", "output": "data:text/plain;base64,aGVsbG8="}
+    )
+
+
+@uses_predictor("output_file_named")
+def test_output_upload_without_destination(client):
+    res = client.post("/predictions", headers={"Cog-Output": "upload"})
+    assert res.status_code == 400
+
+    res = client.post("/predictions", headers={"Cog-Output": "elsewhere"})
+    assert res.status_code == 400
+
+
 @responses.activate
 @uses_predictor_with_client_options("output_file_named", upload_url="https://dontuseme")
 def test_output_file_to_http_with_upload_url_specified(client, match):
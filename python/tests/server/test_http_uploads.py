@@ -0,0 +1,76 @@
+import json
+
+from .conftest import uses_predictor, uses_predictor_with_client_options
+
+
+@uses_predictor("input_multiple")
+def test_multipart_prediction(client, match):
+    resp = client.post(
+        "/predictions",
+        data={"text": "baz", "input": json.dumps({"num1": 5})},
+        files={"path": ("file.txt", b"bar", "text/plain")},
+    )
+    assert resp.status_code == 200
+    assert resp.json() == match({"output": "baz 50 bar", "status": "succeeded"})
+
+
+@uses_predictor("input_multiple")
+def test_multipart_prediction_invalid_input_part(client):
+    resp = client.post(
+        "/predictions",
+        data={"input": "[1, 2]"},
+        files={"path": ("file.txt", b"bar", "text/plain")},
+    )
+    assert resp.status_code == 422
+    assert "must be a JSON object" in resp.json()["detail"]
+
+
+@uses_predictor("input_path")
+def test_chunked_upload(client, match):
+    resp = client.post(
+        "/uploads", content=b"hello ", headers={"Upload-Filename": "greeting.txt"}
+    )
+    assert resp.status_code == 201
+    upload = resp.json()
+    assert upload["offset"] == 6
+
+    # A chunk that doesn't start where the upload ends is rejected, with the
+    # offset to resume from
+    resp = client.patch(
+        f"/uploads/{upload['id']}", content=b"world", headers={"Upload-Offset": "2"}
+    )
+    assert resp.status_code == 409
+    assert resp.json()["offset"] == 6
+
+    resp = client.patch(
+        f"/uploads/{upload['id']}", content=b"world", headers={"Upload-Offset": "6"}
+    )
+    assert resp.status_code == 200
+    assert resp.json()["offset"] == 11
+
+    resp = client.get(f"/uploads/{upload['id']}")
+    assert resp.json()["offset"] == 11
+
+    resp = client.post("/predictions", json={"input": {"path": upload["url"]}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"output": "txt hello world", "status": "succeeded"})
+
+
+@uses_predictor("input_path")
+def test_upload_not_found(client):
+    resp = client.get("/uploads/0123456789abcdef0123456789abcdef")
+    assert resp.status_code == 404
+
+    resp = client.post("/predictions", json={"input": {"path": "upload://nope"}})
+    assert resp.status_code == 422
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"max_request_size": "100"}}
+)
+def test_max_request_size(client):
+    resp = client.post("/predictions", json={"input": {"text": "a" * 200}})
+    assert resp.status_code == 413
+
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
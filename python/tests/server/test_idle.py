@@ -0,0 +1,48 @@
+from cog.server.idle import IdleMonitor
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+def test_idle_monitor():
+    clock = FakeClock()
+    idle = []
+    monitor = IdleMonitor(
+        60, is_busy=lambda: False, on_idle=lambda: idle.append(True), clock=clock
+    )
+
+    clock.now = 30
+    assert not monitor.check()
+    monitor.touch()
+
+    clock.now = 80
+    assert not monitor.check()
+    assert not idle
+
+    clock.now = 90
+    assert monitor.check()
+    assert idle == [True]
+
+
+def test_idle_monitor_waits_for_running_predictions():
+    clock = FakeClock()
+    busy = True
+    idle = []
+    monitor = IdleMonitor(
+        60, is_busy=lambda: busy, on_idle=lambda: idle.append(True), clock=clock
+    )
+
+    clock.now = 600
+    assert not monitor.check()
+
+    # The prediction has just finished, so the server has only been idle since now
+    busy = False
+    clock.now = 630
+    assert not monitor.check()
+    clock.now = 660
+    assert monitor.check()
@@ -0,0 +1,190 @@
+import base64
+import struct
+import wave
+
+import pytest
+from cog.server.input_limits import (
+    InputLimit,
+    InputLimits,
+    audio_duration,
+    count_tokens,
+    image_size,
+    make_input_limits,
+)
+
+from .conftest import make_client, wait_for_setup
+
+
+def _png(width, height):
+    return (
+        b"\x89PNG\r\n\x1a\n"
+        + struct.pack(">I", 13)
+        + b"IHDR"
+        + struct.pack(">IIBBBBB", width, height, 8, 2, 0, 0, 0)
+        + b"\x00\x00\x00\x00"
+    )
+
+
+def _jpeg(width, height):
+    app0 = b"\xff\xe0" + struct.pack(">H", 16) + b"JFIF\x00" + b"\x00" * 9
+    sof0 = b"\xff\xc0" + struct.pack(">HBHHB", 11, 8, height, width, 1) + b"\x00" * 3
+    return b"\xff\xd8" + app0 + sof0 + b"\xff\xd9"
+
+
+def _flac(sample_rate, total_samples):
+    info = (sample_rate << 44) | (1 << 41) | (15 << 36) | total_samples
+    streaminfo = b"\x00" * 10 + info.to_bytes(8, "big") + b"\x00" * 16
+    return b"fLaC" + b"\x00" + (34).to_bytes(3, "big") + streaminfo
+
+
+def _wav(path, seconds, sample_rate=8000):
+    with wave.open(str(path), "wb") as f:
+        f.setnchannels(1)
+        f.setsampwidth(2)
+        f.setframerate(sample_rate)
+        f.writeframes(b"\x00\x00" * int(seconds * sample_rate))
+
+
+def test_image_size(tmp_path):
+    png = tmp_path / "a.png"
+    png.write_bytes(_png(640, 480))
+    assert image_size(png) == (640, 480)
+
+    jpeg = tmp_path / "a.jpg"
+    jpeg.write_bytes(_jpeg(1920, 1080))
+    assert image_size(jpeg) == (1920, 1080)
+
+    gif = tmp_path / "a.gif"
+    gif.write_bytes(b"GIF89a" + struct.pack("<HH", 32, 16) + b"\x00" * 8)
+    assert image_size(gif) == (32, 16)
+
+    text = tmp_path / "a.txt"
+    text.write_text("not an image")
+    assert image_size(text) is None
+
+
+def test_audio_duration(tmp_path):
+    wav = tmp_path / "a.wav"
+    _wav(wav, 1.5)
+    assert audio_duration(wav) == pytest.approx(1.5)
+
+    flac = tmp_path / "a.flac"
+    flac.write_bytes(_flac(44100, 44100 * 3))
+    assert audio_duration(flac) == pytest.approx(3)
+
+
+def test_count_tokens():
+    assert count_tokens("Hello, world!") == 4
+    assert count_tokens("") == 0
+
+
+def test_make_input_limits():
+    assert make_input_limits({}) is None
+    limits = make_input_limits(
+        {"image": {"max_resolution": "1024x768"}, "prompt": {"max_tokens": 10}}
+    )
+    assert limits.limits == {
+        "image": InputLimit(max_resolution=(1024, 768)),
+        "prompt": InputLimit(max_tokens=10),
+    }
+    with pytest.raises(ValueError):
+        make_input_limits({"image": {"max_resolution": "1024"}})
+
+
+def test_check(tmp_path):
+    big = tmp_path / "big.png"
+    big.write_bytes(_png(4096, 512))
+    small = tmp_path / "small.png"
+    small.write_bytes(_png(512, 512))
+    long_wav = tmp_path / "long.wav"
+    _wav(long_wav, 2)
+    limits = InputLimits.from_config(
+        {
+            "image": {"max_resolution": "1024x1024"},
+            "images": {"max_resolution": "1024x1024"},
+            "audio": {"max_duration": 1},
+            "prompt": {"max_tokens": 3},
+        }
+    )
+
+    assert limits.check({"image": small, "prompt": "a hot dog"}) == []
+    # Inputs without limits, and inputs that aren't set, aren't checked
+    assert limits.check({"other": "a very long string indeed"}) == []
+
+    errors = limits.check(
+        {
+            "image": big,
+            "images": [small, big],
+            "audio": long_wav,
+            "prompt": "a hot dog in a bun",
+        }
+    )
+    assert [e.to_dict() for e in errors] == [
+        {
+            "loc": ["body", "input", "image"],
+            "msg": "image is 4096x512, which is larger than the maximum resolution of 1024x1024",
+            "type": "value_error.max_resolution",
+            "ctx": {"limit_value": "1024x1024"},
+        },
+        {
+            "loc": ["body", "input", "images"],
+            "msg": "images is 4096x512, which is larger than the maximum resolution of 1024x1024",
+            "type": "value_error.max_resolution",
+            "ctx": {"limit_value": "1024x1024"},
+        },
+        {
+            "loc": ["body", "input", "audio"],
+            "msg": "audio is 2 seconds long, which is longer than the maximum of 1 seconds",
+            "type": "value_error.max_duration",
+            "ctx": {"limit_value": 1.0},
+        },
+        {
+            "loc": ["body", "input", "prompt"],
+            "msg": "prompt is 6 tokens long, which is more than the maximum of 3",
+            "type": "value_error.max_tokens",
+            "ctx": {"limit_value": 3},
+        },
+    ]
+
+
+def test_check_unreadable_image(tmp_path):
+    text = tmp_path / "a.txt"
+    text.write_text("not an image")
+    limits = InputLimits.from_config({"image": {"max_resolution": "1024x1024"}})
+    [error] = limits.check({"image": text})
+    assert error.kind == "max_resolution"
+    assert "Couldn't read the resolution of image" in str(error)
+
+
+def test_long_prompts_are_rejected():
+    config = {"serve": {"input_limits": {"text": {"max_tokens": 3}}}}
+    with make_client("input_string", additional_config=config) as client:
+        wait_for_setup(client)
+        resp = client.post("/predictions", json={"input": {"text": "a hot dog"}})
+        assert resp.status_code == 200
+        assert resp.json()["output"] == "a hot dog"
+
+        resp = client.post(
+            "/predictions", json={"input": {"text": "a hot dog in a bun"}}
+        )
+        assert resp.status_code == 422
+        assert resp.json() == {
+            "detail": [
+                {
+                    "loc": ["body", "input", "text"],
+                    "msg": "text is 6 tokens long, which is more than the maximum of 3",
+                    "type": "value_error.max_tokens",
+                    "ctx": {"limit_value": 3},
+                }
+            ]
+        }
+
+
+def test_large_images_are_rejected():
+    config = {"serve": {"input_limits": {"path": {"max_resolution": "64x64"}}}}
+    data_url = "data:image/png;base64," + base64.b64encode(_png(128, 32)).decode()
+    with make_client("input_path", additional_config=config) as client:
+        wait_for_setup(client)
+        resp = client.post("/predictions", json={"input": {"path": data_url}})
+        assert resp.status_code == 422
+        assert resp.json()["detail"][0]["type"] == "value_error.max_resolution"
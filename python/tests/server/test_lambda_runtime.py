@@ -0,0 +1,30 @@
+import base64
+import json
+
+import pytest
+
+from cog.server.lambda_runtime import parse_event
+
+
+def test_parse_event():
+    assert parse_event({"input": {"prompt": "a hotdog"}}) == {"prompt": "a hotdog"}
+    assert parse_event({"prompt": "a hotdog"}) == {"prompt": "a hotdog"}
+
+
+def test_parse_event_from_function_url():
+    body = json.dumps({"input": {"prompt": "a hotdog"}})
+    assert parse_event({"body": body, "isBase64Encoded": False}) == {
+        "prompt": "a hotdog"
+    }
+    encoded = base64.b64encode(body.encode("utf-8")).decode("utf-8")
+    assert parse_event({"body": encoded, "isBase64Encoded": True}) == {
+        "prompt": "a hotdog"
+    }
+    assert parse_event({"body": ""}) == {}
+
+
+def test_parse_event_rejects_non_objects():
+    with pytest.raises(ValueError):
+        parse_event(["a hotdog"])
+    with pytest.raises(ValueError):
+        parse_event({"input": "a hotdog"})
@@ -0,0 +1,137 @@
+from cog import schema
+from cog.server.metrics import PredictionMetrics
+
+from .conftest import uses_predictor_with_client_options
+
+
+def _response(status, predict_time=None):
+    response = schema.PredictionResponse(input={}, status=status)
+    if predict_time is not None:
+        response.metrics = {"predict_time": predict_time}
+    return response
+
+
+def test_prediction_metrics():
+    metrics = PredictionMetrics(buckets=(1, 10))
+    metrics.observe(_response(schema.Status.SUCCEEDED, 0.5))
+    metrics.observe(_response(schema.Status.SUCCEEDED, 5))
+    metrics.observe(_response(schema.Status.SUCCEEDED, 20))
+    metrics.observe(_response(schema.Status.FAILED))
+    assert metrics.counts == {
+        ("", "succeeded"): 3,
+        ("", "failed"): 1,
+        ("", "canceled"): 0,
+    }
+
+    text = metrics.metrics()
+    assert 'cog_predictions_total{status="succeeded"} 3\n' in text
+    assert 'cog_predictions_total{status="canceled"} 0\n' in text
+    assert 'cog_prediction_duration_seconds_bucket{le="1"} 1\n' in text
+    assert 'cog_prediction_duration_seconds_bucket{le="10"} 2\n' in text
+    assert 'cog_prediction_duration_seconds_bucket{le="+Inf"} 3\n' in text
+    assert "cog_prediction_duration_seconds_sum 25.5\n" in text
+    assert "cog_prediction_duration_seconds_count 3\n" in text
+
+
+def test_prediction_usage_metrics():
+    metrics = PredictionMetrics()
+    response = _response(schema.Status.SUCCEEDED, 2)
+    response.metrics.update({"cpu_time": 1.5, "gpu_time": 2, "energy": 300})
+    metrics.observe(response)
+    response = _response(schema.Status.FAILED)
+    response.metrics = {"cpu_time": 0.5}
+    response.experiment = schema.Experiment(variant="b")
+    metrics.observe(response)
+
+    text = metrics.metrics()
+    assert "# TYPE cog_prediction_cpu_seconds_total counter\n" in text
+    assert "cog_prediction_cpu_seconds_total 1.5\n" in text
+    assert 'cog_prediction_cpu_seconds_total{variant="b"} 0.5\n' in text
+    assert "cog_prediction_gpu_seconds_total 2.0\n" in text
+    assert "cog_prediction_energy_joules_total 300.0\n" in text
+
+
+def test_prediction_error_metrics():
+    metrics = PredictionMetrics()
+    text = metrics.metrics()
+    assert "# TYPE cog_prediction_errors_total counter\n" in text
+    assert 'cog_prediction_errors_total{type="cuda_out_of_memory"} 0\n' in text
+
+    response = _response(schema.Status.FAILED)
+    response.error_type = "cuda_out_of_memory"
+    metrics.observe(response)
+    response = _response(schema.Status.FAILED)
+    response.error_type = "cuda_out_of_memory"
+    response.experiment = schema.Experiment(variant="b")
+    metrics.observe(response)
+    metrics.observe(_response(schema.Status.FAILED))
+
+    text = metrics.metrics()
+    assert 'cog_prediction_errors_total{type="cuda_out_of_memory"} 1\n' in text
+    assert (
+        'cog_prediction_errors_total{type="cuda_out_of_memory",variant="b"} 1\n'
+        in text
+    )
+
+
+def test_prediction_metrics_by_variant():
+    metrics = PredictionMetrics(buckets=(1, 10))
+    metrics.observe(_response(schema.Status.SUCCEEDED, 0.5))
+    response = _response(schema.Status.SUCCEEDED, 5)
+    response.experiment = schema.Experiment(id="checkout", variant='b "new"')
+    metrics.observe(response)
+    response = _response(schema.Status.FAILED)
+    response.experiment = schema.Experiment(variant="b")
+    metrics.observe(response)
+
+    text = metrics.metrics()
+    assert 'cog_predictions_total{status="succeeded"} 1\n' in text
+    assert (
+        'cog_predictions_total{status="succeeded",experiment="checkout",variant="b \\"new\\""} 1\n'
+        in text
+    )
+    assert 'cog_predictions_total{status="failed",variant="b"} 1\n' in text
+    assert 'cog_prediction_duration_seconds_bucket{le="1"} 1\n' in text
+    assert (
+        'cog_prediction_duration_seconds_bucket{experiment="checkout",variant="b \\"new\\"",le="10"} 1\n'
+        in text
+    )
+    assert (
+        'cog_prediction_duration_seconds_count{experiment="checkout",variant="b \\"new\\""} 1\n'
+        in text
+    )
+    assert "cog_prediction_duration_seconds_count 1\n" in text
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"metrics": True}}
+)
+def test_metrics_endpoint(client):
+    assert client.get("/").json()["metrics_url"] == "/metrics"
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+
+    resp = client.get("/metrics")
+    assert resp.status_code == 200
+    assert 'cog_predictions_total{status="succeeded"} 1\n' in resp.text
+    assert "cog_prediction_duration_seconds_count 1\n" in resp.text
+    assert "cog_cache_hits_total" not in resp.text
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"metrics": True}}
+)
+def test_metrics_by_variant(client):
+    resp = client.post(
+        "/predictions",
+        json={"input": {"text": "baz"}},
+        headers={"Cog-Experiment": "checkout", "Cog-Variant": "b"},
+    )
+    assert resp.status_code == 200
+
+    resp = client.get("/metrics")
+    assert (
+        'cog_predictions_total{status="succeeded",experiment="checkout",variant="b"} 1\n'
+        in resp.text
+    )
+    assert 'cog_predictions_total{status="succeeded"} 0\n' in resp.text
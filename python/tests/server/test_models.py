@@ -0,0 +1,189 @@
+import pytest
+
+from cog.server.models import (
+    Model,
+    ModelNotFoundError,
+    ModelPool,
+    ModelPoolFullError,
+    make_model_pool,
+)
+
+from .conftest import _fixture_path, uses_predictor_with_client_options
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+class FakeRunner:
+    def __init__(self):
+        self.busy = False
+
+    def is_busy(self):
+        return self.busy
+
+    def predict(self, request, task_kwargs=None):
+        return request
+
+
+class FakeModel(Model):
+    def __init__(self, name, memory=None):
+        super().__init__(name, f"{name}.py:Predictor", is_async=False, memory=memory)
+        self.loads = 0
+
+    def load(self):
+        self.loads += 1
+        self.runner = FakeRunner()
+
+    def unload(self):
+        self.runner = None
+
+
+def loaded(pool):
+    return sorted(m.name for m in pool.models.values() if m.status == "loaded")
+
+
+def test_model_pool_loads_models_when_theyre_used():
+    pool = ModelPool([FakeModel("a"), FakeModel("b")])
+    assert loaded(pool) == []
+    assert pool.predict("a", "request") == "request"
+    pool.predict("a", "request")
+    assert loaded(pool) == ["a"]
+    assert pool.models["a"].loads == 1
+
+    with pytest.raises(ModelNotFoundError):
+        pool.predict("c", "request")
+
+
+def test_model_pool_unloads_least_recently_used_models():
+    clock = FakeClock()
+    pool = ModelPool([FakeModel("a"), FakeModel("b"), FakeModel("c")], 2, clock=clock)
+    for name in ["a", "b", "a"]:
+        clock.now += 1
+        pool.predict(name, "request")
+    assert loaded(pool) == ["a", "b"]
+
+    clock.now += 1
+    pool.predict("c", "request")
+    assert loaded(pool) == ["a", "c"]
+
+
+def test_model_pool_doesnt_unload_busy_models():
+    pool = ModelPool([FakeModel("a"), FakeModel("b")], max_loaded=1)
+    pool.predict("a", "request")
+    pool.models["a"].runner.busy = True
+    assert pool.is_busy()
+    with pytest.raises(ModelPoolFullError):
+        pool.predict("b", "request")
+    assert loaded(pool) == ["a"]
+
+    pool.models["a"].runner.busy = False
+    pool.predict("b", "request")
+    assert loaded(pool) == ["b"]
+
+
+def test_model_pool_max_memory():
+    pool = ModelPool(
+        [FakeModel("a", memory=6), FakeModel("b", memory=4), FakeModel("c", memory=5)],
+        max_memory=10,
+    )
+    pool.predict("a", "request")
+    pool.predict("b", "request")
+    assert loaded(pool) == ["a", "b"]
+    pool.predict("c", "request")
+    assert loaded(pool) == ["b", "c"]
+    assert pool.models["c"].to_dict() == {
+        "name": "c",
+        "status": "loaded",
+        "predictions_url": "/models/c/predictions",
+        "memory": 5,
+    }
+
+
+def test_make_model_pool():
+    pool = make_model_pool(
+        [
+            {"name": "a", "predict": "a.py:Predictor", "memory": "1Ki"},
+            {"name": "b", "predict": "b.py:Predictor"},
+        ],
+        {"max_loaded": 1, "max_memory": "2Ki"},
+        is_async={"a": True, "b": False},
+        max_concurrency=4,
+    )
+    assert (pool.max_loaded, pool.max_memory) == (1, 2048)
+    assert pool.models["a"].memory == 1024
+    assert pool.models["a"].max_concurrency == 4
+    assert pool.models["b"].memory is None
+    assert pool.models["b"].max_concurrency == 1
+
+
+MODELS = [
+    {"name": "cube", "predict": _fixture_path("input_integer")},
+    {"name": "broken", "predict": _fixture_path("exc_in_setup")},
+]
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"models": MODELS}
+)
+def test_models(client, match):
+    resp = client.get("/models")
+    assert resp.status_code == 200
+    assert resp.json() == [
+        {
+            "name": "cube",
+            "status": "unloaded",
+            "predictions_url": "/models/cube/predictions",
+        },
+        {
+            "name": "broken",
+            "status": "unloaded",
+            "predictions_url": "/models/broken/predictions",
+        },
+    ]
+    assert client.get("/").json()["models_url"] == "/models"
+
+    resp = client.post("/models/cube/predictions", json={"input": {"num": 3}})
+    assert resp.status_code == 200
+    assert resp.json() == match({"status": "succeeded", "output": 27})
+    assert client.get("/models").json()[0]["status"] == "loaded"
+
+    resp = client.put("/models/cube/predictions/abc", json={"input": {"num": 2}})
+    assert resp.json() == match({"id": "abc", "status": "succeeded", "output": 8})
+
+    # The model's inputs are validated against its own schema
+    resp = client.post("/models/cube/predictions", json={"input": {"text": "hi"}})
+    assert resp.status_code == 422
+
+    resp = client.post("/predictions", json={"input": {"text": "hi"}})
+    assert resp.json() == match({"status": "succeeded", "output": "hi"})
+
+    schema = client.get("/openapi.json").json()
+    assert "CubeInput" in schema["components"]["schemas"]
+    assert "CubeOutput" in schema["components"]["schemas"]
+
+    resp = client.post("/models/cube/predictions/abc/cancel")
+    assert resp.status_code == 404
+    resp = client.post("/models/nope/predictions/abc/cancel")
+    assert resp.status_code == 404
+    assert client.post("/models/nope/predictions", json={}).status_code == 404
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"models": MODELS}
+)
+def test_model_that_fails_setup(client):
+    resp = client.post("/models/broken/predictions", json={})
+    assert resp.status_code == 500
+    assert "Model broken failed to load" in resp.json()["detail"]
+    assert "setup error" in resp.json()["setup"]["logs"]
+    assert client.get("/models").json()[1]["status"] == "unloaded"
+
+    # The server keeps serving the other models
+    assert client.get("/health-check").json()["status"] == "READY"
+    resp = client.post("/models/cube/predictions", json={"input": {"num": 2}})
+    assert resp.json()["output"] == 8
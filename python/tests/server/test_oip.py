@@ -0,0 +1,160 @@
+import pytest
+
+from cog.server import oip
+
+from .conftest import uses_predictor
+
+SCHEMA = {
+    "components": {
+        "schemas": {
+            "Input": {
+                "type": "object",
+                "properties": {
+                    "steps": {"type": "integer", "x-order": 1},
+                    "prompt": {"type": "string", "x-order": 0},
+                    "image": {"type": "string", "format": "uri", "x-order": 2},
+                    "scheduler": {
+                        "allOf": [{"$ref": "#/components/schemas/scheduler"}],
+                        "x-order": 3,
+                    },
+                    "weights": {
+                        "type": "array",
+                        "items": {"type": "number"},
+                        "x-order": 4,
+                    },
+                    "options": {"type": "object", "x-order": 5},
+                },
+            },
+            "scheduler": {"type": "string", "enum": ["DDIM", "K_EULER"]},
+            "Output": {
+                "type": "object",
+                "properties": {
+                    "number": {"type": "integer"},
+                    "text": {"type": "string"},
+                },
+            },
+        }
+    }
+}
+
+
+def test_model_metadata():
+    assert oip.model_metadata("sdxl", SCHEMA) == {
+        "name": "sdxl",
+        "platform": "cog",
+        "inputs": [
+            {"name": "prompt", "datatype": "BYTES", "shape": [1]},
+            {"name": "steps", "datatype": "INT64", "shape": [1]},
+            {"name": "image", "datatype": "BYTES", "shape": [1]},
+            {"name": "scheduler", "datatype": "BYTES", "shape": [1]},
+            {"name": "weights", "datatype": "FP64", "shape": [-1]},
+        ],
+        "outputs": [
+            {"name": "number", "datatype": "INT64", "shape": [1]},
+            {"name": "text", "datatype": "BYTES", "shape": [1]},
+        ],
+    }
+
+
+def test_decode_inputs():
+    request = {
+        "inputs": [
+            {"name": "prompt", "datatype": "BYTES", "shape": [1], "data": ["a hotdog"]},
+            {"name": "steps", "datatype": "INT64", "shape": [1, 1], "data": [[20]]},
+            {"name": "weights", "datatype": "FP64", "shape": [2], "data": [0.5, 1.5]},
+        ],
+        "parameters": {"options": {"seed": 1}, "content_type": "ignored"},
+    }
+    assert oip.decode_inputs(request, SCHEMA) == {
+        "prompt": "a hotdog",
+        "steps": 20,
+        "weights": [0.5, 1.5],
+        "options": {"seed": 1},
+    }
+
+
+@pytest.mark.parametrize(
+    "request_body,message",
+    [
+        ({"inputs": [{"name": "nope", "data": [1]}]}, "doesn't have an input named"),
+        ({"inputs": [{"name": "steps", "data": [1, 2]}]}, "has 2 elements"),
+        ({"inputs": [{"name": "options", "data": [{}]}]}, "can't be a tensor"),
+        ({"inputs": "prompt"}, "must be a list"),
+    ],
+)
+def test_decode_inputs_errors(request_body, message):
+    with pytest.raises(oip.InferenceError, match=message):
+        oip.decode_inputs(request_body, SCHEMA)
+
+
+def test_encode_outputs():
+    assert oip.encode_outputs({"number": 42, "text": "meaning of life"}, SCHEMA) == [
+        {"name": "number", "datatype": "INT64", "shape": [1], "data": [42]},
+        {
+            "name": "text",
+            "datatype": "BYTES",
+            "shape": [1],
+            "data": ["meaning of life"],
+        },
+    ]
+    list_schema = {
+        "components": {
+            "schemas": {"Output": {"type": "array", "items": {"type": "string"}}}
+        }
+    }
+    assert oip.encode_outputs(["a", "b"], list_schema) == [
+        {"name": "output", "datatype": "BYTES", "shape": [2], "data": ["a", "b"]}
+    ]
+
+
+@uses_predictor("input_tensors")
+def test_infer(client):
+    resp = client.get("/v2/models/my-model")
+    assert resp.status_code == 200
+    assert resp.json()["inputs"] == [
+        {"name": "prompt", "datatype": "BYTES", "shape": [1]},
+        {"name": "weights", "datatype": "INT64", "shape": [-1]},
+        {"name": "scale", "datatype": "FP64", "shape": [1]},
+    ]
+
+    assert client.get("/v2/health/ready").status_code == 200
+    assert client.get("/v2/models/my-model/ready").json() == {"ready": True}
+
+    resp = client.post(
+        "/v2/models/my-model/infer",
+        json={
+            "id": "abc123",
+            "inputs": [
+                {
+                    "name": "prompt",
+                    "datatype": "BYTES",
+                    "shape": [1],
+                    "data": ["hotdog"],
+                },
+                {"name": "weights", "datatype": "INT64", "shape": [2], "data": [1, 2]},
+                {"name": "scale", "datatype": "FP64", "shape": [1], "data": [0.5]},
+            ],
+        },
+    )
+    assert resp.status_code == 200
+    assert resp.json() == {
+        "model_name": "my-model",
+        "id": "abc123",
+        "outputs": [
+            {"name": "output", "datatype": "FP64", "shape": [2], "data": [3.0, 6.0]}
+        ],
+    }
+
+
+@uses_predictor("input_tensors")
+def test_infer_bad_input(client):
+    resp = client.post(
+        "/v2/models/my-model/infer",
+        json={"inputs": [{"name": "prompt", "data": ["a", "b"]}]},
+    )
+    assert resp.status_code == 400
+    assert "has 2 elements" in resp.json()["error"]
+
+    resp = client.post("/v2/models/my-model/infer", json={"inputs": []})
+    assert resp.status_code == 400
+    assert "prompt" in resp.json()["error"]
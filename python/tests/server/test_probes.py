@@ -43,6 +43,17 @@ def test_creates_probe_dir_if_needed(tmpdir):
     assert os.path.isfile(os.path.join(tmpdir, "probes", "ready"))
 
 
+def test_probe_dir_from_environment(tmpdir):
+    root = os.path.join(tmpdir, "state", "cog")
+    with mock.patch.dict(
+        os.environ, {"KUBERNETES_SERVICE_HOST": "0.0.0.0", "COG_PROBE_DIR": root}
+    ):
+        p = ProbeHelper()
+        p.ready()
+
+    assert os.path.isfile(os.path.join(root, "ready"))
+
+
 @mock.patch.dict(os.environ, {"KUBERNETES_SERVICE_HOST": "0.0.0.0"})
 def test_no_exception_when_probe_dir_exists(tmpdir, caplog):
     root = os.path.join(tmpdir, "probes")
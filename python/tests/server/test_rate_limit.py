@@ -0,0 +1,115 @@
+from cog.server.rate_limit import RateLimiter, make_rate_limiter
+
+from .conftest import uses_predictor_with_client_options
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+def test_rate_limiter_global():
+    clock = FakeClock()
+    limiter = RateLimiter(requests_per_second=2, burst=3, clock=clock)
+    assert [limiter.acquire("a") for _ in range(3)] == [0, 0, 0]
+    assert limiter.acquire("b") == 0.5
+
+    clock.now = 0.5
+    assert limiter.acquire("b") == 0
+    assert limiter.acquire("a") == 0.5
+
+
+def test_rate_limiter_per_client():
+    clock = FakeClock()
+    limiter = RateLimiter(per_client_requests_per_second=0.5, clock=clock)
+    assert limiter.acquire("a") == 0
+    assert limiter.acquire("a") == 2
+    # Other clients have their own limit
+    assert limiter.acquire("b") == 0
+
+    clock.now = 2
+    assert limiter.acquire("a") == 0
+
+
+def test_rate_limiter_rejected_requests_dont_use_global_limit():
+    clock = FakeClock()
+    limiter = RateLimiter(
+        requests_per_second=10, per_client_requests_per_second=1, clock=clock
+    )
+    assert limiter.acquire("a") == 0
+    for _ in range(20):
+        assert limiter.acquire("a") > 0
+    assert limiter.acquire("b") == 0
+
+
+def test_make_rate_limiter():
+    assert make_rate_limiter({}) is None
+    assert isinstance(make_rate_limiter({"requests_per_second": 1}), RateLimiter)
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    additional_config={
+        "serve": {"rate_limit": {"per_client_requests_per_second": 0.01}}
+    },
+)
+def test_predictions_are_rate_limited(client):
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 200
+
+    resp = client.post("/predictions", json={"input": {"text": "baz"}})
+    assert resp.status_code == 429
+    assert resp.headers["Retry-After"] == "100"
+
+    # Other endpoints aren't limited
+    resp = client.get("/health-check")
+    assert resp.status_code == 200
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    env={"COG_API_KEYS": "key1,key2"},
+    additional_config={
+        "serve": {
+            "auth": {"type": "api_key"},
+            "rate_limit": {"per_client_requests_per_second": 0.01},
+        }
+    },
+)
+def test_predictions_are_rate_limited_per_api_key(client):
+    def predict(key):
+        return client.post(
+            "/predictions",
+            json={"input": {"text": "baz"}},
+            headers={"Authorization": f"Bearer {key}"},
+        )
+
+    assert predict("key1").status_code == 200
+    assert predict("key1").status_code == 429
+    assert predict("key2").status_code == 200
+
+
+@uses_predictor_with_client_options(
+    "input_string",
+    additional_config={
+        "serve": {"rate_limit": {"per_client_requests_per_second": 0.01}}
+    },
+)
+def test_inference_protocol_is_rate_limited(client):
+    body = {
+        "inputs": [
+            {"name": "text", "datatype": "BYTES", "shape": [1], "data": ["baz"]}
+        ]
+    }
+    resp = client.post("/v2/models/my-model/infer", json=body)
+    assert resp.status_code == 200
+
+    resp = client.post("/v2/models/my-model/infer", json=body)
+    assert resp.status_code == 429
+
+    # Its health checks aren't limited
+    resp = client.get("/v2/health/ready")
+    assert resp.status_code == 200
@@ -0,0 +1,49 @@
+from .conftest import uses_predictor_with_client_options
+
+HELLO = "data:text/plain; charset=utf-8;base64,aGVsbG8="
+WORLD = "data:text/plain; charset=utf-8;base64,d29ybGQ="
+BROKEN = "data:text/plain; charset=utf-8;base64,YnJva2Vu"
+
+
+@uses_predictor_with_client_options("reload_weights", env={"COG_WEIGHTS": HELLO})
+def test_reload(client, match):
+    resp = client.post("/predictions", json={"input": {}})
+    assert resp.json() == match({"status": "succeeded", "output": "hello"})
+
+    resp = client.post(
+        "/predictions",
+        json={"id": "slow", "input": {"sleep": 10}},
+        headers={"Prefer": "respond-async"},
+    )
+    assert resp.status_code == 202
+
+    resp = client.post("/admin/reload", json={"weights": WORLD})
+    assert resp.status_code == 200
+    assert resp.json()["setup"]["status"] == "succeeded"
+    assert client.get("/health-check").json()["status"] == "READY"
+
+    # New predictions run on the new weights, while the old model carries on
+    # with the prediction it was running
+    resp = client.post("/predictions", json={"input": {}})
+    assert resp.json() == match({"status": "succeeded", "output": "world"})
+    assert client.post("/predictions/slow/cancel").status_code == 200
+
+    # Without weights, the model reloads with the weights it has
+    resp = client.post("/admin/reload")
+    assert resp.status_code == 200
+    resp = client.post("/predictions", json={"input": {}})
+    assert resp.json() == match({"status": "succeeded", "output": "world"})
+
+
+@uses_predictor_with_client_options("reload_weights", env={"COG_WEIGHTS": HELLO})
+def test_reload_that_fails_setup(client, match):
+    resp = client.post("/admin/reload", json={"weights": BROKEN})
+    assert resp.status_code == 500
+    assert resp.json()["detail"] == "The model failed to reload"
+    assert resp.json()["setup"]["status"] == "failed"
+    assert "broken weights" in resp.json()["setup"]["logs"]
+
+    # The old model keeps serving
+    assert client.get("/health-check").json()["status"] == "READY"
+    resp = client.post("/predictions", json={"input": {}})
+    assert resp.json() == match({"status": "succeeded", "output": "hello"})
@@ -0,0 +1,151 @@
+import json
+import time
+
+from cog import schema
+from cog.server.cache import MemoryBackend, RedisError
+from cog.server.results import (
+    PostgresBackend,
+    PredictionResults,
+    S3Backend,
+    make_prediction_results,
+)
+
+from .conftest import uses_predictor_with_client_options
+
+
+class FakeClock:
+    def __init__(self):
+        self.now = 0.0
+
+    def __call__(self):
+        return self.now
+
+
+class FakeS3Sink:
+    def __init__(self):
+        self.files = {}
+
+    def write(self, name, data):
+        self.files[name] = data
+
+    def read(self, name):
+        return self.files.get(name)
+
+
+class FakeCursor:
+    def __init__(self, conn):
+        self.conn = conn
+        self.description = None
+
+    def __enter__(self):
+        return self
+
+    def __exit__(self, *args):
+        pass
+
+    def execute(self, sql, params):
+        self.conn.statements.append((sql.split(" (")[0], params))
+        self.description = [("response",)] if sql.startswith("SELECT") else None
+
+    def fetchall(self):
+        return [('{"id": "a"}',)]
+
+
+class FakeConnection:
+    def __init__(self):
+        self.statements = []
+        self.autocommit = False
+
+    def cursor(self):
+        return FakeCursor(self)
+
+
+class BrokenBackend:
+    def get(self, key):
+        raise RedisError("connection refused")
+
+    def set(self, key, value, ttl):
+        raise RedisError("connection refused")
+
+
+def test_s3_backend_expires_results():
+    clock = FakeClock()
+    sink = FakeS3Sink()
+    backend = S3Backend(sink, clock=clock)
+    backend.set("a", b'{"id": "a"}', ttl=10)
+    assert json.loads(sink.files["a.json"]) == {
+        "expires_at": 10,
+        "response": {"id": "a"},
+    }
+    assert backend.get("a") == b'{"id": "a"}'
+    assert backend.get("b") is None
+    clock.now = 10
+    assert backend.get("a") is None
+
+
+def test_postgres_backend():
+    conn = FakeConnection()
+    backend = PostgresBackend("postgres://localhost/cog", connect=lambda url: conn)
+    backend.set("a", b'{"id": "a"}', ttl=60)
+    assert backend.get("a") == b'{"id": "a"}'
+    assert conn.autocommit
+    assert conn.statements == [
+        ("CREATE TABLE IF NOT EXISTS cog_predictions", ()),
+        ("INSERT INTO cog_predictions", ("a", '{"id": "a"}', 60)),
+        ("DELETE FROM cog_predictions WHERE expires_at <= now()", ()),
+        ("SELECT response::text FROM cog_predictions WHERE id = %s AND", ("a",)),
+    ]
+
+
+def test_prediction_results():
+    results = PredictionResults(MemoryBackend(), ttl=60)
+    results.save(
+        schema.PredictionResponse(id="a", status=schema.Status.SUCCEEDED, output=1)
+    )
+    # Predictions without IDs can't be fetched
+    results.save(schema.PredictionResponse(status=schema.Status.SUCCEEDED))
+    results.stop()
+    assert results.get("a")["output"] == 1
+    assert results.get("b") is None
+
+
+def test_prediction_results_store_failures_are_logged():
+    results = PredictionResults(BrokenBackend())
+    results.save(schema.PredictionResponse(id="a", status=schema.Status.SUCCEEDED))
+    results.stop()
+    assert results.get("a") is None
+
+
+def test_make_prediction_results():
+    assert make_prediction_results({}) is None
+    results = make_prediction_results({"backend": "memory", "ttl": 60})
+    assert isinstance(results.backend, MemoryBackend)
+    assert results.ttl == 60
+    # Redis and Postgres need URLs, and S3 needs credentials
+    assert make_prediction_results({"backend": "redis"}) is None
+    assert make_prediction_results({"backend": "postgres"}) is None
+    assert make_prediction_results({"backend": "s3", "url": "s3://bucket"}) is None
+
+
+@uses_predictor_with_client_options(
+    "input_string", additional_config={"serve": {"results": {"backend": "memory"}}}
+)
+def test_async_predictions_can_be_fetched_after_they_finish(client):
+    resp = client.put(
+        "/predictions/abc",
+        json={"input": {"text": "baz"}},
+        headers={"Prefer": "respond-async"},
+    )
+    assert resp.status_code == 202
+
+    deadline = time.time() + 10
+    while True:
+        resp = client.get("/predictions/abc")
+        assert resp.status_code == 200
+        if resp.json()["status"] == "succeeded" or time.time() > deadline:
+            break
+        time.sleep(0.01)
+    assert resp.json()["output"] == "baz"
+
+    resp = client.get("/predictions/missing")
+    assert resp.status_code == 404
@@ -71,9 +71,10 @@ class FakeWorker:
             if isinstance(event, Done):
                 self._setup_future.set_result(event)
 
-    def predict(self, payload, tag=None):
+    def predict(self, payload, tag=None, method=None):
         assert tag not in self._predict_futures or self._predict_futures[tag].done()
         self.last_prediction_payload = payload
+        self.last_prediction_method = method
         self._predict_futures[tag] = Future()
         print(f"setting {tag}, now {self._predict_futures}")
         return self._predict_futures[tag]
@@ -0,0 +1,99 @@
+import json
+from datetime import datetime, timezone
+
+import pytest
+
+from cog.server.recorder import DirectorySink
+from cog.server.scheduler import Cron, CronError, Schedule, ScheduledPredictions
+
+
+def _utc(*args):
+    return datetime(*args, tzinfo=timezone.utc)
+
+
+@pytest.mark.parametrize(
+    "expression,after,expected",
+    [
+        ("* * * * *", _utc(2024, 5, 24, 12, 30, 15), _utc(2024, 5, 24, 12, 31)),
+        ("0 * * * *", _utc(2024, 5, 24, 12, 30), _utc(2024, 5, 24, 13, 0)),
+        ("@daily", _utc(2024, 12, 31, 23, 59), _utc(2025, 1, 1, 0, 0)),
+        ("*/15 9-17 * * mon-fri", _utc(2024, 5, 24, 17, 50), _utc(2024, 5, 27, 9, 0)),
+        ("30 6 1,15 * *", _utc(2024, 5, 2), _utc(2024, 5, 15, 6, 30)),
+        ("0 0 29 feb *", _utc(2024, 3, 1), _utc(2028, 2, 29)),
+        # Sunday is 0 and 7
+        ("0 0 * * 7", _utc(2024, 5, 24), _utc(2024, 5, 26)),
+        # Either the day of the month or the day of the week can match
+        ("0 0 1 * 1", _utc(2024, 5, 24), _utc(2024, 5, 27)),
+        ("5/20 * * * *", _utc(2024, 5, 24, 12, 30), _utc(2024, 5, 24, 12, 45)),
+    ],
+)
+def test_cron_next_after(expression, after, expected):
+    assert Cron(expression).next_after(after) == expected
+
+
+@pytest.mark.parametrize(
+    "expression,message",
+    [
+        ("* * * *", "should have 5 fields"),
+        ("60 * * * *", "must be between 0 and 59"),
+        ("* * * foo *", "'foo' isn't a number"),
+        ("*/0 * * * *", "the step must be a positive number"),
+        ("* 5-1 * * *", "is backwards"),
+        ("0 0 31 2 *", "never matches"),
+    ],
+)
+def test_cron_invalid(expression, message):
+    with pytest.raises(CronError, match=message):
+        Cron(expression)
+
+
+def test_schedule_parse(tmp_path):
+    schedule = Schedule.parse("@hourly", '{"days": 7}', "s3://bucket/forecasts")
+    assert schedule.cron.expression == "@hourly"
+    assert schedule.inputs == {"days": 7}
+    assert schedule.destination == "s3://bucket/forecasts"
+
+    path = tmp_path / "input.json"
+    path.write_text('{"text": "hello"}')
+    assert Schedule.parse("@hourly", f"@{path}", "outputs").inputs == {"text": "hello"}
+
+    with pytest.raises(ValueError, match="must be a JSON object"):
+        Schedule.parse("@hourly", "[1]", "outputs")
+
+
+def test_scheduled_prediction_is_written(tmp_path):
+    output_path = tmp_path / "forecast.csv"
+    output_path.write_text("day,temperature\n")
+    inputs = []
+
+    def predict(i):
+        inputs.append(i)
+        return {
+            "id": "abc",
+            "status": "succeeded",
+            "input": i,
+            "output": [output_path, output_path],
+        }
+
+    sink = DirectorySink(str(tmp_path / "outputs"))
+    scheduled = ScheduledPredictions(Cron("@daily"), {"days": 7}, sink, predict)
+    scheduled.run(_utc(2024, 5, 24))
+
+    assert inputs == [{"days": 7}]
+    run_dir = tmp_path / "outputs" / "20240524T0000Z"
+    prediction = json.loads((run_dir / "prediction.json").read_text())
+    assert prediction["id"] == "abc"
+    assert prediction["output"] == ["forecast.csv", "forecast-1.csv"]
+    assert (run_dir / "forecast.csv").read_text() == "day,temperature\n"
+    assert (run_dir / "forecast-1.csv").read_text() == "day,temperature\n"
+
+
+def test_scheduled_prediction_error_is_logged(tmp_path):
+    def predict(_):
+        raise RuntimeError("the model is busy")
+
+    sink = DirectorySink(str(tmp_path))
+    scheduled = ScheduledPredictions(Cron("@daily"), {}, sink, predict)
+    # It's logged, so the next run still happens
+    scheduled.run(_utc(2024, 5, 24))
+    assert list(tmp_path.iterdir()) == []
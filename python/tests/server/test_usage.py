@@ -0,0 +1,62 @@
+from cog.server.usage import RAPL, UsageMeter
+
+
+class FakeNVML:
+    def __init__(self, readings):
+        self.readings = iter(readings)
+
+    def energy(self):
+        return next(self.readings)
+
+
+def _rapl_domain(path, energy_uj, max_energy_uj=1_000_000_000):
+    path.mkdir()
+    (path / "energy_uj").write_text(f"{energy_uj}\n")
+    (path / "max_energy_range_uj").write_text(f"{max_energy_uj}\n")
+
+
+def test_rapl(tmp_path):
+    _rapl_domain(tmp_path / "intel-rapl:0", 5_000_000)
+    _rapl_domain(tmp_path / "intel-rapl:1", 999_000_000)
+    # Subdomains are included in their package's counter
+    _rapl_domain(tmp_path / "intel-rapl:0:0", 1_000_000)
+
+    rapl = RAPL.load(str(tmp_path / "intel-rapl:[0-9]*"))
+    assert rapl is not None
+    assert rapl.domains == [
+        str(tmp_path / "intel-rapl:0"),
+        str(tmp_path / "intel-rapl:1"),
+    ]
+    start = rapl.counters()
+    (tmp_path / "intel-rapl:0" / "energy_uj").write_text("7000000\n")
+    # This one wrapped around
+    (tmp_path / "intel-rapl:1" / "energy_uj").write_text("1000000\n")
+    assert rapl.joules_since(start) == 2 + 2
+
+
+def test_rapl_unavailable(tmp_path):
+    assert RAPL.load(str(tmp_path / "intel-rapl:[0-9]*")) is None
+
+
+def test_usage_meter():
+    times = iter([10.0, 12.5])
+    cpu_times = iter([1.0, 1.75])
+    meter = UsageMeter(
+        nvml=FakeNVML([1000.0, 1450.0]),
+        gpu_count=2,
+        clock=lambda: next(times),
+        cpu_time=lambda: next(cpu_times),
+    )
+    start = meter.start()
+    assert meter.stop(start) == {"cpu_time": 0.75, "gpu_time": 5.0, "energy": 450.0}
+
+
+def test_usage_meter_without_gpus():
+    cpu_times = iter([1.0, 3.0])
+    meter = UsageMeter(cpu_time=lambda: next(cpu_times))
+    assert meter.stop(meter.start()) == {"cpu_time": 2.0}
+
+
+def test_usage_meter_gpu_energy_unsupported():
+    meter = UsageMeter(nvml=FakeNVML([None, None]), gpu_count=1)
+    assert "energy" not in meter.stop(meter.start())
@@ -29,7 +29,8 @@ from cog.server.eventtypes import (
     PredictionOutputType,
 )
 from cog.server.exceptions import FatalWorkerException, InvalidStateException
-from cog.server.worker import Worker, _PublicEventType
+from cog.server.usage import USAGE_METRICS
+from cog.server.worker import Worker, _PublicEventType, _crash_message
 
 from .conftest import WorkerConfig, uses_worker, uses_worker_configs
 
@@ -60,12 +61,14 @@ SETUP_FATAL_FIXTURES = [
 PREDICTION_FATAL_FIXTURES = [
     "exit_in_predict",
     "killed_in_predict",
+    "segfault_in_predict",
 ]
 
 RUNNABLE_FIXTURES = [
     "simple",
     "exc_in_predict",
     "missing_predict",
+    "oom_in_predict",
 ]
 
 METRICS_FIXTURES = [
@@ -182,6 +185,8 @@ class Result:
     stderr_lines: List[str] = field(factory=list)
     heartbeat_count: int = 0
     metrics: Optional[Dict[str, Any]] = None
+    # The resources the prediction used, which are measured for every prediction
+    usage: Dict[str, float] = field(factory=dict)
     output_type: Optional[PredictionOutputType] = None
     output: Any = None
     done: Optional[Done] = None
@@ -205,6 +210,8 @@ class Result:
         elif isinstance(event, Done):
             assert not self.done
             self.done = event
+        elif isinstance(event, PredictionMetric) and event.name in USAGE_METRICS:
+            self.usage[event.name] = event.value
         elif isinstance(event, PredictionMetric):
             if self.metrics is None:
                 self.metrics = {}
@@ -269,6 +276,62 @@ def test_fatalworkerexception_from_irrecoverable_failures(worker):
         _process(worker, lambda: worker.predict({}))
 
 
+@uses_worker("segfault_in_predict")
+def test_crashes_are_reported_with_the_stack(worker):
+    """
+    Crashes in native code can't be caught, but the stack of each of the
+    child's threads is added to the logs, and the error says why it crashed.
+    """
+    result = _process(worker, lambda: worker.predict({}), swallow_exceptions=True)
+
+    assert isinstance(result.exception, FatalWorkerException)
+    assert "crashed with SIGSEGV" in str(result.exception)
+    assert "Fatal Python error: Segmentation fault" in result.stderr
+    assert "in predict" in result.stderr
+
+
+def test_crash_message():
+    assert (
+        _crash_message("Prediction", -11)
+        == "Prediction failed because the model crashed with SIGSEGV (exitcode -11)"
+    )
+    # Processes are killed with SIGKILL when they run out of memory
+    assert "It might have run out of memory?" in _crash_message("Prediction", -9)
+    assert "It might have run out of memory?" in _crash_message("Prediction", 1)
+
+
+@uses_worker("oom_in_predict")
+def test_out_of_memory_errors_are_recognised(worker):
+    result = _process(worker, lambda: worker.predict({"batch_size": 4}))
+
+    assert result.done.error
+    assert result.done.error_type == "cuda_out_of_memory"
+    assert "retried" not in result.stderr
+
+
+@uses_worker_configs(
+    [
+        WorkerConfig(
+            "oom_in_predict", retry_on_oom=True, oom_batch_size_input="batch_size"
+        )
+    ]
+)
+def test_predictions_that_run_out_of_memory_are_retried(worker):
+    result = _process(worker, lambda: worker.predict({"batch_size": 4}))
+
+    assert not result.done.error
+    assert result.output == 2
+    assert "CUDA out of memory" in result.stderr
+    assert "retried with batch_size=2" in result.stderr
+
+    # They're only retried once
+    result = _process(worker, lambda: worker.predict({"batch_size": 8}))
+
+    assert result.done.error
+    assert result.done.error_type == "cuda_out_of_memory"
+    assert "retried with batch_size=4" in result.stderr
+
+
 @uses_worker(RUNNABLE_FIXTURES)
 def test_no_exceptions_from_recoverable_failures(worker):
     """
@@ -431,6 +494,125 @@ def test_concurrency_with_sync_predictor_raises_error(worker):
     )
 
 
+BATCH_FIXTURES = [
+    WorkerConfig("batch", max_batch_size=4, max_batch_latency=1),
+    WorkerConfig(
+        "batch_async",
+        min_python=(3, 11),
+        is_async=True,
+        max_batch_size=4,
+        max_batch_latency=1,
+    ),
+]
+
+
+@uses_worker_configs(BATCH_FIXTURES)
+def test_predictions_are_batched(worker: Worker):
+    results = [Result() for _ in range(4)]
+    sids = [
+        worker.subscribe(result.handle_event, tag=f"p{i}")
+        for i, result in enumerate(results)
+    ]
+    try:
+        futs = [
+            worker.predict({"text": f"{i}", "repeat": 2}, tag=f"p{i}")
+            for i in range(4)
+        ]
+        # The batch is full, so it runs without waiting for the latency window
+        for fut in futs:
+            assert fut.result(timeout=0.9) == Done()
+    finally:
+        for sid in sids:
+            worker.unsubscribe(sid)
+
+    for i, result in enumerate(results):
+        assert result.output == f"{i}{i}"
+        assert result.metrics == {"batch_size": 4}
+        # Logs from the batch go to each prediction in it
+        assert result.stdout == "running a batch of 4\n"
+
+
+@uses_worker_configs(BATCH_FIXTURES)
+def test_batch_runs_after_latency_window(worker: Worker):
+    start = time.perf_counter()
+    result = _process(worker, lambda: worker.predict({"text": "a"}, "p1"), tag="p1")
+    assert time.perf_counter() - start >= 1
+    assert result.output == "a"
+    assert result.metrics == {"batch_size": 1}
+
+
+@uses_worker_configs(BATCH_FIXTURES)
+def test_batch_usage_is_split(worker: Worker):
+    results = [Result() for _ in range(4)]
+    sids = [
+        worker.subscribe(result.handle_event, tag=f"p{i}")
+        for i, result in enumerate(results)
+    ]
+    try:
+        futs = [
+            worker.predict({"text": f"{i}", "repeat": 2}, tag=f"p{i}")
+            for i in range(4)
+        ]
+        for fut in futs:
+            fut.result(timeout=5)
+    finally:
+        for sid in sids:
+            worker.unsubscribe(sid)
+
+    cpu_times = [result.usage["cpu_time"] for result in results]
+    assert all(t >= 0 for t in cpu_times)
+    assert len(set(cpu_times)) == 1
+
+
+@uses_worker_configs(BATCH_FIXTURES)
+def test_cancel_prediction_waiting_for_batch(worker: Worker):
+    fut = worker.predict({"text": "a"}, "p1")
+    time.sleep(0.1)
+    worker.cancel("p1")
+    assert fut.result(timeout=0.5) == Done(canceled=True)
+
+    result = _process(worker, lambda: worker.predict({"text": "b"}, "p2"), tag="p2")
+    assert result.output == "b"
+
+
+@uses_worker_configs(
+    [WorkerConfig("batch_sleep", max_batch_size=4, max_batch_latency=0.1)]
+)
+def test_cancel_prediction_queued_behind_batch(worker: Worker):
+    running = worker.predict({"text": "a", "sleep": 1}, "p1")
+    time.sleep(0.5)
+    queued = worker.predict({"text": "b"}, "p2")
+    time.sleep(0.1)
+    worker.cancel("p2")
+
+    # Canceling the queued prediction doesn't cancel the batch that's running
+    assert running.result(timeout=2) == Done()
+    assert queued.result(timeout=2) == Done(canceled=True)
+
+
+@uses_worker_configs([WorkerConfig("simple", max_batch_size=4, setup=False)])
+def test_batching_without_predict_batch_raises_error(worker):
+    fut = worker.setup()
+    result = Result()
+    worker.subscribe(result.handle_event)
+
+    with pytest.raises(FatalWorkerException):
+        fut.result()
+    assert result.done
+    assert result.done.error
+    assert (
+        result.done.error_detail
+        == "batching is set in cog.yaml, but the predictor doesn't have a predict_batch() method"
+    )
+
+
+@uses_worker("hello_world")
+def test_usage_is_measured(worker: Worker):
+    result = _process(worker, lambda: worker.predict({"name": "world"}))
+    assert result.usage["cpu_time"] >= 0
+    assert result.metrics is None
+
+
 @uses_worker("stream_redirector_race_condition")
 def test_stream_redirector_race_condition(worker):
     """
@@ -0,0 +1,44 @@
+import os
+
+from cog.command.check_imports import check_imports
+from cog.config import Config
+
+
+def write_predictor(tmp_path, name, source):
+    path = os.path.join(tmp_path, name)
+    with open(path, "w", encoding="utf-8") as f:
+        f.write(source)
+    return path
+
+
+def test_check_imports(tmp_path):
+    path = write_predictor(
+        tmp_path,
+        "predict.py",
+        "from cog import BasePredictor\n\nclass Predictor(BasePredictor):\n    def setup(self):\n        raise RuntimeError('setup ran')\n",
+    )
+    assert check_imports(Config({"predict": f"{path}:Predictor"})) == []
+
+
+def test_check_imports_missing_package(tmp_path):
+    path = write_predictor(tmp_path, "predict.py", "import not_a_real_package.sub\n")
+    errors = check_imports(Config({"predict": f"{path}:Predictor"}))
+    assert len(errors) == 1
+    assert "imports not_a_real_package.sub, which isn't installed" in errors[0]
+    assert "that not_a_real_package is in" in errors[0]
+
+
+def test_check_imports_syntax_error(tmp_path):
+    path = write_predictor(tmp_path, "predict.py", "x = 1\ndef predict(:\n")
+    errors = check_imports(Config({"predict": f"{path}:Predictor"}))
+    assert len(errors) == 1
+    assert errors[0].startswith(f"{path}:2: ")
+
+
+def test_check_imports_train_in_same_file(tmp_path):
+    path = write_predictor(tmp_path, "predict.py", "raise ValueError('broken')\n")
+    errors = check_imports(
+        Config({"predict": f"{path}:Predictor", "train": f"{path}:train"})
+    )
+    assert len(errors) == 1
+    assert "ValueError: broken" in errors[0]
@@ -289,3 +289,9 @@ async def train(
             "Predict output type should be the training Output."
         )
         assert is_async, "is_async should be True for async functions"
+
+
+def test_environment_variables():
+    config = Config(config={"environment_variables": {"MODEL_CACHE": "/src/.cache"}})
+    assert config.environment_variables == {"MODEL_CACHE": "/src/.cache"}
+    assert Config(config={}).environment_variables == {}
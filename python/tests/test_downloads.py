@@ -0,0 +1,162 @@
+import io
+
+import pytest
+import responses
+
+from cog import downloads
+from cog.downloads import DownloadError, DownloadPolicy, parse_quantity
+from cog.types import File, URLFile
+
+
+@pytest.fixture
+def policy(monkeypatch):
+    def set_policy(**kwargs):
+        monkeypatch.setattr(downloads, "_policy", DownloadPolicy(**kwargs))
+
+    return set_policy
+
+
+@pytest.mark.parametrize(
+    "value,expected",
+    [
+        ("1024", 1024),
+        ("512M", 512_000_000),
+        ("512Mi", 512 * 1024 * 1024),
+        ("16GB", 16_000_000_000),
+        ("1.5G", 1_500_000_000),
+    ],
+)
+def test_parse_quantity(value, expected):
+    assert parse_quantity(value) == expected
+
+
+@pytest.mark.parametrize("value", ["", "lots", "16X", "16i"])
+def test_parse_quantity_invalid(value):
+    with pytest.raises(ValueError):
+        parse_quantity(value)
+
+
+def test_from_config():
+    policy = DownloadPolicy.from_config(
+        {"max_size": "100M", "timeout": 30, "allowed_schemes": ["https"]}
+    )
+    assert policy.max_size == 100_000_000
+    assert policy.timeout == 30
+    assert policy.allowed_schemes == ["https"]
+    assert policy.allowed_hosts is None
+
+
+def test_check_url():
+    policy = DownloadPolicy(
+        allowed_schemes=["https", "data"], allowed_hosts=["*.example.com", "foo.com"]
+    )
+    policy.check_url("https://cdn.example.com/a.png")
+    policy.check_url("https://FOO.com/a.png")
+    policy.check_url("data:text/plain,hello")
+
+    with pytest.raises(DownloadError, match="scheme 'http' is not allowed"):
+        policy.check_url("http://foo.com/a.png")
+    with pytest.raises(DownloadError, match="host 'example.com' is not allowed"):
+        policy.check_url("https://example.com/a.png")
+    with pytest.raises(DownloadError, match="host 'evilexample.com' is not allowed"):
+        policy.check_url("https://evilexample.com/a.png")
+
+
+def test_check_content_type():
+    policy = DownloadPolicy(allowed_content_types=["image/*", "application/json"])
+    policy.check_content_type("image/png")
+    policy.check_content_type("application/json; charset=utf-8")
+
+    with pytest.raises(DownloadError, match="Content type 'text/html' is not allowed"):
+        policy.check_content_type("text/html")
+    with pytest.raises(DownloadError):
+        policy.check_content_type(None)
+
+
+def test_file_validate_checks_url(policy):
+    policy(allowed_schemes=["https"])
+    with pytest.raises(DownloadError):
+        File.validate("data:text/plain,hello")
+
+
+def test_file_validate_data_url_size(policy):
+    policy(max_size=3)
+    with pytest.raises(DownloadError, match="maximum size of 3 bytes"):
+        File.validate("data:text/plain,hello")
+
+
+@responses.activate
+def test_urlfile_content_length_too_large(policy):
+    policy(max_size=3)
+    responses.get("https://example.com/some/url", body="hello world", status=200)
+
+    u = URLFile("https://example.com/some/url")
+    with pytest.raises(DownloadError):
+        u.read()
+
+
+@responses.activate
+def test_urlfile_content_type(policy):
+    policy(allowed_content_types=["image/*"])
+    responses.get(
+        "https://example.com/some/url",
+        body="hello",
+        content_type="text/plain",
+        status=200,
+    )
+
+    u = URLFile("https://example.com/some/url")
+    with pytest.raises(DownloadError, match="text/plain"):
+        u.read()
+
+
+@responses.activate
+def test_urlfile_redirect_to_host_that_isnt_allowed(policy):
+    policy(allowed_hosts=["example.com"])
+    responses.get(
+        "https://example.com/some/url",
+        status=302,
+        headers={"Location": "http://169.254.169.254/latest/meta-data/"},
+    )
+    internal = responses.get("http://169.254.169.254/latest/meta-data/", body="x")
+
+    u = URLFile("https://example.com/some/url")
+    with pytest.raises(DownloadError, match="host '169.254.169.254' is not allowed"):
+        u.read()
+    assert internal.call_count == 0
+
+
+@responses.activate
+def test_urlfile_redirect_to_host_that_is_allowed(policy):
+    policy(allowed_hosts=["example.com", "*.example.com"])
+    responses.get(
+        "https://example.com/some/url",
+        status=302,
+        headers={"Location": "https://cdn.example.com/file.txt"},
+    )
+    responses.get("https://cdn.example.com/file.txt", body="hello", status=200)
+
+    u = URLFile("https://example.com/some/url")
+    assert u.read() == b"hello"
+
+
+@responses.activate
+def test_urlfile_too_many_redirects(policy):
+    policy()
+    responses.get(
+        "https://example.com/some/url",
+        status=302,
+        headers={"Location": "/some/url"},
+    )
+
+    u = URLFile("https://example.com/some/url")
+    with pytest.raises(DownloadError, match="Too many redirects"):
+        u.read()
+
+
+def test_limited_reader():
+    reader = downloads.LimitedReader(
+        io.BytesIO(b"hello world"), DownloadPolicy(max_size=5)
+    )
+    with pytest.raises(DownloadError):
+        reader.read()
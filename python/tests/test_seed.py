@@ -0,0 +1,26 @@
+import random
+
+from cog.seed import COG_SEED_ENV_VAR, seed_from_env
+
+
+def test_seed_from_env(monkeypatch):
+    monkeypatch.setenv(COG_SEED_ENV_VAR, "42")
+    seed_from_env()
+    first = [random.random() for _ in range(3)]
+    seed_from_env()
+    second = [random.random() for _ in range(3)]
+    assert first == second
+
+
+def test_seed_from_env_not_set(monkeypatch):
+    monkeypatch.delenv(COG_SEED_ENV_VAR, raising=False)
+    random.seed(1)
+    seed_from_env()
+    assert random.random() == random.Random(1).random()
+
+
+def test_seed_from_env_invalid(monkeypatch):
+    monkeypatch.setenv(COG_SEED_ENV_VAR, "not-a-number")
+    random.seed(1)
+    seed_from_env()
+    assert random.random() == random.Random(1).random()